@@ -192,13 +192,28 @@ type BidAsk struct {
 	Qty   float64 `json:"qty"`
 }
 
-// FundingRate 資金費率
+// FundingRate 資金費率（含標記價/指數價/未平倉量，供 S2 計算 carry 特徵）
 type FundingRate struct {
-	Symbol    string    `json:"symbol"`
-	Rate      float64   `json:"rate"`
-	NextRate  float64   `json:"next_rate"`
-	Timestamp int64     `json:"timestamp"`
-	CreatedAt time.Time `json:"created_at"`
+	Symbol          string    `json:"symbol"`
+	Rate            float64   `json:"rate"`                        // 最近一次已結算資金費率
+	NextRate        float64   `json:"next_rate"`                   // 預估下一期資金費率
+	MarkPrice       float64   `json:"mark_price,omitempty"`        // 標記價
+	IndexPrice      float64   `json:"index_price,omitempty"`       // 指數價（現貨加權）
+	OpenInterest    float64   `json:"open_interest,omitempty"`     // 未平倉量（合約張數/幣量）
+	FundingTime     int64     `json:"funding_time,omitempty"`      // Rate 對應的結算時間 epoch ms
+	NextFundingTime int64     `json:"next_funding_time,omitempty"` // 下一次結算時間 epoch ms
+	Timestamp       int64     `json:"timestamp"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// FundingRecord funding_records 文件：每個 symbol 每次結算一筆（_key = <symbol>_<funding_time>）
+type FundingRecord struct {
+	Key         string  `json:"_key"`
+	Symbol      string  `json:"symbol"`
+	FundingTime int64   `json:"funding_time"`          // 結算時間 epoch ms
+	Rate        float64 `json:"rate"`                  // 已結算資金費率
+	MarkPrice   float64 `json:"mark_price,omitempty"`  // 結算時標記價
+	AmountUSDT  float64 `json:"amount_usdt,omitempty"` // 帳戶實收/實付（需帳戶收益資料，行情輪詢不填）
 }
 
 // AccountBalance 帳戶餘額
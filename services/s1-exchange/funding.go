@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"s1-exchange/dao"
+	"s1-exchange/internal/config"
+	"strings"
+	"time"
+
+	driver "github.com/arangodb/go-driver"
+)
+
+// 資金費率輪詢預設值（env.yaml funding 區塊未設定時使用）
+const (
+	defaultFuturesURL          = "https://fapi.binance.com"
+	defaultFundingPollInterval = time.Minute
+	defaultFundingHistoryLimit = 100
+	maxFundingHistoryLimit     = 1000
+	defaultExchangeTimeout     = 10 * time.Second
+	fundingRecordsCollection   = "funding_records"
+)
+
+var defaultFundingSymbols = []string{"BTCUSDT", "ETHUSDT", "ADAUSDT"}
+
+// binancePremiumIndex GET /fapi/v1/premiumIndex
+type binancePremiumIndex struct {
+	Symbol          string `json:"symbol"`
+	MarkPrice       string `json:"markPrice"`
+	IndexPrice      string `json:"indexPrice"`
+	LastFundingRate string `json:"lastFundingRate"` // 本期累計中的預估費率，於 nextFundingTime 結算
+	NextFundingTime int64  `json:"nextFundingTime"`
+	Time            int64  `json:"time"`
+}
+
+// binanceOpenInterest GET /fapi/v1/openInterest
+type binanceOpenInterest struct {
+	OpenInterest string `json:"openInterest"`
+	Time         int64  `json:"time"`
+}
+
+// binanceFundingRate GET /fapi/v1/fundingRate（已結算歷史，時間升冪）
+type binanceFundingRate struct {
+	Symbol      string `json:"symbol"`
+	FundingTime int64  `json:"fundingTime"`
+	FundingRate string `json:"fundingRate"`
+	MarkPrice   string `json:"markPrice"`
+}
+
+// fundingFeed 資金費率輪詢設定
+type fundingFeed struct {
+	baseURL      string
+	client       *http.Client
+	symbols      []string
+	interval     time.Duration
+	historyLimit int
+}
+
+func newFundingFeed() *fundingFeed {
+	cfg := config.AppConfig.Funding
+	binance := config.AppConfig.Exchange.Binance
+
+	feed := &fundingFeed{
+		baseURL:      strings.TrimRight(binance.FuturesURL, "/"),
+		symbols:      cfg.Symbols,
+		interval:     defaultFundingPollInterval,
+		historyLimit: cfg.HistoryLimit,
+	}
+	if feed.baseURL == "" {
+		feed.baseURL = defaultFuturesURL
+	}
+	if len(feed.symbols) == 0 {
+		feed.symbols = defaultFundingSymbols
+	}
+	if cfg.PollInterval != "" {
+		if d, err := time.ParseDuration(cfg.PollInterval); err == nil && d > 0 {
+			feed.interval = d
+		} else {
+			log.Printf("Invalid funding.poll_interval %q, using %s: %v", cfg.PollInterval, defaultFundingPollInterval, err)
+		}
+	}
+	if feed.historyLimit <= 0 {
+		feed.historyLimit = defaultFundingHistoryLimit
+	}
+	if feed.historyLimit > maxFundingHistoryLimit {
+		feed.historyLimit = maxFundingHistoryLimit
+	}
+	timeout := defaultExchangeTimeout
+	if binance.Timeout != "" {
+		if d, err := time.ParseDuration(binance.Timeout); err == nil {
+			timeout = d
+		}
+	}
+	feed.client = &http.Client{Timeout: timeout}
+	return feed
+}
+
+// get 呼叫 Binance 公開行情端點並解析 JSON
+func (f *fundingFeed) get(ctx context.Context, path string, params url.Values, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.baseURL+path+"?"+params.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("GET %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %d", path, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// settlements 最近 limit 次已結算資金費率（時間升冪）
+func (f *fundingFeed) settlements(ctx context.Context, symbol string, limit int) ([]dao.FundingRecord, error) {
+	var rows []binanceFundingRate
+	params := url.Values{"symbol": {symbol}, "limit": {fmt.Sprint(limit)}}
+	if err := f.get(ctx, "/fapi/v1/fundingRate", params, &rows); err != nil {
+		return nil, err
+	}
+	records := make([]dao.FundingRecord, 0, len(rows))
+	for _, row := range rows {
+		records = append(records, dao.FundingRecord{
+			Key:         fmt.Sprintf("%s_%d", symbol, row.FundingTime),
+			Symbol:      symbol,
+			FundingTime: row.FundingTime,
+			Rate:        parseFloat(row.FundingRate),
+			MarkPrice:   parseFloat(row.MarkPrice),
+		})
+	}
+	return records, nil
+}
+
+// startFundingPoller 啟動時回補 funding_records，之後每 poll_interval 更新 /market/funding 快照
+func (s *S1_EXCHANGEServer) startFundingPoller() {
+	s.ensureFundingCollection()
+	s.refreshFundingRates()
+
+	ticker := time.NewTicker(s.funding.interval)
+	defer ticker.Stop()
+	for {
+		s.pollFundingRates()
+		<-ticker.C
+	}
+}
+
+// pollFundingRates 以 premiumIndex（標記價/指數價/預估費率）、openInterest 與最近一次結算組成各 symbol 的快照；
+// 跨過結算時間時取新結算並寫入 funding_records
+func (s *S1_EXCHANGEServer) pollFundingRates() {
+	for _, symbol := range s.funding.symbols {
+		ctx, cancel := context.WithTimeout(context.Background(), s.funding.client.Timeout)
+		snapshot, settled, err := s.fetchFundingSnapshot(ctx, symbol)
+		cancel()
+		if err != nil {
+			log.Printf("Failed to poll funding for %s: %v", symbol, err)
+			continue
+		}
+
+		s.dataMutex.Lock()
+		s.fundingRates[symbol] = snapshot
+		s.dataMutex.Unlock()
+
+		if settled != nil {
+			s.saveFundingRecords([]dao.FundingRecord{*settled})
+		}
+	}
+}
+
+// fetchFundingSnapshot 回傳最新快照；有新的結算時一併回傳該筆結算
+func (s *S1_EXCHANGEServer) fetchFundingSnapshot(ctx context.Context, symbol string) (*dao.FundingRate, *dao.FundingRecord, error) {
+	var premium binancePremiumIndex
+	if err := s.funding.get(ctx, "/fapi/v1/premiumIndex", url.Values{"symbol": {symbol}}, &premium); err != nil {
+		return nil, nil, err
+	}
+
+	snapshot := &dao.FundingRate{
+		Symbol:          symbol,
+		NextRate:        parseFloat(premium.LastFundingRate),
+		MarkPrice:       parseFloat(premium.MarkPrice),
+		IndexPrice:      parseFloat(premium.IndexPrice),
+		NextFundingTime: premium.NextFundingTime,
+		Timestamp:       premium.Time,
+		CreatedAt:       time.Now(),
+	}
+
+	var oi binanceOpenInterest
+	if err := s.funding.get(ctx, "/fapi/v1/openInterest", url.Values{"symbol": {symbol}}, &oi); err != nil {
+		log.Printf("Failed to fetch open interest for %s: %v", symbol, err)
+	} else {
+		snapshot.OpenInterest = parseFloat(oi.OpenInterest)
+	}
+
+	// 最近一次結算：沿用上次快照，直到上次快照的 next_funding_time 已過
+	s.dataMutex.RLock()
+	prev := s.fundingRates[symbol]
+	s.dataMutex.RUnlock()
+	if prev != nil && prev.FundingTime > 0 && (prev.NextFundingTime == 0 || premium.Time < prev.NextFundingTime) {
+		snapshot.Rate, snapshot.FundingTime = prev.Rate, prev.FundingTime
+		return snapshot, nil, nil
+	}
+
+	records, err := s.funding.settlements(ctx, symbol, 1)
+	if err != nil {
+		log.Printf("Failed to fetch last funding settlement for %s: %v", symbol, err)
+		if prev != nil {
+			snapshot.Rate, snapshot.FundingTime = prev.Rate, prev.FundingTime
+		}
+		return snapshot, nil, nil
+	}
+	if len(records) == 0 {
+		return snapshot, nil, nil
+	}
+	last := records[len(records)-1]
+	snapshot.Rate, snapshot.FundingTime = last.Rate, last.FundingTime
+	if prev != nil && prev.FundingTime >= last.FundingTime {
+		return snapshot, nil, nil
+	}
+	return snapshot, &last, nil
+}
+
+// ensureFundingCollection 建立 funding_records 與 (symbol, funding_time) 索引
+func (s *S1_EXCHANGEServer) ensureFundingCollection() {
+	if s.arangodbClient == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	db := s.arangodbClient.GetDB()
+	exists, err := db.CollectionExists(ctx, fundingRecordsCollection)
+	if err != nil {
+		log.Printf("Failed to check collection %s: %v", fundingRecordsCollection, err)
+		return
+	}
+	var col driver.Collection
+	if exists {
+		col, err = db.Collection(ctx, fundingRecordsCollection)
+	} else {
+		col, err = db.CreateCollection(ctx, fundingRecordsCollection, nil)
+	}
+	if err != nil {
+		log.Printf("Failed to open collection %s: %v", fundingRecordsCollection, err)
+		return
+	}
+	fields := []string{"symbol", "funding_time"}
+	if _, _, err := col.EnsurePersistentIndex(ctx, fields, &driver.EnsurePersistentIndexOptions{Name: "idx_symbol_time"}); err != nil {
+		log.Printf("Failed to ensure index on %s: %v", fundingRecordsCollection, err)
+	}
+}
+
+// saveFundingRecords 以 _key 冪等寫入（重複回補不產生重複紀錄）
+func (s *S1_EXCHANGEServer) saveFundingRecords(records []dao.FundingRecord) {
+	if s.arangodbClient == nil || len(records) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	query := `FOR doc IN @docs
+		UPSERT { _key: doc._key } INSERT doc UPDATE { rate: doc.rate, mark_price: doc.mark_price } IN @@col`
+	bindVars := map[string]interface{}{
+		"@col": fundingRecordsCollection,
+		"docs": records,
+	}
+	cursor, err := s.arangodbClient.GetDB().Query(ctx, query, bindVars)
+	if err != nil {
+		log.Printf("Failed to write %d funding records for %s: %v", len(records), records[0].Symbol, err)
+		return
+	}
+	cursor.Close()
+}
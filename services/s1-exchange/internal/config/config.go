@@ -112,6 +112,11 @@ type Config struct {
 			RateLimit  int    `yaml:"rate_limit"`
 		} `yaml:"binance"`
 	} `yaml:"exchange"`
+	Funding struct {
+		Symbols      []string `yaml:"symbols"`
+		PollInterval string   `yaml:"poll_interval"`
+		HistoryLimit int      `yaml:"history_limit"`
+	} `yaml:"funding"`
 	WebSocket struct {
 		ReconnectInterval string `yaml:"reconnect_interval"`
 		PingInterval      string `yaml:"ping_interval"`
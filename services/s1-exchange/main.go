@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -40,6 +41,9 @@ type S1_EXCHANGEServer struct {
 	fundingRates map[string]*dao.FundingRate
 	dataMutex    sync.RWMutex
 
+	// 資金費率輪詢（GET /market/funding 與 funding_records）
+	funding *fundingFeed
+
 	// 配置
 	credentials    *dao.ExchangeCredentials
 	treasuryConfig *dao.TreasuryConfig
@@ -55,6 +59,7 @@ func NewS1_EXCHANGEServer() *S1_EXCHANGEServer {
 		marketData:     make(map[string]*dao.MarketData),
 		orderBooks:     make(map[string]*dao.OrderBook),
 		fundingRates:   make(map[string]*dao.FundingRate),
+		funding:        newFundingFeed(),
 		credentials: &dao.ExchangeCredentials{
 			APIKey:    os.Getenv("BINANCE_API_KEY"),
 			SecretKey: os.Getenv("BINANCE_SECRET_KEY"),
@@ -73,6 +78,9 @@ func NewS1_EXCHANGEServer() *S1_EXCHANGEServer {
 	// 啟動 WebSocket 連接
 	go server.startWebSocketConnections()
 
+	// 啟動資金費率輪詢
+	go server.startFundingPoller()
+
 	// 啟動定時任務
 	go server.startScheduledTasks()
 
@@ -541,10 +549,19 @@ func (s *S1_EXCHANGEServer) refreshExchangeInfo() {
 	// TODO: 實現 exchangeInfo 刷新邏輯
 }
 
-// refreshFundingRates 刷新資金費率
+// refreshFundingRates 回補各 symbol 最近 history_limit 次結算至 funding_records（補輪詢期間的缺口）
 func (s *S1_EXCHANGEServer) refreshFundingRates() {
 	log.Println("Refreshing funding rates...")
-	// TODO: 實現資金費率刷新邏輯
+	for _, symbol := range s.funding.symbols {
+		ctx, cancel := context.WithTimeout(context.Background(), s.funding.client.Timeout)
+		records, err := s.funding.settlements(ctx, symbol, s.funding.historyLimit)
+		cancel()
+		if err != nil {
+			log.Printf("Failed to backfill funding history for %s: %v", symbol, err)
+			continue
+		}
+		s.saveFundingRecords(records)
+	}
 }
 
 // parseFloat 解析字串為浮點數
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"s2-feature/dao"
+	"s2-feature/internal/compute"
+	"s2-feature/internal/config"
+	"strings"
+	"sync"
+	"time"
+)
+
+// carry 特徵預設值（env.yaml carry 區塊未設定時使用）
+const (
+	defaultFundingIntervalHours = 8
+	defaultFundingWindow        = 21 // 21 次結算 = 7 天（8 小時週期）
+	defaultOILookback           = time.Hour
+	defaultCarryTimeout         = 2 * time.Second
+	minFundingZScoreSamples     = 5
+	fundingRecordsCollection    = "funding_records"
+)
+
+// carryFlatKeys 同時以頂層扁平鍵輸出的 carry 欄位（S3 L0 守門與規則以此名稱讀取，如 funding_next）
+var carryFlatKeys = []string{"funding_next", "funding_rate", "funding_cum", "funding_zscore", "basis_bps", "basis_annualized", "oi_change_pct"}
+
+// CarrySource 資金費、標記價、指數價與未平倉量來源
+type CarrySource interface {
+	Funding(ctx context.Context, symbol string) (*dao.FundingRate, error)
+}
+
+// S1CarrySource 透過 S1 GET /market/funding 取得
+type S1CarrySource struct {
+	baseURL string
+	client  *http.Client
+}
+
+func NewS1CarrySource(baseURL string, timeout time.Duration) *S1CarrySource {
+	return &S1CarrySource{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  &http.Client{Timeout: timeout},
+	}
+}
+
+func (src *S1CarrySource) Funding(ctx context.Context, symbol string) (*dao.FundingRate, error) {
+	endpoint := src.baseURL + "/market/funding?symbol=" + url.QueryEscape(symbol)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := src.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query S1 funding for %s: %w", symbol, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("S1 /market/funding returned %d for %s", resp.StatusCode, symbol)
+	}
+
+	var funding dao.FundingRate
+	if err := json.NewDecoder(resp.Body).Decode(&funding); err != nil {
+		return nil, fmt.Errorf("failed to decode S1 funding for %s: %w", symbol, err)
+	}
+	return &funding, nil
+}
+
+// CarryConfig carry 特徵參數
+type CarryConfig struct {
+	FundingIntervalHours float64
+	FundingWindow        int           // 累計資金費與 z-score 使用的結算次數
+	OILookback           time.Duration // 未平倉量變化的回看時間
+}
+
+// fundingPoint 一次資金費結算
+type fundingPoint struct {
+	FundingTime int64   `json:"funding_time"`
+	Rate        float64 `json:"funding_rate"`
+}
+
+// oiPoint 一次未平倉量觀測
+type oiPoint struct {
+	ts int64
+	oi float64
+}
+
+// CarryTracker 各 symbol 的資金費結算歷史與未平倉量觀測
+//
+// S1 快照只帶最新一次結算，結算歷史隨 FundingTime 前進逐筆累積（啟動時可自 funding_records 預載）；
+// 未平倉量保留回看時間內的觀測，用於計算變化率。
+type CarryTracker struct {
+	cfg     CarryConfig
+	mu      sync.Mutex
+	funding map[string][]fundingPoint
+	oi      map[string][]oiPoint
+	seeded  map[string]bool
+}
+
+func NewCarryTracker(cfg CarryConfig) *CarryTracker {
+	return &CarryTracker{
+		cfg:     cfg,
+		funding: make(map[string][]fundingPoint),
+		oi:      make(map[string][]oiPoint),
+		seeded:  make(map[string]bool),
+	}
+}
+
+// Seeded 是否已嘗試預載結算歷史
+func (t *CarryTracker) Seeded(symbol string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.seeded[symbol]
+}
+
+// Seed 預載結算歷史（任意順序；只保留最近 FundingWindow 筆）
+func (t *CarryTracker) Seed(symbol string, history []fundingPoint) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.seeded[symbol] = true
+	for _, point := range history {
+		t.addFunding(symbol, point)
+	}
+}
+
+// addFunding 依結算時間插入並去重（呼叫端持有鎖）
+func (t *CarryTracker) addFunding(symbol string, point fundingPoint) {
+	series := t.funding[symbol]
+	idx := len(series)
+	for idx > 0 && series[idx-1].FundingTime >= point.FundingTime {
+		if series[idx-1].FundingTime == point.FundingTime {
+			return
+		}
+		idx--
+	}
+	series = append(series, fundingPoint{})
+	copy(series[idx+1:], series[idx:])
+	series[idx] = point
+
+	if len(series) > t.cfg.FundingWindow {
+		series = series[len(series)-t.cfg.FundingWindow:]
+	}
+	t.funding[symbol] = series
+}
+
+// Observe 記錄 S1 快照並回傳 carry 特徵（欄位皆為 float64，資料不足的欄位省略）
+//
+//   - funding_rate / funding_next：最近已結算 / 預估下一期資金費率（S3 GateKeeper 讀取 funding_next）
+//   - funding_cum：最近 FundingWindow 次結算的累計資金費（多單成本，小數）
+//   - funding_zscore：funding_next 相對結算歷史的 z 值（至少 5 筆）
+//   - basis_bps / basis_annualized：標記價相對指數價的基差與年化基差
+//   - open_interest / oi_change_pct：未平倉量與相對 OILookback 前的變化百分比
+func (t *CarryTracker) Observe(snapshot *dao.FundingRate) map[string]interface{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	symbol := snapshot.Symbol
+	if snapshot.FundingTime > 0 {
+		t.addFunding(symbol, fundingPoint{FundingTime: snapshot.FundingTime, Rate: snapshot.Rate})
+	}
+
+	features := map[string]interface{}{
+		"funding_rate":   snapshot.Rate,
+		"funding_next":   snapshot.NextRate,
+		"funding_window": t.cfg.FundingWindow,
+		"symbol":         symbol,
+		"timestamp":      snapshot.Timestamp,
+	}
+
+	history := t.funding[symbol]
+	if len(history) > 0 {
+		rates := make([]float64, len(history))
+		cum := 0.0
+		for i, point := range history {
+			rates[i] = point.Rate
+			cum += point.Rate
+		}
+		features["funding_cum"] = cum
+		features["funding_settlements"] = len(history)
+
+		if len(rates) >= minFundingZScoreSamples {
+			if z := compute.ZScore(rates, snapshot.NextRate); !math.IsNaN(z) {
+				features["funding_zscore"] = z
+			}
+		}
+	}
+
+	if basis := compute.BasisBps(snapshot.MarkPrice, snapshot.IndexPrice); !math.IsNaN(basis) {
+		features["basis_bps"] = basis
+		features["basis_annualized"] = compute.AnnualizedBasis(basis, t.cfg.FundingIntervalHours)
+	}
+
+	if snapshot.OpenInterest > 0 {
+		features["open_interest"] = snapshot.OpenInterest
+		if change, ok := t.observeOpenInterest(symbol, snapshot.Timestamp, snapshot.OpenInterest); ok {
+			features["oi_change_pct"] = change
+		}
+	}
+
+	return features
+}
+
+// observeOpenInterest 記錄未平倉量並回傳相對回看時間前的變化百分比（呼叫端持有鎖）
+func (t *CarryTracker) observeOpenInterest(symbol string, ts int64, oi float64) (float64, bool) {
+	series := t.oi[symbol]
+	if n := len(series); n == 0 || ts > series[n-1].ts {
+		series = append(series, oiPoint{ts: ts, oi: oi})
+	}
+
+	// 基準：回看時間點之前最近的一筆；更早的觀測不再需要
+	cutoff := ts - t.cfg.OILookback.Milliseconds()
+	ref := -1
+	for i := range series {
+		if series[i].ts > cutoff {
+			break
+		}
+		ref = i
+	}
+	if ref > 0 {
+		series = series[ref:]
+		ref = 0
+	}
+	t.oi[symbol] = series
+
+	if ref < 0 || series[ref].oi <= 0 {
+		return 0, false
+	}
+	return (oi - series[ref].oi) / series[ref].oi * 100, true
+}
+
+// initializeCarry 依 env.yaml carry 區塊建立資金費來源（未設定 s1_url 時不計算 carry 特徵）
+func (s *S2_FEATUREServer) initializeCarry() {
+	cfg := config.AppConfig.Carry
+
+	carryCfg := CarryConfig{
+		FundingIntervalHours: cfg.FundingIntervalHours,
+		FundingWindow:        cfg.FundingWindow,
+		OILookback:           defaultOILookback,
+	}
+	if carryCfg.FundingIntervalHours <= 0 {
+		carryCfg.FundingIntervalHours = defaultFundingIntervalHours
+	}
+	if carryCfg.FundingWindow <= 0 {
+		carryCfg.FundingWindow = defaultFundingWindow
+	}
+	if cfg.OILookback != "" {
+		if lookback, err := time.ParseDuration(cfg.OILookback); err == nil {
+			carryCfg.OILookback = lookback
+		} else {
+			log.Printf("Invalid carry.oi_lookback %q, using %s: %v", cfg.OILookback, defaultOILookback, err)
+		}
+	}
+	s.carryTracker = NewCarryTracker(carryCfg)
+
+	if cfg.S1URL == "" {
+		return
+	}
+	timeout := defaultCarryTimeout
+	if cfg.Timeout != "" {
+		if d, err := time.ParseDuration(cfg.Timeout); err == nil {
+			timeout = d
+		} else {
+			log.Printf("Invalid carry.timeout %q, using %s: %v", cfg.Timeout, defaultCarryTimeout, err)
+		}
+	}
+	s.carrySource = NewS1CarrySource(cfg.S1URL, timeout)
+}
+
+// computeCarryFeatures 取 S1 最新資金費快照並計算 carry 特徵，同時回傳快照供血緣記錄；未設定來源時回傳 nil
+func (s *S2_FEATUREServer) computeCarryFeatures(symbol string) (map[string]interface{}, *dao.FundingRate, error) {
+	if s.carrySource == nil {
+		return nil, nil, nil
+	}
+	if !s.carryTracker.Seeded(symbol) {
+		s.seedFundingHistory(symbol)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	snapshot, err := s.carrySource.Funding(ctx, symbol)
+	if err != nil {
+		return nil, nil, err
+	}
+	if snapshot.Symbol == "" {
+		snapshot.Symbol = symbol
+	}
+	return s.carryTracker.Observe(snapshot), snapshot, nil
+}
+
+// flattenCarryFeatures 將 carry 欄位複製為頂層扁平鍵（與 CARRY 分組並存；缺值欄位不輸出）
+func flattenCarryFeatures(features, carry map[string]interface{}) {
+	for _, key := range carryFlatKeys {
+		if value, ok := carry[key]; ok {
+			features[key] = value
+		}
+	}
+}
+
+// seedFundingHistory 自 S1 寫入的 funding_records 預載最近的結算歷史
+func (s *S2_FEATUREServer) seedFundingHistory(symbol string) {
+	var history []fundingPoint
+	defer func() { s.carryTracker.Seed(symbol, history) }()
+
+	if s.arangodbClient == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	query := `FOR d IN @@col
+		FILTER d.symbol == @symbol
+		SORT d.funding_time DESC
+		LIMIT @limit
+		RETURN { funding_time: d.funding_time, funding_rate: d.rate }`
+	bindVars := map[string]interface{}{
+		"@col":   fundingRecordsCollection,
+		"symbol": symbol,
+		"limit":  s.carryTracker.cfg.FundingWindow,
+	}
+
+	cursor, err := s.arangodbClient.GetDB().Query(ctx, query, bindVars)
+	if err != nil {
+		log.Printf("Failed to load funding history for %s: %v", symbol, err)
+		return
+	}
+	defer cursor.Close()
+
+	for cursor.HasMore() {
+		var point fundingPoint
+		if _, err := cursor.ReadDocument(ctx, &point); err != nil {
+			log.Printf("Failed to read funding record for %s: %v", symbol, err)
+			return
+		}
+		history = append(history, point)
+	}
+}
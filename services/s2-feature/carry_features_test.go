@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"s2-feature/dao"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCarryTracker_Observe(t *testing.T) {
+	tracker := NewCarryTracker(CarryConfig{FundingIntervalHours: 8, FundingWindow: 5, OILookback: time.Hour})
+	interval := (8 * time.Hour).Milliseconds()
+
+	var features map[string]interface{}
+	rates := []float64{0.0001, 0.0002, 0.0001, 0.0003, 0.0002, 0.0001}
+	for i, rate := range rates {
+		features = tracker.Observe(&dao.FundingRate{
+			Symbol:       "BTCUSDT",
+			Rate:         rate,
+			NextRate:     0.0005,
+			MarkPrice:    50050,
+			IndexPrice:   50000,
+			OpenInterest: 1000 + float64(i)*100,
+			FundingTime:  int64(i+1) * interval,
+			Timestamp:    int64(i+1)*interval + 1,
+		})
+	}
+
+	assert.Equal(t, 0.0005, features["funding_next"])
+	assert.Equal(t, 0.0001, features["funding_rate"])
+	// 只保留最近 5 次結算
+	assert.Equal(t, 5, features["funding_settlements"])
+	assert.InDelta(t, 0.0009, features["funding_cum"], 1e-12)
+	assert.Greater(t, features["funding_zscore"], 2.0)
+	assert.InDelta(t, 10.0, features["basis_bps"], 1e-9)
+	assert.InDelta(t, 1.095, features["basis_annualized"], 1e-9)
+	// 相對 8 小時前（回看 1h 之前最近一筆）的 1400
+	assert.InDelta(t, (1500.0-1400.0)/1400.0*100, features["oi_change_pct"], 1e-9)
+
+	// 同一結算重複觀測不重複累計
+	again := tracker.Observe(&dao.FundingRate{Symbol: "BTCUSDT", Rate: 0.0001, NextRate: 0.0005, FundingTime: 6 * interval, Timestamp: 6*interval + 2})
+	assert.InDelta(t, 0.0009, again["funding_cum"], 1e-12)
+	assert.NotContains(t, again, "basis_bps")
+}
+
+func TestCarryTracker_SeedAndWarmup(t *testing.T) {
+	tracker := NewCarryTracker(CarryConfig{FundingIntervalHours: 8, FundingWindow: 21, OILookback: time.Hour})
+
+	features := tracker.Observe(&dao.FundingRate{Symbol: "ETHUSDT", NextRate: 0.0001, OpenInterest: 500, Timestamp: 1})
+	assert.NotContains(t, features, "funding_cum")
+	assert.NotContains(t, features, "funding_zscore")
+	assert.NotContains(t, features, "oi_change_pct")
+
+	assert.False(t, tracker.Seeded("ETHUSDT"))
+	tracker.Seed("ETHUSDT", []fundingPoint{
+		{FundingTime: 3, Rate: 0.0003}, {FundingTime: 1, Rate: 0.0001}, {FundingTime: 2, Rate: 0.0002},
+		{FundingTime: 5, Rate: 0.0001}, {FundingTime: 4, Rate: 0.0002},
+	})
+	assert.True(t, tracker.Seeded("ETHUSDT"))
+
+	features = tracker.Observe(&dao.FundingRate{Symbol: "ETHUSDT", NextRate: 0.0001, Timestamp: 2})
+	assert.Equal(t, 5, features["funding_settlements"])
+	assert.InDelta(t, 0.0009, features["funding_cum"], 1e-12)
+	assert.Contains(t, features, "funding_zscore")
+}
+
+func TestS1CarrySource_Funding(t *testing.T) {
+	s1 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/market/funding" || r.URL.Query().Get("symbol") != "BTCUSDT" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(dao.FundingRate{Symbol: "BTCUSDT", Rate: 0.0001, NextRate: 0.0002, MarkPrice: 50010, IndexPrice: 50000})
+	}))
+	defer s1.Close()
+
+	source := NewS1CarrySource(s1.URL+"/", time.Second)
+
+	funding, err := source.Funding(context.Background(), "BTCUSDT")
+	if assert.NoError(t, err) {
+		assert.Equal(t, 0.0002, funding.NextRate)
+		assert.Equal(t, 50010.0, funding.MarkPrice)
+	}
+
+	_, err = source.Funding(context.Background(), "DOGEUSDT")
+	assert.Error(t, err)
+}
+
+type fakeCarrySource struct {
+	funding dao.FundingRate
+}
+
+func (f *fakeCarrySource) Funding(ctx context.Context, symbol string) (*dao.FundingRate, error) {
+	funding := f.funding
+	return &funding, nil
+}
+
+func TestComputeFeatures_IncludesCarry(t *testing.T) {
+	server := NewS2_FEATUREServer()
+	server.carrySource = &fakeCarrySource{funding: dao.FundingRate{Symbol: "BTCUSDT", NextRate: 0.0004, MarkPrice: 50100, IndexPrice: 50000}}
+
+	if !assert.NoError(t, server.computeFeaturesForSymbol("BTCUSDT", "4h", true)) {
+		return
+	}
+	snapshot := server.featureCache["BTCUSDT"]
+	carry, ok := snapshot.Features["CARRY"].(map[string]interface{})
+	if assert.True(t, ok) {
+		assert.Equal(t, 0.0004, carry["funding_next"])
+		assert.InDelta(t, 20.0, carry["basis_bps"], 1e-9)
+	}
+
+	// S3 守門讀取的扁平鍵與分組並存；資料不足的欄位不輸出
+	assert.Equal(t, 0.0004, snapshot.Features["funding_next"])
+	assert.InDelta(t, 20.0, snapshot.Features["basis_bps"], 1e-9)
+	assert.NotContains(t, snapshot.Features, "oi_change_pct")
+
+	// 外部即時資料不納入血緣雜湊
+	if assert.NotNil(t, snapshot.Lineage) {
+		assert.NotContains(t, snapshot.Lineage.HashedGroups, "CARRY")
+	}
+}
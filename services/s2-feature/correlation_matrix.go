@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"log"
+	"math"
+	"s2-feature/internal/compute"
+	"s2-feature/internal/config"
+	"sort"
+	"strconv"
+	"time"
+
+	goredis "github.com/go-redis/redis/v8"
+)
+
+// 相關係數矩陣預設值（env.yaml correlation 區塊未設定時使用）
+const (
+	defaultCorrelationKey       = "risk:correlation_matrix"
+	defaultCorrelationTimeframe = "1h"
+	defaultCorrelationPeriod    = 72
+	defaultCorrelationRefresh   = 15 * time.Minute
+	minCorrelationSamples       = 20
+	correlationTTLMultiple      = 3
+)
+
+// CorrelationConfig 相關係數矩陣參數
+type CorrelationConfig struct {
+	Key       string
+	Symbols   []string
+	Timeframe string
+	Period    int // 最近 N 筆對數報酬
+	Refresh   time.Duration
+}
+
+// correlationPairs 兩兩標的以共同收盤時間對齊，取最近 period 筆對數報酬的皮爾森相關係數。
+// 欄位為 <A>:<B>（A < B）；有效樣本少於 minCorrelationSamples 或變異為 0 的組合省略
+func correlationPairs(candles map[string][]MarketDataPoint, period int) map[string]float64 {
+	symbols := make([]string, 0, len(candles))
+	closes := make(map[string]map[int64]float64, len(candles))
+	for symbol, data := range candles {
+		symbols = append(symbols, symbol)
+		byTs := make(map[int64]float64, len(data))
+		for _, point := range data {
+			byTs[point.Timestamp] = point.Close
+		}
+		closes[symbol] = byTs
+	}
+	sort.Strings(symbols)
+
+	pairs := make(map[string]float64)
+	for i, a := range symbols {
+		for _, b := range symbols[i+1:] {
+			var ts []int64
+			for t := range closes[a] {
+				if _, ok := closes[b][t]; ok {
+					ts = append(ts, t)
+				}
+			}
+			sort.Slice(ts, func(x, y int) bool { return ts[x] < ts[y] })
+			if len(ts) > period+1 {
+				ts = ts[len(ts)-period-1:]
+			}
+			pa, pb := make([]float64, len(ts)), make([]float64, len(ts))
+			for k, t := range ts {
+				pa[k], pb[k] = closes[a][t], closes[b][t]
+			}
+			ra, rb := compute.LogReturns(pa), compute.LogReturns(pb)
+			if len(ra) < minCorrelationSamples {
+				continue
+			}
+			if rho := compute.Pearson(ra, rb); !math.IsNaN(rho) {
+				pairs[a+":"+b] = rho
+			}
+		}
+	}
+	return pairs
+}
+
+// initializeCorrelationMatrix 依 env.yaml correlation 區塊定時發布相關係數矩陣（Redis 未連線或未啟用時不發布）
+func (s *S2_FEATUREServer) initializeCorrelationMatrix() {
+	cfg := config.AppConfig.Correlation
+	if !cfg.Enabled || s.redisClient == nil {
+		return
+	}
+	corrCfg := CorrelationConfig{
+		Key:       cfg.Key,
+		Symbols:   cfg.Symbols,
+		Timeframe: cfg.Timeframe,
+		Period:    cfg.Period,
+		Refresh:   defaultCorrelationRefresh,
+	}
+	if corrCfg.Key == "" {
+		corrCfg.Key = defaultCorrelationKey
+	}
+	if corrCfg.Timeframe == "" {
+		corrCfg.Timeframe = defaultCorrelationTimeframe
+	}
+	if corrCfg.Period <= 0 {
+		corrCfg.Period = defaultCorrelationPeriod
+	}
+	if corrCfg.Period > marketDataBars-1 {
+		log.Printf("correlation.period %d exceeds %d bars, using %d", corrCfg.Period, marketDataBars, marketDataBars-1)
+		corrCfg.Period = marketDataBars - 1
+	}
+	if cfg.Refresh != "" {
+		if d, err := time.ParseDuration(cfg.Refresh); err == nil && d > 0 {
+			corrCfg.Refresh = d
+		} else {
+			log.Printf("Invalid correlation.refresh %q, using %s: %v", cfg.Refresh, defaultCorrelationRefresh, err)
+		}
+	}
+	if len(corrCfg.Symbols) < 2 {
+		log.Printf("Correlation matrix disabled: need at least 2 symbols, got %v", corrCfg.Symbols)
+		return
+	}
+
+	go func() {
+		s.publishCorrelationMatrix(corrCfg)
+		ticker := time.NewTicker(corrCfg.Refresh)
+		defer ticker.Stop()
+		for range ticker.C {
+			s.publishCorrelationMatrix(corrCfg)
+		}
+	}()
+}
+
+// publishCorrelationMatrix 重算並整份覆寫 Redis Hash（TTL 為 3 倍重算間隔）
+func (s *S2_FEATUREServer) publishCorrelationMatrix(cfg CorrelationConfig) {
+	toMs, err := lastClosedBaseMs(cfg.Timeframe, time.Now().UnixMilli())
+	if err != nil {
+		log.Printf("Failed to compute correlation matrix: %v", err)
+		return
+	}
+	candles := make(map[string][]MarketDataPoint, len(cfg.Symbols))
+	for _, symbol := range cfg.Symbols {
+		data, _, err := s.getMarketData(symbol, cfg.Timeframe, toMs)
+		if err != nil {
+			log.Printf("Correlation matrix: skipping %s: %v", symbol, err)
+			continue
+		}
+		candles[symbol] = data
+	}
+	pairs := correlationPairs(candles, cfg.Period)
+	if len(pairs) == 0 {
+		log.Printf("Correlation matrix: no pairs with enough samples")
+		return
+	}
+
+	fields := make(map[string]interface{}, len(pairs))
+	for pair, rho := range pairs {
+		fields[pair] = strconv.FormatFloat(rho, 'f', 6, 64)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = s.redisClient.Client.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+		pipe.Del(ctx, cfg.Key)
+		pipe.HSet(ctx, cfg.Key, fields)
+		pipe.Expire(ctx, cfg.Key, correlationTTLMultiple*cfg.Refresh)
+		return nil
+	})
+	if err != nil {
+		log.Printf("Failed to publish %s: %v", cfg.Key, err)
+		return
+	}
+	log.Printf("Published %d correlation pairs to %s", len(pairs), cfg.Key)
+}
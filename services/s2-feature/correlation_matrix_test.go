@@ -0,0 +1,40 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCorrelationPairs(t *testing.T) {
+	const n = 40
+	series := func(price func(i int) float64, skip func(i int) bool) []MarketDataPoint {
+		var data []MarketDataPoint
+		for i := 0; i < n; i++ {
+			if skip != nil && skip(i) {
+				continue
+			}
+			data = append(data, MarketDataPoint{Timestamp: int64(i) * 3600000, Close: price(i)})
+		}
+		return data
+	}
+	wave := func(i int) float64 { return 100 * math.Exp(0.01*math.Sin(float64(i))) }
+	candles := map[string][]MarketDataPoint{
+		"BTCUSDT": series(wave, nil),
+		"ETHUSDT": series(func(i int) float64 { return 3 * wave(i) }, nil),                                    // 報酬相同：ρ = 1
+		"SOLUSDT": series(func(i int) float64 { return 1e4 / wave(i) }, func(i int) bool { return i%4 == 3 }), // 報酬相反，每 4 根缺 1 根
+		"XRPUSDT": series(wave, func(i int) bool { return i < n-10 }),                                         // 共同樣本不足
+	}
+
+	pairs := correlationPairs(candles, 72)
+	assert.InDelta(t, 1.0, pairs["BTCUSDT:ETHUSDT"], 1e-9)
+	assert.InDelta(t, -1.0, pairs["BTCUSDT:SOLUSDT"], 1e-9)
+	assert.InDelta(t, -1.0, pairs["ETHUSDT:SOLUSDT"], 1e-9)
+	assert.NotContains(t, pairs, "BTCUSDT:XRPUSDT")
+	assert.NotContains(t, pairs, "ETHUSDT:BTCUSDT")
+	assert.Len(t, pairs, 3)
+
+	// period 只取最近 N 筆報酬：樣本不足時省略
+	assert.Empty(t, correlationPairs(candles, minCorrelationSamples-1))
+}
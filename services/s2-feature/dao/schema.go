@@ -173,8 +173,11 @@ type RecomputeFeaturesRequest struct {
 }
 
 type RecomputeFeaturesResponse struct {
-	Computed int    `json:"computed"`          // 本次補算筆數
-	Message  string `json:"message,omitempty"` // 補算摘要
+	Accepted         bool   `json:"accepted"`                    // 已排入非同步任務佇列
+	TaskID           string `json:"task_id,omitempty"`           // 任務 ID（GET/DELETE /features/computation/:id）
+	EstimatedBatches int    `json:"estimated_batches,omitempty"` // 預估批次數（symbol × window）
+	Computed         int    `json:"computed"`                    // 本次補算筆數（非同步任務受理時為 0）
+	Message          string `json:"message,omitempty"`           // 補算摘要
 }
 
 // ================================
@@ -238,21 +241,244 @@ type DepthFeature struct {
 type FeatureComputation struct {
 	TaskID      string    `json:"task_id"`
 	Symbol      string    `json:"symbol"`
+	Symbols     []string  `json:"symbols,omitempty"`
+	Windows     []string  `json:"windows,omitempty"`
+	Force       bool      `json:"force,omitempty"`
 	FeatureType string    `json:"feature_type"`
 	FromMs      int64     `json:"from_ms"`
 	ToMs        int64     `json:"to_ms"`
-	Status      string    `json:"status"`   // PENDING/RUNNING/COMPLETED/FAILED
-	Progress    float64   `json:"progress"` // 0-100
+	Status      string    `json:"status"`                 // PENDING/RUNNING/COMPLETED/FAILED/CANCELLED
+	Progress    float64   `json:"progress"`               // 0-100
+	TotalUnits  int       `json:"total_units,omitempty"`  // symbol × window 總數
+	DoneUnits   int       `json:"done_units,omitempty"`   // 已處理數（含失敗）
+	FailedUnits int       `json:"failed_units,omitempty"` // 失敗數
 	ErrorMsg    string    `json:"error_msg"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 }
 
+// FeatureComputation.Status 取值
+const (
+	ComputationPending   = "PENDING"
+	ComputationRunning   = "RUNNING"
+	ComputationCompleted = "COMPLETED"
+	ComputationFailed    = "FAILED"
+	ComputationCancelled = "CANCELLED"
+)
+
 // FeatureSet 特徵集合快照
 type FeatureSetSnapshot struct {
 	SetID     string                 `json:"set_id"`
 	Symbol    string                 `json:"symbol"`
 	Features  map[string]interface{} `json:"features"`
+	DQC       *FeatureDQC            `json:"dqc,omitempty"`     // 資料品質檢查結果
+	Lineage   *FeatureLineage        `json:"lineage,omitempty"` // 輸入來源與內容雜湊（可重現驗證）
 	Timestamp int64                  `json:"timestamp"`
 	CreatedAt time.Time              `json:"created_at"`
 }
+
+// ================================
+// 資金費與基差（S1 GET /market/funding）
+// ================================
+
+// FundingRate S1 資金費率快照（欄位與 S1 dao.FundingRate 一致）
+type FundingRate struct {
+	Symbol          string    `json:"symbol"`
+	Rate            float64   `json:"rate"`                        // 最近一次已結算資金費率
+	NextRate        float64   `json:"next_rate"`                   // 預估下一期資金費率
+	MarkPrice       float64   `json:"mark_price,omitempty"`        // 標記價
+	IndexPrice      float64   `json:"index_price,omitempty"`       // 指數價（現貨加權）
+	OpenInterest    float64   `json:"open_interest,omitempty"`     // 未平倉量
+	FundingTime     int64     `json:"funding_time,omitempty"`      // Rate 對應的結算時間 epoch ms
+	NextFundingTime int64     `json:"next_funding_time,omitempty"` // 下一次結算時間 epoch ms
+	Timestamp       int64     `json:"timestamp"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// ================================
+// 特徵血緣（Lineage）與可重現雜湊
+// ================================
+
+// LineageInput 單一週期的 K 線輸入範圍
+type LineageInput struct {
+	Timeframe     string `json:"timeframe"`       // 聚合後週期
+	BaseTimeframe string `json:"base_timeframe"`  // 來源基礎週期
+	Stream        string `json:"stream"`          // 來源 Stream，如 mkt:events:{perp}:BTCUSDT
+	FromMs        int64  `json:"from_ms"`         // 基礎 K 線查詢起點（含）
+	ToMs          int64  `json:"to_ms"`           // 基礎 K 線查詢終點（不含）
+	BaseBars      int    `json:"base_bars"`       // 取得的基礎 K 線根數
+	Bars          int    `json:"bars"`            // 聚合後實際參與計算的根數
+	FirstBarMs    int64  `json:"first_bar_ms"`    // 首根開盤時間
+	LastBarMs     int64  `json:"last_bar_ms"`     // 末根開盤時間
+	FirstStreamID string `json:"first_stream_id"` // 首根基礎 K 線的 Stream entry ID
+	LastStreamID  string `json:"last_stream_id"`  // 末根基礎 K 線的 Stream entry ID
+}
+
+// CalculatorLineage 計算器版本與參數
+type CalculatorLineage struct {
+	FeatureType string                 `json:"feature_type"`
+	Version     string                 `json:"version"`
+	Params      map[string]interface{} `json:"params,omitempty"`
+}
+
+// FeatureLineage 特徵快照血緣
+// ContentHash 只涵蓋 HashedGroups（純由輸入 K 線與參數決定、可重算的特徵）；
+// SnapshotHash 涵蓋快照全部特徵（含 CARRY、FACTORS 與扁平 carry 鍵），連同資金費輸入與公式版本一起雜湊。
+// 公式因子為增量狀態、CARRY 為 S1 即時快照，無法重算，只能以 SnapshotHash 驗證保存內容；DQC 依賴滾動視窗，不納入雜湊
+type FeatureLineage struct {
+	Timeframe      string              `json:"timeframe"`
+	AsOfMs         int64               `json:"as_of_ms"` // 輸入截止時間（最後一根已收盤基礎 K 線的收盤時間）
+	Inputs         []LineageInput      `json:"inputs"`   // 錨定週期在前
+	Calculators    []CalculatorLineage `json:"calculators"`
+	FactorRev      int                 `json:"factor_rev,omitempty"`
+	FactorBundleID string              `json:"factor_bundle_id,omitempty"`
+	HashAlgo       string              `json:"hash_algo"`                 // sha256
+	HashedGroups   []string            `json:"hashed_groups"`             // 納入雜湊的特徵群組（升冪）
+	ContentHash    string              `json:"content_hash"`              // hex(sha256(canonical JSON))
+	FundingInput   *LineageFunding     `json:"funding_input,omitempty"`   // CARRY 使用的 S1 資金費快照
+	SnapshotGroups []string            `json:"snapshot_groups,omitempty"` // 快照全部特徵鍵（升冪）
+	SnapshotHash   string              `json:"snapshot_hash,omitempty"`   // hex(sha256(全部特徵 + funding_input + factor_rev/bundle + content_hash))
+}
+
+// LineageFunding CARRY 特徵的輸入（S1 GET /market/funding 快照）
+type LineageFunding struct {
+	Symbol          string  `json:"symbol"`
+	Rate            float64 `json:"rate"`
+	NextRate        float64 `json:"next_rate"`
+	MarkPrice       float64 `json:"mark_price"`
+	IndexPrice      float64 `json:"index_price"`
+	OpenInterest    float64 `json:"open_interest"`
+	FundingTime     int64   `json:"funding_time"`
+	NextFundingTime int64   `json:"next_funding_time"`
+	Timestamp       int64   `json:"timestamp"`
+}
+
+// FeatureLineageResponse GET /features/lineage/:set_id 回傳
+type FeatureLineageResponse struct {
+	SetID          string          `json:"set_id"`
+	Symbol         string          `json:"symbol"`
+	Lineage        *FeatureLineage `json:"lineage"`
+	RecomputedHash string          `json:"recomputed_hash"`
+	Verified       bool            `json:"verified"`             // 重算結果逐位元組一致
+	Mismatches     []string        `json:"mismatches,omitempty"` // 不一致項目（輸入、版本、參數或雜湊）
+}
+
+// ================================
+// S2 Feature Generator - 時點特徵庫（Point-in-Time Feature Store）
+// ================================
+
+// FeatureRecord 時點特徵記錄（鍵：symbol + timeframe + feature_version + bar_close_ms）
+// AvailableAtMs = K 線收盤時間 + 發布延遲；as-of 查詢只回傳 AvailableAtMs <= ts 的記錄，避免未來洩漏
+type FeatureRecord struct {
+	Key            string                 `json:"_key,omitempty"`
+	Symbol         string                 `json:"symbol"`
+	Timeframe      string                 `json:"timeframe"`       // 1m/5m/1h/4h/1d
+	FeatureVersion string                 `json:"feature_version"` // 特徵計算版本（計算器/參數變更時遞增）
+	SetID          string                 `json:"set_id"`          // 對應 FeatureSetSnapshot.SetID
+	BarCloseMs     int64                  `json:"bar_close_ms"`    // K 線收盤時間 epoch ms
+	AvailableAtMs  int64                  `json:"available_at_ms"` // 可見時間 epoch ms（收盤 + 發布延遲）
+	Features       map[string]interface{} `json:"features"`
+	DQC            *FeatureDQC            `json:"dqc,omitempty"`
+	Lineage        *FeatureLineage        `json:"lineage,omitempty"`
+	CreatedAt      time.Time              `json:"created_at"`
+}
+
+// FeatureAsOfResponse GET /features/asof 回傳
+type FeatureAsOfResponse struct {
+	Symbol         string          `json:"symbol"`
+	AsOfMs         int64           `json:"as_of_ms"`
+	FeatureVersion string          `json:"feature_version"`
+	Records        []FeatureRecord `json:"records"` // 每個 timeframe 至多一筆
+}
+
+// FeatureExportResponse GET /features/export 回傳（依 AvailableAtMs 升冪）
+type FeatureExportResponse struct {
+	Symbol         string          `json:"symbol"`
+	Timeframe      string          `json:"timeframe"`
+	FeatureVersion string          `json:"feature_version"`
+	FromMs         int64           `json:"from_ms"`
+	ToMs           int64           `json:"to_ms"`
+	Count          int             `json:"count"`
+	Records        []FeatureRecord `json:"records"`
+}
+
+// ================================
+// 因子公式（S10 Bundle 熱載）
+// ================================
+
+// FactorDefinition 公式因子定義（來源：S10 factor_registry 或 env.yaml factors.static）
+type FactorDefinition struct {
+	FactorID string   `json:"factor_id"`
+	Formula  string   `json:"formula"` // 如 ema(close,20)/ema(close,50)-1
+	Inputs   []string `json:"inputs,omitempty"`
+	Warmup   int      `json:"warmup,omitempty"` // 產生第一個有效值所需 K 線根數
+}
+
+// FactorListResponse GET /factors 回傳
+type FactorListResponse struct {
+	Rev      int                `json:"rev"`       // 來源 config_active.rev（僅靜態定義時為 0）
+	BundleID string             `json:"bundle_id"` // 來源 Bundle
+	Factors  []FactorDefinition `json:"factors"`
+	Errors   map[string]string  `json:"errors,omitempty"` // 編譯失敗的因子（不生效）
+}
+
+// FactorValidateRequest POST /factors/validate 請求
+type FactorValidateRequest struct {
+	Formula string `json:"formula" validate:"required,max=1024"`
+}
+
+// FactorValidateResponse POST /factors/validate 回傳
+type FactorValidateResponse struct {
+	Valid  bool     `json:"valid"`
+	Inputs []string `json:"inputs,omitempty"`
+	Warmup int      `json:"warmup,omitempty"`
+	Error  string   `json:"error,omitempty"`
+}
+
+// ================================
+// S2 Feature Generator - 資料品質與漂移監控（DQC / Drift）
+// ================================
+
+// DQC 旗標
+const (
+	DQCFlagNull       = "NULL"         // 缺值（計算失敗、NaN 或先前出現過的特徵消失）
+	DQCFlagStale      = "STALE"        // 連續多根 K 線數值不變
+	DQCFlagOutOfRange = "OUT_OF_RANGE" // 超出合理值域
+	DQCFlagDrift      = "DRIFT"        // PSI/KS 超過門檻
+)
+
+// FeatureDQC 特徵快照的資料品質標記（TODO §3 dqc 欄位）
+type FeatureDQC struct {
+	Pass            bool                `json:"pass"`    // 缺值率未超標、無越界、無漂移
+	Missing         bool                `json:"missing"` // 任一特徵缺值
+	NullCount       int                 `json:"null_count"`
+	NullRate        float64             `json:"null_rate"`
+	StaleCount      int                 `json:"stale_count"`
+	OutOfRangeCount int                 `json:"out_of_range_count"`
+	DriftedCount    int                 `json:"drifted_count"`
+	MaxPSI          float64             `json:"max_psi"`
+	MaxKS           float64             `json:"max_ks"`
+	Flags           map[string][]string `json:"flags,omitempty"` // 特徵名 → 旗標
+	Note            string              `json:"note,omitempty"`
+}
+
+// FeatureDriftStat 單一特徵相對參考視窗的漂移統計
+type FeatureDriftStat struct {
+	Feature       string  `json:"feature"`
+	PSI           float64 `json:"psi"`
+	KS            float64 `json:"ks"`
+	ReferenceSize int     `json:"reference_size"`
+	CurrentSize   int     `json:"current_size"`
+	Drifted       bool    `json:"drifted"`
+}
+
+// DriftReport GET /features/drift 回傳（每個 symbol × timeframe 最近一次檢查）
+type DriftReport struct {
+	Symbol    string             `json:"symbol"`
+	Timeframe string             `json:"timeframe"`
+	BarMs     int64              `json:"bar_ms"` // 最近一根納入統計的 K 線開盤時間
+	DQC       FeatureDQC         `json:"dqc"`
+	Drift     []FeatureDriftStat `json:"drift"`    // 參考與當前視窗皆足量的特徵
+	Alerting  bool               `json:"alerting"` // 漂移或缺值率超標
+	UpdatedAt time.Time          `json:"updated_at"`
+}
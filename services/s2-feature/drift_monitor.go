@@ -0,0 +1,616 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"path"
+	"s2-feature/dao"
+	"s2-feature/internal/compute"
+	"s2-feature/internal/config"
+	"s2-feature/internal/services/redis"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 漂移監控預設值（env.yaml drift 區塊未設定時使用）
+const (
+	defaultDriftReferenceSize = 500
+	defaultDriftCurrentSize   = 100
+	defaultDriftBins          = 10
+	defaultPSIThreshold       = 0.25
+	defaultKSThreshold        = 0.3
+	defaultNullRateThreshold  = 0.2
+	defaultStaleBars          = 10
+	defaultFallbackTTL        = 15 * time.Minute
+
+	driftMetricsStream = "metrics:events:s2.drift"
+	dqcMetricsStream   = "metrics:events:s2.dqc"
+	alertsStream       = "alerts"
+)
+
+// rulesOnlyKey S3 讀取的純規則模式旗標（per symbol；值含原因，TTL 到期自動恢復）
+func rulesOnlyKey(symbol string) string {
+	return "prod:{strategy}:rules_only:" + symbol
+}
+
+// defaultFeatureRanges 內建值域（特徵名 = 類型.欄位）；env.yaml drift.ranges 可覆寫或新增
+var defaultFeatureRanges = map[string][2]float64{
+	"ATR.atr":                 {0, math.Inf(1)},
+	"ATR.atr_pct":             {0, 50},
+	"RV.rv":                   {0, 10},
+	"RV.rv_pct":               {0, 1000},
+	"CORRELATION.correlation": {-1, 1},
+	"DEPTH.bid_depth":         {0, math.Inf(1)},
+	"DEPTH.ask_depth":         {0, math.Inf(1)},
+	"DEPTH.bid_ask_ratio":     {0, math.Inf(1)},
+	"DEPTH.spread":            {0, math.Inf(1)},
+	"DEPTH.spread_pct":        {0, 1},
+	"MTF.mtf_alignment_score": {-1, 1},
+	"MTF.mtf_agree_ratio":     {0, 1},
+	"RSI.rsi":                 {0, 100},
+	"ADX.adx":                 {0, 100},
+	"ADX.plus_di":             {0, 100},
+	"ADX.minus_di":            {0, 100},
+	"VWAP.vwap":               {0, math.Inf(1)},
+	"CARRY.funding_rate":      {-1, 1},
+	"CARRY.funding_next":      {-1, 1},
+	"CARRY.open_interest":     {0, math.Inf(1)},
+}
+
+// defaultStaleExclude 不檢查 stale 的特徵（path.Match 樣式）：多時框趨勢為離散值且沿用至高週期收盤前，
+// 已結算的資金費每個結算週期才變動；env.yaml drift.stale_exclude 可再新增
+var defaultStaleExclude = []string{
+	"MTF.*",
+	"CARRY.funding_rate",
+	"CARRY.funding_cum",
+	"CARRY.funding_zscore",
+	"CARRY.funding_settlements",
+}
+
+// DriftConfig 漂移監控參數
+type DriftConfig struct {
+	ReferenceSize     int
+	CurrentSize       int
+	Bins              int
+	PSIThreshold      float64
+	KSThreshold       float64
+	NullRateThreshold float64
+	StaleBars         int
+	StaleExclude      []string // 不檢查 stale 的特徵（離散、沿用或低頻更新者）
+	Ranges            map[string][2]float64
+}
+
+// DriftMonitor 特徵漂移與資料品質監控
+//
+// 每個 symbol × 週期、每個數值特徵維護兩個視窗：參考視窗（先填滿後凍結，可由特徵庫的訓練期資料預載）
+// 與當前視窗（最近 CurrentSize 筆）。只有新 K 線才推進視窗與 stale 計數，同一根 K 線重算僅重新評估旗標。
+type DriftMonitor struct {
+	cfg    DriftConfig
+	mu     sync.Mutex
+	states map[string]*driftState
+}
+
+type driftState struct {
+	symbol    string
+	lastBarMs int64
+	series    map[string]*featureSeries
+	report    *dao.DriftReport
+}
+
+type featureSeries struct {
+	reference []float64
+	current   []float64
+	last      float64
+	repeats   int // 與前一根相同的連續次數
+}
+
+func NewDriftMonitor(cfg DriftConfig) *DriftMonitor {
+	return &DriftMonitor{cfg: cfg, states: make(map[string]*driftState)}
+}
+
+func (m *DriftMonitor) state(symbol, window string) *driftState {
+	key := symbol + "|" + window
+	st, ok := m.states[key]
+	if !ok {
+		st = &driftState{symbol: symbol, lastBarMs: math.MinInt64, series: make(map[string]*featureSeries)}
+		m.states[key] = st
+	}
+	return st
+}
+
+// Seeded 該 symbol × 週期是否已有狀態（決定是否需自特徵庫預載參考視窗）
+func (m *DriftMonitor) Seeded(symbol, window string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.states[symbol+"|"+window]
+	return ok
+}
+
+// Seed 以歷史特徵預載參考視窗（依時間升冪）
+func (m *DriftMonitor) Seed(symbol, window string, history []map[string]interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	st := m.state(symbol, window)
+	for _, features := range history {
+		for name, value := range numericFeatures(features) {
+			if value == nil {
+				continue
+			}
+			fs := st.seriesFor(name)
+			if len(fs.reference) < m.cfg.ReferenceSize {
+				fs.reference = append(fs.reference, *value)
+			}
+		}
+	}
+}
+
+// staleChecked 特徵是否為逐根更新的連續值（未列於 StaleExclude）
+func (m *DriftMonitor) staleChecked(name string) bool {
+	for _, pattern := range m.cfg.StaleExclude {
+		if ok, _ := path.Match(pattern, name); ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (st *driftState) seriesFor(name string) *featureSeries {
+	fs, ok := st.series[name]
+	if !ok {
+		fs = &featureSeries{last: math.NaN()}
+		st.series[name] = fs
+	}
+	return fs
+}
+
+// Observe 評估一次特徵快照並回傳最新報告；barMs 為最新 K 線開盤時間
+func (m *DriftMonitor) Observe(symbol, window string, barMs int64, features map[string]interface{}) *dao.DriftReport {
+	values := numericFeatures(features)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	st := m.state(symbol, window)
+	newBar := barMs > st.lastBarMs
+	if newBar {
+		st.lastBarMs = barMs
+	}
+
+	// 先前出現過但本次缺席的特徵視為缺值
+	for name := range st.series {
+		if _, ok := values[name]; !ok {
+			values[name] = nil
+		}
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	dqc := dao.FeatureDQC{}
+	flags := make(map[string][]string)
+	var drift []dao.FeatureDriftStat
+
+	for _, name := range names {
+		value := values[name]
+		fs := st.seriesFor(name)
+
+		if value == nil {
+			dqc.NullCount++
+			flags[name] = append(flags[name], dao.DQCFlagNull)
+			continue
+		}
+		v := *value
+
+		if bounds, ok := m.cfg.Ranges[name]; ok && (v < bounds[0] || v > bounds[1]) {
+			dqc.OutOfRangeCount++
+			flags[name] = append(flags[name], dao.DQCFlagOutOfRange)
+		}
+
+		if newBar {
+			if v == fs.last {
+				fs.repeats++
+			} else {
+				fs.repeats = 0
+			}
+			fs.last = v
+
+			if len(fs.reference) < m.cfg.ReferenceSize {
+				fs.reference = append(fs.reference, v)
+			} else {
+				fs.current = append(fs.current, v)
+				if len(fs.current) > m.cfg.CurrentSize {
+					fs.current = fs.current[len(fs.current)-m.cfg.CurrentSize:]
+				}
+			}
+		}
+
+		if m.cfg.StaleBars > 0 && fs.repeats+1 >= m.cfg.StaleBars && m.staleChecked(name) {
+			dqc.StaleCount++
+			flags[name] = append(flags[name], dao.DQCFlagStale)
+		}
+
+		// 參考與當前視窗皆足量才計算漂移
+		if len(fs.reference) < m.cfg.CurrentSize || len(fs.current) < m.cfg.CurrentSize {
+			continue
+		}
+		stat := dao.FeatureDriftStat{
+			Feature:       name,
+			PSI:           compute.PSI(fs.reference, fs.current, m.cfg.Bins),
+			KS:            compute.KSStatistic(fs.reference, fs.current),
+			ReferenceSize: len(fs.reference),
+			CurrentSize:   len(fs.current),
+		}
+		stat.Drifted = stat.PSI >= m.cfg.PSIThreshold || stat.KS >= m.cfg.KSThreshold
+		if stat.Drifted {
+			dqc.DriftedCount++
+			flags[name] = append(flags[name], dao.DQCFlagDrift)
+		}
+		dqc.MaxPSI = math.Max(dqc.MaxPSI, stat.PSI)
+		dqc.MaxKS = math.Max(dqc.MaxKS, stat.KS)
+		drift = append(drift, stat)
+	}
+
+	if len(names) > 0 {
+		dqc.NullRate = float64(dqc.NullCount) / float64(len(names))
+	}
+	dqc.Missing = dqc.NullCount > 0
+	nullBreach := dqc.NullRate > m.cfg.NullRateThreshold
+	dqc.Pass = !nullBreach && dqc.OutOfRangeCount == 0 && dqc.DriftedCount == 0
+	if len(flags) > 0 {
+		dqc.Flags = flags
+	}
+	dqc.Note = dqcNote(flags)
+
+	st.report = &dao.DriftReport{
+		Symbol:    symbol,
+		Timeframe: window,
+		BarMs:     st.lastBarMs,
+		DQC:       dqc,
+		Drift:     drift,
+		Alerting:  nullBreach || dqc.DriftedCount > 0,
+		UpdatedAt: time.Now(),
+	}
+
+	report := *st.report
+	return &report
+}
+
+// Report 最近一次報告（無則 nil）
+func (m *DriftMonitor) Report(symbol, window string) *dao.DriftReport {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	st, ok := m.states[symbol+"|"+window]
+	if !ok || st.report == nil {
+		return nil
+	}
+	report := *st.report
+	return &report
+}
+
+// Reports 指定 symbol 各週期最近一次報告（依週期排序）
+func (m *DriftMonitor) Reports(symbol string) []dao.DriftReport {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	reports := make([]dao.DriftReport, 0)
+	for _, window := range supportedWindows {
+		if st, ok := m.states[symbol+"|"+window]; ok && st.report != nil {
+			reports = append(reports, *st.report)
+		}
+	}
+	return reports
+}
+
+// SymbolAlerting 該 symbol 是否仍有任一週期處於告警
+func (m *DriftMonitor) SymbolAlerting(symbol string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, st := range m.states {
+		if st.symbol == symbol && st.report != nil && st.report.Alerting {
+			return true
+		}
+	}
+	return false
+}
+
+// numericFeatures 將特徵攤平為「類型.欄位」→ 值；nil / NaN / Inf 以 nil 表示缺值
+// 字串、布林與中繼欄位（period/timestamp）不納入監控
+func numericFeatures(features map[string]interface{}) map[string]*float64 {
+	values := make(map[string]*float64)
+	for featureType, raw := range features {
+		fields, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for name, field := range fields {
+			if name == "period" || name == "timestamp" {
+				continue
+			}
+			key := featureType + "." + name
+			var v float64
+			switch x := field.(type) {
+			case nil:
+				values[key] = nil
+				continue
+			case float64:
+				v = x
+			case int:
+				v = float64(x)
+			case int64:
+				v = float64(x)
+			default:
+				continue
+			}
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				values[key] = nil
+				continue
+			}
+			values[key] = &v
+		}
+	}
+	return values
+}
+
+// dqcNote 旗標摘要，如 "DRIFT: RV.rv; NULL: FACTORS.x"
+func dqcNote(flags map[string][]string) string {
+	if len(flags) == 0 {
+		return ""
+	}
+	byFlag := make(map[string][]string)
+	for name, fs := range flags {
+		for _, f := range fs {
+			byFlag[f] = append(byFlag[f], name)
+		}
+	}
+	parts := make([]string, 0, len(byFlag))
+	for _, f := range []string{dao.DQCFlagDrift, dao.DQCFlagNull, dao.DQCFlagOutOfRange, dao.DQCFlagStale} {
+		if names, ok := byFlag[f]; ok {
+			sort.Strings(names)
+			parts = append(parts, f+": "+strings.Join(names, ","))
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+// initializeDriftMonitor 依 env.yaml drift 區塊建立監控器
+func (s *S2_FEATUREServer) initializeDriftMonitor() {
+	cfg := config.AppConfig.Drift
+
+	driftCfg := DriftConfig{
+		ReferenceSize:     cfg.ReferenceSize,
+		CurrentSize:       cfg.CurrentSize,
+		Bins:              cfg.Bins,
+		PSIThreshold:      cfg.PSIThreshold,
+		KSThreshold:       cfg.KSThreshold,
+		NullRateThreshold: cfg.NullRateThreshold,
+		StaleBars:         cfg.StaleBars,
+		StaleExclude:      append(append([]string(nil), defaultStaleExclude...), cfg.StaleExclude...),
+		Ranges:            make(map[string][2]float64, len(defaultFeatureRanges)+len(cfg.Ranges)),
+	}
+	if driftCfg.ReferenceSize <= 0 {
+		driftCfg.ReferenceSize = defaultDriftReferenceSize
+	}
+	if driftCfg.CurrentSize <= 0 {
+		driftCfg.CurrentSize = defaultDriftCurrentSize
+	}
+	if driftCfg.Bins <= 0 {
+		driftCfg.Bins = defaultDriftBins
+	}
+	if driftCfg.PSIThreshold <= 0 {
+		driftCfg.PSIThreshold = defaultPSIThreshold
+	}
+	if driftCfg.KSThreshold <= 0 {
+		driftCfg.KSThreshold = defaultKSThreshold
+	}
+	if driftCfg.NullRateThreshold <= 0 {
+		driftCfg.NullRateThreshold = defaultNullRateThreshold
+	}
+	if driftCfg.StaleBars <= 0 {
+		driftCfg.StaleBars = defaultStaleBars
+	}
+	for _, pattern := range driftCfg.StaleExclude {
+		if _, err := path.Match(pattern, ""); err != nil {
+			log.Printf("Invalid drift.stale_exclude pattern %q: %v", pattern, err)
+		}
+	}
+	for name, bounds := range defaultFeatureRanges {
+		driftCfg.Ranges[name] = bounds
+	}
+	for name, bounds := range cfg.Ranges {
+		if len(bounds) != 2 || bounds[0] > bounds[1] {
+			log.Printf("Invalid drift.ranges[%s] %v, expected [min, max]", name, bounds)
+			continue
+		}
+		driftCfg.Ranges[name] = [2]float64{bounds[0], bounds[1]}
+	}
+
+	s.driftMonitor = NewDriftMonitor(driftCfg)
+	s.rulesOnlyFallback = cfg.RulesOnlyFallback
+	s.fallbackTTL = defaultFallbackTTL
+	if cfg.FallbackTTL != "" {
+		if ttl, err := time.ParseDuration(cfg.FallbackTTL); err == nil {
+			s.fallbackTTL = ttl
+		} else {
+			log.Printf("Invalid drift.fallback_ttl %q, using %s: %v", cfg.FallbackTTL, defaultFallbackTTL, err)
+		}
+	}
+}
+
+// checkFeatureQuality 對快照執行 DQC / 漂移檢查，回傳要附加到快照的 DQC 標記，並發布指標與告警
+func (s *S2_FEATUREServer) checkFeatureQuality(symbol, window string, marketData []MarketDataPoint, features map[string]interface{}) *dao.FeatureDQC {
+	if !s.driftMonitor.Seeded(symbol, window) {
+		s.seedDriftReference(symbol, window)
+	}
+
+	previous := s.driftMonitor.Report(symbol, window)
+	report := s.driftMonitor.Observe(symbol, window, marketData[len(marketData)-1].Timestamp, features)
+	wasAlerting := previous != nil && previous.Alerting
+
+	if s.redisClient != nil {
+		go s.publishQualityEvents(report, wasAlerting)
+	}
+
+	dqc := report.DQC
+	return &dqc
+}
+
+// seedDriftReference 設定了訓練期區間時，自時點特徵庫預載參考視窗
+func (s *S2_FEATUREServer) seedDriftReference(symbol, window string) {
+	cfg := config.AppConfig.Drift
+	if cfg.ReferenceFromMs <= 0 || cfg.ReferenceToMs <= cfg.ReferenceFromMs {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	records, err := s.featureStore.Range(ctx, symbol, window, s.featureVersion, cfg.ReferenceFromMs, cfg.ReferenceToMs, s.driftMonitor.cfg.ReferenceSize)
+	if err != nil {
+		log.Printf("Failed to load drift reference for %s %s: %v", symbol, window, err)
+		return
+	}
+
+	history := make([]map[string]interface{}, len(records))
+	for i := range records {
+		history[i] = records[i].Features
+	}
+	s.driftMonitor.Seed(symbol, window, history)
+	log.Printf("Seeded drift reference for %s %s with %d records", symbol, window, len(records))
+}
+
+// publishQualityEvents 發布 DQC / 漂移指標到 S11，告警狀態切換時發 alerts 並切換 S3 純規則模式
+func (s *S2_FEATUREServer) publishQualityEvents(report *dao.DriftReport, wasAlerting bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ts := time.Now().UnixMilli()
+	baseTags := map[string]string{"symbol": report.Symbol, "timeframe": report.Timeframe}
+
+	points := []dao.MetricPoint{
+		{Metric: "s2.dqc.null_rate", Value: report.DQC.NullRate, Ts: ts, Tags: baseTags},
+		{Metric: "s2.dqc.stale.count", Value: float64(report.DQC.StaleCount), Ts: ts, Tags: baseTags},
+		{Metric: "s2.dqc.out_of_range.count", Value: float64(report.DQC.OutOfRangeCount), Ts: ts, Tags: baseTags},
+	}
+	if !report.DQC.Pass {
+		points = append(points, dao.MetricPoint{Metric: "s2.dqc.fail.count", Value: 1, Ts: ts, Tags: baseTags})
+	}
+	for _, p := range points {
+		s.publishMetric(ctx, dqcMetricsStream, p)
+	}
+
+	for _, stat := range report.Drift {
+		tags := map[string]string{"symbol": report.Symbol, "timeframe": report.Timeframe, "feature": stat.Feature}
+		s.publishMetric(ctx, driftMetricsStream, dao.MetricPoint{Metric: "s2.feature.psi", Value: stat.PSI, Ts: ts, Tags: tags})
+		s.publishMetric(ctx, driftMetricsStream, dao.MetricPoint{Metric: "s2.feature.ks", Value: stat.KS, Ts: ts, Tags: tags})
+	}
+
+	switch {
+	case report.Alerting && !wasAlerting:
+		s.publishAlert(ctx, dao.SevWarn, fmt.Sprintf("Feature quality breach %s %s: %s (max_psi=%.3f, max_ks=%.3f, null_rate=%.2f)",
+			report.Symbol, report.Timeframe, report.DQC.Note, report.DQC.MaxPSI, report.DQC.MaxKS, report.DQC.NullRate))
+	case !report.Alerting && wasAlerting:
+		s.publishAlert(ctx, dao.SevInfo, fmt.Sprintf("Feature quality recovered %s %s", report.Symbol, report.Timeframe))
+	}
+
+	if !s.rulesOnlyFallback {
+		return
+	}
+	key := rulesOnlyKey(report.Symbol)
+	if report.Alerting {
+		// 告警期間持續續期；S2 停擺時 TTL 到期自動解除
+		payload, _ := json.Marshal(map[string]interface{}{
+			"source":    "s2",
+			"reason":    "feature_drift",
+			"timeframe": report.Timeframe,
+			"note":      report.DQC.Note,
+			"ts":        ts,
+		})
+		if err := s.redisClient.Client.Set(ctx, key, payload, s.fallbackTTL).Err(); err != nil {
+			log.Printf("Failed to set %s: %v", key, err)
+		}
+	} else if wasAlerting && !s.driftMonitor.SymbolAlerting(report.Symbol) {
+		if err := s.redisClient.Client.Del(ctx, key).Err(); err != nil {
+			log.Printf("Failed to clear %s: %v", key, err)
+		}
+	}
+}
+
+func (s *S2_FEATUREServer) publishMetric(ctx context.Context, stream string, point dao.MetricPoint) {
+	tags, _ := json.Marshal(point.Tags)
+	_, err := s.redisClient.PublishStream(ctx, stream, redis.StreamMessage{
+		"metric": point.Metric,
+		"value":  point.Value,
+		"ts":     point.Ts,
+		"tags":   string(tags),
+	})
+	if err != nil {
+		log.Printf("Failed to publish metric %s: %v", point.Metric, err)
+	}
+}
+
+func (s *S2_FEATUREServer) publishAlert(ctx context.Context, severity dao.Severity, message string) {
+	alert := dao.Alert{
+		AlertID:  fmt.Sprintf("s2-dqc-%d", time.Now().UnixNano()),
+		Severity: severity,
+		Source:   "s2",
+		Message:  message,
+		Ts:       time.Now().UnixMilli(),
+	}
+	_, err := s.redisClient.PublishStream(ctx, alertsStream, redis.StreamMessage{
+		"alert_id": alert.AlertID,
+		"severity": string(alert.Severity),
+		"source":   alert.Source,
+		"message":  alert.Message,
+		"ts":       alert.Ts,
+	})
+	if err != nil {
+		log.Printf("Failed to publish alert: %v", err)
+	}
+	log.Printf("[%s] %s", severity, message)
+}
+
+// @Summary Get feature drift report
+// @Description Latest DQC flags and PSI/KS drift statistics per timeframe
+// @Tags features
+// @Produce json
+// @Param symbol query string true "Symbol (e.g., BTCUSDT)"
+// @Param timeframe query string false "Timeframe (1m/5m/1h/4h/1d); empty = all"
+// @Success 200 {array} dao.DriftReport
+// @Failure 400 {object} map[string]string "Bad request"
+// @Failure 404 {object} map[string]string "No report"
+// @Router /features/drift [get]
+func (s *S2_FEATUREServer) GetFeatureDrift(c *gin.Context) {
+	symbol := c.Query("symbol")
+	if symbol == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "symbol parameter is required"})
+		return
+	}
+
+	reports := s.driftMonitor.Reports(symbol)
+	if timeframe := c.Query("timeframe"); timeframe != "" {
+		report := s.driftMonitor.Report(symbol, timeframe)
+		reports = reports[:0]
+		if report != nil {
+			reports = append(reports, *report)
+		}
+	}
+
+	if len(reports) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no drift report for symbol"})
+		return
+	}
+
+	c.JSON(http.StatusOK, reports)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"s2-feature/dao"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestDriftMonitor() *DriftMonitor {
+	return NewDriftMonitor(DriftConfig{
+		ReferenceSize:     20,
+		CurrentSize:       10,
+		Bins:              5,
+		PSIThreshold:      0.25,
+		KSThreshold:       0.3,
+		NullRateThreshold: 0.2,
+		StaleBars:         3,
+		Ranges:            map[string][2]float64{"RV.rv": {0, 10}},
+	})
+}
+
+func TestDriftMonitor_DQCFlags(t *testing.T) {
+	monitor := newTestDriftMonitor()
+
+	features := func(rv interface{}, depth float64) map[string]interface{} {
+		return map[string]interface{}{
+			"RV":    map[string]interface{}{"rv": rv, "period": 20},
+			"DEPTH": map[string]interface{}{"bid_depth": depth, "symbol": "BTCUSDT"},
+		}
+	}
+
+	report := monitor.Observe("BTCUSDT", "1h", 1, features(0.5, 1000.0))
+	assert.True(t, report.DQC.Pass)
+	assert.Empty(t, report.DQC.Flags)
+
+	// 越界
+	report = monitor.Observe("BTCUSDT", "1h", 2, features(12.0, 1000.0))
+	assert.Equal(t, 1, report.DQC.OutOfRangeCount)
+	assert.Equal(t, []string{dao.DQCFlagOutOfRange}, report.DQC.Flags["RV.rv"])
+	assert.False(t, report.DQC.Pass)
+
+	// 第三根 bid_depth 仍不變 → stale；stale 不影響 Pass
+	report = monitor.Observe("BTCUSDT", "1h", 3, features(0.6, 1000.0))
+	assert.Equal(t, 1, report.DQC.StaleCount)
+	assert.Contains(t, report.DQC.Flags["DEPTH.bid_depth"], dao.DQCFlagStale)
+	assert.True(t, report.DQC.Pass)
+
+	// 缺值：NaN 與先前出現過的特徵消失都算
+	report = monitor.Observe("BTCUSDT", "1h", 4, map[string]interface{}{
+		"RV": map[string]interface{}{"rv": math.NaN()},
+	})
+	assert.Equal(t, 2, report.DQC.NullCount)
+	assert.True(t, report.DQC.Missing)
+	assert.InDelta(t, 1.0, report.DQC.NullRate, 1e-12)
+	assert.True(t, report.Alerting)
+	assert.Contains(t, report.DQC.Note, "NULL: DEPTH.bid_depth,RV.rv")
+}
+
+func TestDriftMonitor_StaleExclude(t *testing.T) {
+	monitor := newTestDriftMonitor()
+	monitor.cfg.StaleExclude = append(append([]string(nil), defaultStaleExclude...), "FACTORS.regime_*")
+
+	// 高週期趨勢與旗標在低週期 K 線上沿用、已結算資金費與離散因子維持不變，都不算 stale；連續特徵照常檢查
+	features := map[string]interface{}{
+		"MTF":     map[string]interface{}{"trend_4h": 1, "htf_trend": 1, "mtf_agree_ratio": 1.0, "htf_veto_long": false},
+		"CARRY":   map[string]interface{}{"funding_rate": 0.0001, "funding_zscore": 0.4},
+		"FACTORS": map[string]interface{}{"regime_trend": 1.0},
+		"DEPTH":   map[string]interface{}{"bid_depth": 1000.0},
+	}
+	var report *dao.DriftReport
+	for bar := int64(1); bar <= 5; bar++ {
+		report = monitor.Observe("BTCUSDT", "15m", bar, features)
+	}
+	assert.Equal(t, 1, report.DQC.StaleCount)
+	assert.Equal(t, map[string][]string{"DEPTH.bid_depth": {dao.DQCFlagStale}}, report.DQC.Flags)
+	assert.Equal(t, "STALE: DEPTH.bid_depth", report.DQC.Note)
+}
+
+func TestDriftMonitor_Drift(t *testing.T) {
+	monitor := newTestDriftMonitor()
+	bar := int64(0)
+	observe := func(v float64) *dao.DriftReport {
+		bar++
+		return monitor.Observe("ETHUSDT", "4h", bar, map[string]interface{}{
+			"ATR": map[string]interface{}{"atr_pct": v},
+		})
+	}
+
+	// 參考視窗：0~19
+	for i := 0; i < 20; i++ {
+		observe(float64(i))
+	}
+	// 同分布的當前視窗：不漂移
+	var report *dao.DriftReport
+	for i := 0; i < 10; i++ {
+		report = observe(float64(i * 2))
+	}
+	if assert.Len(t, report.Drift, 1) {
+		assert.False(t, report.Drift[0].Drifted)
+		assert.Equal(t, 20, report.Drift[0].ReferenceSize)
+	}
+	assert.False(t, report.Alerting)
+
+	// 整體平移到參考視窗外
+	for i := 0; i < 10; i++ {
+		report = observe(100 + float64(i))
+	}
+	assert.True(t, report.Alerting)
+	assert.Equal(t, 1, report.DQC.DriftedCount)
+	assert.InDelta(t, 1.0, report.DQC.MaxKS, 1e-12)
+	assert.Greater(t, report.DQC.MaxPSI, 0.25)
+	assert.True(t, monitor.SymbolAlerting("ETHUSDT"))
+	assert.False(t, monitor.SymbolAlerting("BTCUSDT"))
+
+	// 同一根 K 線重算不推進視窗
+	again := monitor.Observe("ETHUSDT", "4h", bar, map[string]interface{}{
+		"ATR": map[string]interface{}{"atr_pct": 5.0},
+	})
+	assert.Equal(t, report.Drift[0].KS, again.Drift[0].KS)
+}
+
+func TestDriftMonitor_SeedReference(t *testing.T) {
+	monitor := newTestDriftMonitor()
+	assert.False(t, monitor.Seeded("BTCUSDT", "1d"))
+
+	history := make([]map[string]interface{}, 30)
+	for i := range history {
+		history[i] = map[string]interface{}{"RV": map[string]interface{}{"rv": float64(i % 20)}}
+	}
+	monitor.Seed("BTCUSDT", "1d", history)
+	assert.True(t, monitor.Seeded("BTCUSDT", "1d"))
+
+	// 參考視窗已滿（只取前 20 筆），新資料直接進入當前視窗
+	var report *dao.DriftReport
+	for i := 0; i < 10; i++ {
+		report = monitor.Observe("BTCUSDT", "1d", int64(i), map[string]interface{}{
+			"RV": map[string]interface{}{"rv": float64(i * 2)},
+		})
+	}
+	if assert.Len(t, report.Drift, 1) {
+		assert.Equal(t, 20, report.Drift[0].ReferenceSize)
+		assert.Equal(t, 10, report.Drift[0].CurrentSize)
+	}
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"context"
+	"log"
+	"math"
+	"net/http"
+	"s2-feature/dao"
+	"s2-feature/internal/config"
+	"s2-feature/internal/formula"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const defaultFactorReloadInterval = 30 * time.Second
+
+// FactorEngine 公式因子引擎：持有已編譯公式與每個 symbol × 週期 × 因子的增量求值狀態
+//
+// 每次計算只對上次之後的新 K 線推進求值器，不重算歷史；公式變更或 K 線出現斷層時重建狀態。
+// 歷史 K 線只提供 open/high/low/close/volume，既有特徵（atr、rv…）只在最新一根提供，
+// 因此引用特徵的視窗函數需隨服務運行逐根累積。
+type FactorEngine struct {
+	mu       sync.Mutex
+	rev      int
+	bundleID string
+	factors  map[string]*formula.Expr
+	errors   map[string]string
+	states   map[string]*factorState
+}
+
+type factorState struct {
+	evaluator *formula.Evaluator
+	lastBarMs int64
+	value     float64
+}
+
+func NewFactorEngine() *FactorEngine {
+	return &FactorEngine{
+		factors: make(map[string]*formula.Expr),
+		errors:  make(map[string]string),
+		states:  make(map[string]*factorState),
+	}
+}
+
+// Load 以新定義原子替換因子集合；公式未變的因子保留求值狀態
+func (e *FactorEngine) Load(rev int, bundleID string, defs []dao.FactorDefinition) {
+	factors := make(map[string]*formula.Expr, len(defs))
+	errors := make(map[string]string)
+	for _, def := range defs {
+		expr, err := formula.Parse(def.Formula)
+		if err != nil {
+			errors[def.FactorID] = err.Error()
+			continue
+		}
+		factors[def.FactorID] = expr
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for key, state := range e.states {
+		factorID := key[strings.LastIndex(key, "|")+1:]
+		expr, ok := factors[factorID]
+		if !ok || expr.Source() != state.evaluator.Expr().Source() {
+			delete(e.states, key)
+		}
+	}
+
+	e.rev = rev
+	e.bundleID = bundleID
+	e.factors = factors
+	e.errors = errors
+}
+
+// Rev 目前生效的 config_active.rev
+func (e *FactorEngine) Rev() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.rev
+}
+
+// List 目前生效的因子定義
+func (e *FactorEngine) List() dao.FactorListResponse {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	response := dao.FactorListResponse{
+		Rev:      e.rev,
+		BundleID: e.bundleID,
+		Factors:  make([]dao.FactorDefinition, 0, len(e.factors)),
+	}
+	for id, expr := range e.factors {
+		response.Factors = append(response.Factors, dao.FactorDefinition{
+			FactorID: id,
+			Formula:  expr.Source(),
+			Inputs:   expr.Inputs(),
+			Warmup:   expr.Warmup(),
+		})
+	}
+	sort.Slice(response.Factors, func(i, j int) bool {
+		return response.Factors[i].FactorID < response.Factors[j].FactorID
+	})
+	if len(e.errors) > 0 {
+		response.Errors = make(map[string]string, len(e.errors))
+		for id, msg := range e.errors {
+			response.Errors[id] = msg
+		}
+	}
+	return response
+}
+
+// Evaluate 推進各因子至最新一根 K 線並回傳 factor_id → 值（暖機中為 nil）
+func (e *FactorEngine) Evaluate(symbol, window string, candles []MarketDataPoint, features map[string]interface{}) map[string]interface{} {
+	if len(candles) == 0 {
+		return nil
+	}
+	latest := flattenFeatureVars(features)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if len(e.factors) == 0 {
+		return nil
+	}
+
+	result := make(map[string]interface{}, len(e.factors))
+	for id, expr := range e.factors {
+		key := symbol + "|" + window + "|" + id
+		state, ok := e.states[key]
+		// 首次計算或 K 線斷層（上次位置已不在本批資料內）時重建
+		if !ok || state.lastBarMs < candles[0].Timestamp {
+			state = &factorState{evaluator: expr.NewEvaluator(), lastBarMs: math.MinInt64, value: math.NaN()}
+			e.states[key] = state
+		}
+
+		for i, bar := range candles {
+			if bar.Timestamp <= state.lastBarMs {
+				continue
+			}
+			vars := map[string]float64{
+				"open":   bar.Open,
+				"high":   bar.High,
+				"low":    bar.Low,
+				"close":  bar.Close,
+				"volume": bar.Volume,
+			}
+			if i == len(candles)-1 {
+				for name, v := range latest {
+					if _, exists := vars[name]; !exists {
+						vars[name] = v
+					}
+				}
+			}
+			state.value = state.evaluator.Step(vars)
+			state.lastBarMs = bar.Timestamp
+		}
+
+		if math.IsNaN(state.value) || math.IsInf(state.value, 0) {
+			result[id] = nil
+		} else {
+			result[id] = state.value
+		}
+	}
+
+	return result
+}
+
+// flattenFeatureVars 將 {"ATR": {"atr_pct": ...}} 攤平為 {"atr_pct": ...}，供公式以名稱引用
+// 特徵類型依字母序處理，同名時先出現者優先；period/timestamp 等中繼欄位不輸出
+func flattenFeatureVars(features map[string]interface{}) map[string]float64 {
+	types := make([]string, 0, len(features))
+	for featureType := range features {
+		types = append(types, featureType)
+	}
+	sort.Strings(types)
+
+	vars := make(map[string]float64)
+	for _, featureType := range types {
+		values, ok := features[featureType].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for name, raw := range values {
+			name = strings.ToLower(name)
+			if name == "period" || name == "timestamp" {
+				continue
+			}
+			if _, exists := vars[name]; exists {
+				continue
+			}
+			switch v := raw.(type) {
+			case float64:
+				vars[name] = v
+			case int:
+				vars[name] = float64(v)
+			case int64:
+				vars[name] = float64(v)
+			}
+		}
+	}
+	return vars
+}
+
+// initializeFactors 載入 env.yaml 靜態因子，並在 ArangoDB 可用時自 S10 Bundle 熱載
+func (s *S2_FEATUREServer) initializeFactors() {
+	cfg := config.AppConfig.Factors
+
+	s.factorEngine = NewFactorEngine()
+	for _, f := range cfg.Static {
+		s.staticFactors = append(s.staticFactors, dao.FactorDefinition{FactorID: f.FactorID, Formula: f.Formula})
+	}
+	s.factorEngine.Load(0, "", s.staticFactors)
+
+	if s.arangodbClient == nil {
+		return
+	}
+
+	interval := defaultFactorReloadInterval
+	if cfg.ReloadInterval != "" {
+		if d, err := time.ParseDuration(cfg.ReloadInterval); err == nil && d > 0 {
+			interval = d
+		} else {
+			log.Printf("Invalid factors.reload_interval %q, using %s", cfg.ReloadInterval, defaultFactorReloadInterval)
+		}
+	}
+
+	s.reloadFactors()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			s.reloadFactors()
+		}
+	}()
+}
+
+// activeFactorSet config_active → config_bundles → factor_registry 解析結果
+type activeFactorSet struct {
+	Rev      int                    `json:"rev"`
+	BundleID string                 `json:"bundle_id"`
+	Factors  []dao.FactorDefinition `json:"factors"`
+}
+
+// reloadFactors 比對 config_active.rev，變更時載入 Bundle 因子公式（RCU：整組替換）
+func (s *S2_FEATUREServer) reloadFactors() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Bundle.factors 為 factor_id 列表；公式取自 factor_registry，無公式的內建因子略過
+	query := `LET active = FIRST(FOR a IN config_active FILTER a.key == "active" RETURN a)
+		LET bundle = active == null ? null : FIRST(FOR b IN config_bundles FILTER b.bundle_id == active.bundle_id RETURN b)
+		RETURN {
+			rev: active.rev,
+			bundle_id: active.bundle_id,
+			factors: bundle == null ? [] : (
+				FOR f IN factor_registry
+					FILTER f.factor_id IN bundle.factors AND f.status != "DEPRECATED" AND f.formula != null AND f.formula != ""
+					RETURN { factor_id: f.factor_id, formula: f.formula }
+			)
+		}`
+	cursor, err := s.arangodbClient.GetDB().Query(ctx, query, nil)
+	if err != nil {
+		log.Printf("Failed to load active factors: %v", err)
+		return
+	}
+	defer cursor.Close()
+
+	var active activeFactorSet
+	if _, err := cursor.ReadDocument(ctx, &active); err != nil {
+		log.Printf("Failed to read active factors: %v", err)
+		return
+	}
+	if active.Rev == 0 || active.Rev == s.factorEngine.Rev() {
+		return
+	}
+
+	// Bundle 定義優先於同名靜態定義
+	defs := append([]dao.FactorDefinition(nil), active.Factors...)
+	fromBundle := make(map[string]bool, len(active.Factors))
+	for _, def := range active.Factors {
+		fromBundle[def.FactorID] = true
+	}
+	for _, def := range s.staticFactors {
+		if !fromBundle[def.FactorID] {
+			defs = append(defs, def)
+		}
+	}
+
+	s.factorEngine.Load(active.Rev, active.BundleID, defs)
+	loaded := s.factorEngine.List()
+	log.Printf("Loaded %d factors from bundle %s (rev %d), %d invalid", len(loaded.Factors), active.BundleID, active.Rev, len(loaded.Errors))
+	for id, msg := range loaded.Errors {
+		log.Printf("Factor %s rejected: %s", id, msg)
+	}
+}
+
+// @Summary List factors
+// @Description List formula factors currently loaded from the active config bundle
+// @Tags factors
+// @Produce json
+// @Success 200 {object} dao.FactorListResponse
+// @Router /factors [get]
+func (s *S2_FEATUREServer) GetFactors(c *gin.Context) {
+	c.JSON(http.StatusOK, s.factorEngine.List())
+}
+
+// @Summary Validate factor formula
+// @Description Compile a factor formula and report its inputs and warmup length (used by S10 lint)
+// @Tags factors
+// @Accept json
+// @Produce json
+// @Param request body dao.FactorValidateRequest true "Formula"
+// @Success 200 {object} dao.FactorValidateResponse
+// @Failure 400 {object} map[string]string "Bad request"
+// @Router /factors/validate [post]
+func (s *S2_FEATUREServer) ValidateFactor(c *gin.Context) {
+	var req dao.FactorValidateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format", "details": err.Error()})
+		return
+	}
+	if err := s.validator.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "details": err.Error()})
+		return
+	}
+
+	expr, err := formula.Parse(req.Formula)
+	if err != nil {
+		c.JSON(http.StatusOK, dao.FactorValidateResponse{Valid: false, Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, dao.FactorValidateResponse{
+		Valid:  true,
+		Inputs: expr.Inputs(),
+		Warmup: expr.Warmup(),
+	})
+}
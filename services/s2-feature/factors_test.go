@@ -0,0 +1,74 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"s2-feature/dao"
+	"s2-feature/internal/compute"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFactorEngine_IncrementalMatchesBatch(t *testing.T) {
+	engine := NewFactorEngine()
+	engine.Load(1, "bundle-1", []dao.FactorDefinition{
+		{FactorID: "ema_ratio", Formula: "ema(close,20)/ema(close,50)-1"},
+		{FactorID: "broken", Formula: "ema(close)"},
+	})
+
+	list := engine.List()
+	assert.Len(t, list.Factors, 1)
+	assert.Contains(t, list.Errors, "broken")
+
+	hour := time.Hour.Milliseconds()
+	closes := make([]float64, 160)
+	for i := range closes {
+		closes[i] = 100 + float64(i%17) + float64(i)/10
+	}
+	candles := makeCandles(0, hour, closes)
+
+	// 以 100 根的滑動視窗逐根前進，模擬排程計算
+	var last map[string]interface{}
+	for end := 100; end <= len(candles); end++ {
+		last = engine.Evaluate("BTCUSDT", "1h", candles[end-100:end], nil)
+	}
+
+	fast, slow := compute.EMA(closes, 20), compute.EMA(closes, 50)
+	want := compute.Last(fast)/compute.Last(slow) - 1
+	assert.InDelta(t, want, last["ema_ratio"], 1e-12)
+}
+
+func TestFactorEngine_FeatureInputsAndReload(t *testing.T) {
+	engine := NewFactorEngine()
+	engine.Load(1, "bundle-1", []dao.FactorDefinition{
+		{FactorID: "atr_over_close", Formula: "atr / close"},
+		{FactorID: "slow", Formula: "sma(close, 3)"},
+	})
+
+	hour := time.Hour.Milliseconds()
+	candles := makeCandles(0, hour, []float64{10, 20, 30})
+	features := map[string]interface{}{
+		"ATR": map[string]interface{}{"atr": 3.0, "period": 14},
+	}
+
+	values := engine.Evaluate("BTCUSDT", "1h", candles, features)
+	assert.InDelta(t, 0.1, values["atr_over_close"], 1e-12)
+	assert.Equal(t, 20.0, values["slow"])
+
+	// 熱載：未變更的公式保留狀態，新增的因子從頭暖機
+	engine.Load(2, "bundle-2", []dao.FactorDefinition{
+		{FactorID: "slow", Formula: "sma(close, 3)"},
+		{FactorID: "fast", Formula: "sma(close, 2)"},
+	})
+	assert.Equal(t, 2, engine.Rev())
+
+	values = engine.Evaluate("BTCUSDT", "1h", makeCandles(hour, hour, []float64{20, 30, 40}), nil)
+	assert.Equal(t, 30.0, values["slow"])
+	assert.Equal(t, 35.0, values["fast"])
+	assert.NotContains(t, values, "atr_over_close")
+
+	// 暖機中的因子回傳 nil
+	values = engine.Evaluate("ETHUSDT", "1h", makeCandles(0, hour, []float64{1, 2}), nil)
+	assert.Nil(t, values["slow"])
+}
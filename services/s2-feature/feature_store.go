@@ -0,0 +1,470 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"s2-feature/dao"
+	"s2-feature/internal/config"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	driver "github.com/arangodb/go-driver"
+	"github.com/gin-gonic/gin"
+)
+
+// 預設值（env.yaml feature_store 區塊未設定時使用）
+const (
+	defaultFeatureVersion     = "v1"
+	defaultFeatureCollection  = "feature_store"
+	defaultPublicationLatency = 2 * time.Second
+	maxFeatureExportRecords   = 10000
+)
+
+// supportedWindows 支援的時間窗口（與 RecomputeFeaturesRequest.Windows 枚舉一致）
+var supportedWindows = []string{"1m", "5m", "1h", "4h", "1d"}
+
+// windowDuration 將時間窗口字串轉為 K 線週期
+func windowDuration(window string) (time.Duration, error) {
+	switch window {
+	case "1m":
+		return time.Minute, nil
+	case "5m":
+		return 5 * time.Minute, nil
+	case "1h":
+		return time.Hour, nil
+	case "4h":
+		return 4 * time.Hour, nil
+	case "1d":
+		return 24 * time.Hour, nil
+	}
+	return 0, fmt.Errorf("unsupported window: %s", window)
+}
+
+// FeatureStore 時點特徵庫接口
+// 所有讀取都以 AvailableAtMs（收盤 + 發布延遲）為界，保證回測/標籤不會讀到決策當下尚不可見的特徵
+type FeatureStore interface {
+	Put(ctx context.Context, record *dao.FeatureRecord) error
+	AsOf(ctx context.Context, symbol, timeframe, version string, asOfMs int64) (*dao.FeatureRecord, error)
+	Range(ctx context.Context, symbol, timeframe, version string, fromMs, toMs int64, limit int) ([]dao.FeatureRecord, error)
+	// BySetID 依快照 ID 查詢（血緣驗證用）；同一根 K 線重算覆寫後，舊 SetID 將查無資料
+	BySetID(ctx context.Context, setID string) (*dao.FeatureRecord, error)
+}
+
+// featureRecordKey 記錄主鍵；同一根 K 線重算會覆寫而非重複寫入
+func featureRecordKey(symbol, timeframe, version string, barCloseMs int64) string {
+	return fmt.Sprintf("%s_%s_%s_%d", symbol, timeframe, version, barCloseMs)
+}
+
+// ArangoFeatureStore 以 ArangoDB 為後端的特徵庫
+type ArangoFeatureStore struct {
+	db         driver.Database
+	collection string
+}
+
+func NewArangoFeatureStore(db driver.Database, collection string) (*ArangoFeatureStore, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	exists, err := db.CollectionExists(ctx, collection)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check collection %s: %w", collection, err)
+	}
+
+	var col driver.Collection
+	if exists {
+		col, err = db.Collection(ctx, collection)
+	} else {
+		col, err = db.CreateCollection(ctx, collection, nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open collection %s: %w", collection, err)
+	}
+
+	// as-of 查詢索引：等值欄位在前，AvailableAtMs 在後供範圍掃描
+	fields := []string{"symbol", "timeframe", "feature_version", "available_at_ms"}
+	if _, _, err := col.EnsurePersistentIndex(ctx, fields, &driver.EnsurePersistentIndexOptions{Name: "idx_asof"}); err != nil {
+		return nil, fmt.Errorf("failed to ensure as-of index on %s: %w", collection, err)
+	}
+	if _, _, err := col.EnsurePersistentIndex(ctx, []string{"set_id"}, &driver.EnsurePersistentIndexOptions{Name: "idx_set_id"}); err != nil {
+		return nil, fmt.Errorf("failed to ensure set_id index on %s: %w", collection, err)
+	}
+
+	return &ArangoFeatureStore{db: db, collection: collection}, nil
+}
+
+func (fs *ArangoFeatureStore) Put(ctx context.Context, record *dao.FeatureRecord) error {
+	query := `UPSERT { _key: @key } INSERT @doc REPLACE @doc IN @@col`
+	bindVars := map[string]interface{}{
+		"@col": fs.collection,
+		"key":  record.Key,
+		"doc":  record,
+	}
+
+	cursor, err := fs.db.Query(ctx, query, bindVars)
+	if err != nil {
+		return fmt.Errorf("failed to upsert feature record %s: %w", record.Key, err)
+	}
+	return cursor.Close()
+}
+
+func (fs *ArangoFeatureStore) AsOf(ctx context.Context, symbol, timeframe, version string, asOfMs int64) (*dao.FeatureRecord, error) {
+	query := `FOR d IN @@col
+		FILTER d.symbol == @symbol AND d.timeframe == @timeframe AND d.feature_version == @version
+		FILTER d.available_at_ms <= @ts
+		SORT d.available_at_ms DESC
+		LIMIT 1
+		RETURN d`
+	bindVars := map[string]interface{}{
+		"@col":      fs.collection,
+		"symbol":    symbol,
+		"timeframe": timeframe,
+		"version":   version,
+		"ts":        asOfMs,
+	}
+
+	records, err := fs.query(ctx, query, bindVars)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	return &records[0], nil
+}
+
+func (fs *ArangoFeatureStore) Range(ctx context.Context, symbol, timeframe, version string, fromMs, toMs int64, limit int) ([]dao.FeatureRecord, error) {
+	query := `FOR d IN @@col
+		FILTER d.symbol == @symbol AND d.timeframe == @timeframe AND d.feature_version == @version
+		FILTER d.available_at_ms >= @from AND d.available_at_ms <= @to
+		SORT d.available_at_ms ASC
+		LIMIT @limit
+		RETURN d`
+	bindVars := map[string]interface{}{
+		"@col":      fs.collection,
+		"symbol":    symbol,
+		"timeframe": timeframe,
+		"version":   version,
+		"from":      fromMs,
+		"to":        toMs,
+		"limit":     limit,
+	}
+
+	return fs.query(ctx, query, bindVars)
+}
+
+func (fs *ArangoFeatureStore) BySetID(ctx context.Context, setID string) (*dao.FeatureRecord, error) {
+	query := `FOR d IN @@col
+		FILTER d.set_id == @set_id
+		LIMIT 1
+		RETURN d`
+	bindVars := map[string]interface{}{
+		"@col":   fs.collection,
+		"set_id": setID,
+	}
+
+	records, err := fs.query(ctx, query, bindVars)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	return &records[0], nil
+}
+
+func (fs *ArangoFeatureStore) query(ctx context.Context, query string, bindVars map[string]interface{}) ([]dao.FeatureRecord, error) {
+	cursor, err := fs.db.Query(ctx, query, bindVars)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query feature store: %w", err)
+	}
+	defer cursor.Close()
+
+	records := make([]dao.FeatureRecord, 0)
+	for cursor.HasMore() {
+		var record dao.FeatureRecord
+		if _, err := cursor.ReadDocument(ctx, &record); err != nil {
+			return nil, fmt.Errorf("failed to read feature record: %w", err)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// MemoryFeatureStore 內存特徵庫（ArangoDB 未連線時的降級實作，亦供測試使用）
+type MemoryFeatureStore struct {
+	mu      sync.RWMutex
+	records map[string][]dao.FeatureRecord // symbol|timeframe|version → 依 AvailableAtMs 升冪
+}
+
+func NewMemoryFeatureStore() *MemoryFeatureStore {
+	return &MemoryFeatureStore{records: make(map[string][]dao.FeatureRecord)}
+}
+
+func (fs *MemoryFeatureStore) seriesKey(symbol, timeframe, version string) string {
+	return symbol + "|" + timeframe + "|" + version
+}
+
+func (fs *MemoryFeatureStore) Put(ctx context.Context, record *dao.FeatureRecord) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	key := fs.seriesKey(record.Symbol, record.Timeframe, record.FeatureVersion)
+	series := fs.records[key]
+	for i := range series {
+		if series[i].Key == record.Key {
+			series[i] = *record
+			sort.SliceStable(series, func(a, b int) bool { return series[a].AvailableAtMs < series[b].AvailableAtMs })
+			return nil
+		}
+	}
+
+	series = append(series, *record)
+	sort.SliceStable(series, func(a, b int) bool { return series[a].AvailableAtMs < series[b].AvailableAtMs })
+	fs.records[key] = series
+	return nil
+}
+
+func (fs *MemoryFeatureStore) AsOf(ctx context.Context, symbol, timeframe, version string, asOfMs int64) (*dao.FeatureRecord, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	series := fs.records[fs.seriesKey(symbol, timeframe, version)]
+	// 第一筆 AvailableAtMs > asOfMs 的位置，前一筆即為 as-of 結果
+	idx := sort.Search(len(series), func(i int) bool { return series[i].AvailableAtMs > asOfMs })
+	if idx == 0 {
+		return nil, nil
+	}
+	record := series[idx-1]
+	return &record, nil
+}
+
+func (fs *MemoryFeatureStore) Range(ctx context.Context, symbol, timeframe, version string, fromMs, toMs int64, limit int) ([]dao.FeatureRecord, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	records := make([]dao.FeatureRecord, 0)
+	for _, record := range fs.records[fs.seriesKey(symbol, timeframe, version)] {
+		if record.AvailableAtMs < fromMs || record.AvailableAtMs > toMs {
+			continue
+		}
+		records = append(records, record)
+		if len(records) >= limit {
+			break
+		}
+	}
+	return records, nil
+}
+
+func (fs *MemoryFeatureStore) BySetID(ctx context.Context, setID string) (*dao.FeatureRecord, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	for _, series := range fs.records {
+		for _, record := range series {
+			if record.SetID == setID {
+				return &record, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// initializeFeatureStore 初始化特徵庫（ArangoDB 不可用時降級為內存）
+func (s *S2_FEATUREServer) initializeFeatureStore() {
+	cfg := config.AppConfig.FeatureStore
+
+	s.featureVersion = cfg.FeatureVersion
+	if s.featureVersion == "" {
+		s.featureVersion = defaultFeatureVersion
+	}
+
+	s.publicationLatency = defaultPublicationLatency
+	if cfg.PublicationLatency != "" {
+		if latency, err := time.ParseDuration(cfg.PublicationLatency); err == nil {
+			s.publicationLatency = latency
+		} else {
+			log.Printf("Invalid feature_store.publication_latency %q, using %s: %v", cfg.PublicationLatency, defaultPublicationLatency, err)
+		}
+	}
+
+	collection := cfg.Collection
+	if collection == "" {
+		collection = defaultFeatureCollection
+	}
+
+	if s.arangodbClient != nil {
+		store, err := NewArangoFeatureStore(s.arangodbClient.GetDB(), collection)
+		if err == nil {
+			s.featureStore = store
+			return
+		}
+		log.Printf("Failed to initialize ArangoDB feature store, falling back to memory: %v", err)
+	}
+	s.featureStore = NewMemoryFeatureStore()
+}
+
+// recordFeatures 將特徵快照寫入時點特徵庫
+func (s *S2_FEATUREServer) recordFeatures(window string, marketData []MarketDataPoint, snapshot *dao.FeatureSetSnapshot) error {
+	if len(marketData) == 0 {
+		return fmt.Errorf("no market data for %s %s", snapshot.Symbol, window)
+	}
+
+	barDuration, err := windowDuration(window)
+	if err != nil {
+		return err
+	}
+
+	// MarketDataPoint.Timestamp 為開盤時間；特徵在收盤後加上發布延遲才可見
+	barCloseMs := marketData[len(marketData)-1].Timestamp + barDuration.Milliseconds()
+	record := &dao.FeatureRecord{
+		Key:            featureRecordKey(snapshot.Symbol, window, s.featureVersion, barCloseMs),
+		Symbol:         snapshot.Symbol,
+		Timeframe:      window,
+		FeatureVersion: s.featureVersion,
+		SetID:          snapshot.SetID,
+		BarCloseMs:     barCloseMs,
+		AvailableAtMs:  barCloseMs + s.publicationLatency.Milliseconds(),
+		Features:       snapshot.Features,
+		DQC:            snapshot.DQC,
+		Lineage:        snapshot.Lineage,
+		CreatedAt:      time.Now(),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return s.featureStore.Put(ctx, record)
+}
+
+// @Summary Get features as of a point in time
+// @Description Get the feature values that were visible at ts (bar close + publication latency <= ts)
+// @Tags features
+// @Accept json
+// @Produce json
+// @Param symbol query string true "Symbol (e.g., BTCUSDT)"
+// @Param ts query int true "As-of time (epoch ms)"
+// @Param timeframe query string false "Timeframe (1m/5m/1h/4h/1d); empty = all"
+// @Param version query string false "Feature version; empty = current"
+// @Success 200 {object} dao.FeatureAsOfResponse
+// @Router /features/asof [get]
+func (s *S2_FEATUREServer) GetFeaturesAsOf(c *gin.Context) {
+	symbol := c.Query("symbol")
+	if symbol == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "symbol parameter is required"})
+		return
+	}
+
+	asOfMs, err := strconv.ParseInt(c.Query("ts"), 10, 64)
+	if err != nil || asOfMs <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ts parameter must be a positive epoch ms"})
+		return
+	}
+
+	timeframes := supportedWindows
+	if timeframe := c.Query("timeframe"); timeframe != "" {
+		if _, err := windowDuration(timeframe); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		timeframes = []string{timeframe}
+	}
+
+	version := c.DefaultQuery("version", s.featureVersion)
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	records := make([]dao.FeatureRecord, 0, len(timeframes))
+	for _, timeframe := range timeframes {
+		record, err := s.featureStore.AsOf(ctx, symbol, timeframe, version, asOfMs)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query feature store", "details": err.Error()})
+			return
+		}
+		if record != nil {
+			records = append(records, *record)
+		}
+	}
+
+	if len(records) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no features visible as of ts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, dao.FeatureAsOfResponse{
+		Symbol:         symbol,
+		AsOfMs:         asOfMs,
+		FeatureVersion: version,
+		Records:        records,
+	})
+}
+
+// @Summary Export features in a time range
+// @Description Batch export of point-in-time feature records whose availability time falls in [from, to]
+// @Tags features
+// @Accept json
+// @Produce json
+// @Param symbol query string true "Symbol (e.g., BTCUSDT)"
+// @Param timeframe query string true "Timeframe (1m/5m/1h/4h/1d)"
+// @Param from query int true "From (epoch ms, inclusive)"
+// @Param to query int true "To (epoch ms, inclusive)"
+// @Param version query string false "Feature version; empty = current"
+// @Param limit query int false "Max records (default/max 10000)"
+// @Success 200 {object} dao.FeatureExportResponse
+// @Router /features/export [get]
+func (s *S2_FEATUREServer) ExportFeatures(c *gin.Context) {
+	symbol := c.Query("symbol")
+	timeframe := c.Query("timeframe")
+	if symbol == "" || timeframe == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "symbol and timeframe parameters are required"})
+		return
+	}
+	if _, err := windowDuration(timeframe); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	fromMs, errFrom := strconv.ParseInt(c.Query("from"), 10, 64)
+	toMs, errTo := strconv.ParseInt(c.Query("to"), 10, 64)
+	if errFrom != nil || errTo != nil || fromMs > toMs {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from/to must be epoch ms with from <= to"})
+		return
+	}
+
+	limit := maxFeatureExportRecords
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+			return
+		}
+		if n < limit {
+			limit = n
+		}
+	}
+
+	version := c.DefaultQuery("version", s.featureVersion)
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+	defer cancel()
+
+	records, err := s.featureStore.Range(ctx, symbol, timeframe, version, fromMs, toMs, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query feature store", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, dao.FeatureExportResponse{
+		Symbol:         symbol,
+		Timeframe:      timeframe,
+		FeatureVersion: version,
+		FromMs:         fromMs,
+		ToMs:           toMs,
+		Count:          len(records),
+		Records:        records,
+	})
+}
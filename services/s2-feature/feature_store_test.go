@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"s2-feature/dao"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryFeatureStore_AsOfNeverLeaksFuture(t *testing.T) {
+	store := NewMemoryFeatureStore()
+	ctx := context.Background()
+
+	// 1h K 線，收盤 + 2s 發布延遲後才可見
+	for i, closeMs := range []int64{3_600_000, 7_200_000, 10_800_000} {
+		record := &dao.FeatureRecord{
+			Key:            featureRecordKey("BTCUSDT", "1h", "v1", closeMs),
+			Symbol:         "BTCUSDT",
+			Timeframe:      "1h",
+			FeatureVersion: "v1",
+			BarCloseMs:     closeMs,
+			AvailableAtMs:  closeMs + 2_000,
+			Features:       map[string]interface{}{"bar": i},
+		}
+		assert.NoError(t, store.Put(ctx, record))
+	}
+
+	tests := []struct {
+		name        string
+		asOfMs      int64
+		wantCloseMs int64
+	}{
+		{name: "before first publication", asOfMs: 3_601_999, wantCloseMs: 0},
+		{name: "exactly at publication", asOfMs: 3_602_000, wantCloseMs: 3_600_000},
+		{name: "bar closed but not yet published", asOfMs: 7_201_000, wantCloseMs: 3_600_000},
+		{name: "after last publication", asOfMs: 99_000_000, wantCloseMs: 10_800_000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record, err := store.AsOf(ctx, "BTCUSDT", "1h", "v1", tt.asOfMs)
+			assert.NoError(t, err)
+			if tt.wantCloseMs == 0 {
+				assert.Nil(t, record)
+				return
+			}
+			if !assert.NotNil(t, record) {
+				return
+			}
+			assert.Equal(t, tt.wantCloseMs, record.BarCloseMs)
+			assert.LessOrEqual(t, record.AvailableAtMs, tt.asOfMs)
+		})
+	}
+}
+
+func TestMemoryFeatureStore_RangeAndOverwrite(t *testing.T) {
+	store := NewMemoryFeatureStore()
+	ctx := context.Background()
+
+	put := func(closeMs int64, value float64) {
+		assert.NoError(t, store.Put(ctx, &dao.FeatureRecord{
+			Key:            featureRecordKey("ETHUSDT", "4h", "v1", closeMs),
+			Symbol:         "ETHUSDT",
+			Timeframe:      "4h",
+			FeatureVersion: "v1",
+			BarCloseMs:     closeMs,
+			AvailableAtMs:  closeMs + 1_000,
+			Features:       map[string]interface{}{"atr": value},
+		}))
+	}
+	put(2_000, 1.0)
+	put(1_000, 0.5)
+	put(2_000, 1.5) // 同一根 K 線重算覆寫
+
+	records, err := store.Range(ctx, "ETHUSDT", "4h", "v1", 0, 10_000, 100)
+	assert.NoError(t, err)
+	if !assert.Len(t, records, 2) {
+		return
+	}
+	assert.Equal(t, int64(1_000), records[0].BarCloseMs)
+	assert.Equal(t, 1.5, records[1].Features["atr"])
+
+	// 其他版本互不干擾
+	records, err = store.Range(ctx, "ETHUSDT", "4h", "v2", 0, 10_000, 100)
+	assert.NoError(t, err)
+	assert.Empty(t, records)
+}
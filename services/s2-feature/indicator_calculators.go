@@ -0,0 +1,374 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"s2-feature/internal/compute"
+)
+
+// 標準技術指標計算器：數學實作位於 internal/compute，此處負責取最新值並輸出扁平欄位（供 S3 規則直接引用）
+
+// ohlcv 拆出 K 線各欄位數列
+func ohlcv(data []MarketDataPoint) (opens, highs, lows, closes, volumes []float64) {
+	n := len(data)
+	opens, highs, lows, closes, volumes = make([]float64, n), make([]float64, n), make([]float64, n), make([]float64, n), make([]float64, n)
+	for i, d := range data {
+		opens[i], highs[i], lows[i], closes[i], volumes[i] = d.Open, d.High, d.Low, d.Close, d.Volume
+	}
+	return
+}
+
+// lastValid 取最新值；暖機不足（NaN）時回傳錯誤
+func lastValid(name string, values []float64) (float64, error) {
+	v := compute.Last(values)
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, fmt.Errorf("insufficient data for %s calculation", name)
+	}
+	return v, nil
+}
+
+// RSICalculator 相對強弱指標（Wilder）
+type RSICalculator struct {
+	period int
+}
+
+func (calc *RSICalculator) Calculate(symbol string, data []MarketDataPoint) (map[string]interface{}, error) {
+	_, _, _, closes, _ := ohlcv(data)
+	rsi, err := lastValid("RSI", compute.RSI(closes, calc.period))
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"rsi":       rsi,
+		"period":    calc.period,
+		"symbol":    symbol,
+		"timestamp": data[len(data)-1].Timestamp,
+	}, nil
+}
+
+func (calc *RSICalculator) GetFeatureType() string {
+	return "RSI"
+}
+
+func (calc *RSICalculator) Version() string {
+	return "1.0.0"
+}
+
+func (calc *RSICalculator) Params() map[string]interface{} {
+	return map[string]interface{}{"period": calc.period}
+}
+
+// MACDCalculator MACD 線、訊號線與柱狀體
+type MACDCalculator struct {
+	fast   int
+	slow   int
+	signal int
+}
+
+func (calc *MACDCalculator) Calculate(symbol string, data []MarketDataPoint) (map[string]interface{}, error) {
+	_, _, _, closes, _ := ohlcv(data)
+	macd, signal, hist := compute.MACD(closes, calc.fast, calc.slow, calc.signal)
+	signalValue, err := lastValid("MACD", signal)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"macd":        compute.Last(macd),
+		"macd_signal": signalValue,
+		"macd_hist":   compute.Last(hist),
+		"period":      calc.slow,
+		"symbol":      symbol,
+		"timestamp":   data[len(data)-1].Timestamp,
+	}, nil
+}
+
+func (calc *MACDCalculator) GetFeatureType() string {
+	return "MACD"
+}
+
+func (calc *MACDCalculator) Version() string {
+	return "1.0.0"
+}
+
+func (calc *MACDCalculator) Params() map[string]interface{} {
+	return map[string]interface{}{"fast": calc.fast, "slow": calc.slow, "signal": calc.signal}
+}
+
+// BollingerCalculator 布林通道 %B 與帶寬
+type BollingerCalculator struct {
+	period int
+	k      float64
+}
+
+func (calc *BollingerCalculator) Calculate(symbol string, data []MarketDataPoint) (map[string]interface{}, error) {
+	_, _, _, closes, _ := ohlcv(data)
+	mid, upper, lower := compute.BollingerBands(closes, calc.period, calc.k)
+	midValue, err := lastValid("Bollinger", mid)
+	if err != nil {
+		return nil, err
+	}
+	up, lo := compute.Last(upper), compute.Last(lower)
+
+	// 通道寬度為 0（價格完全不動）時 %B 取中間值
+	pctB := 0.5
+	if up > lo {
+		pctB = (closes[len(closes)-1] - lo) / (up - lo)
+	}
+
+	return map[string]interface{}{
+		"bb_mid":       midValue,
+		"bb_upper":     up,
+		"bb_lower":     lo,
+		"bb_pct_b":     pctB,
+		"bb_bandwidth": (up - lo) / midValue,
+		"period":       calc.period,
+		"symbol":       symbol,
+		"timestamp":    data[len(data)-1].Timestamp,
+	}, nil
+}
+
+func (calc *BollingerCalculator) GetFeatureType() string {
+	return "BBANDS"
+}
+
+func (calc *BollingerCalculator) Version() string {
+	return "1.0.0"
+}
+
+func (calc *BollingerCalculator) Params() map[string]interface{} {
+	return map[string]interface{}{"period": calc.period, "k": calc.k}
+}
+
+// KeltnerCalculator 肯特納通道：EMA 中軌 ± mult × ATR
+type KeltnerCalculator struct {
+	emaPeriod int
+	atrPeriod int
+	mult      float64
+}
+
+func (calc *KeltnerCalculator) Calculate(symbol string, data []MarketDataPoint) (map[string]interface{}, error) {
+	_, highs, lows, closes, _ := ohlcv(data)
+	mid, upper, lower := compute.KeltnerChannels(highs, lows, closes, calc.emaPeriod, calc.atrPeriod, calc.mult)
+	midValue, err := lastValid("Keltner", mid)
+	if err != nil {
+		return nil, err
+	}
+	up, err := lastValid("Keltner", upper)
+	if err != nil {
+		return nil, err
+	}
+	lo := compute.Last(lower)
+
+	position := 0.5
+	if up > lo {
+		position = (closes[len(closes)-1] - lo) / (up - lo)
+	}
+
+	return map[string]interface{}{
+		"kc_mid":      midValue,
+		"kc_upper":    up,
+		"kc_lower":    lo,
+		"kc_position": position, // 0 = 下軌、1 = 上軌，超出通道時 < 0 或 > 1
+		"period":      calc.emaPeriod,
+		"symbol":      symbol,
+		"timestamp":   data[len(data)-1].Timestamp,
+	}, nil
+}
+
+func (calc *KeltnerCalculator) GetFeatureType() string {
+	return "KELTNER"
+}
+
+func (calc *KeltnerCalculator) Version() string {
+	return "1.0.0"
+}
+
+func (calc *KeltnerCalculator) Params() map[string]interface{} {
+	return map[string]interface{}{"ema_period": calc.emaPeriod, "atr_period": calc.atrPeriod, "mult": calc.mult}
+}
+
+// ADXCalculator 平均趨向指標與 ±DI
+type ADXCalculator struct {
+	period int
+}
+
+func (calc *ADXCalculator) Calculate(symbol string, data []MarketDataPoint) (map[string]interface{}, error) {
+	_, highs, lows, closes, _ := ohlcv(data)
+	adx, plusDI, minusDI := compute.ADX(highs, lows, closes, calc.period)
+	adxValue, err := lastValid("ADX", adx)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"adx":       adxValue,
+		"plus_di":   compute.Last(plusDI),
+		"minus_di":  compute.Last(minusDI),
+		"period":    calc.period,
+		"symbol":    symbol,
+		"timestamp": data[len(data)-1].Timestamp,
+	}, nil
+}
+
+func (calc *ADXCalculator) GetFeatureType() string {
+	return "ADX"
+}
+
+func (calc *ADXCalculator) Version() string {
+	return "1.0.0"
+}
+
+func (calc *ADXCalculator) Params() map[string]interface{} {
+	return map[string]interface{}{"period": calc.period}
+}
+
+// OBVCalculator 能量潮與其 n 根平均斜率
+type OBVCalculator struct {
+	period int
+}
+
+func (calc *OBVCalculator) Calculate(symbol string, data []MarketDataPoint) (map[string]interface{}, error) {
+	if len(data) <= calc.period {
+		return nil, fmt.Errorf("insufficient data for OBV calculation")
+	}
+	_, _, _, closes, volumes := ohlcv(data)
+	obv := compute.OBV(closes, volumes)
+	last := obv[len(obv)-1]
+
+	return map[string]interface{}{
+		"obv":       last,
+		"obv_slope": (last - obv[len(obv)-1-calc.period]) / float64(calc.period),
+		"period":    calc.period,
+		"symbol":    symbol,
+		"timestamp": data[len(data)-1].Timestamp,
+	}, nil
+}
+
+func (calc *OBVCalculator) GetFeatureType() string {
+	return "OBV"
+}
+
+func (calc *OBVCalculator) Version() string {
+	return "1.0.0"
+}
+
+func (calc *OBVCalculator) Params() map[string]interface{} {
+	return map[string]interface{}{"period": calc.period}
+}
+
+// VWAPCalculator 滾動 VWAP 與收盤偏離
+type VWAPCalculator struct {
+	period int
+}
+
+func (calc *VWAPCalculator) Calculate(symbol string, data []MarketDataPoint) (map[string]interface{}, error) {
+	_, highs, lows, closes, volumes := ohlcv(data)
+	vwap, err := lastValid("VWAP", compute.RollingVWAP(highs, lows, closes, volumes, calc.period))
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"vwap":      vwap,
+		"vwap_dev":  closes[len(closes)-1]/vwap - 1,
+		"period":    calc.period,
+		"symbol":    symbol,
+		"timestamp": data[len(data)-1].Timestamp,
+	}, nil
+}
+
+func (calc *VWAPCalculator) GetFeatureType() string {
+	return "VWAP"
+}
+
+func (calc *VWAPCalculator) Version() string {
+	return "1.0.0"
+}
+
+func (calc *VWAPCalculator) Params() map[string]interface{} {
+	return map[string]interface{}{"period": calc.period}
+}
+
+// DonchianCalculator 唐奇安通道（前 n 根）突破距離
+type DonchianCalculator struct {
+	period int
+}
+
+func (calc *DonchianCalculator) Calculate(symbol string, data []MarketDataPoint) (map[string]interface{}, error) {
+	_, highs, lows, closes, _ := ohlcv(data)
+	upper, lower := compute.DonchianChannel(highs, lows, calc.period)
+	up, err := lastValid("Donchian", upper)
+	if err != nil {
+		return nil, err
+	}
+	lo := compute.Last(lower)
+	lastClose := closes[len(closes)-1]
+
+	breakout := 0.0
+	switch {
+	case lastClose > up:
+		breakout = 1
+	case lastClose < lo:
+		breakout = -1
+	}
+
+	return map[string]interface{}{
+		"donchian_upper":      up,
+		"donchian_lower":      lo,
+		"donchian_dist_upper": (lastClose - up) / up, // > 0 表示向上突破
+		"donchian_dist_lower": (lastClose - lo) / lo, // < 0 表示向下突破
+		"donchian_breakout":   breakout,
+		"period":              calc.period,
+		"symbol":              symbol,
+		"timestamp":           data[len(data)-1].Timestamp,
+	}, nil
+}
+
+func (calc *DonchianCalculator) GetFeatureType() string {
+	return "DONCHIAN"
+}
+
+func (calc *DonchianCalculator) Version() string {
+	return "1.0.0"
+}
+
+func (calc *DonchianCalculator) Params() map[string]interface{} {
+	return map[string]interface{}{"period": calc.period}
+}
+
+// CandlePatternCalculator K 線型態旗標（1 = 成立、0 = 不成立，便於規則以數值比較）
+type CandlePatternCalculator struct{}
+
+func (calc *CandlePatternCalculator) Calculate(symbol string, data []MarketDataPoint) (map[string]interface{}, error) {
+	if len(data) < 2 {
+		return nil, fmt.Errorf("insufficient data for pattern calculation")
+	}
+	opens, highs, lows, closes, _ := ohlcv(data)
+
+	result := map[string]interface{}{
+		"symbol":    symbol,
+		"timestamp": data[len(data)-1].Timestamp,
+	}
+	for name, set := range compute.CandlePatterns(opens, highs, lows, closes) {
+		value := 0.0
+		if set {
+			value = 1.0
+		}
+		result["pattern_"+name] = value
+	}
+	return result, nil
+}
+
+func (calc *CandlePatternCalculator) GetFeatureType() string {
+	return "PATTERNS"
+}
+
+func (calc *CandlePatternCalculator) Version() string {
+	return "1.0.0"
+}
+
+func (calc *CandlePatternCalculator) Params() map[string]interface{} {
+	return nil
+}
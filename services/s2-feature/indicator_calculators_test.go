@@ -0,0 +1,57 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIndicatorCalculators_Registered(t *testing.T) {
+	server := NewS2_FEATUREServer()
+
+	closes := make([]float64, marketDataBars)
+	for i := range closes {
+		closes[i] = 100 + 5*math.Sin(float64(i)/6) + float64(i)/20
+	}
+	data := makeCandles(0, time.Hour.Milliseconds(), closes)
+
+	tests := []struct {
+		featureType string
+		field       string
+	}{
+		{featureType: "RSI", field: "rsi"},
+		{featureType: "MACD", field: "macd_hist"},
+		{featureType: "BBANDS", field: "bb_pct_b"},
+		{featureType: "KELTNER", field: "kc_position"},
+		{featureType: "ADX", field: "adx"},
+		{featureType: "OBV", field: "obv_slope"},
+		{featureType: "VWAP", field: "vwap_dev"},
+		{featureType: "DONCHIAN", field: "donchian_dist_upper"},
+		{featureType: "PATTERNS", field: "pattern_doji"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.featureType, func(t *testing.T) {
+			calc, ok := server.featureCalculators[tt.featureType]
+			if !assert.True(t, ok, "calculator not registered") {
+				return
+			}
+			assert.Equal(t, tt.featureType, calc.GetFeatureType())
+
+			result, err := calc.Calculate("BTCUSDT", data)
+			if !assert.NoError(t, err) {
+				return
+			}
+			// 規則引擎以 float64 比較
+			value, ok := result[tt.field].(float64)
+			assert.True(t, ok, "%s should be float64", tt.field)
+			assert.False(t, math.IsNaN(value))
+
+			// 暖機不足時回傳錯誤而非 NaN
+			_, err = calc.Calculate("BTCUSDT", data[:1])
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package compute
+
+import "math"
+
+// 永續合約持有成本（carry）：資金費與基差
+
+// BasisBps 永續標記價相對指數價（現貨加權籃子）的基差，單位 bps；指數價非正時為 NaN
+func BasisBps(mark, index float64) float64 {
+	if index <= 0 || mark <= 0 {
+		return math.NaN()
+	}
+	return (mark - index) / index * 1e4
+}
+
+// AnnualizedBasis 將基差年化（小數）：溢價透過資金費每個結算週期回歸一次，
+// 故年化 = 基差 × 每年結算次數（8 小時週期為 1095 次）
+func AnnualizedBasis(basisBps, fundingIntervalHours float64) float64 {
+	if fundingIntervalHours <= 0 {
+		return math.NaN()
+	}
+	return basisBps / 1e4 * (365 * 24 / fundingIntervalHours)
+}
+
+// ZScore x 相對樣本的 z 值（母體標準差）；樣本少於 2 筆或標準差為 0 時為 NaN
+func ZScore(sample []float64, x float64) float64 {
+	if len(sample) < 2 {
+		return math.NaN()
+	}
+
+	mean := 0.0
+	for _, v := range sample {
+		mean += v
+	}
+	mean /= float64(len(sample))
+
+	variance := 0.0
+	for _, v := range sample {
+		variance += (v - mean) * (v - mean)
+	}
+	sd := math.Sqrt(variance / float64(len(sample)))
+	if sd == 0 {
+		return math.NaN()
+	}
+	return (x - mean) / sd
+}
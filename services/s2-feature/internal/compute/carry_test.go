@@ -0,0 +1,31 @@
+package compute
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBasisBps(t *testing.T) {
+	assert.InDelta(t, 10.0, BasisBps(50050, 50000), 1e-9)
+	assert.InDelta(t, -20.0, BasisBps(49900, 50000), 1e-9)
+	assert.True(t, math.IsNaN(BasisBps(50000, 0)))
+}
+
+func TestAnnualizedBasis(t *testing.T) {
+	// 10 bps × 1095 次/年
+	assert.InDelta(t, 1.095, AnnualizedBasis(10, 8), 1e-12)
+	assert.InDelta(t, 2.19, AnnualizedBasis(10, 4), 1e-12)
+	assert.True(t, math.IsNaN(AnnualizedBasis(10, 0)))
+}
+
+func TestZScore(t *testing.T) {
+	// 平均 2.5、母體標準差 √1.25
+	sample := []float64{1, 2, 3, 4}
+	assert.InDelta(t, 2.5/math.Sqrt(1.25), ZScore(sample, 5), 1e-12)
+	assert.InDelta(t, 0.0, ZScore(sample, 2.5), 1e-12)
+
+	assert.True(t, math.IsNaN(ZScore([]float64{1}, 2)))
+	assert.True(t, math.IsNaN(ZScore([]float64{3, 3, 3}, 4)))
+}
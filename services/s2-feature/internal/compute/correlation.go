@@ -0,0 +1,54 @@
+package compute
+
+import "math"
+
+// LogReturns 對數報酬 ln(P_t / P_{t-1})；價格非正的區間記為 NaN
+func LogReturns(closes []float64) []float64 {
+	if len(closes) < 2 {
+		return nil
+	}
+	out := make([]float64, len(closes)-1)
+	for i := 1; i < len(closes); i++ {
+		if closes[i-1] <= 0 || closes[i] <= 0 {
+			out[i-1] = math.NaN()
+			continue
+		}
+		out[i-1] = math.Log(closes[i] / closes[i-1])
+	}
+	return out
+}
+
+// Pearson 兩等長序列的皮爾森相關係數；略過任一側為 NaN 的樣本，有效樣本少於 2 筆或任一側變異為 0 時為 NaN
+func Pearson(a, b []float64) float64 {
+	if len(a) != len(b) {
+		return math.NaN()
+	}
+	var n, sumA, sumB float64
+	for i := range a {
+		if math.IsNaN(a[i]) || math.IsNaN(b[i]) {
+			continue
+		}
+		n++
+		sumA += a[i]
+		sumB += b[i]
+	}
+	if n < 2 {
+		return math.NaN()
+	}
+	meanA, meanB := sumA/n, sumB/n
+
+	var cov, varA, varB float64
+	for i := range a {
+		if math.IsNaN(a[i]) || math.IsNaN(b[i]) {
+			continue
+		}
+		da, db := a[i]-meanA, b[i]-meanB
+		cov += da * db
+		varA += da * da
+		varB += db * db
+	}
+	if varA == 0 || varB == 0 {
+		return math.NaN()
+	}
+	return cov / math.Sqrt(varA*varB)
+}
@@ -0,0 +1,34 @@
+package compute
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogReturns(t *testing.T) {
+	r := LogReturns([]float64{100, 110, 99, 0, 50})
+	assert.Len(t, r, 4)
+	assert.InDelta(t, math.Log(1.1), r[0], 1e-12)
+	assert.InDelta(t, math.Log(0.9), r[1], 1e-12)
+	assert.True(t, math.IsNaN(r[2]))
+	assert.True(t, math.IsNaN(r[3]))
+	assert.Nil(t, LogReturns([]float64{100}))
+}
+
+func TestPearson(t *testing.T) {
+	a := []float64{1, 2, 3, 4, 5}
+	assert.InDelta(t, 1.0, Pearson(a, []float64{2, 4, 6, 8, 10}), 1e-12)
+	assert.InDelta(t, -1.0, Pearson(a, []float64{5, 4, 3, 2, 1}), 1e-12)
+
+	// 離差乘積和 4、離差平方和 10 與 5.2 → 4/√52
+	assert.InDelta(t, 4/math.Sqrt(52), Pearson(a, []float64{2, 1, 4, 3, 3}), 1e-12)
+
+	// NaN 樣本成對略過
+	assert.InDelta(t, 1.0, Pearson([]float64{1, math.NaN(), 3, 4}, []float64{2, 100, 6, 8}), 1e-12)
+
+	assert.True(t, math.IsNaN(Pearson(a, []float64{1, 1, 1, 1, 1})))
+	assert.True(t, math.IsNaN(Pearson(a, a[:4])))
+	assert.True(t, math.IsNaN(Pearson([]float64{1}, []float64{2})))
+}
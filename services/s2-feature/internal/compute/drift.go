@@ -0,0 +1,81 @@
+package compute
+
+import (
+	"math"
+	"sort"
+)
+
+// psiEpsilon 空桶平滑，避免 log(0)
+const psiEpsilon = 1e-4
+
+// PSI 族群穩定度指標：以 reference 的分位數切 bins 個桶，
+// PSI = Σ (cur% − ref%) × ln(cur% / ref%)。慣例：< 0.1 穩定、0.1~0.25 輕微漂移、> 0.25 顯著漂移。
+// 任一側為空回傳 NaN。
+func PSI(reference, current []float64, bins int) float64 {
+	if len(reference) == 0 || len(current) == 0 || bins <= 0 {
+		return math.NaN()
+	}
+
+	sorted := append([]float64(nil), reference...)
+	sort.Float64s(sorted)
+
+	// 分位切點（去重：大量相同值時桶數自動減少）
+	edges := make([]float64, 0, bins-1)
+	for i := 1; i < bins; i++ {
+		edge := sorted[i*len(sorted)/bins]
+		if len(edges) == 0 || edge > edges[len(edges)-1] {
+			edges = append(edges, edge)
+		}
+	}
+
+	refCounts := bucketCounts(reference, edges)
+	curCounts := bucketCounts(current, edges)
+
+	psi := 0.0
+	for i := range refCounts {
+		ref := math.Max(float64(refCounts[i])/float64(len(reference)), psiEpsilon)
+		cur := math.Max(float64(curCounts[i])/float64(len(current)), psiEpsilon)
+		psi += (cur - ref) * math.Log(cur/ref)
+	}
+	return psi
+}
+
+// bucketCounts 依切點計數：桶 i 為 (edges[i-1], edges[i]]（右閉，與 qcut 一致）
+func bucketCounts(values, edges []float64) []int {
+	counts := make([]int, len(edges)+1)
+	for _, v := range values {
+		counts[sort.Search(len(edges), func(i int) bool { return edges[i] >= v })]++
+	}
+	return counts
+}
+
+// KSStatistic 雙樣本 Kolmogorov–Smirnov 統計量 D = sup |F_a(x) − F_b(x)| ∈ [0, 1]
+// 任一側為空回傳 NaN。
+func KSStatistic(a, b []float64) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return math.NaN()
+	}
+
+	x := append([]float64(nil), a...)
+	y := append([]float64(nil), b...)
+	sort.Float64s(x)
+	sort.Float64s(y)
+
+	d := 0.0
+	i, j := 0, 0
+	for i < len(x) && j < len(y) {
+		// 同值一次推進兩側，避免在跳躍點中間取差
+		v := math.Min(x[i], y[j])
+		for i < len(x) && x[i] == v {
+			i++
+		}
+		for j < len(y) && y[j] == v {
+			j++
+		}
+		diff := math.Abs(float64(i)/float64(len(x)) - float64(j)/float64(len(y)))
+		if diff > d {
+			d = diff
+		}
+	}
+	return d
+}
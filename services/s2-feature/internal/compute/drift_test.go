@@ -0,0 +1,49 @@
+package compute
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPSI(t *testing.T) {
+	reference := []float64{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}
+
+	assert.InDelta(t, 0.0, PSI(reference, reference, 10), 1e-12)
+
+	// 2 桶（切點 5，右閉）：參考 60/40，當前 90/10
+	// PSI = 0.3×ln(1.5) + (−0.3)×ln(0.25)
+	current := []float64{0, 0, 1, 1, 2, 2, 3, 4, 5, 9}
+	assert.InDelta(t, 0.5375278407684165, PSI(reference, current, 2), 1e-12)
+
+	assert.True(t, math.IsNaN(PSI(nil, current, 10)))
+}
+
+func TestPSI_ConstantReference(t *testing.T) {
+	// 參考值全相同時只剩單一切點，不應 panic
+	reference := []float64{1, 1, 1, 1, 1}
+	assert.InDelta(t, 0.0, PSI(reference, []float64{1, 1}, 10), 1e-12)
+	assert.Greater(t, PSI(reference, []float64{5, 5}, 10), 1.0)
+}
+
+func TestKSStatistic(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []float64
+		want float64
+	}{
+		{name: "identical", a: []float64{1, 2, 3}, b: []float64{3, 2, 1}, want: 0},
+		{name: "disjoint", a: []float64{1, 2, 3}, b: []float64{4, 5, 6}, want: 1},
+		{name: "half overlap", a: []float64{1, 2, 3, 4}, b: []float64{3, 4, 5, 6}, want: 0.5},
+		{name: "ties", a: []float64{1, 1, 2}, b: []float64{1, 2, 2}, want: 1.0 / 3.0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.InDelta(t, tt.want, KSStatistic(tt.a, tt.b), 1e-12)
+		})
+	}
+
+	assert.True(t, math.IsNaN(KSStatistic(nil, []float64{1})))
+}
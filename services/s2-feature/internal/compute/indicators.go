@@ -0,0 +1,288 @@
+package compute
+
+import "math"
+
+// 技術指標：輸入為時間升冪、等長的 OHLCV 數列，輸出與輸入等長，暖機期不足處以 NaN 填充
+// 平滑慣例與 TA-Lib 一致：RSI/ATR/ADX 使用 Wilder 平滑，EMA 以 SMA 為種子
+
+// RSI 相對強弱指標（Wilder）：首值位於 index n，種子為前 n 個漲跌幅的簡單平均
+func RSI(closes []float64, period int) []float64 {
+	out := nanSeries(len(closes))
+	if period <= 0 || len(closes) <= period {
+		return out
+	}
+
+	gain, loss := 0.0, 0.0
+	for i := 1; i <= period; i++ {
+		change := closes[i] - closes[i-1]
+		if change > 0 {
+			gain += change
+		} else {
+			loss -= change
+		}
+	}
+	gain /= float64(period)
+	loss /= float64(period)
+	out[period] = rsiValue(gain, loss)
+
+	for i := period + 1; i < len(closes); i++ {
+		change := closes[i] - closes[i-1]
+		up, down := math.Max(change, 0), math.Max(-change, 0)
+		gain = (gain*float64(period-1) + up) / float64(period)
+		loss = (loss*float64(period-1) + down) / float64(period)
+		out[i] = rsiValue(gain, loss)
+	}
+	return out
+}
+
+func rsiValue(gain, loss float64) float64 {
+	if loss == 0 {
+		if gain == 0 {
+			return 50
+		}
+		return 100
+	}
+	return 100 - 100/(1+gain/loss)
+}
+
+// MACD 快慢 EMA 差、訊號線（MACD 有效值的 EMA）與柱狀體
+func MACD(closes []float64, fast, slow, signal int) (macd, signalLine, hist []float64) {
+	n := len(closes)
+	macd, signalLine, hist = nanSeries(n), nanSeries(n), nanSeries(n)
+	if fast <= 0 || slow <= fast || signal <= 0 {
+		return
+	}
+
+	fastEMA, slowEMA := EMA(closes, fast), EMA(closes, slow)
+	for i := range closes {
+		macd[i] = fastEMA[i] - slowEMA[i]
+	}
+	if n < slow {
+		return
+	}
+
+	sig := EMA(macd[slow-1:], signal)
+	for i, v := range sig {
+		signalLine[slow-1+i] = v
+		hist[slow-1+i] = macd[slow-1+i] - v
+	}
+	return
+}
+
+// BollingerBands 中軌 SMA、上下軌 ±k 倍母體標準差
+func BollingerBands(closes []float64, period int, k float64) (mid, upper, lower []float64) {
+	n := len(closes)
+	mid, upper, lower = SMA(closes, period), nanSeries(n), nanSeries(n)
+	for i := period - 1; i < n && period > 0; i++ {
+		variance := 0.0
+		for _, v := range closes[i-period+1 : i+1] {
+			variance += (v - mid[i]) * (v - mid[i])
+		}
+		sd := math.Sqrt(variance / float64(period))
+		upper[i] = mid[i] + k*sd
+		lower[i] = mid[i] - k*sd
+	}
+	return
+}
+
+// TrueRange 真實波幅；index 0 無前收盤，為 NaN
+func TrueRange(highs, lows, closes []float64) []float64 {
+	out := nanSeries(len(closes))
+	for i := 1; i < len(closes); i++ {
+		out[i] = math.Max(highs[i]-lows[i], math.Max(math.Abs(highs[i]-closes[i-1]), math.Abs(lows[i]-closes[i-1])))
+	}
+	return out
+}
+
+// ATR 平均真實波幅（Wilder）：首值位於 index n，種子為 TR[1..n] 的平均
+func ATR(highs, lows, closes []float64, period int) []float64 {
+	out := nanSeries(len(closes))
+	if period <= 0 || len(closes) <= period {
+		return out
+	}
+
+	tr := TrueRange(highs, lows, closes)
+	atr := 0.0
+	for i := 1; i <= period; i++ {
+		atr += tr[i]
+	}
+	atr /= float64(period)
+	out[period] = atr
+
+	for i := period + 1; i < len(closes); i++ {
+		atr = (atr*float64(period-1) + tr[i]) / float64(period)
+		out[i] = atr
+	}
+	return out
+}
+
+// KeltnerChannels 中軌 EMA(close)、上下軌 ±mult × ATR
+func KeltnerChannels(highs, lows, closes []float64, emaPeriod, atrPeriod int, mult float64) (mid, upper, lower []float64) {
+	n := len(closes)
+	mid, upper, lower = EMA(closes, emaPeriod), nanSeries(n), nanSeries(n)
+	atr := ATR(highs, lows, closes, atrPeriod)
+	for i := range closes {
+		upper[i] = mid[i] + mult*atr[i]
+		lower[i] = mid[i] - mult*atr[i]
+	}
+	return
+}
+
+// ADX 平均趨向指標與 ±DI（Wilder）：DI 首值位於 index n，ADX 首值位於 index 2n−1
+func ADX(highs, lows, closes []float64, period int) (adx, plusDI, minusDI []float64) {
+	n := len(closes)
+	adx, plusDI, minusDI = nanSeries(n), nanSeries(n), nanSeries(n)
+	if period <= 0 || n <= period {
+		return
+	}
+
+	tr := TrueRange(highs, lows, closes)
+	plusDM, minusDM := make([]float64, n), make([]float64, n)
+	for i := 1; i < n; i++ {
+		up, down := highs[i]-highs[i-1], lows[i-1]-lows[i]
+		if up > down && up > 0 {
+			plusDM[i] = up
+		}
+		if down > up && down > 0 {
+			minusDM[i] = down
+		}
+	}
+
+	// Wilder 累加平滑：S_t = S_{t-1} − S_{t-1}/n + x_t
+	smTR, smPlus, smMinus := 0.0, 0.0, 0.0
+	for i := 1; i <= period; i++ {
+		smTR += tr[i]
+		smPlus += plusDM[i]
+		smMinus += minusDM[i]
+	}
+
+	dx := nanSeries(n)
+	for i := period; i < n; i++ {
+		if i > period {
+			smTR = smTR - smTR/float64(period) + tr[i]
+			smPlus = smPlus - smPlus/float64(period) + plusDM[i]
+			smMinus = smMinus - smMinus/float64(period) + minusDM[i]
+		}
+		if smTR == 0 {
+			plusDI[i], minusDI[i] = 0, 0
+		} else {
+			plusDI[i] = 100 * smPlus / smTR
+			minusDI[i] = 100 * smMinus / smTR
+		}
+		if sum := plusDI[i] + minusDI[i]; sum == 0 {
+			dx[i] = 0
+		} else {
+			dx[i] = 100 * math.Abs(plusDI[i]-minusDI[i]) / sum
+		}
+	}
+
+	first := 2*period - 1
+	if n <= first {
+		return
+	}
+	value := 0.0
+	for i := period; i <= first; i++ {
+		value += dx[i]
+	}
+	value /= float64(period)
+	adx[first] = value
+	for i := first + 1; i < n; i++ {
+		value = (value*float64(period-1) + dx[i]) / float64(period)
+		adx[i] = value
+	}
+	return
+}
+
+// OBV 能量潮：收盤上漲加量、下跌減量，首值為 0
+func OBV(closes, volumes []float64) []float64 {
+	out := make([]float64, len(closes))
+	for i := 1; i < len(closes); i++ {
+		switch {
+		case closes[i] > closes[i-1]:
+			out[i] = out[i-1] + volumes[i]
+		case closes[i] < closes[i-1]:
+			out[i] = out[i-1] - volumes[i]
+		default:
+			out[i] = out[i-1]
+		}
+	}
+	return out
+}
+
+// RollingVWAP 以典型價 (H+L+C)/3 計算的 n 根滾動成交量加權均價；區間無量為 NaN
+func RollingVWAP(highs, lows, closes, volumes []float64, period int) []float64 {
+	out := nanSeries(len(closes))
+	if period <= 0 {
+		return out
+	}
+	pv, vol := 0.0, 0.0
+	for i := range closes {
+		pv += (highs[i] + lows[i] + closes[i]) / 3 * volumes[i]
+		vol += volumes[i]
+		if i >= period {
+			j := i - period
+			pv -= (highs[j] + lows[j] + closes[j]) / 3 * volumes[j]
+			vol -= volumes[j]
+		}
+		if i >= period-1 && vol > 0 {
+			out[i] = pv / vol
+		}
+	}
+	return out
+}
+
+// DonchianChannel 前 n 根（不含當根）的最高價與最低價，供突破判斷
+func DonchianChannel(highs, lows []float64, period int) (upper, lower []float64) {
+	n := len(highs)
+	upper, lower = nanSeries(n), nanSeries(n)
+	for i := period; i < n && period > 0; i++ {
+		hi, lo := math.Inf(-1), math.Inf(1)
+		for j := i - period; j < i; j++ {
+			hi = math.Max(hi, highs[j])
+			lo = math.Min(lo, lows[j])
+		}
+		upper[i], lower[i] = hi, lo
+	}
+	return
+}
+
+// CandlePatterns 最後一根 K 線的型態旗標
+//
+//   - doji：實體 ≤ 全幅 10%
+//   - hammer：下影線 ≥ 2 倍實體、上影線 ≤ 實體、實體非零
+//   - shooting_star：上影線 ≥ 2 倍實體、下影線 ≤ 實體、實體非零
+//   - bullish_engulfing / bearish_engulfing：當根實體完全包覆前一根反向實體
+//   - inside_bar：高低點皆在前一根範圍內
+func CandlePatterns(opens, highs, lows, closes []float64) map[string]bool {
+	flags := map[string]bool{
+		"doji":              false,
+		"hammer":            false,
+		"shooting_star":     false,
+		"bullish_engulfing": false,
+		"bearish_engulfing": false,
+		"inside_bar":        false,
+	}
+	n := len(closes)
+	if n == 0 {
+		return flags
+	}
+
+	o, h, l, c := opens[n-1], highs[n-1], lows[n-1], closes[n-1]
+	body := math.Abs(c - o)
+	rng := h - l
+	upperShadow := h - math.Max(o, c)
+	lowerShadow := math.Min(o, c) - l
+
+	flags["doji"] = rng > 0 && body <= 0.1*rng
+	flags["hammer"] = body > 0 && lowerShadow >= 2*body && upperShadow <= body
+	flags["shooting_star"] = body > 0 && upperShadow >= 2*body && lowerShadow <= body
+
+	if n < 2 {
+		return flags
+	}
+	po, ph, pl, pc := opens[n-2], highs[n-2], lows[n-2], closes[n-2]
+	flags["bullish_engulfing"] = pc < po && c > o && o <= pc && c >= po && body > math.Abs(pc-po)
+	flags["bearish_engulfing"] = pc > po && c < o && o >= pc && c <= po && body > math.Abs(pc-po)
+	flags["inside_bar"] = h < ph && l > pl
+	return flags
+}
@@ -0,0 +1,133 @@
+package compute
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 參考值以獨立的 Python 實作（Wilder / TA-Lib 慣例）對同一份 60 根 K 線計算，見各測試註解
+var (
+	testOpens = []float64{
+		100.0, 99.3, 100.59, 99.45, 97.81, 99.6, 99.91, 100.14, 98.61, 97.02, 97.21, 97.2, 97.54, 96.26,
+		96.36, 96.8, 97.83, 99.68, 101.18, 101.17, 102.95, 103.87, 105.16, 104.55, 103.02, 103.97, 102.29,
+		103.57, 105.52, 104.12, 102.17, 100.19, 99.46, 100.08, 101.2, 100.79, 99.04, 97.48, 96.09, 94.37,
+		93.38, 91.84, 91.78, 92.74, 90.83, 91.59, 93.5, 93.57, 93.7, 94.15, 95.37, 94.17, 95.33, 97.16,
+		98.98, 98.86, 100.22, 100.79, 101.92, 101.66,
+	}
+	testHighs = []float64{
+		100.23, 100.73, 100.72, 100.09, 100.55, 100.51, 100.34, 100.6, 99.47, 97.3, 98.01, 98.22, 98.71,
+		97.67, 96.91, 98.06, 99.8, 101.65, 102.38, 103.66, 104.33, 105.59, 106.57, 104.64, 104.57, 104.64,
+		104.87, 106.54, 105.78, 105.37, 102.8, 100.38, 101.19, 102.51, 101.79, 100.89, 99.94, 97.63, 96.4,
+		94.89, 94.11, 91.97, 93.46, 94.17, 92.96, 94.79, 94.93, 94.87, 95.33, 96.6, 96.11, 96.04, 97.83,
+		99.53, 99.49, 100.94, 102.04, 103.05, 102.87, 102.26,
+	}
+	testLows = []float64{
+		98.32, 98.43, 98.82, 96.57, 96.94, 98.14, 99.28, 97.39, 96.74, 96.93, 96.03, 96.75, 96.14, 95.17,
+		95.59, 96.07, 96.99, 98.64, 101.07, 100.17, 102.08, 103.29, 104.02, 101.87, 101.64, 101.47, 101.87,
+		103.0, 103.77, 101.9, 99.64, 98.17, 98.78, 98.88, 100.07, 98.73, 97.33, 95.54, 93.81, 92.83, 90.37,
+		91.63, 90.74, 90.04, 89.69, 90.55, 92.97, 93.08, 92.56, 93.04, 93.07, 93.88, 93.92, 96.83, 98.14,
+		97.88, 100.04, 100.07, 101.53, 99.82,
+	}
+	testCloses = []float64{
+		99.3, 100.59, 99.45, 97.81, 99.6, 99.91, 100.14, 98.61, 97.02, 97.21, 97.2, 97.54, 96.26, 96.36,
+		96.8, 97.83, 99.68, 101.18, 101.17, 102.95, 103.87, 105.16, 104.55, 103.02, 103.97, 102.29, 103.57,
+		105.52, 104.12, 102.17, 100.19, 99.46, 100.08, 101.2, 100.79, 99.04, 97.48, 96.09, 94.37, 93.38,
+		91.84, 91.78, 92.74, 90.83, 91.59, 93.5, 93.57, 93.7, 94.15, 95.37, 94.17, 95.33, 97.16, 98.98,
+		98.86, 100.22, 100.79, 101.92, 101.66, 101.24,
+	}
+	testVolumes = []float64{
+		174.0, 619.0, 346.0, 226.0, 163.0, 147.0, 653.0, 285.0, 199.0, 310.0, 576.0, 913.0, 407.0, 394.0,
+		268.0, 140.0, 908.0, 708.0, 195.0, 162.0, 797.0, 784.0, 725.0, 232.0, 608.0, 240.0, 525.0, 336.0,
+		338.0, 388.0, 679.0, 732.0, 991.0, 501.0, 510.0, 266.0, 680.0, 126.0, 749.0, 225.0, 591.0, 450.0,
+		628.0, 250.0, 405.0, 367.0, 328.0, 328.0, 299.0, 332.0, 128.0, 719.0, 457.0, 332.0, 724.0, 918.0,
+		497.0, 282.0, 839.0, 842.0,
+	}
+)
+
+func last(values []float64) float64 { return values[len(values)-1] }
+
+func TestRSI(t *testing.T) {
+	rsi := RSI(testCloses, 14)
+	assert.True(t, math.IsNaN(rsi[13]))
+	assert.False(t, math.IsNaN(rsi[14]))
+	assert.InDelta(t, 62.94257514955449, last(rsi), 1e-9)
+
+	// 全漲 → 100；持平 → 50
+	assert.Equal(t, 100.0, last(RSI([]float64{1, 2, 3, 4}, 3)))
+	assert.Equal(t, 50.0, last(RSI([]float64{1, 1, 1, 1}, 3)))
+}
+
+func TestMACD(t *testing.T) {
+	macd, signal, hist := MACD(testCloses, 12, 26, 9)
+	assert.InDelta(t, 1.1004562680873846, last(macd), 1e-9)
+	assert.InDelta(t, 0.14682837236440535, last(signal), 1e-9)
+	assert.InDelta(t, 0.9536278957229792, last(hist), 1e-9)
+
+	// 訊號線首值：MACD 首值 (index 25) 起第 9 個
+	assert.True(t, math.IsNaN(signal[32]))
+	assert.False(t, math.IsNaN(signal[33]))
+}
+
+func TestBollingerBands(t *testing.T) {
+	mid, upper, lower := BollingerBands(testCloses, 20, 2)
+	assert.InDelta(t, 95.97, last(mid), 1e-9)
+	assert.InDelta(t, 103.3274506454342, last(upper), 1e-9)
+	assert.InDelta(t, 88.6125493545658, last(lower), 1e-9)
+	assert.True(t, math.IsNaN(upper[18]))
+}
+
+func TestATRAndKeltner(t *testing.T) {
+	assert.InDelta(t, 2.5615447311141346, last(ATR(testHighs, testLows, testCloses, 14)), 1e-9)
+
+	mid, upper, lower := KeltnerChannels(testHighs, testLows, testCloses, 20, 10, 2)
+	assert.InDelta(t, 98.11366759389048, last(mid), 1e-9)
+	assert.InDelta(t, 103.17601919543789, last(upper), 1e-9)
+	assert.InDelta(t, 93.05131599234308, last(lower), 1e-9)
+}
+
+func TestADX(t *testing.T) {
+	adx, plusDI, minusDI := ADX(testHighs, testLows, testCloses, 14)
+	assert.InDelta(t, 24.043319074766405, last(adx), 1e-9)
+	assert.InDelta(t, 22.101638441389245, last(plusDI), 1e-9)
+	assert.InDelta(t, 14.404149982638714, last(minusDI), 1e-9)
+	assert.True(t, math.IsNaN(adx[26]))
+	assert.False(t, math.IsNaN(adx[27]))
+}
+
+func TestVolumeIndicators(t *testing.T) {
+	assert.Equal(t, 3871.0, last(OBV(testCloses, testVolumes)))
+	assert.InDelta(t, 96.62123610539318, last(RollingVWAP(testHighs, testLows, testCloses, testVolumes, 20)), 1e-9)
+}
+
+func TestDonchianChannel(t *testing.T) {
+	upper, lower := DonchianChannel(testHighs, testLows, 20)
+	assert.Equal(t, 103.05, last(upper))
+	assert.Equal(t, 89.69, last(lower))
+	assert.True(t, math.IsNaN(upper[19]))
+}
+
+func TestCandlePatterns(t *testing.T) {
+	tests := []struct {
+		name                   string
+		opens, highs, lows, cl []float64
+		want                   string
+	}{
+		{name: "doji", opens: []float64{10}, highs: []float64{11}, lows: []float64{9}, cl: []float64{10.1}, want: "doji"},
+		{name: "hammer", opens: []float64{10}, highs: []float64{10.6}, lows: []float64{8}, cl: []float64{10.5}, want: "hammer"},
+		{name: "shooting star", opens: []float64{10.5}, highs: []float64{12.5}, lows: []float64{9.9}, cl: []float64{10}, want: "shooting_star"},
+		{name: "bullish engulfing", opens: []float64{10, 8.9}, highs: []float64{10.2, 11.2}, lows: []float64{8.8, 8.8}, cl: []float64{9, 11}, want: "bullish_engulfing"},
+		{name: "bearish engulfing", opens: []float64{9, 11}, highs: []float64{10.2, 11.2}, lows: []float64{8.8, 8.7}, cl: []float64{10, 8.8}, want: "bearish_engulfing"},
+		{name: "inside bar", opens: []float64{9, 9.5}, highs: []float64{12, 11}, lows: []float64{8, 9}, cl: []float64{11, 10.5}, want: "inside_bar"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flags := CandlePatterns(tt.opens, tt.highs, tt.lows, tt.cl)
+			for name, set := range flags {
+				assert.Equal(t, name == tt.want, set, name)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package compute
+
+// 純函數指標計算：輸入為時間升冪的數列，輸出與輸入等長，暖機期不足處以 NaN 填充
+
+import "math"
+
+// SMA 簡單移動平均
+func SMA(values []float64, period int) []float64 {
+	out := nanSeries(len(values))
+	if period <= 0 || len(values) < period {
+		return out
+	}
+
+	sum := 0.0
+	for i, v := range values {
+		sum += v
+		if i >= period {
+			sum -= values[i-period]
+		}
+		if i >= period-1 {
+			out[i] = sum / float64(period)
+		}
+	}
+	return out
+}
+
+// EMA 指數移動平均：α = 2/(n+1)，以前 n 筆 SMA 作為種子
+func EMA(values []float64, period int) []float64 {
+	out := nanSeries(len(values))
+	if period <= 0 || len(values) < period {
+		return out
+	}
+
+	alpha := 2.0 / float64(period+1)
+	seed := 0.0
+	for i := 0; i < period; i++ {
+		seed += values[i]
+	}
+	out[period-1] = seed / float64(period)
+
+	for i := period; i < len(values); i++ {
+		out[i] = alpha*values[i] + (1-alpha)*out[i-1]
+	}
+	return out
+}
+
+// Last 取數列最後一個值（空數列回傳 NaN）
+func Last(values []float64) float64 {
+	if len(values) == 0 {
+		return math.NaN()
+	}
+	return values[len(values)-1]
+}
+
+func nanSeries(n int) []float64 {
+	out := make([]float64, n)
+	for i := range out {
+		out[i] = math.NaN()
+	}
+	return out
+}
@@ -68,6 +68,56 @@ type Config struct {
 		Timeout       string   `yaml:"timeout"`
 		Dependencies  []string `yaml:"dependencies"`
 	} `yaml:"health"`
+	FeatureStore struct {
+		FeatureVersion     string `yaml:"feature_version"`
+		PublicationLatency string `yaml:"publication_latency"`
+		Collection         string `yaml:"collection"`
+	} `yaml:"feature_store"`
+	Recompute struct {
+		Workers   int    `yaml:"workers"`
+		QueueSize int    `yaml:"queue_size"`
+		TaskTTL   string `yaml:"task_ttl"`
+	} `yaml:"recompute"`
+	Candles struct {
+		SessionOffset string `yaml:"session_offset"`
+	} `yaml:"candles"`
+	Factors struct {
+		ReloadInterval string `yaml:"reload_interval"`
+		Static         []struct {
+			FactorID string `yaml:"factor_id"`
+			Formula  string `yaml:"formula"`
+		} `yaml:"static"`
+	} `yaml:"factors"`
+	Drift struct {
+		ReferenceSize     int                  `yaml:"reference_size"`
+		CurrentSize       int                  `yaml:"current_size"`
+		Bins              int                  `yaml:"bins"`
+		PSIThreshold      float64              `yaml:"psi_threshold"`
+		KSThreshold       float64              `yaml:"ks_threshold"`
+		NullRateThreshold float64              `yaml:"null_rate_threshold"`
+		StaleBars         int                  `yaml:"stale_bars"`
+		StaleExclude      []string             `yaml:"stale_exclude"`
+		ReferenceFromMs   int64                `yaml:"reference_from_ms"`
+		ReferenceToMs     int64                `yaml:"reference_to_ms"`
+		RulesOnlyFallback bool                 `yaml:"rules_only_fallback"`
+		FallbackTTL       string               `yaml:"fallback_ttl"`
+		Ranges            map[string][]float64 `yaml:"ranges"`
+	} `yaml:"drift"`
+	Carry struct {
+		S1URL                string  `yaml:"s1_url"`
+		Timeout              string  `yaml:"timeout"`
+		FundingIntervalHours float64 `yaml:"funding_interval_hours"`
+		FundingWindow        int     `yaml:"funding_window"`
+		OILookback           string  `yaml:"oi_lookback"`
+	} `yaml:"carry"`
+	Correlation struct {
+		Enabled   bool     `yaml:"enabled"`
+		Key       string   `yaml:"key"`
+		Symbols   []string `yaml:"symbols"`
+		Timeframe string   `yaml:"timeframe"`
+		Period    int      `yaml:"period"`
+		Refresh   string   `yaml:"refresh"`
+	} `yaml:"correlation"`
 	MemoryMonitoring struct {
 		Enabled                bool   `yaml:"enabled"`
 		MonitorInterval        string `yaml:"monitor_interval"`
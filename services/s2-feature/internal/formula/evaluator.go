@@ -0,0 +1,256 @@
+package formula
+
+import (
+	"math"
+)
+
+// Evaluator 公式的增量求值器：每根 K 線呼叫一次 Step，視窗函數各自維護環形緩衝區，
+// 單步成本為 O(視窗長度) 以內，不需重算整段歷史。
+//
+// 缺值語意：輸入缺失或為 NaN 時輸出 NaN；視窗函數只累積有效值（NaN 不進入視窗），
+// 視窗未滿前輸出 NaN。
+type Evaluator struct {
+	expr *Expr
+	root evalNode
+}
+
+// NewEvaluator 建立帶獨立狀態的求值器（每個 symbol × 週期各一個）
+func (e *Expr) NewEvaluator() *Evaluator {
+	return &Evaluator{expr: e, root: build(e.root)}
+}
+
+// Expr 求值器對應的公式
+func (ev *Evaluator) Expr() *Expr { return ev.expr }
+
+// Step 推進一根 K 線並回傳當根公式值；vars 未提供的序列視為 NaN
+func (ev *Evaluator) Step(vars map[string]float64) float64 {
+	return ev.root.step(vars)
+}
+
+type evalNode interface {
+	step(vars map[string]float64) float64
+}
+
+func build(n *astNode) evalNode {
+	switch n.kind {
+	case nodeNumber:
+		return constNode(n.value)
+	case nodeIdent:
+		return identNode(n.name)
+	case nodeUnary:
+		return &negNode{arg: build(n.args[0])}
+	case nodeBinary:
+		return &binaryNode{op: n.op, left: build(n.args[0]), right: build(n.args[1])}
+	}
+
+	arg := build(n.args[0])
+	switch n.name {
+	case "ema":
+		return &emaNode{arg: arg, period: n.window, alpha: 2 / float64(n.window+1)}
+	case "sma":
+		return &windowNode{arg: arg, ring: newRing(n.window), reduce: mean}
+	case "std":
+		return &windowNode{arg: arg, ring: newRing(n.window), reduce: stddev}
+	case "zscore":
+		return &windowNode{arg: arg, ring: newRing(n.window), reduce: zscore}
+	case "rank":
+		return &windowNode{arg: arg, ring: newRing(n.window), reduce: percentRank}
+	case "lag":
+		return &lagNode{arg: arg, ring: newRing(n.window + 1)}
+	case "abs":
+		return &mathNode{arg: arg, fn: math.Abs}
+	case "sqrt":
+		return &mathNode{arg: arg, fn: math.Sqrt}
+	case "log":
+		return &mathNode{arg: arg, fn: math.Log}
+	case "min":
+		return &pairNode{left: arg, right: build(n.args[1]), fn: math.Min}
+	case "max":
+		return &pairNode{left: arg, right: build(n.args[1]), fn: math.Max}
+	}
+	// Parse 已檢查函數白名單，不會到達此處
+	return constNode(math.NaN())
+}
+
+type constNode float64
+
+func (c constNode) step(map[string]float64) float64 { return float64(c) }
+
+type identNode string
+
+func (id identNode) step(vars map[string]float64) float64 {
+	if v, ok := vars[string(id)]; ok {
+		return v
+	}
+	return math.NaN()
+}
+
+type negNode struct{ arg evalNode }
+
+func (n *negNode) step(vars map[string]float64) float64 { return -n.arg.step(vars) }
+
+type binaryNode struct {
+	op          byte
+	left, right evalNode
+}
+
+func (n *binaryNode) step(vars map[string]float64) float64 {
+	// 兩側皆需推進，保持子節點狀態同步
+	l, r := n.left.step(vars), n.right.step(vars)
+	switch n.op {
+	case '+':
+		return l + r
+	case '-':
+		return l - r
+	case '*':
+		return l * r
+	}
+	if r == 0 {
+		return math.NaN()
+	}
+	return l / r
+}
+
+type mathNode struct {
+	arg evalNode
+	fn  func(float64) float64
+}
+
+func (n *mathNode) step(vars map[string]float64) float64 { return n.fn(n.arg.step(vars)) }
+
+type pairNode struct {
+	left, right evalNode
+	fn          func(float64, float64) float64
+}
+
+func (n *pairNode) step(vars map[string]float64) float64 {
+	return n.fn(n.left.step(vars), n.right.step(vars))
+}
+
+// emaNode 與 compute.EMA 一致：前 n 個有效值的 SMA 為種子，其後 α = 2/(n+1)
+type emaNode struct {
+	arg    evalNode
+	period int
+	alpha  float64
+	count  int
+	value  float64
+}
+
+func (n *emaNode) step(vars map[string]float64) float64 {
+	x := n.arg.step(vars)
+	if math.IsNaN(x) || math.IsInf(x, 0) {
+		return math.NaN()
+	}
+	n.count++
+	switch {
+	case n.count < n.period:
+		n.value += x
+		return math.NaN()
+	case n.count == n.period:
+		n.value = (n.value + x) / float64(n.period)
+	default:
+		n.value = n.alpha*x + (1-n.alpha)*n.value
+	}
+	return n.value
+}
+
+// lagNode 回傳 n 根前的值（含 NaN，保持時間對齊）
+type lagNode struct {
+	arg  evalNode
+	ring *ring
+}
+
+func (n *lagNode) step(vars map[string]float64) float64 {
+	n.ring.push(n.arg.step(vars))
+	if !n.ring.full() {
+		return math.NaN()
+	}
+	return n.ring.oldest()
+}
+
+// windowNode 滑動視窗聚合；當根輸入無效時不進入視窗並輸出 NaN
+type windowNode struct {
+	arg    evalNode
+	ring   *ring
+	reduce func(values []float64, current float64) float64
+}
+
+func (n *windowNode) step(vars map[string]float64) float64 {
+	x := n.arg.step(vars)
+	if math.IsNaN(x) || math.IsInf(x, 0) {
+		return math.NaN()
+	}
+	n.ring.push(x)
+	if !n.ring.full() {
+		return math.NaN()
+	}
+	return n.reduce(n.ring.values, x)
+}
+
+func mean(values []float64, _ float64) float64 {
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// stddev 母體標準差（與 RV 計算一致）
+func stddev(values []float64, current float64) float64 {
+	m := mean(values, current)
+	variance := 0.0
+	for _, v := range values {
+		variance += (v - m) * (v - m)
+	}
+	return math.Sqrt(variance / float64(len(values)))
+}
+
+// zscore 當根值相對視窗（含當根）的標準分數；視窗無波動時為 0
+func zscore(values []float64, current float64) float64 {
+	sd := stddev(values, current)
+	if sd == 0 {
+		return 0
+	}
+	return (current - mean(values, current)) / sd
+}
+
+// percentRank 當根值在視窗內的百分位 ∈ [0, 1]：(小於者 + 0.5×等於者(不含自身)) / (n-1)
+func percentRank(values []float64, current float64) float64 {
+	if len(values) == 1 {
+		return 0.5
+	}
+	below, equal := 0.0, -1.0
+	for _, v := range values {
+		if v < current {
+			below++
+		} else if v == current {
+			equal++
+		}
+	}
+	return (below + 0.5*equal) / float64(len(values)-1)
+}
+
+// ring 固定長度環形緩衝區；values 為底層儲存（順序不保證，聚合函數皆與順序無關）
+type ring struct {
+	values []float64
+	size   int
+	next   int
+}
+
+func newRing(size int) *ring {
+	return &ring{values: make([]float64, 0, size), size: size}
+}
+
+func (r *ring) push(v float64) {
+	if len(r.values) < r.size {
+		r.values = append(r.values, v)
+		return
+	}
+	r.values[r.next] = v
+	r.next = (r.next + 1) % r.size
+}
+
+func (r *ring) full() bool { return len(r.values) == r.size }
+
+// oldest 視窗已滿時最舊的值
+func (r *ring) oldest() float64 { return r.values[r.next] }
@@ -0,0 +1,144 @@
+package formula
+
+import (
+	"math"
+	"testing"
+
+	"s2-feature/internal/compute"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func runSeries(t *testing.T, source string, closes []float64) []float64 {
+	expr, err := Parse(source)
+	if !assert.NoError(t, err) {
+		return nil
+	}
+	ev := expr.NewEvaluator()
+	out := make([]float64, len(closes))
+	for i, c := range closes {
+		out[i] = ev.Step(map[string]float64{"close": c})
+	}
+	return out
+}
+
+func sampleCloses(n int) []float64 {
+	closes := make([]float64, n)
+	for i := range closes {
+		closes[i] = 100 + 10*math.Sin(float64(i)/7) + float64(i%5)
+	}
+	return closes
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		formula string
+	}{
+		{name: "empty", formula: "  "},
+		{name: "unknown function", formula: "exec(close)"},
+		{name: "wrong arity", formula: "ema(close)"},
+		{name: "non constant window", formula: "sma(close, volume)"},
+		{name: "negative window", formula: "lag(close, -1)"},
+		{name: "fractional window", formula: "sma(close, 2.5)"},
+		{name: "window too large", formula: "rank(close, 100000)"},
+		{name: "unbalanced parens", formula: "(close + 1"},
+		{name: "trailing tokens", formula: "close close"},
+		{name: "illegal character", formula: "close; drop"},
+		{name: "too deep", formula: "abs(abs(abs(abs(abs(abs(abs(abs(abs(abs(abs(abs(abs(abs(abs(abs(abs(abs(abs(abs(abs(abs(abs(abs(abs(abs(abs(abs(abs(abs(abs(abs(abs(close)))))))))))))))))))))))))))))))))"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.formula)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestParse_InputsAndWarmup(t *testing.T) {
+	expr, err := Parse("EMA(close,20)/ema(close,50)-1")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []string{"close"}, expr.Inputs())
+	assert.Equal(t, 50, expr.Warmup())
+
+	expr, err = Parse("zscore(funding, 30) + rank(lag(rv, 1), 10) * 1e-3")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []string{"funding", "rv"}, expr.Inputs())
+	assert.Equal(t, 30, expr.Warmup())
+}
+
+func TestEvaluator_MatchesBatchIndicators(t *testing.T) {
+	closes := sampleCloses(120)
+
+	ratio := runSeries(t, "ema(close,20)/ema(close,50)-1", closes)
+	fast, slow := compute.EMA(closes, 20), compute.EMA(closes, 50)
+	for i := range closes {
+		want := fast[i]/slow[i] - 1
+		if math.IsNaN(want) {
+			assert.True(t, math.IsNaN(ratio[i]), "index %d should be warming up", i)
+			continue
+		}
+		assert.InDelta(t, want, ratio[i], 1e-12, "index %d", i)
+	}
+
+	sma := runSeries(t, "sma(close, 10)", closes)
+	batch := compute.SMA(closes, 10)
+	for i := range closes {
+		if math.IsNaN(batch[i]) {
+			assert.True(t, math.IsNaN(sma[i]))
+			continue
+		}
+		assert.InDelta(t, batch[i], sma[i], 1e-9)
+	}
+}
+
+func TestEvaluator_WindowFunctions(t *testing.T) {
+	closes := []float64{1, 2, 3, 4, 5}
+
+	lag := runSeries(t, "lag(close, 2)", closes)
+	assert.True(t, math.IsNaN(lag[1]))
+	assert.Equal(t, 1.0, lag[2])
+	assert.Equal(t, 3.0, lag[4])
+
+	// 視窗 [3,4,5]：均值 4、母體標準差 √(2/3)
+	z := runSeries(t, "zscore(close, 3)", closes)
+	assert.InDelta(t, 1/math.Sqrt(2.0/3.0), z[4], 1e-12)
+
+	std := runSeries(t, "std(close, 3)", closes)
+	assert.InDelta(t, math.Sqrt(2.0/3.0), std[4], 1e-12)
+
+	// 遞增序列的當根值永遠是視窗最大值
+	rank := runSeries(t, "rank(close, 4)", closes)
+	assert.True(t, math.IsNaN(rank[2]))
+	assert.Equal(t, 1.0, rank[3])
+
+	rank = runSeries(t, "rank(close, 3)", []float64{5, 1, 3})
+	assert.Equal(t, 0.5, rank[2])
+}
+
+func TestEvaluator_MissingInputsAndDivision(t *testing.T) {
+	expr, err := Parse("close / (close - close) + max(open, 1)")
+	if !assert.NoError(t, err) {
+		return
+	}
+	ev := expr.NewEvaluator()
+	assert.True(t, math.IsNaN(ev.Step(map[string]float64{"close": 1, "open": 2})))
+
+	// 缺值不進入視窗
+	expr, _ = Parse("sma(funding, 2)")
+	ev = expr.NewEvaluator()
+	assert.True(t, math.IsNaN(ev.Step(map[string]float64{"funding": 1})))
+	assert.True(t, math.IsNaN(ev.Step(map[string]float64{})))
+	assert.Equal(t, 2.0, ev.Step(map[string]float64{"funding": 3}))
+
+	// 各求值器狀態獨立
+	a, b := expr.NewEvaluator(), expr.NewEvaluator()
+	a.Step(map[string]float64{"funding": 10})
+	assert.Equal(t, 10.0, a.Step(map[string]float64{"funding": 10}))
+	assert.True(t, math.IsNaN(b.Step(map[string]float64{"funding": 10})))
+}
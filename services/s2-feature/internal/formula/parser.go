@@ -0,0 +1,377 @@
+package formula
+
+// 因子公式語言：四則運算 + 白名單函數，作用於 K 線序列與既有特徵
+//
+//   expr    := term   (('+' | '-') term)*
+//   term    := unary  (('*' | '/') unary)*
+//   unary   := '-' unary | primary
+//   primary := number | ident | ident '(' expr (',' expr)* ')' | '(' expr ')'
+//
+// 安全限制：無迴圈、無賦值、無外部呼叫；公式長度、節點數、巢狀深度與視窗長度皆有上限。
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// 公式限制
+const (
+	MaxFormulaLength = 1024
+	MaxNodes         = 256
+	MaxDepth         = 32
+	MaxWindow        = 5000
+)
+
+// funcSpec 函數簽名：args 為參數個數，windowArg 為需為正整數常數的參數位置（-1 表示無）
+type funcSpec struct {
+	args      int
+	windowArg int
+}
+
+var functions = map[string]funcSpec{
+	"ema":    {args: 2, windowArg: 1},
+	"sma":    {args: 2, windowArg: 1},
+	"std":    {args: 2, windowArg: 1},
+	"zscore": {args: 2, windowArg: 1},
+	"rank":   {args: 2, windowArg: 1},
+	"lag":    {args: 2, windowArg: 1},
+	"abs":    {args: 1, windowArg: -1},
+	"log":    {args: 1, windowArg: -1},
+	"sqrt":   {args: 1, windowArg: -1},
+	"min":    {args: 2, windowArg: -1},
+	"max":    {args: 2, windowArg: -1},
+}
+
+// Expr 已編譯的公式（不含狀態，可安全共用）；以 NewEvaluator 建立帶狀態的求值器
+type Expr struct {
+	source string
+	root   *astNode
+	inputs []string
+	warmup int
+}
+
+// Source 原始公式
+func (e *Expr) Source() string { return e.source }
+
+// Inputs 公式引用的序列名稱（已排序）
+func (e *Expr) Inputs() []string { return append([]string(nil), e.inputs...) }
+
+// Warmup 產生第一個有效值前需要的最少 K 線根數
+func (e *Expr) Warmup() int { return e.warmup }
+
+type nodeKind int
+
+const (
+	nodeNumber nodeKind = iota
+	nodeIdent
+	nodeUnary
+	nodeBinary
+	nodeCall
+)
+
+type astNode struct {
+	kind   nodeKind
+	value  float64 // nodeNumber
+	name   string  // nodeIdent / nodeCall
+	op     byte    // nodeUnary / nodeBinary
+	args   []*astNode
+	window int // nodeCall 且含視窗參數時
+}
+
+// Parse 解析並檢查公式
+func Parse(source string) (*Expr, error) {
+	if strings.TrimSpace(source) == "" {
+		return nil, fmt.Errorf("empty formula")
+	}
+	if len(source) > MaxFormulaLength {
+		return nil, fmt.Errorf("formula too long: %d > %d", len(source), MaxFormulaLength)
+	}
+
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	root, err := p.parseExpr(0)
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q at position %d", tok.text, tok.pos)
+	}
+
+	inputs := map[string]bool{}
+	nodes := 0
+	warmup, err := check(root, inputs, &nodes)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(inputs))
+	for name := range inputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return &Expr{source: source, root: root, inputs: names, warmup: warmup}, nil
+}
+
+// check 驗證函數名稱/參數、節點數上限，並推算暖機根數
+func check(n *astNode, inputs map[string]bool, nodes *int) (int, error) {
+	*nodes++
+	if *nodes > MaxNodes {
+		return 0, fmt.Errorf("formula too complex: more than %d nodes", MaxNodes)
+	}
+
+	switch n.kind {
+	case nodeNumber:
+		return 0, nil
+	case nodeIdent:
+		inputs[n.name] = true
+		return 1, nil
+	}
+
+	if n.kind == nodeCall {
+		spec, ok := functions[n.name]
+		if !ok {
+			return 0, fmt.Errorf("unknown function %q", n.name)
+		}
+		if len(n.args) != spec.args {
+			return 0, fmt.Errorf("%s expects %d arguments, got %d", n.name, spec.args, len(n.args))
+		}
+		if spec.windowArg >= 0 {
+			arg := n.args[spec.windowArg]
+			if arg.kind != nodeNumber || arg.value != float64(int(arg.value)) || arg.value < 1 || arg.value > MaxWindow {
+				return 0, fmt.Errorf("%s window must be an integer constant in [1, %d]", n.name, MaxWindow)
+			}
+			n.window = int(arg.value)
+		}
+	}
+
+	warmup := 0
+	for i, arg := range n.args {
+		if n.kind == nodeCall && i == functions[n.name].windowArg {
+			continue
+		}
+		w, err := check(arg, inputs, nodes)
+		if err != nil {
+			return 0, err
+		}
+		if w > warmup {
+			warmup = w
+		}
+	}
+
+	// 視窗函數在輸入有效後還需 window-1 根（lag 需 window 根）
+	if n.kind == nodeCall {
+		switch n.name {
+		case "ema", "sma", "std", "zscore", "rank":
+			warmup += n.window - 1
+		case "lag":
+			warmup += n.window
+		}
+	}
+	return warmup, nil
+}
+
+// ---- lexer ----
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokIdent
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func tokenize(source string) ([]token, error) {
+	var tokens []token
+	runes := []rune(source)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case unicode.IsDigit(r) || r == '.':
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			// 科學記號 1e-3
+			if i < len(runes) && (runes[i] == 'e' || runes[i] == 'E') {
+				j := i + 1
+				if j < len(runes) && (runes[j] == '+' || runes[j] == '-') {
+					j++
+				}
+				if j < len(runes) && unicode.IsDigit(runes[j]) {
+					i = j
+					for i < len(runes) && unicode.IsDigit(runes[i]) {
+						i++
+					}
+				}
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: string(runes[start:i]), pos: start})
+		case r == '_' || unicode.IsLetter(r):
+			start := i
+			for i < len(runes) && (runes[i] == '_' || unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i])) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokIdent, text: string(runes[start:i]), pos: start})
+		case strings.ContainsRune("+-*/(),", r):
+			tokens = append(tokens, token{kind: tokOp, text: string(r), pos: i})
+			i++
+		default:
+			return nil, fmt.Errorf("unexpected character %q at position %d", r, i)
+		}
+	}
+	return append(tokens, token{kind: tokEOF, pos: len(runes)}), nil
+}
+
+// ---- parser ----
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token { return p.tokens[p.pos] }
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) isOp(text string) bool {
+	tok := p.peek()
+	return tok.kind == tokOp && tok.text == text
+}
+
+func (p *parser) expect(text string) error {
+	if !p.isOp(text) {
+		tok := p.peek()
+		if tok.kind == tokEOF {
+			return fmt.Errorf("expected %q at end of formula", text)
+		}
+		return fmt.Errorf("expected %q at position %d, got %q", text, tok.pos, tok.text)
+	}
+	p.next()
+	return nil
+}
+
+func (p *parser) parseExpr(depth int) (*astNode, error) {
+	if depth > MaxDepth {
+		return nil, fmt.Errorf("formula nested deeper than %d", MaxDepth)
+	}
+	left, err := p.parseTerm(depth)
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("+") || p.isOp("-") {
+		op := p.next().text[0]
+		right, err := p.parseTerm(depth)
+		if err != nil {
+			return nil, err
+		}
+		left = &astNode{kind: nodeBinary, op: op, args: []*astNode{left, right}}
+	}
+	return left, nil
+}
+
+func (p *parser) parseTerm(depth int) (*astNode, error) {
+	left, err := p.parseUnary(depth)
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("*") || p.isOp("/") {
+		op := p.next().text[0]
+		right, err := p.parseUnary(depth)
+		if err != nil {
+			return nil, err
+		}
+		left = &astNode{kind: nodeBinary, op: op, args: []*astNode{left, right}}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary(depth int) (*astNode, error) {
+	if p.isOp("-") {
+		if depth > MaxDepth {
+			return nil, fmt.Errorf("formula nested deeper than %d", MaxDepth)
+		}
+		p.next()
+		operand, err := p.parseUnary(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		// 常數直接折疊，使 lag(x, -1) 之類仍能被視窗檢查攔下
+		if operand.kind == nodeNumber {
+			return &astNode{kind: nodeNumber, value: -operand.value}, nil
+		}
+		return &astNode{kind: nodeUnary, op: '-', args: []*astNode{operand}}, nil
+	}
+	return p.parsePrimary(depth)
+}
+
+func (p *parser) parsePrimary(depth int) (*astNode, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokNumber:
+		value, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q at position %d", tok.text, tok.pos)
+		}
+		return &astNode{kind: nodeNumber, value: value}, nil
+
+	case tokIdent:
+		name := strings.ToLower(tok.text)
+		if !p.isOp("(") {
+			return &astNode{kind: nodeIdent, name: name}, nil
+		}
+		p.next()
+		call := &astNode{kind: nodeCall, name: name}
+		for {
+			arg, err := p.parseExpr(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			call.args = append(call.args, arg)
+			if !p.isOp(",") {
+				break
+			}
+			p.next()
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return call, nil
+
+	case tokOp:
+		if tok.text == "(" {
+			inner, err := p.parseExpr(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return inner, nil
+		}
+		return nil, fmt.Errorf("unexpected %q at position %d", tok.text, tok.pos)
+	}
+
+	return nil, fmt.Errorf("unexpected end of formula")
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"s2-feature/dao"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// lineageHashAlgo 內容雜湊演算法
+const lineageHashAlgo = "sha256"
+
+// CalculatorDescriptor 可選接口：計算器版本與參數（特徵血緣記錄用）
+// 計算邏輯或輸出欄位變更時須遞增 Version，否則舊快照重算會被判定為不一致
+type CalculatorDescriptor interface {
+	Version() string
+	Params() map[string]interface{}
+}
+
+// candleStream K 線來源 Stream（S1 永續合約行情事件）
+func candleStream(symbol string) string {
+	return fmt.Sprintf("mkt:events:{perp}:%s", symbol)
+}
+
+// lastClosedBaseMs 最後一根已收盤基礎 K 線的收盤時間（特徵輸入截止點）
+func lastClosedBaseMs(window string, nowMs int64) (int64, error) {
+	baseDur, err := windowDuration(baseTimeframeFor(window))
+	if err != nil {
+		return 0, err
+	}
+	return nowMs - nowMs%baseDur.Milliseconds(), nil
+}
+
+// deriveFeatures 以截至 toMs 的 K 線計算計算器與多時框特徵
+// 結果只取決於輸入 K 線與計算器參數，live 計算與血緣驗證共用此路徑
+func (s *S2_FEATUREServer) deriveFeatures(symbol, window string, toMs int64) ([]MarketDataPoint, map[string]interface{}, []dao.LineageInput, error) {
+	marketData, input, err := s.getMarketData(symbol, window, toMs)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if len(marketData) == 0 {
+		return nil, nil, nil, fmt.Errorf("no market data for %s %s", symbol, window)
+	}
+
+	features := make(map[string]interface{})
+	for featureType, calculator := range s.featureCalculators {
+		result, err := calculator.Calculate(symbol, marketData)
+		if err != nil {
+			log.Printf("Failed to calculate %s for %s: %v", featureType, symbol, err)
+			continue
+		}
+		features[featureType] = result
+	}
+
+	// 多時框一致性特徵（以當前 window 為錨定週期）
+	inputs := []dao.LineageInput{input}
+	if mtf, mtfInputs, err := s.computeMultiTimeframeFeatures(symbol, window, marketData, toMs); err != nil {
+		log.Printf("Failed to calculate MTF for %s %s: %v", symbol, window, err)
+	} else {
+		features["MTF"] = mtf
+		inputs = append(inputs, mtfInputs...)
+	}
+
+	return marketData, features, inputs, nil
+}
+
+// describeCalculators 目前生效的計算器版本與參數（依特徵類型升冪）
+func (s *S2_FEATUREServer) describeCalculators() []dao.CalculatorLineage {
+	calculators := make([]dao.CalculatorLineage, 0, len(s.featureCalculators)+1)
+	for featureType, calculator := range s.featureCalculators {
+		entry := dao.CalculatorLineage{FeatureType: featureType, Version: "unversioned"}
+		if d, ok := calculator.(CalculatorDescriptor); ok {
+			entry.Version = d.Version()
+			entry.Params = d.Params()
+		}
+		calculators = append(calculators, entry)
+	}
+	calculators = append(calculators, dao.CalculatorLineage{
+		FeatureType: "MTF",
+		Version:     mtfVersion,
+		Params: map[string]interface{}{
+			"fast_ema": mtfFastEMA,
+			"slow_ema": mtfSlowEMA,
+			"weights":  mtfWeights,
+		},
+	})
+	sort.Slice(calculators, func(i, j int) bool {
+		return calculators[i].FeatureType < calculators[j].FeatureType
+	})
+	return calculators
+}
+
+// canonicalJSON 標準化序列化：encoding/json 對 map 鍵排序，整數值的 float64 與 int 輸出相同，
+// 因此經 ArangoDB 往返（數值皆解為 float64）後仍得到相同位元組
+func canonicalJSON(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// featureContentHash 指定特徵群組的內容雜湊
+func featureContentHash(features map[string]interface{}, groups []string) (string, error) {
+	subset := make(map[string]interface{}, len(groups))
+	for _, group := range groups {
+		value, ok := features[group]
+		if !ok {
+			return "", fmt.Errorf("feature group %s missing", group)
+		}
+		subset[group] = value
+	}
+
+	payload, err := canonicalJSON(subset)
+	if err != nil {
+		return "", fmt.Errorf("failed to serialize features: %w", err)
+	}
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// featureGroups 特徵群組名稱（升冪）
+func featureGroups(features map[string]interface{}) []string {
+	groups := make([]string, 0, len(features))
+	for group := range features {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	return groups
+}
+
+// buildLineage 建立特徵快照血緣；features 須為 deriveFeatures 的結果（尚未加入公式因子）
+func (s *S2_FEATUREServer) buildLineage(window string, toMs int64, inputs []dao.LineageInput, features map[string]interface{}) (*dao.FeatureLineage, error) {
+	groups := featureGroups(features)
+	hash, err := featureContentHash(features, groups)
+	if err != nil {
+		return nil, err
+	}
+
+	lineage := &dao.FeatureLineage{
+		Timeframe:    window,
+		AsOfMs:       toMs,
+		Inputs:       inputs,
+		Calculators:  s.describeCalculators(),
+		HashAlgo:     lineageHashAlgo,
+		HashedGroups: groups,
+		ContentHash:  hash,
+	}
+	if s.factorEngine != nil {
+		factors := s.factorEngine.List()
+		lineage.FactorRev = factors.Rev
+		lineage.FactorBundleID = factors.BundleID
+	}
+	return lineage, nil
+}
+
+// snapshotHash 快照全部特徵連同資金費輸入、公式版本與 content_hash 的雜湊
+func snapshotHash(lineage *dao.FeatureLineage, features map[string]interface{}) (string, error) {
+	subset := make(map[string]interface{}, len(lineage.SnapshotGroups))
+	for _, group := range lineage.SnapshotGroups {
+		value, ok := features[group]
+		if !ok {
+			return "", fmt.Errorf("feature %s missing", group)
+		}
+		subset[group] = value
+	}
+
+	payload, err := canonicalJSON(map[string]interface{}{
+		"features":         subset,
+		"funding_input":    lineage.FundingInput,
+		"factor_rev":       lineage.FactorRev,
+		"factor_bundle_id": lineage.FactorBundleID,
+		"content_hash":     lineage.ContentHash,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to serialize snapshot: %w", err)
+	}
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// sealLineage 加入 CARRY、公式因子後記錄資金費輸入並計算快照雜湊；funding 為 nil 表示未取得資金費
+func sealLineage(lineage *dao.FeatureLineage, features map[string]interface{}, funding *dao.FundingRate) error {
+	lineage.FundingInput = nil
+	if funding != nil {
+		lineage.FundingInput = &dao.LineageFunding{
+			Symbol:          funding.Symbol,
+			Rate:            funding.Rate,
+			NextRate:        funding.NextRate,
+			MarkPrice:       funding.MarkPrice,
+			IndexPrice:      funding.IndexPrice,
+			OpenInterest:    funding.OpenInterest,
+			FundingTime:     funding.FundingTime,
+			NextFundingTime: funding.NextFundingTime,
+			Timestamp:       funding.Timestamp,
+		}
+	}
+	lineage.SnapshotGroups = featureGroups(features)
+	hash, err := snapshotHash(lineage, features)
+	if err != nil {
+		lineage.SnapshotGroups = nil
+		return err
+	}
+	lineage.SnapshotHash = hash
+	return nil
+}
+
+// verifyLineage 依記錄的血緣重算特徵並逐位元組比對
+func (s *S2_FEATUREServer) verifyLineage(record *dao.FeatureRecord) (*dao.FeatureLineageResponse, error) {
+	lineage := record.Lineage
+	response := &dao.FeatureLineageResponse{
+		SetID:   record.SetID,
+		Symbol:  record.Symbol,
+		Lineage: lineage,
+	}
+
+	_, features, inputs, err := s.deriveFeatures(record.Symbol, lineage.Timeframe, lineage.AsOfMs)
+	if err != nil {
+		return nil, err
+	}
+
+	// 輸入範圍與來源 Stream ID
+	if len(inputs) != len(lineage.Inputs) {
+		response.Mismatches = append(response.Mismatches, fmt.Sprintf("inputs: recorded %d timeframes, re-derived %d", len(lineage.Inputs), len(inputs)))
+	} else {
+		for i := range inputs {
+			if inputs[i] != lineage.Inputs[i] {
+				response.Mismatches = append(response.Mismatches, fmt.Sprintf("inputs: %s candle range differs", lineage.Inputs[i].Timeframe))
+			}
+		}
+	}
+
+	// 計算器版本與參數
+	recorded, _ := canonicalJSON(lineage.Calculators)
+	current, _ := canonicalJSON(s.describeCalculators())
+	if string(recorded) != string(current) {
+		response.Mismatches = append(response.Mismatches, "calculators: versions or params changed since snapshot")
+	}
+
+	// 已保存的特徵須與記錄的雜湊一致（防止事後竄改）
+	if stored, err := featureContentHash(record.Features, lineage.HashedGroups); err != nil || stored != lineage.ContentHash {
+		response.Mismatches = append(response.Mismatches, "content: stored features do not match content hash")
+	}
+
+	// CARRY 與公式因子無法重算：以快照雜湊確認保存內容與記錄的資金費輸入、公式版本一致
+	if lineage.SnapshotHash != "" {
+		if fmt.Sprint(featureGroups(record.Features)) != fmt.Sprint(lineage.SnapshotGroups) {
+			response.Mismatches = append(response.Mismatches, "snapshot: stored feature keys differ from snapshot_groups")
+		}
+		if stored, err := snapshotHash(lineage, record.Features); err != nil || stored != lineage.SnapshotHash {
+			response.Mismatches = append(response.Mismatches, "snapshot: stored features do not match snapshot hash")
+		}
+	}
+
+	// 重算結果
+	groups := featureGroups(features)
+	if fmt.Sprint(groups) != fmt.Sprint(lineage.HashedGroups) {
+		response.Mismatches = append(response.Mismatches, fmt.Sprintf("groups: recorded %v, re-derived %v", lineage.HashedGroups, groups))
+	}
+	response.RecomputedHash, err = featureContentHash(features, groups)
+	if err != nil {
+		return nil, err
+	}
+	if response.RecomputedHash != lineage.ContentHash {
+		response.Mismatches = append(response.Mismatches, "hash: re-derived content hash differs")
+	}
+
+	response.Verified = len(response.Mismatches) == 0
+	return response, nil
+}
+
+// @Summary Get feature lineage
+// @Description Get the inputs, calculator versions and content hash of a feature snapshot, and re-derive it to confirm the hash byte-for-byte
+// @Tags features
+// @Accept json
+// @Produce json
+// @Param set_id path string true "Feature set ID"
+// @Success 200 {object} dao.FeatureLineageResponse
+// @Failure 404 {object} map[string]string "Feature set or lineage not found"
+// @Router /features/lineage/{set_id} [get]
+func (s *S2_FEATUREServer) GetFeatureLineage(c *gin.Context) {
+	setID := c.Param("set_id")
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	record, err := s.featureStore.BySetID(ctx, setID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to query feature store", "details": err.Error()})
+		return
+	}
+	if record == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "feature set not found"})
+		return
+	}
+	if record.Lineage == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no lineage recorded for feature set"})
+		return
+	}
+
+	response, err := s.verifyLineage(record)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to re-derive features", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"s2-feature/dao"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFeatureContentHash_StableAcrossRoundTrip(t *testing.T) {
+	features := map[string]interface{}{
+		"ATR": map[string]interface{}{"atr": 123.456, "period": 14, "symbol": "BTCUSDT"},
+		"MTF": map[string]interface{}{"htf_veto_long": true, "trend_1h": 1},
+	}
+	groups := featureGroups(features)
+	assert.Equal(t, []string{"ATR", "MTF"}, groups)
+
+	hash, err := featureContentHash(features, groups)
+	assert.NoError(t, err)
+	assert.Len(t, hash, 64)
+
+	// 經 JSON 往返（如 ArangoDB）後整數變為 float64，雜湊不變
+	payload, _ := json.Marshal(features)
+	var decoded map[string]interface{}
+	assert.NoError(t, json.Unmarshal(payload, &decoded))
+	again, err := featureContentHash(decoded, groups)
+	assert.NoError(t, err)
+	assert.Equal(t, hash, again)
+
+	_, err = featureContentHash(features, []string{"ATR", "RSI"})
+	assert.Error(t, err)
+}
+
+func TestSealLineage_CoversCarryAndFactors(t *testing.T) {
+	features := func() map[string]interface{} {
+		return map[string]interface{}{
+			"ATR":          map[string]interface{}{"atr": 123.456, "period": 14},
+			"CARRY":        map[string]interface{}{"funding_next": 0.0001, "funding_settlements": 21},
+			"FACTORS":      map[string]interface{}{"trend_score": 0.42},
+			"funding_next": 0.0001,
+		}
+	}
+	funding := &dao.FundingRate{Symbol: "BTCUSDT", Rate: 0.0001, NextRate: 0.0001, FundingTime: 1700000000000, Timestamp: 1700000100000}
+	seal := func(f map[string]interface{}, funding *dao.FundingRate, factorRev int) *dao.FeatureLineage {
+		lineage := &dao.FeatureLineage{ContentHash: "abc", FactorRev: factorRev}
+		assert.NoError(t, sealLineage(lineage, f, funding))
+		return lineage
+	}
+
+	base := seal(features(), funding, 3)
+	assert.Equal(t, []string{"ATR", "CARRY", "FACTORS", "funding_next"}, base.SnapshotGroups)
+	assert.Equal(t, 1700000000000, int(base.FundingInput.FundingTime))
+
+	// 經 JSON 往返後雜湊不變
+	payload, _ := json.Marshal(features())
+	var decoded map[string]interface{}
+	assert.NoError(t, json.Unmarshal(payload, &decoded))
+	again, err := snapshotHash(base, decoded)
+	assert.NoError(t, err)
+	assert.Equal(t, base.SnapshotHash, again)
+
+	// 扁平 carry 鍵、公式因子、資金費輸入或公式版本任一不同，雜湊即不同
+	flat := features()
+	flat["funding_next"] = 0.0002
+	factors := features()
+	factors["FACTORS"] = map[string]interface{}{"trend_score": 0.43}
+	otherFunding := *funding
+	otherFunding.NextRate = 0.0002
+	for name, lineage := range map[string]*dao.FeatureLineage{
+		"flat carry key": seal(flat, funding, 3),
+		"factors":        seal(factors, funding, 3),
+		"funding input":  seal(features(), &otherFunding, 3),
+		"factor rev":     seal(features(), funding, 4),
+	} {
+		assert.NotEqual(t, base.SnapshotHash, lineage.SnapshotHash, name)
+	}
+}
+
+func TestGetFeatureLineage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server := NewS2_FEATUREServer()
+
+	if !assert.NoError(t, server.computeFeaturesForSymbol("BTCUSDT", "1h", true)) {
+		return
+	}
+	snapshot := server.featureCache["BTCUSDT"]
+	if !assert.NotNil(t, snapshot.Lineage) {
+		return
+	}
+	lineage := snapshot.Lineage
+	assert.Equal(t, lineageHashAlgo, lineage.HashAlgo)
+	assert.Equal(t, "1h", lineage.Inputs[0].Timeframe)
+	assert.Equal(t, candleStream("BTCUSDT"), lineage.Inputs[0].Stream)
+	assert.NotEmpty(t, lineage.Inputs[0].LastStreamID)
+	assert.Len(t, lineage.Inputs, len(supportedWindows))
+	assert.NotContains(t, lineage.HashedGroups, "FACTORS")
+	assert.NotEmpty(t, lineage.SnapshotHash)
+	assert.Equal(t, featureGroups(snapshot.Features), lineage.SnapshotGroups)
+
+	r := gin.New()
+	r.GET("/features/lineage/:set_id", server.GetFeatureLineage)
+	get := func(setID string) (int, dao.FeatureLineageResponse) {
+		req := httptest.NewRequest("GET", "/features/lineage/"+setID, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var response dao.FeatureLineageResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response
+	}
+
+	code, response := get(snapshot.SetID)
+	assert.Equal(t, http.StatusOK, code)
+	assert.True(t, response.Verified, "mismatches: %v", response.Mismatches)
+	assert.Equal(t, lineage.ContentHash, response.RecomputedHash)
+
+	// 竄改已保存的特徵：重算仍一致，但保存內容與雜湊不符
+	record, _ := server.featureStore.BySetID(context.Background(), snapshot.SetID)
+	tampered := *record
+	tampered.Features = make(map[string]interface{}, len(record.Features))
+	for group, value := range record.Features {
+		tampered.Features[group] = value
+	}
+	tampered.Features["RV"] = map[string]interface{}{"rv": 0.0}
+	assert.NoError(t, server.featureStore.Put(context.Background(), &tampered))
+
+	code, response = get(snapshot.SetID)
+	assert.Equal(t, http.StatusOK, code)
+	assert.False(t, response.Verified)
+	assert.Contains(t, response.Mismatches, "content: stored features do not match content hash")
+	assert.Contains(t, response.Mismatches, "snapshot: stored features do not match snapshot hash")
+
+	// 只加入無法重算的特徵（扁平 carry 鍵）：重算雜湊一致，但與快照記錄的特徵鍵不符
+	tampered.Features = record.Features
+	tampered.Features["funding_next"] = 0.01
+	assert.NoError(t, server.featureStore.Put(context.Background(), &tampered))
+	code, response = get(snapshot.SetID)
+	assert.Equal(t, http.StatusOK, code)
+	assert.False(t, response.Verified)
+	assert.Equal(t, []string{"snapshot: stored feature keys differ from snapshot_groups"}, response.Mismatches)
+	assert.NotContains(t, response.Mismatches, "content: stored features do not match content hash")
+
+	code, _ = get("set_missing")
+	assert.Equal(t, http.StatusNotFound, code)
+}
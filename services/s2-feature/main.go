@@ -6,6 +6,7 @@ import (
 	"math"
 	"net/http"
 	"os"
+	"regexp"
 	"s2-feature/dao"
 	"s2-feature/internal/apispec"
 	"s2-feature/internal/config"
@@ -38,6 +39,7 @@ type MarketDataPoint struct {
 	Low       float64 `json:"low"`
 	Close     float64 `json:"close"`
 	Volume    float64 `json:"volume"`
+	StreamID  string  `json:"stream_id,omitempty"` // 來源 Stream entry ID（血緣記錄用）
 }
 
 // ATRCalculator ATR 計算器
@@ -88,6 +90,14 @@ func (calc *ATRCalculator) GetFeatureType() string {
 	return "ATR"
 }
 
+func (calc *ATRCalculator) Version() string {
+	return "1.0.0"
+}
+
+func (calc *ATRCalculator) Params() map[string]interface{} {
+	return map[string]interface{}{"period": calc.period}
+}
+
 // RVCalculator 已實現波動率計算器
 type RVCalculator struct {
 	period int
@@ -140,19 +150,32 @@ func (calc *RVCalculator) GetFeatureType() string {
 	return "RV"
 }
 
+func (calc *RVCalculator) Version() string {
+	return "1.0.0"
+}
+
+func (calc *RVCalculator) Params() map[string]interface{} {
+	return map[string]interface{}{"period": calc.period, "annualization": 252}
+}
+
 // CorrelationCalculator 相關性計算器
 type CorrelationCalculator struct {
 	period int
 }
 
 func (calc *CorrelationCalculator) Calculate(symbol string, data []MarketDataPoint) (map[string]interface{}, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("insufficient data for correlation calculation")
+	}
+
 	// 這裡需要兩個標的的數據，暫時返回模擬數據
+	// 時間戳取自輸入 K 線（而非當下時間），確保同一輸入可重現相同結果
 	return map[string]interface{}{
 		"correlation": 0.75,
 		"symbol1":     symbol,
 		"symbol2":     "BTCUSDT",
 		"period":      calc.period,
-		"timestamp":   time.Now().UnixMilli(),
+		"timestamp":   data[len(data)-1].Timestamp,
 	}, nil
 }
 
@@ -160,10 +183,22 @@ func (calc *CorrelationCalculator) GetFeatureType() string {
 	return "CORRELATION"
 }
 
+func (calc *CorrelationCalculator) Version() string {
+	return "0.1.0"
+}
+
+func (calc *CorrelationCalculator) Params() map[string]interface{} {
+	return map[string]interface{}{"period": calc.period, "reference": "BTCUSDT"}
+}
+
 // DepthCalculator 深度特徵計算器
 type DepthCalculator struct{}
 
 func (calc *DepthCalculator) Calculate(symbol string, data []MarketDataPoint) (map[string]interface{}, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("insufficient data for depth calculation")
+	}
+
 	// 模擬深度數據
 	return map[string]interface{}{
 		"bid_depth":     1000.0,
@@ -172,7 +207,7 @@ func (calc *DepthCalculator) Calculate(symbol string, data []MarketDataPoint) (m
 		"spread":        0.5,
 		"spread_pct":    0.001,
 		"symbol":        symbol,
-		"timestamp":     time.Now().UnixMilli(),
+		"timestamp":     data[len(data)-1].Timestamp,
 	}, nil
 }
 
@@ -180,6 +215,14 @@ func (calc *DepthCalculator) GetFeatureType() string {
 	return "DEPTH"
 }
 
+func (calc *DepthCalculator) Version() string {
+	return "0.1.0"
+}
+
+func (calc *DepthCalculator) Params() map[string]interface{} {
+	return nil
+}
+
 type S2_FEATUREServer struct {
 	redisClient    *redis.RedisClient
 	arangodbClient *arangodb.ArangoDBClient
@@ -197,13 +240,36 @@ type S2_FEATUREServer struct {
 	// 計算任務管理
 	computationTasks map[string]*dao.FeatureComputation
 	taskMutex        sync.RWMutex
+	taskQueue        chan string
+	taskTTL          time.Duration
+
+	// 時點特徵庫
+	featureStore       FeatureStore
+	featureVersion     string
+	publicationLatency time.Duration
+
+	// K 線聚合：交易日起點相對 UTC 00:00 的平移
+	sessionOffset time.Duration
+
+	// 公式因子（S10 Bundle 熱載）
+	factorEngine  *FactorEngine
+	staticFactors []dao.FactorDefinition
+
+	// 資料品質與漂移監控
+	driftMonitor      *DriftMonitor
+	rulesOnlyFallback bool
+	fallbackTTL       time.Duration
+
+	// 資金費與基差（S1 /market/funding）
+	carrySource  CarrySource
+	carryTracker *CarryTracker
 }
 
 func NewS2_FEATUREServer() *S2_FEATUREServer {
 	server := &S2_FEATUREServer{
 		redisClient:        redis.GetInstance(),
 		arangodbClient:     arangodb.GetInstance(),
-		validator:          validator.New(),
+		validator:          newValidator(),
 		version:            "v1.0.0",
 		startTime:          time.Now(),
 		featureCalculators: make(map[string]FeatureCalculator),
@@ -214,12 +280,60 @@ func NewS2_FEATUREServer() *S2_FEATUREServer {
 	// 初始化特徵計算器
 	server.initializeFeatureCalculators()
 
+	// 初始化時點特徵庫
+	server.initializeFeatureStore()
+
+	// K 線聚合設定
+	if offset := config.AppConfig.Candles.SessionOffset; offset != "" {
+		if d, err := time.ParseDuration(offset); err == nil {
+			server.sessionOffset = d
+		} else {
+			log.Printf("Invalid candles.session_offset %q, using UTC 00:00: %v", offset, err)
+		}
+	}
+
+	// 載入公式因子
+	server.initializeFactors()
+
+	// 資料品質與漂移監控
+	server.initializeDriftMonitor()
+
+	// 資金費與基差來源
+	server.initializeCarry()
+
+	// 相關係數矩陣（S3 組合層預檢）
+	server.initializeCorrelationMatrix()
+
+	// 啟動重算任務 worker pool
+	server.initializeRecomputeWorkers()
+
 	// 啟動定時任務
 	go server.startScheduledTasks()
 
 	return server
 }
 
+// newValidator 建立驗證器並註冊 dao 標籤使用的自訂規則（regexp=<pattern>）
+func newValidator() *validator.Validate {
+	v := validator.New()
+
+	var patterns sync.Map
+	v.RegisterValidation("regexp", func(fl validator.FieldLevel) bool {
+		param := fl.Param()
+		re, ok := patterns.Load(param)
+		if !ok {
+			compiled, err := regexp.Compile(param)
+			if err != nil {
+				return false
+			}
+			re, _ = patterns.LoadOrStore(param, compiled)
+		}
+		return re.(*regexp.Regexp).MatchString(fl.Field().String())
+	})
+
+	return v
+}
+
 func (s *S2_FEATUREServer) HealthCheck(c *gin.Context) {
 	checks := []apispec.HealthCheck{
 		{Name: "redis", Status: apispec.HealthOK, LatencyMs: 5},
@@ -254,12 +368,13 @@ func (s *S2_FEATUREServer) ReadyCheck(c *gin.Context) {
 }
 
 // @Summary Recompute features
-// @Description Recompute features for a specific symbol
+// @Description Queue an asynchronous feature recompute job; poll /features/computation?task_id= for progress
 // @Tags features
 // @Accept json
 // @Produce json
 // @Param request body apispec.RecomputeFeaturesRequest true "Recompute request"
 // @Success 200 {object} apispec.RecomputeFeaturesResponse
+// @Failure 503 {object} map[string]string "Queue full"
 // @Router /features/recompute [post]
 func (s *S2_FEATUREServer) RecomputeFeatures(c *gin.Context) {
 	var req dao.RecomputeFeaturesRequest
@@ -274,21 +389,18 @@ func (s *S2_FEATUREServer) RecomputeFeatures(c *gin.Context) {
 		return
 	}
 
-	// 執行特徵重算
-	computed := 0
-	for _, symbol := range req.Symbols {
-		for _, window := range req.Windows {
-			if err := s.computeFeaturesForSymbol(symbol, window, req.Force); err != nil {
-				log.Printf("Failed to compute features for %s %s: %v", symbol, window, err)
-				continue
-			}
-			computed++
-		}
+	// 排入非同步任務佇列，由 worker pool 執行
+	task, err := s.enqueueRecompute(&req)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Recompute queue unavailable", "details": err.Error()})
+		return
 	}
 
 	response := dao.RecomputeFeaturesResponse{
-		Computed: computed,
-		Message:  fmt.Sprintf("Successfully computed %d feature sets", computed),
+		Accepted:         true,
+		TaskID:           task.TaskID,
+		EstimatedBatches: task.TotalUnits,
+		Message:          fmt.Sprintf("Queued %d feature sets for recompute", task.TotalUnits),
 	}
 
 	c.JSON(http.StatusOK, response)
@@ -347,11 +459,12 @@ func (s *S2_FEATUREServer) GetFeatures(c *gin.Context) {
 func (s *S2_FEATUREServer) GetComputationStatus(c *gin.Context) {
 	taskID := c.Query("task_id")
 
-	if taskID != "" {
-		s.taskMutex.RLock()
-		task, exists := s.computationTasks[taskID]
-		s.taskMutex.RUnlock()
+	if taskID == "" {
+		taskID = c.Param("id")
+	}
 
+	if taskID != "" {
+		task, exists := s.getTask(taskID)
 		if !exists {
 			c.JSON(http.StatusNotFound, gin.H{"error": "task not found"})
 			return
@@ -363,9 +476,9 @@ func (s *S2_FEATUREServer) GetComputationStatus(c *gin.Context) {
 
 	// 返回所有任務
 	s.taskMutex.RLock()
-	tasks := make([]*dao.FeatureComputation, 0, len(s.computationTasks))
+	tasks := make([]dao.FeatureComputation, 0, len(s.computationTasks))
 	for _, task := range s.computationTasks {
-		tasks = append(tasks, task)
+		tasks = append(tasks, *task)
 	}
 	s.taskMutex.RUnlock()
 
@@ -378,6 +491,17 @@ func (s *S2_FEATUREServer) initializeFeatureCalculators() {
 	s.featureCalculators["RV"] = &RVCalculator{period: 20}
 	s.featureCalculators["CORRELATION"] = &CorrelationCalculator{period: 14}
 	s.featureCalculators["DEPTH"] = &DepthCalculator{}
+
+	// 標準技術指標
+	s.featureCalculators["RSI"] = &RSICalculator{period: 14}
+	s.featureCalculators["MACD"] = &MACDCalculator{fast: 12, slow: 26, signal: 9}
+	s.featureCalculators["BBANDS"] = &BollingerCalculator{period: 20, k: 2}
+	s.featureCalculators["KELTNER"] = &KeltnerCalculator{emaPeriod: 20, atrPeriod: 10, mult: 2}
+	s.featureCalculators["ADX"] = &ADXCalculator{period: 14}
+	s.featureCalculators["OBV"] = &OBVCalculator{period: 20}
+	s.featureCalculators["VWAP"] = &VWAPCalculator{period: 20}
+	s.featureCalculators["DONCHIAN"] = &DonchianCalculator{period: 20}
+	s.featureCalculators["PATTERNS"] = &CandlePatternCalculator{}
 }
 
 // computeFeaturesForSymbol 為指定標的計算特徵
@@ -392,49 +516,53 @@ func (s *S2_FEATUREServer) computeFeaturesForSymbol(symbol, window string, force
 		s.cacheMutex.RUnlock()
 	}
 
-	// 創建計算任務
-	taskID := fmt.Sprintf("task_%s_%s_%d", symbol, window, time.Now().Unix())
-	task := &dao.FeatureComputation{
-		TaskID:      taskID,
-		Symbol:      symbol,
-		FeatureType: "ALL",
-		FromMs:      time.Now().Add(-24 * time.Hour).UnixMilli(),
-		ToMs:        time.Now().UnixMilli(),
-		Status:      "RUNNING",
-		Progress:    0.0,
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
+	// 計算器與多時框特徵：純由截至 toMs 的 K 線決定，可依血緣重算驗證
+	toMs, err := lastClosedBaseMs(window, time.Now().UnixMilli())
+	if err != nil {
+		return err
+	}
+	marketData, features, inputs, err := s.deriveFeatures(symbol, window, toMs)
+	if err != nil {
+		return err
 	}
 
-	s.taskMutex.Lock()
-	s.computationTasks[taskID] = task
-	s.taskMutex.Unlock()
+	// 血緣與內容雜湊（須在加入有狀態的公式因子之前計算）
+	lineage, err := s.buildLineage(window, toMs, inputs, features)
+	if err != nil {
+		log.Printf("Failed to build lineage for %s %s: %v", symbol, window, err)
+	}
 
-	// 獲取市場數據（模擬）
-	marketData := s.getMarketData(symbol, window)
+	// 資金費與基差（S1 即時快照，無法重算；由快照雜湊涵蓋）
+	carry, funding, err := s.computeCarryFeatures(symbol)
+	if err != nil {
+		log.Printf("Failed to calculate CARRY for %s: %v", symbol, err)
+	} else if carry != nil {
+		features["CARRY"] = carry
+		flattenCarryFeatures(features, carry)
+	}
 
-	// 計算各種特徵
-	features := make(map[string]interface{})
+	// 公式因子（增量求值，可引用上方已計算的特徵）
+	if factors := s.factorEngine.Evaluate(symbol, window, marketData, features); len(factors) > 0 {
+		features["FACTORS"] = factors
+	}
 
-	for featureType, calculator := range s.featureCalculators {
-		result, err := calculator.Calculate(symbol, marketData)
-		if err != nil {
-			log.Printf("Failed to calculate %s for %s: %v", featureType, symbol, err)
-			continue
+	// 快照雜湊：涵蓋 CARRY、FACTORS 與扁平 carry 鍵，連同資金費輸入與公式版本
+	if lineage != nil {
+		if err := sealLineage(lineage, features, funding); err != nil {
+			log.Printf("Failed to hash feature snapshot for %s %s: %v", symbol, window, err)
 		}
-		features[featureType] = result
 	}
 
-	// 更新任務狀態
-	task.Status = "COMPLETED"
-	task.Progress = 100.0
-	task.UpdatedAt = time.Now()
+	// 資料品質與漂移檢查
+	dqc := s.checkFeatureQuality(symbol, window, marketData, features)
 
 	// 保存特徵快照
 	snapshot := &dao.FeatureSetSnapshot{
-		SetID:     fmt.Sprintf("set_%s_%d", symbol, time.Now().Unix()),
+		SetID:     fmt.Sprintf("set_%s_%s_%d", symbol, window, time.Now().Unix()),
 		Symbol:    symbol,
 		Features:  features,
+		DQC:       dqc,
+		Lineage:   lineage,
 		Timestamp: time.Now().UnixMilli(),
 		CreatedAt: time.Now(),
 	}
@@ -443,29 +571,81 @@ func (s *S2_FEATUREServer) computeFeaturesForSymbol(symbol, window string, force
 	s.featureCache[symbol] = snapshot
 	s.cacheMutex.Unlock()
 
+	// 寫入時點特徵庫（as-of 查詢用）
+	if err := s.recordFeatures(window, marketData, snapshot); err != nil {
+		log.Printf("Failed to record features for %s %s: %v", symbol, window, err)
+	}
+
 	// 發布到 Redis
 	s.publishFeaturesToRedis(snapshot)
 
 	return nil
 }
 
-// getMarketData 獲取市場數據（模擬）
-func (s *S2_FEATUREServer) getMarketData(symbol, window string) []MarketDataPoint {
-	// 模擬生成 K 線數據
-	data := make([]MarketDataPoint, 0, 100)
+// getMarketData 獲取指定週期截至 toMs 的 K 線：先取基礎週期 K 線，再聚合為目標週期
+// toMs 須對齊基礎週期（見 lastClosedBaseMs）；同時回傳輸入範圍供血緣記錄
+func (s *S2_FEATUREServer) getMarketData(symbol, window string, toMs int64) ([]MarketDataPoint, dao.LineageInput, error) {
+	input := dao.LineageInput{Timeframe: window, Stream: candleStream(symbol), ToMs: toMs}
+
+	targetDur, err := windowDuration(window)
+	if err != nil {
+		return nil, input, err
+	}
+	baseTF := baseTimeframeFor(window)
+	input.BaseTimeframe = baseTF
+
+	// 多取一個目標週期以補齊首桶
+	input.FromMs = toMs - int64(marketDataBars+1)*targetDur.Milliseconds()
+
+	base := s.fetchBaseCandles(symbol, baseTF, input.FromMs, toMs)
+	input.BaseBars = len(base)
+	if len(base) > 0 {
+		input.FirstStreamID = base[0].StreamID
+		input.LastStreamID = base[len(base)-1].StreamID
+	}
+
+	candles, err := ResampleCandles(base, baseTF, window, s.sessionOffset)
+	if err != nil {
+		return nil, input, fmt.Errorf("failed to resample %s %s -> %s: %w", symbol, baseTF, window, err)
+	}
+
+	if len(candles) > marketDataBars {
+		candles = candles[len(candles)-marketDataBars:]
+	}
+	input.Bars = len(candles)
+	if len(candles) > 0 {
+		input.FirstBarMs = candles[0].Timestamp
+		input.LastBarMs = candles[len(candles)-1].Timestamp
+	}
+
+	return candles, input, nil
+}
+
+// fetchBaseCandles 獲取 [fromMs, toMs) 區間的基礎週期 K 線（模擬；時間戳為開盤時間）
+// 模擬資料的 StreamID 以收盤時間產生，與 S1 於收盤時 XADD 的自動 ID 格式一致
+func (s *S2_FEATUREServer) fetchBaseCandles(symbol, baseTF string, fromMs, toMs int64) []MarketDataPoint {
+	baseDur, err := windowDuration(baseTF)
+	if err != nil {
+		return nil
+	}
+	stepMs := baseDur.Milliseconds()
+	start := fromMs - fromMs%stepMs
+
+	data := make([]MarketDataPoint, 0, (toMs-start)/stepMs+1)
 	basePrice := 50000.0
 
-	for i := 0; i < 100; i++ {
-		timestamp := time.Now().Add(-time.Duration(100-i) * time.Minute).UnixMilli()
-		price := basePrice + float64(i)*10 + math.Sin(float64(i)*0.1)*100
+	for ts := start; ts+stepMs <= toMs; ts += stepMs {
+		minute := float64(ts / time.Minute.Milliseconds())
+		price := basePrice + math.Sin(minute/1440)*2000 + math.Sin(minute*0.1)*100
 
 		data = append(data, MarketDataPoint{
-			Timestamp: timestamp,
+			Timestamp: ts,
 			Open:      price,
 			High:      price + 50,
 			Low:       price - 50,
 			Close:     price + 25,
 			Volume:    1000.0,
+			StreamID:  fmt.Sprintf("%d-0", ts+stepMs),
 		})
 	}
 
@@ -537,6 +717,16 @@ func main() {
 	r.POST("/features/recompute", server.RecomputeFeatures)
 	r.GET("/features", server.GetFeatures)
 	r.GET("/features/computation", server.GetComputationStatus)
+	r.GET("/features/computation/:id", server.GetComputationStatus)
+	r.DELETE("/features/computation/:id", server.CancelComputation)
+	r.GET("/features/asof", server.GetFeaturesAsOf)
+	r.GET("/features/export", server.ExportFeatures)
+	r.GET("/features/drift", server.GetFeatureDrift)
+	r.GET("/features/lineage/:set_id", server.GetFeatureLineage)
+
+	// 公式因子
+	r.GET("/factors", server.GetFactors)
+	r.POST("/factors/validate", server.ValidateFactor)
 
 	// Use configuration port, fallback to environment variable or default
 	port := os.Getenv("PORT")
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"s2-feature/dao"
+	"s2-feature/internal/compute"
+)
+
+// 多時框趨勢判定參數
+const (
+	mtfFastEMA = 20
+	mtfSlowEMA = 50
+	mtfVersion = "1.0.0" // 判定規則或權重變更時遞增（特徵血緣記錄用）
+)
+
+// mtfWeights 各週期在一致性評分中的權重（高週期權重較大）
+var mtfWeights = map[string]float64{
+	"1m": 1,
+	"5m": 1,
+	"1h": 2,
+	"4h": 3,
+	"1d": 4,
+}
+
+// trendDirection 單一週期趨勢方向：
+// +1：收盤 > 慢線 且 快線 > 慢線；-1：收盤 < 慢線 且 快線 < 慢線；其餘 0
+func trendDirection(candles []MarketDataPoint) (int, error) {
+	if len(candles) < mtfSlowEMA {
+		return 0, fmt.Errorf("insufficient data for trend: %d < %d", len(candles), mtfSlowEMA)
+	}
+
+	closes := make([]float64, len(candles))
+	for i, c := range candles {
+		closes[i] = c.Close
+	}
+
+	fast := compute.Last(compute.EMA(closes, mtfFastEMA))
+	slow := compute.Last(compute.EMA(closes, mtfSlowEMA))
+	last := closes[len(closes)-1]
+
+	switch {
+	case last > slow && fast > slow:
+		return 1, nil
+	case last < slow && fast < slow:
+		return -1, nil
+	}
+	return 0, nil
+}
+
+// MultiTimeframeFeatures 以 anchor 週期為主，計算多時框一致性特徵
+//
+//   - trend_<tf>：各週期趨勢方向 -1/0/+1
+//   - mtf_alignment_score：加權平均趨勢方向 ∈ [-1, 1]
+//   - mtf_agree_ratio：非零趨勢週期中與 anchor 同向的比例
+//   - htf_trend：anchor 上一級週期的趨勢方向
+//   - htf_veto_long / htf_veto_short：任一更高週期反向時否決同向進場（EW 文件 Anchor TF 守門）
+//
+// series 需已過濾至 anchor 最後收盤時間之前（見 computeMultiTimeframeFeatures）
+func MultiTimeframeFeatures(anchor string, series map[string][]MarketDataPoint) (map[string]interface{}, error) {
+	anchorIdx := -1
+	for i, tf := range supportedWindows {
+		if tf == anchor {
+			anchorIdx = i
+		}
+	}
+	if anchorIdx < 0 {
+		return nil, fmt.Errorf("unsupported anchor timeframe: %s", anchor)
+	}
+
+	anchorTrend, err := trendDirection(series[anchor])
+	if err != nil {
+		return nil, fmt.Errorf("anchor %s: %w", anchor, err)
+	}
+
+	result := map[string]interface{}{
+		"anchor_tf": anchor,
+	}
+
+	weighted, totalWeight := 0.0, 0.0
+	agree, directional := 0, 0
+	vetoLong, vetoShort := false, false
+	htfTrend := 0
+
+	for i, tf := range supportedWindows {
+		trend, err := trendDirection(series[tf])
+		if err != nil {
+			// 資料不足的週期不參與評分
+			continue
+		}
+		result["trend_"+tf] = trend
+
+		weighted += mtfWeights[tf] * float64(trend)
+		totalWeight += mtfWeights[tf]
+
+		if trend != 0 {
+			directional++
+			if trend == anchorTrend {
+				agree++
+			}
+		}
+
+		if i > anchorIdx {
+			if i == anchorIdx+1 {
+				htfTrend = trend
+			}
+			if trend < 0 {
+				vetoLong = true
+			}
+			if trend > 0 {
+				vetoShort = true
+			}
+		}
+	}
+
+	score := 0.0
+	if totalWeight > 0 {
+		score = weighted / totalWeight
+	}
+	agreeRatio := 0.0
+	if directional > 0 {
+		agreeRatio = float64(agree) / float64(directional)
+	}
+
+	result["mtf_alignment_score"] = math.Round(score*1e6) / 1e6
+	result["mtf_agree_ratio"] = agreeRatio
+	result["htf_trend"] = htfTrend
+	result["htf_veto_long"] = vetoLong
+	result["htf_veto_short"] = vetoShort
+
+	return result, nil
+}
+
+// computeMultiTimeframeFeatures 取各週期截至 toMs 的 K 線並計算多時框特徵，並回傳其他週期的輸入範圍
+// 其他週期只保留收盤時間 <= anchor 最後收盤時間的 K 線，避免高週期洩漏未來
+func (s *S2_FEATUREServer) computeMultiTimeframeFeatures(symbol, anchor string, anchorData []MarketDataPoint, toMs int64) (map[string]interface{}, []dao.LineageInput, error) {
+	if len(anchorData) == 0 {
+		return nil, nil, fmt.Errorf("no anchor data")
+	}
+	anchorDur, err := windowDuration(anchor)
+	if err != nil {
+		return nil, nil, err
+	}
+	cutoffMs := anchorData[len(anchorData)-1].Timestamp + anchorDur.Milliseconds()
+
+	series := map[string][]MarketDataPoint{anchor: anchorData}
+	inputs := make([]dao.LineageInput, 0, len(supportedWindows)-1)
+	for _, tf := range supportedWindows {
+		if tf == anchor {
+			continue
+		}
+		tfDur, _ := windowDuration(tf)
+		candles, input, err := s.getMarketData(symbol, tf, toMs)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", tf, err)
+		}
+		end := len(candles)
+		for end > 0 && candles[end-1].Timestamp+tfDur.Milliseconds() > cutoffMs {
+			end--
+		}
+		series[tf] = candles[:end]
+		inputs = append(inputs, input)
+	}
+
+	features, err := MultiTimeframeFeatures(anchor, series)
+	return features, inputs, err
+}
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"s2-feature/dao"
+	"s2-feature/internal/config"
+	"time"
+
+	driver "github.com/arangodb/go-driver"
+	"github.com/gin-gonic/gin"
+)
+
+// 預設值（env.yaml recompute 區塊未設定時使用）
+const (
+	defaultRecomputeWorkers   = 2
+	defaultRecomputeQueueSize = 100
+	defaultTaskTTL            = 24 * time.Hour
+	taskCleanupInterval       = 10 * time.Minute
+	computationCollection     = "feature_computations"
+)
+
+// computationDone 任務是否已結束
+func computationDone(status string) bool {
+	switch status {
+	case dao.ComputationCompleted, dao.ComputationFailed, dao.ComputationCancelled:
+		return true
+	}
+	return false
+}
+
+// initializeRecomputeWorkers 初始化重算任務佇列與 worker pool
+func (s *S2_FEATUREServer) initializeRecomputeWorkers() {
+	cfg := config.AppConfig.Recompute
+
+	workers := cfg.Workers
+	if workers <= 0 {
+		workers = defaultRecomputeWorkers
+	}
+	queueSize := cfg.QueueSize
+	if queueSize <= 0 {
+		queueSize = defaultRecomputeQueueSize
+	}
+	s.taskTTL = defaultTaskTTL
+	if cfg.TaskTTL != "" {
+		if ttl, err := time.ParseDuration(cfg.TaskTTL); err == nil {
+			s.taskTTL = ttl
+		} else {
+			log.Printf("Invalid recompute.task_ttl %q, using %s: %v", cfg.TaskTTL, defaultTaskTTL, err)
+		}
+	}
+
+	s.taskQueue = make(chan string, queueSize)
+
+	if s.arangodbClient != nil {
+		if err := s.ensureComputationCollection(); err != nil {
+			log.Printf("Failed to prepare %s collection: %v", computationCollection, err)
+		} else {
+			s.recoverInterruptedTasks()
+		}
+	}
+
+	for i := 0; i < workers; i++ {
+		go s.recomputeWorker(i)
+	}
+	go s.cleanupExpiredTasks()
+}
+
+// enqueueRecompute 建立任務並排入佇列；佇列已滿時回傳錯誤
+func (s *S2_FEATUREServer) enqueueRecompute(req *dao.RecomputeFeaturesRequest) (*dao.FeatureComputation, error) {
+	now := time.Now()
+	task := &dao.FeatureComputation{
+		TaskID:      fmt.Sprintf("recomp-%s-%d", now.Format("20060102"), now.UnixNano()),
+		Symbol:      req.Symbols[0],
+		Symbols:     req.Symbols,
+		Windows:     req.Windows,
+		Force:       req.Force,
+		FeatureType: "ALL",
+		ToMs:        now.UnixMilli(),
+		Status:      dao.ComputationPending,
+		TotalUnits:  len(req.Symbols) * len(req.Windows),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	s.taskMutex.Lock()
+	s.computationTasks[task.TaskID] = task
+	s.taskMutex.Unlock()
+
+	select {
+	case s.taskQueue <- task.TaskID:
+	default:
+		s.taskMutex.Lock()
+		delete(s.computationTasks, task.TaskID)
+		s.taskMutex.Unlock()
+		return nil, fmt.Errorf("recompute queue is full (%d pending)", cap(s.taskQueue))
+	}
+
+	s.persistTask(task.TaskID)
+
+	snapshot := *task
+	return &snapshot, nil
+}
+
+// recomputeWorker 自佇列取出任務並逐一計算 symbol × window
+// 取消以任務狀態為準：每個 symbol × window 單元開始前檢查，已取消則停止
+func (s *S2_FEATUREServer) recomputeWorker(id int) {
+	for taskID := range s.taskQueue {
+		s.runRecomputeTask(taskID)
+	}
+	log.Printf("Recompute worker %d stopped", id)
+}
+
+func (s *S2_FEATUREServer) runRecomputeTask(taskID string) {
+	var symbols, windows []string
+	var force bool
+	if !s.updateTask(taskID, func(t *dao.FeatureComputation) bool {
+		// 佇列中已被取消的任務直接略過
+		if t.Status != dao.ComputationPending {
+			return false
+		}
+		t.Status = dao.ComputationRunning
+		symbols, windows, force = t.Symbols, t.Windows, t.Force
+		return true
+	}) {
+		return
+	}
+
+	for _, symbol := range symbols {
+		for _, window := range windows {
+			if s.taskCancelled(taskID) {
+				return
+			}
+
+			err := s.computeFeaturesForSymbol(symbol, window, force)
+			if err != nil {
+				log.Printf("Task %s failed to compute features for %s %s: %v", taskID, symbol, window, err)
+			}
+
+			s.updateTask(taskID, func(t *dao.FeatureComputation) bool {
+				if t.Status != dao.ComputationRunning {
+					return false
+				}
+				t.DoneUnits++
+				if err != nil {
+					t.FailedUnits++
+					t.ErrorMsg = fmt.Sprintf("%s %s: %v", symbol, window, err)
+				}
+				t.Progress = float64(t.DoneUnits) / float64(t.TotalUnits) * 100
+				return true
+			})
+		}
+	}
+
+	s.updateTask(taskID, func(t *dao.FeatureComputation) bool {
+		if t.Status != dao.ComputationRunning {
+			return false
+		}
+		t.Status = dao.ComputationCompleted
+		if t.FailedUnits == t.TotalUnits {
+			t.Status = dao.ComputationFailed
+		}
+		t.Progress = 100.0
+		return true
+	})
+}
+
+// taskCancelled 任務是否已被取消
+func (s *S2_FEATUREServer) taskCancelled(taskID string) bool {
+	s.taskMutex.RLock()
+	defer s.taskMutex.RUnlock()
+	task, exists := s.computationTasks[taskID]
+	return !exists || task.Status == dao.ComputationCancelled
+}
+
+// updateTask 在鎖內修改任務；mutate 回傳 false 表示不變更。變更後同步寫入 ArangoDB
+func (s *S2_FEATUREServer) updateTask(taskID string, mutate func(t *dao.FeatureComputation) bool) bool {
+	s.taskMutex.Lock()
+	task, exists := s.computationTasks[taskID]
+	if !exists || !mutate(task) {
+		s.taskMutex.Unlock()
+		return false
+	}
+	task.UpdatedAt = time.Now()
+	s.taskMutex.Unlock()
+
+	s.persistTask(taskID)
+	return true
+}
+
+// getTask 取得任務副本（內存優先，其次 ArangoDB）
+func (s *S2_FEATUREServer) getTask(taskID string) (*dao.FeatureComputation, bool) {
+	s.taskMutex.RLock()
+	task, exists := s.computationTasks[taskID]
+	if exists {
+		snapshot := *task
+		s.taskMutex.RUnlock()
+		return &snapshot, true
+	}
+	s.taskMutex.RUnlock()
+
+	if s.arangodbClient == nil {
+		return nil, false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	col, err := s.arangodbClient.GetDB().Collection(ctx, computationCollection)
+	if err != nil {
+		return nil, false
+	}
+	var stored dao.FeatureComputation
+	if _, err := col.ReadDocument(ctx, taskID, &stored); err != nil {
+		return nil, false
+	}
+	return &stored, true
+}
+
+// @Summary Cancel computation task
+// @Description Cancel a pending or running feature computation task
+// @Tags features
+// @Accept json
+// @Produce json
+// @Param id path string true "Task ID"
+// @Success 200 {object} dao.FeatureComputation
+// @Router /features/computation/{id} [delete]
+func (s *S2_FEATUREServer) CancelComputation(c *gin.Context) {
+	taskID := c.Param("id")
+
+	var current dao.FeatureComputation
+	cancelled := s.updateTask(taskID, func(t *dao.FeatureComputation) bool {
+		current = *t
+		if computationDone(t.Status) {
+			return false
+		}
+		t.Status = dao.ComputationCancelled
+		t.ErrorMsg = "cancelled by request"
+		current = *t
+		return true
+	})
+
+	if current.TaskID == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "task not found"})
+		return
+	}
+	if !cancelled {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("task already %s", current.Status)})
+		return
+	}
+
+	c.JSON(http.StatusOK, current)
+}
+
+// cleanupExpiredTasks 定期清除已結束且超過 TTL 的任務（ArangoDB 端由 TTL index 清除）
+func (s *S2_FEATUREServer) cleanupExpiredTasks() {
+	ticker := time.NewTicker(taskCleanupInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		cutoff := time.Now().Add(-s.taskTTL)
+
+		s.taskMutex.Lock()
+		removed := 0
+		for id, task := range s.computationTasks {
+			if computationDone(task.Status) && task.UpdatedAt.Before(cutoff) {
+				delete(s.computationTasks, id)
+				removed++
+			}
+		}
+		s.taskMutex.Unlock()
+
+		if removed > 0 {
+			log.Printf("Cleaned up %d expired computation tasks", removed)
+		}
+	}
+}
+
+// ensureComputationCollection 建立任務集合與 TTL index
+func (s *S2_FEATUREServer) ensureComputationCollection() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	db := s.arangodbClient.GetDB()
+	exists, err := db.CollectionExists(ctx, computationCollection)
+	if err != nil {
+		return err
+	}
+
+	var col driver.Collection
+	if exists {
+		col, err = db.Collection(ctx, computationCollection)
+	} else {
+		col, err = db.CreateCollection(ctx, computationCollection, nil)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, _, err = col.EnsureTTLIndex(ctx, "updated_at", int(s.taskTTL.Seconds()), &driver.EnsureTTLIndexOptions{Name: "idx_ttl_updated_at"})
+	return err
+}
+
+// persistTask 將任務狀態寫入 ArangoDB（以 task_id 為 _key upsert）
+func (s *S2_FEATUREServer) persistTask(taskID string) {
+	if s.arangodbClient == nil {
+		return
+	}
+
+	s.taskMutex.RLock()
+	task, exists := s.computationTasks[taskID]
+	if !exists {
+		s.taskMutex.RUnlock()
+		return
+	}
+	snapshot := *task
+	s.taskMutex.RUnlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query := `UPSERT { _key: @key } INSERT MERGE(@doc, { _key: @key }) REPLACE MERGE(@doc, { _key: @key }) IN @@col`
+	bindVars := map[string]interface{}{
+		"@col": computationCollection,
+		"key":  snapshot.TaskID,
+		"doc":  snapshot,
+	}
+	cursor, err := s.arangodbClient.GetDB().Query(ctx, query, bindVars)
+	if err != nil {
+		log.Printf("Failed to persist computation task %s: %v", taskID, err)
+		return
+	}
+	cursor.Close()
+}
+
+// recoverInterruptedTasks 將上次行程中斷時仍在佇列/執行中的任務標記為 FAILED
+func (s *S2_FEATUREServer) recoverInterruptedTasks() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	query := `FOR t IN @@col
+		FILTER t.status IN [@pending, @running]
+		UPDATE t WITH { status: @failed, error_msg: "interrupted by service restart", updated_at: @now } IN @@col
+		RETURN NEW.task_id`
+	bindVars := map[string]interface{}{
+		"@col":    computationCollection,
+		"pending": dao.ComputationPending,
+		"running": dao.ComputationRunning,
+		"failed":  dao.ComputationFailed,
+		"now":     time.Now(),
+	}
+	cursor, err := s.arangodbClient.GetDB().Query(ctx, query, bindVars)
+	if err != nil {
+		log.Printf("Failed to recover interrupted computation tasks: %v", err)
+		return
+	}
+	defer cursor.Close()
+
+	recovered := 0
+	for cursor.HasMore() {
+		var id string
+		if _, err := cursor.ReadDocument(ctx, &id); err != nil {
+			break
+		}
+		recovered++
+	}
+	if recovered > 0 {
+		log.Printf("Marked %d interrupted computation tasks as FAILED", recovered)
+	}
+}
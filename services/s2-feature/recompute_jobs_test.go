@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"s2-feature/dao"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecomputeJob_CompletesWithProgress(t *testing.T) {
+	server := NewS2_FEATUREServer()
+
+	task, err := server.enqueueRecompute(&dao.RecomputeFeaturesRequest{
+		Symbols: []string{"BTCUSDT", "ETHUSDT"},
+		Windows: []string{"1h", "4h"},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, dao.ComputationPending, task.Status)
+	assert.Equal(t, 4, task.TotalUnits)
+
+	// 等待 worker 完成
+	var current *dao.FeatureComputation
+	assert.Eventually(t, func() bool {
+		current, _ = server.getTask(task.TaskID)
+		return current != nil && computationDone(current.Status)
+	}, 5*time.Second, 10*time.Millisecond)
+
+	if assert.NotNil(t, current) {
+		assert.Equal(t, dao.ComputationCompleted, current.Status)
+		assert.Equal(t, 4, current.DoneUnits)
+		assert.Equal(t, 100.0, current.Progress)
+	}
+}
+
+func TestCancelComputation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server := NewS2_FEATUREServer()
+
+	// 直接放入任務表，不經佇列，避免 worker 搶先執行
+	server.computationTasks["pending-task"] = &dao.FeatureComputation{TaskID: "pending-task", Status: dao.ComputationPending}
+	server.computationTasks["done-task"] = &dao.FeatureComputation{TaskID: "done-task", Status: dao.ComputationCompleted}
+
+	r := gin.New()
+	r.DELETE("/features/computation/:id", server.CancelComputation)
+
+	tests := []struct {
+		name           string
+		taskID         string
+		expectedStatus int
+	}{
+		{name: "cancel pending task", taskID: "pending-task", expectedStatus: http.StatusOK},
+		{name: "cancel twice", taskID: "pending-task", expectedStatus: http.StatusConflict},
+		{name: "already completed", taskID: "done-task", expectedStatus: http.StatusConflict},
+		{name: "unknown task", taskID: "missing", expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("DELETE", "/features/computation/"+tt.taskID, nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+
+	// 已取消的任務即使被 worker 取出也不會執行
+	server.runRecomputeTask("pending-task")
+	task, _ := server.getTask("pending-task")
+	assert.Equal(t, dao.ComputationCancelled, task.Status)
+	assert.Equal(t, 0, task.DoneUnits)
+}
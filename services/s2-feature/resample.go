@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// marketDataBars 每個週期供特徵計算的 K 線根數
+const marketDataBars = 100
+
+// ResampleCandles 將基礎週期 K 線聚合為目標週期 K 線
+//
+// 邊界：桶起點 = floor((open_time - offset) / 週期) × 週期 + offset，
+// offset 為交易日起點相對 UTC 00:00 的平移（加密貨幣為 0；1d/4h 皆以此對齊）。
+// 只輸出「已收盤」的桶：桶結束時間必須 <= 最後一根基礎 K 線的收盤時間，未完成的桶不輸出以避免未來洩漏；
+// 起點早於第一根基礎 K 線的首桶資料不完整，同樣丟棄。
+// 桶內基礎 K 線缺漏時仍以現有資料聚合（O=首根開盤、H/L=極值、C=末根收盤、V=加總）。
+func ResampleCandles(base []MarketDataPoint, baseTF, targetTF string, sessionOffset time.Duration) ([]MarketDataPoint, error) {
+	baseDur, err := windowDuration(baseTF)
+	if err != nil {
+		return nil, err
+	}
+	targetDur, err := windowDuration(targetTF)
+	if err != nil {
+		return nil, err
+	}
+	if targetDur < baseDur || targetDur%baseDur != 0 {
+		return nil, fmt.Errorf("cannot resample %s into %s", baseTF, targetTF)
+	}
+	if len(base) == 0 {
+		return nil, nil
+	}
+
+	baseMs := baseDur.Milliseconds()
+	targetMs := targetDur.Milliseconds()
+	offsetMs := sessionOffset.Milliseconds()
+	lastCloseMs := base[len(base)-1].Timestamp + baseMs
+
+	bucketStart := func(ts int64) int64 {
+		shifted := ts - offsetMs
+		start := shifted - shifted%targetMs
+		if shifted%targetMs < 0 {
+			start -= targetMs
+		}
+		return start + offsetMs
+	}
+
+	result := make([]MarketDataPoint, 0, len(base)*int(baseMs)/int(targetMs)+1)
+	var current *MarketDataPoint
+	for i := range base {
+		bar := base[i]
+		if i > 0 && bar.Timestamp <= base[i-1].Timestamp {
+			return nil, fmt.Errorf("base candles must be strictly increasing in time (index %d)", i)
+		}
+
+		start := bucketStart(bar.Timestamp)
+		if current == nil || current.Timestamp != start {
+			if current != nil && current.Timestamp >= base[0].Timestamp {
+				result = append(result, *current)
+			}
+			current = &MarketDataPoint{
+				Timestamp: start,
+				Open:      bar.Open,
+				High:      bar.High,
+				Low:       bar.Low,
+				Close:     bar.Close,
+				Volume:    bar.Volume,
+			}
+			continue
+		}
+
+		current.High = math.Max(current.High, bar.High)
+		current.Low = math.Min(current.Low, bar.Low)
+		current.Close = bar.Close
+		current.Volume += bar.Volume
+	}
+
+	// 最後一桶僅在完整收盤後輸出
+	if current != nil && current.Timestamp >= base[0].Timestamp && current.Timestamp+targetMs <= lastCloseMs {
+		result = append(result, *current)
+	}
+
+	return result, nil
+}
+
+// baseTimeframeFor 取得目標週期聚合所用的基礎週期
+func baseTimeframeFor(window string) string {
+	switch window {
+	case "1m", "5m":
+		return "1m"
+	default:
+		return "1h"
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func makeCandles(startMs, stepMs int64, closes []float64) []MarketDataPoint {
+	data := make([]MarketDataPoint, len(closes))
+	for i, c := range closes {
+		data[i] = MarketDataPoint{
+			Timestamp: startMs + int64(i)*stepMs,
+			Open:      c - 1,
+			High:      c + 2,
+			Low:       c - 2,
+			Close:     c,
+			Volume:    1,
+		}
+	}
+	return data
+}
+
+func TestResampleCandles_DropsIncompleteBucket(t *testing.T) {
+	minute := time.Minute.Milliseconds()
+	// 12 根 1m：00:00~00:11，只有 00:00 與 00:05 兩桶完整
+	base := makeCandles(0, minute, []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12})
+
+	bars, err := ResampleCandles(base, "1m", "5m", 0)
+	assert.NoError(t, err)
+	if !assert.Len(t, bars, 2) {
+		return
+	}
+
+	assert.Equal(t, int64(0), bars[0].Timestamp)
+	assert.Equal(t, 0.0, bars[0].Open)
+	assert.Equal(t, 7.0, bars[0].High)
+	assert.Equal(t, -1.0, bars[0].Low)
+	assert.Equal(t, 5.0, bars[0].Close)
+	assert.Equal(t, 5.0, bars[0].Volume)
+
+	assert.Equal(t, 5*minute, bars[1].Timestamp)
+	assert.Equal(t, 10.0, bars[1].Close)
+}
+
+func TestResampleCandles_SessionOffset(t *testing.T) {
+	hour := time.Hour.Milliseconds()
+	closes := make([]float64, 48)
+	for i := range closes {
+		closes[i] = float64(i)
+	}
+	base := makeCandles(0, hour, closes)
+
+	// UTC 00:00 對齊：兩根完整日線
+	bars, err := ResampleCandles(base, "1h", "1d", 0)
+	assert.NoError(t, err)
+	if assert.Len(t, bars, 2) {
+		assert.Equal(t, 23.0, bars[0].Close)
+		assert.Equal(t, 47.0, bars[1].Close)
+	}
+
+	// 交易日自 UTC 08:00 起：00:00~07:00 屬前一交易日（不完整，不輸出），08:00~次日 07:00 為完整一根
+	bars, err = ResampleCandles(base, "1h", "1d", 8*time.Hour)
+	assert.NoError(t, err)
+	if assert.Len(t, bars, 1) {
+		assert.Equal(t, 8*hour, bars[0].Timestamp)
+		assert.Equal(t, 7.0, bars[0].Open)
+		assert.Equal(t, 31.0, bars[0].Close)
+	}
+}
+
+func TestResampleCandles_InvalidInput(t *testing.T) {
+	_, err := ResampleCandles(nil, "1h", "5m", 0)
+	assert.Error(t, err)
+
+	minute := time.Minute.Milliseconds()
+	unordered := []MarketDataPoint{{Timestamp: minute}, {Timestamp: 0}}
+	_, err = ResampleCandles(unordered, "1m", "5m", 0)
+	assert.Error(t, err)
+}
+
+func TestMultiTimeframeFeatures_HTFVeto(t *testing.T) {
+	up := make([]float64, 60)
+	down := make([]float64, 60)
+	for i := range up {
+		up[i] = 100 + float64(i)
+		down[i] = 200 - float64(i)
+	}
+
+	series := map[string][]MarketDataPoint{
+		"1h": makeCandles(0, time.Hour.Milliseconds(), up),
+		"4h": makeCandles(0, 4*time.Hour.Milliseconds(), up),
+		"1d": makeCandles(0, 24*time.Hour.Milliseconds(), down),
+	}
+
+	features, err := MultiTimeframeFeatures("4h", series)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, features["trend_4h"])
+	assert.Equal(t, -1, features["trend_1d"])
+	assert.Equal(t, -1, features["htf_trend"])
+	assert.Equal(t, true, features["htf_veto_long"])
+	assert.Equal(t, false, features["htf_veto_short"])
+	// (2×1 + 3×1 + 4×-1) / 9
+	assert.InDelta(t, 1.0/9.0, features["mtf_alignment_score"], 1e-6)
+	assert.InDelta(t, 2.0/3.0, features["mtf_agree_ratio"], 1e-9)
+}
@@ -1,9 +1,10 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
-	"strings"
 	"testing"
 
 	"s2-feature/dao"
@@ -63,7 +64,7 @@ func TestRecomputeFeatures_Validation(t *testing.T) {
 		{
 			name: "symbol too short",
 			request: dao.RecomputeFeaturesRequest{
-				Symbols: []string{"BTC"}, // 少於 3 個字符
+				Symbols: []string{"BT"}, // 少於 3 個字符
 				Windows: []string{"1h"},
 				Force:   false,
 			},
@@ -109,8 +110,11 @@ func TestRecomputeFeatures_Validation(t *testing.T) {
 			r.POST("/features/recompute", server.RecomputeFeatures)
 
 			// 準備請求
-			reqBody := `{"symbols":["BTCUSDT"],"windows":["1h"],"force":false}`
-			req := httptest.NewRequest("POST", "/features/recompute", strings.NewReader(reqBody))
+			reqBody, err := json.Marshal(tt.request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req := httptest.NewRequest("POST", "/features/recompute", bytes.NewReader(reqBody))
 			req.Header.Set("Content-Type", "application/json")
 
 			// 執行請求
@@ -175,8 +179,11 @@ func TestRecomputeFeatures_EdgeCases(t *testing.T) {
 			r.POST("/features/recompute", server.RecomputeFeatures)
 
 			// 準備請求
-			reqBody := `{"symbols":["BTCUSDT"],"windows":["1h"],"force":false}`
-			req := httptest.NewRequest("POST", "/features/recompute", strings.NewReader(reqBody))
+			reqBody, err := json.Marshal(tt.request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req := httptest.NewRequest("POST", "/features/recompute", bytes.NewReader(reqBody))
 			req.Header.Set("Content-Type", "application/json")
 
 			// 執行請求
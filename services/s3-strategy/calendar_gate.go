@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"s3-strategy/dao"
+	"s3-strategy/internal/calendar"
+	"time"
+)
+
+const (
+	gateCalendar   = "calendar"
+	reasonCalendar = "calendar"
+)
+
+// compileCalendar 解析 Bundle 的 calendar；未設定時為 nil（全天可交易、無停止交易事件）
+func compileCalendar(raw json.RawMessage) (*calendar.Calendar, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	return calendar.Parse(raw)
+}
+
+// CheckCalendar L0 交易時段與停止交易事件（依策略套用覆寫）；未通過時只擋進場，既有持倉照常出場。cal 為 nil 時不檢查
+func (gk *GateKeeper) CheckCalendar(cal *calendar.Calendar, strategyName, symbol string, at time.Time) (bool, string, *dao.GateTrace) {
+	if cal == nil {
+		return true, "", nil
+	}
+	trace := &dao.GateTrace{Gate: gateCalendar, Passed: true}
+	block, blocked := cal.Check(strategyName, symbol, at)
+	if !blocked {
+		return true, "", trace
+	}
+	reason := fmt.Sprintf("%s: %s", reasonCalendar, block)
+	trace.Passed, trace.Note = false, reason
+	return false, reason, trace
+}
+
+// instanceGate 策略在本筆決策的 L0 結果：共用守門未通過時沿用其原因，否則再檢查該策略的交易時段與停止交易事件
+func (s *S3_STRATEGYServer) instanceGate(run *decideRun, strategyName string) (bool, string, []dao.GateTrace) {
+	passed, reason, gate := s.gateKeeper.CheckCalendar(run.snapshot.Calendar, strategyName, run.req.Symbol, run.now)
+	if gate == nil {
+		return run.passed, run.reason, run.gates
+	}
+	gates := append(append([]dao.GateTrace(nil), run.gates...), *gate)
+	if !run.passed {
+		gates[len(gates)-1] = dao.GateTrace{Gate: gateCalendar, Note: "skipped"}
+		return false, run.reason, gates
+	}
+	return passed, reason, gates
+}
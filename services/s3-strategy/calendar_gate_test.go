@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"s3-strategy/dao"
+)
+
+func calendarSnapshot(t *testing.T, calendar string) *ConfigSnapshot {
+	t.Helper()
+	bundle := defaultBundle()
+	bundle.Rev, bundle.Calendar = 3, json.RawMessage(calendar)
+	snapshot, err := buildConfigSnapshot(bundle, defaultStrategyRules())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return snapshot
+}
+
+func TestDecide_CalendarBlackout(t *testing.T) {
+	s := newTestServer(t)
+	now := time.Now().UTC()
+	blackout := fmt.Sprintf(`{"blackouts": [{"id": "us-cpi", "kind": "MACRO", "start": %q, "end": %q}]}`,
+		now.Add(-time.Minute).Format(time.RFC3339), now.Add(time.Hour).Format(time.RFC3339))
+	req := &dao.DecideRequest{SignalID: "sig-1", Symbol: "BTCUSDT", Market: dao.MarketFUT, ConfigRev: "CURRENT", Features: hostedFeatures(nil)}
+
+	// 停止交易事件期間不進場，原因與守門追蹤記錄事件
+	s.configManager.Swap(calendarSnapshot(t, blackout))
+	response := s.decide(req)
+	gates := response.Trace.Gates
+	if response.Decision.Action != dao.DecisionSkip || !strings.HasPrefix(response.Decision.Reason, "calendar: blackout MACRO us-cpi until ") || len(response.Intents) != 0 {
+		t.Fatalf("decision = %+v", response.Decision)
+	}
+	if last := gates[len(gates)-1]; last.Gate != gateCalendar || last.Passed || last.Note != response.Decision.Reason {
+		t.Errorf("gates = %+v", gates)
+	}
+
+	// 策略覆寫略過該事件時照常進場
+	override := strings.TrimSuffix(blackout, "}") + `, "strategies": {"rules": {"ignore": ["MACRO"]}}}`
+	s.configManager.Swap(calendarSnapshot(t, override))
+	if response = s.decide(req); response.Decision.Action != dao.DecisionOpen || len(response.Intents) != 1 {
+		t.Fatalf("override = %+v", response.Decision)
+	}
+
+	// 交易時段外不加倉/開倉，既有持倉仍依 EXIT 規則出場
+	closed := fmt.Sprintf(`{"sessions": [{"start": %q, "end": %q}]}`, now.Add(time.Hour).Format("15:04"), now.Add(2*time.Hour).Format("15:04"))
+	s.configManager.Swap(calendarSnapshot(t, closed))
+	req.SignalID, req.Features = "sig-2", hostedFeatures(dao.FeatureSet{"correlation": 0.9})
+	response = s.decide(req)
+	if !strings.HasPrefix(response.Decision.Reason, "calendar: outside trading sessions; exits: R-002") || len(response.Intents) != 1 || response.Intents[0].Kind != dao.IntentExit {
+		t.Errorf("outside sessions = %+v, intents %+v", response.Decision, response.Intents)
+	}
+
+	// 行事曆格式錯誤時整個版本被拒絕
+	bundle := defaultBundle()
+	bundle.Calendar = json.RawMessage(`{"sessions": [{"start": "25:00", "end": "26:00"}]}`)
+	if _, err := buildConfigSnapshot(bundle, defaultStrategyRules()); err == nil || !strings.Contains(err.Error(), "invalid time") {
+		t.Errorf("err = %v", err)
+	}
+}
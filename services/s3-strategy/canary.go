@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"s3-strategy/dao"
+	"s3-strategy/internal/config"
+	"strings"
+)
+
+// 候選配置預設值（env.yaml candidate 區塊未設定時使用）
+const (
+	candidateModeCanary     = "canary"
+	candidateModeShadow     = "shadow"
+	candidateModeOff        = "off"
+	defaultCanaryTrafficPct = 10
+	rampTrafficPct          = 50
+)
+
+// Candidate 候選配置版本（S10 CANARY/RAMP 推廣中）；TrafficPct 為 0 時僅影子評估
+type Candidate struct {
+	Snapshot    *ConfigSnapshot
+	PromotionID string
+	Mode        string // 推廣模式：CANARY|RAMP
+	TrafficPct  int
+}
+
+func (c *Candidate) Rev() int {
+	return c.Snapshot.Rev()
+}
+
+// candidateBundle promotions（ACTIVE 的 CANARY/RAMP）指向的 Bundle
+type candidateBundle struct {
+	activeBundle
+	PromotionID string `json:"promotion_id"`
+	Mode        string `json:"mode"`
+	TrafficPct  int    `json:"traffic_pct"`
+}
+
+// configTag 決策使用的配置版本；Shadow 為影子評估（不下單、不暫占）
+type configTag struct {
+	Rev    int
+	Role   dao.ConfigRole
+	Shadow bool
+}
+
+// route 選出本筆信號的執行版本與影子版本；無候選版本時影子為 nil
+func (cm *ConfigManager) route(req *dao.DecideRequest) (serving *ConfigSnapshot, servingRole dao.ConfigRole, shadow *ConfigSnapshot, shadowRole dao.ConfigRole) {
+	active := cm.Active()
+	candidate := cm.Candidate()
+	if candidate == nil {
+		return active, dao.ConfigRoleActive, nil, ""
+	}
+	if routeToCandidate(req.Symbol, req.SignalID, candidate.TrafficPct) {
+		return candidate.Snapshot, dao.ConfigRoleCandidate, active, dao.ConfigRoleActive
+	}
+	return active, dao.ConfigRoleActive, candidate.Snapshot, dao.ConfigRoleCandidate
+}
+
+// routeToCandidate 依 hash(symbol, signal_id) 分流；同一信號重送時結果不變
+func routeToCandidate(symbol, signalID string, pct int) bool {
+	if pct <= 0 {
+		return false
+	}
+	if pct >= 100 {
+		return true
+	}
+	h := fnv.New32a()
+	h.Write([]byte(symbol + "|" + signalID))
+	return int(h.Sum32()%100) < pct
+}
+
+func candidateMode() string {
+	mode := strings.ToLower(config.AppConfig.Candidate.Mode)
+	switch mode {
+	case "":
+		return candidateModeCanary
+	case candidateModeCanary, candidateModeShadow, candidateModeOff:
+		return mode
+	default:
+		log.Printf("Unknown candidate mode %q, using %s", mode, candidateModeShadow)
+		return candidateModeShadow
+	}
+}
+
+// candidateTrafficPct 推廣記錄的 traffic_pct 優先；未帶時 RAMP 取 50%、CANARY 取 env.yaml 預設；shadow 模式一律 0
+func candidateTrafficPct(mode string, bundle candidateBundle) int {
+	if mode == candidateModeShadow {
+		return 0
+	}
+	pct := bundle.TrafficPct
+	if pct <= 0 {
+		pct = config.AppConfig.Candidate.TrafficPct
+		if strings.ToUpper(bundle.Mode) == "RAMP" {
+			pct = rampTrafficPct
+		} else if pct <= 0 {
+			pct = defaultCanaryTrafficPct
+		}
+	}
+	if pct > 100 {
+		pct = 100
+	}
+	return pct
+}
+
+// reloadCandidate 載入推廣中的候選 Bundle；推廣結束（已成為現行、回滾或中止）時卸除
+func (s *S3_STRATEGYServer) reloadCandidate() {
+	current := s.configManager.Candidate()
+	mode := candidateMode()
+	if mode == candidateModeOff {
+		if current != nil {
+			s.configManager.SetCandidate(nil)
+			log.Printf("Candidate rev %d unloaded (candidate mode off)", current.Rev())
+		}
+		return
+	}
+
+	bundle, err := s.fetchCandidateBundle()
+	if err != nil {
+		log.Printf("Failed to load candidate config: %v", err)
+		return
+	}
+	if bundle.Rev == 0 || bundle.Rev <= s.configManager.Rev() {
+		if current != nil {
+			s.configManager.SetCandidate(nil)
+			log.Printf("Candidate rev %d unloaded (active rev %d)", current.Rev(), s.configManager.Rev())
+		}
+		return
+	}
+
+	pct := candidateTrafficPct(mode, bundle)
+	if current != nil && current.Rev() == bundle.Rev {
+		if current.TrafficPct != pct || current.Mode != bundle.Mode {
+			s.configManager.SetCandidate(&Candidate{Snapshot: current.Snapshot, PromotionID: bundle.PromotionID, Mode: bundle.Mode, TrafficPct: pct})
+			log.Printf("Candidate rev %d: %s %d%% -> %s %d%%", bundle.Rev, current.Mode, current.TrafficPct, bundle.Mode, pct)
+		}
+		return
+	}
+	if bundle.Rev == s.rejectedCandidateRev {
+		return
+	}
+	if !bundle.Found {
+		s.rejectedCandidateRev = bundle.Rev
+		s.publishAlert(dao.SevWarn, fmt.Sprintf("candidate rev %d (%s): bundle %s not found", bundle.Rev, bundle.PromotionID, bundle.BundleID))
+		return
+	}
+
+	snapshot, err := buildConfigSnapshot(bundle.activeBundle, bundle.Rules)
+	if err != nil {
+		s.rejectedCandidateRev = bundle.Rev
+		s.publishAlert(dao.SevWarn, fmt.Sprintf("candidate %v (%s)", err, bundle.PromotionID))
+		return
+	}
+	s.configManager.SetCandidate(&Candidate{Snapshot: snapshot, PromotionID: bundle.PromotionID, Mode: bundle.Mode, TrafficPct: pct})
+	log.Printf("Candidate loaded: rev %d (bundle %s, %s %d%%, %d rules) next to active rev %d",
+		snapshot.Rev(), snapshot.BundleID, bundle.Mode, pct, len(snapshot.Rules), s.configManager.Rev())
+}
+
+func (s *S3_STRATEGYServer) fetchCandidateBundle() (candidateBundle, error) {
+	var bundle candidateBundle
+	ctx, cancel := context.WithTimeout(context.Background(), configLoadTimeout)
+	defer cancel()
+
+	query := `LET promo = FIRST(FOR p IN promotions
+				FILTER p.status == "ACTIVE" && p.mode IN ["CANARY", "RAMP"]
+				SORT p.activated_at DESC LIMIT 1 RETURN p)
+			LET bundle = promo == null ? null : FIRST(FOR b IN config_bundles FILTER b.bundle_id == promo.bundle_id RETURN b)
+			RETURN {
+				promotion_id: promo.promotion_id,
+				mode: promo.mode,
+				traffic_pct: promo.traffic_pct,
+				rev: promo.to_rev,
+				bundle_id: promo.bundle_id,
+				activated_at: promo.activated_at,
+				found: bundle != null,
+				rule_ids: bundle == null ? [] : bundle.rules,
+				instruments: bundle == null ? [] : bundle.instruments,
+				flags: bundle == null ? {} : bundle.flags,
+				rules: bundle == null ? [] : (FOR r IN strategy_rules FILTER r.rule_id IN bundle.rules RETURN r),
+				calendar: bundle == null ? null : bundle.calendar
+			}`
+	cursor, err := s.arangodbClient.GetDB().Query(ctx, query, nil)
+	if err != nil {
+		return bundle, err
+	}
+	defer cursor.Close()
+
+	if _, err := cursor.ReadDocument(ctx, &bundle); err != nil {
+		return bundle, err
+	}
+	return bundle, nil
+}
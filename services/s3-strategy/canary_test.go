@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"s3-strategy/dao"
+	"s3-strategy/internal/config"
+	"s3-strategy/internal/strategy"
+)
+
+func TestRouteToCandidate(t *testing.T) {
+	if routeToCandidate("BTCUSDT", "sig-1", 0) || !routeToCandidate("BTCUSDT", "sig-1", 100) {
+		t.Fatal("0% must never and 100% must always route to the candidate")
+	}
+
+	routed := 0
+	for i := 0; i < 10000; i++ {
+		id := fmt.Sprintf("sig_BTCUSDT_FUT_%d", 1_700_000_000_000+i*60_000)
+		hit := routeToCandidate("BTCUSDT", id, 10)
+		if hit != routeToCandidate("BTCUSDT", id, 10) {
+			t.Fatalf("%s: routing must be deterministic", id)
+		}
+		if hit {
+			routed++
+		}
+	}
+	if routed < 800 || routed > 1200 {
+		t.Errorf("routed %d of 10000 at 10%%", routed)
+	}
+}
+
+func TestCandidateTrafficPct(t *testing.T) {
+	defer func(pct int) { config.AppConfig.Candidate.TrafficPct = pct }(config.AppConfig.Candidate.TrafficPct)
+	config.AppConfig.Candidate.TrafficPct = 0
+
+	cases := []struct {
+		mode   string
+		bundle candidateBundle
+		want   int
+	}{
+		{candidateModeCanary, candidateBundle{Mode: "CANARY", TrafficPct: 25}, 25},
+		{candidateModeCanary, candidateBundle{Mode: "CANARY"}, defaultCanaryTrafficPct},
+		{candidateModeCanary, candidateBundle{Mode: "RAMP"}, rampTrafficPct},
+		{candidateModeShadow, candidateBundle{Mode: "RAMP", TrafficPct: 50}, 0},
+	}
+	for _, c := range cases {
+		if got := candidateTrafficPct(c.mode, c.bundle); got != c.want {
+			t.Errorf("%s %+v: pct = %d, want %d", c.mode, c.bundle, got, c.want)
+		}
+	}
+}
+
+func TestDecide_ShadowAndCanary(t *testing.T) {
+	s := newTestServer(t)
+	snapshot, err := buildConfigSnapshot(activeBundle{Rev: 5, BundleID: "b-5", RuleIDs: []string{"R-NEW"}}, []ruleDocument{
+		{RuleID: "R-NEW", When: json.RawMessage(`"rv_pctile_30d < 0.25"`), Actions: json.RawMessage(`{"size_mult":0.5}`), Priority: 50},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := &dao.DecideRequest{
+		SignalID:  "sig-1",
+		Symbol:    "BTCUSDT",
+		Market:    dao.MarketFUT,
+		ConfigRev: "CURRENT",
+		Features:  dao.FeatureSet{"spread_bps": 1.5, "rv_pctile_30d": 0.1, "rho_usdttwd_14": -0.5, "atr_pct": 0.5, "rv_pct": 0.1, "invalidation_px": 59000.0},
+	}
+
+	// 影子：現行版本執行，候選版本只記錄決策
+	s.configManager.SetCandidate(&Candidate{Snapshot: snapshot, Mode: "CANARY", TrafficPct: 0})
+	response := s.decide(req)
+	if response.ConfigRole != dao.ConfigRoleActive || response.ConfigRev != 0 || len(response.Intents) != 1 || response.Intents[0].ConfigRev != 0 {
+		t.Fatalf("serving = %+v", response)
+	}
+	if sh := response.Shadow; sh == nil || sh.ConfigRev != 5 || sh.ConfigRole != dao.ConfigRoleCandidate || len(sh.RulesFired) != 1 || sh.Decision.SizeMult != 0.5 {
+		t.Errorf("shadow = %+v", response.Shadow)
+	}
+
+	// canary 100%：候選版本執行並標記意圖，現行版本轉為影子（從無持倉開始）
+	s.strategyRunner.Store = strategy.NewMemoryPositionStore()
+	s.configManager.SetCandidate(&Candidate{Snapshot: snapshot, Mode: "CANARY", TrafficPct: 100})
+	response = s.decide(req)
+	if response.ConfigRole != dao.ConfigRoleCandidate || response.ConfigRev != 5 || response.Decision.SizeMult != 0.5 {
+		t.Fatalf("serving = %+v", response)
+	}
+	if len(response.Intents) != 1 || response.Intents[0].ConfigRev != 5 || response.Intents[0].ConfigRole != dao.ConfigRoleCandidate {
+		t.Errorf("intents = %+v", response.Intents)
+	}
+	if sh := response.Shadow; sh == nil || sh.ConfigRev != 0 || sh.ConfigRole != dao.ConfigRoleActive || sh.Decision.SizeMult != 1.2 {
+		t.Errorf("shadow = %+v", response.Shadow)
+	}
+
+	// 無候選版本時不做影子評估
+	s.configManager.SetCandidate(nil)
+	if response = s.decide(req); response.Shadow != nil || response.ConfigRole != dao.ConfigRoleActive {
+		t.Errorf("response = %+v", response)
+	}
+}
+
+func TestSignalKey(t *testing.T) {
+	if key := signalKey(&dao.Signal{SignalID: "sig-1", ConfigRev: 5}); key != "sig-1" {
+		t.Errorf("key = %s", key)
+	}
+	if key := signalKey(&dao.Signal{SignalID: "sig-1", ConfigRev: 5, Shadow: true}); key != "sig-1-shadow-r5" {
+		t.Errorf("shadow key = %s", key)
+	}
+}
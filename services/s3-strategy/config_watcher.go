@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"s3-strategy/dao"
+	"s3-strategy/internal/config"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 配置熱載預設值（env.yaml config_watch 區塊未設定時使用）
+const (
+	defaultConfigEventsStream = "cfg:events"
+	defaultConfigPollInterval = 30 * time.Second
+	configLoadTimeout         = 10 * time.Second
+	configEventsBlock         = 5 * time.Second
+	configEventsBatch         = 10
+	configEventsRetryDelay    = 2 * time.Second
+)
+
+// activeBundle config_active → config_bundles → strategy_rules 解析結果
+type activeBundle struct {
+	Rev         int                    `json:"rev"`
+	BundleID    string                 `json:"bundle_id"`
+	ActivatedAt int64                  `json:"activated_at"`
+	Found       bool                   `json:"found"`
+	RuleIDs     []string               `json:"rule_ids"`
+	Instruments []string               `json:"instruments"`
+	Flags       map[string]interface{} `json:"flags"`
+	Rules       []ruleDocument         `json:"rules"`
+	Calendar    json.RawMessage        `json:"calendar"` // 交易時段與停止交易事件（internal/calendar）
+}
+
+// ruleDocument strategy_rules 文件；相容白皮書（when/action）與 S10（conditions/actions）兩種欄位
+type ruleDocument struct {
+	RuleID     string          `json:"rule_id"`
+	RuleName   string          `json:"rule_name"`
+	Name       string          `json:"name"`
+	RuleType   string          `json:"rule_type"`
+	Type       string          `json:"type"`
+	Priority   int             `json:"priority"`
+	When       json.RawMessage `json:"when"`
+	Conditions json.RawMessage `json:"conditions"`
+	Action     *struct {
+		Type  string      `json:"type"`
+		Value interface{} `json:"value"`
+	} `json:"action"`
+	Actions json.RawMessage `json:"actions"`
+	Status  string          `json:"status"`
+}
+
+// toStrategyRule 條件可為 DSL 字串或 JSON 物件；停用/棄用的規則保留但不啟用
+func (d ruleDocument) toStrategyRule(rev int) (*dao.StrategyRule, error) {
+	conditions := rawText(d.When)
+	if conditions == "" {
+		conditions = rawText(d.Conditions)
+	}
+	actions := rawText(d.Actions)
+	if d.Action != nil {
+		encoded, err := json.Marshal(map[string]interface{}{d.Action.Type: d.Action.Value})
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: invalid action: %w", d.RuleID, err)
+		}
+		actions = string(encoded)
+	}
+	name := d.RuleName
+	if name == "" {
+		name = d.Name
+	}
+	ruleType := d.RuleType
+	if ruleType == "" {
+		ruleType = d.Type
+	}
+	status := strings.ToUpper(d.Status)
+	return &dao.StrategyRule{
+		RuleID:     d.RuleID,
+		RuleName:   name,
+		RuleType:   ruleType,
+		Conditions: conditions,
+		Actions:    actions,
+		Priority:   d.Priority,
+		Enabled:    status != "DISABLED" && status != "DEPRECATED",
+		ConfigRev:  rev,
+	}, nil
+}
+
+// rawText JSON 字串取其內容，其餘（物件）保留原文
+func rawText(raw json.RawMessage) string {
+	if len(raw) == 0 || string(raw) == "null" {
+		return ""
+	}
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return text
+	}
+	return string(raw)
+}
+
+// buildConfigSnapshot 編譯 Bundle 的全部規則與行事曆；任一規則缺漏、編譯失敗或行事曆格式錯誤即拒絕整個版本
+func buildConfigSnapshot(bundle activeBundle, docs []ruleDocument) (*ConfigSnapshot, error) {
+	byID := make(map[string]ruleDocument, len(docs))
+	for _, doc := range docs {
+		byID[doc.RuleID] = doc
+	}
+
+	engine := NewRuleEngine()
+	rules := make(map[string]*dao.StrategyRule, len(bundle.RuleIDs))
+	var problems []string
+	for _, id := range bundle.RuleIDs {
+		doc, ok := byID[id]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("rule %s not found", id))
+			continue
+		}
+		rule, err := doc.toStrategyRule(bundle.Rev)
+		if err == nil {
+			err = engine.LoadRule(rule)
+		}
+		if err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+		rules[id] = rule
+	}
+	cal, err := compileCalendar(bundle.Calendar)
+	if err != nil {
+		problems = append(problems, err.Error())
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("bundle %s rev %d rejected: %s", bundle.BundleID, bundle.Rev, strings.Join(problems, "; "))
+	}
+
+	now := time.Now()
+	return &ConfigSnapshot{
+		Config: &dao.StrategyConfig{
+			ConfigRev:   bundle.Rev,
+			ConfigName:  bundle.BundleID,
+			Parameters:  bundle.Flags,
+			Rules:       bundle.RuleIDs,
+			Instruments: bundle.Instruments,
+			Status:      "ACTIVE",
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		},
+		Rules:    rules,
+		Engine:   engine,
+		Calendar: cal,
+		BundleID: bundle.BundleID,
+		LoadedAt: now,
+	}, nil
+}
+
+// reloadConfig 依序載入現行版本與候選版本（同一時間只執行一次）
+func (s *S3_STRATEGYServer) reloadConfig() {
+	s.reloadMutex.Lock()
+	defer s.reloadMutex.Unlock()
+
+	s.reloadActive()
+	s.reloadCandidate()
+}
+
+// reloadActive 比對 config_active.rev，變更時載入 Bundle 規則並整組替換；失敗保留現行版本
+func (s *S3_STRATEGYServer) reloadActive() {
+	bundle, err := s.fetchActiveBundle()
+	if err != nil {
+		log.Printf("Failed to load active config: %v", err)
+		return
+	}
+	if bundle.Rev == 0 || bundle.Rev == s.configManager.Rev() || bundle.Rev == s.rejectedRev {
+		return
+	}
+	if !bundle.Found {
+		s.rejectedRev = bundle.Rev
+		s.publishAlert(dao.SevWarn, fmt.Sprintf("config rev %d: bundle %s not found; keeping rev %d", bundle.Rev, bundle.BundleID, s.configManager.Rev()))
+		return
+	}
+
+	snapshot, err := buildConfigSnapshot(bundle, bundle.Rules)
+	if err != nil {
+		s.rejectedRev = bundle.Rev
+		s.publishAlert(dao.SevWarn, fmt.Sprintf("%v; keeping rev %d", err, s.configManager.Rev()))
+		return
+	}
+	previous := s.configManager.Rev()
+	s.configManager.Swap(snapshot)
+	log.Printf("Config reloaded: rev %d -> %d (bundle %s, %d rules)", previous, snapshot.Rev(), snapshot.BundleID, len(snapshot.Rules))
+}
+
+func (s *S3_STRATEGYServer) fetchActiveBundle() (activeBundle, error) {
+	var bundle activeBundle
+	ctx, cancel := context.WithTimeout(context.Background(), configLoadTimeout)
+	defer cancel()
+
+	query := `LET active = FIRST(FOR a IN config_active FILTER a.key == "active" RETURN a)
+		LET bundle = active == null ? null : FIRST(FOR b IN config_bundles FILTER b.bundle_id == active.bundle_id RETURN b)
+		RETURN {
+			rev: active.rev,
+			bundle_id: active.bundle_id,
+			activated_at: active.activated_at,
+			found: bundle != null,
+			rule_ids: bundle == null ? [] : bundle.rules,
+			instruments: bundle == null ? [] : bundle.instruments,
+			flags: bundle == null ? {} : bundle.flags,
+			rules: bundle == null ? [] : (FOR r IN strategy_rules FILTER r.rule_id IN bundle.rules RETURN r),
+			calendar: bundle == null ? null : bundle.calendar
+		}`
+	cursor, err := s.arangodbClient.GetDB().Query(ctx, query, nil)
+	if err != nil {
+		return bundle, err
+	}
+	defer cursor.Close()
+
+	if _, err := cursor.ReadDocument(ctx, &bundle); err != nil {
+		return bundle, err
+	}
+	return bundle, nil
+}
+
+// startConfigWatcher 訂閱 cfg:events 並定期輪詢 config_active.rev 與推廣記錄（事件遺失時的補償）
+func (s *S3_STRATEGYServer) startConfigWatcher() {
+	if s.arangodbClient == nil {
+		return
+	}
+	cfg := config.AppConfig.ConfigWatch
+
+	interval := durationOr(cfg.PollInterval, defaultConfigPollInterval)
+	if interval > 0 {
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for range ticker.C {
+				s.reloadConfig()
+			}
+		}()
+	}
+
+	if s.redisClient != nil {
+		stream := cfg.EventsStream
+		if stream == "" {
+			stream = defaultConfigEventsStream
+		}
+		go s.consumeConfigEvents(stream)
+	}
+}
+
+// consumeConfigEvents 以 XREAD 讀取廣播事件（每個副本都需熱載，不使用 consumer group）
+func (s *S3_STRATEGYServer) consumeConfigEvents(stream string) {
+	ctx := s.redisClient.Ctx
+	lastID := "$"
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		streams, err := s.redisClient.ReadStream(ctx, stream, lastID, configEventsBatch, configEventsBlock)
+		if err != nil {
+			log.Printf("Failed to read %s: %v", stream, err)
+			time.Sleep(configEventsRetryDelay)
+			continue
+		}
+		reload := false
+		for _, st := range streams {
+			for _, msg := range st.Messages {
+				lastID = msg.ID
+				rev, _ := strconv.Atoi(fmt.Sprint(msg.Values["rev"]))
+				log.Printf("Config event %v: bundle %v rev %d", msg.Values["event"], msg.Values["bundle_id"], rev)
+				if rev == 0 || rev != s.configManager.Rev() || s.configManager.Candidate() != nil {
+					reload = true
+				}
+			}
+		}
+		// 事件僅為通知；實際版本以 config_active 與 promotions 為準（ROLLBACK 亦同）
+		if reload {
+			s.reloadConfig()
+		}
+	}
+}
+
+// defaultBundle 無 config_active 時使用的內建規則組（rev 0）
+func defaultBundle() activeBundle {
+	return activeBundle{
+		BundleID:    "builtin",
+		RuleIDs:     []string{"R-001", "R-002"},
+		Instruments: []string{"BTCUSDT", "ETHUSDT"},
+		Flags:       map[string]interface{}{},
+	}
+}
+
+func defaultStrategyRules() []ruleDocument {
+	return []ruleDocument{
+		{
+			RuleID:     "R-001",
+			RuleName:   "Low Volatility Entry",
+			RuleType:   "ENTRY",
+			Conditions: json.RawMessage(`{"allOf":[{"f":"rv_pctile_30d","op":"<","v":0.25},{"f":"rho_usdttwd_14","op":"<","v":-0.3}]}`),
+			Actions:    json.RawMessage(`{"size_mult":1.2,"tp_mult":2.0,"sl_mult":0.5}`),
+			Priority:   50,
+		},
+		{
+			RuleID:     "R-002",
+			RuleName:   "High Correlation Exit",
+			RuleType:   "EXIT",
+			Conditions: json.RawMessage(`{"allOf":[{"f":"correlation","op":">","v":0.8}]}`),
+			Actions:    json.RawMessage(`{"size_mult":0.5}`),
+			Priority:   30,
+		},
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"s3-strategy/dao"
+)
+
+func TestBuildConfigSnapshot(t *testing.T) {
+	var docs []ruleDocument
+	err := json.Unmarshal([]byte(`[
+		{"rule_id":"R-EW","priority":60,"when":"wave_signal_4h == \"end_of_2_confirmed\"","action":{"type":"size_mult","value":1.5},"status":"ENABLED"},
+		{"rule_id":"R-VOL","name":"Low vol","type":"ENTRY","priority":50,"conditions":{"allOf":[{"f":"rv_pctile_30d","op":"<","v":0.25}]},"actions":{"tp_mult":2.0},"status":"ACTIVE"},
+		{"rule_id":"R-OFF","priority":90,"when":"rv_pctile_30d < 1","action":{"type":"size_mult","value":0.1},"status":"DISABLED"},
+		{"rule_id":"R-OTHER","priority":10,"when":"rv_pctile_30d < 1","action":{"type":"size_mult","value":0.1},"status":"ENABLED"}
+	]`), &docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bundle := activeBundle{Rev: 7, BundleID: "b-7", Found: true, RuleIDs: []string{"R-EW", "R-VOL", "R-OFF"}}
+	snapshot, err := buildConfigSnapshot(bundle, docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshot.Rev() != 7 || len(snapshot.Rules) != 3 || snapshot.Rules["R-VOL"].RuleName != "Low vol" {
+		t.Fatalf("snapshot = %+v", snapshot)
+	}
+
+	// 僅 Bundle 列出且啟用的規則生效
+	decision, fired := snapshot.Engine.Evaluate(&dao.DecideRequest{Symbol: "BTCUSDT"}, dao.FeatureSet{
+		"wave_signal_4h": "end_of_2_confirmed",
+		"rv_pctile_30d":  0.1,
+	})
+	if len(fired) != 2 || fired[0] != "R-EW" || fired[1] != "R-VOL" {
+		t.Fatalf("fired = %v", fired)
+	}
+	if decision.SizeMult != 1.5 || decision.TPMult != 2.0 {
+		t.Errorf("decision = %+v", decision)
+	}
+}
+
+func TestBuildConfigSnapshot_Rejects(t *testing.T) {
+	docs := []ruleDocument{
+		{RuleID: "R-BAD", When: json.RawMessage(`"rv_pctile_30d <"`), Actions: json.RawMessage(`{"size_mult":2}`)},
+	}
+	cases := map[string][]string{
+		"compile error": {"R-BAD"},
+		"missing rule":  {"R-MISSING"},
+	}
+	for name, ids := range cases {
+		_, err := buildConfigSnapshot(activeBundle{Rev: 8, BundleID: "b-8", RuleIDs: ids}, docs)
+		if err == nil || !strings.Contains(err.Error(), "rev 8 rejected") {
+			t.Errorf("%s: err = %v", name, err)
+		}
+	}
+}
+
+func TestConfigManager_SwapKeepsInFlightSnapshot(t *testing.T) {
+	cm := &ConfigManager{}
+	if cm.Rev() != 0 || cm.Active() != nil {
+		t.Fatal("empty manager must report rev 0")
+	}
+
+	old, err := buildConfigSnapshot(defaultBundle(), defaultStrategyRules())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cm.Swap(old)
+	inFlight := cm.Active()
+
+	next, err := buildConfigSnapshot(activeBundle{Rev: 3, BundleID: "b-3"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cm.Swap(next)
+
+	if inFlight.Rev() != 0 || len(inFlight.Rules) != 2 {
+		t.Errorf("in-flight snapshot changed: rev %d, %d rules", inFlight.Rev(), len(inFlight.Rules))
+	}
+	if cm.Rev() != 3 || len(cm.Active().Rules) != 0 {
+		t.Errorf("active rev = %d", cm.Rev())
+	}
+}
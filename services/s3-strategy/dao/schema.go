@@ -1,6 +1,9 @@
 package dao
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // ================================
 // Project Chimera — API Contract v3.1 (commented)
@@ -73,14 +76,25 @@ const (
 	HealthError    HealthStatus = "ERROR"    // 關鍵相依失效，功能不可用
 )
 
-// DecisionAction 決策動作：入場或跳過
+// DecisionAction 決策動作：入場、加倉、出場、反手或跳過
 type DecisionAction string
 
 const (
-	DecisionOpen DecisionAction = "open"
+	DecisionOpen DecisionAction = "open" // 無持倉，依信號方向進場
+	DecisionAdd  DecisionAction = "add"  // 同向持倉加倉
+	DecisionExit DecisionAction = "exit" // 僅減倉/平倉（EXIT/RISK 規則、止損或反向信號 close）
+	DecisionFlip DecisionAction = "flip" // 反向信號：平倉後反向進場
 	DecisionSkip DecisionAction = "skip"
 )
 
+// ConfigRole 產生決策的配置版本角色：現行或候選（S10 CANARY/RAMP 推廣中）
+type ConfigRole string
+
+const (
+	ConfigRoleActive    ConfigRole = "ACTIVE"
+	ConfigRoleCandidate ConfigRole = "CANDIDATE"
+)
+
 // OrderIntentKind 訂單意圖類型：入場/加倉/減倉/停利/停損
 type OrderIntentKind string
 
@@ -176,11 +190,13 @@ type DecideRequest struct {
 }
 
 type Decision struct {
-	Action   DecisionAction `json:"action"`              // open|skip
+	Action   DecisionAction `json:"action"`              // open|add|exit|flip|skip
+	Side     PosSide        `json:"side,omitempty"`      // 進場方向 LONG|SHORT（open/add/flip）
 	SizeMult float64        `json:"size_mult,omitempty"` // 初始倉位倍率（預設 1.0）
 	TPMult   float64        `json:"tp_mult,omitempty"`   // 停利倍率
 	SLMult   float64        `json:"sl_mult,omitempty"`   // 停損倍率
 	Reason   string         `json:"reason,omitempty"`    // 可讀解釋（規則命中/模型分數等）
+	Strategy string         `json:"strategy,omitempty"`  // 規則路徑策略實例（hosted_strategies）
 }
 
 // OCO SPOT 一單兩腿（TakeProfitPx/StopLossPx 以「價格」定義）
@@ -201,19 +217,250 @@ type ExecPolicy struct {
 }
 
 type OrderIntent struct {
-	IntentID     string          `json:"intent_id"`          // 唯一意圖 ID（冪等鍵）
-	Symbol       string          `json:"symbol"`             // 交易對（如 BTCUSDT）
-	Market       Market          `json:"market"`             // FUT|SPOT
-	Kind         OrderIntentKind `json:"kind"`               // ENTRY/ADD/EXIT/TP/SL
-	Side         Side            `json:"side"`               // BUY/SELL
-	NotionalUSDT float64         `json:"notional_usdt"`      // 名目 USDT 金額
-	Leverage     int             `json:"leverage,omitempty"` // FUT：槓桿；SPOT 留空
-	ExecPolicy   ExecPolicy      `json:"exec_policy"`        // 執行策略
+	IntentID     string          `json:"intent_id"`             // 唯一意圖 ID（冪等鍵）
+	Symbol       string          `json:"symbol"`                // 交易對（如 BTCUSDT）
+	Market       Market          `json:"market"`                // FUT|SPOT
+	Kind         OrderIntentKind `json:"kind"`                  // ENTRY/ADD/EXIT/TP/SL
+	Side         Side            `json:"side"`                  // BUY/SELL
+	NotionalUSDT float64         `json:"notional_usdt"`         // 名目 USDT 金額
+	Leverage     int             `json:"leverage,omitempty"`    // FUT：槓桿；SPOT 留空
+	ExecPolicy   ExecPolicy      `json:"exec_policy"`           // 執行策略
+	Qty          float64         `json:"qty,omitempty"`         // 數量（策略規格依風險計算時提供）
+	TriggerPx    float64         `json:"trigger_px,omitempty"`  // SL：止損觸發價
+	ReduceOnly   bool            `json:"reduce_only,omitempty"` // 僅減倉（EXIT/TP/SL）
+	Strategy     string          `json:"strategy,omitempty"`    // 產生意圖的策略規格
+	Reason       string          `json:"reason,omitempty"`      // 觸發原因（entry/ladder/stop_hit/time_stop…）
+	ConfigRev    int             `json:"config_rev"`            // 產生意圖的配置版本
+	ConfigRole   ConfigRole      `json:"config_role,omitempty"` // ACTIVE|CANDIDATE
+}
+
+// OrderCmdRequest S4 POST /orders 請求（串流決策轉送意圖）
+type OrderCmdRequest struct {
+	Intent OrderIntent `json:"intent"`
 }
 
 type DecideResponse struct {
-	Decision Decision      `json:"decision"`          // 決策
-	Intents  []OrderIntent `json:"intents,omitempty"` // 需要執行的下單意圖
+	Decision    Decision             `json:"decision"`              // 決策
+	Intents     []OrderIntent        `json:"intents,omitempty"`     // 需要執行的下單意圖
+	Transitions []PositionTransition `json:"transitions,omitempty"` // 策略持倉狀態轉移
+	ConfigRev   int                  `json:"config_rev"`            // 本次決策使用的配置版本
+	ConfigRole  ConfigRole           `json:"config_role"`           // ACTIVE|CANDIDATE（canary 分流命中時為 CANDIDATE）
+	Shadow      *ShadowDecision      `json:"shadow,omitempty"`      // 另一版本的影子決策（有候選版本時）
+	Trace       *DecisionTrace       `json:"trace,omitempty"`       // ?explain=true 時回傳
+	Strategies  []StrategyDecision   `json:"strategies,omitempty"`  // 各策略實例的決策；頂層為第一個非 skip 者
+	Replayed    bool                 `json:"replayed,omitempty"`    // 同一 signal_id 與配置版本重送：回傳已保存的決策，未重新決策
+}
+
+// StrategyDecision 單一規則路徑策略實例的決策（意圖已併入 DecideResponse.Intents）
+type StrategyDecision struct {
+	Strategy   string          `json:"strategy"`
+	Decision   Decision        `json:"decision"`
+	RulesFired []string        `json:"rules_fired,omitempty"`
+	Shadow     *ShadowDecision `json:"shadow,omitempty"`
+	Trace      *DecisionTrace  `json:"trace,omitempty"` // ?explain=true 時回傳
+}
+
+// ShadowDecision 影子評估結果：同一信號以另一配置版本評估，不下單、不暫占風險
+type ShadowDecision struct {
+	ConfigRev  int        `json:"config_rev"`
+	ConfigRole ConfigRole `json:"config_role"`
+	Decision   Decision   `json:"decision"`
+	RulesFired []string   `json:"rules_fired,omitempty"`
+}
+
+// DecisionTrace 決策可解釋性追蹤：隨信號保存，?explain=true 時回傳
+type DecisionTrace struct {
+	Gates       []GateTrace       `json:"gates"`                 // L0 守門：觀測值 vs 門檻
+	Rules       []RuleTrace       `json:"rules,omitempty"`       // L1 規則：每個條件的結果與運算元
+	Multipliers []MultiplierTrace `json:"multipliers,omitempty"` // 規則倍率乘積（clamp 前後）
+	Model       *ModelTrace       `json:"model,omitempty"`       // L2 分數與主要特徵貢獻
+	Sizing      *SizingTrace      `json:"sizing,omitempty"`      // 最終倉位計算
+	Position    *PositionTrace    `json:"position,omitempty"`    // 規則路徑的信號方向與既有持倉
+	Portfolio   *PortfolioTrace   `json:"portfolio,omitempty"`   // 組合層預檢（相關性、策略/資產類額度、淨 Delta）
+	KillSwitch  string            `json:"kill_switch,omitempty"` // 停止進場開關（啟動時只允許出場）
+}
+
+// GateTrace 單一 L0 守門檢查
+type GateTrace struct {
+	Gate      string   `json:"gate"`               // funding/spread/depth/risk_budget/calendar
+	Feature   string   `json:"feature,omitempty"`  // 觀測的特徵
+	Observed  *float64 `json:"observed,omitempty"` // 觀測值（缺值時不檢查）
+	Op        string   `json:"op,omitempty"`       // 通過條件：observed <op> threshold
+	Threshold float64  `json:"threshold,omitempty"`
+	Passed    bool     `json:"passed"`
+	Note      string   `json:"note,omitempty"` // missing/skipped/失敗原因
+}
+
+// RuleTrace 單一規則的評估結果
+type RuleTrace struct {
+	RuleID     string             `json:"rule_id"`
+	RuleType   string             `json:"rule_type,omitempty"` // ENTRY/EXIT/RISK
+	Priority   int                `json:"priority"`
+	Result     string             `json:"result"` // TRUE/FALSE/UNKNOWN/DISABLED/ERROR
+	Fired      bool               `json:"fired"`
+	Conditions []RuleCondition    `json:"conditions,omitempty"`
+	Actions    map[string]float64 `json:"actions,omitempty"` // 命中時套用的倍率
+	Error      string             `json:"error,omitempty"`   // 編譯錯誤
+}
+
+// RuleCondition 條件求值明細
+type RuleCondition struct {
+	Expr     string        `json:"expr"`
+	Result   string        `json:"result"` // TRUE/FALSE/UNKNOWN
+	Operands []RuleOperand `json:"operands,omitempty"`
+}
+
+// RuleOperand 條件運算元的實際值（null 為缺值）
+type RuleOperand struct {
+	Expr  string      `json:"expr"`
+	Value interface{} `json:"value"`
+}
+
+// MultiplierTrace 倍率：命中規則乘積與白名單 clamp 後的值
+type MultiplierTrace struct {
+	Name    string  `json:"name"` // size_mult/tp_mult/sl_mult
+	Product float64 `json:"product"`
+	Min     float64 `json:"min"`
+	Max     float64 `json:"max"`
+	Value   float64 `json:"value"`
+	Clamped bool    `json:"clamped"`
+}
+
+// ModelTrace L2 評分明細
+type ModelTrace struct {
+	Path           ModelPath             `json:"path"`
+	Model          string                `json:"model"`
+	Version        string                `json:"version,omitempty"`
+	Score          float64               `json:"score"`
+	Confidence     float64               `json:"confidence"`
+	SizeMult       float64               `json:"size_mult"` // 分數映射的倉位倍率（RULES_ONLY 為 1.0）
+	FallbackReason string                `json:"fallback_reason,omitempty"`
+	Contributions  []FeatureContribution `json:"contributions,omitempty"` // 依 |contribution| 排序的前幾名
+}
+
+// FeatureContribution 特徵對模型分數的貢獻
+type FeatureContribution struct {
+	Feature      string      `json:"feature"`
+	Value        interface{} `json:"value"`
+	Contribution float64     `json:"contribution"`
+}
+
+// PositionTrace 規則路徑：信號方向、既有持倉與出場/反向處理
+type PositionTrace struct {
+	Direction        PosSide  `json:"direction,omitempty"`         // 信號方向；方向特徵皆缺值時為空（依無效化價）
+	DirectionFeature string   `json:"direction_feature,omitempty"` // 決定方向的特徵
+	Held             PosSide  `json:"held,omitempty"`              // 評估前的持倉方向（無持倉為空）
+	HeldQty          float64  `json:"held_qty,omitempty"`
+	StopPx           float64  `json:"stop_px,omitempty"`
+	Adds             int      `json:"adds,omitempty"`
+	OnOpposite       string   `json:"on_opposite,omitempty"` // hold|close|flip
+	Exits            []string `json:"exits,omitempty"`       // 出場動作（stop_hit、<rule_id>:exit 等）
+}
+
+// PortfolioTrace 組合層預檢：以持倉、未成交暫占與候選單計算下單後曝險（占 NAV 比例）
+type PortfolioTrace struct {
+	NAV          float64     `json:"nav"`
+	Notional     float64     `json:"notional_usdt"`       // 預檢前的候選名義金額
+	Final        float64     `json:"final_notional_usdt"` // 預檢後（降尺）；拒單為 0
+	Action       string      `json:"action"`              // pass|downsize|reject
+	Correlations bool        `json:"correlations"`        // 是否取得相關係數矩陣（未取得時只合併同標的）
+	Checks       []RiskCheck `json:"checks"`
+}
+
+// SizingTrace 最終倉位計算：risk_cash = NAV × base_risk_pct × conviction；qty = risk_cash / |entry − stop|
+type SizingTrace struct {
+	RuleSizeMult   float64 `json:"rule_size_mult"`
+	MLSizeMult     float64 `json:"ml_size_mult"`
+	SizeMult       float64 `json:"size_mult"`       // L1 × L2
+	ConvictionMult float64 `json:"conviction_mult"` // clamp(size_mult, lower, upper)
+	NAVUSDT        float64 `json:"nav_usdt"`
+	BaseRiskPct    float64 `json:"base_risk_pct"`
+	RiskCashUSDT   float64 `json:"risk_cash_usdt"`
+	EntryPx        float64 `json:"entry_px"`
+	StopRef        string  `json:"stop_ref,omitempty"` // 無效化價特徵
+	InvalidationPx float64 `json:"invalidation_px"`
+	StopPx         float64 `json:"stop_px"` // 依 tickSize 取整後的硬止損
+	RawQty         float64 `json:"raw_qty"`
+	Qty            float64 `json:"qty"`                // 夾限並依 stepSize 取整
+	HeldQty        float64 `json:"held_qty,omitempty"` // 加倉時的既有持倉數量（合計受槓桿與保證金上限夾限）
+	MarginUSDT     float64 `json:"margin_usdt"`
+	Leverage       int     `json:"leverage"`
+	NotionalUSDT   float64 `json:"notional_usdt"`
+	CappedBy       string  `json:"capped_by,omitempty"` // leverage|max_margin|portfolio
+	Error          string  `json:"error,omitempty"`     // 無法計算時的原因（決策改為 skip）
+}
+
+// PositionTransition 策略持倉狀態轉移（同步發布至 pos:events，type=state_changed）
+type PositionTransition struct {
+	Strategy string `json:"strategy"`
+	Symbol   string `json:"symbol"`
+	From     string `json:"from"`  // 空字串表示新倉
+	To       string `json:"to"`    // ACTIVE_CONFIRMED/ACTIVE_WARNING/ACTIVE_REDUCED_RISK/PENDING_EXIT/CLOSED/INVALIDATED
+	Event    string `json:"event"` // 觸發事件（entry/end_of_4_confirmed/stop_hit…）
+	Ts       int64  `json:"ts"`
+}
+
+// DecideBatchRequest POST /decide/batch：多個交易對一次決策（同一交易對依序、不同交易對並行）
+type DecideBatchRequest struct {
+	Requests []DecideRequest `json:"requests" validate:"required,min=1"` // 各筆另行驗證，錯誤只影響該筆
+}
+
+// DecideBatchResult 單筆結果（與 requests 同序）；status 沿用 /decide 的 HTTP 狀態碼
+type DecideBatchResult struct {
+	SignalID string          `json:"signal_id,omitempty"`
+	Symbol   string          `json:"symbol"`
+	Status   int             `json:"status"`             // 200 | 400 驗證失敗 | 409 同一信號處理中
+	Response *DecideResponse `json:"response,omitempty"` // status 200 時
+	Error    string          `json:"error,omitempty"`
+}
+
+type DecideBatchResponse struct {
+	Results []DecideBatchResult `json:"results"`
+}
+
+// RuleTestRequest POST /rules/test：以指定的規則/策略規格在沙盒中逐列重跑決策管線（不下單、不寫回、不暫占）
+type RuleTestRequest struct {
+	Rules      []json.RawMessage `json:"rules,omitempty"`      // strategy_rules 文件；空值使用現行 Bundle 規則
+	Strategies []string          `json:"strategies,omitempty"` // 策略規格 YAML 原文；空值使用已載入的策略規格
+	Symbol     string            `json:"symbol" validate:"required,min=3,regexp=^[A-Z0-9]+$"`
+	Market     Market            `json:"market" validate:"required,oneof=FUT SPOT"`
+	NAVUSDT    float64           `json:"nav_usdt,omitempty" validate:"gte=0"` // 倉位計算 NAV；0 使用 strategies.nav_usdt
+	Rows       []RuleTestRow     `json:"rows,omitempty" validate:"dive"`      // 特徵列（依序評估，持倉在列間延續）
+	Window     *SignalWindow     `json:"window,omitempty"`                    // 或重播 signals 中已記錄的特徵
+}
+
+// RuleTestRow 單列特徵；price 未提供時取特徵 mark_price/close/price
+type RuleTestRow struct {
+	SignalID string     `json:"signal_id,omitempty"`
+	Price    float64    `json:"price,omitempty" validate:"gte=0"`
+	Features FeatureSet `json:"features" validate:"required"`
+}
+
+// SignalWindow 已記錄信號區間（signals.timestamp，epoch ms；to 為 0 表示至今）
+type SignalWindow struct {
+	From  int64 `json:"from" validate:"gte=0"`
+	To    int64 `json:"to,omitempty" validate:"gte=0"`
+	Limit int   `json:"limit,omitempty" validate:"gte=0"`
+}
+
+// RuleTestResponse 各列決策與彙總
+type RuleTestResponse struct {
+	Rules      []string         `json:"rules"`      // 本次評估的規則 ID
+	Strategies []string         `json:"strategies"` // 本次評估的策略規格
+	Rows       []RuleTestResult `json:"rows"`
+	Summary    map[string]int   `json:"summary"` // 動作 → 列數
+}
+
+// RuleTestResult 單列結果；recorded 為重播信號當時記錄的決策
+type RuleTestResult struct {
+	Row         int                  `json:"row"`
+	SignalID    string               `json:"signal_id"`
+	Decision    Decision             `json:"decision"`
+	RulesFired  []string             `json:"rules_fired,omitempty"`
+	Intents     []OrderIntent        `json:"intents,omitempty"`
+	Transitions []PositionTransition `json:"transitions,omitempty"`
+	Trace       *DecisionTrace       `json:"trace,omitempty"`
+	Recorded    *Decision            `json:"recorded,omitempty"`
 }
 
 // ================================
@@ -222,13 +469,18 @@ type DecideResponse struct {
 
 // Signal 交易信號
 type Signal struct {
-	SignalID  string                 `json:"signal_id"`
-	Symbol    string                 `json:"symbol"`
-	Market    string                 `json:"market"`
-	Features  map[string]interface{} `json:"features"`
-	ConfigRev int                    `json:"config_rev"`
-	Timestamp int64                  `json:"timestamp"`
-	CreatedAt time.Time              `json:"created_at"`
+	SignalID   string                 `json:"signal_id"`
+	Symbol     string                 `json:"symbol"`
+	Market     string                 `json:"market"`
+	Features   map[string]interface{} `json:"features"`
+	ConfigRev  int                    `json:"config_rev"`
+	ConfigRole ConfigRole             `json:"config_role"`
+	Shadow     bool                   `json:"shadow,omitempty"`   // 影子評估記錄（未執行）；與實際決策共用 signal_id
+	Strategy   string                 `json:"strategy,omitempty"` // 規則路徑策略實例；非 rules 時文件鍵加上策略名
+	Decision   *Decision              `json:"decision,omitempty"`
+	Trace      *DecisionTrace         `json:"trace,omitempty"` // 決策可解釋性追蹤
+	Timestamp  int64                  `json:"timestamp"`
+	CreatedAt  time.Time              `json:"created_at"`
 }
 
 // StrategyRule 策略規則
@@ -261,21 +513,49 @@ type StrategyConfig struct {
 type RiskCheck struct {
 	CheckID   string    `json:"check_id"`
 	SignalID  string    `json:"signal_id"`
-	CheckType string    `json:"check_type"` // POSITION_SIZE/MARGIN/CORRELATION
+	CheckType string    `json:"check_type"` // POSITION_SIZE/MARGIN/CORRELATION/STRATEGY_BUDGET/ASSET_CLASS/NET_DELTA
 	Result    string    `json:"result"`     // PASS/FAIL/WARN
 	Message   string    `json:"message"`
+	Observed  float64   `json:"observed"`         // 下單後曝險（占 NAV）
+	Limit     float64   `json:"limit"`            // 上限（net_delta 為區間邊界）
+	Action    string    `json:"action,omitempty"` // 違反時的處置：prefer_higher_score/downsize_to_fit/skip_entry
 	Timestamp int64     `json:"timestamp"`
 	CreatedAt time.Time `json:"created_at"`
 }
 
+// 風險檢查類型與結果
+const (
+	RiskCheckCorrelation    = "CORRELATION"
+	RiskCheckStrategyBudget = "STRATEGY_BUDGET"
+	RiskCheckAssetClass     = "ASSET_CLASS"
+	RiskCheckNetDelta       = "NET_DELTA"
+
+	RiskResultPass = "PASS"
+	RiskResultFail = "FAIL"
+	RiskResultWarn = "WARN"
+)
+
+// ModelPath L2 評分實際採用的路徑
+type ModelPath string
+
+const (
+	ModelPathLocal     ModelPath = "LOCAL"      // 服務內模型（樹集成或啟發式）
+	ModelPathRemote    ModelPath = "REMOTE"     // 模型即服務
+	ModelPathRulesOnly ModelPath = "RULES_ONLY" // 模型逾時/不健康或純規則旗標：僅用規則倉位
+)
+
 // ModelScore 模型評分
 type ModelScore struct {
-	ScoreID    string    `json:"score_id"`
-	SignalID   string    `json:"signal_id"`
-	ModelName  string    `json:"model_name"`
-	Score      float64   `json:"score"`
-	Confidence float64   `json:"confidence"`
-	Features   string    `json:"features"` // JSON 字符串
-	Timestamp  int64     `json:"timestamp"`
-	CreatedAt  time.Time `json:"created_at"`
+	ScoreID        string    `json:"score_id"`
+	SignalID       string    `json:"signal_id"`
+	ModelName      string    `json:"model_name"`
+	ModelVersion   string    `json:"model_version,omitempty"`
+	Score          float64   `json:"score"`
+	Confidence     float64   `json:"confidence"`
+	Path           ModelPath `json:"path"`                      // LOCAL/REMOTE/RULES_ONLY
+	FallbackReason string    `json:"fallback_reason,omitempty"` // 退回純規則的原因
+	LatencyMs      int64     `json:"latency_ms"`
+	Features       string    `json:"features"` // JSON 字符串
+	Timestamp      int64     `json:"timestamp"`
+	CreatedAt      time.Time `json:"created_at"`
 }
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"s3-strategy/dao"
+	"s3-strategy/internal/config"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	goredis "github.com/go-redis/redis/v8"
+)
+
+// 決策冪等與批次預設值（env.yaml decide 區塊未設定時使用）
+const (
+	defaultIdempotencyTTL = 24 * time.Hour
+	defaultInFlightWait   = 2 * time.Second
+	defaultBatchWorkers   = 8
+	defaultMaxBatch       = 200
+	decisionResultPrefix  = "decide:result:"
+	decisionClaimLease    = 30 * time.Second // 決策處理中的租約（逾時視為中斷，重送可重新決策）
+	decisionPollInterval  = 50 * time.Millisecond
+)
+
+// errDecisionInFlight 同一信號正在決策中，等待逾時；呼叫端稍後重送即可取得結果
+var errDecisionInFlight = errors.New("decision for this signal is in progress")
+
+// DecisionStore 以 signal_id + 配置版本保存決策回應：先占處理權，決策完成後保存；重送時回傳已保存的回應
+type DecisionStore interface {
+	Claim(ctx context.Context, key string, lease time.Duration) (*dao.DecideResponse, dedupeState, error)
+	Save(ctx context.Context, key string, response dao.DecideResponse, ttl time.Duration) error
+	Abandon(ctx context.Context, key string) error
+}
+
+// decisionKey decide:result:<signal_id>:r<rev>
+func decisionKey(signalID string, rev int) string {
+	return fmt.Sprintf("%s%s:r%d", decisionResultPrefix, signalID, rev)
+}
+
+// RedisDecisionStore 鍵值為 processing（租約）或決策回應 JSON（保留 idempotency_ttl）
+type RedisDecisionStore struct {
+	client goredis.Cmdable
+}
+
+func (r *RedisDecisionStore) Claim(ctx context.Context, key string, lease time.Duration) (*dao.DecideResponse, dedupeState, error) {
+	ok, err := r.client.SetNX(ctx, key, dedupeValueProcessing, lease).Result()
+	if err != nil {
+		return nil, dedupeBusy, err
+	}
+	if ok {
+		return nil, dedupeClaimed, nil
+	}
+	value, err := r.client.Get(ctx, key).Result()
+	if err == goredis.Nil {
+		// 租約剛好到期：重新搶占
+		return r.Claim(ctx, key, lease)
+	}
+	if err != nil {
+		return nil, dedupeBusy, err
+	}
+	if value == dedupeValueProcessing {
+		return nil, dedupeBusy, nil
+	}
+	var stored dao.DecideResponse
+	if err := json.Unmarshal([]byte(value), &stored); err != nil {
+		return nil, dedupeBusy, fmt.Errorf("decode stored decision %s: %w", key, err)
+	}
+	return &stored, dedupeDone, nil
+}
+
+func (r *RedisDecisionStore) Save(ctx context.Context, key string, response dao.DecideResponse, ttl time.Duration) error {
+	payload, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+	return r.client.Set(ctx, key, payload, ttl).Err()
+}
+
+func (r *RedisDecisionStore) Abandon(ctx context.Context, key string) error {
+	return r.client.Del(ctx, key).Err()
+}
+
+// MemoryDecisionStore 單機保存（測試與無 Redis 時使用）
+type MemoryDecisionStore struct {
+	mu      sync.Mutex
+	entries map[string]memoryDecisionEntry
+	now     func() time.Time
+}
+
+type memoryDecisionEntry struct {
+	response  *dao.DecideResponse // nil 表示處理中
+	expiresAt time.Time
+}
+
+func NewMemoryDecisionStore() *MemoryDecisionStore {
+	return &MemoryDecisionStore{entries: make(map[string]memoryDecisionEntry), now: time.Now}
+}
+
+func (m *MemoryDecisionStore) Claim(_ context.Context, key string, lease time.Duration) (*dao.DecideResponse, dedupeState, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	if entry, ok := m.entries[key]; ok && now.Before(entry.expiresAt) {
+		if entry.response != nil {
+			stored := *entry.response
+			return &stored, dedupeDone, nil
+		}
+		return nil, dedupeBusy, nil
+	}
+	m.entries[key] = memoryDecisionEntry{expiresAt: now.Add(lease)}
+	return nil, dedupeClaimed, nil
+}
+
+func (m *MemoryDecisionStore) Save(_ context.Context, key string, response dao.DecideResponse, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries[key] = memoryDecisionEntry{response: &response, expiresAt: m.now().Add(ttl)}
+	return nil
+}
+
+func (m *MemoryDecisionStore) Abandon(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, key)
+	return nil
+}
+
+// decideConfig 決策冪等與批次設定
+type decideConfig struct {
+	idempotencyTTL time.Duration
+	inFlightWait   time.Duration
+	batchWorkers   int
+	maxBatch       int
+}
+
+func newDecideConfig() decideConfig {
+	cfg := config.AppConfig.Decide
+	dc := decideConfig{
+		idempotencyTTL: durationOr(cfg.IdempotencyTTL, defaultIdempotencyTTL),
+		inFlightWait:   durationOr(cfg.InFlightWait, defaultInFlightWait),
+		batchWorkers:   cfg.BatchWorkers,
+		maxBatch:       cfg.MaxBatch,
+	}
+	if dc.batchWorkers <= 0 {
+		dc.batchWorkers = defaultBatchWorkers
+	}
+	if dc.maxBatch <= 0 {
+		dc.maxBatch = defaultMaxBatch
+	}
+	return dc
+}
+
+// initializeDecisionStore 決策冪等：Redis 未連線時以單機記憶體保存；idempotency_ttl 為 0 時停用
+func (s *S3_STRATEGYServer) initializeDecisionStore() {
+	s.decideOpts = newDecideConfig()
+	if s.decideOpts.idempotencyTTL == 0 {
+		log.Printf("Decision idempotency disabled")
+		return
+	}
+	if s.redisClient == nil {
+		log.Printf("Decision idempotency using in-memory store: redis not connected")
+		s.decisions = NewMemoryDecisionStore()
+		return
+	}
+	s.decisions = &RedisDecisionStore{client: s.redisClient.Client}
+}
+
+// decideOnce 以 signal_id + 配置版本冪等的決策：已決策過則回傳保存的回應（replayed），處理中則等待至 in_flight_wait。
+// 未帶 signal_id、dry_run 或未啟用時直接決策；保存層無法使用時不經冪等直接決策（intent_id 依 signal_id 固定，下游仍冪等）
+func (s *S3_STRATEGYServer) decideOnce(ctx context.Context, req *dao.DecideRequest) (dao.DecideResponse, error) {
+	if s.decisions == nil || req.SignalID == "" || req.DryRun {
+		return s.decide(req), nil
+	}
+	response, err := s.decideStored(ctx, req, s.decisions, s.decideOpts.idempotencyTTL, s.decideOpts.inFlightWait)
+	if errors.Is(err, errDecisionStore) {
+		log.Printf("Deciding %s without idempotency: %v", req.SignalID, err)
+		return s.decide(req), nil
+	}
+	return response, err
+}
+
+// errDecisionStore 決策保存層讀取失敗
+var errDecisionStore = errors.New("decision store unavailable")
+
+// decideStored 先占 store 中的決策鍵：已保存則回放，取得處理權則決策並在回傳前保存，處理中則等待至 wait 後回傳 errDecisionInFlight
+func (s *S3_STRATEGYServer) decideStored(ctx context.Context, req *dao.DecideRequest, store DecisionStore, ttl, wait time.Duration) (dao.DecideResponse, error) {
+	serving, _, _, _ := s.configManager.route(req)
+	key := decisionKey(req.SignalID, serving.Rev())
+	deadline := time.Now().Add(wait)
+	for {
+		stored, state, err := store.Claim(ctx, key, decisionClaimLease)
+		if err != nil {
+			return dao.DecideResponse{}, fmt.Errorf("%w: %v", errDecisionStore, err)
+		}
+		switch state {
+		case dedupeDone:
+			stored.Replayed = true
+			return *stored, nil
+		case dedupeClaimed:
+			return s.decideAndSave(ctx, req, store, key, ttl), nil
+		}
+		if !time.Now().Before(deadline) {
+			return dao.DecideResponse{}, errDecisionInFlight
+		}
+		select {
+		case <-ctx.Done():
+			return dao.DecideResponse{}, errDecisionInFlight
+		case <-time.After(decisionPollInterval):
+		}
+	}
+}
+
+// decideAndSave 決策並保存回應；熱載使實際版本與占用時不同時，以實際版本保存並釋放原占用
+func (s *S3_STRATEGYServer) decideAndSave(ctx context.Context, req *dao.DecideRequest, store DecisionStore, claimed string, ttl time.Duration) dao.DecideResponse {
+	response := s.decide(req)
+	key := decisionKey(req.SignalID, response.ConfigRev)
+	saveCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), signalSaveTimeout)
+	defer cancel()
+	if err := store.Save(saveCtx, key, response, ttl); err != nil {
+		log.Printf("Failed to save decision %s: %v", key, err)
+	}
+	if key != claimed {
+		if err := store.Abandon(saveCtx, claimed); err != nil {
+			log.Printf("Failed to release decision claim %s: %v", claimed, err)
+		}
+	}
+	return response
+}
+
+// streamDecider 串流決策與心跳使用的 decideOnce：回應在意圖送出前保存，送出失敗重試時回放保存的意圖（不重跑管線）；
+// 保存層讀取失敗與處理中皆回傳錯誤，訊息不 ACK 待重試
+func (s *S3_STRATEGYServer) streamDecider(store DecisionStore, ttl time.Duration) func(context.Context, *dao.DecideRequest) (dao.DecideResponse, error) {
+	return func(ctx context.Context, req *dao.DecideRequest) (dao.DecideResponse, error) {
+		if req.DryRun {
+			return s.decide(req), nil
+		}
+		return s.decideStored(ctx, req, store, ttl, 0)
+	}
+}
+
+// stripTraces 未要求 explain 時不回傳決策追蹤
+func stripTraces(response *dao.DecideResponse) {
+	response.Trace = nil
+	for i := range response.Strategies {
+		response.Strategies[i].Trace = nil
+	}
+}
+
+// decideBatch 依交易對分組：同一交易對依序決策（持倉狀態延續），不同交易對以 batch_workers 個 worker 並行
+func (s *S3_STRATEGYServer) decideBatch(ctx context.Context, requests []dao.DecideRequest, explain bool) []dao.DecideBatchResult {
+	results := make([]dao.DecideBatchResult, len(requests))
+	var symbols []string
+	groups := make(map[string][]int)
+	for i := range requests {
+		req := &requests[i]
+		results[i] = dao.DecideBatchResult{SignalID: req.SignalID, Symbol: req.Symbol}
+		if err := s.validator.Struct(req); err != nil {
+			results[i].Status, results[i].Error = http.StatusBadRequest, err.Error()
+			continue
+		}
+		if _, ok := groups[req.Symbol]; !ok {
+			symbols = append(symbols, req.Symbol)
+		}
+		groups[req.Symbol] = append(groups[req.Symbol], i)
+	}
+
+	workers := s.decideOpts.batchWorkers
+	if workers <= 0 {
+		workers = defaultBatchWorkers
+	}
+	if workers > len(symbols) {
+		workers = len(symbols)
+	}
+	jobs := make(chan []int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for group := range jobs {
+				for _, i := range group {
+					response, err := s.decideOnce(ctx, &requests[i])
+					if err != nil {
+						results[i].Status, results[i].Error = http.StatusConflict, err.Error()
+						continue
+					}
+					if !explain {
+						stripTraces(&response)
+					}
+					results[i].Status, results[i].Response = http.StatusOK, &response
+				}
+			}
+		}()
+	}
+	for _, symbol := range symbols {
+		jobs <- groups[symbol]
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+// @Summary Make trading decisions in batch
+// @Description Decide many signals in one call; the same symbol is decided in order, different symbols in parallel
+// @Tags strategy
+// @Accept json
+// @Produce json
+// @Param request body apispec.DecideBatchRequest true "Batch decision request"
+// @Param explain query bool false "Return the decision traces"
+// @Success 200 {object} apispec.DecideBatchResponse
+// @Failure 400 {object} map[string]string
+// @Router /decide/batch [post]
+func (s *S3_STRATEGYServer) DecideBatch(c *gin.Context) {
+	var req dao.DecideBatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format", "details": err.Error()})
+		return
+	}
+	if err := s.validator.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "details": err.Error()})
+		return
+	}
+	maxBatch := s.decideOpts.maxBatch
+	if maxBatch <= 0 {
+		maxBatch = defaultMaxBatch
+	}
+	if len(req.Requests) > maxBatch {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Batch too large", "details": fmt.Sprintf("at most %d requests per batch", maxBatch)})
+		return
+	}
+
+	results := s.decideBatch(c.Request.Context(), req.Requests, c.Query("explain") == "true")
+	c.JSON(http.StatusOK, dao.DecideBatchResponse{Results: results})
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"s3-strategy/dao"
+)
+
+func newIdempotentServer(t *testing.T) *S3_STRATEGYServer {
+	t.Helper()
+	s := newTestServer(t)
+	s.decisions = NewMemoryDecisionStore()
+	s.decideOpts = decideConfig{idempotencyTTL: time.Hour, inFlightWait: 100 * time.Millisecond, batchWorkers: 2, maxBatch: 3}
+	return s
+}
+
+func decideBody(signalID, symbol string) string {
+	body, _ := json.Marshal(dao.DecideRequest{SignalID: signalID, Symbol: symbol, Market: dao.MarketFUT, ConfigRev: "CURRENT", Features: hostedFeatures(nil)})
+	return string(body)
+}
+
+func TestDecide_Idempotent(t *testing.T) {
+	s := newIdempotentServer(t)
+
+	// 重送同一 signal_id：回傳保存的決策（不因既有持倉變成 skip，也不產生新意圖）
+	first := postDecide(t, s, "", decideBody("sig-1", "BTCUSDT"))
+	retry := postDecide(t, s, "", decideBody("sig-1", "BTCUSDT"))
+	if first.Decision.Action != dao.DecisionOpen || first.Replayed || !retry.Replayed || retry.Decision.Action != dao.DecisionOpen ||
+		len(retry.Intents) != 1 || retry.Intents[0].IntentID != first.Intents[0].IntentID {
+		t.Fatalf("first %+v\nretry %+v", first, retry)
+	}
+	if explained := postDecide(t, s, "?explain=true", decideBody("sig-1", "BTCUSDT")); explained.Trace == nil {
+		t.Errorf("replayed decision lost its trace")
+	}
+
+	// 新信號與新配置版本重新決策
+	if next := postDecide(t, s, "", decideBody("sig-2", "BTCUSDT")); next.Replayed || next.Decision.Action != dao.DecisionSkip {
+		t.Errorf("new signal = %+v", next.Decision)
+	}
+	snapshot, err := buildConfigSnapshot(activeBundle{Rev: 7, BundleID: "b-7", RuleIDs: []string{"R-001", "R-002"}}, defaultStrategyRules())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.configManager.Swap(snapshot)
+	if redo := postDecide(t, s, "", decideBody("sig-1", "BTCUSDT")); redo.Replayed || redo.ConfigRev != 7 || redo.Decision.Action != dao.DecisionSkip {
+		t.Errorf("new config rev = %+v", redo)
+	}
+
+	// dry_run 不保存也不回放
+	dry := `{"signal_id":"sig-3","symbol":"ETHUSDT","market":"FUT","config_rev":"CURRENT","dry_run":true,"features":{"spread_bps":1.5,"ew_dir":1,"invalidation_px":59000}}`
+	postDecide(t, s, "", dry)
+	if again := postDecide(t, s, "", dry); again.Replayed {
+		t.Errorf("dry run replayed")
+	}
+
+	// 同一信號處理中：等待 in_flight_wait 後回 409
+	if _, _, err := s.decisions.Claim(context.Background(), decisionKey("sig-4", 7), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/decide", s.Decide)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/decide", strings.NewReader(decideBody("sig-4", "BTCUSDT"))))
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), "Decision in progress") {
+		t.Errorf("in flight: %d %s", w.Code, w.Body.String())
+	}
+}
+
+func postDecideBatch(t *testing.T, s *S3_STRATEGYServer, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/decide/batch", s.DecideBatch)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/decide/batch", strings.NewReader(body)))
+	return w
+}
+
+func TestDecideBatch(t *testing.T) {
+	s := newIdempotentServer(t)
+	body := `{"requests":[` + decideBody("sig-a", "BTCUSDT") + `,` + decideBody("sig-b", "ETHUSDT") + `,` +
+		decideBody("sig-a", "BTCUSDT") + `]}`
+
+	w := postDecideBatch(t, s, body)
+	var response dao.DecideBatchResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil || w.Code != http.StatusOK || len(response.Results) != 3 {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	a, b, dup := response.Results[0], response.Results[1], response.Results[2]
+	if a.Status != http.StatusOK || a.Response.Decision.Action != dao.DecisionOpen || a.Response.Replayed || a.Response.Trace != nil {
+		t.Errorf("BTCUSDT = %+v", a)
+	}
+	if b.Status != http.StatusOK || b.Symbol != "ETHUSDT" || b.Response.Decision.Action != dao.DecisionOpen {
+		t.Errorf("ETHUSDT = %+v", b)
+	}
+	// 同一交易對依序處理：批次內重複的信號回放第一筆
+	if dup.Status != http.StatusOK || !dup.Response.Replayed || dup.Response.Intents[0].IntentID != a.Response.Intents[0].IntentID {
+		t.Errorf("duplicate = %+v", dup)
+	}
+
+	// 單筆驗證失敗只影響該筆；超過 max_batch 整批拒絕
+	w = postDecideBatch(t, s, `{"requests":[{"symbol":"btc","market":"FUT","config_rev":"CURRENT"},`+decideBody("sig-a", "BTCUSDT")+`]}`)
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil || response.Results[0].Status != http.StatusBadRequest || response.Results[1].Status != http.StatusOK {
+		t.Errorf("invalid item: %s", w.Body.String())
+	}
+	many := `{"requests":[` + strings.Repeat(decideBody("sig-x", "BTCUSDT")+",", 3) + decideBody("sig-x", "BTCUSDT") + `]}`
+	if w = postDecideBatch(t, s, many); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "at most 3") {
+		t.Errorf("oversized batch: %d %s", w.Code, w.Body.String())
+	}
+	if w = postDecideBatch(t, s, `{"requests":[]}`); w.Code != http.StatusBadRequest {
+		t.Errorf("empty batch: %d", w.Code)
+	}
+}
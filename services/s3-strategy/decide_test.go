@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"s3-strategy/dao"
+	"s3-strategy/internal/sizing"
+	"s3-strategy/internal/strategy"
+)
+
+// staticMarketData 固定價格/NAV/交易所限制
+type staticMarketData struct {
+	price   float64
+	nav     float64
+	filters sizing.Filters
+	err     error
+}
+
+func (m *staticMarketData) Price(context.Context, string, dao.Market) (float64, error) {
+	return m.price, m.err
+}
+
+func (m *staticMarketData) NAV(context.Context) (float64, error) {
+	return m.nav, nil
+}
+
+func (m *staticMarketData) Filters(context.Context, string) (sizing.Filters, error) {
+	return m.filters, nil
+}
+
+func newTestServer(t *testing.T) *S3_STRATEGYServer {
+	t.Helper()
+	s := &S3_STRATEGYServer{
+		validator:      newValidator(),
+		gateKeeper:     &GateKeeper{maxFundingAbs: 0.0005, spreadBpLimit: 3.0, depthTop1UsdtMin: 200.0},
+		mlModel:        &MLModel{modelName: "default_model", version: "v1.0"},
+		configManager:  &ConfigManager{},
+		sizing:         newSizingConfig(),
+		direction:      newDirectionConfig(),
+		strategyRunner: &strategy.Runner{Store: strategy.NewMemoryPositionStore()},
+		marketData: &staticMarketData{
+			price:   60000,
+			nav:     10000,
+			filters: sizing.Filters{TickSize: 0.1, StepSize: 0.001, MinQty: 0.001, MinNotional: 5},
+		},
+	}
+	snapshot, err := buildConfigSnapshot(defaultBundle(), defaultStrategyRules())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.configManager.Swap(snapshot)
+	return s
+}
+
+func postDecide(t *testing.T, s *S3_STRATEGYServer, query, body string) dao.DecideResponse {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/decide", s.Decide)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/decide"+query, strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	var response dao.DecideResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	return response
+}
+
+func TestDecide_ExplainTrace(t *testing.T) {
+	s := newTestServer(t)
+	body := `{"signal_id":"sig-1","symbol":"BTCUSDT","market":"FUT","config_rev":"CURRENT","dry_run":true,
+		"features":{"spread_bps":1.5,"rv_pctile_30d":0.1,"rho_usdttwd_14":-0.5,"atr_pct":0.5,"rv_pct":0.1,"invalidation_px":59000}}`
+
+	if response := postDecide(t, s, "", body); response.Trace != nil {
+		t.Error("trace must only be returned with ?explain=true")
+	}
+
+	trace := postDecide(t, s, "?explain=true", body).Trace
+	if trace == nil {
+		t.Fatal("missing trace")
+	}
+	if len(trace.Gates) != 3 || trace.Gates[1].Gate != "spread" || *trace.Gates[1].Observed != 1.5 || trace.Gates[0].Note != "missing" {
+		t.Errorf("gates = %+v", trace.Gates)
+	}
+
+	// R-001 命中（乘積 1.2），R-002 缺 correlation → UNKNOWN
+	if len(trace.Rules) != 2 || trace.Rules[0].RuleID != "R-001" || !trace.Rules[0].Fired || trace.Rules[1].Result != "UNKNOWN" {
+		t.Fatalf("rules = %+v", trace.Rules)
+	}
+	if c := trace.Rules[0].Conditions[1]; c.Expr != "rho_usdttwd_14 < -0.3" || c.Operands[0].Value != -0.5 {
+		t.Errorf("condition = %+v", c)
+	}
+	if m := trace.Multipliers[0]; m.Name != "size_mult" || m.Product != 1.2 || m.Clamped {
+		t.Errorf("size_mult = %+v", m)
+	}
+	if m := trace.Multipliers[2]; m.Name != "sl_mult" || m.Value != 0.5 {
+		t.Errorf("sl_mult = %+v", m)
+	}
+
+	// 啟發式分數 0.5 + 0.1 + 0.15 = 0.75 → ×1.0
+	if trace.Model == nil || trace.Model.Path != dao.ModelPathLocal || trace.Model.SizeMult != 1.0 || len(trace.Model.Contributions) != 2 || trace.Model.Contributions[0].Feature != "rv_pct" {
+		t.Errorf("model = %+v", trace.Model)
+	}
+	// 風險 10000 × 1% × 1.2 = 120 USDT；距離 1000 → 0.12 BTC
+	if sz := trace.Sizing; sz == nil || sz.ConvictionMult != 1.2 || sz.RiskCashUSDT != 120 || sz.Qty != 0.12 || sz.NotionalUSDT != 7200 || sz.MarginUSDT != 360 {
+		t.Errorf("sizing = %+v", sz)
+	}
+}
+
+func TestDecide_GateFailureTrace(t *testing.T) {
+	s := newTestServer(t)
+	response := postDecide(t, s, "?explain=true", `{"symbol":"BTCUSDT","market":"FUT","config_rev":"CURRENT","features":{"spread_bps":5,"depth_top1_usdt":100}}`)
+	if response.Decision.Action != dao.DecisionSkip || !strings.HasPrefix(response.Decision.Reason, "spread too wide") {
+		t.Fatalf("decision = %+v", response.Decision)
+	}
+	gates := response.Trace.Gates
+	if gates[1].Passed || gates[2].Passed || response.Trace.Rules != nil {
+		t.Errorf("trace = %+v", response.Trace)
+	}
+}
+
+func TestDecide_RiskByInvalidation(t *testing.T) {
+	s := newTestServer(t)
+	req := &dao.DecideRequest{
+		SignalID: "sig-2",
+		Symbol:   "BTCUSDT",
+		Market:   dao.MarketFUT,
+		Features: dao.FeatureSet{"spread_bps": 1.5, "rv_pctile_30d": 0.1, "rho_usdttwd_14": -0.5, "atr_pct": 0.5, "rv_pct": 0.1,
+			"wave_invalidation_px_4h": 61500.0},
+	}
+
+	// 失效價在上方 → 空單；硬止損為失效價
+	response := s.decide(req)
+	if len(response.Intents) != 1 {
+		t.Fatalf("response = %+v", response)
+	}
+	intent := response.Intents[0]
+	if response.Decision.Action != dao.DecisionOpen || response.Decision.Side != dao.PosShort {
+		t.Errorf("decision = %+v", response.Decision)
+	}
+	if intent.Side != dao.SideSell || intent.Qty != 0.08 || intent.NotionalUSDT != 4800 || intent.Leverage != 20 || intent.ExecPolicy.SLPct != 0.025 {
+		t.Errorf("intent = %+v", intent)
+	}
+
+	// 以下每次皆從無持倉開始
+	// S1 價格不可用時退回特徵快照價格
+	s.strategyRunner.Store = strategy.NewMemoryPositionStore()
+	s.marketData.(*staticMarketData).err = errors.New("connection refused")
+	req.Features["mark_price"] = 61000.0
+	if response = s.decide(req); response.Trace.Sizing.EntryPx != 61000 || response.Intents[0].Qty != 0.24 {
+		t.Errorf("fallback sizing = %+v", response.Trace.Sizing)
+	}
+
+	// 無失效價：不進場
+	s.strategyRunner.Store = strategy.NewMemoryPositionStore()
+	delete(req.Features, "wave_invalidation_px_4h")
+	response = s.decide(req)
+	if response.Decision.Action != dao.DecisionSkip || !strings.HasPrefix(response.Decision.Reason, "sizing: invalidation price unavailable") || len(response.Intents) != 0 {
+		t.Errorf("decision = %+v", response.Decision)
+	}
+}
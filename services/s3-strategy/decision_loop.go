@@ -0,0 +1,470 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"s3-strategy/dao"
+	"s3-strategy/internal/config"
+	"s3-strategy/internal/services/redis"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	goredis "github.com/go-redis/redis/v8"
+)
+
+// 串流決策預設值（env.yaml decision_loop 區塊未設定時使用）
+const (
+	defaultFeatureStreamPrefix = "feat:events:"
+	defaultCmdStreamPrefix     = "ord:cmd:"
+	defaultDecisionGroup       = "s3-strategy"
+	defaultClaimIdle           = time.Minute
+	defaultDedupeTTL           = 24 * time.Hour
+	defaultMaxEventAge         = 5 * time.Minute
+	intentSinkHTTP             = "http"
+	intentSinkStream           = "stream"
+	signalDedupePrefix         = "sig:dedupe:"
+	decisionLoopBlock          = 5 * time.Second
+	decisionLoopBatch          = 50
+	decisionLoopRetryDelay     = 2 * time.Second
+	intentSendTimeout          = 3 * time.Second
+)
+
+// errSignalInFlight 同一信號正由其他消費者處理；不 ACK，逾時後由 reclaim 接手
+var errSignalInFlight = errors.New("signal is being processed by another consumer")
+
+// IntentSink 意圖下游：S4 POST /orders 或 ord:cmd:{SYMBOL}
+type IntentSink interface {
+	Send(ctx context.Context, intent dao.OrderIntent) error
+}
+
+// httpIntentSink 呼叫 S4 POST /orders；4xx 視為永久拒絕（記錄後不重試），5xx/連線錯誤回傳錯誤以重試
+type httpIntentSink struct {
+	url    string
+	client *http.Client
+}
+
+func (h *httpIntentSink) Send(ctx context.Context, intent dao.OrderIntent) error {
+	body, err := json.Marshal(dao.OrderCmdRequest{Intent: intent})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	payload, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	switch {
+	case resp.StatusCode >= 500:
+		return fmt.Errorf("order router returned %d: %s", resp.StatusCode, bytes.TrimSpace(payload))
+	case resp.StatusCode >= 400:
+		log.Printf("Order router rejected intent %s (%d): %s", intent.IntentID, resp.StatusCode, bytes.TrimSpace(payload))
+	}
+	return nil
+}
+
+// streamIntentSink 寫入 ord:cmd:{SYMBOL}（cmd_id = intent_id）
+type streamIntentSink struct {
+	client *redis.RedisClient
+	prefix string
+}
+
+func (st *streamIntentSink) Send(ctx context.Context, intent dao.OrderIntent) error {
+	payload, err := json.Marshal(intent)
+	if err != nil {
+		return err
+	}
+	_, err = st.client.PublishStream(ctx, st.prefix+intent.Symbol, redis.StreamMessage{
+		"cmd_id": intent.IntentID,
+		"ts":     time.Now().UnixMilli(),
+		"symbol": intent.Symbol,
+		"market": string(intent.Market),
+		"intent": string(payload),
+	})
+	return err
+}
+
+// dedupeState 信號去重狀態
+type dedupeState int
+
+const (
+	dedupeClaimed dedupeState = iota // 首次處理（已取得處理權）
+	dedupeDone                       // 已完成並送出意圖
+	dedupeBusy                       // 其他消費者處理中
+)
+
+// SignalDedupe 以 signal_id 去重：先占處理權，意圖送出後標記完成；失敗時放棄以便重試
+type SignalDedupe interface {
+	Claim(ctx context.Context, signalID string, lease time.Duration) (dedupeState, error)
+	Done(ctx context.Context, signalID string, ttl time.Duration) error
+	Abandon(ctx context.Context, signalID string) error
+}
+
+const (
+	dedupeValueProcessing = "processing"
+	dedupeValueDone       = "done"
+)
+
+// RedisSignalDedupe sig:dedupe:<signal_id> = processing（租約）| done（保留 dedupe_ttl）
+type RedisSignalDedupe struct {
+	client goredis.Cmdable
+}
+
+func (r *RedisSignalDedupe) Claim(ctx context.Context, signalID string, lease time.Duration) (dedupeState, error) {
+	key := signalDedupePrefix + signalID
+	ok, err := r.client.SetNX(ctx, key, dedupeValueProcessing, lease).Result()
+	if err != nil {
+		return dedupeBusy, err
+	}
+	if ok {
+		return dedupeClaimed, nil
+	}
+	value, err := r.client.Get(ctx, key).Result()
+	if err == goredis.Nil {
+		// 租約剛好到期：重新搶占
+		return r.Claim(ctx, signalID, lease)
+	}
+	if err != nil {
+		return dedupeBusy, err
+	}
+	if value == dedupeValueDone {
+		return dedupeDone, nil
+	}
+	return dedupeBusy, nil
+}
+
+func (r *RedisSignalDedupe) Done(ctx context.Context, signalID string, ttl time.Duration) error {
+	return r.client.Set(ctx, signalDedupePrefix+signalID, dedupeValueDone, ttl).Err()
+}
+
+func (r *RedisSignalDedupe) Abandon(ctx context.Context, signalID string) error {
+	return r.client.Del(ctx, signalDedupePrefix+signalID).Err()
+}
+
+// MemorySignalDedupe 單機去重（測試與無 Redis 時使用）
+type MemorySignalDedupe struct {
+	mu      sync.Mutex
+	entries map[string]memoryDedupeEntry
+	now     func() time.Time
+}
+
+type memoryDedupeEntry struct {
+	value     string
+	expiresAt time.Time
+}
+
+func NewMemorySignalDedupe() *MemorySignalDedupe {
+	return &MemorySignalDedupe{entries: make(map[string]memoryDedupeEntry), now: time.Now}
+}
+
+func (m *MemorySignalDedupe) Claim(_ context.Context, signalID string, lease time.Duration) (dedupeState, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	if entry, ok := m.entries[signalID]; ok && now.Before(entry.expiresAt) {
+		if entry.value == dedupeValueDone {
+			return dedupeDone, nil
+		}
+		return dedupeBusy, nil
+	}
+	m.entries[signalID] = memoryDedupeEntry{value: dedupeValueProcessing, expiresAt: now.Add(lease)}
+	return dedupeClaimed, nil
+}
+
+func (m *MemorySignalDedupe) Done(_ context.Context, signalID string, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries[signalID] = memoryDedupeEntry{value: dedupeValueDone, expiresAt: m.now().Add(ttl)}
+	return nil
+}
+
+func (m *MemorySignalDedupe) Abandon(_ context.Context, signalID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, signalID)
+	return nil
+}
+
+// decisionLoop 將 feat:events 特徵快照轉為 DecideRequest，執行決策管線並轉送意圖
+type decisionLoop struct {
+	decide    func(ctx context.Context, req *dao.DecideRequest) (dao.DecideResponse, error) // 保存回應後回傳；重試回放同一回應
+	sink      IntentSink
+	dedupe    SignalDedupe
+	market    dao.Market
+	dryRun    bool
+	claimIdle time.Duration
+	dedupeTTL time.Duration
+	maxAge    time.Duration
+	now       func() time.Time
+	symbols   []string
+
+	seenMu   sync.Mutex
+	lastSeen map[string]time.Time // 各標的最近一次收到 feat:events 的時間（決策心跳判斷靜默）
+}
+
+// touch 記錄標的收到特徵事件
+func (l *decisionLoop) touch(symbol string, at time.Time) {
+	l.seenMu.Lock()
+	defer l.seenMu.Unlock()
+	if l.lastSeen == nil {
+		l.lastSeen = make(map[string]time.Time)
+	}
+	l.lastSeen[symbol] = at
+}
+
+// quiet 標的逾 after 未收到特徵事件；首次查詢以當下為起點（啟動後先等待一個靜默週期）
+func (l *decisionLoop) quiet(symbol string, now time.Time, after time.Duration) bool {
+	l.seenMu.Lock()
+	defer l.seenMu.Unlock()
+	last, ok := l.lastSeen[symbol]
+	if !ok {
+		if l.lastSeen == nil {
+			l.lastSeen = make(map[string]time.Time)
+		}
+		l.lastSeen[symbol] = now
+		return false
+	}
+	return now.Sub(last) >= after
+}
+
+// featureEventRequest 解析 FeatureEvent（ts, market, symbol, features JSON；confirmed=false 的未收盤快照略過）
+func (l *decisionLoop) featureEventRequest(symbol, msgID string, values map[string]interface{}) (*dao.DecideRequest, error) {
+	if confirmed, ok := values["confirmed"]; ok {
+		if v, err := strconv.ParseBool(fmt.Sprint(confirmed)); err == nil && !v {
+			return nil, nil
+		}
+	}
+	if sym, ok := values["symbol"].(string); ok && sym != "" {
+		symbol = strings.ToUpper(sym)
+	}
+	market := l.market
+	if m, ok := values["market"].(string); ok && m != "" {
+		market = dao.Market(strings.ToUpper(m))
+	}
+
+	var features dao.FeatureSet
+	raw, _ := values["features"].(string)
+	if err := json.Unmarshal([]byte(raw), &features); err != nil {
+		return nil, fmt.Errorf("invalid features payload: %w", err)
+	}
+
+	ts, _ := strconv.ParseInt(fmt.Sprint(values["ts"]), 10, 64)
+	if ts > 0 && l.maxAge > 0 && l.now().Sub(time.UnixMilli(ts)) > l.maxAge {
+		log.Printf("Skipping stale feature event %s for %s (ts %d)", msgID, symbol, ts)
+		return nil, nil
+	}
+
+	// 同一快照重送得到相同 signal_id（去重、intent_id 皆依此）
+	signalID, _ := values["signal_id"].(string)
+	if signalID == "" {
+		if ts > 0 {
+			signalID = fmt.Sprintf("sig_%s_%s_%d", symbol, market, ts)
+		} else {
+			signalID = fmt.Sprintf("sig_%s_%s_%s", symbol, market, msgID)
+		}
+	}
+	return &dao.DecideRequest{
+		SignalID:  signalID,
+		Symbol:    symbol,
+		Market:    market,
+		Features:  features,
+		ConfigRev: "CURRENT",
+		DryRun:    l.dryRun,
+	}, nil
+}
+
+// handle 處理一則特徵事件；回傳 nil 才 ACK（至少一次）
+func (l *decisionLoop) handle(ctx context.Context, symbol, msgID string, values map[string]interface{}) error {
+	req, err := l.featureEventRequest(symbol, msgID, values)
+	if err != nil {
+		// 格式錯誤重試也不會成功：記錄後 ACK
+		log.Printf("Dropping feature event %s on %s: %v", msgID, symbol, err)
+		return nil
+	}
+	if req == nil {
+		return nil
+	}
+
+	state, err := l.dedupe.Claim(ctx, req.SignalID, l.claimIdle)
+	if err != nil {
+		return fmt.Errorf("dedupe %s: %w", req.SignalID, err)
+	}
+	switch state {
+	case dedupeDone:
+		return nil
+	case dedupeBusy:
+		return errSignalInFlight
+	}
+
+	// 決策回應先保存再送出：送出失敗重試時回放相同意圖，不因持倉已寫入而改判為加倉或略過
+	response, err := l.decide(ctx, req)
+	if err != nil {
+		l.release(ctx, req.SignalID)
+		if errors.Is(err, errDecisionInFlight) {
+			return errSignalInFlight
+		}
+		return fmt.Errorf("decide %s: %w", req.SignalID, err)
+	}
+	for _, intent := range response.Intents {
+		sendCtx, cancel := context.WithTimeout(ctx, intentSendTimeout)
+		err := l.sink.Send(sendCtx, intent)
+		cancel()
+		if err != nil {
+			// 下次重試回放保存的意圖，以相同 intent_id 重送，下游依 intent_id 冪等
+			l.release(ctx, req.SignalID)
+			return fmt.Errorf("forward intent %s: %w", intent.IntentID, err)
+		}
+	}
+	if len(response.Intents) > 0 {
+		log.Printf("Signal %s: %s, forwarded %d intents (config rev %d, replayed %v)", req.SignalID, response.Decision.Action, len(response.Intents), response.ConfigRev, response.Replayed)
+	}
+	return l.dedupe.Done(ctx, req.SignalID, l.dedupeTTL)
+}
+
+// release 釋放信號的去重租約，讓重試立即接手
+func (l *decisionLoop) release(ctx context.Context, signalID string) {
+	if err := l.dedupe.Abandon(ctx, signalID); err != nil {
+		log.Printf("Failed to release dedupe lease for %s: %v", signalID, err)
+	}
+}
+
+// initializeDecisionLoop 依 env.yaml decision_loop 區塊為每個標的啟動 feat:events 消費者
+func (s *S3_STRATEGYServer) initializeDecisionLoop() {
+	cfg := config.AppConfig.DecisionLoop
+	if !cfg.Enabled {
+		return
+	}
+	if s.redisClient == nil {
+		log.Printf("Decision loop disabled: redis not connected")
+		return
+	}
+
+	var sink IntentSink
+	switch cfg.Sink {
+	case intentSinkHTTP, "":
+		if cfg.OrdersURL == "" {
+			log.Printf("Decision loop disabled: decision_loop.orders_url is required for the http sink")
+			return
+		}
+		sink = &httpIntentSink{url: cfg.OrdersURL, client: &http.Client{}}
+	case intentSinkStream:
+		prefix := cfg.CmdStreamPrefix
+		if prefix == "" {
+			prefix = defaultCmdStreamPrefix
+		}
+		sink = &streamIntentSink{client: s.redisClient, prefix: prefix}
+	default:
+		log.Printf("Decision loop disabled: unknown sink %q", cfg.Sink)
+		return
+	}
+
+	market := dao.Market(strings.ToUpper(cfg.Market))
+	if market == "" {
+		market = dao.MarketFUT
+	}
+	dedupeTTL := durationOr(cfg.DedupeTTL, defaultDedupeTTL)
+	// 重試必須回放同一決策：decide.idempotency_ttl 為 0（停用 HTTP 冪等）時仍以 Redis 保存，保留 dedupe_ttl
+	store, ttl := s.decisions, s.decideOpts.idempotencyTTL
+	if store == nil {
+		store, ttl = &RedisDecisionStore{client: s.redisClient.Client}, dedupeTTL
+	}
+	loop := &decisionLoop{
+		decide:    s.streamDecider(store, ttl),
+		sink:      sink,
+		dedupe:    &RedisSignalDedupe{client: s.redisClient.Client},
+		market:    market,
+		dryRun:    cfg.DryRun,
+		claimIdle: durationOr(cfg.ClaimIdle, defaultClaimIdle),
+		dedupeTTL: dedupeTTL,
+		maxAge:    durationOr(cfg.MaxEventAge, defaultMaxEventAge),
+		now:       time.Now,
+	}
+
+	symbols := cfg.Symbols
+	if len(symbols) == 0 {
+		symbols = s.configManager.Active().Config.Instruments
+	}
+	loop.symbols = symbols
+	s.decisionLoop = loop
+	prefix := cfg.StreamPrefix
+	if prefix == "" {
+		prefix = defaultFeatureStreamPrefix
+	}
+	group := cfg.Group
+	if group == "" {
+		group = defaultDecisionGroup
+	}
+	for _, symbol := range symbols {
+		go s.consumeFeatureEvents(loop, prefix+symbol, group, symbol)
+	}
+	log.Printf("Decision loop consuming %s%v (group %s, sink %s)", prefix, symbols, group, cfg.Sink)
+}
+
+// consumeFeatureEvents 消費單一標的的特徵事件；定期接手閒置逾 claim_idle 的 pending 訊息（消費者當機復原）
+func (s *S3_STRATEGYServer) consumeFeatureEvents(loop *decisionLoop, stream, group, symbol string) {
+	ctx := s.redisClient.Ctx
+	// 新建群組只處理之後的事件，避免回放歷史快照下單
+	if err := s.redisClient.CreateConsumerGroupFrom(ctx, stream, group, "$"); err != nil {
+		log.Printf("Failed to create consumer group for %s: %v", stream, err)
+		return
+	}
+	consumer, _ := os.Hostname()
+	if consumer == "" {
+		consumer = fmt.Sprintf("s3-%d", os.Getpid())
+	}
+
+	process := func(messages []goredis.XMessage) {
+		for _, msg := range messages {
+			loop.touch(symbol, time.Now())
+			if err := loop.handle(ctx, symbol, msg.ID, msg.Values); err != nil {
+				log.Printf("Feature event %s on %s left pending: %v", msg.ID, stream, err)
+				continue
+			}
+			if err := s.redisClient.AcknowledgeStreamMessage(ctx, stream, group, msg.ID); err != nil {
+				log.Printf("%v", err)
+			}
+		}
+	}
+
+	var lastClaim time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		if time.Since(lastClaim) >= loop.claimIdle {
+			lastClaim = time.Now()
+			claimed, err := s.redisClient.ClaimPending(ctx, stream, group, consumer, loop.claimIdle, decisionLoopBatch)
+			if err != nil {
+				log.Printf("%v", err)
+			}
+			process(claimed)
+		}
+
+		streams, err := s.redisClient.ConsumeStream(ctx, stream, group, consumer, decisionLoopBatch, decisionLoopBlock)
+		if err != nil {
+			log.Printf("Failed to read %s: %v", stream, err)
+			time.Sleep(decisionLoopRetryDelay)
+			continue
+		}
+		for _, st := range streams {
+			process(st.Messages)
+		}
+	}
+}
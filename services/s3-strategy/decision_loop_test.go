@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"s3-strategy/dao"
+)
+
+type recordingSink struct {
+	sent     []dao.OrderIntent
+	attempts []dao.OrderIntent // 含送出失敗者
+	fail     error
+}
+
+func (r *recordingSink) Send(_ context.Context, intent dao.OrderIntent) error {
+	r.attempts = append(r.attempts, intent)
+	if r.fail != nil {
+		return r.fail
+	}
+	r.sent = append(r.sent, intent)
+	return nil
+}
+
+func newTestLoop(sink IntentSink, decisions *int) *decisionLoop {
+	now := time.UnixMilli(1_700_000_060_000)
+	return &decisionLoop{
+		decide: func(_ context.Context, req *dao.DecideRequest) (dao.DecideResponse, error) {
+			*decisions++
+			return dao.DecideResponse{
+				Decision: dao.Decision{Action: dao.DecisionOpen},
+				Intents:  []dao.OrderIntent{{IntentID: "intent_" + req.SignalID, Symbol: req.Symbol, Market: req.Market}},
+			}, nil
+		},
+		sink:      sink,
+		dedupe:    NewMemorySignalDedupe(),
+		market:    dao.MarketFUT,
+		claimIdle: time.Minute,
+		dedupeTTL: time.Hour,
+		maxAge:    5 * time.Minute,
+		now:       func() time.Time { return now },
+	}
+}
+
+func featureEvent(ts string) map[string]interface{} {
+	return map[string]interface{}{
+		"ts":       ts,
+		"symbol":   "BTCUSDT",
+		"market":   "FUT",
+		"features": `{"rv_pctile_30d":0.1}`,
+	}
+}
+
+func TestDecisionLoop_ForwardsOnceAndDedupes(t *testing.T) {
+	sink := &recordingSink{}
+	decisions := 0
+	loop := newTestLoop(sink, &decisions)
+
+	// 同一快照重送（重複事件或 reclaim）只決策、轉送一次
+	for i := 0; i < 2; i++ {
+		if err := loop.handle(context.Background(), "BTCUSDT", "1-0", featureEvent("1700000000000")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if decisions != 1 || len(sink.sent) != 1 {
+		t.Fatalf("decisions = %d, sent = %d", decisions, len(sink.sent))
+	}
+	if got := sink.sent[0].IntentID; got != "intent_sig_BTCUSDT_FUT_1700000000000" {
+		t.Errorf("intent id = %s", got)
+	}
+}
+
+func TestDecisionLoop_RetriesAfterSinkFailure(t *testing.T) {
+	sink := &recordingSink{fail: errors.New("connection refused")}
+	decisions := 0
+	loop := newTestLoop(sink, &decisions)
+
+	if err := loop.handle(context.Background(), "BTCUSDT", "1-0", featureEvent("1700000000000")); err == nil {
+		t.Fatal("sink failure must leave the event pending")
+	}
+	sink.fail = nil
+	if err := loop.handle(context.Background(), "BTCUSDT", "1-0", featureEvent("1700000000000")); err != nil {
+		t.Fatal(err)
+	}
+	if decisions != 2 || len(sink.sent) != 1 || sink.sent[0].IntentID != "intent_sig_BTCUSDT_FUT_1700000000000" {
+		t.Errorf("decisions = %d, sent = %+v", decisions, sink.sent)
+	}
+}
+
+func TestDecisionLoop_RetryResendsStoredIntents(t *testing.T) {
+	s := newTestServer(t)
+	sink := &recordingSink{}
+	store := NewMemoryDecisionStore()
+	loop := newTestLoop(sink, new(int))
+	loop.decide = s.streamDecider(store, time.Hour)
+	event := func(ts string, extra dao.FeatureSet) map[string]interface{} {
+		features, _ := json.Marshal(hostedFeatures(extra))
+		return map[string]interface{}{"ts": ts, "symbol": "BTCUSDT", "market": "FUT", "features": string(features)}
+	}
+
+	// 進場與出場信號第一次送出即失敗：持倉與出場旗標已寫入，重試仍須收到與首次決策相同的意圖清單
+	for _, tc := range []struct {
+		ts    string
+		extra dao.FeatureSet
+		kind  dao.OrderIntentKind
+	}{
+		{"1700000000000", nil, dao.IntentEntry},
+		{"1700000030000", dao.FeatureSet{"correlation": 0.9}, dao.IntentExit},
+	} {
+		sink.sent, sink.attempts, sink.fail = nil, nil, errors.New("connection refused")
+		if err := loop.handle(context.Background(), "BTCUSDT", "1-0", event(tc.ts, tc.extra)); err == nil {
+			t.Fatal("sink failure must leave the event pending")
+		}
+		first := sink.attempts[0]
+		sink.fail = nil
+		if err := loop.handle(context.Background(), "BTCUSDT", "1-0", event(tc.ts, tc.extra)); err != nil {
+			t.Fatal(err)
+		}
+		stored, _, _ := store.Claim(context.Background(), decisionKey("sig_BTCUSDT_FUT_"+tc.ts, s.configManager.Active().Rev()), time.Minute)
+		if stored == nil || len(sink.sent) == 0 || !reflect.DeepEqual(sink.sent, stored.Intents) || !reflect.DeepEqual(sink.sent[0], first) || first.Kind != tc.kind {
+			t.Fatalf("%s: first attempt %+v, retry sent %+v", tc.kind, first, sink.sent)
+		}
+	}
+}
+
+func TestDecisionLoop_SkipsAndInFlight(t *testing.T) {
+	sink := &recordingSink{}
+	decisions := 0
+	loop := newTestLoop(sink, &decisions)
+
+	unconfirmed := featureEvent("1700000000000")
+	unconfirmed["confirmed"] = "false"
+	for name, values := range map[string]map[string]interface{}{
+		"unconfirmed": unconfirmed,
+		"stale":       featureEvent("1699999000000"),
+		"malformed":   {"ts": "1700000000000", "features": "{"},
+	} {
+		if err := loop.handle(context.Background(), "BTCUSDT", "2-0", values); err != nil {
+			t.Errorf("%s: err = %v", name, err)
+		}
+	}
+	if decisions != 0 {
+		t.Errorf("skipped events must not reach the pipeline, decisions = %d", decisions)
+	}
+
+	// 其他消費者持有租約時不 ACK
+	if _, err := loop.dedupe.Claim(context.Background(), "sig_BTCUSDT_FUT_1700000000000", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := loop.handle(context.Background(), "BTCUSDT", "3-0", featureEvent("1700000000000")); err != errSignalInFlight {
+		t.Errorf("err = %v, want errSignalInFlight", err)
+	}
+}
+
+func TestHTTPIntentSink(t *testing.T) {
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+	sink := &httpIntentSink{url: srv.URL, client: srv.Client()}
+
+	for code, wantErr := range map[int]bool{http.StatusOK: false, http.StatusUnprocessableEntity: false, http.StatusBadGateway: true} {
+		status = code
+		if err := sink.Send(context.Background(), dao.OrderIntent{IntentID: "i-1"}); (err != nil) != wantErr {
+			t.Errorf("status %d: err = %v", code, err)
+		}
+	}
+}
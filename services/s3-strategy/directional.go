@@ -0,0 +1,418 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"s3-strategy/dao"
+	"s3-strategy/internal/config"
+	"s3-strategy/internal/dsl"
+	"s3-strategy/internal/sizing"
+	"s3-strategy/internal/strategy"
+	"strings"
+	"time"
+)
+
+// 規則路徑（L1）方向與持倉預設值（env.yaml direction 區塊未設定時使用）
+const (
+	rulePathStrategy    = "rules" // 預設策略實例名（持倉 strategy:{pos}:rules:<symbol>）
+	defaultAddSizeFrac  = 0.5
+	rulePositionTimeout = time.Second
+	moveStopToBreakeven = "breakeven"
+	exitFlagPrefix      = "exit:" // 持倉 Flags：每條出場規則每筆持倉只執行一次
+	qtyEpsilon          = 1e-12
+)
+
+var defaultDirectionFeatures = []string{"ew_dir", "wave_direction_4h", "trend_4h", dsl.DirectionFeature}
+
+// directionConfig 解析後的 direction 區塊
+type directionConfig struct {
+	features    []string
+	onOpposite  string
+	maxAdds     int
+	addSizeFrac float64
+}
+
+func newDirectionConfig() directionConfig {
+	cfg := config.AppConfig.Direction
+	dc := directionConfig{
+		features:    cfg.Features,
+		onOpposite:  strings.ToLower(cfg.OnOpposite),
+		maxAdds:     cfg.MaxAdds,
+		addSizeFrac: cfg.AddSizeFrac,
+	}
+	if len(dc.features) == 0 {
+		dc.features = defaultDirectionFeatures
+	}
+	switch dc.onOpposite {
+	case "":
+		dc.onOpposite = strategy.OppositeHold
+	case strategy.OppositeHold, strategy.OppositeClose, strategy.OppositeFlip:
+	default:
+		log.Printf("Unknown direction.on_opposite %q, using %s", cfg.OnOpposite, strategy.OppositeHold)
+		dc.onOpposite = strategy.OppositeHold
+	}
+	if dc.maxAdds < 0 {
+		dc.maxAdds = 0
+	}
+	if dc.addSizeFrac <= 0 || dc.addSizeFrac > 1 {
+		dc.addSizeFrac = defaultAddSizeFrac
+	}
+	return dc
+}
+
+// signalDirection 依序取第一個非零的有號方向特徵（數值正負或 LONG/SHORT/UP/DOWN 等字串）
+func signalDirection(features dao.FeatureSet, names []string) (dao.PosSide, string) {
+	env := dsl.MapEnv(features)
+	for _, name := range names {
+		d, ok := dsl.DirectionOf(env.Lookup(name))
+		switch {
+		case !ok || d == 0:
+			continue
+		case d > 0:
+			return dao.PosLong, name
+		default:
+			return dao.PosShort, name
+		}
+	}
+	return "", ""
+}
+
+// positionTrace 信號方向與評估前的持倉
+func (dc directionConfig) positionTrace(features dao.FeatureSet, held *strategy.Position) *dao.PositionTrace {
+	pt := &dao.PositionTrace{OnOpposite: dc.onOpposite}
+	pt.Direction, pt.DirectionFeature = signalDirection(features, dc.features)
+	if isOpen(held) {
+		pt.Held, pt.HeldQty, pt.StopPx, pt.Adds = held.Side, held.Qty, held.StopPx, held.Adds
+	}
+	return pt
+}
+
+// resolveEntry 進場信號對應的動作：無持倉 open；同向未達 max_adds 為 add；反向依 on_opposite
+// （hold 略過、close 平倉、flip 平倉後反向進場）。略過時回傳原因。
+func (dc directionConfig) resolveEntry(pos *strategy.Position, side dao.PosSide) (dao.DecisionAction, string) {
+	switch {
+	case !isOpen(pos):
+		return dao.DecisionOpen, ""
+	case side == "":
+		return dao.DecisionSkip, fmt.Sprintf("%s position open, signal direction unavailable", pos.Side)
+	case side == pos.Side:
+		if pos.Adds >= dc.maxAdds {
+			return dao.DecisionSkip, fmt.Sprintf("%s position already open (adds %d/%d)", pos.Side, pos.Adds, dc.maxAdds)
+		}
+		return dao.DecisionAdd, ""
+	}
+	switch dc.onOpposite {
+	case strategy.OppositeClose:
+		return dao.DecisionExit, ""
+	case strategy.OppositeFlip:
+		return dao.DecisionFlip, ""
+	}
+	return dao.DecisionSkip, fmt.Sprintf("%s signal against open %s position (on_opposite=hold)", side, pos.Side)
+}
+
+func isOpen(pos *strategy.Position) bool {
+	return pos != nil && !strategy.IsTerminal(pos.State)
+}
+
+// rulePlan 規則路徑對持倉的處理：pos 為評估後的複本，intents 依產生順序排列
+type rulePlan struct {
+	pos     *strategy.Position
+	intents []strategy.Intent
+	changed bool
+}
+
+func (p *rulePlan) emit(intent strategy.Intent) {
+	p.pos.Seq++
+	intent.Seq = p.pos.Seq
+	p.intents = append(p.intents, intent)
+	p.changed = true
+}
+
+// closeAll 全數平倉（reduce-only）並結束持倉
+func (p *rulePlan) closeAll(kind dao.OrderIntentKind, reason, state string, price float64, nowMs int64) {
+	pos := p.pos
+	if pos.Qty > 0 {
+		p.emit(strategy.Intent{Kind: kind, Side: pos.ExitSide(), Qty: pos.Qty, Price: price, ReduceOnly: true, Reason: reason})
+	}
+	pos.Qty = 0
+	pos.State, pos.StateTs = state, nowMs
+	pos.ClosedAt, pos.ExitReason = nowMs, reason
+	p.changed = true
+}
+
+// manageExits 既有持倉：止損觸發 → EXIT/RISK 規則出場動作（依優先序；每條規則每筆持倉實際執行一次）。
+// 減倉/停利為 reduce-only，數量依進場時的交易所限制取整（減倉量或剩餘量低於下限時整筆平倉）；移動止損只收緊；全平後不再處理後續規則。
+func manageExits(prev *strategy.Position, exits []ruleExit, price float64, filters sizing.Filters, nowMs int64, pt *dao.PositionTrace) rulePlan {
+	plan := rulePlan{pos: prev}
+	if !isOpen(prev) {
+		return plan
+	}
+	pos := prev.Clone()
+	plan.pos = pos
+	if price <= 0 {
+		return plan
+	}
+	dir := pos.Dir()
+
+	if pos.StopPx > 0 && (price-pos.StopPx)*dir <= 0 {
+		state := strategy.StateClosed
+		if pos.StopPx == pos.InitialStopPx {
+			state = strategy.StateInvalidated
+		}
+		plan.closeAll(dao.IntentExit, "stop_hit", state, price, nowMs)
+		pt.Exits = append(pt.Exits, "stop_hit")
+		return plan
+	}
+
+	// 規則產生減倉/出場意圖或實際移動止損後才標記已執行（條件未成立的移動止損留待之後再觸發）
+	markDone := func(ruleID string) {
+		if pos.Flags == nil {
+			pos.Flags = map[string]bool{}
+		}
+		pos.Flags[exitFlagPrefix+ruleID] = true
+		plan.changed = true
+	}
+	for _, exit := range exits {
+		if pos.Flags[exitFlagPrefix+exit.RuleID] {
+			continue
+		}
+
+		for _, step := range []struct {
+			kind dao.OrderIntentKind
+			frac float64
+		}{{dao.IntentTP, exit.TakeProfit}, {dao.IntentExit, exit.Exit}} {
+			if step.frac <= 0 {
+				continue
+			}
+			reason := fmt.Sprintf("%s:%s", exit.RuleID, strings.ToLower(string(step.kind)))
+			pt.Exits = append(pt.Exits, fmt.Sprintf("%s %.4g", reason, step.frac))
+			qty, rest, all := filters.SplitExit(pos.Qty, pos.Qty*step.frac, price)
+			markDone(exit.RuleID)
+			if step.frac >= 1 || all || rest <= qtyEpsilon*pos.InitialQty {
+				plan.closeAll(step.kind, reason, strategy.StateClosed, price, nowMs)
+				return plan
+			}
+			pos.Qty = rest
+			plan.emit(strategy.Intent{Kind: step.kind, Side: pos.ExitSide(), Qty: qty, Price: price, ReduceOnly: true, Reason: reason})
+		}
+
+		if exit.MoveStopTo == moveStopToBreakeven && (price-pos.EntryPx)*dir > 0 && (pos.StopPx == 0 || (pos.EntryPx-pos.StopPx)*dir > 0) {
+			markDone(exit.RuleID)
+			pos.StopPx = pos.EntryPx
+			reason := exit.RuleID + ":move_stop_to"
+			pt.Exits = append(pt.Exits, reason+" "+moveStopToBreakeven)
+			plan.emit(strategy.Intent{Kind: dao.IntentSL, Side: pos.ExitSide(), Qty: pos.Qty, TriggerPx: pos.StopPx, ReduceOnly: true, Reason: reason})
+		}
+	}
+	return plan
+}
+
+// openRulePosition 進場（open/flip）後的新持倉；延續前一筆的序號與版本
+func openRulePosition(name string, prev *strategy.Position, req *dao.DecideRequest, sized sizing.Result, entryPx float64, nowMs int64) *strategy.Position {
+	pos := &strategy.Position{
+		Strategy:      name,
+		Symbol:        req.Symbol,
+		Side:          dao.PosLong,
+		Market:        req.Market,
+		State:         strategy.StateActiveConfirmed,
+		StateTs:       nowMs,
+		EntryPx:       entryPx,
+		InitialQty:    sized.Qty,
+		Qty:           sized.Qty,
+		InitialStopPx: sized.StopPx,
+		StopPx:        sized.StopPx,
+		ExtremePx:     entryPx,
+		RiskCash:      sized.RiskCash,
+		OpenedAt:      nowMs,
+		Flags:         map[string]bool{},
+	}
+	if !sized.Long {
+		pos.Side = dao.PosShort
+	}
+	if prev != nil {
+		pos.Seq, pos.Rev = prev.Seq, prev.Rev
+	}
+	return pos
+}
+
+// rulePath 單一策略實例在本次決策的交易對、既有持倉與停止進場狀態
+type rulePath struct {
+	req    *dao.DecideRequest
+	inst   *ruleInstance
+	held   *strategy.Position // 評估前的持倉（含已結束者）
+	inputs func() (pricingInputs, error)
+	killed string // 停止進場開關原因；非空時只允許出場（反手改為平倉）
+}
+
+// executeRulePath 規則路徑：既有持倉出場 → 依信號方向決定 open/add/exit/flip → 計算倉位並暫占 → 寫回持倉。
+// commit 為 false（乾跑、影子評估）時只更新決策與追蹤，不暫占、不寫回、不回傳意圖。
+func (s *S3_STRATEGYServer) executeRulePath(p rulePath, decision *dao.Decision, exits []ruleExit,
+	ruleSizeMult, mlSizeMult float64, trace *dao.DecisionTrace, commit bool) []dao.OrderIntent {
+	req, held, inputs := p.req, p.held, p.inputs
+	nowMs := time.Now().UnixMilli()
+	pt := trace.Position
+	var intents []dao.OrderIntent
+	flush := func(plan *rulePlan) {
+		for _, intent := range plan.intents {
+			intents = append(intents, s.strategyOrderIntent(req, p.inst.name, plan.pos, intent))
+		}
+		plan.intents = nil
+	}
+
+	// 1. 既有持倉：止損與 EXIT/RISK 規則
+	plan := rulePlan{pos: held}
+	price := referencePrice(req.Features)
+	if isOpen(held) {
+		var filters sizing.Filters
+		if in, err := inputs(); err == nil {
+			price, filters = in.Price, in.Filters
+		}
+		plan = manageExits(held, exits, price, filters, nowMs, pt)
+	}
+	exited := len(plan.intents) > 0
+	flush(&plan)
+
+	// 2. 進場信號：依既有持倉與方向決定動作
+	if decision.Action == dao.DecisionOpen {
+		action, reason := s.direction.resolveEntry(plan.pos, pt.Direction)
+		// 停止進場開關：不開倉、不加倉；反手只平倉
+		if p.killed != "" {
+			switch action {
+			case dao.DecisionOpen, dao.DecisionAdd:
+				action, reason = dao.DecisionSkip, p.killed
+			case dao.DecisionFlip:
+				action, decision.Reason = dao.DecisionExit, p.killed
+			}
+		}
+		if action == dao.DecisionExit || action == dao.DecisionFlip {
+			plan.closeAll(dao.IntentExit, "opposite_signal", strategy.StateClosed, price, nowMs)
+			pt.Exits = append(pt.Exits, "opposite_signal")
+			exited = true
+			flush(&plan)
+		}
+		switch action {
+		case dao.DecisionSkip:
+			decision.Action, decision.Reason = dao.DecisionSkip, reason
+		case dao.DecisionExit:
+			decision.Action = dao.DecisionSkip
+		default:
+			qtyFrac, heldQty := 1.0, 0.0
+			if action == dao.DecisionAdd {
+				qtyFrac, heldQty = s.direction.addSizeFrac, plan.pos.Qty
+			}
+			decision.Side = pt.Direction
+			if sized, ok := s.sizeDecision(req, decision, ruleSizeMult, mlSizeMult, qtyFrac, heldQty, inputs, trace); ok {
+				decision.Side = dao.PosLong
+				if !sized.Long {
+					decision.Side = dao.PosShort
+				}
+				// 組合層預檢：相關曝險、策略/資產類額度與淨 Delta（拒單或降尺）
+				if sized, ok = s.checkPortfolio(p, decision, plan.pos, sized, trace); ok {
+					decision.Action = action
+					if commit {
+						intents = append(intents, s.enterRulePosition(p, decision, &plan, sized, trace, nowMs)...)
+					}
+				}
+			}
+		}
+	}
+
+	// 沒有新進場但已減倉/平倉時，決策為 exit
+	if exited && decision.Action == dao.DecisionSkip {
+		decision.Action = dao.DecisionExit
+		decision.Reason = fmt.Sprintf("%s; exits: %s", decision.Reason, strings.Join(pt.Exits, ", "))
+	}
+
+	if !commit {
+		return nil
+	}
+	if plan.changed {
+		if err := s.saveRulePosition(plan.pos); err != nil {
+			// 持倉未寫回（版本衝突代表其他副本已處理同一持倉）：捨棄本次意圖並回滾進場/加倉暫占
+			for i := range intents {
+				if isEntryIntent(&intents[i]) {
+					s.releaseEntry(p.inst, &intents[i])
+				}
+			}
+			decision.Action, decision.Reason = dao.DecisionSkip, fmt.Sprintf("position not saved: %v", err)
+			return nil
+		}
+	}
+	var score float64
+	if trace.Model != nil {
+		score = trace.Model.Score
+	}
+	for i := range intents {
+		if isEntryIntent(&intents[i]) {
+			s.trackPending(&intents[i], decision.Side, score)
+		}
+	}
+	return intents
+}
+
+// enterRulePosition 產生進場/加倉意圖並暫占帳戶層與策略額度，成功後更新持倉（寫回後才記入未成交曝險）；暫占失敗時改為 skip。
+// rules 以外的實例 intent_id 加上 _<strategy>（同一信號各實例各自冪等）
+func (s *S3_STRATEGYServer) enterRulePosition(p rulePath, decision *dao.Decision, plan *rulePlan, sized sizing.Result, trace *dao.DecisionTrace, nowMs int64) []dao.OrderIntent {
+	entryPx := trace.Sizing.EntryPx
+	intent := s.generateOrderIntent(p.req, decision, sized, entryPx)
+	if p.inst.name != rulePathStrategy {
+		intent.IntentID += "_" + p.inst.name
+	}
+	if decision.Action == dao.DecisionAdd {
+		intent.Kind = dao.IntentAdd
+		intent.IntentID += "-add"
+	}
+	intent.Strategy = p.inst.name
+	if ok, reason := s.reserveEntry(p.inst, &intent); !ok {
+		decision.Action = dao.DecisionSkip
+		decision.Reason = reason
+		return nil
+	}
+	if decision.Action == dao.DecisionAdd {
+		plan.pos.Qty += sized.Qty
+		plan.pos.Adds++
+	} else {
+		plan.pos = openRulePosition(p.inst.name, plan.pos, p.req, sized, entryPx, nowMs)
+		if trace.Model != nil {
+			plan.pos.Score = trace.Model.Score
+		}
+		plan.pos.Leverage = trace.Sizing.Leverage
+	}
+	plan.changed = true
+	return []dao.OrderIntent{intent}
+}
+
+// rulePosition 讀取策略實例的持倉（含已結束者，供延續序號與版本）；未啟用或讀取失敗時回傳 nil
+func (s *S3_STRATEGYServer) rulePosition(name, symbol string) *strategy.Position {
+	if s.strategyRunner == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), rulePositionTimeout)
+	defer cancel()
+	pos, err := s.strategyRunner.Store.Get(ctx, name, symbol)
+	if err != nil {
+		log.Printf("Failed to load %s position for %s: %v", name, symbol, err)
+		return nil
+	}
+	return pos
+}
+
+// saveRulePosition 寫回策略實例持倉；失敗（含版本衝突 strategy.ErrConflict）時由呼叫端捨棄本次結果
+func (s *S3_STRATEGYServer) saveRulePosition(pos *strategy.Position) error {
+	if s.strategyRunner == nil || pos == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), rulePositionTimeout)
+	defer cancel()
+	if err := s.strategyRunner.Store.Save(ctx, pos); err != nil {
+		if errors.Is(err, strategy.ErrConflict) {
+			log.Printf("Position %s/%s changed concurrently, result discarded", pos.Strategy, pos.Symbol)
+		} else {
+			log.Printf("Failed to save %s position for %s, result discarded: %v", pos.Strategy, pos.Symbol, err)
+		}
+		return err
+	}
+	return nil
+}
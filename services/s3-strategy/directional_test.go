@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"s3-strategy/dao"
+	"s3-strategy/internal/risk"
+	"s3-strategy/internal/sizing"
+	"s3-strategy/internal/strategy"
+)
+
+func TestSignalDirection(t *testing.T) {
+	cases := []struct {
+		features    dao.FeatureSet
+		side        dao.PosSide
+		featureName string
+	}{
+		{dao.FeatureSet{"ew_dir": -1.0, "trend_4h": "UP"}, dao.PosShort, "ew_dir"},
+		{dao.FeatureSet{"ew_dir": 0.0, "trend_4h": "UP"}, dao.PosLong, "trend_4h"},
+		{dao.FeatureSet{"wave_direction_4h": "NEUTRAL", "direction": "SHORT"}, dao.PosShort, "direction"},
+		{dao.FeatureSet{"rv_pct": 0.1}, "", ""},
+	}
+	for _, c := range cases {
+		if side, name := signalDirection(c.features, defaultDirectionFeatures); side != c.side || name != c.featureName {
+			t.Errorf("signalDirection(%v) = %s %s, want %s %s", c.features, side, name, c.side, c.featureName)
+		}
+	}
+}
+
+func TestParseRuleExit(t *testing.T) {
+	cases := []struct {
+		ruleType string
+		actions  map[string]interface{}
+		exit     ruleExit
+		ok       bool
+	}{
+		{ruleTypeExit, map[string]interface{}{"size_mult": 0.5}, ruleExit{RuleID: "R", Exit: 0.5}, true},
+		{ruleTypeExit, nil, ruleExit{RuleID: "R", Exit: 1}, true},
+		{ruleTypeExit, map[string]interface{}{"take_profit": 0.25, "move_stop_to": "breakeven"}, ruleExit{RuleID: "R", TakeProfit: 0.25, MoveStopTo: "breakeven"}, true},
+		{ruleTypeRisk, map[string]interface{}{"size_mult": 0.5}, ruleExit{RuleID: "R"}, false},
+		{ruleTypeRisk, map[string]interface{}{"exit": 3.0}, ruleExit{RuleID: "R", Exit: 1}, true},
+	}
+	for _, c := range cases {
+		exit, ok := parseRuleExit(&dao.StrategyRule{RuleID: "R", RuleType: c.ruleType}, c.actions)
+		if exit != c.exit || ok != c.ok {
+			t.Errorf("%s %v: exit = %+v, %v", c.ruleType, c.actions, exit, ok)
+		}
+	}
+}
+
+func TestResolveEntry(t *testing.T) {
+	dc := directionConfig{onOpposite: strategy.OppositeHold, maxAdds: 1}
+	long := &strategy.Position{Side: dao.PosLong, State: strategy.StateActiveConfirmed}
+
+	if action, _ := dc.resolveEntry(nil, dao.PosShort); action != dao.DecisionOpen {
+		t.Errorf("flat: %s", action)
+	}
+	if action, _ := dc.resolveEntry(long, dao.PosLong); action != dao.DecisionAdd {
+		t.Errorf("same side: %s", action)
+	}
+	long.Adds = 1
+	if action, reason := dc.resolveEntry(long, dao.PosLong); action != dao.DecisionSkip || !strings.Contains(reason, "adds 1/1") {
+		t.Errorf("max adds: %s %s", action, reason)
+	}
+	if action, reason := dc.resolveEntry(long, dao.PosShort); action != dao.DecisionSkip || !strings.Contains(reason, "on_opposite=hold") {
+		t.Errorf("hold: %s %s", action, reason)
+	}
+	dc.onOpposite = strategy.OppositeClose
+	if action, _ := dc.resolveEntry(long, dao.PosShort); action != dao.DecisionExit {
+		t.Errorf("close: %s", action)
+	}
+	dc.onOpposite = strategy.OppositeFlip
+	if action, _ := dc.resolveEntry(long, dao.PosShort); action != dao.DecisionFlip {
+		t.Errorf("flip: %s", action)
+	}
+}
+
+func TestManageExits_Filters(t *testing.T) {
+	filters := sizing.Filters{TickSize: 0.1, StepSize: 0.001, MinQty: 0.001, MinNotional: 5}
+	held := func(qty float64) *strategy.Position {
+		return &strategy.Position{Symbol: "BTCUSDT", Side: dao.PosLong, State: strategy.StateActiveConfirmed, EntryPx: 60000, InitialQty: qty, Qty: qty}
+	}
+	exits := []ruleExit{{RuleID: "R-TP", TakeProfit: 0.33}, {RuleID: "R-002", Exit: 0.5}}
+
+	// 0.123 × 0.33 = 0.04059 捨去為 0.040，剩 0.083；0.083 × 0.5 捨去為 0.041，剩 0.042
+	plan := manageExits(held(0.123), exits, 61000, filters, 1, &dao.PositionTrace{})
+	if len(plan.intents) != 2 || plan.intents[0].Qty != 0.04 || plan.intents[1].Qty != 0.041 || plan.pos.Qty != 0.042 {
+		t.Errorf("partial exits = %+v, remaining %v", plan.intents, plan.pos.Qty)
+	}
+
+	// 剩餘量低於 minQty：0.0015 減倉一半無法成交，整筆平倉
+	plan = manageExits(held(0.0015), exits[1:], 61000, filters, 1, &dao.PositionTrace{})
+	if len(plan.intents) != 1 || plan.intents[0].Qty != 0.0015 || plan.pos.State != strategy.StateClosed || plan.pos.Qty != 0 {
+		t.Errorf("dust close = %+v, position %+v", plan.intents, plan.pos)
+	}
+}
+
+func TestManageExits_BreakevenWaitsForProfit(t *testing.T) {
+	held := &strategy.Position{Symbol: "BTCUSDT", Side: dao.PosLong, State: strategy.StateActiveConfirmed, EntryPx: 60000, InitialQty: 0.1, Qty: 0.1, StopPx: 59000}
+	exits := []ruleExit{{RuleID: "R-BE", MoveStopTo: moveStopToBreakeven}}
+
+	// 價格仍在進場價下方：不移動止損，規則不標記已執行
+	plan := manageExits(held, exits, 59500, sizing.Filters{}, 1, &dao.PositionTrace{})
+	if plan.changed || len(plan.intents) != 0 || plan.pos.Flags[exitFlagPrefix+"R-BE"] {
+		t.Fatalf("premature breakeven = %+v, flags %v", plan.intents, plan.pos.Flags)
+	}
+
+	// 之後轉為獲利時照常移至保本，並只執行一次
+	plan = manageExits(plan.pos, exits, 60500, sizing.Filters{}, 2, &dao.PositionTrace{})
+	if len(plan.intents) != 1 || plan.intents[0].Kind != dao.IntentSL || plan.pos.StopPx != 60000 || !plan.pos.Flags[exitFlagPrefix+"R-BE"] {
+		t.Fatalf("breakeven = %+v, position %+v", plan.intents, plan.pos)
+	}
+	if plan = manageExits(plan.pos, exits, 61000, sizing.Filters{}, 3, &dao.PositionTrace{}); len(plan.intents) != 0 {
+		t.Errorf("repeat breakeven = %+v", plan.intents)
+	}
+}
+
+// conflictStore 模擬其他副本先寫回同一持倉
+type conflictStore struct {
+	strategy.PositionStore
+}
+
+func (conflictStore) Save(context.Context, *strategy.Position) error {
+	return strategy.ErrConflict
+}
+
+func TestDecide_PositionConflictDiscardsEntry(t *testing.T) {
+	s := newTestServer(t)
+	ctx := context.Background()
+	ledger := risk.NewMemoryLedger()
+	s.gateKeeper.budget = risk.NewBudget(ledger, risk.Limits{FutMarginUSDT: 5000, SpotQuoteUSDT: 10000, ConcurrentEntries: 2, ReservationTTL: time.Minute})
+	s.portfolio = testPortfolioGate()
+	s.portfolio.netDeltaLower, s.portfolio.netDeltaUpper = -1, 1
+	s.strategyRunner.Store = conflictStore{s.strategyRunner.Store}
+
+	// 寫回版本衝突：不送出意圖、回滾暫占，也不記入未成交曝險
+	response := s.decide(&dao.DecideRequest{SignalID: "sig-1", Symbol: "BTCUSDT", Market: dao.MarketFUT, Features: dao.FeatureSet{
+		"spread_bps": 1.5, "atr_pct": 0.5, "rv_pct": 0.1, "ew_dir": 1.0, "invalidation_px": 59000.0,
+	}})
+	if len(response.Intents) != 0 || response.Decision.Action != dao.DecisionSkip || !strings.Contains(response.Decision.Reason, strategy.ErrConflict.Error()) {
+		t.Fatalf("response = %+v", response)
+	}
+	if n, _ := ledger.Usage(ctx, risk.ConcurrencyKey("BTCUSDT")); n != 0 {
+		t.Errorf("account concurrency after conflict = %v", n)
+	}
+	if pending, _ := s.portfolio.pending.List(ctx); len(pending) != 0 {
+		t.Errorf("pending after conflict = %+v", pending)
+	}
+}
+
+func TestDecide_DirectionalLifecycle(t *testing.T) {
+	s := newTestServer(t)
+	s.direction.onOpposite = strategy.OppositeFlip
+	s.direction.maxAdds = 1
+	market := s.marketData.(*staticMarketData)
+	features := func(extra dao.FeatureSet) dao.FeatureSet {
+		f := dao.FeatureSet{"spread_bps": 1.5, "rv_pctile_30d": 0.1, "rho_usdttwd_14": -0.5, "atr_pct": 0.5, "rv_pct": 0.1}
+		for k, v := range extra {
+			f[k] = v
+		}
+		return f
+	}
+	decide := func(id string, f dao.FeatureSet) dao.DecideResponse {
+		return s.decide(&dao.DecideRequest{SignalID: id, Symbol: "BTCUSDT", Market: dao.MarketFUT, Features: f})
+	}
+	stored := func() *strategy.Position {
+		pos, _ := s.strategyRunner.Store.Get(context.Background(), rulePathStrategy, "BTCUSDT")
+		return pos
+	}
+
+	// 1. ew_dir > 0：多單進場並記錄規則路徑持倉
+	response := decide("sig-1", features(dao.FeatureSet{"ew_dir": 1.0, "invalidation_px": 59000.0}))
+	if response.Decision.Action != dao.DecisionOpen || response.Decision.Side != dao.PosLong || len(response.Intents) != 1 {
+		t.Fatalf("open = %+v", response)
+	}
+	entryQty := response.Intents[0].Qty
+	if pos := stored(); pos == nil || pos.Side != dao.PosLong || pos.Qty != entryQty || pos.StopPx != 59000 {
+		t.Fatalf("stored = %+v", pos)
+	}
+
+	// 2. 同向信號加倉 add_size_frac（0.5）
+	response = decide("sig-2", features(dao.FeatureSet{"ew_dir": 1.0, "invalidation_px": 59000.0}))
+	if response.Decision.Action != dao.DecisionAdd || len(response.Intents) != 1 || response.Intents[0].Kind != dao.IntentAdd || response.Intents[0].Side != dao.SideBuy {
+		t.Fatalf("add = %+v", response)
+	}
+	addQty := response.Intents[0].Qty
+	if math.Abs(addQty-entryQty/2) > 0.001 || stored().Adds != 1 {
+		t.Errorf("add qty = %v (entry %v), stored = %+v", addQty, entryQty, stored())
+	}
+
+	// 3. R-002（EXIT，size_mult 0.5）命中：減倉一半、reduce-only；已達加倉上限，決策為 exit
+	held := entryQty + addQty
+	response = decide("sig-3", features(dao.FeatureSet{"ew_dir": 1.0, "invalidation_px": 59000.0, "correlation": 0.9}))
+	if response.Decision.Action != dao.DecisionExit || len(response.Intents) != 1 {
+		t.Fatalf("exit = %+v", response)
+	}
+	if exit := response.Intents[0]; exit.Kind != dao.IntentExit || !exit.ReduceOnly || exit.Side != dao.SideSell || math.Abs(exit.Qty-held/2) > 1e-9 || exit.Reason != "R-002:exit" {
+		t.Errorf("exit intent = %+v", exit)
+	}
+
+	// 同一條出場規則每筆持倉只執行一次
+	if response = decide("sig-4", features(dao.FeatureSet{"ew_dir": 1.0, "invalidation_px": 59000.0, "correlation": 0.9})); len(response.Intents) != 0 || response.Decision.Action != dao.DecisionSkip {
+		t.Errorf("repeat exit = %+v", response)
+	}
+
+	// 4. 反向信號（on_opposite=flip）：平多後空單進場
+	response = decide("sig-5", features(dao.FeatureSet{"ew_dir": -1.0, "invalidation_px": 61000.0}))
+	if response.Decision.Action != dao.DecisionFlip || response.Decision.Side != dao.PosShort || len(response.Intents) != 2 {
+		t.Fatalf("flip = %+v", response)
+	}
+	if closeIntent := response.Intents[0]; closeIntent.Kind != dao.IntentExit || !closeIntent.ReduceOnly || math.Abs(closeIntent.Qty-held/2) > 1e-9 || closeIntent.Reason != "opposite_signal" {
+		t.Errorf("flip close = %+v", closeIntent)
+	}
+	if entry := response.Intents[1]; entry.Kind != dao.IntentEntry || entry.Side != dao.SideSell || entry.ReduceOnly {
+		t.Errorf("flip entry = %+v", entry)
+	}
+	if pos := stored(); pos.Side != dao.PosShort || pos.StopPx != 61000 || pos.Adds != 0 {
+		t.Errorf("stored after flip = %+v", pos)
+	}
+
+	// 5. 價格突破空單止損：全平（INVALIDATED）；失效價已在價格下方，不再進場
+	market.price = 61500
+	response = decide("sig-6", features(dao.FeatureSet{"ew_dir": -1.0, "invalidation_px": 61000.0}))
+	if response.Decision.Action != dao.DecisionExit || len(response.Intents) != 1 || response.Intents[0].Side != dao.SideBuy || response.Intents[0].Reason != "stop_hit" {
+		t.Fatalf("stop = %+v", response)
+	}
+	if pos := stored(); pos.State != strategy.StateInvalidated || pos.Qty != 0 {
+		t.Errorf("stored after stop = %+v", pos)
+	}
+
+	// 出場意圖 ID 由規則路徑、交易對、開倉時間與序號組成
+	if !strings.HasPrefix(response.Intents[0].IntentID, rulePathStrategy+"-BTCUSDT-") {
+		t.Errorf("intent id = %s", response.Intents[0].IntentID)
+	}
+}
+
+func TestDecide_AddRespectsMarginCap(t *testing.T) {
+	s := newTestServer(t)
+	s.direction.maxAdds = 1
+	s.sizing.maxMarginUSDT = 50
+	decide := func(id string) dao.DecideResponse {
+		return s.decide(&dao.DecideRequest{SignalID: id, Symbol: "BTCUSDT", Market: dao.MarketFUT, Features: dao.FeatureSet{
+			"spread_bps": 1.5, "atr_pct": 0.5, "rv_pct": 0.1, "ew_dir": 1.0, "invalidation_px": 59000.0,
+		}})
+	}
+
+	// 進場已被保證金上限夾限
+	response := decide("sig-1")
+	if response.Decision.Action != dao.DecisionOpen || response.Trace.Sizing.CappedBy != sizing.CappedByMargin {
+		t.Fatalf("open = %+v, sizing %+v", response.Decision, response.Trace.Sizing)
+	}
+
+	// 同向加倉：既有 0.016 與上限 0.01666 的剩餘額度低於 minQty，不再加倉
+	response = decide("sig-2")
+	if response.Decision.Action != dao.DecisionSkip || !strings.HasPrefix(response.Decision.Reason, "sizing: qty 0 below min qty") || len(response.Intents) != 0 {
+		t.Errorf("add = %+v", response.Decision)
+	}
+	if sz := response.Trace.Sizing; sz.HeldQty == 0 || sz.Qty != 0 {
+		t.Errorf("add sizing = %+v", sz)
+	}
+}
+
+func TestDecide_DirectionMismatch(t *testing.T) {
+	s := newTestServer(t)
+	// 信號做多但失效價在價格上方：不進場
+	response := s.decide(&dao.DecideRequest{SignalID: "sig-1", Symbol: "BTCUSDT", Market: dao.MarketFUT, Features: dao.FeatureSet{
+		"spread_bps": 1.5, "atr_pct": 0.5, "rv_pct": 0.1, "ew_dir": 1.0, "invalidation_px": 61000.0,
+	}})
+	if response.Decision.Action != dao.DecisionSkip || !strings.Contains(response.Decision.Reason, "wrong side of entry") || len(response.Intents) != 0 {
+		t.Errorf("decision = %+v", response.Decision)
+	}
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"s3-strategy/dao"
+	"s3-strategy/internal/config"
+	"s3-strategy/internal/risk"
+	"s3-strategy/internal/sizing"
+	"s3-strategy/internal/strategy"
+	"strings"
+	"time"
+)
+
+// 決策心跳預設值（env.yaml heartbeat 區塊未設定時使用）
+const (
+	defaultHeartbeatInterval  = 10 * time.Second
+	defaultQuietAfter         = 30 * time.Second
+	defaultSnapshotURL        = "http://localhost:8082/features"
+	defaultLBMin              = 0.02
+	defaultMaintenanceMargin  = 0.005
+	defaultReduceFrac         = 0.5
+	defaultSLBufferFrac       = 0.5
+	breachReduce              = "reduce"
+	breachTightenSL           = "tighten_sl"
+	liquidationGuardFlag      = "liq_guard" // 持倉 Flags：本次跌破已處理，LB 回升後清除
+	heartbeatSnapshotTimeout  = 2 * time.Second
+	heartbeatPositionsTimeout = 3 * time.Second
+)
+
+// heartbeatConfig 解析後的 heartbeat 區塊
+type heartbeatConfig struct {
+	interval     time.Duration
+	quietAfter   time.Duration
+	lbMin        float64
+	mmr          float64
+	reduce       bool
+	tightenSL    bool
+	reduceFrac   float64
+	slBufferFrac float64
+	// fetch 特徵快照（S2 GET /features），回傳與 feat:events 訊息相同格式的欄位
+	fetch func(ctx context.Context, symbol string) (map[string]interface{}, error)
+}
+
+func newHeartbeatConfig() heartbeatConfig {
+	cfg := config.AppConfig.Heartbeat
+	hb := heartbeatConfig{
+		interval:     durationOr(cfg.Interval, defaultHeartbeatInterval),
+		quietAfter:   durationOr(cfg.QuietAfter, defaultQuietAfter),
+		lbMin:        cfg.LBMin,
+		mmr:          cfg.MaintenanceMarginRate,
+		reduceFrac:   cfg.ReduceFrac,
+		slBufferFrac: cfg.SLBufferFrac,
+	}
+	if hb.lbMin <= 0 {
+		hb.lbMin = defaultLBMin
+	}
+	if hb.mmr <= 0 || hb.mmr >= 1 {
+		hb.mmr = defaultMaintenanceMargin
+	}
+	if hb.reduceFrac <= 0 || hb.reduceFrac > 1 {
+		hb.reduceFrac = defaultReduceFrac
+	}
+	if hb.slBufferFrac <= 0 || hb.slBufferFrac >= 1 {
+		hb.slBufferFrac = defaultSLBufferFrac
+	}
+	actions := cfg.OnBreach
+	if len(actions) == 0 {
+		actions = []string{breachReduce, breachTightenSL}
+	}
+	for _, action := range actions {
+		switch strings.ToLower(action) {
+		case breachReduce:
+			hb.reduce = true
+		case breachTightenSL:
+			hb.tightenSL = true
+		default:
+			log.Printf("Unknown heartbeat.on_breach action %q ignored", action)
+		}
+	}
+	snapshotURL := cfg.SnapshotURL
+	if snapshotURL == "" {
+		snapshotURL = defaultSnapshotURL
+	}
+	hb.fetch = featureSnapshotFetcher(snapshotURL, &http.Client{Timeout: heartbeatSnapshotTimeout})
+	return hb
+}
+
+// featureSnapshotFetcher 呼叫 S2 GET /features?symbol=，轉為 feat:events 訊息欄位（symbol、features JSON、ts）
+func featureSnapshotFetcher(endpoint string, client *http.Client) func(ctx context.Context, symbol string) (map[string]interface{}, error) {
+	return func(ctx context.Context, symbol string) (map[string]interface{}, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+"?symbol="+url.QueryEscape(symbol), nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			payload, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+			return nil, fmt.Errorf("feature service returned %d: %s", resp.StatusCode, strings.TrimSpace(string(payload)))
+		}
+		var snapshot struct {
+			Symbol    string          `json:"symbol"`
+			Features  json.RawMessage `json:"features"`
+			Timestamp int64           `json:"timestamp"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&snapshot); err != nil {
+			return nil, fmt.Errorf("decode feature snapshot: %w", err)
+		}
+		return map[string]interface{}{
+			"symbol":   snapshot.Symbol,
+			"features": string(snapshot.Features),
+			"ts":       snapshot.Timestamp,
+		}, nil
+	}
+}
+
+// startHeartbeat 依 env.yaml heartbeat 區塊啟動冗餘決策心跳（需要串流決策的去重與意圖下游）
+func (s *S3_STRATEGYServer) startHeartbeat() {
+	if !config.AppConfig.Heartbeat.Enabled {
+		return
+	}
+	if s.decisionLoop == nil {
+		log.Printf("Decision heartbeat disabled: decision_loop is not running")
+		return
+	}
+	hb := newHeartbeatConfig()
+	go func() {
+		ticker := time.NewTicker(hb.interval)
+		defer ticker.Stop()
+		ctx := s.redisClient.Ctx
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.heartbeatTick(ctx, s.decisionLoop, hb)
+			}
+		}
+	}()
+	log.Printf("Decision heartbeat every %s (quiet after %s, lb_min %.4g)", hb.interval, hb.quietAfter, hb.lbMin)
+}
+
+// heartbeatTick 一次巡檢：feat:events 靜默的標的向 S2 拉快照並走決策管線（與串流共用 signal_id 去重與意圖下游），
+// 再檢查持倉強平緩衝
+func (s *S3_STRATEGYServer) heartbeatTick(ctx context.Context, loop *decisionLoop, hb heartbeatConfig) {
+	now := loop.now()
+	for _, symbol := range loop.symbols {
+		if !loop.quiet(symbol, now, hb.quietAfter) {
+			continue
+		}
+		fetchCtx, cancel := context.WithTimeout(ctx, heartbeatSnapshotTimeout)
+		values, err := hb.fetch(fetchCtx, symbol)
+		cancel()
+		if err != nil {
+			log.Printf("Heartbeat snapshot for %s unavailable: %v", symbol, err)
+			continue
+		}
+		if err := loop.handle(ctx, symbol, fmt.Sprintf("heartbeat-%d", now.UnixMilli()), values); err != nil {
+			log.Printf("Heartbeat decision for %s failed: %v", symbol, err)
+		}
+	}
+	s.guardLiquidation(ctx, loop, hb)
+}
+
+// liquidationCheck 逐倉強平價、強平緩衝與 ROE
+type liquidationCheck struct {
+	liqPx  float64
+	buffer float64
+	roe    float64
+}
+
+// liquidationPlan 依標記價檢查持倉強平緩衝；LB < lb_min 時依 on_breach 減倉（reduce-only）並收緊止損（只收緊），
+// 每次跌破只處理一次（Flags liq_guard，LB 回升後清除）。逐倉保證金 = entry × qty / leverage（持倉未記錄槓桿時用 leverage）；
+// 減倉量依 stepSize 捨去（減倉量或剩餘量低於下限時全平），止損依 tickSize 往遠離標記價取整
+func (hb heartbeatConfig) liquidationPlan(prev *strategy.Position, mark float64, leverage int, filters sizing.Filters, nowMs int64) (rulePlan, liquidationCheck) {
+	if prev.Leverage > 0 {
+		leverage = prev.Leverage
+	}
+	ip := risk.IsolatedPosition{Dir: prev.Dir(), EntryPx: prev.EntryPx, Qty: prev.Qty, MarginUSDT: prev.EntryPx * prev.Qty / float64(leverage)}
+	chk := liquidationCheck{liqPx: ip.LiquidationPrice(hb.mmr), buffer: ip.LiquidationBuffer(mark, hb.mmr), roe: ip.ROE(mark)}
+
+	plan := rulePlan{pos: prev}
+	flagged := prev.Flags[liquidationGuardFlag]
+	switch {
+	case chk.buffer >= hb.lbMin && flagged:
+		plan.pos = prev.Clone()
+		delete(plan.pos.Flags, liquidationGuardFlag)
+		plan.changed = true
+	case chk.buffer < hb.lbMin && !flagged:
+		pos := prev.Clone()
+		plan.pos = pos
+		if pos.Flags == nil {
+			pos.Flags = map[string]bool{}
+		}
+		pos.Flags[liquidationGuardFlag] = true
+		plan.changed = true
+		reason := fmt.Sprintf("liq_guard: lb %.4f < %.4f", chk.buffer, hb.lbMin)
+		if hb.reduce {
+			qty, rest, all := filters.SplitExit(pos.Qty, pos.Qty*hb.reduceFrac, mark)
+			if hb.reduceFrac >= 1 || all || rest <= qtyEpsilon*pos.InitialQty {
+				plan.closeAll(dao.IntentExit, reason, strategy.StateClosed, mark, nowMs)
+				return plan, chk
+			}
+			pos.Qty = rest
+			plan.emit(strategy.Intent{Kind: dao.IntentExit, Side: pos.ExitSide(), Qty: qty, Price: mark, ReduceOnly: true, Reason: reason})
+		}
+		if hb.tightenSL && chk.liqPx > 0 {
+			stop := sizing.RoundStop(chk.liqPx+(mark-chk.liqPx)*hb.slBufferFrac, filters.TickSize, pos.Dir() > 0)
+			if pos.StopPx == 0 || (stop-pos.StopPx)*pos.Dir() > 0 {
+				pos.StopPx = stop
+				plan.emit(strategy.Intent{Kind: dao.IntentSL, Side: pos.ExitSide(), Qty: pos.Qty, TriggerPx: stop, ReduceOnly: true, Reason: reason})
+			}
+		}
+	}
+	return plan, chk
+}
+
+// guardLiquidation 巡檢所有未結束的合約持倉（未記錄市場者視為 decision_loop.market）；
+// 意圖全數送出後才寫回持倉，送出失敗時下次巡檢以相同 intent_id 重送（下游依 intent_id 冪等）
+func (s *S3_STRATEGYServer) guardLiquidation(ctx context.Context, loop *decisionLoop, hb heartbeatConfig) {
+	if s.strategyRunner == nil || s.marketData == nil {
+		return
+	}
+	listCtx, cancel := context.WithTimeout(ctx, heartbeatPositionsTimeout)
+	positions, err := s.strategyRunner.Store.List(listCtx)
+	cancel()
+	if err != nil {
+		log.Printf("Heartbeat failed to list positions: %v", err)
+		return
+	}
+	nowMs := loop.now().UnixMilli()
+	for _, pos := range positions {
+		if !isOpen(pos) || pos.Qty <= 0 || pos.EntryPx <= 0 {
+			continue
+		}
+		market := pos.Market
+		if market == "" {
+			market = loop.market
+		}
+		if market == dao.MarketSPOT {
+			continue
+		}
+		priceCtx, cancel := context.WithTimeout(ctx, s.sizing.priceTimeout)
+		mark, err := s.marketData.Price(priceCtx, pos.Symbol, market)
+		cancel()
+		if err != nil || mark <= 0 {
+			log.Printf("Heartbeat mark price for %s unavailable: %v", pos.Symbol, err)
+			continue
+		}
+
+		filtersCtx, cancel := context.WithTimeout(ctx, s.sizing.priceTimeout)
+		filters, err := s.marketData.Filters(filtersCtx, pos.Symbol)
+		cancel()
+		if err != nil {
+			// 降風險優先：取不到交易所限制時仍以未取整的數量與止損送出
+			log.Printf("Heartbeat filters for %s unavailable: %v", pos.Symbol, err)
+		}
+
+		plan, chk := hb.liquidationPlan(pos, mark, s.sizing.leverage, filters, nowMs)
+		if !plan.changed {
+			continue
+		}
+		if len(plan.intents) == 0 {
+			s.saveRulePosition(plan.pos)
+			continue
+		}
+		summary := fmt.Sprintf("Liquidation buffer %s/%s %.2f%% below %.2f%% (mark %.8g, liq %.8g, ROE %.1f%%)",
+			pos.Strategy, pos.Symbol, chk.buffer*100, hb.lbMin*100, mark, chk.liqPx, chk.roe*100)
+		if loop.dryRun {
+			log.Printf("Dry run: %s, %d de-risk intents not sent", summary, len(plan.intents))
+			continue
+		}
+		if s.forwardDeRisk(ctx, loop.sink, market, plan) {
+			s.saveRulePosition(plan.pos)
+			s.publishAlert(dao.SevWarn, fmt.Sprintf("%s: sent %d de-risk intents", summary, len(plan.intents)))
+		}
+	}
+}
+
+// forwardDeRisk 依序送出降風險意圖；任一失敗即停止並回傳 false
+func (s *S3_STRATEGYServer) forwardDeRisk(ctx context.Context, sink IntentSink, market dao.Market, plan rulePlan) bool {
+	req := &dao.DecideRequest{Symbol: plan.pos.Symbol, Market: market}
+	for _, intent := range plan.intents {
+		sendCtx, cancel := context.WithTimeout(ctx, intentSendTimeout)
+		err := sink.Send(sendCtx, s.strategyOrderIntent(req, plan.pos.Strategy, plan.pos, intent))
+		cancel()
+		if err != nil {
+			log.Printf("Heartbeat failed to forward de-risk intent for %s/%s: %v", plan.pos.Strategy, plan.pos.Symbol, err)
+			return false
+		}
+	}
+	return true
+}
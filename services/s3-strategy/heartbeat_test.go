@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"s3-strategy/dao"
+	"s3-strategy/internal/sizing"
+	"s3-strategy/internal/strategy"
+)
+
+func testHeartbeat() heartbeatConfig {
+	return heartbeatConfig{interval: 10 * time.Second, quietAfter: 30 * time.Second, lbMin: 0.02, mmr: 0.005,
+		reduce: true, tightenSL: true, reduceFrac: 0.5, slBufferFrac: 0.5}
+}
+
+func TestLiquidationPlan(t *testing.T) {
+	hb := testHeartbeat()
+	filters := sizing.Filters{TickSize: 0.1, StepSize: 0.001, MinQty: 0.001, MinNotional: 5}
+	long := &strategy.Position{Strategy: "rules", Symbol: "BTCUSDT", Side: dao.PosLong, State: strategy.StateActiveConfirmed,
+		EntryPx: 60000, InitialQty: 0.1, Qty: 0.1, StopPx: 55000, Leverage: 20, Seq: 1}
+
+	// 20 倍多倉強平價 60000 × 0.95 / 0.995 ≈ 57286；標記價 57500 時 LB ≈ 0.37% < 2%
+	plan, chk := hb.liquidationPlan(long, 57500, 10, filters, 1)
+	if chk.buffer >= 0.01 || chk.liqPx < 57286 || chk.liqPx > 57287 || chk.roe > -0.8 {
+		t.Fatalf("check = %+v", chk)
+	}
+	if len(plan.intents) != 2 || plan.intents[0].Kind != dao.IntentExit || plan.intents[0].Qty != 0.05 || !plan.intents[0].ReduceOnly {
+		t.Fatalf("intents = %+v", plan.intents)
+	}
+	// 止損 liq + (mark − liq) × 0.5 依 tickSize 往下取整（多單遠離標記價）
+	sl := plan.intents[1]
+	if want := math.Floor((chk.liqPx+(57500-chk.liqPx)*0.5)*10) / 10; sl.Kind != dao.IntentSL || sl.Side != dao.SideSell || sl.Qty != 0.05 || sl.TriggerPx != want || plan.pos.StopPx != sl.TriggerPx {
+		t.Errorf("stop = %+v, want trigger %v", sl, want)
+	}
+	if !plan.pos.Flags[liquidationGuardFlag] || long.Qty != 0.1 || plan.pos.Seq != 3 {
+		t.Errorf("position = %+v", plan.pos)
+	}
+
+	// 同一次跌破不重複處理；LB 回升後清除旗標
+	if again, _ := hb.liquidationPlan(plan.pos, 57400, 10, filters, 2); again.changed {
+		t.Errorf("repeated breach = %+v", again.intents)
+	}
+	if recovered, _ := hb.liquidationPlan(plan.pos, 60000, 10, filters, 3); !recovered.changed || len(recovered.intents) != 0 || recovered.pos.Flags[liquidationGuardFlag] {
+		t.Errorf("recovered = %+v", recovered.pos)
+	}
+
+	// 既有止損已較緊時只減倉；reduce_frac 1 全數平倉
+	short := &strategy.Position{Symbol: "ETHUSDT", Side: dao.PosShort, State: strategy.StateActiveConfirmed,
+		EntryPx: 3000, InitialQty: 1, Qty: 1, StopPx: 3050}
+	if plan, _ = hb.liquidationPlan(short, 3140, 20, filters, 1); len(plan.intents) != 1 || plan.intents[0].Side != dao.SideBuy || plan.pos.StopPx != 3050 {
+		t.Errorf("short = %+v", plan.intents)
+	}
+
+	// 減倉量依 stepSize 捨去；剩餘量低於 minQty 時全平
+	odd := &strategy.Position{Symbol: "BTCUSDT", Side: dao.PosLong, State: strategy.StateActiveConfirmed, EntryPx: 60000, InitialQty: 0.123, Qty: 0.123, Leverage: 20}
+	if plan, _ = hb.liquidationPlan(odd, 57500, 20, filters, 1); plan.intents[0].Qty != 0.061 || plan.pos.Qty != 0.062 || plan.intents[1].Qty != 0.062 {
+		t.Errorf("odd lot = %+v", plan.intents)
+	}
+	odd.Qty, odd.InitialQty = 0.0015, 0.0015
+	if plan, _ = hb.liquidationPlan(odd, 57500, 20, filters, 1); len(plan.intents) != 1 || plan.intents[0].Qty != 0.0015 || plan.pos.State != strategy.StateClosed {
+		t.Errorf("dust = %+v", plan.intents)
+	}
+	hb.reduceFrac = 1
+	if plan, _ = hb.liquidationPlan(short, 3140, 20, filters, 1); len(plan.intents) != 1 || plan.pos.State != strategy.StateClosed || plan.pos.Qty != 0 {
+		t.Errorf("close = %+v", plan.pos)
+	}
+}
+
+func TestHeartbeatTick(t *testing.T) {
+	s := newTestServer(t)
+	sink := &recordingSink{}
+	now := time.UnixMilli(1_700_000_000_000)
+	loop := &decisionLoop{decide: s.streamDecider(NewMemoryDecisionStore(), time.Hour), sink: sink, dedupe: NewMemorySignalDedupe(), market: dao.MarketFUT,
+		claimIdle: time.Minute, dedupeTTL: time.Hour, maxAge: 5 * time.Minute, now: func() time.Time { return now },
+		symbols: []string{"BTCUSDT"}}
+	hb := testHeartbeat()
+	fetches := 0
+	hb.fetch = func(_ context.Context, symbol string) (map[string]interface{}, error) {
+		fetches++
+		return map[string]interface{}{"symbol": symbol, "features": `{"spread_bps":1.5,"atr_pct":0.5,"rv_pct":0.1,"ew_dir":1,"invalidation_px":59000}`, "ts": now.UnixMilli()}, nil
+	}
+	ctx := context.Background()
+	// 其他策略的 ETH 20 倍空倉：強平價 57500 × 1.05 / 1.005 ≈ 60075，標記價 60000 時 LB ≈ 0.12%
+	s.strategyRunner.Store.Save(ctx, &strategy.Position{Strategy: "ew_trend", Symbol: "ETHUSDT", Side: dao.PosShort, State: strategy.StateActiveConfirmed,
+		EntryPx: 57500, InitialQty: 0.1, Qty: 0.1, Leverage: 20, OpenedAt: 1})
+
+	// 1. 啟動後第一個週期只記錄起點；強平緩衝跌破時減倉並收緊止損
+	s.heartbeatTick(ctx, loop, hb)
+	if fetches != 0 || len(sink.sent) != 2 || sink.sent[0].IntentID != "ew_trend-ETHUSDT-1-1" || sink.sent[1].Kind != dao.IntentSL || !strings.HasPrefix(sink.sent[1].Reason, "liq_guard: lb 0.0012") {
+		t.Fatalf("first tick: fetches %d, sent %+v", fetches, sink.sent)
+	}
+	if pos, _ := s.strategyRunner.Store.Get(ctx, "ew_trend", "ETHUSDT"); pos.Qty != 0.05 || !pos.Flags[liquidationGuardFlag] {
+		t.Errorf("guarded position = %+v", pos)
+	}
+
+	// 2. 靜默逾 quiet_after：拉快照走決策管線進場；同一快照不重複決策
+	now = now.Add(40 * time.Second)
+	s.heartbeatTick(ctx, loop, hb)
+	s.heartbeatTick(ctx, loop, hb)
+	if fetches != 2 || len(sink.sent) != 3 || sink.sent[2].IntentID != "intent_sig_BTCUSDT_FUT_1700000040000" {
+		t.Fatalf("quiet stream: fetches %d, sent %+v", fetches, sink.sent)
+	}
+
+	// 3. 收到串流事件後不再拉快照
+	loop.touch("BTCUSDT", now)
+	s.heartbeatTick(ctx, loop, hb)
+	if fetches != 2 {
+		t.Errorf("fetched while stream active: %d", fetches)
+	}
+
+	// 4. 下游失敗時不寫回持倉，下次以相同 intent_id 重送
+	s.strategyRunner.Store.Save(ctx, &strategy.Position{Strategy: "ew_trend", Symbol: "SOLUSDT", Side: dao.PosShort, State: strategy.StateActiveConfirmed,
+		EntryPx: 57500, InitialQty: 1, Qty: 1, Leverage: 20, OpenedAt: 2})
+	sink.fail = errors.New("connection refused")
+	s.heartbeatTick(ctx, loop, hb)
+	sink.fail = nil
+	s.heartbeatTick(ctx, loop, hb)
+	if last := sink.sent[len(sink.sent)-2]; last.IntentID != "ew_trend-SOLUSDT-2-1" {
+		t.Errorf("retry = %+v", last)
+	}
+}
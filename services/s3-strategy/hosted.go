@@ -0,0 +1,408 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"s3-strategy/dao"
+	"s3-strategy/internal/config"
+	"s3-strategy/internal/risk"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 策略實例與停止進場開關預設值
+const (
+	rulePrefixWildcard = "*"
+	killSwitchTimeout  = 200 * time.Millisecond
+	reasonKillSwitch   = "kill_switch"
+)
+
+// ruleInstance 規則路徑上的一個策略實例：規則子集、交易對、策略額度與模型；
+// 持倉（strategy:{pos}:<name>:<symbol>）、暫占與信號皆以 name 區分
+type ruleInstance struct {
+	name        string
+	rules       []string        // 規則 ID（結尾 * 為前綴）；空值為 Bundle 全部規則
+	instruments map[string]bool // nil 為全部交易對
+	budget      *risk.Budget    // 策略額度；nil 只受帳戶層額度限制
+	model       *MLModel        // 專屬模型；nil 共用 L2（含遠端評分）
+	rulesOnly   bool
+}
+
+// defaultRuleInstance hosted_strategies 未設定時的單一實例（全部規則、全部交易對、共用額度與模型）
+var defaultRuleInstance = &ruleInstance{name: rulePathStrategy}
+
+func (inst *ruleInstance) covers(symbol string) bool {
+	return inst.instruments == nil || inst.instruments[symbol]
+}
+
+func (inst *ruleInstance) selects(ruleID string) bool {
+	if len(inst.rules) == 0 {
+		return true
+	}
+	for _, pattern := range inst.rules {
+		if prefix, ok := strings.CutSuffix(pattern, rulePrefixWildcard); ok && strings.HasPrefix(ruleID, prefix) {
+			return true
+		}
+		if pattern == ruleID {
+			return true
+		}
+	}
+	return false
+}
+
+// initializeHostedStrategies 依 env.yaml hosted_strategies 建立策略實例（需在風險預算之後）與停止進場開關存取
+func (s *S3_STRATEGYServer) initializeHostedStrategies() {
+	s.killSwitches = risk.NewMemoryKillSwitchStore()
+	if s.redisClient != nil {
+		s.killSwitches = risk.NewRedisKillSwitchStore(s.redisClient.Client)
+	}
+
+	seen := make(map[string]bool)
+	for _, cfg := range config.AppConfig.HostedStrategies {
+		if cfg.Name == "" || seen[cfg.Name] {
+			log.Printf("Skipping hosted strategy with empty or duplicate name %q", cfg.Name)
+			continue
+		}
+		seen[cfg.Name] = true
+		inst := &ruleInstance{name: cfg.Name, rules: cfg.Rules, rulesOnly: cfg.Model.RulesOnly}
+		if len(cfg.Instruments) > 0 {
+			inst.instruments = make(map[string]bool, len(cfg.Instruments))
+			for _, symbol := range cfg.Instruments {
+				inst.instruments[strings.ToUpper(symbol)] = true
+			}
+		}
+
+		inst.budget = s.scopedBudget(cfg.Name, cfg.Risk.FutMarginUSDTMax, cfg.Risk.SpotQuoteUSDTMax, cfg.Risk.ConcurrentEntriesPerSymbol)
+
+		if m := cfg.Model; m.Source != "" && m.Name != "" && !m.RulesOnly {
+			predictor, err := s.loadPredictor(m.Source, config.AppConfig.ML.ModelDir, m.Name, m.Version)
+			if err != nil {
+				log.Printf("Failed to load ML model %s for strategy %s: %v; using shared model", m.Name, cfg.Name, err)
+			} else {
+				inst.model = &MLModel{modelName: predictor.Artifact.Name, version: predictor.Artifact.Version, predictor: predictor}
+			}
+		}
+		s.instances = append(s.instances, inst)
+	}
+	if len(s.instances) > 0 {
+		log.Printf("Hosting %d rule strategies", len(s.instances))
+	}
+
+	// 策略規格的進場/加倉同樣經 reserveEntry 暫占帳戶層與策略額度（strategies.risk）
+	s.specInstances = make(map[string]*ruleInstance, len(s.strategies))
+	for _, st := range s.strategies {
+		inst := &ruleInstance{name: st.Name()}
+		if r, ok := config.AppConfig.Strategies.Risk[st.Name()]; ok {
+			inst.budget = s.scopedBudget(st.Name(), r.FutMarginUSDTMax, r.SpotQuoteUSDTMax, r.ConcurrentEntriesPerSymbol)
+		}
+		s.specInstances[st.Name()] = inst
+	}
+}
+
+// scopedBudget 策略額度：以帳戶層上限為底覆寫大於 0 的項目；帳戶層未啟用或皆未設定時為 nil
+func (s *S3_STRATEGYServer) scopedBudget(name string, futMarginMax, spotQuoteMax float64, concurrentEntries int) *risk.Budget {
+	if s.gateKeeper.budget == nil || (futMarginMax <= 0 && spotQuoteMax <= 0 && concurrentEntries <= 0) {
+		return nil
+	}
+	limits := s.gateKeeper.budget.Limits()
+	if futMarginMax > 0 {
+		limits.FutMarginUSDT = futMarginMax
+	}
+	if spotQuoteMax > 0 {
+		limits.SpotQuoteUSDT = spotQuoteMax
+	}
+	if concurrentEntries > 0 {
+		limits.ConcurrentEntries = concurrentEntries
+	}
+	return s.gateKeeper.budget.Scoped(name, limits)
+}
+
+// specInstance 策略規格的額度實例；未設定策略額度時只受帳戶層額度限制
+func (s *S3_STRATEGYServer) specInstance(name string) *ruleInstance {
+	if inst, ok := s.specInstances[name]; ok {
+		return inst
+	}
+	return &ruleInstance{name: name}
+}
+
+// hostedFor 涵蓋該交易對的策略實例（依設定順序）
+func (s *S3_STRATEGYServer) hostedFor(symbol string) []*ruleInstance {
+	if len(s.instances) == 0 {
+		return []*ruleInstance{defaultRuleInstance}
+	}
+	var out []*ruleInstance
+	for _, inst := range s.instances {
+		if inst.covers(symbol) {
+			out = append(out, inst)
+		}
+	}
+	return out
+}
+
+// engineFor 實例的規則子集引擎；同一快照內快取（熱載後隨新快照重建）
+func (cs *ConfigSnapshot) engineFor(inst *ruleInstance) *RuleEngine {
+	if len(inst.rules) == 0 {
+		return cs.Engine
+	}
+	if engine, ok := cs.engines.Load(inst.name); ok {
+		return engine.(*RuleEngine)
+	}
+	engine, _ := cs.engines.LoadOrStore(inst.name, cs.Engine.subset(inst.selects))
+	return engine.(*RuleEngine)
+}
+
+// subset 共用已編譯程式的規則子集
+func (re *RuleEngine) subset(keep func(ruleID string) bool) *RuleEngine {
+	out := NewRuleEngine()
+	for id, rule := range re.rules {
+		if !keep(id) {
+			continue
+		}
+		out.rules[id] = rule
+		if program, ok := re.programs[id]; ok {
+			out.programs[id] = program
+		}
+		if err, ok := re.errors[id]; ok {
+			out.errors[id] = err
+		}
+	}
+	return out
+}
+
+// reserveEntry 先暫占帳戶層額度，再暫占策略額度；策略額度不足時回滾帳戶層暫占
+func (s *S3_STRATEGYServer) reserveEntry(inst *ruleInstance, intent *dao.OrderIntent) (bool, string) {
+	if ok, reason := s.gateKeeper.Reserve(intent); !ok {
+		return false, reason
+	}
+	if inst.budget == nil {
+		return true, ""
+	}
+	ok, reason := reserveBudget(inst.budget, intent)
+	if ok {
+		return true, ""
+	}
+	s.releaseEntry(&ruleInstance{name: inst.name}, intent)
+	return false, strings.Replace(reason, reasonRiskBudget+":", fmt.Sprintf("%s: strategy %s:", reasonRiskBudget, inst.name), 1)
+}
+
+// releaseEntry 回滾 reserveEntry 的暫占（帳戶層與策略額度）
+func (s *S3_STRATEGYServer) releaseEntry(inst *ruleInstance, intent *dao.OrderIntent) {
+	ctx, cancel := context.WithTimeout(context.Background(), riskBudgetTimeout)
+	defer cancel()
+	for _, budget := range []*risk.Budget{s.gateKeeper.budget, inst.budget} {
+		if budget == nil {
+			continue
+		}
+		if _, err := budget.Release(ctx, intent.IntentID, intent.Symbol, intent.Market); err != nil {
+			log.Printf("Failed to roll back reservation for %s: %v", intent.IntentID, err)
+		}
+	}
+}
+
+// releaseInstances 回報終態時釋放各策略額度的暫占（意圖只屬於一個實例，其餘為無副作用的重複釋放）
+func (s *S3_STRATEGYServer) releaseInstances(ctx context.Context, intentID, symbol string, market dao.Market) error {
+	instances := append([]*ruleInstance(nil), s.instances...)
+	for _, inst := range s.specInstances {
+		instances = append(instances, inst)
+	}
+	for _, inst := range instances {
+		if inst.budget == nil {
+			continue
+		}
+		if _, err := inst.budget.Release(ctx, intentID, symbol, market); err != nil {
+			return fmt.Errorf("strategy %s: %w", inst.name, err)
+		}
+	}
+	return nil
+}
+
+// killState 本次決策讀取的停止進場開關；讀取失敗時所有策略視為已停止（只允許出場）
+type killState struct {
+	symbol string
+	active map[string]string
+	err    error
+}
+
+// reason 策略在該交易對的停止原因（global → strategy → symbol）；未停止時為空字串
+func (k killState) reason(strategyName string) string {
+	if k.err != nil {
+		return fmt.Sprintf("%s: state unavailable: %v", reasonKillSwitch, k.err)
+	}
+	for _, key := range []string{
+		risk.KillSwitchKey(risk.KillScopeGlobal, ""),
+		risk.KillSwitchKey(risk.KillScopeStrategy, strategyName),
+		risk.KillSwitchKey(risk.KillScopeSymbol, k.symbol),
+	} {
+		if reason, ok := k.active[key]; ok {
+			if reason == "" {
+				return key
+			}
+			return fmt.Sprintf("%s (%s)", key, reason)
+		}
+	}
+	return ""
+}
+
+// killSwitchState 一次讀取全域、交易對與各策略（規則路徑實例與策略規格）的開關
+func (s *S3_STRATEGYServer) killSwitchState(symbol string, instances []*ruleInstance) killState {
+	state := killState{symbol: symbol}
+	if s.killSwitches == nil {
+		return state
+	}
+	keys := []string{risk.KillSwitchKey(risk.KillScopeGlobal, ""), risk.KillSwitchKey(risk.KillScopeSymbol, symbol)}
+	for _, inst := range instances {
+		keys = append(keys, risk.KillSwitchKey(risk.KillScopeStrategy, inst.name))
+	}
+	for _, st := range s.strategies {
+		keys = append(keys, risk.KillSwitchKey(risk.KillScopeStrategy, st.Name()))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), killSwitchTimeout)
+	defer cancel()
+	state.active, state.err = s.killSwitches.Lookup(ctx, keys)
+	if state.err != nil {
+		log.Printf("Failed to read kill switches for %s, blocking entries: %v", symbol, state.err)
+	}
+	return state
+}
+
+// KillSwitchRequest PUT /kill_switches
+type KillSwitchRequest struct {
+	Scope  string `json:"scope" validate:"required,oneof=global strategy symbol"`
+	Name   string `json:"name"`
+	Reason string `json:"reason" validate:"required"`
+	TTL    string `json:"ttl"` // 空值不過期
+}
+
+// @Summary List kill switches
+// @Description Active kill switches (global, per strategy, per symbol); entries are blocked while exits continue
+// @Tags risk
+// @Produce json
+// @Success 200 {array} risk.KillSwitch
+// @Router /kill_switches [get]
+func (s *S3_STRATEGYServer) ListKillSwitches(c *gin.Context) {
+	switches, err := s.killSwitches.List(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list kill switches", "details": err.Error()})
+		return
+	}
+	if switches == nil {
+		switches = []risk.KillSwitch{}
+	}
+	c.JSON(http.StatusOK, switches)
+}
+
+// @Summary Set kill switch
+// @Description Stop new entries for all strategies, one strategy or one symbol
+// @Tags risk
+// @Accept json
+// @Produce json
+// @Param request body KillSwitchRequest true "Kill switch"
+// @Success 200 {object} risk.KillSwitch
+// @Router /kill_switches [put]
+func (s *S3_STRATEGYServer) SetKillSwitch(c *gin.Context) {
+	var req KillSwitchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format", "details": err.Error()})
+		return
+	}
+	if err := s.validator.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "details": err.Error()})
+		return
+	}
+	if req.Scope == risk.KillScopeSymbol {
+		req.Name = strings.ToUpper(req.Name)
+	}
+	if err := risk.ValidKillScope(req.Scope, req.Name); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "details": err.Error()})
+		return
+	}
+	var ttl time.Duration
+	if req.TTL != "" {
+		parsed, err := time.ParseDuration(req.TTL)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ttl", "details": fmt.Sprintf("%q is not a positive duration", req.TTL)})
+			return
+		}
+		ttl = parsed
+	}
+
+	k := risk.KillSwitch{Scope: req.Scope, Name: req.Name, Reason: req.Reason}
+	if err := s.killSwitches.Set(c.Request.Context(), k, ttl); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set kill switch", "details": err.Error()})
+		return
+	}
+	if ttl > 0 {
+		k.ExpiresAt = time.Now().Add(ttl).UnixMilli()
+	}
+	s.publishAlert(dao.SevWarn, fmt.Sprintf("%s set: %s; new entries stopped, exits continue", k.Key(), k.Reason))
+	c.JSON(http.StatusOK, k)
+}
+
+// @Summary Clear kill switch
+// @Description Resume entries for the scope
+// @Tags risk
+// @Produce json
+// @Param scope path string true "global|strategy|symbol"
+// @Param name path string false "Strategy or symbol"
+// @Success 200 {object} map[string]interface{}
+// @Router /kill_switches/{scope}/{name} [delete]
+func (s *S3_STRATEGYServer) ClearKillSwitch(c *gin.Context) {
+	scope, name := c.Param("scope"), c.Param("name")
+	if scope == risk.KillScopeSymbol {
+		name = strings.ToUpper(name)
+	}
+	if err := risk.ValidKillScope(scope, name); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "details": err.Error()})
+		return
+	}
+	cleared, err := s.killSwitches.Clear(c.Request.Context(), scope, name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear kill switch", "details": err.Error()})
+		return
+	}
+	if !cleared {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Kill switch not set", "details": risk.KillSwitchKey(scope, name)})
+		return
+	}
+	s.publishAlert(dao.SevInfo, fmt.Sprintf("%s cleared; entries resume", risk.KillSwitchKey(scope, name)))
+	c.JSON(http.StatusOK, gin.H{"cleared": risk.KillSwitchKey(scope, name)})
+}
+
+// instanceScore L2 評分；共用同一模型的實例在同一決策中只評分一次
+func (s *S3_STRATEGYServer) instanceScore(run *decideRun, inst *ruleInstance) (*dao.ModelScore, []dao.FeatureContribution) {
+	if inst.rulesOnly {
+		return s.scoreModel(run.req, inst)
+	}
+	if cached, ok := run.scores[inst.model]; ok {
+		return cached.score, cached.contributions
+	}
+	score, contributions := s.scoreModel(run.req, inst)
+	run.scores[inst.model] = scoredModel{score: score, contributions: contributions}
+	return score, contributions
+}
+
+type scoredModel struct {
+	score         *dao.ModelScore
+	contributions []dao.FeatureContribution
+}
+
+// decideRun 單次決策中各策略實例共用的輸入：配置版本、守門結果、價格查詢、停止進場開關與模型分數
+type decideRun struct {
+	req       *dao.DecideRequest
+	snapshot  *ConfigSnapshot
+	tag       configTag
+	shadow    *ConfigSnapshot // 候選版本影子評估；nil 時不評估
+	shadowTag configTag
+	passed    bool
+	reason    string
+	gates     []dao.GateTrace
+	inputs    func() (pricingInputs, error)
+	kills     killState
+	now       time.Time // 交易時段與停止交易事件的判斷時間
+	commit    bool
+	scores    map[*MLModel]scoredModel
+}
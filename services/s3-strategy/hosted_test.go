@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"s3-strategy/dao"
+	"s3-strategy/internal/risk"
+	"s3-strategy/internal/strategy"
+)
+
+// failingKillSwitches 讀取失敗的開關存取
+type failingKillSwitches struct{ risk.KillSwitchStore }
+
+func (failingKillSwitches) Lookup(context.Context, []string) (map[string]string, error) {
+	return nil, errors.New("connection refused")
+}
+
+func hostedFeatures(extra dao.FeatureSet) dao.FeatureSet {
+	f := dao.FeatureSet{"spread_bps": 1.5, "rv_pctile_30d": 0.1, "rho_usdttwd_14": -0.5, "atr_pct": 0.5, "rv_pct": 0.1, "ew_dir": 1.0, "invalidation_px": 59000.0}
+	for k, v := range extra {
+		f[k] = v
+	}
+	return f
+}
+
+func TestRuleInstance_Selects(t *testing.T) {
+	inst := &ruleInstance{name: "ew_4h", rules: []string{"EW4H-*", "R-002"}}
+	for id, want := range map[string]bool{"EW4H-001": true, "R-002": true, "R-001": false, "EW1D-001": false} {
+		if got := inst.selects(id); got != want {
+			t.Errorf("selects(%s) = %v", id, got)
+		}
+	}
+	if !defaultRuleInstance.selects("anything") || !defaultRuleInstance.covers("ANYUSDT") {
+		t.Error("default instance should select every rule and symbol")
+	}
+}
+
+func TestDecide_HostedStrategies(t *testing.T) {
+	s := newTestServer(t)
+	ledger := risk.NewMemoryLedger()
+	s.gateKeeper.budget = risk.NewBudget(ledger, risk.Limits{FutMarginUSDT: 5000, SpotQuoteUSDT: 10000, ConcurrentEntries: 2, ReservationTTL: time.Minute})
+	trend := &ruleInstance{name: "trend", rules: []string{"R-001"}}
+	carry := &ruleInstance{name: "carry", rules: []string{"R-002"}, instruments: map[string]bool{"BTCUSDT": true}, rulesOnly: true}
+	s.instances = []*ruleInstance{trend, carry}
+	decide := func(id, symbol string) dao.DecideResponse {
+		return s.decide(&dao.DecideRequest{SignalID: id, Symbol: symbol, Market: dao.MarketFUT, Features: hostedFeatures(nil)})
+	}
+
+	// 1. 兩個實例涵蓋 BTCUSDT：各自評估規則子集與模型、各自進場與記錄持倉；頂層決策為第一個非 skip 者
+	response := decide("sig-1", "BTCUSDT")
+	if len(response.Strategies) != 2 || response.Decision.Strategy != "trend" || response.Decision.SizeMult != response.Strategies[0].Decision.SizeMult {
+		t.Fatalf("strategies = %+v", response.Strategies)
+	}
+	if rules := response.Strategies[0].RulesFired; len(rules) != 1 || rules[0] != "R-001" {
+		t.Errorf("trend rules fired = %v", rules)
+	}
+	if m := response.Strategies[1].Trace.Model; m.Path != dao.ModelPathRulesOnly || !strings.Contains(m.FallbackReason, "strategy carry: rules_only") {
+		t.Errorf("carry model = %+v", m)
+	}
+	if len(response.Intents) != 2 || response.Intents[0].IntentID != "intent_sig-1_trend" || response.Intents[1].IntentID != "intent_sig-1_carry" || response.Intents[1].Strategy != "carry" {
+		t.Fatalf("intents = %+v", response.Intents)
+	}
+	for _, name := range []string{"trend", "carry"} {
+		if pos, _ := s.strategyRunner.Store.Get(context.Background(), name, "BTCUSDT"); !isOpen(pos) {
+			t.Errorf("%s position = %+v", name, pos)
+		}
+	}
+
+	// 2. 只有 trend 涵蓋 ETHUSDT；策略額度不足時拒單並回滾帳戶層暫占
+	trend.budget = s.gateKeeper.budget.Scoped("trend", risk.Limits{FutMarginUSDT: 1, SpotQuoteUSDT: 1, ConcurrentEntries: 1, ReservationTTL: time.Minute})
+	response = decide("sig-2", "ETHUSDT")
+	if len(response.Strategies) != 1 || response.Decision.Action != dao.DecisionSkip || !strings.Contains(response.Decision.Reason, "RISK_BUDGET: strategy trend: FUT budget exceeded") {
+		t.Errorf("scoped budget = %+v", response.Decision)
+	}
+	if n, _ := ledger.Usage(context.Background(), risk.ConcurrencyKey("ETHUSDT")); n != 0 {
+		t.Errorf("global concurrency after rollback = %v", n)
+	}
+
+	// 3. 沒有實例涵蓋的交易對
+	s.instances = []*ruleInstance{carry}
+	if response = decide("sig-3", "SOLUSDT"); response.Decision.Action != dao.DecisionSkip || !strings.Contains(response.Decision.Reason, "no hosted strategy covers SOLUSDT") {
+		t.Errorf("uncovered = %+v", response.Decision)
+	}
+}
+
+func TestDecide_KillSwitch(t *testing.T) {
+	s := newTestServer(t)
+	store := risk.NewMemoryKillSwitchStore()
+	s.killSwitches = store
+	ctx := context.Background()
+	decide := func(id string, extra dao.FeatureSet) dao.DecideResponse {
+		return s.decide(&dao.DecideRequest{SignalID: id, Symbol: "BTCUSDT", Market: dao.MarketFUT, Features: hostedFeatures(extra)})
+	}
+
+	// 1. 交易對開關：不進場
+	store.Set(ctx, risk.KillSwitch{Scope: risk.KillScopeSymbol, Name: "BTCUSDT", Reason: "drawdown"}, 0)
+	response := decide("sig-1", nil)
+	if response.Decision.Action != dao.DecisionSkip || response.Decision.Reason != "kill_switch:symbol:BTCUSDT (drawdown)" || len(response.Intents) != 0 {
+		t.Fatalf("symbol switch = %+v", response.Decision)
+	}
+	if response.Trace.KillSwitch != response.Decision.Reason {
+		t.Errorf("trace kill switch = %q", response.Trace.KillSwitch)
+	}
+
+	// 2. 解除後進場；策略開關啟動時反手只平倉
+	store.Clear(ctx, risk.KillScopeSymbol, "BTCUSDT")
+	if response = decide("sig-2", nil); response.Decision.Action != dao.DecisionOpen {
+		t.Fatalf("open = %+v", response.Decision)
+	}
+	s.direction.onOpposite = strategy.OppositeFlip
+	store.Set(ctx, risk.KillSwitch{Scope: risk.KillScopeStrategy, Name: rulePathStrategy, Reason: "manual"}, 0)
+	response = decide("sig-3", dao.FeatureSet{"ew_dir": -1.0, "invalidation_px": 61000.0})
+	if response.Decision.Action != dao.DecisionExit || len(response.Intents) != 1 || !response.Intents[0].ReduceOnly || !strings.Contains(response.Decision.Reason, "kill_switch:strategy:rules (manual)") {
+		t.Errorf("flip under kill switch = %+v %+v", response.Decision, response.Intents)
+	}
+	if pos, _ := s.strategyRunner.Store.Get(ctx, rulePathStrategy, "BTCUSDT"); isOpen(pos) {
+		t.Errorf("position after close-only flip = %+v", pos)
+	}
+
+	// 3. 開關狀態讀取失敗：保守停止進場
+	s.killSwitches = failingKillSwitches{}
+	if response = decide("sig-4", nil); response.Decision.Action != dao.DecisionSkip || !strings.Contains(response.Decision.Reason, "kill_switch: state unavailable") {
+		t.Errorf("unavailable = %+v", response.Decision)
+	}
+}
+
+func TestKillSwitchEndpoints(t *testing.T) {
+	s := newTestServer(t)
+	s.killSwitches = risk.NewMemoryKillSwitchStore()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/kill_switches", s.ListKillSwitches)
+	r.PUT("/kill_switches", s.SetKillSwitch)
+	r.DELETE("/kill_switches/:scope", s.ClearKillSwitch)
+	r.DELETE("/kill_switches/:scope/:name", s.ClearKillSwitch)
+	call := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+
+	if w := call(http.MethodPut, "/kill_switches", `{"scope":"strategy","reason":"halt"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("missing name: %d %s", w.Code, w.Body.String())
+	}
+	if w := call(http.MethodPut, "/kill_switches", `{"scope":"symbol","name":"btcusdt","reason":"drawdown","ttl":"10m"}`); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"name":"BTCUSDT"`) {
+		t.Errorf("set: %d %s", w.Code, w.Body.String())
+	}
+	if w := call(http.MethodGet, "/kill_switches", ""); !strings.Contains(w.Body.String(), `"scope":"symbol"`) {
+		t.Errorf("list: %s", w.Body.String())
+	}
+	if w := call(http.MethodDelete, "/kill_switches/symbol/BTCUSDT", ""); w.Code != http.StatusOK {
+		t.Errorf("clear: %d %s", w.Code, w.Body.String())
+	}
+	if w := call(http.MethodDelete, "/kill_switches/global", ""); w.Code != http.StatusNotFound {
+		t.Errorf("clear unset: %d", w.Code)
+	}
+}
@@ -0,0 +1,285 @@
+package calendar
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// 停止交易事件類型（kind 可自訂，以下為 S10 常用值）
+const (
+	KindSession     = "SESSION" // 不在允許交易時段內
+	KindFunding     = "FUNDING"
+	KindMacro       = "MACRO"
+	KindMaintenance = "MAINTENANCE"
+)
+
+var weekdays = map[string]time.Weekday{
+	"SUN": time.Sunday, "MON": time.Monday, "TUE": time.Tuesday, "WED": time.Wednesday,
+	"THU": time.Thursday, "FRI": time.Friday, "SAT": time.Saturday,
+}
+
+// Window 允許交易時段（時區內 HH:MM，end 可為 24:00；start > end 表示跨午夜，days 指起始日；days 空值為每日）
+type Window struct {
+	Days  []string `json:"days,omitempty"`
+	Start string   `json:"start"`
+	End   string   `json:"end"`
+
+	days       map[time.Weekday]bool
+	start, end int // 當日分鐘
+}
+
+// Blackout 停止進場事件：一次性（start/end，RFC3339）或每日重複（times 為時區內 HH:MM，前後各延伸 before/after）
+type Blackout struct {
+	ID      string    `json:"id"`
+	Kind    string    `json:"kind"`
+	Start   time.Time `json:"start,omitempty"`
+	End     time.Time `json:"end,omitempty"`
+	Times   []string  `json:"times,omitempty"`
+	Days    []string  `json:"days,omitempty"`   // 重複事件限定星期；空值為每日
+	Before  string    `json:"before,omitempty"` // 例：2m
+	After   string    `json:"after,omitempty"`
+	Symbols []string  `json:"symbols,omitempty"` // 空值適用所有交易對
+
+	days          map[time.Weekday]bool
+	times         []int
+	before, after time.Duration
+}
+
+// Override 策略覆寫：sessions 非空時取代全域時段，blackouts 附加於全域事件，ignore 略過全域事件（kind 或 id）
+type Override struct {
+	Sessions  []Window   `json:"sessions,omitempty"`
+	Blackouts []Blackout `json:"blackouts,omitempty"`
+	Ignore    []string   `json:"ignore,omitempty"`
+}
+
+// Calendar S10 Bundle 的交易時段與停止交易事件
+type Calendar struct {
+	Timezone   string              `json:"timezone,omitempty"` // 時段與重複事件的時區（預設 UTC）
+	Sessions   []Window            `json:"sessions,omitempty"` // 空值為全天可交易
+	Blackouts  []Blackout          `json:"blackouts,omitempty"`
+	Strategies map[string]Override `json:"strategies,omitempty"`
+
+	loc *time.Location
+}
+
+// Block 進場被擋下的原因；Until 為事件結束時間（交易時段外為零值）
+type Block struct {
+	Kind  string
+	ID    string
+	Until time.Time
+}
+
+func (b Block) String() string {
+	if b.Kind == KindSession {
+		return "outside trading sessions"
+	}
+	return fmt.Sprintf("blackout %s %s until %s", b.Kind, b.ID, b.Until.UTC().Format(time.RFC3339))
+}
+
+// Parse 解析並驗證行事曆；任一欄位格式錯誤即回傳錯誤
+func Parse(raw []byte) (*Calendar, error) {
+	var c Calendar
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return nil, fmt.Errorf("calendar: %w", err)
+	}
+	tz := c.Timezone
+	if tz == "" {
+		tz = "UTC"
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, fmt.Errorf("calendar: timezone %q: %w", tz, err)
+	}
+	c.loc = loc
+	if err := compileWindows(c.Sessions); err != nil {
+		return nil, err
+	}
+	if err := compileBlackouts(c.Blackouts); err != nil {
+		return nil, err
+	}
+	for name, o := range c.Strategies {
+		if err := compileWindows(o.Sessions); err != nil {
+			return nil, fmt.Errorf("strategy %s: %w", name, err)
+		}
+		if err := compileBlackouts(o.Blackouts); err != nil {
+			return nil, fmt.Errorf("strategy %s: %w", name, err)
+		}
+	}
+	return &c, nil
+}
+
+func compileWindows(windows []Window) error {
+	for i := range windows {
+		w := &windows[i]
+		var err error
+		if w.days, err = parseDays(w.Days); err != nil {
+			return fmt.Errorf("session %d: %w", i, err)
+		}
+		if w.start, err = parseClock(w.Start); err != nil {
+			return fmt.Errorf("session %d: %w", i, err)
+		}
+		if w.end, err = parseClock(w.End); err != nil {
+			return fmt.Errorf("session %d: %w", i, err)
+		}
+		if w.start == w.end {
+			return fmt.Errorf("session %d: empty window %s-%s", i, w.Start, w.End)
+		}
+	}
+	return nil
+}
+
+func compileBlackouts(blackouts []Blackout) error {
+	for i := range blackouts {
+		b := &blackouts[i]
+		if b.ID == "" || b.Kind == "" {
+			return fmt.Errorf("blackout %d: id and kind are required", i)
+		}
+		if len(b.Times) == 0 {
+			if b.Start.IsZero() || !b.End.After(b.Start) {
+				return fmt.Errorf("blackout %s: start must precede end", b.ID)
+			}
+			continue
+		}
+		var err error
+		if b.days, err = parseDays(b.Days); err != nil {
+			return fmt.Errorf("blackout %s: %w", b.ID, err)
+		}
+		for _, t := range b.Times {
+			minute, err := parseClock(t)
+			if err != nil {
+				return fmt.Errorf("blackout %s: %w", b.ID, err)
+			}
+			b.times = append(b.times, minute)
+		}
+		if b.before, err = parseDuration(b.Before); err != nil {
+			return fmt.Errorf("blackout %s: before: %w", b.ID, err)
+		}
+		if b.after, err = parseDuration(b.After); err != nil {
+			return fmt.Errorf("blackout %s: after: %w", b.ID, err)
+		}
+		if b.before+b.after <= 0 {
+			return fmt.Errorf("blackout %s: before/after are both zero", b.ID)
+		}
+	}
+	return nil
+}
+
+// parseClock HH:MM → 當日分鐘（00:00–24:00）
+func parseClock(s string) (int, error) {
+	var h, m int
+	if _, err := fmt.Sscanf(s, "%d:%d", &h, &m); err != nil || h < 0 || m < 0 || m > 59 || h*60+m > 24*60 {
+		return 0, fmt.Errorf("invalid time %q (want HH:MM)", s)
+	}
+	return h*60 + m, nil
+}
+
+func parseDays(days []string) (map[time.Weekday]bool, error) {
+	if len(days) == 0 {
+		return nil, nil
+	}
+	set := make(map[time.Weekday]bool, len(days))
+	for _, d := range days {
+		wd, ok := weekdays[strings.ToUpper(d)]
+		if !ok {
+			return nil, fmt.Errorf("invalid day %q", d)
+		}
+		set[wd] = true
+	}
+	return set, nil
+}
+
+func parseDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err == nil && d < 0 {
+		err = fmt.Errorf("negative duration %s", s)
+	}
+	return d, err
+}
+
+// Check 策略在該交易對於 at 時是否可進場；停止交易事件優先於交易時段回報
+func (c *Calendar) Check(strategy, symbol string, at time.Time) (Block, bool) {
+	if c == nil {
+		return Block{}, false
+	}
+	local := at.In(c.loc)
+	override := c.Strategies[strategy]
+	ignored := make(map[string]bool, len(override.Ignore))
+	for _, key := range override.Ignore {
+		ignored[key] = true
+	}
+
+	for _, list := range [][]Blackout{c.Blackouts, override.Blackouts} {
+		for i := range list {
+			b := &list[i]
+			if ignored[b.Kind] || ignored[b.ID] || !b.appliesTo(symbol) {
+				continue
+			}
+			if until, ok := b.active(local); ok {
+				return Block{Kind: b.Kind, ID: b.ID, Until: until}, true
+			}
+		}
+	}
+
+	sessions := c.Sessions
+	if len(override.Sessions) > 0 {
+		sessions = override.Sessions
+	}
+	if len(sessions) == 0 {
+		return Block{}, false
+	}
+	for i := range sessions {
+		if sessions[i].contains(local) {
+			return Block{}, false
+		}
+	}
+	return Block{Kind: KindSession}, true
+}
+
+func (b *Blackout) appliesTo(symbol string) bool {
+	if len(b.Symbols) == 0 {
+		return true
+	}
+	for _, s := range b.Symbols {
+		if strings.EqualFold(s, symbol) {
+			return true
+		}
+	}
+	return false
+}
+
+// active 一次性事件比對 [start, end)；重複事件比對前一日、當日、次日的 [t − before, t + after)（涵蓋跨午夜）
+func (b *Blackout) active(local time.Time) (time.Time, bool) {
+	if len(b.times) == 0 {
+		return b.End, !local.Before(b.Start) && local.Before(b.End)
+	}
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, local.Location())
+	for offset := -1; offset <= 1; offset++ {
+		day := midnight.AddDate(0, 0, offset)
+		if b.days != nil && !b.days[day.Weekday()] {
+			continue
+		}
+		for _, minute := range b.times {
+			event := day.Add(time.Duration(minute) * time.Minute)
+			if !local.Before(event.Add(-b.before)) && local.Before(event.Add(b.after)) {
+				return event.Add(b.after), true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+func (w *Window) contains(local time.Time) bool {
+	minute := local.Hour()*60 + local.Minute()
+	today := w.days == nil || w.days[local.Weekday()]
+	if w.start < w.end {
+		return today && minute >= w.start && minute < w.end
+	}
+	// 跨午夜：起始日的 start 之後，或前一日開始的時段延續到 end 之前
+	yesterday := w.days == nil || w.days[local.AddDate(0, 0, -1).Weekday()]
+	return (today && minute >= w.start) || (yesterday && minute < w.end)
+}
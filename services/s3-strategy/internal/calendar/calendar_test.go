@@ -0,0 +1,112 @@
+package calendar
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func mustParse(t *testing.T, raw string) *Calendar {
+	t.Helper()
+	c, err := Parse([]byte(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func at(s string) time.Time {
+	ts, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		panic(err)
+	}
+	return ts
+}
+
+func TestCalendar_Blackouts(t *testing.T) {
+	c := mustParse(t, `{
+		"blackouts": [
+			{"id": "funding", "kind": "FUNDING", "times": ["00:00", "08:00", "16:00"], "before": "2m", "after": "3m"},
+			{"id": "us-cpi", "kind": "MACRO", "start": "2026-11-12T13:25:00Z", "end": "2026-11-12T14:00:00Z"},
+			{"id": "eth-upgrade", "kind": "MAINTENANCE", "start": "2026-11-12T13:00:00Z", "end": "2026-11-12T15:00:00Z", "symbols": ["ETHUSDT"]},
+			{"id": "weekly", "kind": "MAINTENANCE", "times": ["02:00"], "days": ["WED"], "after": "30m"}
+		]
+	}`)
+	for _, tc := range []struct {
+		symbol, at string
+		want       string // 空字串表示可進場
+	}{
+		{"BTCUSDT", "2026-11-11T23:58:30Z", "blackout FUNDING funding until 2026-11-12T00:03:00Z"}, // 跨午夜
+		{"BTCUSDT", "2026-11-12T08:02:59Z", "blackout FUNDING funding until 2026-11-12T08:03:00Z"},
+		{"BTCUSDT", "2026-11-12T08:03:00Z", ""},
+		{"BTCUSDT", "2026-11-12T13:30:00Z", "blackout MACRO us-cpi until 2026-11-12T14:00:00Z"},
+		{"BTCUSDT", "2026-11-12T14:30:00Z", ""},
+		{"ETHUSDT", "2026-11-12T14:30:00Z", "blackout MAINTENANCE eth-upgrade until 2026-11-12T15:00:00Z"},
+		{"BTCUSDT", "2026-11-11T02:10:00Z", "blackout MAINTENANCE weekly until 2026-11-11T02:30:00Z"}, // 週三
+		{"BTCUSDT", "2026-11-12T02:10:00Z", ""},
+	} {
+		block, blocked := c.Check("rules", tc.symbol, at(tc.at))
+		if got := block.String(); blocked != (tc.want != "") || (blocked && got != tc.want) {
+			t.Errorf("%s %s: blocked=%v %q, want %q", tc.symbol, tc.at, blocked, got, tc.want)
+		}
+	}
+}
+
+func TestCalendar_SessionsAndOverrides(t *testing.T) {
+	c := mustParse(t, `{
+		"timezone": "Asia/Taipei",
+		"sessions": [{"days": ["MON", "TUE", "WED", "THU", "FRI"], "start": "09:00", "end": "17:00"}],
+		"blackouts": [{"id": "funding", "kind": "FUNDING", "times": ["16:00"], "before": "5m", "after": "5m"}],
+		"strategies": {
+			"ew_1d": {"sessions": [{"days": ["FRI"], "start": "22:00", "end": "02:00"}], "ignore": ["FUNDING"]},
+			"usdttwd": {"blackouts": [{"id": "twd-fix", "kind": "MACRO", "times": ["11:00"], "after": "10m"}]}
+		}
+	}`)
+	for _, tc := range []struct {
+		strategy, at string
+		blocked      bool
+	}{
+		{"rules", "2026-10-19T02:00:00Z", false},  // 週一 10:00 台北
+		{"rules", "2026-10-19T10:00:00Z", true},   // 週一 18:00 台北
+		{"rules", "2026-10-18T02:00:00Z", true},   // 週日
+		{"rules", "2026-10-19T08:02:00Z", true},   // 16:02 資金費結算
+		{"usdttwd", "2026-10-19T03:05:00Z", true}, // 11:05 策略附加事件
+		{"usdttwd", "2026-10-19T03:15:00Z", false},
+		{"ew_1d", "2026-10-23T13:00:00Z", true},  // 覆寫時段：週五 21:00 台北
+		{"ew_1d", "2026-10-23T15:00:00Z", false}, // 週五 23:00 台北
+		{"ew_1d", "2026-10-23T17:30:00Z", false}, // 週六 01:30 台北（週五開始的跨午夜時段）
+		{"ew_1d", "2026-10-24T15:00:00Z", true},  // 週六 23:00 台北
+	} {
+		block, blocked := c.Check(tc.strategy, "BTCUSDT", at(tc.at))
+		if blocked != tc.blocked {
+			t.Errorf("%s %s: blocked=%v (%s)", tc.strategy, tc.at, blocked, block)
+		}
+	}
+	// 時段外與停止交易事件同時成立時回報事件
+	if block, _ := c.Check("rules", "BTCUSDT", at("2026-10-19T08:02:00Z")); block.Kind != KindFunding {
+		t.Errorf("block = %+v", block)
+	}
+	if block, _ := c.Check("rules", "BTCUSDT", at("2026-10-19T10:00:00Z")); block.String() != "outside trading sessions" {
+		t.Errorf("block = %s", block)
+	}
+	var none *Calendar
+	if _, blocked := none.Check("rules", "BTCUSDT", time.Now()); blocked {
+		t.Error("nil calendar blocked")
+	}
+}
+
+func TestParse_Rejects(t *testing.T) {
+	for raw, want := range map[string]string{
+		`{"timezone": "Mars/Olympus"}`:                                                                               "timezone",
+		`{"sessions": [{"start": "9am", "end": "17:00"}]}`:                                                           "invalid time",
+		`{"sessions": [{"days": ["MONDAY"], "start": "09:00", "end": "17:00"}]}`:                                     "invalid day",
+		`{"blackouts": [{"id": "x", "kind": "MACRO", "start": "2026-11-12T14:00:00Z"}]}`:                             "start must precede end",
+		`{"blackouts": [{"kind": "FUNDING", "times": ["00:00"], "after": "1m"}]}`:                                    "id and kind",
+		`{"blackouts": [{"id": "f", "kind": "FUNDING", "times": ["00:00"]}]}`:                                        "both zero",
+		`{"strategies": {"s": {"blackouts": [{"id": "f", "kind": "FUNDING", "times": ["00:00"], "after": "-1m"}]}}}`: "strategy s",
+	} {
+		if _, err := Parse([]byte(raw)); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: err = %v, want %q", raw, err, want)
+		}
+	}
+}
@@ -77,6 +77,123 @@ type Config struct {
 		GoroutineThreshold     int    `yaml:"goroutine_threshold"`
 		GCThreshold            int    `yaml:"gc_threshold"`
 	} `yaml:"memory_monitoring"`
+	Strategies struct {
+		SpecDir string  `yaml:"spec_dir"` // 策略規格 YAML 目錄
+		NAVUSDT float64 `yaml:"nav_usdt"` // 帳戶淨值備援（S1 /account/balance 不可用且無快取時使用）
+		Risk    map[string]struct {
+			FutMarginUSDTMax           float64 `yaml:"fut_margin_usdt_max"`           // 策略期貨保證金上限；0 沿用 risk 區塊上限
+			SpotQuoteUSDTMax           float64 `yaml:"spot_quote_usdt_max"`           // 策略現貨名義金額上限
+			ConcurrentEntriesPerSymbol int     `yaml:"concurrent_entries_per_symbol"` // 策略單一標的併發入場數
+		} `yaml:"risk"` // 策略規格的策略額度（鍵為 strategy 名稱）；未列出者只受帳戶層額度限制
+	} `yaml:"strategies"`
+	Risk struct {
+		FutMarginUSDTMax           float64 `yaml:"fut_margin_usdt_max"`           // 期貨保證金暫占上限
+		SpotQuoteUSDTMax           float64 `yaml:"spot_quote_usdt_max"`           // 現貨名義金額暫占上限
+		ConcurrentEntriesPerSymbol int     `yaml:"concurrent_entries_per_symbol"` // 單一標的併發入場數
+		ReservationTTL             string  `yaml:"reservation_ttl"`               // 意圖未回報時暫占失效時間
+		ResultsStream              string  `yaml:"results_stream"`                // 成交/撤單回報 Stream（釋放暫占）
+	} `yaml:"risk"`
+	ML struct {
+		Source   string `yaml:"source"`    // file|arango；空值使用啟發式分數
+		ModelDir string `yaml:"model_dir"` // <model_dir>/<name>/<version>/manifest.json
+		Name     string `yaml:"name"`
+		Version  string `yaml:"version"` // 空值：磁碟取最大版本、Arango 取 active
+		Remote   struct {
+			URL              string `yaml:"url"`               // 模型即服務 POST 端點；設定後取代本地模型
+			Timeout          string `yaml:"timeout"`           // 單次評分期限（含對沖）
+			HedgeAfter       string `yaml:"hedge_after"`       // 逾此時間未回應即送對沖請求
+			FailureThreshold int    `yaml:"failure_threshold"` // 連續失敗次數達此值開啟斷路器
+			Cooldown         string `yaml:"cooldown"`          // 斷路器開啟後的冷卻時間
+		} `yaml:"remote"`
+	} `yaml:"ml"`
+	ConfigWatch struct {
+		EventsStream string `yaml:"events_stream"` // S10 配置推廣事件 Stream
+		PollInterval string `yaml:"poll_interval"` // config_active.rev 輪詢間隔（事件遺失補償）；0 停用
+	} `yaml:"config_watch"`
+	Decide struct {
+		IdempotencyTTL string `yaml:"idempotency_ttl"` // 已保存決策保留時間（signal_id + 配置版本重送時直接回傳）；0 停用
+		InFlightWait   string `yaml:"in_flight_wait"`  // 同一信號處理中時等待結果的上限，逾時回 409
+		BatchWorkers   int    `yaml:"batch_workers"`   // POST /decide/batch 並行決策的交易對數
+		MaxBatch       int    `yaml:"max_batch"`       // 單次批次請求筆數上限
+	} `yaml:"decide"`
+	DecisionLoop struct {
+		Enabled         bool     `yaml:"enabled"`
+		Symbols         []string `yaml:"symbols"`           // 空值取現行 Bundle instruments
+		Market          string   `yaml:"market"`            // 事件未帶 market 時使用（預設 FUT）
+		StreamPrefix    string   `yaml:"stream_prefix"`     // 特徵事件 Stream 前綴（feat:events:）
+		Group           string   `yaml:"group"`             // consumer group
+		Sink            string   `yaml:"sink"`              // http（S4 POST /orders）| stream（ord:cmd:{SYMBOL}）
+		OrdersURL       string   `yaml:"orders_url"`        // S4 POST /orders 完整 URL
+		CmdStreamPrefix string   `yaml:"cmd_stream_prefix"` // 下單命令 Stream 前綴（ord:cmd:）
+		ClaimIdle       string   `yaml:"claim_idle"`        // pending 訊息閒置逾此時間由其他消費者接手
+		DedupeTTL       string   `yaml:"dedupe_ttl"`        // 已處理 signal_id 保留時間
+		MaxEventAge     string   `yaml:"max_event_age"`     // 逾此時間的特徵快照不再決策
+		DryRun          bool     `yaml:"dry_run"`
+	} `yaml:"decision_loop"`
+	Heartbeat struct {
+		Enabled               bool     `yaml:"enabled"`
+		Interval              string   `yaml:"interval"`                // 巡檢週期（預設 10s）
+		QuietAfter            string   `yaml:"quiet_after"`             // feat:events 逾此時間無更新時主動拉取快照
+		SnapshotURL           string   `yaml:"snapshot_url"`            // S2 GET /features 完整 URL
+		LBMin                 float64  `yaml:"lb_min"`                  // 強平緩衝下限 |mark − liq| / mark
+		MaintenanceMarginRate float64  `yaml:"maintenance_margin_rate"` // 維持保證金率（計算逐倉強平價）
+		OnBreach              []string `yaml:"on_breach"`               // reduce | tighten_sl
+		ReduceFrac            float64  `yaml:"reduce_frac"`             // 減倉比例
+		SLBufferFrac          float64  `yaml:"sl_buffer_frac"`          // 新止損 = liq + (mark − liq) × frac（只收緊）
+	} `yaml:"heartbeat"`
+	Sizing struct {
+		BaseRiskPctOfNav float64  `yaml:"base_risk_pct_of_nav"` // 每筆風險占 NAV 百分比（1.0 = 1%）
+		ConvictionLower  float64  `yaml:"conviction_lower"`     // 信心倍率（L1 × L2 size_mult）夾限下限
+		ConvictionUpper  float64  `yaml:"conviction_upper"`     // 信心倍率夾限上限
+		StopRefs         []string `yaml:"stop_refs"`            // 無效化價特徵，依序取第一個有值者
+		Leverage         int      `yaml:"leverage"`             // FUT 槓桿（SPOT 固定 1）
+		MaxMarginUSDT    float64  `yaml:"max_margin_usdt"`      // 單筆保證金上限；0 不限
+		ExchangeURL      string   `yaml:"exchange_url"`         // S1 base URL（/market/data、/account/balance）
+		PriceTimeout     string   `yaml:"price_timeout"`        // 價格/NAV/交易所限制查詢期限
+		NAVRefresh       string   `yaml:"nav_refresh"`          // NAV 快取時間
+		FiltersTTL       string   `yaml:"filters_ttl"`          // instrument_registry 快取時間
+	} `yaml:"sizing"`
+	Direction struct {
+		Features    []string `yaml:"features"`      // 有號方向特徵，依序取第一個非零者（數值正負或 LONG/SHORT/UP/DOWN）
+		OnOpposite  string   `yaml:"on_opposite"`   // 持倉中出現反向信號：hold | close | flip
+		MaxAdds     int      `yaml:"max_adds"`      // 同向信號加倉次數上限；0 不加倉
+		AddSizeFrac float64  `yaml:"add_size_frac"` // 加倉數量占重新計算倉位的比例
+	} `yaml:"direction"`
+	Candidate struct {
+		Mode       string `yaml:"mode"`        // canary（依推廣分流）| shadow（僅影子評估）| off
+		TrafficPct int    `yaml:"traffic_pct"` // 推廣記錄未帶 traffic_pct 時的 CANARY 流量百分比
+	} `yaml:"candidate"`
+	PortfolioGate struct {
+		Enabled              bool               `yaml:"enabled"`
+		CorrelationKey       string             `yaml:"correlation_key"`         // S2/S9 回填的相關係數 Hash（欄位 <A>:<B>，值為 ρ）
+		CorrelationRefresh   string             `yaml:"correlation_refresh"`     // 相關係數快取時間
+		MaxPairRho           float64            `yaml:"max_pair_rho"`            // 同方向且 ρ ≥ 此值視為同一風險
+		CombineRiskIfExceeds bool               `yaml:"combine_risk_if_exceeds"` // 高相關曝險合併計算；false 只合併同標的
+		CorrelatedCapPct     float64            `yaml:"correlated_cap_pct"`      // 合併後同方向曝險上限（占 NAV）；0 取資產類上限
+		StrategyCapPct       float64            `yaml:"strategy_cap_pct"`        // 單一策略總曝險上限（by_strategy 未列者）
+		ByStrategy           map[string]float64 `yaml:"by_strategy"`             // 策略 → 總曝險上限（規則路徑為 rules）
+		ByAssetClass         map[string]float64 `yaml:"by_asset_class"`          // 資產類 → 總曝險上限
+		AssetClasses         map[string]string  `yaml:"asset_classes"`           // 交易對 → 資產類
+		DefaultAssetClass    string             `yaml:"default_asset_class"`     // asset_classes 未列者
+		NetDeltaRange        []float64          `yaml:"net_delta_range"`         // 下單後（多 − 空）/ NAV 區間
+		OnViolation          map[string]string  `yaml:"on_violation"`            // correlation/strategy_budget/asset_class/net_delta → prefer_higher_score|downsize_to_fit|skip_entry
+	} `yaml:"portfolio_gate"`
+	HostedStrategies []struct {
+		Name        string   `yaml:"name"`        // 持倉鍵 strategy:{pos}:<name>:<symbol>、意圖 strategy 欄位
+		Rules       []string `yaml:"rules"`       // 規則 ID（結尾 * 為前綴）；空值為現行 Bundle 全部規則
+		Instruments []string `yaml:"instruments"` // 空值為全部交易對
+		Risk        struct {
+			FutMarginUSDTMax           float64 `yaml:"fut_margin_usdt_max"`           // 策略期貨保證金上限；0 沿用 risk 區塊上限
+			SpotQuoteUSDTMax           float64 `yaml:"spot_quote_usdt_max"`           // 策略現貨名義金額上限
+			ConcurrentEntriesPerSymbol int     `yaml:"concurrent_entries_per_symbol"` // 策略單一標的併發入場數
+		} `yaml:"risk"`
+		Model struct {
+			Source    string `yaml:"source"` // file|arango；空值共用 ml 區塊模型
+			Name      string `yaml:"name"`
+			Version   string `yaml:"version"`
+			RulesOnly bool   `yaml:"rules_only"` // 不評分，只用規則倉位
+		} `yaml:"model"`
+	} `yaml:"hosted_strategies"` // 空值：單一實例 rules（全部規則、全部交易對）
 }
 
 // LoadConfig loads configuration file with priority: env.local.yaml > env.yaml > config.yaml
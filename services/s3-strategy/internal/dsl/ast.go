@@ -0,0 +1,447 @@
+package dsl
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Env 求值環境：依特徵名取值，缺值回傳 Null
+type Env interface {
+	Lookup(name string) Value
+}
+
+// MapEnv 以特徵 map 作為求值環境（dao.FeatureSet 可直接轉型）
+type MapEnv map[string]interface{}
+
+func (m MapEnv) Lookup(name string) Value {
+	return FromAny(m[name])
+}
+
+// node AST 節點；編譯後不可變，可併發求值
+type node interface {
+	position() int
+	eval(env Env) Value
+	// format 輸出正規化的表達式文字
+	format(sb *strings.Builder)
+}
+
+type litNode struct {
+	pos int
+	v   Value
+}
+
+func (n *litNode) position() int              { return n.pos }
+func (n *litNode) eval(Env) Value             { return n.v }
+func (n *litNode) format(sb *strings.Builder) { sb.WriteString(n.v.String()) }
+
+type identNode struct {
+	pos  int
+	name string
+}
+
+func (n *identNode) position() int              { return n.pos }
+func (n *identNode) eval(env Env) Value         { return env.Lookup(n.name) }
+func (n *identNode) format(sb *strings.Builder) { sb.WriteString(n.name) }
+
+type listNode struct {
+	pos   int
+	items []node
+}
+
+func (n *listNode) position() int { return n.pos }
+
+func (n *listNode) eval(env Env) Value {
+	items := make([]Value, len(n.items))
+	for i, item := range n.items {
+		items[i] = item.eval(env)
+	}
+	return Value{Kind: KindList, List: items}
+}
+
+func (n *listNode) format(sb *strings.Builder) {
+	sb.WriteByte('[')
+	for i, item := range n.items {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		item.format(sb)
+	}
+	sb.WriteByte(']')
+}
+
+// logicNode 多元 and/or（Kleene 三值邏輯）
+//
+//	and：任一 FALSE → FALSE；否則任一 Null → Null；否則 TRUE
+//	or ：任一 TRUE → TRUE；否則任一 Null → Null；否則 FALSE
+type logicNode struct {
+	pos   int
+	any   bool
+	items []node
+}
+
+func (n *logicNode) position() int { return n.pos }
+
+func (n *logicNode) eval(env Env) Value {
+	unknown := false
+	for _, item := range n.items {
+		v := item.eval(env).truth()
+		if v.IsNull() {
+			unknown = true
+			continue
+		}
+		if v.Bool == n.any {
+			return Bool(n.any)
+		}
+	}
+	if unknown {
+		return Null
+	}
+	return Bool(!n.any)
+}
+
+func (n *logicNode) format(sb *strings.Builder) {
+	sep := " and "
+	if n.any {
+		sep = " or "
+	}
+	sb.WriteByte('(')
+	for i, item := range n.items {
+		if i > 0 {
+			sb.WriteString(sep)
+		}
+		item.format(sb)
+	}
+	sb.WriteByte(')')
+}
+
+type notNode struct {
+	pos int
+	x   node
+}
+
+func (n *notNode) position() int { return n.pos }
+
+func (n *notNode) eval(env Env) Value {
+	v := n.x.eval(env).truth()
+	if v.IsNull() {
+		return Null
+	}
+	return Bool(!v.Bool)
+}
+
+func (n *notNode) format(sb *strings.Builder) {
+	sb.WriteString("not ")
+	n.x.format(sb)
+}
+
+// cmpNode 比較；任一側為 Null 時結果為 Null，唯 `== null` / `!= null` 為缺值判斷
+type cmpNode struct {
+	pos  int
+	op   string
+	l, r node
+}
+
+func newCmp(pos int, op string, l, r node) (node, error) {
+	for _, side := range []node{l, r} {
+		lit, ok := side.(*litNode)
+		if !ok {
+			continue
+		}
+		if lit.v.Kind == KindList {
+			return nil, &ParseError{Pos: lit.pos, Msg: fmt.Sprintf("cannot compare with list using %q; use \"in\"", op)}
+		}
+		if lit.v.IsNull() && op != "==" && op != "!=" {
+			return nil, &ParseError{Pos: lit.pos, Msg: fmt.Sprintf("null can only be compared with == or !=, not %q", op)}
+		}
+		if lit.v.Kind == KindString && op != "==" && op != "!=" {
+			return nil, &ParseError{Pos: lit.pos, Msg: fmt.Sprintf("string operand not allowed with %q", op)}
+		}
+	}
+	return &cmpNode{pos: pos, op: op, l: l, r: r}, nil
+}
+
+func (n *cmpNode) position() int { return n.pos }
+
+func (n *cmpNode) eval(env Env) Value {
+	a, b := n.l.eval(env), n.r.eval(env)
+
+	if n.op == "==" || n.op == "!=" {
+		if isNullLit(n.l) || isNullLit(n.r) {
+			return Bool((a.IsNull() && b.IsNull()) == (n.op == "=="))
+		}
+		eq := equal(a, b)
+		if eq.IsNull() || n.op == "==" {
+			return eq
+		}
+		return Bool(!eq.Bool)
+	}
+
+	x, okA := a.numeric()
+	y, okB := b.numeric()
+	if !okA || !okB {
+		return Null
+	}
+	switch n.op {
+	case "<":
+		return Bool(x < y)
+	case "<=":
+		return Bool(x <= y)
+	case ">":
+		return Bool(x > y)
+	case ">=":
+		return Bool(x >= y)
+	}
+	return Null
+}
+
+func (n *cmpNode) format(sb *strings.Builder) {
+	n.l.format(sb)
+	sb.WriteString(" " + n.op + " ")
+	n.r.format(sb)
+}
+
+func isNullLit(n node) bool {
+	lit, ok := n.(*litNode)
+	return ok && lit.v.IsNull()
+}
+
+// inNode 成員判斷；左值為 Null 時結果為 Null，清單中含 Null 且未命中時亦為 Null
+type inNode struct {
+	pos    int
+	x      node
+	list   node
+	negate bool
+}
+
+func newIn(pos int, x, list node, negate bool) (node, error) {
+	if lit, ok := list.(*litNode); ok {
+		return nil, &ParseError{Pos: lit.pos, Msg: "right side of \"in\" must be a list, got " + lit.v.Kind.String()}
+	}
+	if _, ok := list.(*arithNode); ok {
+		return nil, &ParseError{Pos: list.position(), Msg: "right side of \"in\" must be a list, got number"}
+	}
+	return &inNode{pos: pos, x: x, list: list, negate: negate}, nil
+}
+
+func (n *inNode) position() int { return n.pos }
+
+func (n *inNode) eval(env Env) Value {
+	x := n.x.eval(env)
+	list := n.list.eval(env)
+	if x.IsNull() || list.Kind != KindList {
+		return Null
+	}
+	unknown := false
+	found := false
+	for _, item := range list.List {
+		eq := equal(x, item)
+		if eq.IsNull() {
+			unknown = true
+			continue
+		}
+		if eq.Bool {
+			found = true
+			break
+		}
+	}
+	if !found && unknown {
+		return Null
+	}
+	return Bool(found != n.negate)
+}
+
+func (n *inNode) format(sb *strings.Builder) {
+	n.x.format(sb)
+	if n.negate {
+		sb.WriteString(" not in ")
+	} else {
+		sb.WriteString(" in ")
+	}
+	n.list.format(sb)
+}
+
+// betweenNode 閉區間判斷 lo <= x <= hi
+type betweenNode struct {
+	pos       int
+	x, lo, hi node
+}
+
+func newBetween(pos int, x, lo, hi node) (node, error) {
+	for _, bound := range []node{x, lo, hi} {
+		if lit, ok := bound.(*litNode); ok && lit.v.Kind != KindNumber && lit.v.Kind != KindBool {
+			return nil, &ParseError{Pos: lit.pos, Msg: "between requires numeric operands, got " + lit.v.Kind.String()}
+		}
+		if _, ok := bound.(*listNode); ok {
+			return nil, &ParseError{Pos: bound.position(), Msg: "between requires numeric operands, got list"}
+		}
+	}
+	return &betweenNode{pos: pos, x: x, lo: lo, hi: hi}, nil
+}
+
+func (n *betweenNode) position() int { return n.pos }
+
+func (n *betweenNode) eval(env Env) Value {
+	x, okX := n.x.eval(env).numeric()
+	lo, okLo := n.lo.eval(env).numeric()
+	hi, okHi := n.hi.eval(env).numeric()
+	if !okX || !okLo || !okHi {
+		return Null
+	}
+	return Bool(x >= lo && x <= hi)
+}
+
+func (n *betweenNode) format(sb *strings.Builder) {
+	n.x.format(sb)
+	sb.WriteString(" between ")
+	n.lo.format(sb)
+	sb.WriteString(" and ")
+	n.hi.format(sb)
+}
+
+// arithNode 四則運算；非數值運算元、除以零皆為 Null
+type arithNode struct {
+	pos  int
+	op   byte
+	l, r node
+}
+
+func newArith(pos int, op byte, l, r node) (node, error) {
+	for _, side := range []node{l, r} {
+		if lit, ok := side.(*litNode); ok && lit.v.Kind != KindNumber && lit.v.Kind != KindBool {
+			return nil, &ParseError{Pos: lit.pos, Msg: fmt.Sprintf("operator %q requires numeric operands, got %s", string(op), lit.v.Kind)}
+		}
+		if _, ok := side.(*listNode); ok {
+			return nil, &ParseError{Pos: side.position(), Msg: fmt.Sprintf("operator %q requires numeric operands, got list", string(op))}
+		}
+	}
+	if lit, ok := r.(*litNode); ok && (op == '/' || op == '%') && lit.v.Kind == KindNumber && lit.v.Num == 0 {
+		return nil, &ParseError{Pos: lit.pos, Msg: "division by zero"}
+	}
+	return &arithNode{pos: pos, op: op, l: l, r: r}, nil
+}
+
+func (n *arithNode) position() int { return n.pos }
+
+func (n *arithNode) eval(env Env) Value {
+	x, okA := n.l.eval(env).numeric()
+	y, okB := n.r.eval(env).numeric()
+	if !okA || !okB {
+		return Null
+	}
+	switch n.op {
+	case '+':
+		return Number(x + y)
+	case '-':
+		return Number(x - y)
+	case '*':
+		return Number(x * y)
+	case '/':
+		if y == 0 {
+			return Null
+		}
+		return Number(x / y)
+	case '%':
+		if y == 0 {
+			return Null
+		}
+		return Number(math.Mod(x, y))
+	}
+	return Null
+}
+
+func (n *arithNode) format(sb *strings.Builder) {
+	sb.WriteByte('(')
+	n.l.format(sb)
+	sb.WriteString(" " + string(n.op) + " ")
+	n.r.format(sb)
+	sb.WriteByte(')')
+}
+
+// callNode 白名單函式呼叫
+type callNode struct {
+	pos   int
+	name  string
+	args  []node
+	named map[string]node
+	fn    *function
+}
+
+func (n *callNode) position() int { return n.pos }
+
+func (n *callNode) eval(env Env) Value {
+	args := make([]Value, len(n.args))
+	for i, arg := range n.args {
+		args[i] = arg.eval(env)
+	}
+	named := make(map[string]Value, len(n.fn.named))
+	for key, def := range n.fn.named {
+		named[key] = def
+	}
+	for key, arg := range n.named {
+		named[key] = arg.eval(env)
+	}
+	return n.fn.eval(env, args, named)
+}
+
+func (n *callNode) format(sb *strings.Builder) {
+	sb.WriteString(n.name)
+	sb.WriteByte('(')
+	for i, arg := range n.args {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		arg.format(sb)
+	}
+	keys := make([]string, 0, len(n.named))
+	for key := range n.named {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for i, key := range keys {
+		if i > 0 || len(n.args) > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(key + "=")
+		n.named[key].format(sb)
+	}
+	sb.WriteByte(')')
+}
+
+// walk 前序走訪 AST
+func walk(n node, visit func(node)) {
+	visit(n)
+	switch t := n.(type) {
+	case *listNode:
+		for _, item := range t.items {
+			walk(item, visit)
+		}
+	case *logicNode:
+		for _, item := range t.items {
+			walk(item, visit)
+		}
+	case *notNode:
+		walk(t.x, visit)
+	case *cmpNode:
+		walk(t.l, visit)
+		walk(t.r, visit)
+	case *inNode:
+		walk(t.x, visit)
+		walk(t.list, visit)
+	case *betweenNode:
+		walk(t.x, visit)
+		walk(t.lo, visit)
+		walk(t.hi, visit)
+	case *arithNode:
+		walk(t.l, visit)
+		walk(t.r, visit)
+	case *callNode:
+		for _, arg := range t.args {
+			walk(arg, visit)
+		}
+		for _, arg := range t.named {
+			walk(arg, visit)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package dsl
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func mustCompile(t *testing.T, conditions string) *Program {
+	t.Helper()
+	program, err := Compile(conditions)
+	if err != nil {
+		t.Fatalf("Compile(%q) failed: %v", conditions, err)
+	}
+	return program
+}
+
+func TestCompile_EWJSONTemplate(t *testing.T) {
+	program := mustCompile(t, `{"allOf":[{"f":"ew_state_tf_15m","op":"in","v":["IMPULSE_3"]},{"f":"ew_confidence_15m","op":">","v":0.7}]}`)
+
+	if !program.Match(MapEnv{"ew_state_tf_15m": "IMPULSE_3", "ew_confidence_15m": 0.8}) {
+		t.Error("expected match")
+	}
+	if program.Match(MapEnv{"ew_state_tf_15m": "IMPULSE_5", "ew_confidence_15m": 0.8}) {
+		t.Error("unexpected match on other state")
+	}
+	if got := program.Features(); strings.Join(got, ",") != "ew_confidence_15m,ew_state_tf_15m" {
+		t.Errorf("Features() = %v", got)
+	}
+}
+
+func TestCompile_EWYAMLTemplate(t *testing.T) {
+	source := `
+when:
+  all:
+    - "wave_signal_4h in [\"end_of_2_confirmed\",\"triangle_e_break\"]"
+    - "wave_impulse_score_4h >= 0.75 or wave_triangle_score_4h >= 0.75"
+    - "wave_channel_ok_5m == 1"
+    - "not higher_tf_conflict([\"1d\"])"
+    - "higher_tf_align([\"1d\"], allow_same_direction_only=true)"
+`
+	var decoded interface{}
+	if err := yaml.Unmarshal([]byte(source), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	program, err := CompileValue(decoded)
+	if err != nil {
+		t.Fatalf("CompileValue failed: %v", err)
+	}
+
+	env := MapEnv{
+		"wave_signal_4h":         "end_of_2_confirmed",
+		"wave_impulse_score_4h":  0.6,
+		"wave_triangle_score_4h": 0.8,
+		"wave_channel_ok_5m":     1.0,
+		"direction":              "LONG",
+		"wave_direction_1d":      "UP",
+	}
+	if !program.Match(env) {
+		t.Errorf("expected match, got %v", program.Eval(env))
+	}
+
+	env["wave_direction_1d"] = "DOWN"
+	if program.Match(env) {
+		t.Error("unexpected match with conflicting 1d direction")
+	}
+
+	// 高週期方向缺值：結果未知，不命中
+	delete(env, "wave_direction_1d")
+	if got := program.Eval(env); !got.IsNull() {
+		t.Errorf("expected null, got %v", got)
+	}
+
+	// 退回 trend_<tf>
+	env["trend_1d"] = 1.0
+	if !program.Match(env) {
+		t.Error("expected match via trend_1d")
+	}
+}
+
+func TestEval_Expressions(t *testing.T) {
+	env := MapEnv{
+		"wave_signal_4h": "end_of_2_confirmed",
+		"rsi_14":         28.0,
+		"close":          101.0,
+		"ema_20":         100.0,
+		"atr_pct":        0.5,
+		"flag":           true,
+		"zero":           0.0,
+	}
+	cases := []struct {
+		expr string
+		want string
+	}{
+		{`wave_signal_4h == "end_of_2_confirmed"`, "true"},
+		{`wave_signal_4h != 'end_of_2_confirmed'`, "false"},
+		{`rsi_14 between 20 and 30`, "true"},
+		{`rsi_14 between 30 and 40`, "false"},
+		{`(close - ema_20) / ema_20 * 100 > 0.9`, "true"},
+		{`close / zero > 1`, "null"},
+		{`abs(ema_20 - close) <= 2 * atr_pct`, "true"},
+		{`max(rsi_14, 50) == 50 && min(rsi_14, 50) == 28`, "true"},
+		{`rsi_14 not in [10, 20, 28]`, "false"},
+		{`flag and !(rsi_14 > 70)`, "true"},
+		{`flag == 1`, "true"},
+		{`-rsi_14 < -20`, "true"},
+		{`coalesce(missing, 3) == 3`, "true"},
+		{`close % 2 == 1`, "true"},
+	}
+	for _, tc := range cases {
+		program := mustCompile(t, tc.expr)
+		if got := program.Eval(env).String(); got != tc.want {
+			t.Errorf("%s = %s, want %s", tc.expr, got, tc.want)
+		}
+	}
+}
+
+func TestEval_NullSemantics(t *testing.T) {
+	env := MapEnv{"x": 1.0, "s": "A", "f": false}
+	cases := []struct {
+		expr string
+		want string
+	}{
+		{`missing > 0`, "null"},
+		{`not (missing > 0)`, "null"},
+		{`missing > 0 and x > 0`, "null"},
+		{`missing > 0 and x < 0`, "false"},
+		{`missing > 0 or x > 0`, "true"},
+		{`missing == null`, "true"},
+		{`x != null`, "true"},
+		{`missing in ["A"]`, "null"},
+		{`s in ["A", missing]`, "true"},
+		{`s in ["B", missing]`, "null"},
+		{`s > 1`, "null"},
+		{`s == 1`, "false"},
+		{`f or missing == 1`, "null"},
+	}
+	for _, tc := range cases {
+		program := mustCompile(t, tc.expr)
+		if got := program.Eval(env).String(); got != tc.want {
+			t.Errorf("%s = %s, want %s", tc.expr, got, tc.want)
+		}
+		if program.Eval(env).IsNull() && program.Match(env) {
+			t.Errorf("%s: null result must not match", tc.expr)
+		}
+	}
+}
+
+func TestCompileValue_Structured(t *testing.T) {
+	program := mustCompile(t, `{"any":[
+		{"not":{"f":"rv_pctile_30d","op":">=","v":0.25}},
+		{"all":[{"f":"close","op":">","v":{"f":"ema_20"}},{"f":"rsi_14","op":"between","v":[40,60]}]},
+		"wave_signal_4h == \"triangle_e_break\""
+	]}`)
+
+	cases := []struct {
+		env  MapEnv
+		want bool
+	}{
+		{MapEnv{"rv_pctile_30d": 0.1}, true},
+		{MapEnv{"rv_pctile_30d": 0.5, "close": 10.0, "ema_20": 9.0, "rsi_14": 50.0}, true},
+		{MapEnv{"rv_pctile_30d": 0.5, "close": 8.0, "ema_20": 9.0, "rsi_14": 50.0}, false},
+		{MapEnv{"rv_pctile_30d": 0.5, "wave_signal_4h": "triangle_e_break"}, true},
+	}
+	for i, tc := range cases {
+		if got := program.Match(tc.env); got != tc.want {
+			t.Errorf("case %d: Match = %v, want %v (%s)", i, got, tc.want, program)
+		}
+	}
+
+	// 純文字條件
+	if !mustCompile(t, `rv_pctile_30d < 0.25`).Match(MapEnv{"rv_pctile_30d": 0.2}) {
+		t.Error("expected plain expression to match")
+	}
+}
+
+func TestCompile_Errors(t *testing.T) {
+	cases := []struct {
+		conditions string
+		want       string
+	}{
+		{``, "empty condition"},
+		{`{}`, "expected exactly one of"},
+		{`{"allOf":[]}`, "allOf: empty condition list"},
+		{`{"allOf":[{"f":"x","op":"<","v":1},{"f":"y","op":"~","v":1}]}`, "allOf[1].op: unsupported operator"},
+		{`{"allOf":["x > 1", "y >"]}`, "allOf[1]: position 4: unexpected end of expression"},
+		{`{"f":"x","op":"<","v":"abc"}`, `v: position 1: string operand not allowed with "<"`},
+		{`x > 1 and (y < 2`, `position 17: expected ")" at end of expression`},
+		{`x in 5`, `position 6: right side of "in" must be a list`},
+		{`x + "a" > 1`, `position 5: operator "+" requires numeric operands`},
+		{`foo(x)`, `position 1: unknown function "foo"`},
+		{`higher_tf_align(["1d"], strict=true)`, `has no argument "strict"`},
+		{`higher_tf_conflict(tf)`, "expects a non-empty list of timeframes"},
+		{`x / 0 > 1`, "position 5: division by zero"},
+		{`x # 1`, "position 3: unexpected character"},
+		{`{"allOf":[`, "invalid JSON condition"},
+	}
+	for _, tc := range cases {
+		_, err := Compile(tc.conditions)
+		if err == nil {
+			t.Errorf("Compile(%q): expected error", tc.conditions)
+			continue
+		}
+		if !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("Compile(%q) error = %q, want containing %q", tc.conditions, err, tc.want)
+		}
+	}
+
+	deep := strings.Repeat("(", MaxDepth+2) + "x" + strings.Repeat(")", MaxDepth+2)
+	if _, err := Compile(deep); err == nil || !strings.Contains(err.Error(), "nested deeper") {
+		t.Errorf("expected depth error, got %v", err)
+	}
+}
+
+func TestExplain(t *testing.T) {
+	program, err := Compile(`rv_pctile_30d < 0.25 and not (trend_4h in ["down", "flat"]) and funding_next between -0.001 and 0.001`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, conditions := program.Explain(MapEnv{"rv_pctile_30d": 0.1, "trend_4h": "up"})
+	if result != "UNKNOWN" || len(conditions) != 3 {
+		t.Fatalf("result = %s, conditions = %+v", result, conditions)
+	}
+	want := []struct {
+		expr, result string
+		value        interface{}
+	}{
+		{"rv_pctile_30d < 0.25", "TRUE", 0.1},
+		{`trend_4h in ["down", "flat"]`, "FALSE", "up"},
+		{"funding_next between -0.001 and 0.001", "UNKNOWN", nil},
+	}
+	for i, w := range want {
+		c := conditions[i]
+		if c.Expr != w.expr || c.Result != w.result || len(c.Operands) == 0 || c.Operands[0].Value != w.value {
+			t.Errorf("condition %d = %+v, want %s → %s (%v)", i, c, w.expr, w.result, w.value)
+		}
+	}
+}
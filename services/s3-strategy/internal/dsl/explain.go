@@ -0,0 +1,83 @@
+package dsl
+
+import "strings"
+
+// Condition 單一條件（比較/成員/區間/函式/布林特徵）的求值明細
+type Condition struct {
+	Expr     string    `json:"expr"`
+	Result   string    `json:"result"` // TRUE/FALSE/UNKNOWN
+	Operands []Operand `json:"operands,omitempty"`
+}
+
+// Operand 條件中非常數運算元的實際值（nil 為缺值）
+type Operand struct {
+	Expr  string      `json:"expr"`
+	Value interface{} `json:"value"`
+}
+
+// ResultString TRUE/FALSE/UNKNOWN
+func ResultString(v Value) string {
+	switch {
+	case v.IsNull():
+		return "UNKNOWN"
+	case v.IsTrue():
+		return "TRUE"
+	default:
+		return "FALSE"
+	}
+}
+
+// Explain 求值並列出 and/or/not 之下每個條件的結果與運算元（不短路，全部條件皆求值）
+func (p *Program) Explain(env Env) (string, []Condition) {
+	var conditions []Condition
+	var visit func(n node)
+	visit = func(n node) {
+		switch t := n.(type) {
+		case *logicNode:
+			for _, item := range t.items {
+				visit(item)
+			}
+			return
+		case *notNode:
+			visit(t.x)
+			return
+		}
+		conditions = append(conditions, Condition{
+			Expr:     formatNode(n),
+			Result:   ResultString(n.eval(env).truth()),
+			Operands: operands(n, env),
+		})
+	}
+	visit(p.root)
+	return ResultString(p.Eval(env)), conditions
+}
+
+func operands(n node, env Env) []Operand {
+	var sides []node
+	switch t := n.(type) {
+	case *cmpNode:
+		sides = []node{t.l, t.r}
+	case *inNode:
+		sides = []node{t.x, t.list}
+	case *betweenNode:
+		sides = []node{t.x, t.lo, t.hi}
+	case *callNode:
+		sides = t.args
+	case *identNode:
+		sides = []node{t}
+	}
+	var out []Operand
+	for _, side := range sides {
+		if _, ok := side.(*litNode); ok {
+			continue
+		}
+		out = append(out, Operand{Expr: formatNode(side), Value: side.eval(env).Interface()})
+	}
+	return out
+}
+
+func formatNode(n node) string {
+	var sb strings.Builder
+	n.format(&sb)
+	return sb.String()
+}
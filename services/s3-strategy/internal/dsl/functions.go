@@ -0,0 +1,219 @@
+package dsl
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// function 白名單函式定義
+type function struct {
+	minArgs, maxArgs int              // maxArgs < 0 表示不限
+	named            map[string]Value // 允許的具名參數與預設值
+	check            func(call *callNode) error
+	deps             func(call *callNode) []string // 函式隱含讀取的特徵
+	eval             func(env Env, args []Value, named map[string]Value) Value
+}
+
+// functions 可用函式；未列出的名稱編譯失敗
+var functions = map[string]*function{
+	"abs": {minArgs: 1, maxArgs: 1, eval: func(_ Env, args []Value, _ map[string]Value) Value {
+		x, ok := args[0].numeric()
+		if !ok {
+			return Null
+		}
+		return Number(math.Abs(x))
+	}},
+	"min": {minArgs: 1, maxArgs: -1, eval: func(_ Env, args []Value, _ map[string]Value) Value {
+		return fold(args, math.Min)
+	}},
+	"max": {minArgs: 1, maxArgs: -1, eval: func(_ Env, args []Value, _ map[string]Value) Value {
+		return fold(args, math.Max)
+	}},
+	"coalesce": {minArgs: 1, maxArgs: -1, eval: func(_ Env, args []Value, _ map[string]Value) Value {
+		for _, arg := range args {
+			if !arg.IsNull() {
+				return arg
+			}
+		}
+		return Null
+	}},
+	"higher_tf_conflict": {
+		minArgs: 1, maxArgs: 1,
+		check: checkTimeframes,
+		deps:  timeframeDeps,
+		eval: func(env Env, args []Value, _ map[string]Value) Value {
+			ref, ok := DirectionOf(env.Lookup(DirectionFeature))
+			if !ok || ref == 0 {
+				return Null
+			}
+			unknown := false
+			for _, tf := range args[0].List {
+				dir, ok := TimeframeDirection(env, tf.Str)
+				if !ok {
+					unknown = true
+					continue
+				}
+				if dir != 0 && dir != ref {
+					return Bool(true)
+				}
+			}
+			if unknown {
+				return Null
+			}
+			return Bool(false)
+		},
+	},
+	"higher_tf_align": {
+		minArgs: 1, maxArgs: 1,
+		named: map[string]Value{"allow_same_direction_only": Bool(true)},
+		check: checkTimeframes,
+		deps:  timeframeDeps,
+		eval: func(env Env, args []Value, named map[string]Value) Value {
+			ref, ok := DirectionOf(env.Lookup(DirectionFeature))
+			if !ok || ref == 0 {
+				return Null
+			}
+			sameOnly := named["allow_same_direction_only"].truth()
+			if sameOnly.IsNull() {
+				return Null
+			}
+			unknown := false
+			for _, tf := range args[0].List {
+				dir, ok := TimeframeDirection(env, tf.Str)
+				if !ok {
+					unknown = true
+					continue
+				}
+				if dir == ref || (dir == 0 && !sameOnly.Bool) {
+					continue
+				}
+				return Bool(false)
+			}
+			if unknown {
+				return Null
+			}
+			return Bool(true)
+		},
+	},
+}
+
+// DirectionFeature 高週期函式的參考方向特徵（數值正負或 LONG/SHORT 等字串）
+const DirectionFeature = "direction"
+
+// timeframeFeatures 週期方向特徵，依序取第一個有值者
+var timeframeFeatures = []string{"wave_direction_", "trend_"}
+
+func newCall(call *callNode) (node, error) {
+	fn, ok := functions[call.name]
+	if !ok {
+		names := make([]string, 0, len(functions))
+		for name := range functions {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, &ParseError{Pos: call.pos, Msg: fmt.Sprintf("unknown function %q (available: %s)", call.name, strings.Join(names, ", "))}
+	}
+	if len(call.args) < fn.minArgs || (fn.maxArgs >= 0 && len(call.args) > fn.maxArgs) {
+		return nil, &ParseError{Pos: call.pos, Msg: fmt.Sprintf("%s() takes %s, got %d", call.name, arity(fn), len(call.args))}
+	}
+	for key, arg := range call.named {
+		if _, ok := fn.named[key]; !ok {
+			return nil, &ParseError{Pos: arg.position(), Msg: fmt.Sprintf("%s() has no argument %q", call.name, key)}
+		}
+	}
+	call.fn = fn
+	if fn.check != nil {
+		if err := fn.check(call); err != nil {
+			return nil, err
+		}
+	}
+	return call, nil
+}
+
+func arity(fn *function) string {
+	switch {
+	case fn.maxArgs < 0:
+		return fmt.Sprintf("at least %d argument(s)", fn.minArgs)
+	case fn.minArgs == fn.maxArgs:
+		return fmt.Sprintf("%d argument(s)", fn.minArgs)
+	}
+	return fmt.Sprintf("%d to %d arguments", fn.minArgs, fn.maxArgs)
+}
+
+func fold(args []Value, op func(a, b float64) float64) Value {
+	var acc float64
+	for i, arg := range args {
+		x, ok := arg.numeric()
+		if !ok {
+			return Null
+		}
+		if i == 0 {
+			acc = x
+		} else {
+			acc = op(acc, x)
+		}
+	}
+	return Number(acc)
+}
+
+// checkTimeframes 第一個參數須為字串常數清單，如 ["1d", "4h"]
+func checkTimeframes(call *callNode) error {
+	list, ok := call.args[0].(*listNode)
+	if !ok || len(list.items) == 0 {
+		return &ParseError{Pos: call.args[0].position(), Msg: fmt.Sprintf("%s() expects a non-empty list of timeframes", call.name)}
+	}
+	for _, item := range list.items {
+		lit, ok := item.(*litNode)
+		if !ok || lit.v.Kind != KindString || lit.v.Str == "" {
+			return &ParseError{Pos: item.position(), Msg: fmt.Sprintf("%s() timeframes must be string literals", call.name)}
+		}
+	}
+	return nil
+}
+
+func timeframeDeps(call *callNode) []string {
+	deps := []string{DirectionFeature}
+	for _, item := range call.args[0].(*listNode).items {
+		tf := item.(*litNode).v.Str
+		for _, prefix := range timeframeFeatures {
+			deps = append(deps, prefix+tf)
+		}
+	}
+	return deps
+}
+
+// TimeframeDirection 週期方向：wave_direction_<tf>，缺值時退回 trend_<tf>
+func TimeframeDirection(env Env, tf string) (int, bool) {
+	for _, prefix := range timeframeFeatures {
+		if dir, ok := DirectionOf(env.Lookup(prefix + tf)); ok {
+			return dir, true
+		}
+	}
+	return 0, false
+}
+
+// DirectionOf 方向值：數值取正負號；字串 LONG/UP/BULL/BUY 為 +1，SHORT/DOWN/BEAR/SELL 為 -1，FLAT/NEUTRAL 為 0
+func DirectionOf(v Value) (int, bool) {
+	switch v.Kind {
+	case KindNumber:
+		switch {
+		case v.Num > 0:
+			return 1, true
+		case v.Num < 0:
+			return -1, true
+		}
+		return 0, true
+	case KindString:
+		switch strings.ToUpper(strings.TrimSpace(v.Str)) {
+		case "LONG", "UP", "BULL", "BULLISH", "BUY":
+			return 1, true
+		case "SHORT", "DOWN", "BEAR", "BEARISH", "SELL":
+			return -1, true
+		case "FLAT", "NEUTRAL", "NONE":
+			return 0, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,118 @@
+package dsl
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokString
+	tokIdent
+	tokKeyword
+	tokOp
+)
+
+// keywords 保留字（小寫）
+var keywords = map[string]bool{
+	"and": true, "or": true, "not": true, "in": true, "between": true,
+	"true": true, "false": true, "null": true,
+}
+
+type token struct {
+	kind tokenKind
+	text string // 字串 token 為解除跳脫後的內容
+	pos  int    // 1-based 字元位置
+}
+
+// multi-char 運算子須排在單字元前
+var operators = []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "+", "-", "*", "/", "%", "(", ")", "[", "]", ",", "=", "!"}
+
+func tokenize(source string) ([]token, error) {
+	var tokens []token
+	runes := []rune(source)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		pos := i + 1
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case unicode.IsDigit(r) || (r == '.' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			// 科學記號 1e-3
+			if i < len(runes) && (runes[i] == 'e' || runes[i] == 'E') {
+				j := i + 1
+				if j < len(runes) && (runes[j] == '+' || runes[j] == '-') {
+					j++
+				}
+				if j < len(runes) && unicode.IsDigit(runes[j]) {
+					i = j
+					for i < len(runes) && unicode.IsDigit(runes[i]) {
+						i++
+					}
+				}
+			}
+			text := string(runes[start:i])
+			if _, err := strconv.ParseFloat(text, 64); err != nil {
+				return nil, &ParseError{Pos: pos, Msg: "invalid number " + strconv.Quote(text)}
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: text, pos: pos})
+		case r == '"' || r == '\'':
+			quote := r
+			var sb strings.Builder
+			i++
+			closed := false
+			for i < len(runes) {
+				c := runes[i]
+				if c == '\\' && i+1 < len(runes) {
+					sb.WriteRune(runes[i+1])
+					i += 2
+					continue
+				}
+				i++
+				if c == quote {
+					closed = true
+					break
+				}
+				sb.WriteRune(c)
+			}
+			if !closed {
+				return nil, &ParseError{Pos: pos, Msg: "unterminated string"}
+			}
+			tokens = append(tokens, token{kind: tokString, text: sb.String(), pos: pos})
+		case r == '_' || unicode.IsLetter(r):
+			// 識別字可含 '.'，對應 S2 的「類型.欄位」扁平特徵名
+			start := i
+			for i < len(runes) && (runes[i] == '_' || runes[i] == '.' || unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i])) {
+				i++
+			}
+			text := string(runes[start:i])
+			kind := tokIdent
+			if keywords[text] {
+				kind = tokKeyword
+			}
+			tokens = append(tokens, token{kind: kind, text: text, pos: pos})
+		default:
+			matched := false
+			for _, op := range operators {
+				if strings.HasPrefix(string(runes[i:min(i+len(op), len(runes))]), op) {
+					tokens = append(tokens, token{kind: tokOp, text: op, pos: pos})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, &ParseError{Pos: pos, Msg: "unexpected character " + strconv.QuoteRune(r)}
+			}
+		}
+	}
+	return append(tokens, token{kind: tokEOF, pos: len(runes) + 1}), nil
+}
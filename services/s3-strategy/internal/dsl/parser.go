@@ -0,0 +1,407 @@
+package dsl
+
+// 規則條件語言（S3 L1 規則引擎）
+//
+//   expr    := or
+//   or      := and (('or' | '||') and)*
+//   and     := not (('and' | '&&') not)*
+//   not     := ('not' | '!') not | cmp
+//   cmp     := sum [ ('==' | '!=' | '<' | '<=' | '>' | '>=') sum
+//                  | ['not'] 'in' list
+//                  | 'between' sum 'and' sum ]
+//   sum     := term (('+' | '-') term)*
+//   term    := unary (('*' | '/' | '%') unary)*
+//   unary   := '-' unary | primary
+//   primary := number | string | 'true' | 'false' | 'null' | list
+//            | ident | ident '(' [arg (',' arg)*] ')' | '(' expr ')'
+//   list    := '[' [expr (',' expr)*] ']'
+//   arg     := expr | ident '=' expr
+//
+// 識別字為特徵名（可含 '.'）；缺值特徵為 null，並依三值邏輯（Kleene）傳遞，規則只在結果為 TRUE 時命中。
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 語言限制
+const (
+	MaxSourceLength = 4096
+	MaxNodes        = 512
+	MaxDepth        = 32
+)
+
+// ParseError 編譯錯誤；Path 為結構化條件中的位置（如 allOf[2]），Pos 為表達式內 1-based 字元位置
+type ParseError struct {
+	Path string
+	Pos  int
+	Msg  string
+}
+
+func (e *ParseError) Error() string {
+	var sb strings.Builder
+	if e.Path != "" {
+		sb.WriteString(e.Path)
+		sb.WriteString(": ")
+	}
+	if e.Pos > 0 {
+		fmt.Fprintf(&sb, "position %d: ", e.Pos)
+	}
+	sb.WriteString(e.Msg)
+	return sb.String()
+}
+
+// parseText 解析文字表達式
+func parseText(source string) (node, error) {
+	if strings.TrimSpace(source) == "" {
+		return nil, &ParseError{Msg: "empty expression"}
+	}
+	if len(source) > MaxSourceLength {
+		return nil, &ParseError{Msg: fmt.Sprintf("expression too long: %d > %d", len(source), MaxSourceLength)}
+	}
+
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr(0)
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, p.unexpected(tok)
+	}
+	return root, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token { return p.tokens[p.pos] }
+
+func (p *parser) peekAt(offset int) token {
+	if p.pos+offset >= len(p.tokens) {
+		return p.tokens[len(p.tokens)-1]
+	}
+	return p.tokens[p.pos+offset]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) is(kind tokenKind, text string) bool {
+	tok := p.peek()
+	return tok.kind == kind && tok.text == text
+}
+
+func (p *parser) isOp(text string) bool { return p.is(tokOp, text) }
+
+func (p *parser) isKeyword(text string) bool { return p.is(tokKeyword, text) }
+
+func (p *parser) unexpected(tok token) error {
+	if tok.kind == tokEOF {
+		return &ParseError{Pos: tok.pos, Msg: "unexpected end of expression"}
+	}
+	if tok.kind == tokString {
+		return &ParseError{Pos: tok.pos, Msg: "unexpected string " + strconv.Quote(tok.text)}
+	}
+	return &ParseError{Pos: tok.pos, Msg: "unexpected " + strconv.Quote(tok.text)}
+}
+
+func (p *parser) expectOp(text string) error {
+	if !p.isOp(text) {
+		tok := p.peek()
+		if tok.kind == tokEOF {
+			return &ParseError{Pos: tok.pos, Msg: fmt.Sprintf("expected %q at end of expression", text)}
+		}
+		return &ParseError{Pos: tok.pos, Msg: fmt.Sprintf("expected %q, got %q", text, tok.text)}
+	}
+	p.next()
+	return nil
+}
+
+func (p *parser) checkDepth(depth int) error {
+	if depth > MaxDepth {
+		return &ParseError{Pos: p.peek().pos, Msg: fmt.Sprintf("expression nested deeper than %d", MaxDepth)}
+	}
+	return nil
+}
+
+func (p *parser) parseOr(depth int) (node, error) {
+	if err := p.checkDepth(depth); err != nil {
+		return nil, err
+	}
+	first, err := p.parseAnd(depth)
+	if err != nil {
+		return nil, err
+	}
+	items := []node{first}
+	for p.isKeyword("or") || p.isOp("||") {
+		p.next()
+		item, err := p.parseAnd(depth)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	if len(items) == 1 {
+		return first, nil
+	}
+	return &logicNode{pos: first.position(), any: true, items: items}, nil
+}
+
+func (p *parser) parseAnd(depth int) (node, error) {
+	first, err := p.parseNot(depth)
+	if err != nil {
+		return nil, err
+	}
+	items := []node{first}
+	for p.isKeyword("and") || p.isOp("&&") {
+		p.next()
+		item, err := p.parseNot(depth)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	if len(items) == 1 {
+		return first, nil
+	}
+	return &logicNode{pos: first.position(), items: items}, nil
+}
+
+func (p *parser) parseNot(depth int) (node, error) {
+	if p.isKeyword("not") || p.isOp("!") {
+		tok := p.next()
+		if err := p.checkDepth(depth + 1); err != nil {
+			return nil, err
+		}
+		operand, err := p.parseNot(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{pos: tok.pos, x: operand}, nil
+	}
+	return p.parseCmp(depth)
+}
+
+func (p *parser) parseCmp(depth int) (node, error) {
+	left, err := p.parseSum(depth)
+	if err != nil {
+		return nil, err
+	}
+
+	tok := p.peek()
+	switch {
+	case tok.kind == tokOp && (tok.text == "==" || tok.text == "!=" || tok.text == "<" || tok.text == "<=" || tok.text == ">" || tok.text == ">="):
+		p.next()
+		right, err := p.parseSum(depth)
+		if err != nil {
+			return nil, err
+		}
+		return newCmp(tok.pos, tok.text, left, right)
+	case tok.kind == tokKeyword && tok.text == "in",
+		tok.kind == tokKeyword && tok.text == "not" && p.peekAt(1).kind == tokKeyword && p.peekAt(1).text == "in":
+		negate := tok.text == "not"
+		if negate {
+			p.next()
+		}
+		p.next()
+		list, err := p.parseSum(depth)
+		if err != nil {
+			return nil, err
+		}
+		return newIn(tok.pos, left, list, negate)
+	case tok.kind == tokKeyword && tok.text == "between":
+		p.next()
+		lo, err := p.parseSum(depth)
+		if err != nil {
+			return nil, err
+		}
+		if !p.isKeyword("and") {
+			return nil, &ParseError{Pos: p.peek().pos, Msg: "expected \"and\" in between"}
+		}
+		p.next()
+		hi, err := p.parseSum(depth)
+		if err != nil {
+			return nil, err
+		}
+		return newBetween(tok.pos, left, lo, hi)
+	}
+	return left, nil
+}
+
+func (p *parser) parseSum(depth int) (node, error) {
+	left, err := p.parseTerm(depth)
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("+") || p.isOp("-") {
+		tok := p.next()
+		right, err := p.parseTerm(depth)
+		if err != nil {
+			return nil, err
+		}
+		if left, err = newArith(tok.pos, tok.text[0], left, right); err != nil {
+			return nil, err
+		}
+	}
+	return left, nil
+}
+
+func (p *parser) parseTerm(depth int) (node, error) {
+	left, err := p.parseUnary(depth)
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("*") || p.isOp("/") || p.isOp("%") {
+		tok := p.next()
+		right, err := p.parseUnary(depth)
+		if err != nil {
+			return nil, err
+		}
+		if left, err = newArith(tok.pos, tok.text[0], left, right); err != nil {
+			return nil, err
+		}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary(depth int) (node, error) {
+	if p.isOp("-") {
+		tok := p.next()
+		if err := p.checkDepth(depth + 1); err != nil {
+			return nil, err
+		}
+		operand, err := p.parseUnary(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		// 常數直接折疊
+		if lit, ok := operand.(*litNode); ok && lit.v.Kind == KindNumber {
+			return &litNode{pos: tok.pos, v: Number(-lit.v.Num)}, nil
+		}
+		return newArith(tok.pos, '-', &litNode{pos: tok.pos, v: Number(0)}, operand)
+	}
+	return p.parsePrimary(depth)
+}
+
+func (p *parser) parsePrimary(depth int) (node, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokNumber:
+		v, _ := strconv.ParseFloat(tok.text, 64)
+		return &litNode{pos: tok.pos, v: Number(v)}, nil
+	case tokString:
+		return &litNode{pos: tok.pos, v: String(tok.text)}, nil
+	case tokKeyword:
+		switch tok.text {
+		case "true":
+			return &litNode{pos: tok.pos, v: Bool(true)}, nil
+		case "false":
+			return &litNode{pos: tok.pos, v: Bool(false)}, nil
+		case "null":
+			return &litNode{pos: tok.pos, v: Null}, nil
+		}
+	case tokIdent:
+		if p.isOp("(") {
+			return p.parseCall(tok, depth)
+		}
+		return &identNode{pos: tok.pos, name: tok.text}, nil
+	case tokOp:
+		switch tok.text {
+		case "(":
+			if err := p.checkDepth(depth + 1); err != nil {
+				return nil, err
+			}
+			inner, err := p.parseOr(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectOp(")"); err != nil {
+				return nil, err
+			}
+			return inner, nil
+		case "[":
+			return p.parseList(tok, depth)
+		}
+	}
+	return nil, p.unexpected(tok)
+}
+
+func (p *parser) parseList(open token, depth int) (node, error) {
+	list := &listNode{pos: open.pos}
+	if p.isOp("]") {
+		p.next()
+		return list, nil
+	}
+	for {
+		item, err := p.parseOr(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		list.items = append(list.items, item)
+		if p.isOp(",") {
+			p.next()
+			continue
+		}
+		if err := p.expectOp("]"); err != nil {
+			return nil, err
+		}
+		return list, nil
+	}
+}
+
+func (p *parser) parseCall(name token, depth int) (node, error) {
+	p.next() // "("
+	call := &callNode{pos: name.pos, name: name.text}
+	if p.isOp(")") {
+		p.next()
+		return newCall(call)
+	}
+	for {
+		// 具名參數 ident '=' expr
+		if p.peek().kind == tokIdent && p.peekAt(1).kind == tokOp && p.peekAt(1).text == "=" {
+			key := p.next()
+			p.next()
+			value, err := p.parseOr(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			if call.named == nil {
+				call.named = make(map[string]node)
+			}
+			if _, dup := call.named[key.text]; dup {
+				return nil, &ParseError{Pos: key.pos, Msg: fmt.Sprintf("duplicate argument %q", key.text)}
+			}
+			call.named[key.text] = value
+		} else {
+			if call.named != nil {
+				return nil, &ParseError{Pos: p.peek().pos, Msg: "positional argument after named argument"}
+			}
+			arg, err := p.parseOr(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			call.args = append(call.args, arg)
+		}
+		if p.isOp(",") {
+			p.next()
+			continue
+		}
+		if err := p.expectOp(")"); err != nil {
+			return nil, err
+		}
+		return newCall(call)
+	}
+}
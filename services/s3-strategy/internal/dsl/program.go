@@ -0,0 +1,272 @@
+package dsl
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Program 編譯後的規則條件；不可變，可併發求值
+type Program struct {
+	root     node
+	features []string
+}
+
+// Eval 求值，結果為 TRUE / FALSE / Null（UNKNOWN）
+func (p *Program) Eval(env Env) Value {
+	return p.root.eval(env).truth()
+}
+
+// Value 求值並回傳原始結果（不轉為布林；供數值表達式使用）
+func (p *Program) Value(env Env) Value {
+	return p.root.eval(env)
+}
+
+// Match 是否命中（僅 TRUE 命中；UNKNOWN 不命中）
+func (p *Program) Match(env Env) bool {
+	return p.Eval(env).IsTrue()
+}
+
+// Features 條件引用的特徵名（排序、去重）
+func (p *Program) Features() []string {
+	return append([]string(nil), p.features...)
+}
+
+// String 正規化的表達式文字
+func (p *Program) String() string {
+	var sb strings.Builder
+	p.root.format(&sb)
+	return sb.String()
+}
+
+// 結構化運算子（{"f","op","v"} 形式）
+var structuredOps = map[string]string{
+	"<": "<", "<=": "<=", ">": ">", ">=": ">=", "==": "==", "!=": "!=",
+	"in": "in", "not_in": "not in", "nin": "not in", "between": "between",
+}
+
+// Compile 編譯規則條件字串：JSON（物件/陣列/字串）或文字表達式
+func Compile(conditions string) (*Program, error) {
+	text := strings.TrimSpace(conditions)
+	if text == "" {
+		return nil, &ParseError{Msg: "empty condition"}
+	}
+	if text[0] == '{' || text[0] == '[' || text[0] == '"' {
+		var decoded interface{}
+		if err := json.Unmarshal([]byte(text), &decoded); err == nil {
+			return CompileValue(decoded)
+		} else if text[0] != '"' {
+			return nil, &ParseError{Msg: "invalid JSON condition: " + err.Error()}
+		}
+	}
+	return CompileValue(text)
+}
+
+// CompileValue 編譯已解碼的條件（JSON 或 YAML 解碼結果）
+//
+//	{"allOf"|"all": [...]}、{"anyOf"|"any": [...]}、{"not": cond}
+//	{"f": 特徵, "op": 運算子, "v": 常數 | {"f": 特徵}}
+//	[...]（隱含 all）、"文字表達式"
+func CompileValue(v interface{}) (*Program, error) {
+	root, err := compileValue(v, "")
+	if err != nil {
+		return nil, err
+	}
+
+	count := 0
+	seen := make(map[string]bool)
+	var features []string
+	walk(root, func(n node) {
+		count++
+		var names []string
+		switch t := n.(type) {
+		case *identNode:
+			names = []string{t.name}
+		case *callNode:
+			if t.fn.deps != nil {
+				names = t.fn.deps(t)
+			}
+		}
+		for _, name := range names {
+			if !seen[name] {
+				seen[name] = true
+				features = append(features, name)
+			}
+		}
+	})
+	if count > MaxNodes {
+		return nil, &ParseError{Msg: fmt.Sprintf("condition too large: %d nodes > %d", count, MaxNodes)}
+	}
+	sort.Strings(features)
+
+	return &Program{root: root, features: features}, nil
+}
+
+func compileValue(v interface{}, path string) (node, error) {
+	switch t := v.(type) {
+	case string:
+		root, err := parseText(t)
+		return root, withPath(err, path)
+	case []interface{}:
+		return compileList(t, path, false)
+	case map[string]interface{}:
+		return compileMap(t, path)
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for key, value := range t {
+			s, ok := key.(string)
+			if !ok {
+				return nil, &ParseError{Path: path, Msg: fmt.Sprintf("non-string key %v", key)}
+			}
+			m[s] = value
+		}
+		return compileMap(m, path)
+	case nil:
+		return nil, &ParseError{Path: path, Msg: "empty condition"}
+	}
+	return nil, &ParseError{Path: path, Msg: fmt.Sprintf("unsupported condition type %T", v)}
+}
+
+func compileList(items []interface{}, path string, any bool) (node, error) {
+	if len(items) == 0 {
+		return nil, &ParseError{Path: path, Msg: "empty condition list"}
+	}
+	logic := &logicNode{pos: 1, any: any}
+	for i, item := range items {
+		child, err := compileValue(item, fmt.Sprintf("%s[%d]", path, i))
+		if err != nil {
+			return nil, err
+		}
+		logic.items = append(logic.items, child)
+	}
+	if len(logic.items) == 1 {
+		return logic.items[0], nil
+	}
+	return logic, nil
+}
+
+func compileMap(m map[string]interface{}, path string) (node, error) {
+	if _, ok := m["f"]; ok {
+		return compileLeaf(m, path)
+	}
+	if len(m) != 1 {
+		keys := make([]string, 0, len(m))
+		for key := range m {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		return nil, &ParseError{Path: path, Msg: fmt.Sprintf("expected exactly one of all/allOf/any/anyOf/not/when, got keys %v", keys)}
+	}
+
+	for key, value := range m {
+		sub := joinPath(path, key)
+		switch key {
+		case "all", "allOf", "any", "anyOf":
+			items, ok := value.([]interface{})
+			if !ok {
+				return nil, &ParseError{Path: sub, Msg: "expected a list of conditions"}
+			}
+			return compileList(items, sub, key == "any" || key == "anyOf")
+		case "not":
+			inner, err := compileValue(value, sub)
+			if err != nil {
+				return nil, err
+			}
+			return &notNode{pos: inner.position(), x: inner}, nil
+		case "when":
+			return compileValue(value, sub)
+		default:
+			return nil, &ParseError{Path: path, Msg: fmt.Sprintf("unknown key %q", key)}
+		}
+	}
+	return nil, &ParseError{Path: path, Msg: "empty condition"}
+}
+
+// compileLeaf {"f": 特徵, "op": 運算子, "v": 值}
+func compileLeaf(m map[string]interface{}, path string) (node, error) {
+	for key := range m {
+		if key != "f" && key != "op" && key != "v" {
+			return nil, &ParseError{Path: path, Msg: fmt.Sprintf("unknown key %q in condition", key)}
+		}
+	}
+	name, ok := m["f"].(string)
+	if !ok || name == "" {
+		return nil, &ParseError{Path: joinPath(path, "f"), Msg: "feature name must be a non-empty string"}
+	}
+	rawOp, _ := m["op"].(string)
+	op, ok := structuredOps[rawOp]
+	if !ok {
+		return nil, &ParseError{Path: joinPath(path, "op"), Msg: fmt.Sprintf("unsupported operator %q", rawOp)}
+	}
+	operand, err := compileOperand(m["v"], joinPath(path, "v"))
+	if err != nil {
+		return nil, err
+	}
+
+	feature := &identNode{pos: 1, name: name}
+	switch op {
+	case "in", "not in":
+		if _, ok := operand.(*listNode); !ok {
+			return nil, &ParseError{Path: joinPath(path, "v"), Msg: fmt.Sprintf("%q requires a list value", rawOp)}
+		}
+		return &inNode{pos: 1, x: feature, list: operand, negate: op == "not in"}, nil
+	case "between":
+		list, ok := operand.(*listNode)
+		if !ok || len(list.items) != 2 {
+			return nil, &ParseError{Path: joinPath(path, "v"), Msg: "between requires [low, high]"}
+		}
+		created, err := newBetween(1, feature, list.items[0], list.items[1])
+		return created, withPath(err, joinPath(path, "v"))
+	}
+	created, err := newCmp(1, op, feature, operand)
+	return created, withPath(err, joinPath(path, "v"))
+}
+
+// compileOperand 常數、常數清單或 {"f": 特徵} 參照
+func compileOperand(v interface{}, path string) (node, error) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		if name, ok := t["f"].(string); ok && len(t) == 1 && name != "" {
+			return &identNode{pos: 1, name: name}, nil
+		}
+	case map[interface{}]interface{}:
+		if name, ok := t["f"].(string); ok && len(t) == 1 && name != "" {
+			return &identNode{pos: 1, name: name}, nil
+		}
+	case []interface{}:
+		list := &listNode{pos: 1}
+		for i, item := range t {
+			child, err := compileOperand(item, fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			list.items = append(list.items, child)
+		}
+		return list, nil
+	default:
+		value := FromAny(v)
+		if value.IsNull() && v != nil {
+			return nil, &ParseError{Path: path, Msg: fmt.Sprintf("unsupported value type %T", v)}
+		}
+		return &litNode{pos: 1, v: value}, nil
+	}
+	return nil, &ParseError{Path: path, Msg: "value must be a literal, a list or {\"f\": feature}"}
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func withPath(err error, path string) error {
+	if err == nil {
+		return nil
+	}
+	if pe, ok := err.(*ParseError); ok && pe.Path == "" {
+		return &ParseError{Path: path, Pos: pe.Pos, Msg: pe.Msg}
+	}
+	return err
+}
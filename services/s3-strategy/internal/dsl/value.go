@@ -0,0 +1,198 @@
+package dsl
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Kind 值型別
+type Kind int
+
+const (
+	KindNull Kind = iota
+	KindNumber
+	KindString
+	KindBool
+	KindList
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindNumber:
+		return "number"
+	case KindString:
+		return "string"
+	case KindBool:
+		return "bool"
+	case KindList:
+		return "list"
+	}
+	return "null"
+}
+
+// Value 求值結果；Null 代表缺值或未知（三值邏輯中的 UNKNOWN）
+type Value struct {
+	Kind Kind
+	Num  float64
+	Str  string
+	Bool bool
+	List []Value
+}
+
+var Null = Value{}
+
+func Number(v float64) Value {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return Null
+	}
+	return Value{Kind: KindNumber, Num: v}
+}
+
+func String(v string) Value { return Value{Kind: KindString, Str: v} }
+
+func Bool(v bool) Value { return Value{Kind: KindBool, Bool: v} }
+
+// IsNull 是否為缺值/未知
+func (v Value) IsNull() bool { return v.Kind == KindNull }
+
+// IsTrue 是否為確定的 TRUE（規則只在 TRUE 時命中）
+func (v Value) IsTrue() bool { return v.Kind == KindBool && v.Bool }
+
+func (v Value) String() string {
+	switch v.Kind {
+	case KindNumber:
+		return strconv.FormatFloat(v.Num, 'g', -1, 64)
+	case KindString:
+		return strconv.Quote(v.Str)
+	case KindBool:
+		return strconv.FormatBool(v.Bool)
+	case KindList:
+		items := make([]string, len(v.List))
+		for i, item := range v.List {
+			items[i] = item.String()
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	}
+	return "null"
+}
+
+// Interface 轉回 Go 值（explain / JSON 輸出用）
+func (v Value) Interface() interface{} {
+	switch v.Kind {
+	case KindNumber:
+		return v.Num
+	case KindString:
+		return v.Str
+	case KindBool:
+		return v.Bool
+	case KindList:
+		items := make([]interface{}, len(v.List))
+		for i, item := range v.List {
+			items[i] = item.Interface()
+		}
+		return items
+	}
+	return nil
+}
+
+// FromAny 將特徵值轉為 Value；NaN/Inf 與不支援的型別視為 Null
+func FromAny(x interface{}) Value {
+	switch t := x.(type) {
+	case nil:
+		return Null
+	case Value:
+		return t
+	case float64:
+		return Number(t)
+	case float32:
+		return Number(float64(t))
+	case int:
+		return Number(float64(t))
+	case int32:
+		return Number(float64(t))
+	case int64:
+		return Number(float64(t))
+	case uint64:
+		return Number(float64(t))
+	case json.Number:
+		f, err := t.Float64()
+		if err != nil {
+			return Null
+		}
+		return Number(f)
+	case string:
+		return String(t)
+	case bool:
+		return Bool(t)
+	case []interface{}:
+		items := make([]Value, len(t))
+		for i, item := range t {
+			items[i] = FromAny(item)
+		}
+		return Value{Kind: KindList, List: items}
+	case []string:
+		items := make([]Value, len(t))
+		for i, item := range t {
+			items[i] = String(item)
+		}
+		return Value{Kind: KindList, List: items}
+	case []float64:
+		items := make([]Value, len(t))
+		for i, item := range t {
+			items[i] = Number(item)
+		}
+		return Value{Kind: KindList, List: items}
+	}
+	return Null
+}
+
+// numeric 數值情境下的轉換：布林視為 1/0（S2 旗標以 1.0/0.0 輸出）
+func (v Value) numeric() (float64, bool) {
+	switch v.Kind {
+	case KindNumber:
+		return v.Num, true
+	case KindBool:
+		if v.Bool {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// truth 布林情境下的轉換：數值非零為 TRUE；字串/清單為 Null
+func (v Value) truth() Value {
+	switch v.Kind {
+	case KindBool:
+		return v
+	case KindNumber:
+		return Bool(v.Num != 0)
+	}
+	return Null
+}
+
+// equal 相等比較：任一側為 Null 時回傳 Null；型別不同時布林可與數值比較，其餘為 FALSE
+func equal(a, b Value) Value {
+	if a.IsNull() || b.IsNull() {
+		return Null
+	}
+	if a.Kind == KindString || b.Kind == KindString {
+		return Bool(a.Kind == b.Kind && a.Str == b.Str)
+	}
+	if a.Kind == KindList || b.Kind == KindList {
+		if a.Kind != b.Kind || len(a.List) != len(b.List) {
+			return Bool(false)
+		}
+		for i := range a.List {
+			if eq := equal(a.List[i], b.List[i]); !eq.IsTrue() {
+				return eq
+			}
+		}
+		return Bool(true)
+	}
+	x, _ := a.numeric()
+	y, _ := b.numeric()
+	return Bool(x == y)
+}
@@ -0,0 +1,188 @@
+package gbdt
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Calibration 機率校準：platt 作用於原始分數 p = sigmoid(a·margin + b)；isotonic 對模型輸出做分段線性插值
+type Calibration struct {
+	Method string    `json:"method"` // platt|isotonic
+	A      float64   `json:"a,omitempty"`
+	B      float64   `json:"b,omitempty"`
+	X      []float64 `json:"x,omitempty"`
+	Y      []float64 `json:"y,omitempty"`
+}
+
+func (c *Calibration) validate() error {
+	switch c.Method {
+	case "platt":
+		if c.A == 0 {
+			return fmt.Errorf("platt calibration requires a non-zero slope")
+		}
+	case "isotonic":
+		if len(c.X) < 2 || len(c.X) != len(c.Y) {
+			return fmt.Errorf("isotonic calibration requires matching x/y with at least 2 points")
+		}
+		for i := 1; i < len(c.X); i++ {
+			if c.X[i] <= c.X[i-1] || c.Y[i] < c.Y[i-1] {
+				return fmt.Errorf("isotonic calibration points must be increasing")
+			}
+		}
+		for _, y := range c.Y {
+			if y < 0 || y > 1 {
+				return fmt.Errorf("isotonic calibration outputs must be within [0, 1]")
+			}
+		}
+	default:
+		return fmt.Errorf("unknown calibration method %q", c.Method)
+	}
+	return nil
+}
+
+func (c *Calibration) apply(margin, output float64) float64 {
+	if c.Method == "platt" {
+		return sigmoid(c.A*margin + c.B)
+	}
+	n := len(c.X)
+	if output <= c.X[0] {
+		return c.Y[0]
+	}
+	if output >= c.X[n-1] {
+		return c.Y[n-1]
+	}
+	i := sort.SearchFloat64s(c.X, output)
+	x0, x1 := c.X[i-1], c.X[i]
+	y0, y1 := c.Y[i-1], c.Y[i]
+	return y0 + (y1-y0)*(output-x0)/(x1-x0)
+}
+
+// Artifact 模型版本描述（磁碟 manifest.json 或 Arango ml_models 文件）
+type Artifact struct {
+	Name        string       `json:"name"`
+	Version     string       `json:"version"`
+	Format      Format       `json:"format"`
+	File        string       `json:"file,omitempty"`    // 模型檔（相對於 manifest 目錄）
+	Content     string       `json:"content,omitempty"` // 內嵌模型內容（Arango）
+	SHA256      string       `json:"sha256,omitempty"`  // 模型內容雜湊；設定時載入會驗證
+	Features    []string     `json:"features,omitempty"`
+	Calibration *Calibration `json:"calibration,omitempty"`
+}
+
+// Predictor 已載入的模型版本，輸出校準後機率
+type Predictor struct {
+	Artifact Artifact
+	Model    *Model
+}
+
+// Load 解析模型內容並驗證雜湊、特徵與校準；模型輸出非機率（迴歸/raw）時必須提供校準
+func Load(a Artifact, content []byte) (*Predictor, error) {
+	if a.SHA256 != "" {
+		sum := sha256.Sum256(content)
+		if got := hex.EncodeToString(sum[:]); got != a.SHA256 {
+			return nil, fmt.Errorf("model %s@%s: sha256 mismatch: %s", a.Name, a.Version, got)
+		}
+	}
+
+	var m *Model
+	var err error
+	switch a.Format {
+	case FormatXGBoostJSON:
+		m, err = ParseXGBoostJSON(content)
+	case FormatLightGBMText:
+		m, err = ParseLightGBMText(content)
+	default:
+		err = fmt.Errorf("unknown format %q", a.Format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("model %s@%s: %w", a.Name, a.Version, err)
+	}
+
+	if len(a.Features) > 0 {
+		if len(a.Features) != len(m.Features) {
+			return nil, fmt.Errorf("model %s@%s: %d features configured, model expects %d", a.Name, a.Version, len(a.Features), len(m.Features))
+		}
+		m.Features = append([]string(nil), a.Features...)
+	}
+	if a.Calibration != nil {
+		if err := a.Calibration.validate(); err != nil {
+			return nil, fmt.Errorf("model %s@%s: %w", a.Name, a.Version, err)
+		}
+	} else if m.transform == nil {
+		return nil, fmt.Errorf("model %s@%s: objective %q does not output a probability; calibration required", a.Name, a.Version, m.Objective)
+	}
+	return &Predictor{Artifact: a, Model: m}, nil
+}
+
+// Probability 校準後機率與原始分數
+func (p *Predictor) Probability(features map[string]interface{}) (float64, float64) {
+	x := p.Model.Vector(features)
+	margin := p.Model.Margin(x)
+	output := margin
+	if p.Model.transform != nil {
+		output = p.Model.transform(margin)
+	}
+	if p.Artifact.Calibration != nil {
+		output = p.Artifact.Calibration.apply(margin, output)
+	}
+	return math.Max(0, math.Min(1, output)), margin
+}
+
+// Coverage 特徵覆蓋率（非缺值比例），供監控缺特徵
+func (p *Predictor) Coverage(features map[string]interface{}) float64 {
+	if len(p.Model.Features) == 0 {
+		return 1
+	}
+	present := 0
+	for _, v := range p.Model.Vector(features) {
+		if !math.IsNaN(v) {
+			present++
+		}
+	}
+	return float64(present) / float64(len(p.Model.Features))
+}
+
+// LoadManifest 讀取 manifest.json 與其指向的模型檔
+func LoadManifest(path string) (*Predictor, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var a Artifact
+	if err := json.Unmarshal(raw, &a); err != nil {
+		return nil, fmt.Errorf("invalid manifest %s: %w", path, err)
+	}
+	content := []byte(a.Content)
+	if a.File != "" {
+		content, err = os.ReadFile(filepath.Join(filepath.Dir(path), a.File))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return Load(a, content)
+}
+
+// LoadFromDir 由 <dir>/<name>/<version>/manifest.json 載入；version 為空時取字典序最大的版本
+func LoadFromDir(dir, name, version string) (*Predictor, error) {
+	if version == "" {
+		entries, err := os.ReadDir(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if e.IsDir() && e.Name() > version {
+				version = e.Name()
+			}
+		}
+		if version == "" {
+			return nil, fmt.Errorf("no versions found for model %s in %s", name, dir)
+		}
+	}
+	return LoadManifest(filepath.Join(dir, name, version, "manifest.json"))
+}
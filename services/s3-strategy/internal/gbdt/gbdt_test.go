@@ -0,0 +1,297 @@
+package gbdt
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type goldenCase struct {
+	Features map[string]interface{} `json:"features"`
+	XGBoost  float64                `json:"xgboost"`
+	LightGBM float64                `json:"lightgbm"`
+}
+
+// goldenFile testdata/gen_golden.py 的輸出：以真實 xgboost/lightgbm 訓練的模型與其 Booster.predict 分數
+type goldenFile struct {
+	Generator map[string]string `json:"generator"`
+	Models    struct {
+		XGBoost  string `json:"xgboost"`
+		LightGBM string `json:"lightgbm"`
+	} `json:"models"`
+	Cases []goldenCase `json:"cases"`
+}
+
+func loadGolden(t *testing.T) goldenFile {
+	t.Helper()
+	raw, err := os.ReadFile("testdata/golden.json")
+	if os.IsNotExist(err) {
+		t.Skip("testdata/golden.json not generated; run gen_golden.py in testdata with numpy, xgboost and lightgbm installed")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	var golden goldenFile
+	if err := json.Unmarshal(raw, &golden); err != nil {
+		t.Fatal(err)
+	}
+	// 參考分數必須來自框架本身，不接受其他來源
+	if golden.Generator["xgboost"] == "" || golden.Generator["lightgbm"] == "" || golden.Models.XGBoost == "" || golden.Models.LightGBM == "" {
+		t.Fatalf("golden.json missing generator versions or model files: %+v %+v", golden.Generator, golden.Models)
+	}
+	if len(golden.Cases) == 0 {
+		t.Fatal("golden.json has no cases")
+	}
+	return golden
+}
+
+func loadModel(t *testing.T, format Format, file string) *Predictor {
+	t.Helper()
+	content, err := os.ReadFile(filepath.Join("testdata", file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := Load(Artifact{Name: "test", Version: "v1", Format: format}, content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// TestGolden 與 testdata/gen_golden.py 以 xgboost/lightgbm 訓練並匯出的模型、Booster.predict 分數比對（XGBoost 以 float32 計算）
+func TestGolden(t *testing.T) {
+	golden := loadGolden(t)
+	xgb := loadModel(t, FormatXGBoostJSON, golden.Models.XGBoost)
+	lgb := loadModel(t, FormatLightGBMText, golden.Models.LightGBM)
+
+	for i, tc := range golden.Cases {
+		if p, _ := xgb.Probability(tc.Features); math.Abs(p-tc.XGBoost) > 1e-6 {
+			t.Errorf("case %d xgboost: got %.9f, want %.9f", i, p, tc.XGBoost)
+		}
+		if p, _ := lgb.Probability(tc.Features); math.Abs(p-tc.LightGBM) > 1e-9 {
+			t.Errorf("case %d lightgbm: got %.12f, want %.12f", i, p, tc.LightGBM)
+		}
+	}
+}
+
+// TestHandTraced 手寫模型逐棵樹手算的走訪路徑：期望值只寫葉值，不經任何走訪器計算
+func TestHandTraced(t *testing.T) {
+	xgb := loadModel(t, FormatXGBoostJSON, "xgb_handwritten.json")
+	lgb := loadModel(t, FormatLightGBMText, "lgb_handwritten.txt")
+	xgbBase := math.Log(0.42 / 0.58) // base_score 0.42
+
+	for _, tc := range []struct {
+		name     string
+		features map[string]interface{}
+		xgb      []float64 // 三棵樹各自落入的葉值
+		lgb      []float64
+	}{
+		{
+			// xgb: 0.1<0.25→-0.5<-0.3 | 0.8<1.0 | 0.1<0.1 不成立；lgb: 0.1≤0.25→-0.5≤-0.3 | 0.8>0.6→0.1>0 | 常數
+			"all present", map[string]interface{}{"rv_pctile_30d": 0.1, "rho_usdttwd_14": -0.5, "atr_pct": 0.8},
+			[]float64{0.31034483, 0.0923, -0.0213}, []float64{0.41234, -0.0876, -0.0142},
+		},
+		{
+			// xgb: -0.2≥-0.3 | 0.5<1.0 | 0.05<0.1→0.5<0.6；lgb: -0.2>-0.3 | 0.5≤0.6
+			"right of rho split", map[string]interface{}{"rv_pctile_30d": 0.05, "rho_usdttwd_14": -0.2, "atr_pct": 0.5},
+			[]float64{-0.12, 0.0923, 0.0712}, []float64{-0.1123, 0.0931, -0.0142},
+		},
+		{
+			// xgb: 缺值依 default_left 左→右 | 右 | 右；lgb: NaN 型左→NaN 型右 | None 型視為 0≤0.6
+			"all missing", map[string]interface{}{},
+			[]float64{-0.12, -0.1477, -0.0213}, []float64{-0.1123, 0.0931, -0.0142},
+		},
+		{
+			// xgb: 0.9≥0.25 | 2.5≥1.0 | 0.9≥0.1；lgb: 0.9>0.25→2.5>1.0 | 2.5>0.6→0.9>0
+			"high vol", map[string]interface{}{"rv_pctile_30d": 0.9, "atr_pct": 2.5},
+			[]float64{0.18571429, -0.1477, -0.0213}, []float64{-0.3321, -0.0876, -0.0142},
+		},
+		{
+			// xgb: atr 缺值 tree1 走右、tree2 第二層 default_left 走左；lgb: atr None 型視為 0
+			"atr missing", map[string]interface{}{"rv_pctile_30d": 0.05, "rho_usdttwd_14": -0.5},
+			[]float64{0.31034483, -0.1477, 0.0712}, []float64{0.41234, 0.0931, -0.0142},
+		},
+		{
+			// xgb: 0 為一般數值 0<0.1→0.7≥0.6；lgb: rv=0 在 zero-missing 節點走 default_left
+			"zero as missing", map[string]interface{}{"rv_pctile_30d": 0.0, "rho_usdttwd_14": 0.1, "atr_pct": 0.7},
+			[]float64{-0.12, 0.0923, -0.0588}, []float64{-0.1123, 0.0155, -0.0142},
+		},
+		{
+			// lgb: 0.5>0.25 後 atr 缺值在 missing_type None 節點視為 0≤1.0 走左
+			"lgb none-missing left", map[string]interface{}{"rv_pctile_30d": 0.5, "rho_usdttwd_14": 0.1},
+			[]float64{0.18571429, -0.1477, -0.0213}, []float64{0.0518, 0.0931, -0.0142},
+		},
+	} {
+		want := xgbBase
+		for _, v := range tc.xgb {
+			want += v
+		}
+		if got := xgb.Model.Margin(xgb.Model.Vector(tc.features)); math.Abs(got-want) > 1e-6 {
+			t.Errorf("%s xgboost: margin %.9f, want %.9f", tc.name, got, want)
+		}
+		want = 0
+		for _, v := range tc.lgb {
+			want += v
+		}
+		if got := lgb.Model.Margin(lgb.Model.Vector(tc.features)); math.Abs(got-want) > 1e-12 {
+			t.Errorf("%s lightgbm: margin %.12f, want %.12f", tc.name, got, want)
+		}
+		if p, margin := lgb.Probability(tc.features); math.Abs(p-1/(1+math.Exp(-margin))) > 1e-12 {
+			t.Errorf("%s lightgbm: probability %v for margin %v", tc.name, p, margin)
+		}
+	}
+}
+
+func TestModelMetadata(t *testing.T) {
+	xgb := loadModel(t, FormatXGBoostJSON, "xgb_handwritten.json")
+	if xgb.Model.NumTrees() != 3 || xgb.Model.NumFeatures() != 3 || xgb.Model.Objective != "binary:logistic" {
+		t.Errorf("xgboost metadata: trees=%d features=%v objective=%s", xgb.Model.NumTrees(), xgb.Model.Features, xgb.Model.Objective)
+	}
+	lgb := loadModel(t, FormatLightGBMText, "lgb_handwritten.txt")
+	if lgb.Model.NumTrees() != 3 || lgb.Model.Features[2] != "atr_pct" {
+		t.Errorf("lightgbm metadata: trees=%d features=%v", lgb.Model.NumTrees(), lgb.Model.Features)
+	}
+
+	// 非數值特徵視為缺值
+	features := map[string]interface{}{"rv_pctile_30d": "n/a", "rho_usdttwd_14": true, "atr_pct": 1}
+	x := xgb.Model.Vector(features)
+	if !math.IsNaN(x[0]) || x[1] != 1 || x[2] != 1 {
+		t.Errorf("vector = %v", x)
+	}
+	if c := xgb.Coverage(features); math.Abs(c-2.0/3) > 1e-12 {
+		t.Errorf("coverage = %v", c)
+	}
+}
+
+func TestContributions(t *testing.T) {
+	xgb := loadModel(t, FormatXGBoostJSON, "xgb_handwritten.json")
+	features := map[string]interface{}{"rv_pctile_30d": 0.1, "rho_usdttwd_14": -0.5}
+	contributions := xgb.Model.Contributions(features)
+	if len(contributions) != 2 {
+		t.Fatalf("contributions = %+v", contributions)
+	}
+
+	// 每項貢獻等於將該特徵改為缺值後的原始分數差，且依絕對值排序
+	base := xgb.Model.Margin(xgb.Model.Vector(features))
+	for i, c := range contributions {
+		ablated := map[string]interface{}{}
+		for k, v := range features {
+			if k != c.Feature {
+				ablated[k] = v
+			}
+		}
+		if want := base - xgb.Model.Margin(xgb.Model.Vector(ablated)); math.Abs(c.Margin-want) > 1e-12 {
+			t.Errorf("%s: contribution %v, want %v", c.Feature, c.Margin, want)
+		}
+		if i > 0 && math.Abs(c.Margin) > math.Abs(contributions[i-1].Margin) {
+			t.Errorf("contributions not sorted: %+v", contributions)
+		}
+	}
+}
+
+func TestCalibration(t *testing.T) {
+	content, _ := os.ReadFile("testdata/xgb_handwritten.json")
+	features := map[string]interface{}{"rv_pctile_30d": 0.1, "rho_usdttwd_14": -0.5, "atr_pct": 0.8}
+
+	platt, err := Load(Artifact{Format: FormatXGBoostJSON, Calibration: &Calibration{Method: "platt", A: 2, B: -0.1}}, content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, margin := platt.Probability(features)
+	if want := 1 / (1 + math.Exp(-(2*margin - 0.1))); math.Abs(p-want) > 1e-12 {
+		t.Errorf("platt: got %v, want %v", p, want)
+	}
+
+	iso, err := Load(Artifact{Format: FormatXGBoostJSON, Calibration: &Calibration{Method: "isotonic", X: []float64{0, 0.5, 1}, Y: []float64{0.1, 0.4, 0.9}}}, content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := loadModel(t, FormatXGBoostJSON, "xgb_handwritten.json")
+	rawP, _ := raw.Probability(features)
+	if p, _ := iso.Probability(features); math.Abs(p-(0.4+(rawP-0.5))) > 1e-9 {
+		t.Errorf("isotonic: got %v for raw %v", p, rawP)
+	}
+
+	if _, err := Load(Artifact{Format: FormatXGBoostJSON, Calibration: &Calibration{Method: "isotonic", X: []float64{0, 1}, Y: []float64{0.9, 0.1}}}, content); err == nil {
+		t.Error("expected non-monotonic isotonic calibration to be rejected")
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	xgbContent, _ := os.ReadFile("testdata/xgb_handwritten.json")
+	lgbContent, _ := os.ReadFile("testdata/lgb_handwritten.txt")
+
+	cases := []struct {
+		artifact Artifact
+		content  string
+		want     string
+	}{
+		{Artifact{Format: FormatXGBoostJSON, SHA256: "00"}, string(xgbContent), "sha256 mismatch"},
+		{Artifact{Format: FormatXGBoostJSON, Features: []string{"a"}}, string(xgbContent), "1 features configured, model expects 3"},
+		{Artifact{Format: "onnx"}, string(xgbContent), `unknown format "onnx"`},
+		{Artifact{Format: FormatXGBoostJSON}, strings.Replace(string(xgbContent), "binary:logistic", "reg:squarederror", 1), "calibration required"},
+		{Artifact{Format: FormatXGBoostJSON}, strings.Replace(string(xgbContent), "binary:logistic", "multi:softprob", 1), `unsupported objective "multi:softprob"`},
+		{Artifact{Format: FormatXGBoostJSON}, strings.Replace(string(xgbContent), `"split_type": [0, 0, 0]`, `"split_type": [1, 0, 0]`, 1), "categorical splits are not supported"},
+		{Artifact{Format: FormatXGBoostJSON}, strings.Replace(string(xgbContent), `"left_children": [1, -1, -1]`, `"left_children": [0, -1, -1]`, 1), "invalid child 0"},
+		{Artifact{Format: FormatLightGBMText}, strings.Replace(string(lgbContent), "decision_type=10 8 2", "decision_type=11 8 2", 1), "categorical splits are not supported"},
+		{Artifact{Format: FormatLightGBMText}, strings.Replace(string(lgbContent), "split_feature=0 1 2", "split_feature=0 1 7", 1), "feature index 7 out of range"},
+		{Artifact{Format: FormatLightGBMText}, strings.Replace(string(lgbContent), "num_class=1", "num_class=3", 1), "multi-class models are not supported"},
+	}
+	for _, tc := range cases {
+		_, err := Load(tc.artifact, []byte(tc.content))
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("want error containing %q, got %v", tc.want, err)
+		}
+	}
+}
+
+func TestLoadFromDir(t *testing.T) {
+	content, _ := os.ReadFile("testdata/lgb_handwritten.txt")
+	sum := sha256.Sum256(content)
+
+	dir := t.TempDir()
+	for _, version := range []string{"v1", "v2"} {
+		versionDir := filepath.Join(dir, "l2_confidence", version)
+		if err := os.MkdirAll(versionDir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		manifest, _ := json.Marshal(Artifact{
+			Name:    "l2_confidence",
+			Version: version,
+			Format:  FormatLightGBMText,
+			File:    "model.txt",
+			SHA256:  hex.EncodeToString(sum[:]),
+		})
+		os.WriteFile(filepath.Join(versionDir, "manifest.json"), manifest, 0o644)
+		os.WriteFile(filepath.Join(versionDir, "model.txt"), content, 0o644)
+	}
+
+	p, err := LoadFromDir(dir, "l2_confidence", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Artifact.Version != "v2" {
+		t.Errorf("latest version = %s, want v2", p.Artifact.Version)
+	}
+	if p, err := LoadFromDir(dir, "l2_confidence", "v1"); err != nil || p.Artifact.Version != "v1" {
+		t.Errorf("pinned version: %v %v", p, err)
+	}
+}
+
+func BenchmarkPredict(b *testing.B) {
+	content, _ := os.ReadFile("testdata/lgb_handwritten.txt")
+	p, err := Load(Artifact{Format: FormatLightGBMText}, content)
+	if err != nil {
+		b.Fatal(err)
+	}
+	features := map[string]interface{}{"rv_pctile_30d": 0.1, "rho_usdttwd_14": -0.5, "atr_pct": 0.8}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		p.Probability(features)
+	}
+}
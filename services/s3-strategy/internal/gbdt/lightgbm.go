@@ -0,0 +1,221 @@
+package gbdt
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// LightGBM decision_type 位元
+const (
+	lgbCategoricalMask = 1
+	lgbDefaultLeftMask = 2
+)
+
+// ParseLightGBMText 解析 Booster.save_model("*.txt") 的模型檔（數值分割、二元分類或迴歸）
+func ParseLightGBMText(data []byte) (*Model, error) {
+	header := make(map[string]string)
+	var blocks []map[string]string
+	var current map[string]string
+	averageOutput := false
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if line == "end of trees" {
+			break
+		}
+		if line == "average_output" {
+			averageOutput = true
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		if key == "Tree" {
+			current = map[string]string{"Tree": value}
+			blocks = append(blocks, current)
+			continue
+		}
+		if current != nil {
+			current[key] = value
+		} else {
+			header[key] = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("invalid lightgbm model: %w", err)
+	}
+	if header["version"] == "" {
+		return nil, fmt.Errorf("invalid lightgbm model: missing header")
+	}
+	if nc := header["num_class"]; nc != "" && nc != "1" {
+		return nil, fmt.Errorf("multi-class models are not supported (num_class=%s)", nc)
+	}
+
+	m := &Model{Format: FormatLightGBMText, average: averageOutput}
+	objective := strings.Fields(header["objective"])
+	if len(objective) == 0 {
+		return nil, fmt.Errorf("invalid lightgbm model: missing objective")
+	}
+	m.Objective = objective[0]
+	switch m.Objective {
+	case "binary":
+		scale := 1.0
+		for _, param := range objective[1:] {
+			if v, ok := strings.CutPrefix(param, "sigmoid:"); ok {
+				parsed, err := strconv.ParseFloat(v, 64)
+				if err != nil {
+					return nil, fmt.Errorf("invalid objective %q", header["objective"])
+				}
+				scale = parsed
+			}
+		}
+		m.transform = func(x float64) float64 { return sigmoid(scale * x) }
+	case "cross_entropy", "xentropy":
+		m.transform = sigmoid
+	case "regression", "regression_l1", "huber", "fair", "quantile":
+	default:
+		return nil, fmt.Errorf("unsupported objective %q", header["objective"])
+	}
+
+	maxFeatureIdx, err := strconv.Atoi(header["max_feature_idx"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid max_feature_idx %q", header["max_feature_idx"])
+	}
+	numFeatures := maxFeatureIdx + 1
+	if names := strings.Fields(header["feature_names"]); len(names) > 0 {
+		if len(names) != numFeatures {
+			return nil, fmt.Errorf("feature_names has %d entries, max_feature_idx=%d", len(names), maxFeatureIdx)
+		}
+		m.Features = names
+	} else {
+		for i := 0; i < numFeatures; i++ {
+			m.Features = append(m.Features, fmt.Sprintf("Column_%d", i))
+		}
+	}
+
+	for _, block := range blocks {
+		t, err := buildLightGBMTree(block)
+		if err != nil {
+			return nil, fmt.Errorf("tree %s: %w", block["Tree"], err)
+		}
+		if err := t.validate(numFeatures); err != nil {
+			return nil, fmt.Errorf("tree %s: %w", block["Tree"], err)
+		}
+		m.trees = append(m.trees, t)
+	}
+	if len(m.trees) == 0 {
+		return nil, fmt.Errorf("model has no trees")
+	}
+	return m, nil
+}
+
+// buildLightGBMTree 內部節點放前段、葉節點接在其後；子節點為負數 ~leaf 時指向葉
+func buildLightGBMTree(block map[string]string) (tree, error) {
+	numLeaves, err := strconv.Atoi(block["num_leaves"])
+	if err != nil || numLeaves < 1 {
+		return tree{}, fmt.Errorf("invalid num_leaves %q", block["num_leaves"])
+	}
+	if cat := block["num_cat"]; cat != "" && cat != "0" {
+		return tree{}, fmt.Errorf("categorical splits are not supported")
+	}
+	if linear := block["is_linear"]; linear != "" && linear != "0" {
+		return tree{}, fmt.Errorf("linear trees are not supported")
+	}
+
+	leafValues, err := parseFloats(block["leaf_value"], numLeaves)
+	if err != nil {
+		return tree{}, fmt.Errorf("leaf_value: %w", err)
+	}
+	if numLeaves == 1 {
+		return tree{nodes: []node{{feature: -1, value: leafValues[0]}}}, nil
+	}
+
+	internal := numLeaves - 1
+	features, err := parseInts(block["split_feature"], internal)
+	if err != nil {
+		return tree{}, fmt.Errorf("split_feature: %w", err)
+	}
+	thresholds, err := parseFloats(block["threshold"], internal)
+	if err != nil {
+		return tree{}, fmt.Errorf("threshold: %w", err)
+	}
+	decisionTypes, err := parseInts(block["decision_type"], internal)
+	if err != nil {
+		return tree{}, fmt.Errorf("decision_type: %w", err)
+	}
+	lefts, err := parseInts(block["left_child"], internal)
+	if err != nil {
+		return tree{}, fmt.Errorf("left_child: %w", err)
+	}
+	rights, err := parseInts(block["right_child"], internal)
+	if err != nil {
+		return tree{}, fmt.Errorf("right_child: %w", err)
+	}
+
+	child := func(c int) int32 {
+		if c < 0 {
+			return int32(internal + ^c)
+		}
+		return int32(c)
+	}
+	t := tree{nodes: make([]node, internal+numLeaves)}
+	for i := 0; i < internal; i++ {
+		dt := decisionTypes[i]
+		if dt&lgbCategoricalMask != 0 {
+			return tree{}, fmt.Errorf("node %d: categorical splits are not supported", i)
+		}
+		t.nodes[i] = node{
+			feature:     int32(features[i]),
+			left:        child(lefts[i]),
+			right:       child(rights[i]),
+			threshold:   thresholds[i],
+			defaultLeft: dt&lgbDefaultLeftMask != 0,
+			missing:     uint8((dt >> 2) & 3),
+		}
+	}
+	for i, v := range leafValues {
+		t.nodes[internal+i] = node{feature: -1, value: v}
+	}
+	return t, nil
+}
+
+func parseFloats(s string, n int) ([]float64, error) {
+	fields := strings.Fields(s)
+	if len(fields) != n {
+		return nil, fmt.Errorf("expected %d values, got %d", n, len(fields))
+	}
+	out := make([]float64, n)
+	for i, f := range fields {
+		v, err := strconv.ParseFloat(f, 64)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+func parseInts(s string, n int) ([]int, error) {
+	fields := strings.Fields(s)
+	if len(fields) != n {
+		return nil, fmt.Errorf("expected %d values, got %d", n, len(fields))
+	}
+	out := make([]int, n)
+	for i, f := range fields {
+		v, err := strconv.Atoi(f)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = v
+	}
+	return out, nil
+}
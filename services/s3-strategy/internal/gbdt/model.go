@@ -0,0 +1,235 @@
+// Package gbdt 提供樹集成模型（XGBoost JSON / LightGBM 文字檔）的純 Go 推論。
+//
+// 模型載入時攤平成節點陣列，推論只做比較與加總，不配置記憶體以外的資源；
+// 特徵依名稱對應，缺值（未提供、null、非數值）走各框架的預設分支。
+package gbdt
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Format 模型檔格式
+type Format string
+
+const (
+	FormatXGBoostJSON  Format = "xgboost_json"
+	FormatLightGBMText Format = "lightgbm_text"
+)
+
+// 節點缺值處理（LightGBM missing_type；XGBoost 固定為 NaN）
+const (
+	missingNone uint8 = iota
+	missingZero
+	missingNaN
+)
+
+// kZeroThreshold LightGBM 判斷零值的門檻
+const kZeroThreshold = 1e-35
+
+type node struct {
+	feature     int32 // < 0 表示葉節點
+	left, right int32
+	threshold   float64
+	defaultLeft bool
+	missing     uint8
+	value       float64 // 葉值
+}
+
+type tree struct {
+	nodes []node
+}
+
+// Model 已載入的樹集成
+type Model struct {
+	Format    Format
+	Objective string
+	Features  []string
+
+	trees      []tree
+	baseMargin float64
+	float32Cmp bool // XGBoost 以 float32 比較特徵與門檻，且 x < 門檻 走左
+	transform  func(float64) float64
+	average    bool // LightGBM random forest：葉值取平均
+}
+
+func sigmoid(x float64) float64 {
+	return 1 / (1 + math.Exp(-x))
+}
+
+func logit(p float64) float64 {
+	return math.Log(p / (1 - p))
+}
+
+// NumFeatures 特徵數量
+func (m *Model) NumFeatures() int {
+	return len(m.Features)
+}
+
+// NumTrees 樹的數量
+func (m *Model) NumTrees() int {
+	return len(m.trees)
+}
+
+// Vector 依模型特徵順序組特徵向量；缺值或非數值為 NaN，布林視為 1/0
+func (m *Model) Vector(features map[string]interface{}) []float64 {
+	x := make([]float64, len(m.Features))
+	for i, name := range m.Features {
+		x[i] = toFloat(features[name])
+	}
+	return x
+}
+
+func toFloat(v interface{}) float64 {
+	switch n := v.(type) {
+	case float64:
+		return n
+	case float32:
+		return float64(n)
+	case int:
+		return float64(n)
+	case int64:
+		return float64(n)
+	case int32:
+		return float64(n)
+	case bool:
+		if n {
+			return 1
+		}
+		return 0
+	default:
+		return math.NaN()
+	}
+}
+
+// Margin 未經轉換的原始分數（所有樹的葉值加總 + base margin）
+func (m *Model) Margin(x []float64) float64 {
+	if m.float32Cmp {
+		// 與 XGBoost 相同以 float32 自 base margin 起累加
+		sum := float32(m.baseMargin)
+		for i := range m.trees {
+			sum += float32(m.trees[i].leafXGB(x))
+		}
+		return float64(sum)
+	}
+	var sum float64
+	for i := range m.trees {
+		sum += m.trees[i].leafLGB(x)
+	}
+	if m.average && len(m.trees) > 0 {
+		sum /= float64(len(m.trees))
+	}
+	return sum + m.baseMargin
+}
+
+// PredictVector 模型輸出（依 objective 轉換，如 sigmoid）
+func (m *Model) PredictVector(x []float64) float64 {
+	margin := m.Margin(x)
+	if m.transform == nil {
+		return margin
+	}
+	return m.transform(margin)
+}
+
+// Predict 依特徵名稱推論
+func (m *Model) Predict(features map[string]interface{}) float64 {
+	return m.PredictVector(m.Vector(features))
+}
+
+// Contribution 單一特徵對原始分數的貢獻
+type Contribution struct {
+	Feature string
+	Value   float64
+	Margin  float64 // margin(x) − margin(x 中此特徵改為缺值)
+}
+
+// Contributions 逐一將已提供的特徵改為缺值，以原始分數差估計貢獻（依 |Margin| 由大到小）。
+// 此為缺值替換（ablation）近似，並非 SHAP：特徵間的交互作用不會被均分。
+func (m *Model) Contributions(features map[string]interface{}) []Contribution {
+	x := m.Vector(features)
+	base := m.Margin(x)
+	out := make([]Contribution, 0, len(x))
+	for i, v := range x {
+		if math.IsNaN(v) {
+			continue
+		}
+		x[i] = math.NaN()
+		out = append(out, Contribution{Feature: m.Features[i], Value: v, Margin: base - m.Margin(x)})
+		x[i] = v
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return math.Abs(out[i].Margin) > math.Abs(out[j].Margin)
+	})
+	return out
+}
+
+// leafXGB XGBoost：NaN 走 default_left，否則 float32(x) < 門檻 走左
+func (t *tree) leafXGB(x []float64) float64 {
+	i := int32(0)
+	for {
+		n := &t.nodes[i]
+		if n.feature < 0 {
+			return n.value
+		}
+		v := x[n.feature]
+		var goLeft bool
+		if math.IsNaN(v) {
+			goLeft = n.defaultLeft
+		} else {
+			goLeft = float32(v) < float32(n.threshold)
+		}
+		if goLeft {
+			i = n.left
+		} else {
+			i = n.right
+		}
+	}
+}
+
+// leafLGB LightGBM NumericalDecision：依 missing_type 決定缺值/零值的預設分支，否則 x <= 門檻 走左
+func (t *tree) leafLGB(x []float64) float64 {
+	i := int32(0)
+	for {
+		n := &t.nodes[i]
+		if n.feature < 0 {
+			return n.value
+		}
+		v := x[n.feature]
+		if math.IsNaN(v) && n.missing != missingNaN {
+			v = 0
+		}
+		var goLeft bool
+		if (n.missing == missingZero && math.Abs(v) <= kZeroThreshold) || (n.missing == missingNaN && math.IsNaN(v)) {
+			goLeft = n.defaultLeft
+		} else {
+			goLeft = v <= n.threshold
+		}
+		if goLeft {
+			i = n.left
+		} else {
+			i = n.right
+		}
+	}
+}
+
+// validate 檢查子節點索引與特徵索引，避免推論時越界或無窮迴圈
+func (t *tree) validate(numFeatures int) error {
+	if len(t.nodes) == 0 {
+		return fmt.Errorf("empty tree")
+	}
+	for i, n := range t.nodes {
+		if n.feature < 0 {
+			continue
+		}
+		if int(n.feature) >= numFeatures {
+			return fmt.Errorf("node %d: feature index %d out of range (%d features)", i, n.feature, numFeatures)
+		}
+		for _, child := range []int32{n.left, n.right} {
+			if child <= int32(i) || int(child) >= len(t.nodes) {
+				return fmt.Errorf("node %d: invalid child %d", i, child)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+#!/usr/bin/env python3
+"""Generate golden.json for the gbdt package tests from real framework models.
+
+Trains a small binary:logistic XGBoost model and a binary LightGBM model on
+deterministic synthetic data (with missing values and exact zeros so the
+default-direction and zero-as-missing paths are exercised), saves them as
+xgb_trained.json / lgb_trained.txt, and records Booster.predict scores for
+CASES. xgboost, lightgbm and numpy are required; there is no fallback.
+
+    pip install numpy xgboost lightgbm
+    python3 gen_golden.py          # run inside testdata/
+
+Commit xgb_trained.json, lgb_trained.txt and golden.json together.
+"""
+import json
+import platform
+import sys
+
+try:
+    import lightgbm as lgb
+    import numpy as np
+    import xgboost as xgb
+except ImportError as err:
+    sys.exit("gen_golden.py: %s; install numpy, xgboost and lightgbm" % err)
+
+FEATURES = ["rv_pctile_30d", "rho_usdttwd_14", "atr_pct"]
+XGB_MODEL = "xgb_trained.json"
+LGB_MODEL = "lgb_trained.txt"
+SEED = 20240601
+
+# None marks a missing feature (absent key in the request)
+CASES = [
+    [0.1, -0.5, 0.8],
+    [0.1, -0.2, 1.5],
+    [0.25, -0.3, 1.0],
+    [0.4, 0.2, 0.3],
+    [0.9, -0.9, 2.5],
+    [None, -0.5, 0.8],
+    [0.1, None, 0.8],
+    [0.4, 0.2, None],
+    [None, None, None],
+    [0.0, 0.0, 0.0],
+    [-0.1, 0.5, 0.6],
+    [0.10000000149, -0.3, 0.6],
+    [0.75, 0.9, 0.05],
+    [0.5, -0.75, 3.0],
+]
+
+
+def dataset(n=4000):
+    rng = np.random.default_rng(SEED)
+    x = np.column_stack([
+        rng.uniform(0, 1, n),
+        rng.uniform(-1, 1, n),
+        rng.gamma(2.0, 0.5, n),
+    ])
+    logit = 1.5 - 3.0 * x[:, 0] - 1.2 * x[:, 1] + 0.8 * np.minimum(x[:, 2], 2.0) - 1.0
+    y = (rng.uniform(0, 1, n) < 1 / (1 + np.exp(-logit))).astype(np.float64)
+    # 缺值與精確 0 讓預設方向、zero-as-missing 路徑都會被學到
+    x[rng.uniform(0, 1, n) < 0.08, 0] = np.nan
+    x[rng.uniform(0, 1, n) < 0.08, 1] = np.nan
+    x[rng.uniform(0, 1, n) < 0.05, 2] = np.nan
+    x[rng.uniform(0, 1, n) < 0.05, 0] = 0.0
+    return x, y
+
+
+def train(x, y):
+    dtrain = xgb.DMatrix(x, label=y, missing=np.nan, feature_names=FEATURES)
+    xgb_booster = xgb.train(
+        {"objective": "binary:logistic", "max_depth": 3, "eta": 0.3, "seed": SEED, "nthread": 1},
+        dtrain,
+        num_boost_round=20,
+    )
+    xgb_booster.save_model(XGB_MODEL)
+
+    lgb_booster = lgb.train(
+        {
+            "objective": "binary",
+            "num_leaves": 7,
+            "learning_rate": 0.2,
+            "min_data_in_leaf": 20,
+            "seed": SEED,
+            "deterministic": True,
+            "num_threads": 1,
+            "verbose": -1,
+        },
+        lgb.Dataset(x, label=y, feature_name=FEATURES),
+        num_boost_round=20,
+    )
+    lgb_booster.save_model(LGB_MODEL)
+
+
+def predict(rows):
+    x = np.array([[np.nan if v is None else v for v in r] for r in rows], dtype=np.float64)
+    # 重新自檔案載入，確保比對的是 Go 端讀取的同一份模型
+    xgb_booster = xgb.Booster(model_file=XGB_MODEL)
+    xgb_scores = xgb_booster.predict(xgb.DMatrix(x, missing=np.nan, feature_names=FEATURES))
+    lgb_scores = lgb.Booster(model_file=LGB_MODEL).predict(x)
+    return xgb_scores.tolist(), lgb_scores.tolist()
+
+
+def main():
+    train(*dataset())
+    xgb_scores, lgb_scores = predict(CASES)
+    cases = []
+    for row, xs, ls in zip(CASES, xgb_scores, lgb_scores):
+        features = {name: v for name, v in zip(FEATURES, row) if v is not None}
+        cases.append({"features": features, "xgboost": round(xs, 9), "lightgbm": round(ls, 12)})
+    golden = {
+        "generator": {
+            "python": platform.python_version(),
+            "numpy": np.__version__,
+            "xgboost": xgb.__version__,
+            "lightgbm": lgb.__version__,
+        },
+        "models": {"xgboost": XGB_MODEL, "lightgbm": LGB_MODEL},
+        "cases": cases,
+    }
+    with open("golden.json", "w") as f:
+        json.dump(golden, f, indent=2)
+        f.write("\n")
+
+
+if __name__ == "__main__":
+    main()
@@ -0,0 +1,151 @@
+package gbdt
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type xgbModelDoc struct {
+	Learner struct {
+		FeatureNames    []string `json:"feature_names"`
+		GradientBooster struct {
+			Name  string `json:"name"`
+			Model struct {
+				Trees    []xgbTree `json:"trees"`
+				TreeInfo []int     `json:"tree_info"`
+			} `json:"model"`
+		} `json:"gradient_booster"`
+		LearnerModelParam struct {
+			BaseScore  string `json:"base_score"`
+			NumClass   string `json:"num_class"`
+			NumFeature string `json:"num_feature"`
+		} `json:"learner_model_param"`
+		Objective struct {
+			Name string `json:"name"`
+		} `json:"objective"`
+	} `json:"learner"`
+}
+
+type xgbTree struct {
+	LeftChildren    []int32   `json:"left_children"`
+	RightChildren   []int32   `json:"right_children"`
+	SplitIndices    []int32   `json:"split_indices"`
+	SplitConditions []float64 `json:"split_conditions"`
+	DefaultLeft     []boolish `json:"default_left"`
+	SplitType       []int     `json:"split_type"`
+}
+
+// boolish 相容 default_left 以 0/1 或 true/false 表示
+type boolish bool
+
+func (b *boolish) UnmarshalJSON(data []byte) error {
+	switch strings.TrimSpace(string(data)) {
+	case "1", "true":
+		*b = true
+	case "0", "false":
+		*b = false
+	default:
+		return fmt.Errorf("invalid boolean %s", data)
+	}
+	return nil
+}
+
+// parseBaseScore 相容 "5E-1" 與 2.1 之後的 "[5E-1]"
+func parseBaseScore(raw string) (float64, error) {
+	raw = strings.TrimSpace(strings.Trim(strings.TrimSpace(raw), "[]"))
+	if raw == "" {
+		return 0.5, nil
+	}
+	return strconv.ParseFloat(raw, 64)
+}
+
+// ParseXGBoostJSON 解析 Booster.save_model("*.json") 的模型檔（gbtree、二元分類或迴歸）
+func ParseXGBoostJSON(data []byte) (*Model, error) {
+	var doc xgbModelDoc
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid xgboost json: %w", err)
+	}
+	learner := doc.Learner
+
+	if name := learner.GradientBooster.Name; name != "gbtree" {
+		return nil, fmt.Errorf("unsupported gradient booster %q", name)
+	}
+	if nc := learner.LearnerModelParam.NumClass; nc != "" && nc != "0" && nc != "1" {
+		return nil, fmt.Errorf("multi-class models are not supported (num_class=%s)", nc)
+	}
+
+	baseScore, err := parseBaseScore(learner.LearnerModelParam.BaseScore)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base_score %q: %w", learner.LearnerModelParam.BaseScore, err)
+	}
+
+	m := &Model{Format: FormatXGBoostJSON, Objective: learner.Objective.Name, float32Cmp: true}
+	switch m.Objective {
+	case "binary:logistic", "reg:logistic":
+		m.baseMargin = logit(baseScore)
+		m.transform = sigmoid
+	case "binary:logitraw":
+		m.baseMargin = logit(baseScore)
+	case "reg:squarederror", "reg:linear":
+		m.baseMargin = baseScore
+	default:
+		return nil, fmt.Errorf("unsupported objective %q", m.Objective)
+	}
+
+	numFeatures := len(learner.FeatureNames)
+	if numFeatures == 0 {
+		n, err := strconv.Atoi(learner.LearnerModelParam.NumFeature)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("model has neither feature_names nor num_feature")
+		}
+		numFeatures = n
+		for i := 0; i < n; i++ {
+			m.Features = append(m.Features, fmt.Sprintf("f%d", i))
+		}
+	} else {
+		m.Features = append([]string(nil), learner.FeatureNames...)
+	}
+
+	for ti, xt := range learner.GradientBooster.Model.Trees {
+		t, err := xt.build()
+		if err != nil {
+			return nil, fmt.Errorf("tree %d: %w", ti, err)
+		}
+		if err := t.validate(numFeatures); err != nil {
+			return nil, fmt.Errorf("tree %d: %w", ti, err)
+		}
+		m.trees = append(m.trees, t)
+	}
+	if len(m.trees) == 0 {
+		return nil, fmt.Errorf("model has no trees")
+	}
+	return m, nil
+}
+
+func (xt *xgbTree) build() (tree, error) {
+	n := len(xt.LeftChildren)
+	if len(xt.RightChildren) != n || len(xt.SplitIndices) != n || len(xt.SplitConditions) != n || len(xt.DefaultLeft) != n {
+		return tree{}, fmt.Errorf("inconsistent node arrays")
+	}
+	t := tree{nodes: make([]node, n)}
+	for i := 0; i < n; i++ {
+		if i < len(xt.SplitType) && xt.SplitType[i] != 0 {
+			return tree{}, fmt.Errorf("node %d: categorical splits are not supported", i)
+		}
+		if xt.LeftChildren[i] < 0 {
+			t.nodes[i] = node{feature: -1, value: xt.SplitConditions[i]}
+			continue
+		}
+		t.nodes[i] = node{
+			feature:     xt.SplitIndices[i],
+			left:        xt.LeftChildren[i],
+			right:       xt.RightChildren[i],
+			threshold:   xt.SplitConditions[i],
+			defaultLeft: bool(xt.DefaultLeft[i]),
+			missing:     missingNaN,
+		}
+	}
+	return t, nil
+}
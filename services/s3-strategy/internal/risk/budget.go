@@ -0,0 +1,145 @@
+package risk
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"s3-strategy/dao"
+)
+
+// Redis 風險鍵（S3 暫占、成交/撤單後釋放）
+const (
+	FutMarginKey = "risk:budget:fut_margin:inuse"
+	SpotQuoteKey = "risk:budget:spot_quote:inuse"
+)
+
+// ConcurrencyKey 該標的併發入場暫占鍵
+func ConcurrencyKey(symbol string) string {
+	return fmt.Sprintf("risk:concurrency:{%s}", symbol)
+}
+
+// BudgetKey 依市場回傳額度鍵：FUT 以保證金計、SPOT 以報價幣名義金額計
+func BudgetKey(market dao.Market) string {
+	if market == dao.MarketSPOT {
+		return SpotQuoteKey
+	}
+	return FutMarginKey
+}
+
+// Limits 風險預算上限
+type Limits struct {
+	FutMarginUSDT     float64
+	SpotQuoteUSDT     float64
+	ConcurrentEntries int
+	ReservationTTL    time.Duration // 意圖未送出/未回報時暫占自動失效
+}
+
+func (l Limits) budgetLimit(market dao.Market) float64 {
+	if market == dao.MarketSPOT {
+		return l.SpotQuoteUSDT
+	}
+	return l.FutMarginUSDT
+}
+
+// Reservation 單一入場意圖的暫占
+type Reservation struct {
+	IntentID string
+	Symbol   string
+	Market   dao.Market
+	Amount   float64 // FUT：保證金 USDT；SPOT：名義金額 USDT
+}
+
+// Budget 入場前暫占併發數與額度；兩個鍵分屬不同槽位，故分兩步暫占、額度不足時回滾併發數
+type Budget struct {
+	ledger Ledger
+	limits Limits
+	scope  string // 非空時為單一策略的額度（鍵加上 strategy:<scope>）
+}
+
+func NewBudget(ledger Ledger, limits Limits) *Budget {
+	return &Budget{ledger: ledger, limits: limits}
+}
+
+// Scoped 同一帳本上單一策略的額度；與帳戶層額度分開計算
+func (b *Budget) Scoped(scope string, limits Limits) *Budget {
+	return &Budget{ledger: b.ledger, limits: limits, scope: scope}
+}
+
+func (b *Budget) Limits() Limits {
+	return b.limits
+}
+
+func (b *Budget) concurrencyKey(symbol string) string {
+	if b.scope == "" {
+		return ConcurrencyKey(symbol)
+	}
+	return fmt.Sprintf("risk:concurrency:strategy:%s:{%s}", b.scope, symbol)
+}
+
+func (b *Budget) budgetKey(market dao.Market) string {
+	if b.scope == "" {
+		return BudgetKey(market)
+	}
+	return strings.Replace(BudgetKey(market), "risk:budget:", "risk:budget:strategy:"+b.scope+":", 1)
+}
+
+// Headroom 唯讀預檢：併發已滿或額度用罄時回傳原因（最終以 Reserve 為準）
+func (b *Budget) Headroom(ctx context.Context, symbol string, market dao.Market) (bool, string, error) {
+	concurrent, err := b.ledger.Usage(ctx, b.concurrencyKey(symbol))
+	if err != nil {
+		return false, "", err
+	}
+	if concurrent >= float64(b.limits.ConcurrentEntries) {
+		return false, fmt.Sprintf("concurrent entries full: %.0f/%d", concurrent, b.limits.ConcurrentEntries), nil
+	}
+	inuse, err := b.ledger.Usage(ctx, b.budgetKey(market))
+	if err != nil {
+		return false, "", err
+	}
+	if limit := b.limits.budgetLimit(market); inuse >= limit {
+		return false, fmt.Sprintf("%s budget exhausted: %.2f/%.2f USDT", market, inuse, limit), nil
+	}
+	return true, "", nil
+}
+
+// Reserve 原子暫占；未通過時回傳原因
+func (b *Budget) Reserve(ctx context.Context, r Reservation) (bool, string, error) {
+	concurrencyKey := b.concurrencyKey(r.Symbol)
+	ok, inuse, err := b.ledger.Reserve(ctx, concurrencyKey, r.IntentID, 1, float64(b.limits.ConcurrentEntries), b.limits.ReservationTTL)
+	if err != nil {
+		return false, "", err
+	}
+	if !ok {
+		return false, fmt.Sprintf("concurrent entries full: %.0f/%d", inuse, b.limits.ConcurrentEntries), nil
+	}
+
+	limit := b.limits.budgetLimit(r.Market)
+	ok, inuse, err = b.ledger.Reserve(ctx, b.budgetKey(r.Market), r.IntentID, r.Amount, limit, b.limits.ReservationTTL)
+	if err != nil || !ok {
+		if _, releaseErr := b.ledger.Release(ctx, concurrencyKey, r.IntentID); releaseErr != nil && err == nil {
+			err = releaseErr
+		}
+	}
+	if err != nil {
+		return false, "", err
+	}
+	if !ok {
+		return false, fmt.Sprintf("%s budget exceeded: %.2f + %.2f > %.2f USDT", r.Market, inuse, r.Amount, limit), nil
+	}
+	return true, "", nil
+}
+
+// Release 釋放意圖的暫占（成交或撤單後）；重複釋放無副作用
+func (b *Budget) Release(ctx context.Context, intentID, symbol string, market dao.Market) (bool, error) {
+	released, err := b.ledger.Release(ctx, b.budgetKey(market), intentID)
+	if err != nil {
+		return false, err
+	}
+	concurrencyReleased, err := b.ledger.Release(ctx, b.concurrencyKey(symbol), intentID)
+	if err != nil {
+		return released, err
+	}
+	return released || concurrencyReleased, nil
+}
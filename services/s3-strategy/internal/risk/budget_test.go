@@ -0,0 +1,144 @@
+package risk
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"s3-strategy/dao"
+)
+
+func newTestBudget() (*Budget, *MemoryLedger, *time.Time) {
+	now := time.Unix(1700000000, 0)
+	ledger := NewMemoryLedger()
+	ledger.now = func() time.Time { return now }
+	budget := NewBudget(ledger, Limits{
+		FutMarginUSDT:     100,
+		SpotQuoteUSDT:     1000,
+		ConcurrentEntries: 2,
+		ReservationTTL:    time.Minute,
+	})
+	return budget, ledger, &now
+}
+
+func TestBudget_ReserveAndRelease(t *testing.T) {
+	budget, ledger, _ := newTestBudget()
+	ctx := context.Background()
+
+	ok, reason, err := budget.Reserve(ctx, Reservation{IntentID: "i1", Symbol: "BTCUSDT", Market: dao.MarketFUT, Amount: 60})
+	if err != nil || !ok {
+		t.Fatalf("first reserve: ok=%v reason=%q err=%v", ok, reason, err)
+	}
+
+	// 同一 intent 重送不重複計入
+	if ok, _, _ := budget.Reserve(ctx, Reservation{IntentID: "i1", Symbol: "BTCUSDT", Market: dao.MarketFUT, Amount: 60}); !ok {
+		t.Error("re-reserving the same intent must be idempotent")
+	}
+
+	// 額度不足：拒絕且回滾併發數
+	ok, reason, _ = budget.Reserve(ctx, Reservation{IntentID: "i2", Symbol: "BTCUSDT", Market: dao.MarketFUT, Amount: 50})
+	if ok || !strings.Contains(reason, "FUT budget exceeded") {
+		t.Errorf("expected budget rejection, got ok=%v reason=%q", ok, reason)
+	}
+	if n, _ := ledger.Usage(ctx, ConcurrencyKey("BTCUSDT")); n != 1 {
+		t.Errorf("concurrency after rollback = %v, want 1", n)
+	}
+
+	// SPOT 額度獨立計算
+	if ok, _, _ := budget.Reserve(ctx, Reservation{IntentID: "i3", Symbol: "BTCUSDT", Market: dao.MarketSPOT, Amount: 500}); !ok {
+		t.Error("spot budget should be independent of futures margin")
+	}
+
+	// 併發數已滿
+	ok, reason, _ = budget.Reserve(ctx, Reservation{IntentID: "i4", Symbol: "BTCUSDT", Market: dao.MarketFUT, Amount: 1})
+	if ok || !strings.Contains(reason, "concurrent entries full: 2/2") {
+		t.Errorf("expected concurrency rejection, got ok=%v reason=%q", ok, reason)
+	}
+	if ok, reason, _ := budget.Headroom(ctx, "BTCUSDT", dao.MarketFUT); ok || reason == "" {
+		t.Error("headroom should report full concurrency")
+	}
+
+	// 成交後釋放；重複釋放無副作用
+	if released, err := budget.Release(ctx, "i1", "BTCUSDT", dao.MarketFUT); err != nil || !released {
+		t.Errorf("release: released=%v err=%v", released, err)
+	}
+	if released, _ := budget.Release(ctx, "i1", "BTCUSDT", dao.MarketFUT); released {
+		t.Error("second release should be a no-op")
+	}
+	if inuse, _ := ledger.Usage(ctx, FutMarginKey); inuse != 0 {
+		t.Errorf("fut margin in use = %v, want 0", inuse)
+	}
+	if ok, _, _ := budget.Reserve(ctx, Reservation{IntentID: "i5", Symbol: "BTCUSDT", Market: dao.MarketFUT, Amount: 100}); !ok {
+		t.Error("released budget should be reusable")
+	}
+}
+
+func TestBudget_ReservationExpires(t *testing.T) {
+	budget, _, now := newTestBudget()
+	ctx := context.Background()
+
+	if ok, _, _ := budget.Reserve(ctx, Reservation{IntentID: "i1", Symbol: "ETHUSDT", Market: dao.MarketFUT, Amount: 100}); !ok {
+		t.Fatal("reserve failed")
+	}
+	if ok, _, _ := budget.Reserve(ctx, Reservation{IntentID: "i2", Symbol: "ETHUSDT", Market: dao.MarketFUT, Amount: 10}); ok {
+		t.Fatal("budget should be exhausted")
+	}
+
+	// 意圖未送出：TTL 到期後額度自動回收
+	*now = now.Add(time.Minute)
+	if ok, reason, _ := budget.Reserve(ctx, Reservation{IntentID: "i2", Symbol: "ETHUSDT", Market: dao.MarketFUT, Amount: 10}); !ok {
+		t.Errorf("expired reservation should be purged, got %q", reason)
+	}
+}
+
+func TestBudget_ConcurrentReservations(t *testing.T) {
+	budget, ledger, _ := newTestBudget()
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			symbol := []string{"BTCUSDT", "ETHUSDT", "SOLUSDT", "BNBUSDT"}[i%4]
+			budget.Reserve(ctx, Reservation{IntentID: string(rune('a' + i)), Symbol: symbol, Market: dao.MarketFUT, Amount: 15})
+		}(i)
+	}
+	wg.Wait()
+
+	if inuse, _ := ledger.Usage(ctx, FutMarginKey); inuse > 100 {
+		t.Errorf("fut margin in use = %v exceeds limit", inuse)
+	}
+}
+
+func TestBudget_Scoped(t *testing.T) {
+	global, ledger, _ := newTestBudget()
+	scoped := global.Scoped("ew_4h", Limits{FutMarginUSDT: 30, SpotQuoteUSDT: 1000, ConcurrentEntries: 1, ReservationTTL: time.Minute})
+	ctx := context.Background()
+
+	if ok, _, _ := scoped.Reserve(ctx, Reservation{IntentID: "i1", Symbol: "BTCUSDT", Market: dao.MarketFUT, Amount: 20}); !ok {
+		t.Fatal("scoped reserve failed")
+	}
+	if ok, reason, _ := scoped.Reserve(ctx, Reservation{IntentID: "i2", Symbol: "ETHUSDT", Market: dao.MarketFUT, Amount: 20}); ok || !strings.Contains(reason, "FUT budget exceeded") {
+		t.Errorf("scoped limit: ok=%v reason=%q", ok, reason)
+	}
+	// 策略額度與帳戶層額度分開計算
+	if inuse, _ := ledger.Usage(ctx, "risk:budget:strategy:ew_4h:fut_margin:inuse"); inuse != 20 {
+		t.Errorf("scoped in use = %v", inuse)
+	}
+	if ok, _, _ := global.Reserve(ctx, Reservation{IntentID: "i3", Symbol: "BTCUSDT", Market: dao.MarketFUT, Amount: 100}); !ok {
+		t.Error("global budget should not see scoped reservations")
+	}
+}
+
+func TestParseEntry(t *testing.T) {
+	amount, expiresAt, err := parseEntry("12.5:1700000060000")
+	if err != nil || amount != 12.5 || expiresAt != 1700000060000 {
+		t.Errorf("round trip = %v %v %v", amount, expiresAt, err)
+	}
+	if _, _, err := parseEntry("bogus"); err == nil {
+		t.Error("expected malformed reservation error")
+	}
+}
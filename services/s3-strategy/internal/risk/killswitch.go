@@ -0,0 +1,262 @@
+package risk
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// 停止進場開關範圍；鍵為 kill_switch:global、kill_switch:strategy:<name>、kill_switch:symbol:<sym>，值為原因
+const (
+	KillScopeGlobal   = "global"
+	KillScopeStrategy = "strategy"
+	KillScopeSymbol   = "symbol"
+
+	killSwitchPrefix = "kill_switch:"
+	killScanCount    = 100
+)
+
+// KillSwitchKey 開關鍵；global 不帶名稱
+func KillSwitchKey(scope, name string) string {
+	if scope == KillScopeGlobal {
+		return killSwitchPrefix + KillScopeGlobal
+	}
+	return killSwitchPrefix + scope + ":" + name
+}
+
+// ValidKillScope 檢查範圍與名稱（strategy/symbol 需要名稱）
+func ValidKillScope(scope, name string) error {
+	switch scope {
+	case KillScopeGlobal:
+		return nil
+	case KillScopeStrategy, KillScopeSymbol:
+		if name == "" {
+			return fmt.Errorf("kill switch scope %s requires a name", scope)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown kill switch scope %q", scope)
+}
+
+// KillSwitch 已啟動的開關；啟動期間停止新進場，既有持倉仍可出場
+type KillSwitch struct {
+	Scope     string `json:"scope"`
+	Name      string `json:"name,omitempty"`
+	Reason    string `json:"reason"`
+	ExpiresAt int64  `json:"expires_at,omitempty"` // 毫秒；0 為不過期
+}
+
+// Key 開關鍵
+func (k KillSwitch) Key() string {
+	return KillSwitchKey(k.Scope, k.Name)
+}
+
+func parseKillSwitchKey(key string) (scope, name string, ok bool) {
+	rest := strings.TrimPrefix(key, killSwitchPrefix)
+	if rest == key {
+		return "", "", false
+	}
+	if rest == KillScopeGlobal {
+		return KillScopeGlobal, "", true
+	}
+	scope, name, ok = strings.Cut(rest, ":")
+	if !ok || ValidKillScope(scope, name) != nil {
+		return "", "", false
+	}
+	return scope, name, true
+}
+
+// KillSwitchStore 開關狀態；ttl 為 0 時不過期
+type KillSwitchStore interface {
+	// Lookup 回傳 keys 中已啟動者（鍵 → 原因）
+	Lookup(ctx context.Context, keys []string) (map[string]string, error)
+	Set(ctx context.Context, k KillSwitch, ttl time.Duration) error
+	Clear(ctx context.Context, scope, name string) (bool, error)
+	List(ctx context.Context) ([]KillSwitch, error)
+}
+
+// RedisKillSwitchStore 每個開關一個字串鍵；鍵分屬不同槽位，以管線逐鍵讀取（不使用 MGET）
+type RedisKillSwitchStore struct {
+	client redis.Cmdable
+}
+
+func NewRedisKillSwitchStore(client redis.Cmdable) *RedisKillSwitchStore {
+	return &RedisKillSwitchStore{client: client}
+}
+
+func (s *RedisKillSwitchStore) Lookup(ctx context.Context, keys []string) (map[string]string, error) {
+	pipe := s.client.Pipeline()
+	cmds := make([]*redis.StringCmd, len(keys))
+	for i, key := range keys {
+		cmds[i] = pipe.Get(ctx, key)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+	active := make(map[string]string)
+	for i, cmd := range cmds {
+		reason, err := cmd.Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		active[keys[i]] = reason
+	}
+	return active, nil
+}
+
+func (s *RedisKillSwitchStore) Set(ctx context.Context, k KillSwitch, ttl time.Duration) error {
+	return s.client.Set(ctx, k.Key(), k.Reason, ttl).Err()
+}
+
+func (s *RedisKillSwitchStore) Clear(ctx context.Context, scope, name string) (bool, error) {
+	n, err := s.client.Del(ctx, KillSwitchKey(scope, name)).Result()
+	return n > 0, err
+}
+
+// List 掃描 kill_switch:* 並讀取原因與剩餘 TTL；叢集模式需逐一掃描主節點
+func (s *RedisKillSwitchStore) List(ctx context.Context) ([]KillSwitch, error) {
+	keys, err := s.scanKeys(ctx)
+	if err != nil || len(keys) == 0 {
+		return nil, err
+	}
+	pipe := s.client.Pipeline()
+	gets := make([]*redis.StringCmd, len(keys))
+	ttls := make([]*redis.DurationCmd, len(keys))
+	for i, key := range keys {
+		gets[i] = pipe.Get(ctx, key)
+		ttls[i] = pipe.PTTL(ctx, key)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+	now := time.Now()
+	var switches []KillSwitch
+	for i, key := range keys {
+		scope, name, ok := parseKillSwitchKey(key)
+		reason, err := gets[i].Result()
+		if !ok || err != nil {
+			continue // 非開關鍵或掃描後已過期
+		}
+		k := KillSwitch{Scope: scope, Name: name, Reason: reason}
+		if ttl := ttls[i].Val(); ttl > 0 {
+			k.ExpiresAt = now.Add(ttl).UnixMilli()
+		}
+		switches = append(switches, k)
+	}
+	sortKillSwitches(switches)
+	return switches, nil
+}
+
+func (s *RedisKillSwitchStore) scanKeys(ctx context.Context) ([]string, error) {
+	scan := func(ctx context.Context, client redis.Cmdable) ([]string, error) {
+		var keys []string
+		var cursor uint64
+		for {
+			batch, next, err := client.Scan(ctx, cursor, killSwitchPrefix+"*", killScanCount).Result()
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, batch...)
+			if cursor = next; cursor == 0 {
+				return keys, nil
+			}
+		}
+	}
+	cluster, ok := s.client.(*redis.ClusterClient)
+	if !ok {
+		return scan(ctx, s.client)
+	}
+	var mu sync.Mutex
+	var keys []string
+	err := cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+		batch, err := scan(ctx, node)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		keys = append(keys, batch...)
+		mu.Unlock()
+		return nil
+	})
+	return keys, err
+}
+
+// MemoryKillSwitchStore 記憶體實作（Redis 未連線與測試使用，僅適用單一副本）
+type MemoryKillSwitchStore struct {
+	mu       sync.Mutex
+	switches map[string]KillSwitch
+	now      func() time.Time
+}
+
+func NewMemoryKillSwitchStore() *MemoryKillSwitchStore {
+	return &MemoryKillSwitchStore{switches: make(map[string]KillSwitch), now: time.Now}
+}
+
+func (s *MemoryKillSwitchStore) Lookup(ctx context.Context, keys []string) (map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.purge()
+	active := make(map[string]string)
+	for _, key := range keys {
+		if k, ok := s.switches[key]; ok {
+			active[key] = k.Reason
+		}
+	}
+	return active, nil
+}
+
+func (s *MemoryKillSwitchStore) Set(ctx context.Context, k KillSwitch, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k.ExpiresAt = 0
+	if ttl > 0 {
+		k.ExpiresAt = s.now().Add(ttl).UnixMilli()
+	}
+	s.switches[k.Key()] = k
+	return nil
+}
+
+func (s *MemoryKillSwitchStore) Clear(ctx context.Context, scope, name string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.purge()
+	key := KillSwitchKey(scope, name)
+	_, ok := s.switches[key]
+	delete(s.switches, key)
+	return ok, nil
+}
+
+func (s *MemoryKillSwitchStore) List(ctx context.Context) ([]KillSwitch, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.purge()
+	switches := make([]KillSwitch, 0, len(s.switches))
+	for _, k := range s.switches {
+		switches = append(switches, k)
+	}
+	sortKillSwitches(switches)
+	return switches, nil
+}
+
+func (s *MemoryKillSwitchStore) purge() {
+	now := s.now().UnixMilli()
+	for key, k := range s.switches {
+		if k.ExpiresAt > 0 && k.ExpiresAt <= now {
+			delete(s.switches, key)
+		}
+	}
+}
+
+func sortKillSwitches(switches []KillSwitch) {
+	sort.Slice(switches, func(i, j int) bool {
+		return switches[i].Key() < switches[j].Key()
+	})
+}
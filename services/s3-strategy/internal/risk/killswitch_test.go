@@ -0,0 +1,54 @@
+package risk
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryKillSwitchStore(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	store := NewMemoryKillSwitchStore()
+	store.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	store.Set(ctx, KillSwitch{Scope: KillScopeGlobal, Reason: "exchange maintenance"}, 0)
+	store.Set(ctx, KillSwitch{Scope: KillScopeSymbol, Name: "BTCUSDT", Reason: "drawdown"}, time.Minute)
+
+	keys := []string{KillSwitchKey(KillScopeGlobal, ""), KillSwitchKey(KillScopeStrategy, "rules"), KillSwitchKey(KillScopeSymbol, "BTCUSDT")}
+	active, _ := store.Lookup(ctx, keys)
+	if len(active) != 2 || active["kill_switch:global"] != "exchange maintenance" || active["kill_switch:symbol:BTCUSDT"] != "drawdown" {
+		t.Errorf("active = %v", active)
+	}
+
+	// TTL 到期自動解除
+	now = now.Add(2 * time.Minute)
+	if switches, _ := store.List(ctx); len(switches) != 1 || switches[0].Scope != KillScopeGlobal {
+		t.Errorf("after expiry = %+v", switches)
+	}
+	if cleared, _ := store.Clear(ctx, KillScopeGlobal, ""); !cleared {
+		t.Error("clear should report the switch")
+	}
+	if active, _ := store.Lookup(ctx, keys); len(active) != 0 {
+		t.Errorf("after clear = %v", active)
+	}
+}
+
+func TestParseKillSwitchKey(t *testing.T) {
+	cases := []struct {
+		key, scope, name string
+		ok               bool
+	}{
+		{"kill_switch:global", KillScopeGlobal, "", true},
+		{"kill_switch:strategy:ew_4h", KillScopeStrategy, "ew_4h", true},
+		{"kill_switch:symbol:BTCUSDT", KillScopeSymbol, "BTCUSDT", true},
+		{"kill_switch:venue:binance", "", "", false},
+		{"kill_switch:strategy:", "", "", false},
+		{"risk:budget:fut_margin:inuse", "", "", false},
+	}
+	for _, c := range cases {
+		if scope, name, ok := parseKillSwitchKey(c.key); scope != c.scope || name != c.name || ok != c.ok {
+			t.Errorf("parseKillSwitchKey(%q) = %q %q %v", c.key, scope, name, ok)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package risk
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Ledger 單一鍵上的暫占帳本：每筆暫占以 intent_id 為欄位，附數量與到期時間；
+// 到期未釋放的暫占（意圖未送出）於下次存取時清除。
+type Ledger interface {
+	// Reserve 在 limit 內暫占 amount；同一 id 重複暫占視為更新（不重複計入）
+	Reserve(ctx context.Context, key, id string, amount, limit float64, ttl time.Duration) (bool, float64, error)
+	// Release 釋放暫占；id 不存在時回傳 false
+	Release(ctx context.Context, key, id string) (bool, error)
+	// Usage 目前有效暫占總量
+	Usage(ctx context.Context, key string) (float64, error)
+}
+
+// parseEntry 解析欄位值 <amount>:<expires_at_ms>
+func parseEntry(value string) (float64, int64, error) {
+	parts := strings.SplitN(value, ":", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("malformed reservation %q", value)
+	}
+	amount, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("malformed reservation %q: %w", value, err)
+	}
+	expiresAt, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("malformed reservation %q: %w", value, err)
+	}
+	return amount, expiresAt, nil
+}
+
+// reserveScript 清除過期暫占後檢查額度並寫入；整個鍵在 TTL 內無新暫占時自動過期。
+// ARGV: id、數量、上限、現在毫秒、TTL 毫秒；回傳 {1|0, 暫占後總量}
+var reserveScript = redis.NewScript(`
+local now = tonumber(ARGV[4])
+local entries = redis.call('HGETALL', KEYS[1])
+local inuse = 0
+local maxexp = 0
+for i = 1, #entries, 2 do
+  local amt, exp = string.match(entries[i + 1], '^([^:]+):(%d+)$')
+  amt = tonumber(amt) or 0
+  exp = tonumber(exp) or 0
+  if exp <= now then
+    redis.call('HDEL', KEYS[1], entries[i])
+  elseif entries[i] ~= ARGV[1] then
+    inuse = inuse + amt
+    if exp > maxexp then maxexp = exp end
+  end
+end
+local amount = tonumber(ARGV[2])
+if inuse + amount > tonumber(ARGV[3]) + 1e-9 then
+  return {0, tostring(inuse)}
+end
+local exp = now + tonumber(ARGV[5])
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[2] .. ':' .. exp)
+if exp > maxexp then maxexp = exp end
+redis.call('PEXPIREAT', KEYS[1], maxexp)
+return {1, tostring(inuse + amount)}
+`)
+
+var releaseScript = redis.NewScript(`
+return redis.call('HDEL', KEYS[1], ARGV[1])
+`)
+
+// RedisLedger 以 Redis Hash 保存暫占；每次暫占為單鍵 Lua 腳本，多副本併發也不會超額
+type RedisLedger struct {
+	client redis.Cmdable
+}
+
+func NewRedisLedger(client redis.Cmdable) *RedisLedger {
+	return &RedisLedger{client: client}
+}
+
+func (l *RedisLedger) Reserve(ctx context.Context, key, id string, amount, limit float64, ttl time.Duration) (bool, float64, error) {
+	now := time.Now().UnixMilli()
+	res, err := reserveScript.Run(ctx, l.client, []string{key},
+		id, strconv.FormatFloat(amount, 'f', -1, 64), limit, now, ttl.Milliseconds()).Slice()
+	if err != nil {
+		return false, 0, err
+	}
+	if len(res) != 2 {
+		return false, 0, fmt.Errorf("unexpected reserve result %v", res)
+	}
+	ok, _ := res[0].(int64)
+	inuse, _ := strconv.ParseFloat(fmt.Sprint(res[1]), 64)
+	return ok == 1, inuse, nil
+}
+
+func (l *RedisLedger) Release(ctx context.Context, key, id string) (bool, error) {
+	n, err := releaseScript.Run(ctx, l.client, []string{key}, id).Int()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (l *RedisLedger) Usage(ctx context.Context, key string) (float64, error) {
+	entries, err := l.client.HGetAll(ctx, key).Result()
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now().UnixMilli()
+	var inuse float64
+	for _, value := range entries {
+		amount, expiresAt, err := parseEntry(value)
+		if err != nil {
+			return 0, err
+		}
+		if expiresAt > now {
+			inuse += amount
+		}
+	}
+	return inuse, nil
+}
+
+type memoryEntry struct {
+	amount    float64
+	expiresAt time.Time
+}
+
+// MemoryLedger 記憶體實作（Redis 未連線與測試使用，僅適用單一副本）
+type MemoryLedger struct {
+	mu      sync.Mutex
+	entries map[string]map[string]memoryEntry
+	now     func() time.Time
+}
+
+func NewMemoryLedger() *MemoryLedger {
+	return &MemoryLedger{entries: make(map[string]map[string]memoryEntry), now: time.Now}
+}
+
+// purge 清除過期暫占並回傳其餘總量（排除 skipID）
+func (l *MemoryLedger) purge(key, skipID string) float64 {
+	now := l.now()
+	var inuse float64
+	for id, entry := range l.entries[key] {
+		if !entry.expiresAt.After(now) {
+			delete(l.entries[key], id)
+		} else if id != skipID {
+			inuse += entry.amount
+		}
+	}
+	return inuse
+}
+
+func (l *MemoryLedger) Reserve(ctx context.Context, key, id string, amount, limit float64, ttl time.Duration) (bool, float64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	inuse := l.purge(key, id)
+	if inuse+amount > limit+1e-9 {
+		return false, inuse, nil
+	}
+	if l.entries[key] == nil {
+		l.entries[key] = make(map[string]memoryEntry)
+	}
+	l.entries[key][id] = memoryEntry{amount: amount, expiresAt: l.now().Add(ttl)}
+	return true, inuse + amount, nil
+}
+
+func (l *MemoryLedger) Release(ctx context.Context, key, id string) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.entries[key][id]; !ok {
+		return false, nil
+	}
+	delete(l.entries[key], id)
+	return true, nil
+}
+
+func (l *MemoryLedger) Usage(ctx context.Context, key string) (float64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.purge(key, ""), nil
+}
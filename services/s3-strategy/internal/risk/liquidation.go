@@ -0,0 +1,42 @@
+package risk
+
+import "math"
+
+// IsolatedPosition 逐倉 USDT 永續持倉（Dir 多 +1、空 -1）
+type IsolatedPosition struct {
+	Dir        float64
+	EntryPx    float64
+	Qty        float64
+	MarginUSDT float64 // 逐倉保證金
+}
+
+// LiquidationPrice 權益降至維持保證金時的價格：M + dir·(P − E)·Q = mmr·P·Q，
+// 即 P_liq = (dir·E·Q − M) / (Q·(dir − mmr))；多倉（含 1 倍）無強平價時回傳 0
+func (p IsolatedPosition) LiquidationPrice(mmr float64) float64 {
+	if p.Qty <= 0 || p.EntryPx <= 0 {
+		return 0
+	}
+	liq := (p.Dir*p.EntryPx*p.Qty - p.MarginUSDT) / (p.Qty * (p.Dir - mmr))
+	return math.Max(liq, 0)
+}
+
+// PnL 未實現損益 (P − E)·Q·dir
+func (p IsolatedPosition) PnL(mark float64) float64 {
+	return (mark - p.EntryPx) * p.Qty * p.Dir
+}
+
+// ROE 未實現損益 ÷ 逐倉保證金；保證金未知時回傳 0
+func (p IsolatedPosition) ROE(mark float64) float64 {
+	if p.MarginUSDT <= 0 {
+		return 0
+	}
+	return p.PnL(mark) / p.MarginUSDT
+}
+
+// LiquidationBuffer 強平緩衝 LB = |mark − liq| / mark；標記價已越過強平價時為 0
+func (p IsolatedPosition) LiquidationBuffer(mark, mmr float64) float64 {
+	if mark <= 0 {
+		return 0
+	}
+	return math.Max(p.Dir*(mark-p.LiquidationPrice(mmr))/mark, 0)
+}
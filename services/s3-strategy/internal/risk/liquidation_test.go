@@ -0,0 +1,42 @@
+package risk
+
+import (
+	"math"
+	"testing"
+)
+
+func TestIsolatedPosition(t *testing.T) {
+	const mmr = 0.005
+	near := func(a, b float64) bool { return math.Abs(a-b) < 1e-6 }
+
+	// 20 倍多倉：E 60000、Q 0.1、M 300 → P_liq = (6000 − 300) / (0.1 × 0.995)
+	long := IsolatedPosition{Dir: 1, EntryPx: 60000, Qty: 0.1, MarginUSDT: 300}
+	liq := long.LiquidationPrice(mmr)
+	if !near(liq, 5700/0.0995) {
+		t.Fatalf("long liq = %v", liq)
+	}
+	if lb := long.LiquidationBuffer(58000, mmr); !near(lb, (58000-liq)/58000) {
+		t.Errorf("long buffer = %v", lb)
+	}
+	if lb := long.LiquidationBuffer(liq-1, mmr); lb != 0 {
+		t.Errorf("crossed buffer = %v", lb)
+	}
+	if roe := long.ROE(58500); !near(roe, -0.5) {
+		t.Errorf("long roe = %v", roe)
+	}
+
+	// 空倉對稱換號：P_liq = (E·Q + M) / (Q·(1 + mmr))
+	short := IsolatedPosition{Dir: -1, EntryPx: 60000, Qty: 0.1, MarginUSDT: 300}
+	if liq := short.LiquidationPrice(mmr); !near(liq, 6300/0.1005) {
+		t.Errorf("short liq = %v", liq)
+	}
+	if roe := short.ROE(57000); !near(roe, 1) {
+		t.Errorf("short roe = %v", roe)
+	}
+
+	// 1 倍多倉沒有強平價
+	spotLike := IsolatedPosition{Dir: 1, EntryPx: 60000, Qty: 0.1, MarginUSDT: 6000}
+	if liq := spotLike.LiquidationPrice(mmr); liq != 0 || spotLike.LiquidationBuffer(30000, mmr) != 1 {
+		t.Errorf("1x liq = %v", liq)
+	}
+}
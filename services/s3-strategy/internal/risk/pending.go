@@ -0,0 +1,129 @@
+package risk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"s3-strategy/dao"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// PendingKey 已暫占、尚未回報終態的入場曝險（組合層檢查讀取）
+const PendingKey = "risk:portfolio:pending"
+
+// Pending 單一入場意圖的方向與名義金額；與預算暫占同時建立、同時釋放
+type Pending struct {
+	IntentID     string      `json:"intent_id"`
+	Strategy     string      `json:"strategy"`
+	Symbol       string      `json:"symbol"`
+	Side         dao.PosSide `json:"side"`
+	NotionalUSDT float64     `json:"notional_usdt"`
+	Score        float64     `json:"score,omitempty"`
+	ExpiresAt    int64       `json:"expires_at"` // 毫秒；逾期視為意圖未送出
+}
+
+// PendingBook 未成交入場曝險；同一 intent_id 重複加入視為更新
+type PendingBook interface {
+	Add(ctx context.Context, p Pending, ttl time.Duration) error
+	Remove(ctx context.Context, intentID string) (bool, error)
+	List(ctx context.Context) ([]Pending, error)
+}
+
+// RedisPendingBook 以 Redis Hash 保存（欄位 intent_id、值為 JSON）；整個鍵在 TTL 內無新增時自動過期
+type RedisPendingBook struct {
+	client redis.Cmdable
+}
+
+func NewRedisPendingBook(client redis.Cmdable) *RedisPendingBook {
+	return &RedisPendingBook{client: client}
+}
+
+func (b *RedisPendingBook) Add(ctx context.Context, p Pending, ttl time.Duration) error {
+	p.ExpiresAt = time.Now().Add(ttl).UnixMilli()
+	payload, err := json.Marshal(&p)
+	if err != nil {
+		return err
+	}
+	pipe := b.client.TxPipeline()
+	pipe.HSet(ctx, PendingKey, p.IntentID, payload)
+	pipe.PExpire(ctx, PendingKey, ttl)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func (b *RedisPendingBook) Remove(ctx context.Context, intentID string) (bool, error) {
+	n, err := b.client.HDel(ctx, PendingKey, intentID).Result()
+	return n > 0, err
+}
+
+// List 回傳未過期者；過期欄位順手清除
+func (b *RedisPendingBook) List(ctx context.Context) ([]Pending, error) {
+	entries, err := b.client.HGetAll(ctx, PendingKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UnixMilli()
+	var pending []Pending
+	var expired []string
+	for id, value := range entries {
+		var p Pending
+		if err := json.Unmarshal([]byte(value), &p); err != nil {
+			return nil, fmt.Errorf("malformed pending exposure %s: %w", id, err)
+		}
+		if p.ExpiresAt <= now {
+			expired = append(expired, id)
+			continue
+		}
+		pending = append(pending, p)
+	}
+	if len(expired) > 0 {
+		b.client.HDel(ctx, PendingKey, expired...)
+	}
+	return pending, nil
+}
+
+// MemoryPendingBook 記憶體實作（Redis 未連線與測試使用，僅適用單一副本）
+type MemoryPendingBook struct {
+	mu      sync.Mutex
+	entries map[string]Pending
+	now     func() time.Time
+}
+
+func NewMemoryPendingBook() *MemoryPendingBook {
+	return &MemoryPendingBook{entries: make(map[string]Pending), now: time.Now}
+}
+
+func (b *MemoryPendingBook) Add(ctx context.Context, p Pending, ttl time.Duration) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	p.ExpiresAt = b.now().Add(ttl).UnixMilli()
+	b.entries[p.IntentID] = p
+	return nil
+}
+
+func (b *MemoryPendingBook) Remove(ctx context.Context, intentID string) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, ok := b.entries[intentID]
+	delete(b.entries, intentID)
+	return ok, nil
+}
+
+func (b *MemoryPendingBook) List(ctx context.Context) ([]Pending, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now().UnixMilli()
+	pending := make([]Pending, 0, len(b.entries))
+	for id, p := range b.entries {
+		if p.ExpiresAt <= now {
+			delete(b.entries, id)
+			continue
+		}
+		pending = append(pending, p)
+	}
+	return pending, nil
+}
@@ -0,0 +1,44 @@
+package risk
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"s3-strategy/dao"
+)
+
+func TestMemoryPendingBook(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	book := NewMemoryPendingBook()
+	book.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	book.Add(ctx, Pending{IntentID: "i1", Strategy: "rules", Symbol: "BTCUSDT", Side: dao.PosLong, NotionalUSDT: 1000}, time.Minute)
+	book.Add(ctx, Pending{IntentID: "i2", Strategy: "rules", Symbol: "ETHUSDT", Side: dao.PosShort, NotionalUSDT: 500}, 2*time.Minute)
+	// 同一 intent 重複加入視為更新
+	book.Add(ctx, Pending{IntentID: "i1", Strategy: "rules", Symbol: "BTCUSDT", Side: dao.PosLong, NotionalUSDT: 800}, time.Minute)
+
+	pending, _ := book.List(ctx)
+	if len(pending) != 2 {
+		t.Fatalf("pending = %+v", pending)
+	}
+	for _, p := range pending {
+		if p.IntentID == "i1" && p.NotionalUSDT != 800 {
+			t.Errorf("updated entry = %+v", p)
+		}
+	}
+
+	// 逾期者不列出
+	now = now.Add(90 * time.Second)
+	if pending, _ := book.List(ctx); len(pending) != 1 || pending[0].IntentID != "i2" {
+		t.Errorf("after expiry = %+v", pending)
+	}
+
+	if removed, _ := book.Remove(ctx, "i2"); !removed {
+		t.Error("remove should report the entry")
+	}
+	if removed, _ := book.Remove(ctx, "i2"); removed {
+		t.Error("second remove should be a no-op")
+	}
+}
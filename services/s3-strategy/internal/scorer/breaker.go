@@ -0,0 +1,99 @@
+package scorer
+
+import (
+	"sync"
+	"time"
+)
+
+// BreakerState 斷路器狀態
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "CLOSED"
+	BreakerOpen     BreakerState = "OPEN"
+	BreakerHalfOpen BreakerState = "HALF_OPEN"
+)
+
+// Breaker 連續失敗達門檻即開啟；冷卻後放行單一試探請求，成功關閉、失敗重新開啟
+type Breaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	state     BreakerState
+	failures  int
+	openedAt  time.Time
+	probing   bool
+	now       func() time.Time
+	onChange  func(from, to BreakerState)
+}
+
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+	if threshold <= 0 {
+		threshold = 1
+	}
+	return &Breaker{threshold: threshold, cooldown: cooldown, state: BreakerClosed, now: time.Now}
+}
+
+// OnStateChange 狀態轉換回呼（於鎖外呼叫）
+func (b *Breaker) OnStateChange(fn func(from, to BreakerState)) {
+	b.mu.Lock()
+	b.onChange = fn
+	b.mu.Unlock()
+}
+
+// State 目前狀態
+func (b *Breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Allow 是否放行請求；半開狀態僅放行一個試探請求
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	from := b.state
+	allowed := true
+	switch b.state {
+	case BreakerOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			allowed = false
+			break
+		}
+		b.state = BreakerHalfOpen
+		b.probing = true
+	case BreakerHalfOpen:
+		if b.probing {
+			allowed = false
+		} else {
+			b.probing = true
+		}
+	}
+	to, fn := b.state, b.onChange
+	b.mu.Unlock()
+	if fn != nil && from != to {
+		fn(from, to)
+	}
+	return allowed
+}
+
+// Record 回報請求結果
+func (b *Breaker) Record(success bool) {
+	b.mu.Lock()
+	from := b.state
+	if success {
+		b.failures = 0
+		b.state = BreakerClosed
+	} else {
+		b.failures++
+		if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+			b.state = BreakerOpen
+			b.openedAt = b.now()
+		}
+	}
+	b.probing = false
+	to, fn := b.state, b.onChange
+	b.mu.Unlock()
+	if fn != nil && from != to {
+		fn(from, to)
+	}
+}
@@ -0,0 +1,169 @@
+package scorer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"time"
+)
+
+// HTTPConfig 遠端推論服務設定
+type HTTPConfig struct {
+	URL        string
+	Timeout    time.Duration // 單次呼叫（含對沖）總期限
+	HedgeAfter time.Duration // 首個請求逾此時間未回應即送出對沖請求；0 不對沖
+	Breaker    *Breaker
+	Client     *http.Client
+}
+
+// HTTPScorer 呼叫 POST <url>，請求為 Request JSON；回應需含 probability（或 confidence_score）
+type HTTPScorer struct {
+	cfg HTTPConfig
+}
+
+func NewHTTPScorer(cfg HTTPConfig) *HTTPScorer {
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{}
+	}
+	return &HTTPScorer{cfg: cfg}
+}
+
+// Breaker 斷路器（未設定時為 nil）
+func (s *HTTPScorer) Breaker() *Breaker {
+	return s.cfg.Breaker
+}
+
+type httpResponse struct {
+	Probability     *float64           `json:"probability"`
+	ConfidenceScore *float64           `json:"confidence_score"`
+	Confidence      *float64           `json:"confidence"`
+	Model           string             `json:"model"`
+	Version         string             `json:"version"`
+	Contributions   map[string]float64 `json:"contributions"`
+}
+
+type attempt struct {
+	res Result
+	err error
+}
+
+// Score 於期限內取得第一個成功回應；首個請求慢於 HedgeAfter 時再送一個，兩者取先成功者
+func (s *HTTPScorer) Score(ctx context.Context, req Request) (Result, error) {
+	if s.cfg.Breaker != nil && !s.cfg.Breaker.Allow() {
+		return Result{}, ErrCircuitOpen
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return Result{}, err
+	}
+	if s.cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.cfg.Timeout)
+		defer cancel()
+	}
+	// 取得結果後取消其餘在途請求
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan attempt, 2)
+	launch := func() {
+		go func() {
+			res, err := s.call(ctx, body)
+			results <- attempt{res, err}
+		}()
+	}
+	launch()
+	inflight := 1
+
+	var hedge <-chan time.Time
+	if s.cfg.HedgeAfter > 0 {
+		timer := time.NewTimer(s.cfg.HedgeAfter)
+		defer timer.Stop()
+		hedge = timer.C
+	}
+
+	var lastErr error
+	for {
+		select {
+		case <-hedge:
+			hedge = nil
+			launch()
+			inflight++
+		case a := <-results:
+			inflight--
+			if a.err == nil {
+				s.record(true)
+				return a.res, nil
+			}
+			lastErr = a.err
+			// 首個請求已失敗且尚未對沖：立即對沖一次
+			if hedge != nil {
+				hedge = nil
+				launch()
+				inflight++
+				continue
+			}
+			if inflight == 0 {
+				s.record(false)
+				return Result{}, lastErr
+			}
+		case <-ctx.Done():
+			s.record(false)
+			if lastErr != nil {
+				return Result{}, fmt.Errorf("%w (last error: %v)", ctx.Err(), lastErr)
+			}
+			return Result{}, ctx.Err()
+		}
+	}
+}
+
+func (s *HTTPScorer) record(success bool) {
+	if s.cfg.Breaker != nil {
+		s.cfg.Breaker.Record(success)
+	}
+}
+
+func (s *HTTPScorer) call(ctx context.Context, body []byte) (Result, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, s.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return Result{}, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.cfg.Client.Do(httpReq)
+	if err != nil {
+		return Result{}, err
+	}
+	defer resp.Body.Close()
+	payload, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return Result{}, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return Result{}, fmt.Errorf("model service returned %d: %s", resp.StatusCode, bytes.TrimSpace(payload))
+	}
+
+	var out httpResponse
+	if err := json.Unmarshal(payload, &out); err != nil {
+		return Result{}, fmt.Errorf("invalid model service response: %w", err)
+	}
+	p := out.Probability
+	if p == nil {
+		p = out.ConfidenceScore
+	}
+	if p == nil || *p < 0 || *p > 1 {
+		return Result{}, fmt.Errorf("model service response has no probability in [0, 1]")
+	}
+	res := Result{Probability: *p, Model: out.Model, Version: out.Version, Contributions: out.Contributions}
+	if out.Confidence != nil {
+		res.Confidence = *out.Confidence
+	} else {
+		res.Confidence = 2 * math.Abs(*p-0.5)
+	}
+	return res, nil
+}
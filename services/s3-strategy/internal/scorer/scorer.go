@@ -0,0 +1,39 @@
+// Package scorer 定義 L2 置信度模型的呼叫介面，以及模型即服務（HTTP/JSON）的用戶端。
+package scorer
+
+import (
+	"context"
+	"errors"
+)
+
+// Request 評分請求
+type Request struct {
+	SignalID string                 `json:"signal_id"`
+	Symbol   string                 `json:"symbol"`
+	Features map[string]interface{} `json:"features"`
+}
+
+// Result 評分結果
+type Result struct {
+	Probability float64 `json:"probability"`
+	Confidence  float64 `json:"confidence"`
+	Model       string  `json:"model,omitempty"`
+	Version     string  `json:"version,omitempty"`
+	// Contributions 特徵 → 對分數的貢獻（服務有提供時）
+	Contributions map[string]float64 `json:"contributions,omitempty"`
+}
+
+// Scorer 可替換的模型評分實作（本地樹模型或遠端推論服務）
+type Scorer interface {
+	Score(ctx context.Context, req Request) (Result, error)
+}
+
+// Func 以函式實作 Scorer
+type Func func(ctx context.Context, req Request) (Result, error)
+
+func (f Func) Score(ctx context.Context, req Request) (Result, error) {
+	return f(ctx, req)
+}
+
+// ErrCircuitOpen 斷路器開啟中，請求未送出
+var ErrCircuitOpen = errors.New("model service circuit open")
@@ -0,0 +1,141 @@
+package scorer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHTTPScorer_Success(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req Request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Symbol != "BTCUSDT" || req.Features["rsi"] != 55.0 {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		// 相容文件範例的 confidence_score 欄位
+		w.Write([]byte(`{"confidence_score": 0.8, "model": "xgb", "version": "v3"}`))
+	}))
+	defer srv.Close()
+
+	s := NewHTTPScorer(HTTPConfig{URL: srv.URL, Timeout: time.Second})
+	res, err := s.Score(context.Background(), Request{Symbol: "BTCUSDT", Features: map[string]interface{}{"rsi": 55.0}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Probability != 0.8 || res.Version != "v3" || res.Confidence < 0.6-1e-12 || res.Confidence > 0.6+1e-12 {
+		t.Errorf("result = %+v", res)
+	}
+}
+
+func TestHTTPScorer_HedgeWins(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		if atomic.AddInt32(&calls, 1) == 1 {
+			// 首個請求卡住，直到被取消
+			select {
+			case <-r.Context().Done():
+			case <-time.After(2 * time.Second):
+			}
+			return
+		}
+		w.Write([]byte(`{"probability": 0.7}`))
+	}))
+	defer srv.Close()
+
+	s := NewHTTPScorer(HTTPConfig{URL: srv.URL, Timeout: time.Second, HedgeAfter: 20 * time.Millisecond})
+	start := time.Now()
+	res, err := s.Score(context.Background(), Request{Symbol: "BTCUSDT"})
+	if err != nil || res.Probability != 0.7 {
+		t.Fatalf("hedged score: %+v %v", res, err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("hedge did not short-circuit the slow request: %s", elapsed)
+	}
+	if atomic.LoadInt32(&calls) != 2 {
+		t.Errorf("calls = %d, want 2", calls)
+	}
+}
+
+func TestHTTPScorer_DeadlineAndBreaker(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		atomic.AddInt32(&calls, 1)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer srv.Close()
+
+	breaker := NewBreaker(2, time.Minute)
+	var transitions []BreakerState
+	breaker.OnStateChange(func(from, to BreakerState) { transitions = append(transitions, to) })
+	s := NewHTTPScorer(HTTPConfig{URL: srv.URL, Timeout: 30 * time.Millisecond, Breaker: breaker})
+
+	for i := 0; i < 2; i++ {
+		if _, err := s.Score(context.Background(), Request{}); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("call %d: expected deadline exceeded, got %v", i, err)
+		}
+	}
+	if breaker.State() != BreakerOpen {
+		t.Fatalf("breaker state = %s, want OPEN", breaker.State())
+	}
+	if _, err := s.Score(context.Background(), Request{}); err != ErrCircuitOpen {
+		t.Errorf("expected ErrCircuitOpen, got %v", err)
+	}
+	if atomic.LoadInt32(&calls) != 2 {
+		t.Errorf("open breaker must not send requests, calls = %d", calls)
+	}
+	if len(transitions) != 1 || transitions[0] != BreakerOpen {
+		t.Errorf("transitions = %v", transitions)
+	}
+}
+
+func TestHTTPScorer_InvalidResponse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"probability": 1.7}`))
+	}))
+	defer srv.Close()
+
+	s := NewHTTPScorer(HTTPConfig{URL: srv.URL, Timeout: time.Second})
+	if _, err := s.Score(context.Background(), Request{}); err == nil {
+		t.Error("expected out-of-range probability to be rejected")
+	}
+}
+
+func TestBreaker_HalfOpen(t *testing.T) {
+	now := time.Unix(0, 0)
+	b := NewBreaker(1, 10*time.Second)
+	b.now = func() time.Time { return now }
+
+	b.Record(false)
+	if b.Allow() {
+		t.Fatal("open breaker must reject")
+	}
+
+	// 冷卻後僅放行一個試探請求
+	now = now.Add(10 * time.Second)
+	if !b.Allow() || b.Allow() {
+		t.Fatal("half-open breaker must allow exactly one probe")
+	}
+	b.Record(false)
+	if b.State() != BreakerOpen || b.Allow() {
+		t.Fatal("failed probe must reopen the breaker")
+	}
+
+	now = now.Add(10 * time.Second)
+	b.Allow()
+	b.Record(true)
+	if b.State() != BreakerClosed || !b.Allow() || !b.Allow() {
+		t.Error("successful probe must close the breaker")
+	}
+}
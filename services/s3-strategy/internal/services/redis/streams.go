@@ -42,18 +42,52 @@ func (r *RedisClient) ConsumeStream(ctx context.Context, streamName, groupName,
 	return streams, nil
 }
 
+// ReadStream reads messages after lastID without a consumer group (every reader sees every message)
+func (r *RedisClient) ReadStream(ctx context.Context, streamName, lastID string, count int64, block time.Duration) ([]redis.XStream, error) {
+	streams, err := r.Client.XRead(ctx, &redis.XReadArgs{
+		Streams: []string{streamName, lastID},
+		Count:   count,
+		Block:   block,
+	}).Result()
+	if err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to read stream %s: %w", streamName, err)
+	}
+	return streams, nil
+}
+
 // CreateConsumerGroup creates a consumer group for a given stream
 func (r *RedisClient) CreateConsumerGroup(ctx context.Context, streamName, groupName string) error {
-	_, err := r.Client.XGroupCreateMkStream(ctx, streamName, groupName, "0").Result()
+	return r.CreateConsumerGroupFrom(ctx, streamName, groupName, "0")
+}
+
+// CreateConsumerGroupFrom creates a consumer group starting at the given ID ("0" for history, "$" for new messages only)
+func (r *RedisClient) CreateConsumerGroupFrom(ctx context.Context, streamName, groupName, start string) error {
+	_, err := r.Client.XGroupCreateMkStream(ctx, streamName, groupName, start).Result()
 	if err != nil && !strings.Contains(err.Error(), "BUSYGROUP") {
 		return fmt.Errorf("failed to create consumer group %s for stream %s: %w", groupName, streamName, err)
 	}
-	if strings.Contains(err.Error(), "BUSYGROUP") {
+	if err != nil {
 		log.Printf("Consumer group %s already exists for stream %s", groupName, streamName)
 	}
 	return nil
 }
 
+// ClaimPending transfers messages pending longer than minIdle to consumer (crash recovery)
+func (r *RedisClient) ClaimPending(ctx context.Context, streamName, groupName, consumerName string, minIdle time.Duration, count int64) ([]redis.XMessage, error) {
+	messages, _, err := r.Client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream:   streamName,
+		Group:    groupName,
+		Consumer: consumerName,
+		MinIdle:  minIdle,
+		Start:    "0-0",
+		Count:    count,
+	}).Result()
+	if err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to claim pending messages on %s: %w", streamName, err)
+	}
+	return messages, nil
+}
+
 // AcknowledgeStreamMessage acknowledges a message in a stream
 func (r *RedisClient) AcknowledgeStreamMessage(ctx context.Context, streamName, groupName string, ids ...string) error {
 	_, err := r.Client.XAck(ctx, streamName, groupName, ids...).Result()
@@ -0,0 +1,197 @@
+package sizing
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// 夾限原因
+const (
+	CappedByLeverage  = "leverage"   // 名義金額超過 NAV × 槓桿
+	CappedByMargin    = "max_margin" // 保證金超過單筆上限
+	CappedByPortfolio = "portfolio"  // 組合層額度不足而降尺
+)
+
+var (
+	ErrNoNAV          = errors.New("nav unavailable")
+	ErrNoPrice        = errors.New("price unavailable")
+	ErrNoStopDistance = errors.New("invalidation price equals entry")
+)
+
+// Filters 交易所下單限制（instrument_registry：tickSize / stepSize / minQty / minNotional）
+type Filters struct {
+	TickSize    float64 `json:"tickSize"`
+	StepSize    float64 `json:"stepSize"`
+	MinQty      float64 `json:"minQty"`
+	MinNotional float64 `json:"minNotional"`
+}
+
+// Params 以無效化價計算倉位的輸入
+type Params struct {
+	NAV            float64 // 帳戶淨值 USDT
+	BaseRiskPct    float64 // 每筆風險占 NAV 百分比（1.0 = 1%）
+	Conviction     float64 // 已夾限的信心倍率
+	EntryPx        float64
+	InvalidationPx float64 // 結構失效價（硬止損）；低於進場價為多單，高於為空單
+	Leverage       int
+	MaxMarginUSDT  float64 // 單筆保證金上限；0 不限
+	QtyFrac        float64 // 只取部分數量（加倉）；0 視為 1
+	HeldQty        float64 // 既有同向持倉數量（加倉）；與本次合計受槓桿與保證金上限夾限
+	Filters        Filters
+}
+
+// Result 倉位計算結果
+type Result struct {
+	Long         bool
+	RiskCash     float64 // NAV × base_risk_pct × conviction
+	StopPx       float64 // 依 tickSize 往遠離進場價方向取整
+	StopDistance float64
+	RawQty       float64 // risk_cash / |entry − stop|
+	Qty          float64 // 夾限並依 stepSize 無條件捨去後的數量
+	NotionalUSDT float64
+	MarginUSDT   float64
+	CappedBy     string
+}
+
+// Clamp 將 v 限制在 [lower, upper]
+func Clamp(v, lower, upper float64) float64 {
+	return math.Max(lower, math.Min(upper, v))
+}
+
+// Size 風險現金 ÷ 止損距離得數量，再以槓桿與保證金上限夾限（加倉時扣除既有持倉）、依交易所限制取整。
+// 數量只往下取整，實際風險不會超過 risk_cash；既有持倉已達上限或低於 minQty/minNotional 時回傳錯誤。
+func Size(p Params) (Result, error) {
+	var res Result
+	switch {
+	case p.NAV <= 0:
+		return res, ErrNoNAV
+	case p.EntryPx <= 0:
+		return res, ErrNoPrice
+	case p.InvalidationPx <= 0:
+		return res, fmt.Errorf("invalid invalidation price %v", p.InvalidationPx)
+	case p.Leverage <= 0:
+		return res, fmt.Errorf("invalid leverage %d", p.Leverage)
+	}
+
+	res.Long = p.InvalidationPx < p.EntryPx
+	res.StopPx = roundStop(p.InvalidationPx, p.Filters.TickSize, res.Long)
+	res.StopDistance = math.Abs(p.EntryPx - res.StopPx)
+	if res.StopDistance == 0 {
+		return res, ErrNoStopDistance
+	}
+
+	res.RiskCash = p.NAV * p.BaseRiskPct / 100 * p.Conviction
+	res.RawQty = res.RiskCash / res.StopDistance
+	qty := res.RawQty
+	if p.QtyFrac > 0 && p.QtyFrac < 1 {
+		qty *= p.QtyFrac
+	}
+
+	leverage := float64(p.Leverage)
+	held := math.Max(p.HeldQty, 0)
+	if maxQty := p.NAV*leverage/p.EntryPx - held; qty > maxQty {
+		qty, res.CappedBy = math.Max(maxQty, 0), CappedByLeverage
+	}
+	if p.MaxMarginUSDT > 0 {
+		if maxQty := p.MaxMarginUSDT*leverage/p.EntryPx - held; qty > maxQty {
+			qty, res.CappedBy = math.Max(maxQty, 0), CappedByMargin
+		}
+	}
+	if qty <= 0 && held > 0 {
+		return res, fmt.Errorf("held qty %v already at %s cap", held, res.CappedBy)
+	}
+
+	res.Qty = p.Filters.FloorQty(qty)
+	res.NotionalUSDT = res.Qty * p.EntryPx
+	res.MarginUSDT = res.NotionalUSDT / leverage
+	return res, p.Filters.Check(res.Qty, p.EntryPx)
+}
+
+// Downsize 將已計算的倉位降至名義金額 maxNotional 以內（依 stepSize 無條件捨去）；
+// 降尺後低於 minQty/minNotional 時回傳錯誤
+func Downsize(res Result, maxNotional, entryPx float64, leverage int, f Filters) (Result, error) {
+	if entryPx <= 0 {
+		return res, ErrNoPrice
+	}
+	if res.NotionalUSDT <= maxNotional {
+		return res, nil
+	}
+	res.Qty = f.FloorQty(math.Max(maxNotional, 0) / entryPx)
+	res.NotionalUSDT = res.Qty * entryPx
+	res.MarginUSDT = res.NotionalUSDT / float64(leverage)
+	res.CappedBy = CappedByPortfolio
+	return res, f.Check(res.Qty, entryPx)
+}
+
+// FloorQty 數量依 stepSize 無條件捨去（stepSize 為 0 時不取整）
+func (f Filters) FloorQty(qty float64) float64 {
+	return floorToStep(qty, f.StepSize)
+}
+
+// Check 數量與名義金額是否達 minQty / minNotional
+func (f Filters) Check(qty, px float64) error {
+	if qty <= 0 || qty < f.MinQty {
+		return fmt.Errorf("qty %v below min qty %v", qty, f.MinQty)
+	}
+	if notional := qty * px; notional < f.MinNotional {
+		return fmt.Errorf("notional %.2f below min notional %v", notional, f.MinNotional)
+	}
+	return nil
+}
+
+// SplitExit 由持倉 held 部分出場 qty：出場量依 stepSize 無條件捨去，剩餘量取整至 stepSize 的小數位數；
+// 出場量或剩餘量低於 minQty/minNotional（無法單獨下單或會留下殘倉）時 all 為 true，應整筆平倉
+func (f Filters) SplitExit(held, qty, px float64) (exit, rest float64, all bool) {
+	exit = f.FloorQty(math.Min(qty, held))
+	rest = held - exit
+	if f.StepSize > 0 {
+		rest = roundTo(rest, decimals(f.StepSize))
+	}
+	if f.Check(exit, px) != nil || f.Check(rest, px) != nil {
+		return held, 0, true
+	}
+	return exit, rest, false
+}
+
+// RoundStop 止損觸發價依 tickSize 取整，往遠離標記價的方向：多單往下、空單往上
+func RoundStop(px, tick float64, long bool) float64 {
+	return roundStop(px, tick, long)
+}
+
+// roundStop 止損價取整至 tickSize：多單往下、空單往上（不比結構失效價更緊）
+func roundStop(px, tick float64, long bool) float64 {
+	if tick <= 0 {
+		return px
+	}
+	n := px / tick
+	if long {
+		n = math.Floor(n + 1e-9)
+	} else {
+		n = math.Ceil(n - 1e-9)
+	}
+	return roundTo(n*tick, decimals(tick))
+}
+
+func floorToStep(qty, step float64) float64 {
+	if step <= 0 {
+		return qty
+	}
+	return roundTo(math.Floor(qty/step+1e-9)*step, decimals(step))
+}
+
+// decimals 步進的小數位數（0.001 → 3）
+func decimals(step float64) int {
+	s := strconv.FormatFloat(step, 'f', -1, 64)
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		return len(s) - i - 1
+	}
+	return 0
+}
+
+func roundTo(v float64, places int) float64 {
+	scale := math.Pow(10, float64(places))
+	return math.Round(v*scale) / scale
+}
@@ -0,0 +1,156 @@
+package sizing
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+var btcFilters = Filters{TickSize: 0.1, StepSize: 0.001, MinQty: 0.001, MinNotional: 5}
+
+func TestSize_RiskByInvalidation(t *testing.T) {
+	// NAV 10000 × 1% × 1.25 = 125 USDT 風險；止損距離 60000 − 58750.05 → 58750.0（多單往下取整）= 1250
+	res, err := Size(Params{
+		NAV:            10000,
+		BaseRiskPct:    1.0,
+		Conviction:     1.25,
+		EntryPx:        60000,
+		InvalidationPx: 58750.05,
+		Leverage:       20,
+		Filters:        btcFilters,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Long || res.StopPx != 58750 || res.RiskCash != 125 || res.RawQty != 0.1 || res.Qty != 0.1 || res.CappedBy != "" {
+		t.Fatalf("result = %+v", res)
+	}
+	if res.NotionalUSDT != 6000 || res.MarginUSDT != 300 {
+		t.Errorf("notional = %v, margin = %v", res.NotionalUSDT, res.MarginUSDT)
+	}
+
+	// 空單：失效價在上方，止損往上取整
+	res, err = Size(Params{NAV: 10000, BaseRiskPct: 1.0, Conviction: 1, EntryPx: 60000, InvalidationPx: 60333.33, Leverage: 20, Filters: btcFilters})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Long || res.StopPx != 60333.4 || res.Qty != 0.299 {
+		t.Errorf("short = %+v", res)
+	}
+	if risk := res.Qty * res.StopDistance; risk > res.RiskCash {
+		t.Errorf("realised risk %v exceeds risk cash %v", risk, res.RiskCash)
+	}
+}
+
+func TestSize_Caps(t *testing.T) {
+	// 止損極近：原始數量 100 / 10 = 10 BTC，槓桿上限 1000 × 5 / 60000 = 0.0833
+	res, err := Size(Params{NAV: 1000, BaseRiskPct: 10, Conviction: 1, EntryPx: 60000, InvalidationPx: 59990, Leverage: 5, Filters: btcFilters})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.CappedBy != CappedByLeverage || res.Qty != 0.083 {
+		t.Errorf("leverage cap = %+v", res)
+	}
+
+	// 保證金上限 50 USDT × 20 / 60000 = 0.01666
+	res, err = Size(Params{NAV: 10000, BaseRiskPct: 1, Conviction: 1, EntryPx: 60000, InvalidationPx: 59000, Leverage: 20, MaxMarginUSDT: 50, Filters: btcFilters})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.CappedBy != CappedByMargin || res.Qty != 0.016 || math.Abs(res.MarginUSDT-48) > 1e-9 {
+		t.Errorf("margin cap = %+v", res)
+	}
+
+	// 加倉取一半：0.1 × 0.5 = 0.05，仍受同一夾限
+	res, err = Size(Params{NAV: 10000, BaseRiskPct: 1, Conviction: 1, EntryPx: 60000, InvalidationPx: 59000, Leverage: 20, QtyFrac: 0.5, Filters: btcFilters})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.RawQty != 0.1 || res.Qty != 0.05 {
+		t.Errorf("qty frac = %+v", res)
+	}
+
+	// 加倉與既有持倉合計夾限：保證金上限 0.01666 扣除已持有 0.012，剩 0.00466 捨去為 0.004
+	res, err = Size(Params{NAV: 10000, BaseRiskPct: 1, Conviction: 1, EntryPx: 60000, InvalidationPx: 59000, Leverage: 20, MaxMarginUSDT: 50, QtyFrac: 0.5, HeldQty: 0.012, Filters: btcFilters})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.CappedBy != CappedByMargin || res.Qty != 0.004 {
+		t.Errorf("held margin cap = %+v", res)
+	}
+
+	// 既有持倉已達槓桿上限（10000 × 2 / 60000 = 0.333）：不再加倉
+	if res, err = Size(Params{NAV: 10000, BaseRiskPct: 1, Conviction: 1, EntryPx: 60000, InvalidationPx: 59000, Leverage: 2, QtyFrac: 0.5, HeldQty: 0.34, Filters: btcFilters}); err == nil || !strings.Contains(err.Error(), "already at leverage cap") || res.Qty != 0 {
+		t.Errorf("held at leverage cap = %+v, %v", res, err)
+	}
+}
+
+func TestSize_Rejects(t *testing.T) {
+	base := Params{NAV: 10000, BaseRiskPct: 1, Conviction: 1, EntryPx: 60000, InvalidationPx: 59000, Leverage: 20, Filters: btcFilters}
+	cases := map[string]struct {
+		mutate func(*Params)
+		want   string
+	}{
+		"no nav":        {func(p *Params) { p.NAV = 0 }, "nav unavailable"},
+		"no price":      {func(p *Params) { p.EntryPx = 0 }, "price unavailable"},
+		"stop at entry": {func(p *Params) { p.InvalidationPx = 60000 }, "equals entry"},
+		"min notional":  {func(p *Params) { p.NAV = 1000; p.Filters.MinNotional = 1000 }, "below min notional"},
+		"min qty":       {func(p *Params) { p.NAV = 1; p.Filters.MinNotional = 0 }, "below min qty"},
+	}
+	for name, c := range cases {
+		p := base
+		c.mutate(&p)
+		if _, err := Size(p); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: err = %v", name, err)
+		}
+	}
+}
+
+func TestDownsize(t *testing.T) {
+	res, err := Size(Params{NAV: 10000, BaseRiskPct: 1, Conviction: 1, EntryPx: 60000, InvalidationPx: 59000, Leverage: 20, Filters: btcFilters})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 額度足夠：不變
+	if same, err := Downsize(res, 10000, 60000, 20, btcFilters); err != nil || same != res {
+		t.Errorf("no-op downsize = %+v, %v", same, err)
+	}
+
+	// 額度 3000 USDT：0.1 → 0.05
+	down, err := Downsize(res, 3000, 60000, 20, btcFilters)
+	if err != nil || down.Qty != 0.05 || down.NotionalUSDT != 3000 || down.MarginUSDT != 150 || down.CappedBy != CappedByPortfolio {
+		t.Errorf("downsize = %+v, %v", down, err)
+	}
+
+	// 額度低於最小下單量
+	if _, err := Downsize(res, 30, 60000, 20, btcFilters); err == nil || !strings.Contains(err.Error(), "below min qty") {
+		t.Errorf("tiny headroom err = %v", err)
+	}
+}
+
+func TestSplitExit(t *testing.T) {
+	for _, tc := range []struct {
+		held, qty float64
+		want      float64
+		all       bool
+	}{
+		{0.1, 0.1 * 0.33, 0.033, false},   // 0.033 → 剩 0.067
+		{0.1, 0.0334, 0.033, false},       // 依 stepSize 捨去
+		{0.0015, 0.00075, 0.0015, true},   // 出場量低於 minQty
+		{0.0012, 0.001, 0.0012, true},     // 剩 0.0002 為殘倉
+		{0.1, 0.09995, 0.099, false},      // 捨去後剩 0.001（60 USDT）仍可下單
+		{0.0001, 0.0001, 0.0001, true},    // 持倉本身低於 minQty
+		{0.2, 0.0999999999, 0.099, false}, // 浮點誤差不進位
+	} {
+		got, rest, all := btcFilters.SplitExit(tc.held, tc.qty, 60000)
+		if got != tc.want || all != tc.all || (!all && rest+got != tc.held) {
+			t.Errorf("SplitExit(%v, %v) = %v, %v; want %v, %v", tc.held, tc.qty, got, all, tc.want, tc.all)
+		}
+	}
+
+	// 止損往遠離標記價方向取整
+	if long, short := RoundStop(57393.27, 0.1, true), RoundStop(57393.27, 0.1, false); long != 57393.2 || short != 57393.3 {
+		t.Errorf("RoundStop = %v / %v", long, short)
+	}
+}
@@ -0,0 +1,289 @@
+package strategy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"s3-strategy/dao"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Position 單一策略在單一交易對上的持倉狀態
+type Position struct {
+	Strategy        string             `json:"strategy"`
+	Symbol          string             `json:"symbol"`
+	Side            dao.PosSide        `json:"side"`
+	Market          dao.Market         `json:"market,omitempty"`
+	Leverage        int                `json:"leverage,omitempty"` // 進場槓桿（逐倉保證金 = entry × qty / leverage）
+	State           string             `json:"state"`
+	StateTs         int64              `json:"state_ts"`
+	EntryPx         float64            `json:"entry_px"`
+	InitialQty      float64            `json:"initial_qty"`
+	Qty             float64            `json:"qty"`
+	InitialStopPx   float64            `json:"initial_stop_px,omitempty"` // 無效化價（硬止損）
+	StopPx          float64            `json:"stop_px,omitempty"`         // 目前止損（只收緊）
+	ExtremePx       float64            `json:"extreme_px"`                // 進場後最有利價（追蹤止損基準）
+	ATRMult         float64            `json:"atr_mult,omitempty"`
+	RiskCash        float64            `json:"risk_cash,omitempty"`
+	ConvictionMult  float64            `json:"conviction_mult,omitempty"`
+	Score           float64            `json:"score,omitempty"`       // 進場時的 L2 分數（組合層衝突時保留分數較高者）
+	LegLengths      map[string]float64 `json:"leg_lengths,omitempty"` // 進場時鎖定的波段長度（fib_leg 目標）
+	LadderDone      []int              `json:"ladder_done,omitempty"`
+	TransitionsDone []int              `json:"transitions_done,omitempty"`
+	Adds            int                `json:"adds,omitempty"`
+	Flags           map[string]bool    `json:"flags,omitempty"`
+	Tags            []string           `json:"tags,omitempty"`
+	OpenedAt        int64              `json:"opened_at"`
+	ClosedAt        int64              `json:"closed_at,omitempty"`
+	ExitReason      string             `json:"exit_reason,omitempty"`
+	Seq             int                `json:"seq"` // 意圖序號（組 intent_id）
+	Rev             int64              `json:"rev"` // 樂觀鎖版本
+}
+
+// Dir 方向：多 +1、空 -1
+func (p *Position) Dir() float64 {
+	if p.Side == dao.PosShort {
+		return -1
+	}
+	return 1
+}
+
+// EntrySide 進場/加倉的下單方向
+func (p *Position) EntrySide() dao.Side {
+	if p.Side == dao.PosShort {
+		return dao.SideSell
+	}
+	return dao.SideBuy
+}
+
+// ExitSide 減倉/平倉（reduce-only）的下單方向
+func (p *Position) ExitSide() dao.Side {
+	if p.Side == dao.PosShort {
+		return dao.SideBuy
+	}
+	return dao.SideSell
+}
+
+// Clone 深拷貝（評估時不修改已保存的持倉）
+func (p *Position) Clone() *Position {
+	cp := *p
+	if p.LegLengths != nil {
+		cp.LegLengths = make(map[string]float64, len(p.LegLengths))
+		for k, v := range p.LegLengths {
+			cp.LegLengths[k] = v
+		}
+	}
+	if p.Flags != nil {
+		cp.Flags = make(map[string]bool, len(p.Flags))
+		for k, v := range p.Flags {
+			cp.Flags[k] = v
+		}
+	}
+	cp.LadderDone = append([]int(nil), p.LadderDone...)
+	cp.TransitionsDone = append([]int(nil), p.TransitionsDone...)
+	cp.Tags = append([]string(nil), p.Tags...)
+	return &cp
+}
+
+func containsInt(list []int, v int) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrConflict 持倉已被其他請求/副本更新（版本不符）
+var ErrConflict = errors.New("position revision conflict")
+
+// PositionStore 持倉狀態存取；Save 以 Rev 做樂觀鎖，成功後 Rev 加一
+type PositionStore interface {
+	Get(ctx context.Context, strategy, symbol string) (*Position, error)
+	Save(ctx context.Context, pos *Position) error
+	// List 所有策略、交易對的持倉（含保留期內已結束者），供組合層風險檢查
+	List(ctx context.Context) ([]*Position, error)
+}
+
+// closedPositionTTL 結束狀態保留時間（供查詢與下次進場延續序號）
+const closedPositionTTL = 7 * 24 * time.Hour
+
+// PositionKey Redis 持倉鍵
+func PositionKey(strategy, symbol string) string {
+	return fmt.Sprintf(positionKeyPrefix+"%s:%s", strategy, symbol)
+}
+
+const (
+	positionKeyPrefix = "strategy:{pos}:"
+	listScanCount     = 200
+)
+
+// casScript 比對既存版本後寫入；ARGV: 預期版本、內容、TTL 毫秒（0 不過期）
+var casScript = redis.NewScript(`
+local cur = redis.call('GET', KEYS[1])
+local rev = 0
+if cur then
+  rev = tonumber(cjson.decode(cur)['rev']) or 0
+end
+if rev ~= tonumber(ARGV[1]) then
+  return 0
+end
+if tonumber(ARGV[3]) > 0 then
+  redis.call('SET', KEYS[1], ARGV[2], 'PX', ARGV[3])
+else
+  redis.call('SET', KEYS[1], ARGV[2])
+end
+return 1
+`)
+
+// RedisPositionStore 以 Redis JSON 字串保存持倉；多副本以 Lua CAS 避免覆寫
+type RedisPositionStore struct {
+	client redis.Cmdable
+}
+
+func NewRedisPositionStore(client redis.Cmdable) *RedisPositionStore {
+	return &RedisPositionStore{client: client}
+}
+
+func (s *RedisPositionStore) Get(ctx context.Context, strategy, symbol string) (*Position, error) {
+	payload, err := s.client.Get(ctx, PositionKey(strategy, symbol)).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var pos Position
+	if err := json.Unmarshal([]byte(payload), &pos); err != nil {
+		return nil, fmt.Errorf("failed to decode position %s/%s: %w", strategy, symbol, err)
+	}
+	return &pos, nil
+}
+
+func (s *RedisPositionStore) Save(ctx context.Context, pos *Position) error {
+	expected := pos.Rev
+	next := *pos
+	next.Rev = expected + 1
+	payload, err := json.Marshal(&next)
+	if err != nil {
+		return err
+	}
+	ttl := int64(0)
+	if IsTerminal(pos.State) {
+		ttl = closedPositionTTL.Milliseconds()
+	}
+
+	ok, err := casScript.Run(ctx, s.client, []string{PositionKey(pos.Strategy, pos.Symbol)}, expected, payload, ttl).Int()
+	if err != nil {
+		return err
+	}
+	if ok == 0 {
+		return ErrConflict
+	}
+	pos.Rev = next.Rev
+	return nil
+}
+
+// List 以 SCAN 取得持倉鍵後 MGET；掃描期間過期或刪除的鍵略過
+func (s *RedisPositionStore) List(ctx context.Context) ([]*Position, error) {
+	keys, err := s.scanKeys(ctx)
+	if err != nil || len(keys) == 0 {
+		return nil, err
+	}
+	values, err := s.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	positions := make([]*Position, 0, len(values))
+	for i, value := range values {
+		payload, ok := value.(string)
+		if !ok {
+			continue
+		}
+		var pos Position
+		if err := json.Unmarshal([]byte(payload), &pos); err != nil {
+			return nil, fmt.Errorf("failed to decode position %s: %w", keys[i], err)
+		}
+		positions = append(positions, &pos)
+	}
+	return positions, nil
+}
+
+// scanKeys 持倉鍵共用 {pos} hash tag（同一槽位）；叢集模式需逐一掃描主節點
+func (s *RedisPositionStore) scanKeys(ctx context.Context) ([]string, error) {
+	scan := func(ctx context.Context, client redis.Cmdable) ([]string, error) {
+		var keys []string
+		var cursor uint64
+		for {
+			batch, next, err := client.Scan(ctx, cursor, positionKeyPrefix+"*", listScanCount).Result()
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, batch...)
+			if cursor = next; cursor == 0 {
+				return keys, nil
+			}
+		}
+	}
+	cluster, ok := s.client.(*redis.ClusterClient)
+	if !ok {
+		return scan(ctx, s.client)
+	}
+	var mu sync.Mutex
+	var keys []string
+	err := cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+		batch, err := scan(ctx, node)
+		mu.Lock()
+		keys = append(keys, batch...)
+		mu.Unlock()
+		return err
+	})
+	return keys, err
+}
+
+// MemoryPositionStore 記憶體實作（Redis 未連線與測試使用）
+type MemoryPositionStore struct {
+	mu        sync.Mutex
+	positions map[string]Position
+}
+
+func NewMemoryPositionStore() *MemoryPositionStore {
+	return &MemoryPositionStore{positions: make(map[string]Position)}
+}
+
+func (s *MemoryPositionStore) Get(ctx context.Context, strategy, symbol string) (*Position, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pos, ok := s.positions[PositionKey(strategy, symbol)]
+	if !ok {
+		return nil, nil
+	}
+	return pos.Clone(), nil
+}
+
+func (s *MemoryPositionStore) Save(ctx context.Context, pos *Position) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := PositionKey(pos.Strategy, pos.Symbol)
+	if s.positions[key].Rev != pos.Rev {
+		return ErrConflict
+	}
+	pos.Rev++
+	s.positions[key] = *pos.Clone()
+	return nil
+}
+
+func (s *MemoryPositionStore) List(ctx context.Context) ([]*Position, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	positions := make([]*Position, 0, len(s.positions))
+	for _, pos := range s.positions {
+		positions = append(positions, pos.Clone())
+	}
+	return positions, nil
+}
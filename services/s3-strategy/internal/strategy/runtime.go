@@ -0,0 +1,588 @@
+package strategy
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+
+	"s3-strategy/dao"
+	"s3-strategy/internal/dsl"
+	"s3-strategy/internal/sizing"
+)
+
+// Input 單次評估輸入
+type Input struct {
+	Symbol      string
+	Features    dao.FeatureSet
+	Price       float64 // 目前價格（進場參考價與出場觸發判斷）
+	NAV         float64 // 帳戶淨值 USDT（risk_by_invalidation 使用）
+	NowMs       int64
+	AllowEntry  bool           // L0 守門未通過時仍會管理既有持倉，但不進場/加倉
+	Filters     sizing.Filters // 交易所下單限制：數量依 stepSize 捨去、止損依 tickSize 取整；零值不取整
+	MaxNotional float64        // 進場/加倉名義金額上限 USDT（組合層預檢降尺）；0 不限制
+}
+
+// entryQty 進場/加倉數量：套用名義金額上限後依 stepSize 捨去
+func (in Input) entryQty(qty, px float64) float64 {
+	if in.MaxNotional > 0 && px > 0 {
+		qty = math.Min(qty, in.MaxNotional/px)
+	}
+	return in.Filters.FloorQty(qty)
+}
+
+// stop 止損價依 tickSize 往遠離標記價方向取整（多單往下、空單往上）
+func (in Input) stop(px, dir float64) float64 {
+	return sizing.RoundStop(px, in.Filters.TickSize, dir > 0)
+}
+
+// Intent 策略產生的下單意圖（由呼叫端轉為 dao.OrderIntent）
+type Intent struct {
+	Kind        dao.OrderIntentKind
+	Side        dao.Side
+	Qty         float64
+	Price       float64 // 參考價
+	TriggerPx   float64 // SL 觸發價
+	ReduceOnly  bool
+	PreferMaker bool
+	Reason      string
+	Seq         int
+}
+
+// Transition 狀態轉移紀錄
+type Transition struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Event string `json:"event"`
+	Ts    int64  `json:"ts"`
+}
+
+// Result 單次評估結果
+type Result struct {
+	Strategy    string
+	Position    *Position // 評估後的持倉；未持倉且未進場時為 nil
+	Intents     []Intent
+	Transitions []Transition
+	Warnings    []string
+	Changed     bool   // 持倉需寫回
+	Skipped     string // 未進場原因
+}
+
+// 特徵命名（皆以 anchor_tf 為後綴）
+const (
+	signalFeaturePrefix    = "wave_signal_"
+	eventsFeaturePrefix    = "wave_events_"
+	directionFeaturePrefix = "wave_direction_"
+	legFeaturePrefix       = "wave_leg_"
+	pivotFeaturePrefix     = "wave_last_pivot_px_"
+	atrFeaturePrefix       = "atr_"
+
+	// EventRRBreakeven 內建事件：RR 達第一個移動止損階梯（預設 1.0）
+	EventRRBreakeven = "rr_reach_breakeven"
+
+	qtyEpsilon = 1e-12
+)
+
+// Runner 讀取持倉、評估並寫回
+type Runner struct {
+	Store PositionStore
+}
+
+// Process 評估單一策略；dryRun 時不寫回持倉
+func (r *Runner) Process(ctx context.Context, st *Strategy, in Input, dryRun bool) (Result, error) {
+	pos, err := r.Store.Get(ctx, st.Name(), in.Symbol)
+	if err != nil {
+		return Result{Strategy: st.Name()}, fmt.Errorf("load position %s/%s: %w", st.Name(), in.Symbol, err)
+	}
+	res := st.Evaluate(pos, in)
+	if !dryRun {
+		if err := r.Commit(ctx, res); err != nil {
+			return res, err
+		}
+	}
+	return res, nil
+}
+
+// Commit 寫回 Process(dryRun) 的評估結果；持倉未變更時不寫入。用於下單意圖須先暫占額度再寫回的流程
+func (r *Runner) Commit(ctx context.Context, res Result) error {
+	if !res.Changed {
+		return nil
+	}
+	if err := r.Store.Save(ctx, res.Position); err != nil {
+		return fmt.Errorf("save position %s/%s: %w", res.Strategy, res.Position.Symbol, err)
+	}
+	return nil
+}
+
+// Evaluate 依持倉狀態評估進場或出場；不修改傳入的持倉
+//
+// 無持倉（或已結束）時評估 entry；持倉中依序處理：止損觸發 → 反向信號（on_opposite）→ 出場階梯 → 狀態轉移（結構事件）→ 加倉 →
+// 追蹤止損 → 時間止損 → 跨週期告警。所有出場判斷只讀 anchor_tf 的特徵。
+func (st *Strategy) Evaluate(prev *Position, in Input) Result {
+	res := Result{Strategy: st.Name()}
+	env := dsl.MapEnv(in.Features)
+	if prev == nil || IsTerminal(prev.State) {
+		st.enter(prev, in, env, &res)
+		return res
+	}
+
+	pos := prev.Clone()
+	res.Position = pos
+	st.manage(pos, in, env, &res)
+	return res
+}
+
+func (st *Strategy) enter(prev *Position, in Input, env dsl.MapEnv, res *Result) {
+	switch {
+	case !in.AllowEntry:
+		res.Skipped = "entries disabled"
+		return
+	case !st.Applies(in.Symbol):
+		res.Skipped = "symbol out of scope"
+		return
+	case in.Price <= 0:
+		res.Skipped = "price unavailable"
+		return
+	case !st.entry.Match(env):
+		res.Skipped = "entry condition not met"
+		return
+	}
+
+	dir := st.entrySide(env)
+	if dir == 0 {
+		res.Skipped = "no detected trend"
+		return
+	}
+
+	size := st.Spec.Entry.Size
+	stopRef := size.StopRef
+	if stopRef == "" {
+		stopRef = st.Spec.Risk.HardStop
+	}
+	stopPx := 0.0
+	if stopRef != "" {
+		stop, ok := number(env, stopRef)
+		if !ok || stop <= 0 || (in.Price-stop)*dir <= 0 {
+			res.Skipped = fmt.Sprintf("invalid stop %s", stopRef)
+			return
+		}
+		stopPx = in.stop(stop, dir)
+	}
+
+	pos := &Position{
+		Strategy: st.Name(),
+		Symbol:   in.Symbol,
+		Side:     dao.PosLong,
+		EntryPx:  in.Price,
+		StopPx:   stopPx,
+		OpenedAt: in.NowMs,
+		Flags:    map[string]bool{},
+	}
+	if dir < 0 {
+		pos.Side = dao.PosShort
+	}
+	if prev != nil {
+		pos.Seq = prev.Seq
+		pos.Rev = prev.Rev
+	}
+	pos.InitialStopPx = stopPx
+	pos.ExtremePx = in.Price
+
+	switch size.Mode {
+	case SizeRiskByInvalidation:
+		if in.NAV <= 0 {
+			res.Skipped = "nav unavailable"
+			return
+		}
+		pos.ConvictionMult = st.convictionMult(env)
+		pos.RiskCash = in.NAV * size.BaseRiskPctOfNav / 100 * pos.ConvictionMult
+		pos.InitialQty = pos.RiskCash / math.Abs(in.Price-stopPx)
+	case SizeFixedNotional:
+		pos.InitialQty = size.NotionalUSDT / in.Price
+	}
+	pos.InitialQty = in.entryQty(pos.InitialQty, in.Price)
+	if err := in.Filters.Check(pos.InitialQty, in.Price); err != nil {
+		res.Skipped = err.Error()
+		return
+	}
+	pos.Qty = pos.InitialQty
+
+	if tr := st.Spec.Exit.Trailing; tr != nil {
+		pos.ATRMult = tr.ATRMultInitial
+	}
+	for _, step := range st.Spec.Exit.Ladder {
+		if step.Kind != "fib_leg" {
+			continue
+		}
+		name := st.legFeature(step)
+		if length, ok := number(env, name); ok && length != 0 {
+			if pos.LegLengths == nil {
+				pos.LegLengths = make(map[string]float64)
+			}
+			pos.LegLengths[name] = math.Abs(length)
+		}
+	}
+
+	res.Position = pos
+	res.Changed = true
+	st.setState(pos, st.Spec.StateMachine.Initial, "entry", in.NowMs, res)
+	if prev != nil {
+		res.Transitions[len(res.Transitions)-1].From = prev.State
+	}
+
+	st.emit(pos, res, Intent{
+		Kind:        dao.IntentEntry,
+		Side:        pos.EntrySide(),
+		Qty:         pos.Qty,
+		Price:       in.Price,
+		PreferMaker: st.Spec.Entry.Price == "maker_preferred",
+		Reason:      "entry",
+	})
+	if stopPx > 0 {
+		st.emitStop(pos, res, "hard_stop")
+	}
+}
+
+func (st *Strategy) manage(pos *Position, in Input, env dsl.MapEnv, res *Result) {
+	price := in.Price
+	if price <= 0 {
+		return
+	}
+	dir := pos.Dir()
+
+	if (price-pos.ExtremePx)*dir > 0 {
+		pos.ExtremePx = price
+		res.Changed = true
+	}
+	rr := st.currentRR(pos, price)
+
+	// 1. 止損觸發：仍在無效化價即為 INVALIDATED，已移動過的止損為 CLOSED
+	if pos.StopPx > 0 && (price-pos.StopPx)*dir <= 0 {
+		state := StateClosed
+		if pos.StopPx == pos.InitialStopPx {
+			state = StateInvalidated
+		}
+		st.closeAll(pos, in, dao.IntentExit, "stop_hit", state, res)
+		return
+	}
+
+	// 2. 反向進場信號：依 entry.on_opposite 全數平倉，flip 時再以新方向進場
+	if st.Spec.Entry.OnOpposite != OppositeHold && st.entry.Match(env) && st.entrySide(env) == -dir {
+		st.closeAll(pos, in, dao.IntentExit, "opposite_signal", StateClosed, res)
+		if st.Spec.Entry.OnOpposite == OppositeFlip {
+			st.enter(pos, in, env, res)
+		}
+		return
+	}
+
+	// 3. 出場階梯
+	for i, step := range st.Spec.Exit.Ladder {
+		if containsInt(pos.LadderDone, i) || !st.ladderReached(pos, step, price, rr, env) {
+			continue
+		}
+		pos.LadderDone = append(pos.LadderDone, i)
+		res.Changed = true
+		st.apply(pos, step.Action, st.ladderFlags[i], fmt.Sprintf("ladder[%d]:%s", i, step.Kind), in, env, res)
+		if IsTerminal(pos.State) {
+			return
+		}
+	}
+
+	// 4. 結構事件 → 狀態轉移（每條轉移每筆持倉最多觸發一次）
+	events := st.events(env, rr)
+	for i, tr := range st.Spec.StateMachine.Transitions {
+		if containsInt(pos.TransitionsDone, i) || !stateAllowed(pos.State, tr.From) {
+			continue
+		}
+		if tr.On != "" && !events[tr.On] {
+			continue
+		}
+		if program := st.transitions[i]; program != nil && !program.Match(env) {
+			continue
+		}
+		event := tr.On
+		if event == "" {
+			event = fmt.Sprintf("transitions[%d]", i)
+		}
+		pos.TransitionsDone = append(pos.TransitionsDone, i)
+		res.Changed = true
+		st.setState(pos, tr.To, event, in.NowMs, res)
+		st.apply(pos, tr.Action, st.flags[i], event, in, env, res)
+		if IsTerminal(pos.State) {
+			return
+		}
+	}
+
+	// 5. 加倉：同 anchor_tf 事件、RR 達門檻且未禁加倉
+	if add := st.Spec.AddOn; add != nil && in.AllowEntry && !pos.Flags["forbid_add_on"] && pos.Adds < add.MaxAdds && rr >= add.MinRR {
+		for _, event := range add.On {
+			if !events[event] {
+				continue
+			}
+			qty := in.entryQty(pos.InitialQty*add.SizeFrac, price)
+			if in.Filters.Check(qty, price) != nil {
+				break
+			}
+			pos.Qty += qty
+			pos.Adds++
+			if add.TightenATRTo > 0 {
+				pos.tightenATR(add.TightenATRTo)
+			}
+			res.Changed = true
+			st.emit(pos, res, Intent{Kind: dao.IntentAdd, Side: pos.EntrySide(), Qty: qty, Price: price, PreferMaker: st.Spec.Entry.Price == "maker_preferred", Reason: "add_on:" + event})
+			break
+		}
+	}
+
+	// 6. ATR 追蹤止損（只收緊）
+	if tr := st.Spec.Exit.Trailing; tr != nil {
+		if after := tr.ATRMultAfterRR; after != nil && rr >= after.RR && (pos.ATRMult == 0 || after.Mult < pos.ATRMult) {
+			pos.ATRMult = after.Mult
+			res.Changed = true
+		}
+		if atr, ok := st.atr(env); ok && atr > 0 && pos.ATRMult > 0 {
+			trail := in.stop(pos.ExtremePx-dir*pos.ATRMult*atr, dir)
+			if trail > 0 && (price-trail)*dir > 0 && (pos.StopPx == 0 || (trail-pos.StopPx)*dir > 0) {
+				pos.StopPx = trail
+				res.Changed = true
+				st.emitStop(pos, res, "trailing")
+			}
+		}
+	}
+
+	// 7. 時間止損
+	if st.timeStopHours > 0 && in.NowMs-pos.OpenedAt >= int64(st.timeStopHours*3600*1000) {
+		st.closeAll(pos, in, dao.IntentExit, "time_stop", StateClosed, res)
+		return
+	}
+
+	// 8. 跨週期告警：僅標記，不影響倉位
+	adv := st.Spec.Advisory
+	for _, tf := range append(append([]string(nil), adv.WarnIfHigherTFConflict...), adv.WarnIfLowerTFConflict...) {
+		d, ok := dsl.TimeframeDirection(env, tf)
+		if !ok || d == 0 || float64(d) == dir {
+			continue
+		}
+		res.Warnings = append(res.Warnings, fmt.Sprintf("%s trend conflicts with %s position", tf, pos.Side))
+		for _, tag := range adv.OnWarn.SetTag {
+			if !containsString(pos.Tags, tag) {
+				pos.Tags = append(pos.Tags, tag)
+				res.Changed = true
+			}
+		}
+	}
+}
+
+// apply 執行動作：先減倉、再移動止損與收緊追蹤
+func (st *Strategy) apply(pos *Position, action ActionSpec, flag flagAction, reason string, in Input, env dsl.MapEnv, res *Result) {
+	if flag.name != "" {
+		if pos.Flags == nil {
+			pos.Flags = map[string]bool{}
+		}
+		pos.Flags[flag.name] = flag.value
+	}
+
+	if action.TakeProfit > 0 {
+		// 減倉量依 stepSize 捨去；減倉量或剩餘量低於下單限制時整筆平倉
+		qty, rest, all := in.Filters.SplitExit(pos.Qty, pos.InitialQty*action.TakeProfit, in.Price)
+		if action.TakeProfit >= 1 || all || rest <= qtyEpsilon*math.Max(1, pos.InitialQty) {
+			st.closeAll(pos, in, dao.IntentTP, reason, StateClosed, res)
+			return
+		}
+		pos.Qty = rest
+		st.emit(pos, res, Intent{Kind: dao.IntentTP, Side: pos.ExitSide(), Qty: qty, Price: in.Price, ReduceOnly: true, Reason: reason})
+	}
+
+	if action.MoveStopTo != "" {
+		if px, ok := st.stopTarget(pos, action.MoveStopTo, in.Price, env); ok && (pos.StopPx == 0 || (in.stop(px, pos.Dir())-pos.StopPx)*pos.Dir() > 0) {
+			pos.StopPx = in.stop(px, pos.Dir())
+			st.emitStop(pos, res, reason)
+		}
+	}
+
+	if action.TightenATRTo > 0 {
+		pos.tightenATR(action.TightenATRTo)
+	}
+}
+
+func (p *Position) tightenATR(mult float64) {
+	if p.ATRMult == 0 || mult < p.ATRMult {
+		p.ATRMult = mult
+	}
+}
+
+// stopTarget 移動止損目標；須仍在目前價格的安全側，breakeven_or_last_pivot 取較保護者
+func (st *Strategy) stopTarget(pos *Position, target string, price float64, env dsl.MapEnv) (float64, bool) {
+	dir := pos.Dir()
+	var candidates []float64
+	if target == "breakeven" || target == "breakeven_or_last_pivot" {
+		candidates = append(candidates, pos.EntryPx)
+	}
+	if target == "last_pivot" || target == "breakeven_or_last_pivot" {
+		if pivot, ok := number(env, pivotFeaturePrefix+st.Spec.AnchorTF); ok && pivot > 0 {
+			candidates = append(candidates, pivot)
+		}
+	}
+	best, found := 0.0, false
+	for _, px := range candidates {
+		if (price-px)*dir <= 0 {
+			continue
+		}
+		if !found || (px-best)*dir > 0 {
+			best, found = px, true
+		}
+	}
+	return best, found
+}
+
+func (st *Strategy) closeAll(pos *Position, in Input, kind dao.OrderIntentKind, reason, state string, res *Result) {
+	if pos.Qty > 0 {
+		st.emit(pos, res, Intent{Kind: kind, Side: pos.ExitSide(), Qty: pos.Qty, Price: in.Price, ReduceOnly: true, Reason: reason})
+	}
+	pos.Qty = 0
+	pos.ClosedAt = in.NowMs
+	pos.ExitReason = reason
+	res.Changed = true
+	st.setState(pos, state, reason, in.NowMs, res)
+}
+
+func (st *Strategy) setState(pos *Position, state, event string, ts int64, res *Result) {
+	if pos.State == state {
+		return
+	}
+	res.Transitions = append(res.Transitions, Transition{From: pos.State, To: state, Event: event, Ts: ts})
+	pos.State = state
+	pos.StateTs = ts
+	if IsTerminal(state) && pos.ClosedAt == 0 {
+		pos.ClosedAt = ts
+		pos.ExitReason = event
+	}
+}
+
+func (st *Strategy) emit(pos *Position, res *Result, intent Intent) {
+	pos.Seq++
+	intent.Seq = pos.Seq
+	res.Intents = append(res.Intents, intent)
+}
+
+// emitStop 下/改止損單（reduce-only，數量為目前持倉）
+func (st *Strategy) emitStop(pos *Position, res *Result, reason string) {
+	st.emit(pos, res, Intent{Kind: dao.IntentSL, Side: pos.ExitSide(), Qty: pos.Qty, TriggerPx: pos.StopPx, ReduceOnly: true, Reason: reason})
+}
+
+func (st *Strategy) ladderReached(pos *Position, step LadderStep, price, rr float64, env dsl.MapEnv) bool {
+	switch step.Kind {
+	case "rr":
+		return rr >= step.RR
+	case "fib_leg":
+		name := st.legFeature(step)
+		length, ok := pos.LegLengths[name]
+		if !ok {
+			if length, ok = number(env, name); !ok || length == 0 {
+				return false
+			}
+			length = math.Abs(length)
+		}
+		target := pos.EntryPx + pos.Dir()*step.Mult*length
+		return (price-target)*pos.Dir() >= 0
+	}
+	return false
+}
+
+// currentRR 目前報酬 / 初始風險（無止損時為 0）
+func (st *Strategy) currentRR(pos *Position, price float64) float64 {
+	risk := math.Abs(pos.EntryPx - pos.InitialStopPx)
+	if pos.InitialStopPx == 0 || risk == 0 {
+		return 0
+	}
+	return (price - pos.EntryPx) * pos.Dir() / risk
+}
+
+// events anchor_tf 事件：wave_signal_<tf>、wave_events_<tf>（字串或清單）與內建事件
+func (st *Strategy) events(env dsl.MapEnv, rr float64) map[string]bool {
+	events := make(map[string]bool)
+	for _, name := range []string{signalFeaturePrefix + st.Spec.AnchorTF, eventsFeaturePrefix + st.Spec.AnchorTF} {
+		v := env.Lookup(name)
+		switch v.Kind {
+		case dsl.KindString:
+			events[v.Str] = true
+		case dsl.KindList:
+			for _, item := range v.List {
+				if item.Kind == dsl.KindString {
+					events[item.Str] = true
+				}
+			}
+		}
+	}
+	if rr >= st.breakevenRR {
+		events[EventRRBreakeven] = true
+	}
+	return events
+}
+
+// entrySide 進場方向：+1 多、-1 空、0 無法判定
+func (st *Strategy) entrySide(env dsl.MapEnv) float64 {
+	switch strings.ToLower(st.Spec.Entry.Side) {
+	case "long", "buy":
+		return 1
+	case "short", "sell":
+		return -1
+	}
+	// follow_detected_trend：wave_direction_<tf> → trend_<tf> → direction
+	if d, ok := dsl.TimeframeDirection(env, st.Spec.AnchorTF); ok && d != 0 {
+		return float64(d)
+	}
+	if d, ok := dsl.DirectionOf(env.Lookup(dsl.DirectionFeature)); ok {
+		return float64(d)
+	}
+	return 0
+}
+
+// convictionMult clamp(1 + slope × (clamp(c, 0.5, 0.95) − pivot), lower, upper)；缺值時為 1 再夾限
+func (st *Strategy) convictionMult(env dsl.MapEnv) float64 {
+	c := st.Spec.Entry.Size.Conviction
+	if c == nil {
+		return 1
+	}
+	mult := 1.0
+	if confidence, ok := number(env, c.Var); ok {
+		confidence = math.Max(0.5, math.Min(0.95, confidence))
+		mult = 1 + c.Slope*(confidence-c.Pivot)
+	}
+	return math.Max(c.Lower, math.Min(c.Upper, mult))
+}
+
+func (st *Strategy) legFeature(step LadderStep) string {
+	return legFeaturePrefix + strings.ToLower(step.Leg) + "_" + st.Spec.AnchorTF
+}
+
+func (st *Strategy) atr(env dsl.MapEnv) (float64, bool) {
+	if atr, ok := number(env, atrFeaturePrefix+st.Spec.AnchorTF); ok {
+		return atr, true
+	}
+	return number(env, "atr")
+}
+
+func stateAllowed(state string, from []string) bool {
+	if len(from) == 0 {
+		return true
+	}
+	return containsString(from, state)
+}
+
+func containsString(list []string, v string) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
+
+func number(env dsl.MapEnv, name string) (float64, bool) {
+	v := env.Lookup(name)
+	if v.Kind != dsl.KindNumber {
+		return 0, false
+	}
+	return v.Num, true
+}
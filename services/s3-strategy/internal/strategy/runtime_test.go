@@ -0,0 +1,307 @@
+package strategy
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+
+	"s3-strategy/dao"
+	"s3-strategy/internal/sizing"
+)
+
+const hourMs = int64(3600 * 1000)
+
+func loadSpec(t *testing.T, name string) *Strategy {
+	t.Helper()
+	strategies, err := LoadDir("../../strategies")
+	if err != nil {
+		t.Fatalf("LoadDir failed: %v", err)
+	}
+	for _, st := range strategies {
+		if st.Name() == name {
+			return st
+		}
+	}
+	t.Fatalf("strategy %s not found", name)
+	return nil
+}
+
+func entryFeatures() dao.FeatureSet {
+	return dao.FeatureSet{
+		"wave_signal_4h":          "end_of_2_confirmed",
+		"wave_impulse_score_4h":   0.8,
+		"rvol_4h":                 1.2,
+		"wave_direction_4h":       "UP",
+		"ew_confidence_4h":        0.9,
+		"wave_invalidation_px_4h": 95.0,
+		"wave_leg_w1_4h":          10.0,
+		"atr_4h":                  1.0,
+	}
+}
+
+func approx(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+
+func TestLoadDir_EWSpecs(t *testing.T) {
+	st4h := loadSpec(t, "ew_trend_follow_4h_anchor_v1")
+	if st4h.timeStopHours != 96 || st4h.breakevenRR != 0.8 || len(st4h.Spec.Exit.Ladder) != 4 {
+		t.Errorf("unexpected 4h spec: time_stop=%v breakeven=%v ladder=%d", st4h.timeStopHours, st4h.breakevenRR, len(st4h.Spec.Exit.Ladder))
+	}
+	if !st4h.Applies("ETHUSDT") || st4h.Applies("SOLUSDT") {
+		t.Error("unexpected scope")
+	}
+
+	// time_stop: { hours: 24*14 }
+	if st1d := loadSpec(t, "ew_trend_follow_1d_anchor_v1"); st1d.timeStopHours != 336 {
+		t.Errorf("1d time stop = %v, want 336", st1d.timeStopHours)
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	base := `
+strategy: s
+anchor_tf: "4h"
+entry:
+  when: "x > 1"
+  side: long
+  size: { mode: fixed_notional, notional_usdt: 100 }
+`
+	cases := []struct {
+		extra string
+		want  string
+	}{
+		{"unknown_key: 1\n", "field unknown_key not found"},
+		{"state_machine: { transitions: [ { on: e, to: NOWHERE } ] }\n", `unknown state "NOWHERE"`},
+		{"exit: { ladder: [ { kind: fib_leg, tf: \"1d\", leg: W1, mult: 1 } ] }\n", "differs from anchor_tf"},
+		{"exit: { ladder: [ { kind: rr, rr: 1, action: { move_stop_to: moon } } ] }\n", `unknown move_stop_to "moon"`},
+		{"exit: { time_stop: { hours: \"x*2\" } }\n", "must be a positive number"},
+	}
+	for _, tc := range cases {
+		_, err := Parse([]byte(base + tc.extra))
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("Parse(%q) error = %v, want containing %q", tc.extra, err, tc.want)
+		}
+	}
+
+	_, err := Parse([]byte(strings.Replace(base, `"x > 1"`, `"x >"`, 1)))
+	if err == nil || !strings.Contains(err.Error(), "entry.when: position 4") {
+		t.Errorf("expected entry.when parse error with position, got %v", err)
+	}
+}
+
+func TestEvaluate_Lifecycle(t *testing.T) {
+	st := loadSpec(t, "ew_trend_follow_4h_anchor_v1")
+	runner := &Runner{Store: NewMemoryPositionStore()}
+	ctx := context.Background()
+	features := entryFeatures()
+
+	// 進場：conviction = clamp(1 + 2 × (0.9 − 0.75), 0.8, 1.25) = 1.25；risk_cash = 10000 × 1% × 1.25 = 125；qty = 125 / 5
+	res, err := runner.Process(ctx, st, Input{Symbol: "BTCUSDT", Features: features, Price: 100, NAV: 10000, NowMs: 0, AllowEntry: true}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Intents) != 2 || res.Intents[0].Kind != dao.IntentEntry || res.Intents[0].Side != dao.SideBuy || !approx(res.Intents[0].Qty, 25) {
+		t.Fatalf("entry intents = %+v", res.Intents)
+	}
+	if sl := res.Intents[1]; sl.Kind != dao.IntentSL || sl.TriggerPx != 95 || !sl.ReduceOnly || sl.Side != dao.SideSell {
+		t.Errorf("hard stop intent = %+v", sl)
+	}
+	if len(res.Transitions) != 1 || res.Transitions[0].To != StateActiveConfirmed {
+		t.Errorf("entry transitions = %+v", res.Transitions)
+	}
+
+	// RR 0.8：止損移至入場價並轉 ACTIVE_REDUCED_RISK
+	features["wave_signal_4h"] = "none"
+	res, err = runner.Process(ctx, st, Input{Symbol: "BTCUSDT", Features: features, Price: 104, NAV: 10000, NowMs: hourMs, AllowEntry: true}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Position.State != StateActiveReducedRisk || res.Position.StopPx < 100 {
+		t.Errorf("after rr: state=%s stop=%v", res.Position.State, res.Position.StopPx)
+	}
+
+	// fib 0.5 × W1 = 105 與 end_of_4_confirmed：各減倉 33% / 25%，禁加倉，ATR 收緊至 2.0
+	features["wave_signal_4h"] = "end_of_4_confirmed"
+	res, err = runner.Process(ctx, st, Input{Symbol: "BTCUSDT", Features: features, Price: 105.5, NAV: 10000, NowMs: 2 * hourMs, AllowEntry: true}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tpQty float64
+	for _, intent := range res.Intents {
+		if intent.Kind == dao.IntentTP {
+			tpQty += intent.Qty
+		}
+	}
+	pos := res.Position
+	if !approx(tpQty, 25*0.33+25*0.25) || !approx(pos.Qty, 25-tpQty) {
+		t.Errorf("tp qty = %v, remaining = %v", tpQty, pos.Qty)
+	}
+	if pos.State != StateActiveWarning || !pos.Flags["forbid_add_on"] || pos.ATRMult != 2.0 {
+		t.Errorf("after end_of_4: %+v", pos)
+	}
+	if !approx(pos.StopPx, 103.5) {
+		t.Errorf("trailing stop = %v, want 103.5", pos.StopPx)
+	}
+
+	// 跌破已移動的止損：全平並 CLOSED
+	res, err = runner.Process(ctx, st, Input{Symbol: "BTCUSDT", Features: features, Price: 103, NAV: 10000, NowMs: 3 * hourMs, AllowEntry: false}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Position.State != StateClosed || res.Position.ExitReason != "stop_hit" || len(res.Intents) != 1 || !approx(res.Intents[0].Qty, pos.Qty) {
+		t.Errorf("stop exit: state=%s intents=%+v", res.Position.State, res.Intents)
+	}
+
+	// 持倉狀態已寫回
+	stored, _ := runner.Store.Get(ctx, st.Name(), "BTCUSDT")
+	if stored == nil || stored.State != StateClosed || stored.Rev != 4 {
+		t.Errorf("stored position = %+v", stored)
+	}
+}
+
+func TestEvaluate_InvalidationAndTimeStop(t *testing.T) {
+	st := loadSpec(t, "ew_trend_follow_4h_anchor_v1")
+	features := entryFeatures()
+	features["wave_direction_4h"] = nil
+	features["trend_4h"] = -1
+	features["wave_invalidation_px_4h"] = 105.0
+
+	// follow_detected_trend 退回 trend_4h：空單，止損在上方
+	res := st.Evaluate(nil, Input{Symbol: "BTCUSDT", Features: features, Price: 100, NAV: 10000, NowMs: 0, AllowEntry: true})
+	if res.Position == nil || res.Position.Side != dao.PosShort || res.Intents[0].Side != dao.SideSell {
+		t.Fatalf("expected short entry, got %+v", res)
+	}
+	short := res.Position
+
+	// 觸及無效化價：INVALIDATED
+	res = st.Evaluate(short, Input{Symbol: "BTCUSDT", Features: features, Price: 105.2, NowMs: hourMs})
+	if res.Position.State != StateInvalidated || res.Intents[0].Kind != dao.IntentExit || res.Intents[0].Side != dao.SideBuy {
+		t.Errorf("invalidation: %+v", res)
+	}
+	if short.State != StateActiveConfirmed {
+		t.Error("Evaluate must not mutate the previous position")
+	}
+
+	// 96 小時未達目標：時間止損
+	res = st.Evaluate(short, Input{Symbol: "BTCUSDT", Features: features, Price: 100.5, NowMs: 96 * hourMs})
+	if res.Position.State != StateClosed || res.Position.ExitReason != "time_stop" {
+		t.Errorf("time stop: %+v", res.Position)
+	}
+
+	// 1D 反向只標記 HTF_WARN，不出場
+	features["trend_1d"] = 1
+	delete(features, "atr_4h")
+	res = st.Evaluate(short, Input{Symbol: "BTCUSDT", Features: features, Price: 100.5, NowMs: hourMs})
+	if len(res.Intents) != 0 || len(res.Warnings) != 1 || len(res.Position.Tags) != 1 || res.Position.Tags[0] != "HTF_WARN" {
+		t.Errorf("advisory: intents=%+v warnings=%v tags=%v", res.Intents, res.Warnings, res.Position.Tags)
+	}
+}
+
+func TestEvaluate_OnOpposite(t *testing.T) {
+	opposite := entryFeatures()
+	opposite["wave_direction_4h"] = "DOWN"
+	opposite["wave_invalidation_px_4h"] = 105.0
+
+	for _, mode := range []string{OppositeHold, OppositeClose, OppositeFlip} {
+		st := loadSpec(t, "ew_trend_follow_4h_anchor_v1")
+		st.Spec.Entry.OnOpposite = mode
+		open := st.Evaluate(nil, Input{Symbol: "BTCUSDT", Features: entryFeatures(), Price: 100, NAV: 10000, AllowEntry: true})
+		res := st.Evaluate(open.Position, Input{Symbol: "BTCUSDT", Features: opposite, Price: 100, NAV: 10000, NowMs: hourMs, AllowEntry: true})
+
+		switch mode {
+		case OppositeHold:
+			// 只剩追蹤止損調整，不平倉
+			for _, intent := range res.Intents {
+				if intent.Kind != dao.IntentSL {
+					t.Errorf("hold: unexpected intent %+v", intent)
+				}
+			}
+			if res.Position.Side != dao.PosLong || IsTerminal(res.Position.State) {
+				t.Errorf("hold: intents=%+v position=%+v", res.Intents, res.Position)
+			}
+		case OppositeClose:
+			if len(res.Intents) != 1 || res.Intents[0].Kind != dao.IntentExit || !res.Intents[0].ReduceOnly || res.Intents[0].Side != dao.SideSell ||
+				!approx(res.Intents[0].Qty, 25) || res.Position.State != StateClosed || res.Position.ExitReason != "opposite_signal" {
+				t.Errorf("close: intents=%+v position=%+v", res.Intents, res.Position)
+			}
+		case OppositeFlip:
+			// 平多 25 → 空單進場（風險 125 / 止損距離 5）→ 空單硬止損
+			if len(res.Intents) != 3 || res.Intents[0].Kind != dao.IntentExit || res.Intents[1].Kind != dao.IntentEntry ||
+				res.Intents[1].Side != dao.SideSell || !approx(res.Intents[1].Qty, 25) || res.Intents[2].TriggerPx != 105 || res.Intents[2].Side != dao.SideBuy {
+				t.Fatalf("flip intents = %+v", res.Intents)
+			}
+			if res.Position.Side != dao.PosShort || res.Position.State != StateActiveConfirmed || res.Intents[2].Seq <= res.Intents[0].Seq {
+				t.Errorf("flip position = %+v", res.Position)
+			}
+			if len(res.Transitions) != 2 || res.Transitions[0].To != StateClosed || res.Transitions[1].From != StateClosed {
+				t.Errorf("flip transitions = %+v", res.Transitions)
+			}
+		}
+	}
+}
+
+func TestEvaluate_EntryGuards(t *testing.T) {
+	st := loadSpec(t, "ew_trend_follow_4h_anchor_v1")
+
+	cases := []struct {
+		mutate func(f dao.FeatureSet, in *Input)
+		want   string
+	}{
+		{func(f dao.FeatureSet, in *Input) { in.AllowEntry = false }, "entries disabled"},
+		{func(f dao.FeatureSet, in *Input) { in.Symbol = "SOLUSDT" }, "symbol out of scope"},
+		{func(f dao.FeatureSet, in *Input) { delete(f, "rvol_4h") }, "entry condition not met"},
+		{func(f dao.FeatureSet, in *Input) { f["wave_invalidation_px_4h"] = 101.0 }, "invalid stop"},
+		{func(f dao.FeatureSet, in *Input) { in.NAV = 0 }, "nav unavailable"},
+	}
+	for _, tc := range cases {
+		features := entryFeatures()
+		in := Input{Symbol: "BTCUSDT", Features: features, Price: 100, NAV: 10000, AllowEntry: true}
+		tc.mutate(features, &in)
+		res := st.Evaluate(nil, in)
+		if res.Position != nil || !strings.HasPrefix(res.Skipped, tc.want) {
+			t.Errorf("want skip %q, got %q (%+v)", tc.want, res.Skipped, res.Position)
+		}
+	}
+}
+
+func TestEvaluate_Filters(t *testing.T) {
+	st := loadSpec(t, "ew_trend_follow_4h_anchor_v1")
+	features := entryFeatures()
+	features["wave_invalidation_px_4h"] = 95.3
+	filters := sizing.Filters{TickSize: 0.25, StepSize: 1, MinQty: 1, MinNotional: 5}
+
+	// 止損 95.3 往下取整為 95.25；數量 125 / 4.75 = 26.3 捨去為 26
+	res := st.Evaluate(nil, Input{Symbol: "BTCUSDT", Features: features, Price: 100, NAV: 10000, AllowEntry: true, Filters: filters})
+	if len(res.Intents) != 2 || res.Intents[0].Qty != 26 || res.Intents[1].TriggerPx != 95.25 || res.Position.Qty != 26 || res.Position.StopPx != 95.25 {
+		t.Fatalf("entry = %+v", res.Intents)
+	}
+
+	// fib 0.5 × W1 減倉 33%：26 × 0.33 = 8.58 捨去為 8
+	features["wave_signal_4h"] = "none"
+	res = st.Evaluate(res.Position, Input{Symbol: "BTCUSDT", Features: features, Price: 105.5, NAV: 10000, NowMs: hourMs, Filters: filters})
+	if tp := res.Intents[1]; tp.Kind != dao.IntentTP || tp.Qty != 8 || res.Position.Qty != 18 {
+		t.Errorf("partial tp = %+v, remaining %v", res.Intents, res.Position.Qty)
+	}
+
+	// 低於最小下單量不進場
+	filters.MinQty = 30
+	features["wave_signal_4h"] = "end_of_2_confirmed"
+	if res = st.Evaluate(nil, Input{Symbol: "BTCUSDT", Features: features, Price: 100, NAV: 10000, AllowEntry: true, Filters: filters}); res.Position != nil || res.Skipped != "qty 26 below min qty 30" {
+		t.Errorf("below min qty = %+v", res)
+	}
+}
+
+func TestMemoryPositionStore_Conflict(t *testing.T) {
+	store := NewMemoryPositionStore()
+	ctx := context.Background()
+
+	first := &Position{Strategy: "s", Symbol: "BTCUSDT", State: StateActiveConfirmed}
+	if err := store.Save(ctx, first); err != nil || first.Rev != 1 {
+		t.Fatalf("first save: rev=%d err=%v", first.Rev, err)
+	}
+
+	stale := &Position{Strategy: "s", Symbol: "BTCUSDT", State: StateClosed}
+	if err := store.Save(ctx, stale); err != ErrConflict {
+		t.Errorf("expected ErrConflict, got %v", err)
+	}
+}
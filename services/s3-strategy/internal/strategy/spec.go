@@ -0,0 +1,435 @@
+package strategy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"s3-strategy/internal/dsl"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Spec 策略規格（EW 文件「S3 DSL 範本」YAML）
+type Spec struct {
+	Strategy     string           `yaml:"strategy"`
+	Scope        ScopeSpec        `yaml:"scope"`
+	AnchorTF     string           `yaml:"anchor_tf"`
+	Entry        EntrySpec        `yaml:"entry"`
+	AddOn        *AddOnSpec       `yaml:"add_on"`
+	Risk         RiskSpec         `yaml:"risk"`
+	StateMachine StateMachineSpec `yaml:"state_machine"`
+	Exit         ExitSpec         `yaml:"exit"`
+	Advisory     AdvisorySpec     `yaml:"advisory"`
+}
+
+type ScopeSpec struct {
+	Symbols []string `yaml:"symbols"` // 空白表示不限
+	TF      string   `yaml:"tf"`
+}
+
+type EntrySpec struct {
+	When       interface{} `yaml:"when"`  // 規則 DSL（結構化或文字表達式）
+	Side       string      `yaml:"side"`  // long|short|follow_detected_trend
+	Price      string      `yaml:"price"` // maker_preferred|market
+	Size       SizeSpec    `yaml:"size"`
+	OnOpposite string      `yaml:"on_opposite"` // 持倉中出現反向進場信號：hold（預設）|close|flip
+}
+
+type SizeSpec struct {
+	Mode             string          `yaml:"mode"` // risk_by_invalidation|fixed_notional
+	BaseRiskPctOfNav float64         `yaml:"base_risk_pct_of_nav"`
+	Conviction       *ConvictionSpec `yaml:"conviction"`
+	StopRef          string          `yaml:"stop_ref"`      // 無效化價特徵
+	NotionalUSDT     float64         `yaml:"notional_usdt"` // fixed_notional 使用
+}
+
+// ConvictionSpec 信任度倍率：clamp(1 + slope × (clamp(var, 0.5, 0.95) − pivot), lower, upper)
+type ConvictionSpec struct {
+	Var   string  `yaml:"var"`
+	Lower float64 `yaml:"lower"`
+	Upper float64 `yaml:"upper"`
+	Pivot float64 `yaml:"pivot"`
+	Slope float64 `yaml:"slope"`
+}
+
+// AddOnSpec 加倉條件（同 anchor_tf 事件且 RR 達門檻，每次不超過初始數量的 size_frac）
+type AddOnSpec struct {
+	On           []string `yaml:"on"`
+	MinRR        float64  `yaml:"min_rr"`
+	SizeFrac     float64  `yaml:"size_frac"`
+	MaxAdds      int      `yaml:"max_adds"`
+	TightenATRTo float64  `yaml:"tighten_atr_to"`
+}
+
+type RiskSpec struct {
+	HardStop string `yaml:"hard_stop"` // 硬止損特徵（不可移除）
+}
+
+type StateMachineSpec struct {
+	Initial     string           `yaml:"initial"`
+	Transitions []TransitionSpec `yaml:"transitions"`
+}
+
+// TransitionSpec 狀態轉移：on 為 anchor_tf 事件名，when 為選用的 DSL 條件（兩者皆設時須同時成立）
+type TransitionSpec struct {
+	On     string      `yaml:"on"`
+	When   interface{} `yaml:"when"`
+	From   []string    `yaml:"from"`
+	To     string      `yaml:"to"`
+	Action ActionSpec  `yaml:"action"`
+}
+
+// ActionSpec 出場/轉移動作
+type ActionSpec struct {
+	TakeProfit   float64 `yaml:"take_profit"`    // 平倉比例（占初始數量；≥1 全平）
+	MoveStopTo   string  `yaml:"move_stop_to"`   // breakeven|last_pivot|breakeven_or_last_pivot
+	TightenATRTo float64 `yaml:"tighten_atr_to"` // 追蹤止損 ATR 倍數收緊至
+	SetFlag      string  `yaml:"set_flag"`       // name=true|false
+}
+
+type ExitSpec struct {
+	Ladder   []LadderStep  `yaml:"ladder"`
+	Trailing *TrailingSpec `yaml:"trailing"`
+	TimeStop *TimeStopSpec `yaml:"time_stop"`
+}
+
+// LadderStep 出場階梯：kind=rr 以風險倍數觸發；kind=fib_leg 以 entry ± mult × |leg| 觸發
+type LadderStep struct {
+	Kind   string     `yaml:"kind"`
+	RR     float64    `yaml:"rr"`
+	TF     string     `yaml:"tf"`
+	Leg    string     `yaml:"leg"`
+	Mult   float64    `yaml:"mult"`
+	Action ActionSpec `yaml:"action"`
+}
+
+type TrailingSpec struct {
+	Mode           string      `yaml:"mode"` // atr
+	TF             string      `yaml:"tf"`
+	ATRMultInitial float64     `yaml:"atr_mult_initial"`
+	ATRMultAfterRR *RRMultSpec `yaml:"atr_mult_after_rr"`
+}
+
+type RRMultSpec struct {
+	RR   float64 `yaml:"rr"`
+	Mult float64 `yaml:"mult"`
+}
+
+// TimeStopSpec 時間止損；hours 可為數值或常數表達式（如 24*14）
+type TimeStopSpec struct {
+	Hours interface{} `yaml:"hours"`
+}
+
+type AdvisorySpec struct {
+	WarnIfHigherTFConflict []string   `yaml:"warn_if_higher_tf_conflict"`
+	WarnIfLowerTFConflict  []string   `yaml:"warn_if_lower_tf_conflict"`
+	OnWarn                 OnWarnSpec `yaml:"on_warn"`
+}
+
+type OnWarnSpec struct {
+	SetTag           []string `yaml:"set_tag"`
+	NoPositionAction string   `yaml:"no_position_action"` // keep
+}
+
+// 持倉狀態（EW 文件第 7 節）
+const (
+	StateActiveConfirmed   = "ACTIVE_CONFIRMED"
+	StateActiveWarning     = "ACTIVE_WARNING"
+	StateActiveReducedRisk = "ACTIVE_REDUCED_RISK"
+	StatePendingExit       = "PENDING_EXIT"
+	StateClosed            = "CLOSED"
+	StateInvalidated       = "INVALIDATED"
+)
+
+var knownStates = map[string]bool{
+	StateActiveConfirmed: true, StateActiveWarning: true, StateActiveReducedRisk: true,
+	StatePendingExit: true, StateClosed: true, StateInvalidated: true,
+}
+
+// IsTerminal 是否為結束狀態（可重新進場）
+func IsTerminal(state string) bool {
+	return state == "" || state == StateClosed || state == StateInvalidated
+}
+
+// 反向信號處理（entry.on_opposite）
+const (
+	OppositeHold  = "hold"  // 維持原持倉，交由出場規則處理
+	OppositeClose = "close" // 全數平倉（reduce-only），不反向進場
+	OppositeFlip  = "flip"  // 平倉後依新方向進場
+)
+
+// 尺寸模式
+const (
+	SizeRiskByInvalidation = "risk_by_invalidation"
+	SizeFixedNotional      = "fixed_notional"
+)
+
+var stopTargets = map[string]bool{"breakeven": true, "last_pivot": true, "breakeven_or_last_pivot": true}
+
+// Strategy 編譯後的策略規格
+type Strategy struct {
+	Spec          Spec
+	entry         *dsl.Program
+	transitions   []*dsl.Program // 與 Spec.StateMachine.Transitions 對應；未設 when 為 nil
+	flags         []flagAction   // 與 transitions 對應
+	ladderFlags   []flagAction   // 與 Exit.Ladder 對應
+	timeStopHours float64
+	breakevenRR   float64
+}
+
+type flagAction struct {
+	name  string
+	value bool
+}
+
+// Name 策略名
+func (st *Strategy) Name() string { return st.Spec.Strategy }
+
+// Applies 是否涵蓋該交易對
+func (st *Strategy) Applies(symbol string) bool {
+	if len(st.Spec.Scope.Symbols) == 0 {
+		return true
+	}
+	for _, s := range st.Spec.Scope.Symbols {
+		if strings.EqualFold(s, symbol) {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse 解析並編譯策略 YAML
+func Parse(data []byte) (*Strategy, error) {
+	var spec Spec
+	if err := yaml.UnmarshalStrict(data, &spec); err != nil {
+		return nil, fmt.Errorf("invalid strategy spec: %w", err)
+	}
+	return Compile(spec)
+}
+
+// Compile 驗證並編譯策略規格
+func Compile(spec Spec) (*Strategy, error) {
+	if spec.Strategy == "" {
+		return nil, fmt.Errorf("strategy: name is required")
+	}
+	fail := func(format string, args ...interface{}) error {
+		return fmt.Errorf("strategy %s: %s", spec.Strategy, fmt.Sprintf(format, args...))
+	}
+
+	if spec.AnchorTF == "" {
+		spec.AnchorTF = spec.Scope.TF
+	}
+	if spec.AnchorTF == "" {
+		return nil, fail("anchor_tf is required")
+	}
+
+	st := &Strategy{Spec: spec, breakevenRR: 1.0}
+
+	if spec.Entry.When == nil {
+		return nil, fail("entry.when is required")
+	}
+	entry, err := dsl.CompileValue(spec.Entry.When)
+	if err != nil {
+		return nil, fail("entry.when: %v", err)
+	}
+	st.entry = entry
+
+	switch strings.ToLower(spec.Entry.Side) {
+	case "long", "buy", "short", "sell", "follow_detected_trend":
+	default:
+		return nil, fail("entry.side %q must be long, short or follow_detected_trend", spec.Entry.Side)
+	}
+
+	switch strings.ToLower(spec.Entry.OnOpposite) {
+	case "":
+		st.Spec.Entry.OnOpposite = OppositeHold
+	case OppositeHold, OppositeClose, OppositeFlip:
+		st.Spec.Entry.OnOpposite = strings.ToLower(spec.Entry.OnOpposite)
+	default:
+		return nil, fail("entry.on_opposite %q must be %s, %s or %s", spec.Entry.OnOpposite, OppositeHold, OppositeClose, OppositeFlip)
+	}
+
+	size := spec.Entry.Size
+	switch size.Mode {
+	case SizeRiskByInvalidation:
+		if size.BaseRiskPctOfNav <= 0 || size.BaseRiskPctOfNav > 100 {
+			return nil, fail("entry.size.base_risk_pct_of_nav must be in (0, 100]")
+		}
+		if size.StopRef == "" && spec.Risk.HardStop == "" {
+			return nil, fail("entry.size.stop_ref or risk.hard_stop is required for %s", SizeRiskByInvalidation)
+		}
+		if c := size.Conviction; c != nil && (c.Var == "" || c.Lower <= 0 || c.Upper < c.Lower) {
+			return nil, fail("entry.size.conviction requires var and 0 < lower <= upper")
+		}
+	case SizeFixedNotional:
+		if size.NotionalUSDT <= 0 {
+			return nil, fail("entry.size.notional_usdt must be positive")
+		}
+	default:
+		return nil, fail("entry.size.mode %q must be %s or %s", size.Mode, SizeRiskByInvalidation, SizeFixedNotional)
+	}
+
+	if spec.StateMachine.Initial == "" {
+		st.Spec.StateMachine.Initial = StateActiveConfirmed
+	} else if !knownStates[spec.StateMachine.Initial] || IsTerminal(spec.StateMachine.Initial) {
+		return nil, fail("state_machine.initial %q is not an active state", spec.StateMachine.Initial)
+	}
+	for i, tr := range spec.StateMachine.Transitions {
+		if tr.On == "" && tr.When == nil {
+			return nil, fail("state_machine.transitions[%d]: on or when is required", i)
+		}
+		if !knownStates[tr.To] {
+			return nil, fail("state_machine.transitions[%d]: unknown state %q", i, tr.To)
+		}
+		for _, from := range tr.From {
+			if !knownStates[from] {
+				return nil, fail("state_machine.transitions[%d]: unknown from state %q", i, from)
+			}
+		}
+		var program *dsl.Program
+		if tr.When != nil {
+			if program, err = dsl.CompileValue(tr.When); err != nil {
+				return nil, fail("state_machine.transitions[%d].when: %v", i, err)
+			}
+		}
+		st.transitions = append(st.transitions, program)
+
+		flag, err := parseAction(tr.Action)
+		if err != nil {
+			return nil, fail("state_machine.transitions[%d].action: %v", i, err)
+		}
+		st.flags = append(st.flags, flag)
+	}
+
+	breakevenSet := false
+	for i, step := range spec.Exit.Ladder {
+		switch step.Kind {
+		case "rr":
+			if step.RR <= 0 {
+				return nil, fail("exit.ladder[%d]: rr must be positive", i)
+			}
+			if !breakevenSet && step.Action.MoveStopTo != "" {
+				st.breakevenRR, breakevenSet = step.RR, true
+			}
+		case "fib_leg":
+			if step.Leg == "" || step.Mult <= 0 {
+				return nil, fail("exit.ladder[%d]: fib_leg requires leg and a positive mult", i)
+			}
+			if step.TF != "" && step.TF != spec.AnchorTF {
+				return nil, fail("exit.ladder[%d]: tf %s differs from anchor_tf %s", i, step.TF, spec.AnchorTF)
+			}
+		default:
+			return nil, fail("exit.ladder[%d]: unknown kind %q", i, step.Kind)
+		}
+		flag, err := parseAction(step.Action)
+		if err != nil {
+			return nil, fail("exit.ladder[%d].action: %v", i, err)
+		}
+		st.ladderFlags = append(st.ladderFlags, flag)
+	}
+
+	if tr := spec.Exit.Trailing; tr != nil {
+		if tr.Mode != "atr" || tr.ATRMultInitial <= 0 {
+			return nil, fail("exit.trailing requires mode atr and a positive atr_mult_initial")
+		}
+		if tr.TF != "" && tr.TF != spec.AnchorTF {
+			return nil, fail("exit.trailing.tf %s differs from anchor_tf %s", tr.TF, spec.AnchorTF)
+		}
+	}
+
+	if ts := spec.Exit.TimeStop; ts != nil {
+		hours, err := constantNumber(ts.Hours)
+		if err != nil || hours <= 0 {
+			return nil, fail("exit.time_stop.hours %v must be a positive number", ts.Hours)
+		}
+		st.timeStopHours = hours
+	}
+
+	if add := spec.AddOn; add != nil {
+		if len(add.On) == 0 || add.SizeFrac <= 0 || add.SizeFrac > 1 {
+			return nil, fail("add_on requires on events and size_frac in (0, 1]")
+		}
+		if add.MaxAdds <= 0 {
+			st.Spec.AddOn.MaxAdds = 1
+		}
+	}
+
+	return st, nil
+}
+
+// parseAction 驗證動作並解析 set_flag
+func parseAction(action ActionSpec) (flagAction, error) {
+	if action.TakeProfit < 0 {
+		return flagAction{}, fmt.Errorf("take_profit must not be negative")
+	}
+	if action.MoveStopTo != "" && !stopTargets[action.MoveStopTo] {
+		return flagAction{}, fmt.Errorf("unknown move_stop_to %q", action.MoveStopTo)
+	}
+	if action.SetFlag == "" {
+		return flagAction{}, nil
+	}
+	name, raw := action.SetFlag, "true"
+	if idx := strings.Index(action.SetFlag, "="); idx >= 0 {
+		name, raw = strings.TrimSpace(action.SetFlag[:idx]), strings.TrimSpace(action.SetFlag[idx+1:])
+	}
+	value, err := strconv.ParseBool(raw)
+	if err != nil || name == "" {
+		return flagAction{}, fmt.Errorf("invalid set_flag %q", action.SetFlag)
+	}
+	return flagAction{name: name, value: value}, nil
+}
+
+// constantNumber 數值或常數表達式（如 "24*14"）
+func constantNumber(v interface{}) (float64, error) {
+	if s, ok := v.(string); ok {
+		program, err := dsl.Compile(s)
+		if err != nil {
+			return 0, err
+		}
+		if len(program.Features()) > 0 {
+			return 0, fmt.Errorf("expression %q must not reference features", s)
+		}
+		v = program.Value(dsl.MapEnv{}).Interface()
+	}
+	value := dsl.FromAny(v)
+	if value.Kind != dsl.KindNumber {
+		return 0, fmt.Errorf("not a number: %v", v)
+	}
+	return value.Num, nil
+}
+
+// LoadDir 載入目錄下所有 *.yaml / *.yml 策略規格（依檔名排序）；策略名重複視為錯誤
+func LoadDir(dir string) ([]*Strategy, error) {
+	var files []string
+	for _, pattern := range []string{"*.yaml", "*.yml"} {
+		matches, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	sort.Strings(files)
+
+	seen := make(map[string]string)
+	var strategies []*Strategy
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		st, err := Parse(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Base(file), err)
+		}
+		if prev, dup := seen[st.Name()]; dup {
+			return nil, fmt.Errorf("%s: strategy %s already defined in %s", filepath.Base(file), st.Name(), prev)
+		}
+		seen[st.Name()] = filepath.Base(file)
+		strategies = append(strategies, st)
+	}
+	return strategies, nil
+}
@@ -1,17 +1,28 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"math"
 	"net/http"
 	"os"
+	"regexp"
 	"s3-strategy/dao"
+	"s3-strategy/internal/calendar"
 	"s3-strategy/internal/config"
+	"s3-strategy/internal/dsl"
+	"s3-strategy/internal/gbdt"
+	"s3-strategy/internal/risk"
+	"s3-strategy/internal/scorer"
 	"s3-strategy/internal/services/arangodb"
 	"s3-strategy/internal/services/redis"
+	"s3-strategy/internal/sizing"
+	"s3-strategy/internal/strategy"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -32,162 +43,332 @@ type GateKeeper struct {
 	spotQuoteUsdtMax           float64
 	futMarginUsdtMax           float64
 	concurrentEntriesPerMarket int
+
+	// 風險預算暫占（Redis 原子；nil 時不檢查）
+	budget *risk.Budget
 }
 
 func (gk *GateKeeper) Check(req *dao.DecideRequest, features dao.FeatureSet) (bool, string) {
-	// 資金費上限檢查
-	if fundingNext, ok := features["funding_next"].(float64); ok {
-		if math.Abs(fundingNext) > gk.maxFundingAbs {
-			return false, fmt.Sprintf("funding rate too high: %.6f > %.6f", math.Abs(fundingNext), gk.maxFundingAbs)
+	passed, reason, _ := gk.CheckTrace(req, features)
+	return passed, reason
+}
+
+// CheckTrace 逐項守門並記錄觀測值與門檻；缺值的特徵不檢查，回傳第一個失敗原因
+func (gk *GateKeeper) CheckTrace(req *dao.DecideRequest, features dao.FeatureSet) (bool, string, []dao.GateTrace) {
+	var gates []dao.GateTrace
+	passed, reason := true, "gate check passed"
+	check := func(gate, feature, op string, threshold float64, abs bool, format string) {
+		trace := dao.GateTrace{Gate: gate, Feature: feature, Op: op, Threshold: threshold, Passed: true}
+		if v, ok := features[feature].(float64); ok {
+			if abs {
+				v = math.Abs(v)
+			}
+			trace.Observed = &v
+			trace.Passed = (op == "<=" && v <= threshold) || (op == ">=" && v >= threshold)
+			if !trace.Passed && passed {
+				passed, reason = false, fmt.Sprintf(format, v, threshold)
+			}
+		} else {
+			trace.Note = "missing"
 		}
+		gates = append(gates, trace)
 	}
 
+	// 資金費上限檢查
+	check("funding", "funding_next", "<=", gk.maxFundingAbs, true, "funding rate too high: %.6f > %.6f")
+
 	// 流動性檢查
-	if spreadBps, ok := features["spread_bps"].(float64); ok {
-		if spreadBps > gk.spreadBpLimit {
-			return false, fmt.Sprintf("spread too wide: %.2f bps > %.2f bps", spreadBps, gk.spreadBpLimit)
+	check("spread", "spread_bps", "<=", gk.spreadBpLimit, false, "spread too wide: %.2f bps > %.2f bps")
+	check("depth", "depth_top1_usdt", ">=", gk.depthTop1UsdtMin, false, "insufficient depth: %.2f USDT < %.2f USDT")
+
+	// 風險預算預檢（併發數/額度已滿時提早略過；實際暫占於產生意圖後由 Reserve 原子完成）
+	if gk.budget != nil && !req.DryRun {
+		trace := dao.GateTrace{Gate: "risk_budget"}
+		if !passed {
+			trace.Note = "skipped"
+		} else {
+			ctx, cancel := context.WithTimeout(context.Background(), riskBudgetTimeout)
+			ok, budgetReason, err := gk.budget.Headroom(ctx, req.Symbol, req.Market)
+			cancel()
+			switch {
+			case err != nil:
+				passed, reason = false, fmt.Sprintf("%s: budget unavailable: %v", reasonRiskBudget, err)
+			case !ok:
+				passed, reason = false, fmt.Sprintf("%s: %s", reasonRiskBudget, budgetReason)
+			default:
+				trace.Passed = true
+			}
+			if !trace.Passed {
+				trace.Note = reason
+			}
 		}
+		gates = append(gates, trace)
 	}
 
-	if depthTop1Usdt, ok := features["depth_top1_usdt"].(float64); ok {
-		if depthTop1Usdt < gk.depthTop1UsdtMin {
-			return false, fmt.Sprintf("insufficient depth: %.2f USDT < %.2f USDT", depthTop1Usdt, gk.depthTop1UsdtMin)
-		}
+	return passed, reason, gates
+}
+
+// Reserve 為入場意圖暫占帳戶層併發數與額度；Redis 失敗時保守拒絕
+func (gk *GateKeeper) Reserve(intent *dao.OrderIntent) (bool, string) {
+	if gk.budget == nil {
+		return true, ""
 	}
+	return reserveBudget(gk.budget, intent)
+}
 
-	// 風險預算檢查
-	if req.Market == dao.MarketSPOT {
-		// TODO: 檢查現貨名義金額限制
-	} else if req.Market == dao.MarketFUT {
-		// TODO: 檢查期貨保證金限制
+// reserveBudget 暫占意圖的併發數與額度（FUT 以保證金、SPOT 以名義金額計）
+func reserveBudget(budget *risk.Budget, intent *dao.OrderIntent) (bool, string) {
+	amount := intent.NotionalUSDT
+	if intent.Market == dao.MarketFUT && intent.Leverage > 0 {
+		amount = intent.NotionalUSDT / float64(intent.Leverage)
 	}
 
-	return true, "gate check passed"
+	ctx, cancel := context.WithTimeout(context.Background(), riskBudgetTimeout)
+	defer cancel()
+	ok, reason, err := budget.Reserve(ctx, risk.Reservation{
+		IntentID: intent.IntentID,
+		Symbol:   intent.Symbol,
+		Market:   intent.Market,
+		Amount:   amount,
+	})
+	if err != nil {
+		return false, fmt.Sprintf("%s: budget unavailable: %v", reasonRiskBudget, err)
+	}
+	if !ok {
+		return false, fmt.Sprintf("%s: %s", reasonRiskBudget, reason)
+	}
+	return true, ""
 }
 
 // RuleEngine L1 規則引擎
+//
+// 規則條件在載入時編譯為 AST（internal/dsl）；編譯失敗的規則記錄錯誤且永不命中。
 type RuleEngine struct {
-	rules map[string]*dao.StrategyRule
+	rules    map[string]*dao.StrategyRule
+	programs map[string]*dsl.Program
+	errors   map[string]error
 }
 
-func (re *RuleEngine) Evaluate(req *dao.DecideRequest, features dao.FeatureSet) (*dao.Decision, []string) {
-	var firedRules []string
-	var sizeMult, tpMult, slMult float64 = 1.0, 1.0, 1.0
+func NewRuleEngine() *RuleEngine {
+	return &RuleEngine{
+		rules:    make(map[string]*dao.StrategyRule),
+		programs: make(map[string]*dsl.Program),
+		errors:   make(map[string]error),
+	}
+}
+
+// LoadRule 編譯並登錄規則；回傳編譯錯誤（規則仍登錄，但不會命中）
+func (re *RuleEngine) LoadRule(rule *dao.StrategyRule) error {
+	re.rules[rule.RuleID] = rule
+	delete(re.programs, rule.RuleID)
+	delete(re.errors, rule.RuleID)
+
+	program, err := dsl.Compile(rule.Conditions)
+	if err != nil {
+		re.errors[rule.RuleID] = err
+		return fmt.Errorf("rule %s: %w", rule.RuleID, err)
+	}
+	re.programs[rule.RuleID] = program
+	return nil
+}
 
+// sortedRules 依優先序（高者先）與 RuleID 排序，確保評估順序穩定
+func (re *RuleEngine) sortedRules() []*dao.StrategyRule {
+	rules := make([]*dao.StrategyRule, 0, len(re.rules))
 	for _, rule := range re.rules {
+		rules = append(rules, rule)
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		if rules[i].Priority != rules[j].Priority {
+			return rules[i].Priority > rules[j].Priority
+		}
+		return rules[i].RuleID < rules[j].RuleID
+	})
+	return rules
+}
+
+// 倍率白名單範圍
+var multiplierBounds = []struct {
+	name     string
+	min, max float64
+}{
+	{"size_mult", 0.1, 2.0},
+	{"tp_mult", 1.0, 3.0},
+	{"sl_mult", 0.1, 1.0},
+}
+
+// 規則類型：ENTRY 只影響進場倍率；EXIT 只對既有持倉出場；RISK 兩者皆可
+const (
+	ruleTypeEntry = "ENTRY"
+	ruleTypeExit  = "EXIT"
+	ruleTypeRisk  = "RISK"
+)
+
+// ruleExit EXIT/RISK 規則命中時對既有持倉的動作（比例皆以目前持倉數量計）
+type ruleExit struct {
+	RuleID     string
+	Exit       float64 // 減倉比例；1 為全平
+	TakeProfit float64 // 停利減倉比例
+	MoveStopTo string  // breakeven：止損移至進場價（只收緊）
+}
+
+// parseRuleExit 解析出場動作：exit / take_profit / move_stop_to；
+// EXIT 規則未帶出場動作時，size_mult < 1 視為保留該比例（減倉 1 − size_mult），否則全平
+func parseRuleExit(rule *dao.StrategyRule, actions map[string]interface{}) (ruleExit, bool) {
+	exit := ruleExit{RuleID: rule.RuleID}
+	exit.Exit, _ = actions["exit"].(float64)
+	exit.TakeProfit, _ = actions["take_profit"].(float64)
+	exit.MoveStopTo, _ = actions["move_stop_to"].(string)
+	exit.Exit = math.Min(math.Max(exit.Exit, 0), 1)
+	exit.TakeProfit = math.Min(math.Max(exit.TakeProfit, 0), 1)
+	if exit.Exit > 0 || exit.TakeProfit > 0 || exit.MoveStopTo != "" {
+		return exit, true
+	}
+	if rule.RuleType != ruleTypeExit {
+		return exit, false
+	}
+	exit.Exit = 1
+	if mult, ok := actions["size_mult"].(float64); ok && mult > 0 && mult < 1 {
+		exit.Exit = 1 - mult
+	}
+	return exit, true
+}
+
+func (re *RuleEngine) Evaluate(req *dao.DecideRequest, features dao.FeatureSet) (*dao.Decision, []string) {
+	decision, firedRules, _ := re.evaluate(req, features, nil)
+	return decision, firedRules
+}
+
+// evaluate 依序評估規則：ENTRY/RISK 規則合成進場倍率，EXIT/RISK 規則的出場動作另行回傳（僅對既有持倉生效）。
+// firedRules 只列出影響進場倍率的規則；trace 非 nil 時記錄每條規則的條件明細與 clamp 前後倍率
+func (re *RuleEngine) evaluate(req *dao.DecideRequest, features dao.FeatureSet, trace *dao.DecisionTrace) (*dao.Decision, []string, []ruleExit) {
+	var firedRules []string
+	var exits []ruleExit
+	products := map[string]float64{"size_mult": 1.0, "tp_mult": 1.0, "sl_mult": 1.0}
+
+	for _, rule := range re.sortedRules() {
+		var ruleTrace *dao.RuleTrace
+		if trace != nil {
+			trace.Rules = append(trace.Rules, re.explainRule(rule, features))
+			ruleTrace = &trace.Rules[len(trace.Rules)-1]
+		}
 		if !rule.Enabled {
 			continue
 		}
 
-		if re.evaluateRule(rule, req, features) {
-			firedRules = append(firedRules, rule.RuleID)
+		if !re.evaluateRule(rule, req, features) {
+			continue
+		}
 
-			// 解析規則動作
-			var actions map[string]interface{}
-			if err := json.Unmarshal([]byte(rule.Actions), &actions); err == nil {
-				if mult, ok := actions["size_mult"].(float64); ok {
-					sizeMult *= mult
-				}
-				if mult, ok := actions["tp_mult"].(float64); ok {
-					tpMult *= mult
-				}
-				if mult, ok := actions["sl_mult"].(float64); ok {
-					slMult *= mult
+		// 解析規則動作（格式錯誤時視為無動作）
+		var actions map[string]interface{}
+		_ = json.Unmarshal([]byte(rule.Actions), &actions)
+		if rule.RuleType == ruleTypeExit || rule.RuleType == ruleTypeRisk {
+			if exit, ok := parseRuleExit(rule, actions); ok {
+				exits = append(exits, exit)
+			}
+		}
+		if rule.RuleType == ruleTypeExit {
+			continue
+		}
+
+		firedRules = append(firedRules, rule.RuleID)
+		for _, bound := range multiplierBounds {
+			if mult, ok := actions[bound.name].(float64); ok {
+				products[bound.name] *= mult
+				if ruleTrace != nil {
+					if ruleTrace.Actions == nil {
+						ruleTrace.Actions = make(map[string]float64)
+					}
+					ruleTrace.Actions[bound.name] = mult
 				}
 			}
 		}
 	}
 
 	// Clamp 到白名單範圍
-	sizeMult = math.Max(0.1, math.Min(2.0, sizeMult))
-	tpMult = math.Max(1.0, math.Min(3.0, tpMult))
-	slMult = math.Max(0.1, math.Min(1.0, slMult))
+	values := make(map[string]float64, len(multiplierBounds))
+	for _, bound := range multiplierBounds {
+		product := products[bound.name]
+		values[bound.name] = math.Max(bound.min, math.Min(bound.max, product))
+		if trace != nil {
+			trace.Multipliers = append(trace.Multipliers, dao.MultiplierTrace{
+				Name:    bound.name,
+				Product: product,
+				Min:     bound.min,
+				Max:     bound.max,
+				Value:   values[bound.name],
+				Clamped: values[bound.name] != product,
+			})
+		}
+	}
 
 	decision := &dao.Decision{
 		Action:   dao.DecisionOpen,
-		SizeMult: sizeMult,
-		TPMult:   tpMult,
-		SLMult:   slMult,
+		SizeMult: values["size_mult"],
+		TPMult:   values["tp_mult"],
+		SLMult:   values["sl_mult"],
 		Reason:   fmt.Sprintf("Rules fired: %v", firedRules),
 	}
 
-	return decision, firedRules
+	return decision, firedRules, exits
 }
 
-func (re *RuleEngine) evaluateRule(rule *dao.StrategyRule, req *dao.DecideRequest, features dao.FeatureSet) bool {
-	var conditions map[string]interface{}
-	if err := json.Unmarshal([]byte(rule.Conditions), &conditions); err != nil {
-		return false
+// explainRule 規則結果與條件明細（停用規則仍列出條件供比對）
+func (re *RuleEngine) explainRule(rule *dao.StrategyRule, features dao.FeatureSet) dao.RuleTrace {
+	trace := dao.RuleTrace{RuleID: rule.RuleID, RuleType: rule.RuleType, Priority: rule.Priority}
+	program, ok := re.programs[rule.RuleID]
+	if !ok {
+		trace.Result = "ERROR"
+		if err := re.errors[rule.RuleID]; err != nil {
+			trace.Error = err.Error()
+		}
+		return trace
 	}
-
-	// 簡化的條件評估（實際實現需要更複雜的 DSL 解析）
-	if allOf, ok := conditions["allOf"].([]interface{}); ok {
-		for _, condition := range allOf {
-			if condMap, ok := condition.(map[string]interface{}); ok {
-				if !re.evaluateCondition(condMap, features) {
-					return false
-				}
-			}
+	result, conditions := program.Explain(dsl.MapEnv(features))
+	trace.Result = result
+	trace.Fired = rule.Enabled && result == "TRUE"
+	if !rule.Enabled {
+		trace.Result = "DISABLED"
+	}
+	for _, c := range conditions {
+		condition := dao.RuleCondition{Expr: c.Expr, Result: c.Result}
+		for _, o := range c.Operands {
+			condition.Operands = append(condition.Operands, dao.RuleOperand{Expr: o.Expr, Value: o.Value})
 		}
+		trace.Conditions = append(trace.Conditions, condition)
 	}
-
-	return true
+	return trace
 }
 
-func (re *RuleEngine) evaluateCondition(condition map[string]interface{}, features dao.FeatureSet) bool {
-	feature, _ := condition["f"].(string)
-	operator, _ := condition["op"].(string)
-	value, _ := condition["v"].(float64)
-
-	if featureValue, exists := features[feature]; exists {
-		if fv, ok := featureValue.(float64); ok {
-			switch operator {
-			case "<":
-				return fv < value
-			case ">":
-				return fv > value
-			case "<=":
-				return fv <= value
-			case ">=":
-				return fv >= value
-			case "==":
-				return fv == value
-			}
-		}
+// evaluateRule 條件結果為 TRUE 才命中；缺值（UNKNOWN）或未編譯的規則不命中
+func (re *RuleEngine) evaluateRule(rule *dao.StrategyRule, req *dao.DecideRequest, features dao.FeatureSet) bool {
+	program, ok := re.programs[rule.RuleID]
+	if !ok {
+		return false
 	}
-
-	return false
+	return program.Match(dsl.MapEnv(features))
 }
 
 // MLModel L2 機器學習模型
 type MLModel struct {
 	modelName string
 	version   string
+
+	// 樹集成模型（XGBoost/LightGBM）；未載入時使用啟發式分數
+	predictor *gbdt.Predictor
 }
 
 func (ml *MLModel) Predict(features dao.FeatureSet) (float64, float64) {
-	// 模擬 ML 模型預測
-	// 實際實現會調用訓練好的模型
-
-	// 基於特徵計算置信度分數
-	score := 0.5 // 基礎分數
-
-	if atr, ok := features["atr_pct"].(float64); ok {
-		if atr < 1.0 { // 低波動
-			score += 0.1
-		}
+	if ml.predictor != nil {
+		p, _ := ml.predictor.Probability(features)
+		return p, math.Abs(p-0.5) * 2
 	}
 
-	if rv, ok := features["rv_pct"].(float64); ok {
-		if rv < 0.25 { // 低波動率分位
-			score += 0.15
-		}
-	}
-
-	if correlation, ok := features["correlation"].(float64); ok {
-		if correlation < -0.3 { // 負相關
-			score += 0.1
-		}
+	// 未載入模型：基於特徵的啟發式分數
+	score := 0.5 // 基礎分數
+	for _, term := range heuristicTerms(features) {
+		score += term.Contribution
 	}
 
 	// Clamp 分數到 [0, 1]
@@ -199,6 +380,38 @@ func (ml *MLModel) Predict(features dao.FeatureSet) (float64, float64) {
 	return score, confidence
 }
 
+// heuristicTerms 啟發式分數的加分項（未命中的條件不列出）
+func heuristicTerms(features dao.FeatureSet) []dao.FeatureContribution {
+	var terms []dao.FeatureContribution
+	if atr, ok := features["atr_pct"].(float64); ok && atr < 1.0 { // 低波動
+		terms = append(terms, dao.FeatureContribution{Feature: "atr_pct", Value: atr, Contribution: 0.1})
+	}
+	if rv, ok := features["rv_pct"].(float64); ok && rv < 0.25 { // 低波動率分位
+		terms = append(terms, dao.FeatureContribution{Feature: "rv_pct", Value: rv, Contribution: 0.15})
+	}
+	if correlation, ok := features["correlation"].(float64); ok && correlation < -0.3 { // 負相關
+		terms = append(terms, dao.FeatureContribution{Feature: "correlation", Value: correlation, Contribution: 0.1})
+	}
+	return terms
+}
+
+// Explain 主要特徵貢獻：樹模型為原始分數（margin）的缺值替換差，啟發式為各加分項
+func (ml *MLModel) Explain(features dao.FeatureSet, topK int) []dao.FeatureContribution {
+	var out []dao.FeatureContribution
+	if ml.predictor != nil {
+		for _, c := range ml.predictor.Model.Contributions(features) {
+			out = append(out, dao.FeatureContribution{Feature: c.Feature, Value: c.Value, Contribution: c.Margin})
+		}
+	} else {
+		out = heuristicTerms(features)
+		sort.SliceStable(out, func(i, j int) bool { return out[i].Contribution > out[j].Contribution })
+	}
+	if len(out) > topK {
+		out = out[:topK]
+	}
+	return out
+}
+
 func (ml *MLModel) GetSizeMultiplier(score float64) float64 {
 	// 基於分數的倉位倍率
 	if score > 0.85 {
@@ -212,33 +425,52 @@ func (ml *MLModel) GetSizeMultiplier(score float64) float64 {
 	}
 }
 
-// ConfigManager 配置管理器
+// ConfigSnapshot 單一配置版本的規則與引擎；發布後唯讀，熱載時整組替換（RCU）
+type ConfigSnapshot struct {
+	Config   *dao.StrategyConfig
+	Rules    map[string]*dao.StrategyRule
+	Engine   *RuleEngine
+	Calendar *calendar.Calendar // 交易時段與停止交易事件；nil 時不限制
+	BundleID string
+	LoadedAt time.Time
+
+	engines sync.Map // 策略實例名 → 規則子集引擎（engineFor）
+}
+
+// Rev 配置版本（內建預設規則為 0）
+func (cs *ConfigSnapshot) Rev() int {
+	return cs.Config.ConfigRev
+}
+
+// ConfigManager 配置管理器；決策開始時取得快照，進行中的決策不受熱載影響
 type ConfigManager struct {
-	activeConfigRev int
-	configCache     map[int]*dao.StrategyConfig
+	active    atomic.Pointer[ConfigSnapshot]
+	candidate atomic.Pointer[Candidate]
+}
+
+func (cm *ConfigManager) Active() *ConfigSnapshot {
+	return cm.active.Load()
 }
 
-func (cm *ConfigManager) GetActiveConfig() *dao.StrategyConfig {
-	return cm.configCache[cm.activeConfigRev]
+func (cm *ConfigManager) Swap(snapshot *ConfigSnapshot) {
+	cm.active.Store(snapshot)
 }
 
-func (cm *ConfigManager) LoadConfig(rev int) error {
-	// TODO: 從 ArangoDB 加載配置
-	config := &dao.StrategyConfig{
-		ConfigRev:   rev,
-		ConfigName:  "default",
-		Parameters:  make(map[string]interface{}),
-		Rules:       []string{"R-001", "R-002"},
-		Instruments: []string{"BTCUSDT", "ETHUSDT"},
-		Status:      "ACTIVE",
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
+// Rev 目前生效的 config_active.rev
+func (cm *ConfigManager) Rev() int {
+	if snapshot := cm.active.Load(); snapshot != nil {
+		return snapshot.Rev()
 	}
+	return 0
+}
 
-	cm.configCache[rev] = config
-	cm.activeConfigRev = rev
+// Candidate 推廣中的候選版本；無候選時為 nil
+func (cm *ConfigManager) Candidate() *Candidate {
+	return cm.candidate.Load()
+}
 
-	return nil
+func (cm *ConfigManager) SetCandidate(candidate *Candidate) {
+	cm.candidate.Store(candidate)
 }
 
 type S3_STRATEGYServer struct {
@@ -250,14 +482,41 @@ type S3_STRATEGYServer struct {
 
 	// 策略引擎組件
 	gateKeeper    *GateKeeper
-	ruleEngine    *RuleEngine
 	mlModel       *MLModel
+	remoteScorer  scorer.Scorer // 模型即服務；nil 時使用本地模型
 	configManager *ConfigManager
 
-	// 配置快取
-	activeConfig *dao.StrategyConfig
-	activeRules  map[string]*dao.StrategyRule
-	configMutex  sync.RWMutex
+	// 倉位計算（S1 價格/NAV、instrument_registry）
+	sizing     sizingConfig
+	marketData MarketData
+
+	// 規則路徑方向與持倉（有號特徵、反向信號處理、加倉上限）
+	direction directionConfig
+
+	// 組合層預檢（相關性、策略/資產類額度、淨 Delta）；nil 時不檢查
+	portfolio *portfolioGate
+
+	// 規則路徑策略實例（空值為單一 rules 實例）與停止進場開關；killSwitches 為 nil 時不檢查
+	instances     []*ruleInstance
+	specInstances map[string]*ruleInstance // 策略規格的額度實例（strategies.risk）
+	killSwitches  risk.KillSwitchStore
+
+	// 決策冪等（signal_id + 配置版本；nil 時不保存）與批次設定
+	decisions  DecisionStore
+	decideOpts decideConfig
+
+	// 串流決策與冗餘心跳（decision_loop 未啟用時為 nil）
+	decisionLoop *decisionLoop
+
+	// 策略規格（YAML）與持倉狀態
+	strategies     []*strategy.Strategy
+	strategyRunner *strategy.Runner
+	navUSDT        float64
+
+	// 配置熱載（同一時間只執行一次載入；rejected*Rev 避免重複載入同一失敗版本）
+	reloadMutex          sync.Mutex
+	rejectedRev          int
+	rejectedCandidateRev int
 
 	// 風險管理
 	riskLimits      map[string]float64
@@ -269,10 +528,9 @@ func NewS3_STRATEGYServer() *S3_STRATEGYServer {
 	server := &S3_STRATEGYServer{
 		redisClient:     redis.GetInstance(),
 		arangodbClient:  arangodb.GetInstance(),
-		validator:       validator.New(),
+		validator:       newValidator(),
 		version:         "v1.0.0",
 		startTime:       time.Now(),
-		activeRules:     make(map[string]*dao.StrategyRule),
 		riskLimits:      make(map[string]float64),
 		positionTracker: make(map[string]float64),
 	}
@@ -287,28 +545,55 @@ func NewS3_STRATEGYServer() *S3_STRATEGYServer {
 		concurrentEntriesPerMarket: 1,
 	}
 
-	server.ruleEngine = &RuleEngine{
-		rules: make(map[string]*dao.StrategyRule),
-	}
-
 	server.mlModel = &MLModel{
 		modelName: "default_model",
 		version:   "v1.0",
 	}
 
-	server.configManager = &ConfigManager{
-		configCache: make(map[int]*dao.StrategyConfig),
-	}
+	server.configManager = &ConfigManager{}
 
 	// 加載配置和規則
 	server.loadConfiguration()
+	server.initializeStrategies()
+	server.initializeSizing()
+	server.direction = newDirectionConfig()
+	server.initializeRiskBudget()
+	server.initializePortfolioGate()
+	server.initializeMLModel()
+	server.initializeHostedStrategies()
+	server.initializeDecisionStore()
 
 	// 啟動配置監聽
-	go server.startConfigWatcher()
+	server.startConfigWatcher()
+
+	// 串流決策（feat:events）與冗餘心跳
+	server.initializeDecisionLoop()
+	server.startHeartbeat()
 
 	return server
 }
 
+// newValidator 建立驗證器並註冊 dao 標籤使用的自訂規則（regexp=<pattern>）
+func newValidator() *validator.Validate {
+	v := validator.New()
+
+	var patterns sync.Map
+	v.RegisterValidation("regexp", func(fl validator.FieldLevel) bool {
+		param := fl.Param()
+		re, ok := patterns.Load(param)
+		if !ok {
+			compiled, err := regexp.Compile(param)
+			if err != nil {
+				return false
+			}
+			re, _ = patterns.LoadOrStore(param, compiled)
+		}
+		return re.(*regexp.Regexp).MatchString(fl.Field().String())
+	})
+
+	return v
+}
+
 // @Summary Health check
 // @Description Check service health status
 // @Tags health
@@ -344,6 +629,14 @@ func (s *S3_STRATEGYServer) HealthCheck(c *gin.Context) {
 		Checks:   checks,
 		Notes:    "Exchange connectors running normally",
 	}
+	if snapshot := s.configManager.Active(); snapshot != nil {
+		response.ConfigRev = snapshot.Rev()
+		response.Checks = append(response.Checks, dao.HealthCheck{Name: "config", Status: dao.HealthOK})
+		response.Notes = fmt.Sprintf("config rev %d (%s), %d rules loaded", snapshot.Rev(), snapshot.BundleID, len(snapshot.Rules))
+	}
+	if candidate := s.configManager.Candidate(); candidate != nil {
+		response.Notes += fmt.Sprintf("; candidate rev %d (%s %s, %d%% traffic)", candidate.Rev(), candidate.Snapshot.BundleID, candidate.Mode, candidate.TrafficPct)
+	}
 
 	c.JSON(http.StatusOK, response)
 }
@@ -375,7 +668,9 @@ func (s *S3_STRATEGYServer) ReadyCheck(c *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param request body apispec.DecideRequest true "Decision request"
+// @Param explain query bool false "Return the decision trace"
 // @Success 200 {object} apispec.DecideResponse
+// @Failure 409 {object} map[string]string
 // @Router /decide [post]
 func (s *S3_STRATEGYServer) Decide(c *gin.Context) {
 	var req dao.DecideRequest
@@ -390,61 +685,231 @@ func (s *S3_STRATEGYServer) Decide(c *gin.Context) {
 		return
 	}
 
+	response, err := s.decideOnce(c.Request.Context(), &req)
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Decision in progress", "details": err.Error()})
+		return
+	}
+	if c.Query("explain") != "true" {
+		stripTraces(&response)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// decide 決策管線（L0 → 停止進場開關 → 策略規格 → 各規則路徑實例）；HTTP 與串流決策共用。
+// 有候選版本時依分流選出執行版本，另一版本只評估 L1 並記錄影子決策。
+func (s *S3_STRATEGYServer) decide(req *dao.DecideRequest) dao.DecideResponse {
+	// 本次決策全程使用同一配置版本（熱載只影響下一筆）
+	snapshot, role, shadow, shadowRole := s.configManager.route(req)
+	run := &decideRun{
+		req:      req,
+		snapshot: snapshot,
+		tag:      configTag{Rev: snapshot.Rev(), Role: role},
+		commit:   !req.DryRun,
+		scores:   make(map[*MLModel]scoredModel),
+		now:      time.Now(),
+	}
+	if shadow != nil {
+		run.shadow = shadow
+		run.shadowTag = configTag{Rev: shadow.Rev(), Role: shadowRole, Shadow: true}
+	}
+
+	// 價格、NAV 與交易所限制只查詢一次（各實例的倉位計算、出場判斷與影子版本共用）
+	run.inputs = sync.OnceValues(func() (pricingInputs, error) { return s.loadPricingInputs(req) })
+
 	// L0 守門檢查
-	passed, reason := s.gateKeeper.Check(&req, req.Features)
+	run.passed, run.reason, run.gates = s.gateKeeper.CheckTrace(req, req.Features)
+
+	// 停止進場開關（全域、策略、交易對）：啟動時只允許出場
+	instances := s.hostedFor(req.Symbol)
+	run.kills = s.killSwitchState(req.Symbol, instances)
+
+	// 策略規格：守門未通過（含該策略的交易時段/停止交易事件）或開關啟動時仍管理既有持倉（出場），但不進場
+	strategyIntents, transitions := s.evaluateStrategies(req, func(name string) bool {
+		passed, _, _ := s.instanceGate(run, name)
+		return passed && run.kills.reason(name) == ""
+	})
+	tagIntents(strategyIntents, run.tag)
+
+	response := dao.DecideResponse{
+		Transitions: transitions,
+		ConfigRev:   run.tag.Rev,
+		ConfigRole:  run.tag.Role,
+	}
+	if len(instances) == 0 {
+		decision := &dao.Decision{Action: dao.DecisionSkip, Reason: fmt.Sprintf("no hosted strategy covers %s", req.Symbol)}
+		trace := &dao.DecisionTrace{Gates: run.gates}
+		s.saveSignal(req, run.tag, decision, nil, nil, trace)
+		response.Decision, response.Intents, response.Trace = *decision, strategyIntents, trace
+		return response
+	}
+
+	// 規則路徑：各實例依序評估（持倉、額度與信號記錄各自獨立）
+	for _, inst := range instances {
+		out, intents := s.decideInstance(run, inst)
+		response.Strategies = append(response.Strategies, out)
+		response.Intents = append(response.Intents, intents...)
+	}
+	response.Intents = append(response.Intents, strategyIntents...)
+
+	// 頂層決策為第一個非 skip 的實例（皆 skip 時為第一個）
+	primary := response.Strategies[0]
+	for _, out := range response.Strategies {
+		if out.Decision.Action != dao.DecisionSkip {
+			primary = out
+			break
+		}
+	}
+	response.Decision, response.Shadow, response.Trace = primary.Decision, primary.Shadow, primary.Trace
+	return response
+}
+
+// decideInstance 單一策略實例：L1（實例規則子集）→ L2 → 規則路徑持倉 → 暫占；守門未通過時只處理出場。
+// 有候選版本時以同一實例的規則子集影子評估。
+func (s *S3_STRATEGYServer) decideInstance(run *decideRun, inst *ruleInstance) (dao.StrategyDecision, []dao.OrderIntent) {
+	req := run.req
+	path := rulePath{
+		req:    req,
+		inst:   inst,
+		held:   s.rulePosition(inst.name, req.Symbol),
+		inputs: run.inputs,
+		killed: run.kills.reason(inst.name),
+	}
+	passed, gateReason, gates := s.instanceGate(run, inst.name)
+	newTrace := func() *dao.DecisionTrace {
+		return &dao.DecisionTrace{Gates: gates, KillSwitch: path.killed, Position: s.direction.positionTrace(req.Features, path.held)}
+	}
+	trace := newTrace()
+	engine := run.snapshot.engineFor(inst)
+
 	if !passed {
-		response := dao.DecideResponse{
-			Decision: dao.Decision{
-				Action: dao.DecisionSkip,
-				Reason: reason,
-			},
+		// 不進場，但既有持倉仍處理止損與 EXIT/RISK 規則
+		decision := &dao.Decision{Action: dao.DecisionSkip, Reason: gateReason, Strategy: inst.name}
+		var exits []ruleExit
+		if isOpen(path.held) {
+			_, _, exits = engine.evaluate(req, req.Features, trace)
 		}
-		c.JSON(http.StatusOK, response)
-		return
+		intents := s.executeRulePath(path, decision, exits, 0, 0, trace, run.commit)
+		tagIntents(intents, run.tag)
+		s.saveSignal(req, run.tag, decision, nil, nil, trace)
+		out := dao.StrategyDecision{Strategy: inst.name, Decision: *decision, Trace: trace}
+		if run.shadow != nil {
+			shadowDecision := &dao.Decision{Action: dao.DecisionSkip, Reason: gateReason, Strategy: inst.name}
+			shadowTrace := newTrace()
+			var shadowExits []ruleExit
+			if isOpen(path.held) {
+				_, _, shadowExits = run.shadow.engineFor(inst).evaluate(req, req.Features, shadowTrace)
+			}
+			s.executeRulePath(path, shadowDecision, shadowExits, 0, 0, shadowTrace, false)
+			s.saveSignal(req, run.shadowTag, shadowDecision, nil, nil, shadowTrace)
+			out.Shadow = &dao.ShadowDecision{ConfigRev: run.shadowTag.Rev, ConfigRole: run.shadowTag.Role, Decision: *shadowDecision}
+		}
+		return out, intents
 	}
 
-	// L1 規則引擎評估
-	decision, firedRules := s.ruleEngine.Evaluate(&req, req.Features)
+	// L1 規則引擎評估（EXIT/RISK 規則的出場動作只作用於既有持倉）
+	decision, firedRules, exits := engine.evaluate(req, req.Features, trace)
+	decision.Strategy = inst.name
+	ruleSizeMult := decision.SizeMult
 
-	// L2 ML 模型評分
-	mlScore, confidence := s.mlModel.Predict(req.Features)
-	mlSizeMult := s.mlModel.GetSizeMultiplier(mlScore)
+	// L2 ML 模型評分（模型逾時/不健康或純規則旗標時只用規則倉位）
+	modelScore, contributions := s.instanceScore(run, inst)
+	mlSizeMult := 1.0
+	if modelScore.Path != dao.ModelPathRulesOnly {
+		mlSizeMult = s.mlModel.GetSizeMultiplier(modelScore.Score)
+	}
+	trace.Model = &dao.ModelTrace{
+		Path:           modelScore.Path,
+		Model:          modelScore.ModelName,
+		Version:        modelScore.ModelVersion,
+		Score:          modelScore.Score,
+		Confidence:     modelScore.Confidence,
+		SizeMult:       mlSizeMult,
+		FallbackReason: modelScore.FallbackReason,
+		Contributions:  contributions,
+	}
 
 	// 合併規則和 ML 結果
-	finalSizeMult := decision.SizeMult * mlSizeMult
+	applyModel(decision, firedRules, modelScore, mlSizeMult)
+
+	// 規則路徑：既有持倉出場、依方向進場/加倉/反手（送出前暫占風險預算，未通過則略過）
+	intents := s.executeRulePath(path, decision, exits, ruleSizeMult, mlSizeMult, trace, run.commit)
+	tagIntents(intents, run.tag)
+
+	// 保存信號
+	s.saveSignal(req, run.tag, decision, firedRules, modelScore, trace)
+	out := dao.StrategyDecision{Strategy: inst.name, Decision: *decision, RulesFired: firedRules, Trace: trace}
+
+	// 影子評估：同一守門、模型分數與既有持倉，只換 L1 規則；不下單、不暫占、不寫回持倉
+	if run.shadow != nil {
+		shadowTrace := newTrace()
+		shadowTrace.Model = trace.Model
+		shadowDecision, shadowFired, shadowExits := run.shadow.engineFor(inst).evaluate(req, req.Features, shadowTrace)
+		shadowDecision.Strategy = inst.name
+		shadowRuleSizeMult := shadowDecision.SizeMult
+		applyModel(shadowDecision, shadowFired, modelScore, mlSizeMult)
+		s.executeRulePath(path, shadowDecision, shadowExits, shadowRuleSizeMult, mlSizeMult, shadowTrace, false)
+		s.saveSignal(req, run.shadowTag, shadowDecision, shadowFired, modelScore, shadowTrace)
+		out.Shadow = &dao.ShadowDecision{
+			ConfigRev:  run.shadowTag.Rev,
+			ConfigRole: run.shadowTag.Role,
+			Decision:   *shadowDecision,
+			RulesFired: shadowFired,
+		}
+	}
+	return out, intents
+}
+
+// applyModel 以 L2 倍率調整規則決策；模型建議跳過時改為 skip
+func applyModel(decision *dao.Decision, firedRules []string, modelScore *dao.ModelScore, mlSizeMult float64) {
 	if mlSizeMult == 0.0 {
 		decision.Action = dao.DecisionSkip
 		decision.Reason = "ML model recommends skip"
+	} else if modelScore.Path == dao.ModelPathRulesOnly {
+		decision.Reason = fmt.Sprintf("Rules: %v, ML: rules-only (%s)", firedRules, modelScore.FallbackReason)
 	} else {
-		decision.SizeMult = finalSizeMult
-		decision.Reason = fmt.Sprintf("Rules: %v, ML Score: %.3f", firedRules, mlScore)
+		decision.SizeMult *= mlSizeMult
+		decision.Reason = fmt.Sprintf("Rules: %v, ML Score: %.3f", firedRules, modelScore.Score)
 	}
+}
 
-	// 生成訂單意圖
-	var intents []dao.OrderIntent
-	if decision.Action == dao.DecisionOpen && !req.DryRun {
-		intent := s.generateOrderIntent(&req, decision)
-		intents = append(intents, intent)
+// sizeDecision 進場/加倉計算倉位並記錄追蹤；方向取 decision.Side（空白時依無效化價），加倉時 heldQty 為既有持倉。
+// 缺失效價/價格/NAV、失效價與方向不符、既有持倉已達上限或低於交易所下限時改為 skip
+func (s *S3_STRATEGYServer) sizeDecision(req *dao.DecideRequest, decision *dao.Decision, ruleSizeMult, mlSizeMult, qtyFrac, heldQty float64, inputs func() (pricingInputs, error), trace *dao.DecisionTrace) (sizing.Result, bool) {
+	sized, sizingTrace, err := s.sizePosition(req, decision.SizeMult, decision.Side, qtyFrac, heldQty, inputs)
+	sizingTrace.RuleSizeMult, sizingTrace.MLSizeMult = ruleSizeMult, mlSizeMult
+	trace.Sizing = sizingTrace
+	if err != nil {
+		decision.Action = dao.DecisionSkip
+		decision.Reason = "sizing: " + err.Error()
+		return sized, false
 	}
+	return sized, true
+}
 
-	// 保存信號
-	s.saveSignal(&req, decision, firedRules, mlScore, confidence)
-
-	response := dao.DecideResponse{
-		Decision: *decision,
-		Intents:  intents,
+// tagIntents 標記意圖的配置版本（S10 依版本比較 canary 成效）
+func tagIntents(intents []dao.OrderIntent, tag configTag) {
+	for i := range intents {
+		intents[i].ConfigRev = tag.Rev
+		intents[i].ConfigRole = tag.Role
 	}
-
-	c.JSON(http.StatusOK, response)
 }
 
-// generateOrderIntent 生成訂單意圖
-func (s *S3_STRATEGYServer) generateOrderIntent(req *dao.DecideRequest, decision *dao.Decision) dao.OrderIntent {
-	// 計算倉位大小
-	marginBase := 20.0 // USDT
-	margin := marginBase * decision.SizeMult
-	leverage := 20
-	notional := margin * float64(leverage)
+const (
+	signalsCollection = "signals"
+	signalSaveTimeout = 2 * time.Second
+)
+
+// generateOrderIntent 生成進場訂單意圖；方向取自倉位計算（信號方向），硬止損為取整後的無效化價
+func (s *S3_STRATEGYServer) generateOrderIntent(req *dao.DecideRequest, decision *dao.Decision, sized sizing.Result, entryPx float64) dao.OrderIntent {
+	side := dao.SideBuy
+	if !sized.Long {
+		side = dao.SideSell
+	}
+	leverage := s.sizing.leverage
+	if req.Market == dao.MarketSPOT {
+		leverage = 1
+	}
 
 	// 生成執行策略
 	execPolicy := dao.ExecPolicy{
@@ -452,121 +917,136 @@ func (s *S3_STRATEGYServer) generateOrderIntent(req *dao.DecideRequest, decision
 		MakerWaitMs:     2000,
 		TWAPSlices:      1,
 		GuardStopEnable: false,
-		TPPct:           decision.TPMult * 0.02, // 2% * TP倍率
-		SLPct:           decision.SLMult * 0.01, // 1% * SL倍率
+		TPPct:           decision.TPMult * 0.02,       // 2% * TP倍率
+		SLPct:           sized.StopDistance / entryPx, // 硬止損 = 無效化價
 	}
 
 	// 如果是 SPOT 市場，添加 OCO 策略
 	if req.Market == dao.MarketSPOT {
-		currentPrice := 50000.0 // 模擬價格
 		execPolicy.OCO = &dao.OCO{
-			TakeProfitPx: currentPrice * (1 + execPolicy.TPPct),
-			StopLossPx:   currentPrice * (1 - execPolicy.SLPct),
+			TakeProfitPx: entryPx * (1 + execPolicy.TPPct),
+			StopLossPx:   sized.StopPx,
 		}
 	}
 
+	// 同一信號重送時 intent_id 不變（S4 冪等、風險暫占不重複計入）
+	intentID := "intent_" + req.SignalID
+	if req.SignalID == "" {
+		intentID = fmt.Sprintf("intent_%d", time.Now().UnixNano())
+	}
+
 	return dao.OrderIntent{
-		IntentID:     fmt.Sprintf("intent_%s_%d", req.SignalID, time.Now().Unix()),
+		IntentID:     intentID,
 		Symbol:       req.Symbol,
 		Market:       req.Market,
 		Kind:         dao.IntentEntry,
-		Side:         dao.SideBuy, // 簡化為買入
-		NotionalUSDT: notional,
+		Side:         side,
+		NotionalUSDT: sized.NotionalUSDT,
 		Leverage:     leverage,
 		ExecPolicy:   execPolicy,
+		Qty:          sized.Qty,
 	}
 }
 
-// saveSignal 保存交易信號
-func (s *S3_STRATEGYServer) saveSignal(req *dao.DecideRequest, decision *dao.Decision, firedRules []string, mlScore, confidence float64) {
+// saveSignal 保存交易信號（含決策追蹤與配置版本）至 signals；守門未通過時 modelScore 為 nil
+func (s *S3_STRATEGYServer) saveSignal(req *dao.DecideRequest, tag configTag, decision *dao.Decision, firedRules []string, modelScore *dao.ModelScore, trace *dao.DecisionTrace) {
 	signal := &dao.Signal{
-		SignalID:  req.SignalID,
-		Symbol:    req.Symbol,
-		Market:    string(req.Market),
-		Features:  req.Features,
-		ConfigRev: 1, // TODO: 從配置管理器獲取
-		Timestamp: time.Now().UnixMilli(),
-		CreatedAt: time.Now(),
+		SignalID:   req.SignalID,
+		Symbol:     req.Symbol,
+		Market:     string(req.Market),
+		Features:   req.Features,
+		ConfigRev:  tag.Rev,
+		ConfigRole: tag.Role,
+		Shadow:     tag.Shadow,
+		Strategy:   decision.Strategy,
+		Decision:   decision,
+		Trace:      trace,
+		Timestamp:  time.Now().UnixMilli(),
+		CreatedAt:  time.Now(),
 	}
 
-	// TODO: 保存到 ArangoDB
-	log.Printf("Saved signal: %+v", signal)
+	if s.arangodbClient != nil && !req.DryRun {
+		ctx, cancel := context.WithTimeout(context.Background(), signalSaveTimeout)
+		defer cancel()
+		if err := s.insertSignal(ctx, signal); err != nil {
+			log.Printf("Failed to save signal %s: %v", signal.SignalID, err)
+		}
+	}
+	if tag.Shadow {
+		log.Printf("Saved shadow signal %s: %s %s (%s rev %d, %d rules fired)", signal.SignalID, decision.Action, decision.Reason, tag.Role, tag.Rev, len(firedRules))
+		return
+	}
+	log.Printf("Saved signal %s: %s %s (%s rev %d, %d rules fired)", signal.SignalID, decision.Action, decision.Reason, tag.Role, tag.Rev, len(firedRules))
+	if modelScore != nil {
+		log.Printf("Model score for %s: %.3f via %s (%s@%s, %dms) %s", signal.SignalID, modelScore.Score, modelScore.Path,
+			modelScore.ModelName, modelScore.ModelVersion, modelScore.LatencyMs, modelScore.FallbackReason)
+	}
 
 	// 發布到 Redis Stream
-	s.publishSignalToRedis(signal, decision, firedRules, mlScore, confidence)
+	s.publishSignalToRedis(signal, decision, firedRules, modelScore)
+}
+
+// signalKey signals 文件鍵：signal_id；rules 以外的策略實例加上 -<strategy>，影子記錄再加上 -shadow-r<rev>
+func signalKey(signal *dao.Signal) string {
+	if signal.SignalID == "" {
+		return ""
+	}
+	key := signal.SignalID
+	if signal.Strategy != "" && signal.Strategy != rulePathStrategy {
+		key += "-" + signal.Strategy
+	}
+	if signal.Shadow {
+		key = fmt.Sprintf("%s-shadow-r%d", key, signal.ConfigRev)
+	}
+	return key
+}
+
+// insertSignal 寫入 signals 集合（signalKey 為文件鍵；重送同一信號時覆寫）
+func (s *S3_STRATEGYServer) insertSignal(ctx context.Context, signal *dao.Signal) error {
+	col, err := s.arangodbClient.GetDB().Collection(ctx, signalsCollection)
+	if err != nil {
+		return err
+	}
+	key := signalKey(signal)
+	doc := struct {
+		Key string `json:"_key,omitempty"`
+		*dao.Signal
+	}{Key: key, Signal: signal}
+	if key == "" {
+		_, err = col.CreateDocument(ctx, doc)
+		return err
+	}
+	exists, err := col.DocumentExists(ctx, key)
+	if err != nil {
+		return err
+	}
+	if exists {
+		_, err = col.ReplaceDocument(ctx, key, doc)
+	} else {
+		_, err = col.CreateDocument(ctx, doc)
+	}
+	return err
 }
 
 // publishSignalToRedis 發布信號到 Redis
-func (s *S3_STRATEGYServer) publishSignalToRedis(signal *dao.Signal, decision *dao.Decision, firedRules []string, mlScore, confidence float64) {
+func (s *S3_STRATEGYServer) publishSignalToRedis(signal *dao.Signal, decision *dao.Decision, firedRules []string, modelScore *dao.ModelScore) {
 	// TODO: 實現 Redis Stream 發布
 	log.Printf("Publishing signal to Redis: %s", signal.SignalID)
 }
 
-// loadConfiguration 加載配置
+// loadConfiguration 先掛載內建預設規則（rev 0），再載入 config_active 指向的 Bundle
 func (s *S3_STRATEGYServer) loadConfiguration() {
-	// 加載策略配置
-	s.configManager.LoadConfig(1)
-
-	// 加載策略規則
-	s.loadStrategyRules()
-}
-
-// loadStrategyRules 加載策略規則
-func (s *S3_STRATEGYServer) loadStrategyRules() {
-	// 示例規則
-	rule1 := &dao.StrategyRule{
-		RuleID:     "R-001",
-		RuleName:   "Low Volatility Entry",
-		RuleType:   "ENTRY",
-		Conditions: `{"allOf":[{"f":"rv_pctile_30d","op":"<","v":0.25},{"f":"rho_usdttwd_14","op":"<","v":-0.3}]}`,
-		Actions:    `{"size_mult":1.2,"tp_mult":2.0,"sl_mult":0.5}`,
-		Priority:   50,
-		Enabled:    true,
-		ConfigRev:  1,
-		CreatedAt:  time.Now(),
-		UpdatedAt:  time.Now(),
-	}
-
-	rule2 := &dao.StrategyRule{
-		RuleID:     "R-002",
-		RuleName:   "High Correlation Exit",
-		RuleType:   "EXIT",
-		Conditions: `{"allOf":[{"f":"correlation","op":">","v":0.8}]}`,
-		Actions:    `{"size_mult":0.5}`,
-		Priority:   30,
-		Enabled:    true,
-		ConfigRev:  1,
-		CreatedAt:  time.Now(),
-		UpdatedAt:  time.Now(),
+	snapshot, err := buildConfigSnapshot(defaultBundle(), defaultStrategyRules())
+	if err != nil {
+		log.Fatalf("Failed to compile default strategy rules: %v", err)
 	}
+	s.configManager.Swap(snapshot)
 
-	s.configMutex.Lock()
-	s.activeRules["R-001"] = rule1
-	s.activeRules["R-002"] = rule2
-	s.ruleEngine.rules["R-001"] = rule1
-	s.ruleEngine.rules["R-002"] = rule2
-	s.configMutex.Unlock()
-}
-
-// startConfigWatcher 啟動配置監聽
-func (s *S3_STRATEGYServer) startConfigWatcher() {
-	ticker := time.NewTicker(1 * time.Minute)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ticker.C:
-			s.checkConfigUpdates()
-		}
+	if s.arangodbClient != nil {
+		s.reloadConfig()
 	}
 }
 
-// checkConfigUpdates 檢查配置更新
-func (s *S3_STRATEGYServer) checkConfigUpdates() {
-	// TODO: 檢查 Redis cfg:events 或 ArangoDB config_active.rev
-	log.Println("Checking for config updates...")
-}
-
 func main() {
 	// Load configuration (priority: env.local.yaml > env.yaml > config.yaml)
 	if err := config.LoadConfig(""); err != nil {
@@ -594,6 +1074,16 @@ func main() {
 
 	// Strategy routes
 	r.POST("/decide", s3Server.Decide)
+	r.POST("/decide/batch", s3Server.DecideBatch)
+	r.GET("/strategies", s3Server.ListStrategies)
+	r.GET("/strategies/:name/positions/:symbol", s3Server.GetStrategyPosition)
+	r.POST("/rules/test", s3Server.RunRuleTest)
+
+	// Risk routes
+	r.GET("/kill_switches", s3Server.ListKillSwitches)
+	r.PUT("/kill_switches", s3Server.SetKillSwitch)
+	r.DELETE("/kill_switches/:scope", s3Server.ClearKillSwitch)
+	r.DELETE("/kill_switches/:scope/:name", s3Server.ClearKillSwitch)
 
 	// Use configuration port, fallback to environment variable or default
 	port := os.Getenv("PORT")
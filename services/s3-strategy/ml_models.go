@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"s3-strategy/dao"
+	"s3-strategy/internal/config"
+	"s3-strategy/internal/gbdt"
+	"s3-strategy/internal/scorer"
+	"s3-strategy/internal/services/redis"
+	"sort"
+	"time"
+)
+
+// L2 模型來源與遠端評分預設值（env.yaml ml 區塊未設定時使用）
+const (
+	mlSourceFile            = "file"
+	mlSourceArango          = "arango"
+	defaultMLModelDir       = "models"
+	mlModelsCollection      = "ml_models"
+	defaultRemoteTimeout    = 50 * time.Millisecond
+	defaultRemoteHedgeAfter = 20 * time.Millisecond
+	defaultRemoteFailures   = 5
+	defaultRemoteCooldown   = 30 * time.Second
+	rulesOnlyFlagTimeout    = 20 * time.Millisecond
+	explainTopK             = 5
+	alertsStream            = "alerts"
+)
+
+// rulesOnlyKey S2 漂移/缺值告警時寫入的純規則旗標（per symbol，TTL 到期自動恢復）
+func rulesOnlyKey(symbol string) string {
+	return "prod:{strategy}:rules_only:" + symbol
+}
+
+func durationOr(raw string, fallback time.Duration) time.Duration {
+	if raw == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil || d < 0 {
+		log.Printf("Invalid duration %q, using %s", raw, fallback)
+		return fallback
+	}
+	return d
+}
+
+// initializeRemoteScorer 建立模型即服務用戶端；斷路器開啟/恢復時發布告警
+func (s *S3_STRATEGYServer) initializeRemoteScorer() {
+	cfg := config.AppConfig.ML.Remote
+	failures := cfg.FailureThreshold
+	if failures <= 0 {
+		failures = defaultRemoteFailures
+	}
+	breaker := scorer.NewBreaker(failures, durationOr(cfg.Cooldown, defaultRemoteCooldown))
+	breaker.OnStateChange(func(from, to scorer.BreakerState) {
+		severity := dao.SevInfo
+		if to == scorer.BreakerOpen {
+			severity = dao.SevWarn
+		}
+		s.publishAlert(severity, fmt.Sprintf("model service circuit %s -> %s; L2 falls back to rules-only sizing while open", from, to))
+	})
+	s.remoteScorer = scorer.NewHTTPScorer(scorer.HTTPConfig{
+		URL:        cfg.URL,
+		Timeout:    durationOr(cfg.Timeout, defaultRemoteTimeout),
+		HedgeAfter: durationOr(cfg.HedgeAfter, defaultRemoteHedgeAfter),
+		Breaker:    breaker,
+	})
+	log.Printf("Using remote model service %s", cfg.URL)
+}
+
+// scoreModel 策略實例的 L2 評分並記錄採用路徑：實例 rules_only 或純規則旗標 → RULES_ONLY；
+// 共用模型時遠端成功 → REMOTE、失敗 → RULES_ONLY；否則 LOCAL（實例專屬模型或共用模型）。
+// 另回傳前 explainTopK 名特徵貢獻（RULES_ONLY 時為空）。
+func (s *S3_STRATEGYServer) scoreModel(req *dao.DecideRequest, inst *ruleInstance) (*dao.ModelScore, []dao.FeatureContribution) {
+	model := s.mlModel
+	if inst.model != nil {
+		model = inst.model
+	}
+	start := time.Now()
+	score := &dao.ModelScore{
+		ScoreID:   fmt.Sprintf("score_%s_%d", req.SignalID, start.UnixNano()),
+		SignalID:  req.SignalID,
+		ModelName: model.modelName,
+		Timestamp: start.UnixMilli(),
+		CreatedAt: start,
+	}
+	defer func() { score.LatencyMs = time.Since(start).Milliseconds() }()
+
+	if inst.rulesOnly {
+		score.Path = dao.ModelPathRulesOnly
+		score.FallbackReason = "strategy " + inst.name + ": rules_only"
+		return score, nil
+	}
+
+	if reason, ok := s.rulesOnlyFlag(req.Symbol); ok {
+		score.Path = dao.ModelPathRulesOnly
+		score.FallbackReason = "rules_only flag: " + reason
+		return score, nil
+	}
+
+	if s.remoteScorer != nil && inst.model == nil {
+		res, err := s.remoteScorer.Score(context.Background(), scorer.Request{
+			SignalID: req.SignalID,
+			Symbol:   req.Symbol,
+			Features: req.Features,
+		})
+		if err != nil {
+			log.Printf("[WARN] Model service failed for %s, using rules-only sizing: %v", req.Symbol, err)
+			score.Path = dao.ModelPathRulesOnly
+			score.FallbackReason = err.Error()
+			return score, nil
+		}
+		score.Path = dao.ModelPathRemote
+		score.Score, score.Confidence = res.Probability, res.Confidence
+		if res.Model != "" {
+			score.ModelName = res.Model
+		}
+		score.ModelVersion = res.Version
+		return score, topContributions(res.Contributions, req.Features, explainTopK)
+	}
+
+	score.Path = dao.ModelPathLocal
+	score.ModelVersion = model.version
+	score.Score, score.Confidence = model.Predict(req.Features)
+	return score, model.Explain(req.Features, explainTopK)
+}
+
+// topContributions 遠端服務回傳的貢獻依絕對值排序取前 k 名
+func topContributions(contributions map[string]float64, features dao.FeatureSet, k int) []dao.FeatureContribution {
+	out := make([]dao.FeatureContribution, 0, len(contributions))
+	for name, c := range contributions {
+		out = append(out, dao.FeatureContribution{Feature: name, Value: features[name], Contribution: c})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if math.Abs(out[i].Contribution) != math.Abs(out[j].Contribution) {
+			return math.Abs(out[i].Contribution) > math.Abs(out[j].Contribution)
+		}
+		return out[i].Feature < out[j].Feature
+	})
+	if len(out) > k {
+		out = out[:k]
+	}
+	return out
+}
+
+// rulesOnlyFlag 讀取 S2 純規則旗標；Redis 未連線或讀取失敗時視為未設定
+func (s *S3_STRATEGYServer) rulesOnlyFlag(symbol string) (string, bool) {
+	if s.redisClient == nil {
+		return "", false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), rulesOnlyFlagTimeout)
+	defer cancel()
+	reason, err := s.redisClient.Client.Get(ctx, rulesOnlyKey(symbol)).Result()
+	if err != nil {
+		return "", false
+	}
+	return reason, true
+}
+
+// publishAlert 發布 alerts（S11 彙整）
+func (s *S3_STRATEGYServer) publishAlert(severity dao.Severity, message string) {
+	log.Printf("[%s] %s", severity, message)
+	if s.redisClient == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	alert := dao.Alert{
+		AlertID:  fmt.Sprintf("s3-model-%d", time.Now().UnixNano()),
+		Severity: severity,
+		Source:   "s3",
+		Message:  message,
+		Ts:       time.Now().UnixMilli(),
+	}
+	_, err := s.redisClient.PublishStream(ctx, alertsStream, redis.StreamMessage{
+		"alert_id": alert.AlertID,
+		"severity": string(alert.Severity),
+		"source":   alert.Source,
+		"message":  alert.Message,
+		"ts":       alert.Ts,
+	})
+	if err != nil {
+		log.Printf("Failed to publish alert: %v", err)
+	}
+}
+
+// initializeMLModel 依 env.yaml ml 區塊建立遠端評分或載入樹集成模型；失敗時保留啟發式分數
+func (s *S3_STRATEGYServer) initializeMLModel() {
+	cfg := config.AppConfig.ML
+	if cfg.Remote.URL != "" {
+		s.initializeRemoteScorer()
+	}
+	if cfg.Source == "" || cfg.Name == "" {
+		return
+	}
+
+	predictor, err := s.loadPredictor(cfg.Source, cfg.ModelDir, cfg.Name, cfg.Version)
+	if err != nil {
+		log.Printf("Failed to load ML model %s (%s): %v; using heuristic score", cfg.Name, cfg.Source, err)
+		return
+	}
+	s.mlModel.predictor = predictor
+	s.mlModel.modelName = predictor.Artifact.Name
+	s.mlModel.version = predictor.Artifact.Version
+	log.Printf("Loaded ML model %s@%s (%s, %d trees, %d features)",
+		predictor.Artifact.Name, predictor.Artifact.Version, predictor.Artifact.Format,
+		predictor.Model.NumTrees(), predictor.Model.NumFeatures())
+}
+
+func (s *S3_STRATEGYServer) loadPredictor(source, dir, name, version string) (*gbdt.Predictor, error) {
+	switch source {
+	case mlSourceFile:
+		if dir == "" {
+			dir = defaultMLModelDir
+		}
+		return gbdt.LoadFromDir(dir, name, version)
+	case mlSourceArango:
+		return s.loadPredictorFromArango(name, version)
+	default:
+		return nil, fmt.Errorf("unknown ml source %q", source)
+	}
+}
+
+// loadPredictorFromArango 讀取 ml_models 文件（模型內容內嵌於 content）；未指定版本時取 active 中最新者
+func (s *S3_STRATEGYServer) loadPredictorFromArango(name, version string) (*gbdt.Predictor, error) {
+	if s.arangodbClient == nil {
+		return nil, fmt.Errorf("arangodb not connected")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	query := `FOR m IN @@col
+		FILTER m.name == @name && (@version == "" ? m.active == true : m.version == @version)
+		SORT m.created_at DESC
+		LIMIT 1
+		RETURN m`
+	bindVars := map[string]interface{}{
+		"@col":    mlModelsCollection,
+		"name":    name,
+		"version": version,
+	}
+	cursor, err := s.arangodbClient.GetDB().Query(ctx, query, bindVars)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close()
+
+	if !cursor.HasMore() {
+		return nil, fmt.Errorf("model %s@%s not found in %s", name, version, mlModelsCollection)
+	}
+	var artifact gbdt.Artifact
+	if _, err := cursor.ReadDocument(ctx, &artifact); err != nil {
+		return nil, err
+	}
+	return gbdt.Load(artifact, []byte(artifact.Content))
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"s3-strategy/dao"
+	"s3-strategy/internal/scorer"
+)
+
+func TestScoreModel_Paths(t *testing.T) {
+	s := &S3_STRATEGYServer{mlModel: &MLModel{modelName: "default_model", version: "v1.0"}}
+	req := &dao.DecideRequest{SignalID: "sig-1", Symbol: "BTCUSDT", Features: dao.FeatureSet{"rsi": 55.0}}
+
+	if score, _ := s.scoreModel(req, defaultRuleInstance); score.Path != dao.ModelPathLocal || score.ModelVersion != "v1.0" {
+		t.Errorf("local score = %+v", score)
+	}
+
+	s.remoteScorer = scorer.Func(func(ctx context.Context, r scorer.Request) (scorer.Result, error) {
+		return scorer.Result{Probability: 0.9, Confidence: 0.8, Model: "xgb", Version: "v7"}, nil
+	})
+	score, _ := s.scoreModel(req, defaultRuleInstance)
+	if score.Path != dao.ModelPathRemote || score.Score != 0.9 || score.ModelName != "xgb" || score.ModelVersion != "v7" {
+		t.Errorf("remote score = %+v", score)
+	}
+
+	// 遠端失敗：不回退本地啟發式，改以純規則倉位（size_mult_ml = 1.0）
+	s.remoteScorer = scorer.Func(func(ctx context.Context, r scorer.Request) (scorer.Result, error) {
+		return scorer.Result{}, scorer.ErrCircuitOpen
+	})
+	score, _ = s.scoreModel(req, defaultRuleInstance)
+	if score.Path != dao.ModelPathRulesOnly || score.FallbackReason != scorer.ErrCircuitOpen.Error() {
+		t.Errorf("fallback score = %+v", score)
+	}
+
+	s.remoteScorer = scorer.Func(func(ctx context.Context, r scorer.Request) (scorer.Result, error) {
+		return scorer.Result{}, context.DeadlineExceeded
+	})
+	if score, _ := s.scoreModel(req, defaultRuleInstance); score.Path != dao.ModelPathRulesOnly {
+		t.Errorf("timeout score = %+v", score)
+	}
+}
@@ -0,0 +1,556 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"s3-strategy/dao"
+	"s3-strategy/internal/config"
+	"s3-strategy/internal/risk"
+	"s3-strategy/internal/sizing"
+	"s3-strategy/internal/strategy"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	goredis "github.com/go-redis/redis/v8"
+)
+
+// 組合層預檢預設值（env.yaml portfolio_gate 區塊未設定時使用）
+const (
+	defaultCorrelationKey     = "risk:correlation_matrix"
+	defaultCorrelationRefresh = time.Minute
+	defaultMaxPairRho         = 0.7
+	defaultStrategyCapPct     = 0.25
+	defaultAssetClass         = "crypto"
+	defaultNetDeltaLower      = -0.3
+	defaultNetDeltaUpper      = 0.3
+	portfolioTimeout          = 500 * time.Millisecond
+)
+
+// 違反時的處置
+const (
+	violationPreferHigherScore = "prefer_higher_score" // 分數低於相關持倉時拒單，否則降尺至額度內
+	violationDownsize          = "downsize_to_fit"
+	violationSkip              = "skip_entry"
+)
+
+// 預檢結果（PortfolioTrace.Action）
+const (
+	portfolioPass     = "pass"
+	portfolioDownsize = "downsize"
+	portfolioReject   = "reject"
+)
+
+// 檢查類型 → on_violation 鍵與預設處置
+var portfolioViolationKeys = map[string]string{
+	dao.RiskCheckCorrelation:    "correlation",
+	dao.RiskCheckStrategyBudget: "strategy_budget",
+	dao.RiskCheckAssetClass:     "asset_class",
+	dao.RiskCheckNetDelta:       "net_delta",
+}
+
+var defaultViolationActions = map[string]string{
+	dao.RiskCheckCorrelation:    violationPreferHigherScore,
+	dao.RiskCheckStrategyBudget: violationDownsize,
+	dao.RiskCheckAssetClass:     violationDownsize,
+	dao.RiskCheckNetDelta:       violationSkip,
+}
+
+// exposure 單一策略在單一交易對上的方向曝險（USDT 名義金額，持倉以進場價計）
+type exposure struct {
+	strategy string
+	symbol   string
+	side     dao.PosSide
+	notional float64
+	score    float64
+}
+
+func (e exposure) signed() float64 {
+	if e.side == dao.PosShort {
+		return -e.notional
+	}
+	return e.notional
+}
+
+// portfolioGate 規則路徑與策略規格進場前的組合層檢查：同方向高相關曝險合併計算、策略/資產類額度與淨 Delta 區間
+type portfolioGate struct {
+	maxPairRho       float64
+	combineRisk      bool
+	correlatedCapPct float64 // 0 取候選標的資產類上限
+	strategyCapPct   float64
+	byStrategy       map[string]float64
+	byAssetClass     map[string]float64
+	assetClasses     map[string]string
+	defaultClass     string
+	netDeltaLower    float64
+	netDeltaUpper    float64
+	onViolation      map[string]string
+
+	correlations *correlationMatrix
+	pending      risk.PendingBook
+	pendingTTL   time.Duration
+}
+
+// initializePortfolioGate 依 env.yaml portfolio_gate 區塊建立組合層預檢；未啟用時 s.portfolio 為 nil
+func (s *S3_STRATEGYServer) initializePortfolioGate() {
+	cfg := config.AppConfig.PortfolioGate
+	if !cfg.Enabled {
+		return
+	}
+	g := newPortfolioGate()
+
+	book := risk.PendingBook(risk.NewMemoryPendingBook())
+	matrix := &correlationMatrix{refresh: durationOr(cfg.CorrelationRefresh, defaultCorrelationRefresh)}
+	if s.redisClient != nil {
+		book = risk.NewRedisPendingBook(s.redisClient.Client)
+		key := cfg.CorrelationKey
+		if key == "" {
+			key = defaultCorrelationKey
+		}
+		matrix.fetch = redisCorrelations(s.redisClient.Client, key)
+	}
+	g.correlations, g.pending = matrix, book
+	if s.gateKeeper.budget != nil {
+		g.pendingTTL = s.gateKeeper.budget.Limits().ReservationTTL
+	}
+	s.portfolio = g
+	log.Printf("Portfolio gate enabled: max_pair_rho %.2f, strategy cap %.2f, net delta [%.2f, %.2f]",
+		g.maxPairRho, g.strategyCapPct, g.netDeltaLower, g.netDeltaUpper)
+}
+
+func newPortfolioGate() *portfolioGate {
+	cfg := config.AppConfig.PortfolioGate
+	g := &portfolioGate{
+		maxPairRho:       cfg.MaxPairRho,
+		combineRisk:      cfg.CombineRiskIfExceeds,
+		correlatedCapPct: cfg.CorrelatedCapPct,
+		strategyCapPct:   cfg.StrategyCapPct,
+		byStrategy:       cfg.ByStrategy,
+		byAssetClass:     cfg.ByAssetClass,
+		assetClasses:     cfg.AssetClasses,
+		defaultClass:     cfg.DefaultAssetClass,
+		netDeltaLower:    defaultNetDeltaLower,
+		netDeltaUpper:    defaultNetDeltaUpper,
+		onViolation:      make(map[string]string),
+		pendingTTL:       defaultReservationTTL,
+	}
+	if g.maxPairRho <= 0 || g.maxPairRho > 1 {
+		g.maxPairRho = defaultMaxPairRho
+	}
+	if g.strategyCapPct <= 0 {
+		g.strategyCapPct = defaultStrategyCapPct
+	}
+	if g.defaultClass == "" {
+		g.defaultClass = defaultAssetClass
+	}
+	if r := cfg.NetDeltaRange; len(r) == 2 && r[0] < r[1] {
+		g.netDeltaLower, g.netDeltaUpper = r[0], r[1]
+	} else if len(r) > 0 {
+		log.Printf("Invalid portfolio_gate.net_delta_range %v, using [%.2f, %.2f]", r, defaultNetDeltaLower, defaultNetDeltaUpper)
+	}
+	for checkType, key := range portfolioViolationKeys {
+		action := strings.ToLower(cfg.OnViolation[key])
+		switch action {
+		case violationPreferHigherScore, violationDownsize, violationSkip:
+		case "":
+			action = defaultViolationActions[checkType]
+		default:
+			log.Printf("Unknown portfolio_gate.on_violation.%s %q, using %s", key, cfg.OnViolation[key], defaultViolationActions[checkType])
+			action = defaultViolationActions[checkType]
+		}
+		g.onViolation[checkType] = action
+	}
+	return g
+}
+
+func (g *portfolioGate) assetClass(symbol string) string {
+	if class := g.assetClasses[symbol]; class != "" {
+		return class
+	}
+	return g.defaultClass
+}
+
+// portfolioOutcome 預檢結果：allowed 為可下單的名義金額上限（拒單時為 0）
+type portfolioOutcome struct {
+	allowed float64
+	reason  string // 拒單原因
+	checks  []dao.RiskCheck
+}
+
+// evaluate 依序檢查相關性、策略額度、資產類額度與淨 Delta；每項以前一項降尺後的金額計算，
+// 拒單即停止。rho 回傳兩標的相關係數（無資料時 ok 為 false）
+func (g *portfolioGate) evaluate(book []exposure, cand exposure, nav float64, rho func(a, b string) (float64, bool)) portfolioOutcome {
+	out := portfolioOutcome{allowed: cand.notional}
+	if nav <= 0 {
+		out.allowed, out.reason = 0, "nav unavailable"
+		return out
+	}
+
+	// violate 記錄違反並依處置降尺或拒單；headroom 為該項剩餘額度（USDT）
+	violate := func(check dao.RiskCheck, headroom float64, conflicts []exposure) bool {
+		check.Action = g.onViolation[check.CheckType]
+		action := check.Action
+		if action == violationPreferHigherScore {
+			if best, ok := highestScore(conflicts); ok && cand.score < best.score {
+				check.Result = dao.RiskResultFail
+				check.Message += fmt.Sprintf("; score %.3f below %s %s %.3f", cand.score, best.strategy, best.symbol, best.score)
+				out.checks = append(out.checks, check)
+				out.allowed, out.reason = 0, check.Message
+				return false
+			}
+			action = violationDownsize
+		}
+		if action == violationDownsize && headroom > 0 {
+			check.Result = dao.RiskResultWarn
+			check.Message += fmt.Sprintf("; downsized to %.2f USDT", headroom)
+			out.checks = append(out.checks, check)
+			out.allowed = math.Min(out.allowed, headroom)
+			return true
+		}
+		check.Result = dao.RiskResultFail
+		out.checks = append(out.checks, check)
+		out.allowed, out.reason = 0, check.Message
+		return false
+	}
+	pass := func(check dao.RiskCheck) {
+		if check.Result == "" {
+			check.Result = dao.RiskResultPass
+		}
+		out.checks = append(out.checks, check)
+	}
+	class := g.assetClass(cand.symbol)
+
+	// 1. 相關性：同方向且 ρ ≥ max_pair_rho（含同標的）的曝險合併計算
+	limit := g.correlatedCapPct
+	if limit <= 0 {
+		limit = g.byAssetClass[class]
+	}
+	if limit > 0 {
+		var cluster, rivals []exposure
+		var used float64
+		matrixMissing := false
+		for _, e := range book {
+			if e.side != cand.side {
+				continue
+			}
+			if e.symbol != cand.symbol {
+				if !g.combineRisk {
+					continue
+				}
+				r, ok := rho(cand.symbol, e.symbol)
+				if !ok {
+					matrixMissing = true
+					continue
+				}
+				if r < g.maxPairRho {
+					continue
+				}
+			}
+			cluster = append(cluster, e)
+			used += e.notional
+			if e.strategy != cand.strategy || e.symbol != cand.symbol {
+				rivals = append(rivals, e) // 加倉時不與自身持倉比較分數
+			}
+		}
+		check := dao.RiskCheck{CheckType: dao.RiskCheckCorrelation, Observed: (used + out.allowed) / nav, Limit: limit}
+		check.Message = fmt.Sprintf("correlated %s exposure %.3f > %.3f NAV (%d positions, rho >= %.2f)", cand.side, check.Observed, limit, len(cluster), g.maxPairRho)
+		if check.Observed > limit+1e-9 {
+			if !violate(check, limit*nav-used, rivals) {
+				return out
+			}
+		} else {
+			check.Message = fmt.Sprintf("correlated %s exposure %.3f <= %.3f NAV (%d positions)", cand.side, check.Observed, limit, len(cluster))
+			if matrixMissing {
+				check.Result = dao.RiskResultWarn
+				check.Message += "; correlation unavailable for some symbols"
+			}
+			pass(check)
+		}
+	}
+
+	// 2. 策略額度：同一策略所有標的的總曝險
+	limit = g.strategyCapPct
+	if cap, ok := g.byStrategy[cand.strategy]; ok && cap > 0 {
+		limit = cap
+	}
+	var used float64
+	for _, e := range book {
+		if e.strategy == cand.strategy {
+			used += e.notional
+		}
+	}
+	check := dao.RiskCheck{CheckType: dao.RiskCheckStrategyBudget, Observed: (used + out.allowed) / nav, Limit: limit}
+	if check.Observed > limit+1e-9 {
+		check.Message = fmt.Sprintf("strategy %s exposure %.3f > %.3f NAV", cand.strategy, check.Observed, limit)
+		if !violate(check, limit*nav-used, nil) {
+			return out
+		}
+	} else {
+		check.Message = fmt.Sprintf("strategy %s exposure %.3f <= %.3f NAV", cand.strategy, check.Observed, limit)
+		pass(check)
+	}
+
+	// 3. 資產類額度：同資產類（多空合計）的總曝險；未設定上限的資產類不檢查
+	if limit = g.byAssetClass[class]; limit > 0 {
+		used = 0
+		for _, e := range book {
+			if g.assetClass(e.symbol) == class {
+				used += e.notional
+			}
+		}
+		check := dao.RiskCheck{CheckType: dao.RiskCheckAssetClass, Observed: (used + out.allowed) / nav, Limit: limit}
+		if check.Observed > limit+1e-9 {
+			check.Message = fmt.Sprintf("asset class %s exposure %.3f > %.3f NAV", class, check.Observed, limit)
+			if !violate(check, limit*nav-used, nil) {
+				return out
+			}
+		} else {
+			check.Message = fmt.Sprintf("asset class %s exposure %.3f <= %.3f NAV", class, check.Observed, limit)
+			pass(check)
+		}
+	}
+
+	// 4. 淨 Delta：下單後（多 − 空）/ NAV 須在區間內；往區間內移動的單不受限
+	var net float64
+	for _, e := range book {
+		net += e.signed()
+	}
+	edge, headroom := g.netDeltaUpper, g.netDeltaUpper*nav-net
+	if cand.side == dao.PosShort {
+		edge, headroom = g.netDeltaLower, net-g.netDeltaLower*nav
+	}
+	after := exposure{side: cand.side, notional: out.allowed}
+	check = dao.RiskCheck{CheckType: dao.RiskCheckNetDelta, Observed: (net + after.signed()) / nav, Limit: edge}
+	if out.allowed > headroom+1e-9 {
+		check.Message = fmt.Sprintf("net delta %.3f outside [%.2f, %.2f]", check.Observed, g.netDeltaLower, g.netDeltaUpper)
+		if !violate(check, headroom, nil) {
+			return out
+		}
+	} else {
+		check.Message = fmt.Sprintf("net delta %.3f within [%.2f, %.2f]", check.Observed, g.netDeltaLower, g.netDeltaUpper)
+		pass(check)
+	}
+	return out
+}
+
+// highestScore 衝突曝險中分數最高者（皆無分數時 ok 為 false）
+func highestScore(conflicts []exposure) (exposure, bool) {
+	var best exposure
+	found := false
+	for _, e := range conflicts {
+		if e.score > 0 && (!found || e.score > best.score) {
+			best, found = e, true
+		}
+	}
+	return best, found
+}
+
+// portfolioBook 目前的組合曝險：各策略未結束的持倉，加上尚無持倉記錄的未成交暫占。
+// 規則路徑在暫占成功時即寫回持倉，故同一策略與標的已有持倉時以持倉為準，不重複計入。
+// 本策略實例在本標的的持倉以評估後的 current 取代（出場/反手後的實際剩餘）。
+func (s *S3_STRATEGYServer) portfolioBook(ctx context.Context, name, symbol string, current *strategy.Position) ([]exposure, error) {
+	var book []exposure
+	held := make(map[string]bool)
+	add := func(pos *strategy.Position) {
+		if !isOpen(pos) || pos.Qty <= 0 {
+			return
+		}
+		book = append(book, exposure{strategy: pos.Strategy, symbol: pos.Symbol, side: pos.Side, notional: pos.Qty * pos.EntryPx, score: pos.Score})
+		held[pos.Strategy+"|"+pos.Symbol] = true
+	}
+
+	if s.strategyRunner != nil {
+		positions, err := s.strategyRunner.Store.List(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("positions: %w", err)
+		}
+		for _, pos := range positions {
+			if pos.Strategy == name && pos.Symbol == symbol {
+				continue
+			}
+			add(pos)
+		}
+	}
+	add(current)
+
+	pending, err := s.portfolio.pending.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("pending reservations: %w", err)
+	}
+	for _, p := range pending {
+		if held[p.Strategy+"|"+p.Symbol] || p.NotionalUSDT <= 0 {
+			continue
+		}
+		book = append(book, exposure{strategy: p.Strategy, symbol: p.Symbol, side: p.Side, notional: p.NotionalUSDT, score: p.Score})
+	}
+	return book, nil
+}
+
+// checkPortfolio 規則路徑候選單的組合層預檢並記錄 RiskCheck；拒單或降尺後低於交易所下限時改為 skip。
+// 持倉或暫占讀取失敗時保守拒單
+func (s *S3_STRATEGYServer) checkPortfolio(p rulePath, decision *dao.Decision, current *strategy.Position, sized sizing.Result,
+	trace *dao.DecisionTrace) (sizing.Result, bool) {
+	g := s.portfolio
+	if g == nil {
+		return sized, true
+	}
+	req := p.req
+	in, err := p.inputs()
+	if err != nil {
+		decision.Action, decision.Reason = dao.DecisionSkip, "portfolio: "+err.Error()
+		return sized, false
+	}
+	cand := exposure{strategy: p.inst.name, symbol: req.Symbol, side: decision.Side, notional: sized.NotionalUSDT}
+	if trace.Model != nil {
+		cand.score = trace.Model.Score
+	}
+	pt := &dao.PortfolioTrace{NAV: in.NAV, Notional: sized.NotionalUSDT}
+	trace.Portfolio = pt
+	reject := func(reason string) (sizing.Result, bool) {
+		pt.Action, pt.Final = portfolioReject, 0
+		decision.Action, decision.Reason = dao.DecisionSkip, "portfolio: "+reason
+		return sized, false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), portfolioTimeout)
+	defer cancel()
+	book, err := s.portfolioBook(ctx, p.inst.name, req.Symbol, current)
+	if err != nil {
+		return reject(err.Error())
+	}
+	rho, ok := g.correlations.lookup(ctx)
+	pt.Correlations = ok
+
+	out := g.evaluate(book, cand, in.NAV, rho)
+	now := time.Now()
+	for i := range out.checks {
+		check := &out.checks[i]
+		check.CheckID = fmt.Sprintf("%s-%s", req.SignalID, strings.ToLower(check.CheckType))
+		if p.inst.name != rulePathStrategy {
+			check.CheckID = fmt.Sprintf("%s-%s-%s", req.SignalID, p.inst.name, strings.ToLower(check.CheckType))
+		}
+		check.SignalID = req.SignalID
+		check.Timestamp, check.CreatedAt = now.UnixMilli(), now
+	}
+	pt.Checks = out.checks
+	if out.reason != "" {
+		return reject(out.reason)
+	}
+	if out.allowed >= sized.NotionalUSDT {
+		pt.Action, pt.Final = portfolioPass, sized.NotionalUSDT
+		return sized, true
+	}
+
+	leverage := trace.Sizing.Leverage
+	downsized, err := sizing.Downsize(sized, out.allowed, in.Price, leverage, in.Filters)
+	if err != nil {
+		return reject("downsize: " + err.Error())
+	}
+	pt.Action, pt.Final = portfolioDownsize, downsized.NotionalUSDT
+	trace.Sizing.Qty, trace.Sizing.NotionalUSDT = downsized.Qty, downsized.NotionalUSDT
+	trace.Sizing.MarginUSDT, trace.Sizing.CappedBy = downsized.MarginUSDT, downsized.CappedBy
+	return downsized, true
+}
+
+// trackPending 暫占成功的入場意圖記入未成交曝險（回報終態或 TTL 到期後移除）
+func (s *S3_STRATEGYServer) trackPending(intent *dao.OrderIntent, side dao.PosSide, score float64) {
+	if s.portfolio == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), portfolioTimeout)
+	defer cancel()
+	err := s.portfolio.pending.Add(ctx, risk.Pending{
+		IntentID:     intent.IntentID,
+		Strategy:     intent.Strategy,
+		Symbol:       intent.Symbol,
+		Side:         side,
+		NotionalUSDT: intent.NotionalUSDT,
+		Score:        score,
+	}, s.portfolio.pendingTTL)
+	if err != nil {
+		log.Printf("Failed to track pending exposure for %s: %v", intent.IntentID, err)
+	}
+}
+
+// releasePending 回報終態時移除未成交曝險
+func (s *S3_STRATEGYServer) releasePending(ctx context.Context, intentID string) error {
+	if s.portfolio == nil {
+		return nil
+	}
+	_, err := s.portfolio.pending.Remove(ctx, intentID)
+	return err
+}
+
+// correlationMatrix S2 發布的相關係數（Redis Hash：欄位 <A>:<B>，值為 ρ）；快取 refresh 時間，
+// 讀取失敗時沿用上次結果
+type correlationMatrix struct {
+	fetch   func(ctx context.Context) (map[string]float64, error)
+	refresh time.Duration
+
+	mu       sync.Mutex
+	pairs    map[string]float64
+	loadedAt time.Time
+}
+
+// lookup 回傳相關係數查詢函式；矩陣不可用時 ok 為 false（只合併同標的）
+func (m *correlationMatrix) lookup(ctx context.Context) (func(a, b string) (float64, bool), bool) {
+	pairs := m.load(ctx)
+	rho := func(a, b string) (float64, bool) {
+		if a == b {
+			return 1, true
+		}
+		if r, ok := pairs[a+":"+b]; ok {
+			return r, true
+		}
+		r, ok := pairs[b+":"+a]
+		return r, ok
+	}
+	return rho, len(pairs) > 0
+}
+
+func (m *correlationMatrix) load(ctx context.Context) map[string]float64 {
+	if m == nil || m.fetch == nil {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.pairs != nil && time.Since(m.loadedAt) < m.refresh {
+		return m.pairs
+	}
+	pairs, err := m.fetch(ctx)
+	if err != nil {
+		log.Printf("Failed to load correlation matrix: %v", err)
+		return m.pairs
+	}
+	m.pairs, m.loadedAt = pairs, time.Now()
+	return pairs
+}
+
+// redisCorrelations 讀取相關係數 Hash；無法解析的欄位略過
+func redisCorrelations(client goredis.Cmdable, key string) func(ctx context.Context) (map[string]float64, error) {
+	return func(ctx context.Context) (map[string]float64, error) {
+		entries, err := client.HGetAll(ctx, key).Result()
+		if err != nil {
+			return nil, err
+		}
+		pairs := make(map[string]float64, len(entries))
+		var malformed []string
+		for field, value := range entries {
+			r, err := strconv.ParseFloat(value, 64)
+			if err != nil || !strings.Contains(field, ":") {
+				malformed = append(malformed, field)
+				continue
+			}
+			pairs[field] = r
+		}
+		if len(malformed) > 0 {
+			sort.Strings(malformed)
+			log.Printf("Ignored malformed correlation entries in %s: %s", key, strings.Join(malformed, ", "))
+		}
+		return pairs, nil
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"s3-strategy/dao"
+	"s3-strategy/internal/risk"
+	"s3-strategy/internal/strategy"
+)
+
+func testPortfolioGate() *portfolioGate {
+	g := newPortfolioGate()
+	g.combineRisk = true
+	g.byStrategy = map[string]float64{rulePathStrategy: 0.5}
+	g.byAssetClass = map[string]float64{defaultAssetClass: 0.6}
+	g.pending = risk.NewMemoryPendingBook()
+	return g
+}
+
+func staticRho(pairs map[string]float64) func(a, b string) (float64, bool) {
+	m := &correlationMatrix{fetch: func(context.Context) (map[string]float64, error) { return pairs, nil }}
+	rho, _ := m.lookup(context.Background())
+	return rho
+}
+
+func TestPortfolioGate_Evaluate(t *testing.T) {
+	const nav = 10000
+	rho := staticRho(map[string]float64{"BTCUSDT:ETHUSDT": 0.85, "BTCUSDT:SOLUSDT": 0.3, "SOLUSDT:ETHUSDT": 0.2})
+	eth := exposure{strategy: "ew_trend", symbol: "ETHUSDT", side: dao.PosLong, notional: 4000, score: 0.9}
+	btc := exposure{strategy: rulePathStrategy, symbol: "BTCUSDT", side: dao.PosLong, notional: 3000, score: 0.5}
+	results := func(out portfolioOutcome) string {
+		var parts []string
+		for _, c := range out.checks {
+			parts = append(parts, c.CheckType+"="+c.Result)
+		}
+		return strings.Join(parts, " ")
+	}
+
+	// 同方向 ρ 0.85：合併 0.7 NAV 超過 0.6，分數較低者拒單
+	g := testPortfolioGate()
+	out := g.evaluate([]exposure{eth}, btc, nav, rho)
+	if out.allowed != 0 || !strings.Contains(out.reason, "score 0.500 below ew_trend ETHUSDT 0.900") || results(out) != "CORRELATION=FAIL" {
+		t.Errorf("lower score = %+v", out)
+	}
+
+	// 分數較高：降尺至合併額度內（2000），淨 Delta 放寬後通過
+	g.netDeltaLower, g.netDeltaUpper = -1, 1
+	btc.score = 0.95
+	out = g.evaluate([]exposure{eth}, btc, nav, rho)
+	if out.reason != "" || out.allowed != 2000 || results(out) != "CORRELATION=WARN STRATEGY_BUDGET=PASS ASSET_CLASS=PASS NET_DELTA=PASS" {
+		t.Errorf("higher score = %+v", out)
+	}
+	if c := out.checks[0]; c.Action != violationPreferHigherScore || c.Limit != 0.6 || c.Observed != 0.7 {
+		t.Errorf("correlation check = %+v", c)
+	}
+
+	// 低相關不合併；資產類（多空合計）超額時降尺
+	sol := exposure{strategy: rulePathStrategy, symbol: "SOLUSDT", side: dao.PosLong, notional: 3000}
+	out = g.evaluate([]exposure{eth}, sol, nav, rho)
+	if out.allowed != 2000 || results(out) != "CORRELATION=PASS STRATEGY_BUDGET=PASS ASSET_CLASS=WARN NET_DELTA=PASS" {
+		t.Errorf("uncorrelated = %+v", out)
+	}
+
+	// 淨 Delta：預設區間 [-0.3, 0.3] 超出時略過進場；往區間內移動的單不受限
+	g = testPortfolioGate()
+	short := exposure{strategy: "ew_trend", symbol: "ETHUSDT", side: dao.PosShort, notional: 2500}
+	btc.notional = 1000
+	if out = g.evaluate([]exposure{short}, btc, nav, rho); out.reason != "" || out.checks[len(out.checks)-1].Observed != -0.15 {
+		t.Errorf("reducing delta = %+v", out)
+	}
+	btc.side = dao.PosShort
+	if out = g.evaluate([]exposure{short}, btc, nav, rho); out.allowed != 0 || !strings.Contains(out.reason, "net delta -0.350 outside") || out.checks[len(out.checks)-1].Action != violationSkip {
+		t.Errorf("net delta breach = %+v", out)
+	}
+
+	// 相關係數不可用：只合併同標的並標記 WARN
+	btc.side = dao.PosLong
+	out = g.evaluate([]exposure{eth}, btc, nav, staticRho(nil))
+	if c := out.checks[0]; c.Result != dao.RiskResultWarn || !strings.Contains(c.Message, "correlation unavailable") {
+		t.Errorf("missing matrix = %+v", c)
+	}
+}
+
+func TestDecide_PortfolioGate(t *testing.T) {
+	s := newTestServer(t)
+	s.portfolio = testPortfolioGate()
+	s.portfolio.byStrategy = nil // 規則路徑使用 strategy_cap_pct 0.25
+	s.portfolio.netDeltaLower, s.portfolio.netDeltaUpper = -1, 1
+	s.portfolio.correlations = &correlationMatrix{fetch: func(context.Context) (map[string]float64, error) {
+		return map[string]float64{"BTCUSDT:ETHUSDT": 0.9}, nil
+	}}
+	ctx := context.Background()
+	features := func(symbol string) *dao.DecideRequest {
+		return &dao.DecideRequest{SignalID: "sig-" + symbol, Symbol: symbol, Market: dao.MarketFUT, Features: dao.FeatureSet{
+			"spread_bps": 1.5, "atr_pct": 0.5, "rv_pct": 0.1, "ew_dir": 1.0, "invalidation_px": 59000.0,
+		}}
+	}
+
+	// 1. 規則路徑額度 0.25 NAV：降尺至 2500 USDT，記入未成交曝險
+	response := s.decide(features("BTCUSDT"))
+	if response.Decision.Action != dao.DecisionOpen || len(response.Intents) != 1 {
+		t.Fatalf("open = %+v", response.Decision)
+	}
+	pt := response.Trace.Portfolio
+	if pt == nil || pt.Action != portfolioDownsize || pt.Final > 2500 || response.Intents[0].NotionalUSDT != pt.Final || response.Trace.Sizing.CappedBy != "portfolio" {
+		t.Fatalf("portfolio trace = %+v", pt)
+	}
+	if c := pt.Checks[1]; c.CheckType != dao.RiskCheckStrategyBudget || c.Result != dao.RiskResultWarn || c.SignalID != "sig-BTCUSDT" || c.CheckID != "sig-BTCUSDT-strategy_budget" {
+		t.Errorf("strategy budget check = %+v", c)
+	}
+	if pending, _ := s.portfolio.pending.List(ctx); len(pending) != 1 || pending[0].Side != dao.PosLong || pending[0].NotionalUSDT != pt.Final {
+		t.Errorf("pending = %+v", pending)
+	}
+	intentID := response.Intents[0].IntentID
+
+	// 2. 其他策略已有 ETH 空單（不同方向不合併）；BTC 多單 ρ 0.9 分數相同時降尺，
+	// 但規則路徑額度剩餘不足最小下單量，拒單
+	s.strategyRunner.Store.Save(ctx, &strategy.Position{Strategy: "ew_trend", Symbol: "ETHUSDT", Side: dao.PosShort, State: strategy.StateActiveConfirmed, Qty: 0.05, EntryPx: 3000})
+	response = s.decide(features("ETHUSDT"))
+	if response.Decision.Action != dao.DecisionSkip || !strings.Contains(response.Decision.Reason, "portfolio: downsize: qty") || len(response.Intents) != 0 {
+		t.Errorf("exhausted budget = %+v", response.Decision)
+	}
+	if pt := response.Trace.Portfolio; pt.Action != portfolioReject || pt.Checks[0].Result != dao.RiskResultWarn || pt.Checks[1].Result != dao.RiskResultWarn {
+		t.Errorf("reject trace = %+v", pt)
+	}
+
+	// 3. 回報終態後移除未成交曝險（持倉仍計入）
+	if err := s.releasePending(ctx, intentID); err != nil {
+		t.Fatal(err)
+	}
+	if pending, _ := s.portfolio.pending.List(ctx); len(pending) != 0 {
+		t.Errorf("pending after release = %+v", pending)
+	}
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"s3-strategy/dao"
+	"s3-strategy/internal/config"
+	"s3-strategy/internal/services/arangodb"
+	"s3-strategy/internal/sizing"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 倉位計算預設值（env.yaml sizing 區塊未設定時使用）
+const (
+	defaultBaseRiskPct           = 1.0
+	defaultConvictionLower       = 0.8
+	defaultConvictionUpper       = 1.25
+	defaultLeverage              = 20
+	defaultExchangeURL           = "http://localhost:8081"
+	defaultPriceTimeout          = 300 * time.Millisecond
+	defaultNAVRefresh            = 30 * time.Second
+	defaultFiltersTTL            = 5 * time.Minute
+	navStaleFactor               = 10 // S1 失敗時沿用快取 NAV 的最長時間（倍數 × nav_refresh）
+	instrumentRegistryCollection = "instrument_registry"
+)
+
+// errMarketDataUnavailable 未設定 S1/instrument_registry 資料來源
+var errMarketDataUnavailable = errors.New("market data unavailable")
+
+var defaultStopRefs = []string{"invalidation_px", "wave_invalidation_px_4h", "wave_invalidation_px_1d"}
+
+// sizingConfig 解析後的 sizing 區塊
+type sizingConfig struct {
+	baseRiskPct     float64
+	convictionLower float64
+	convictionUpper float64
+	stopRefs        []string
+	leverage        int
+	maxMarginUSDT   float64
+	priceTimeout    time.Duration
+}
+
+func newSizingConfig() sizingConfig {
+	cfg := config.AppConfig.Sizing
+	sc := sizingConfig{
+		baseRiskPct:     cfg.BaseRiskPctOfNav,
+		convictionLower: cfg.ConvictionLower,
+		convictionUpper: cfg.ConvictionUpper,
+		stopRefs:        cfg.StopRefs,
+		leverage:        cfg.Leverage,
+		maxMarginUSDT:   cfg.MaxMarginUSDT,
+		priceTimeout:    durationOr(cfg.PriceTimeout, defaultPriceTimeout),
+	}
+	if sc.baseRiskPct <= 0 {
+		sc.baseRiskPct = defaultBaseRiskPct
+	}
+	if sc.convictionLower <= 0 {
+		sc.convictionLower = defaultConvictionLower
+	}
+	if sc.convictionUpper < sc.convictionLower {
+		sc.convictionUpper = defaultConvictionUpper
+	}
+	if len(sc.stopRefs) == 0 {
+		sc.stopRefs = defaultStopRefs
+	}
+	if sc.leverage <= 0 {
+		sc.leverage = defaultLeverage
+	}
+	return sc
+}
+
+// MarketData 倉位計算所需的即時價格、帳戶淨值與交易所下單限制
+type MarketData interface {
+	Price(ctx context.Context, symbol string, market dao.Market) (float64, error)
+	NAV(ctx context.Context) (float64, error)
+	Filters(ctx context.Context, symbol string) (sizing.Filters, error)
+}
+
+// exchangeMarketData 價格與 NAV 取自 S1（/market/data、/account/balance 的 USDT total），
+// 交易所限制取自 Arango instrument_registry；NAV 與限制皆有快取
+type exchangeMarketData struct {
+	baseURL     string
+	client      *http.Client
+	arangodb    *arangodb.ArangoDBClient
+	navRefresh  time.Duration
+	filtersTTL  time.Duration
+	fallbackNAV float64 // strategies.nav_usdt：S1 不可用且無快取時使用
+
+	mu      sync.Mutex
+	nav     float64
+	navAt   time.Time
+	filters map[string]cachedFilters
+}
+
+type cachedFilters struct {
+	filters  sizing.Filters
+	loadedAt time.Time
+}
+
+func (m *exchangeMarketData) Price(ctx context.Context, symbol string, market dao.Market) (float64, error) {
+	var data struct {
+		Price float64 `json:"price"`
+	}
+	query := url.Values{"symbol": {symbol}, "market": {string(market)}}
+	if err := m.get(ctx, "/market/data?"+query.Encode(), &data); err != nil {
+		return 0, err
+	}
+	if data.Price <= 0 {
+		return 0, sizing.ErrNoPrice
+	}
+	return data.Price, nil
+}
+
+func (m *exchangeMarketData) NAV(ctx context.Context) (float64, error) {
+	m.mu.Lock()
+	nav, navAt := m.nav, m.navAt
+	m.mu.Unlock()
+	if nav > 0 && time.Since(navAt) < m.navRefresh {
+		return nav, nil
+	}
+
+	var balances []struct {
+		Asset string  `json:"asset"`
+		Total float64 `json:"total"`
+	}
+	err := m.get(ctx, "/account/balance?market=FUT", &balances)
+	if err == nil {
+		fresh := 0.0
+		for _, b := range balances {
+			if b.Asset == "USDT" {
+				fresh += b.Total
+			}
+		}
+		if fresh > 0 {
+			m.mu.Lock()
+			m.nav, m.navAt = fresh, time.Now()
+			m.mu.Unlock()
+			return fresh, nil
+		}
+		err = errors.New("no USDT balance")
+	}
+
+	switch {
+	case nav > 0 && time.Since(navAt) < navStaleFactor*m.navRefresh:
+		log.Printf("NAV refresh failed, using cached %.2f USDT: %v", nav, err)
+		return nav, nil
+	case m.fallbackNAV > 0:
+		log.Printf("NAV refresh failed, using strategies.nav_usdt %.2f USDT: %v", m.fallbackNAV, err)
+		return m.fallbackNAV, nil
+	}
+	return 0, fmt.Errorf("%w: %v", sizing.ErrNoNAV, err)
+}
+
+func (m *exchangeMarketData) Filters(ctx context.Context, symbol string) (sizing.Filters, error) {
+	m.mu.Lock()
+	cached, ok := m.filters[symbol]
+	m.mu.Unlock()
+	if ok && time.Since(cached.loadedAt) < m.filtersTTL {
+		return cached.filters, nil
+	}
+	if m.arangodb == nil {
+		return sizing.Filters{}, fmt.Errorf("%s unavailable", instrumentRegistryCollection)
+	}
+
+	query := `FOR i IN @@col FILTER i.symbol == @symbol && i.status != "DISABLED" LIMIT 1 RETURN i`
+	cursor, err := m.arangodb.GetDB().Query(ctx, query, map[string]interface{}{
+		"@col":   instrumentRegistryCollection,
+		"symbol": symbol,
+	})
+	if err != nil {
+		return sizing.Filters{}, err
+	}
+	defer cursor.Close()
+	if !cursor.HasMore() {
+		return sizing.Filters{}, fmt.Errorf("%s not found in %s", symbol, instrumentRegistryCollection)
+	}
+	var filters sizing.Filters
+	if _, err := cursor.ReadDocument(ctx, &filters); err != nil {
+		return sizing.Filters{}, err
+	}
+
+	m.mu.Lock()
+	m.filters[symbol] = cachedFilters{filters: filters, loadedAt: time.Now()}
+	m.mu.Unlock()
+	return filters, nil
+}
+
+func (m *exchangeMarketData) get(ctx context.Context, path string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		payload, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("exchange connector returned %d: %s", resp.StatusCode, strings.TrimSpace(string(payload)))
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// initializeSizing 建立 S1 價格/NAV 與 instrument_registry 來源
+func (s *S3_STRATEGYServer) initializeSizing() {
+	cfg := config.AppConfig.Sizing
+	s.sizing = newSizingConfig()
+	baseURL := cfg.ExchangeURL
+	if baseURL == "" {
+		baseURL = defaultExchangeURL
+	}
+	s.marketData = &exchangeMarketData{
+		baseURL:     strings.TrimRight(baseURL, "/"),
+		client:      &http.Client{},
+		arangodb:    s.arangodbClient,
+		navRefresh:  durationOr(cfg.NAVRefresh, defaultNAVRefresh),
+		filtersTTL:  durationOr(cfg.FiltersTTL, defaultFiltersTTL),
+		fallbackNAV: s.navUSDT,
+		filters:     make(map[string]cachedFilters),
+	}
+}
+
+// pricingInputs 單筆決策的定價輸入；執行與影子版本共用同一次查詢
+type pricingInputs struct {
+	Price   float64
+	NAV     float64
+	Filters sizing.Filters
+}
+
+// loadPricingInputs S1 即時價格（不可用時退回特徵快照的 mark_price/close/price）、NAV 與交易所限制
+func (s *S3_STRATEGYServer) loadPricingInputs(req *dao.DecideRequest) (pricingInputs, error) {
+	var in pricingInputs
+	if s.marketData == nil {
+		return in, errMarketDataUnavailable
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.sizing.priceTimeout)
+	defer cancel()
+
+	price, err := s.marketData.Price(ctx, req.Symbol, req.Market)
+	if err != nil {
+		if price = referencePrice(req.Features); price <= 0 {
+			return in, fmt.Errorf("%w: %v", sizing.ErrNoPrice, err)
+		}
+		log.Printf("Live price for %s unavailable, using feature snapshot %.8g: %v", req.Symbol, price, err)
+	}
+	in.Price = price
+	if in.NAV, err = s.marketData.NAV(ctx); err != nil {
+		return in, err
+	}
+	if in.Filters, err = s.marketData.Filters(ctx, req.Symbol); err != nil {
+		return in, fmt.Errorf("exchange filters: %w", err)
+	}
+	return in, nil
+}
+
+// invalidationPrice 依 stop_refs 順序取第一個有值的無效化價特徵
+func invalidationPrice(features dao.FeatureSet, refs []string) (string, float64) {
+	for _, ref := range refs {
+		if px, ok := features[ref].(float64); ok && px > 0 {
+			return ref, px
+		}
+	}
+	return "", 0
+}
+
+// sizePosition 以無效化價計算倉位：risk_cash = NAV × base_risk_pct × clamp(size_mult)，qty = risk_cash / |entry − stop|。
+// side 為信號方向（空白時依無效化價位置決定）；無效化價須在該方向的止損側。qtyFrac 供加倉只取部分數量，
+// heldQty 為加倉前的既有持倉（合計不超過槓桿與保證金上限）。
+func (s *S3_STRATEGYServer) sizePosition(req *dao.DecideRequest, sizeMult float64, side dao.PosSide, qtyFrac, heldQty float64, inputs func() (pricingInputs, error)) (sizing.Result, *dao.SizingTrace, error) {
+	cfg := s.sizing
+	leverage := cfg.leverage
+	if req.Market == dao.MarketSPOT {
+		leverage = 1
+	}
+	trace := &dao.SizingTrace{
+		SizeMult:       sizeMult,
+		ConvictionMult: sizing.Clamp(sizeMult, cfg.convictionLower, cfg.convictionUpper),
+		BaseRiskPct:    cfg.baseRiskPct,
+		Leverage:       leverage,
+		HeldQty:        heldQty,
+	}
+	fail := func(err error) (sizing.Result, *dao.SizingTrace, error) {
+		trace.Error = err.Error()
+		return sizing.Result{}, trace, err
+	}
+
+	if sizeMult <= 0 {
+		return fail(fmt.Errorf("size_mult %v", sizeMult))
+	}
+	if req.Market == dao.MarketSPOT && side == dao.PosShort {
+		return fail(errors.New("spot entries are long-only"))
+	}
+	trace.StopRef, trace.InvalidationPx = invalidationPrice(req.Features, cfg.stopRefs)
+	if trace.StopRef == "" {
+		return fail(fmt.Errorf("invalidation price unavailable (%s)", strings.Join(cfg.stopRefs, ", ")))
+	}
+	in, err := inputs()
+	if err != nil {
+		return fail(err)
+	}
+	trace.NAVUSDT, trace.EntryPx = in.NAV, in.Price
+
+	res, err := sizing.Size(sizing.Params{
+		NAV:            in.NAV,
+		BaseRiskPct:    cfg.baseRiskPct,
+		Conviction:     trace.ConvictionMult,
+		EntryPx:        in.Price,
+		InvalidationPx: trace.InvalidationPx,
+		Leverage:       leverage,
+		MaxMarginUSDT:  cfg.maxMarginUSDT,
+		QtyFrac:        qtyFrac,
+		HeldQty:        heldQty,
+		Filters:        in.Filters,
+	})
+	trace.RiskCashUSDT, trace.StopPx = res.RiskCash, res.StopPx
+	trace.RawQty, trace.Qty = res.RawQty, res.Qty
+	trace.MarginUSDT, trace.NotionalUSDT = res.MarginUSDT, res.NotionalUSDT
+	trace.CappedBy = res.CappedBy
+	switch {
+	case err != nil:
+	case side != "" && res.Long != (side == dao.PosLong):
+		err = fmt.Errorf("invalidation %s %.8g is on the wrong side of entry %.8g for %s", trace.StopRef, trace.InvalidationPx, in.Price, side)
+	case req.Market == dao.MarketSPOT && !res.Long:
+		err = errors.New("spot entries are long-only (invalidation above price)")
+	}
+	if err != nil {
+		return fail(err)
+	}
+	return res, trace, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"s3-strategy/dao"
+)
+
+func TestExchangeMarketData(t *testing.T) {
+	up := true
+	navCalls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !up {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		switch r.URL.Path {
+		case "/market/data":
+			if r.URL.Query().Get("symbol") != "BTCUSDT" || r.URL.Query().Get("market") != "FUT" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write([]byte(`{"symbol":"BTCUSDT","market":"FUT","price":60123.4}`))
+		case "/account/balance":
+			navCalls++
+			w.Write([]byte(`[{"asset":"USDT","total":9000},{"asset":"BNB","total":3},{"asset":"USDT","total":1000}]`))
+		}
+	}))
+	defer srv.Close()
+
+	m := &exchangeMarketData{baseURL: srv.URL, client: srv.Client(), navRefresh: time.Minute, fallbackNAV: 500}
+	ctx := context.Background()
+
+	if price, err := m.Price(ctx, "BTCUSDT", dao.MarketFUT); err != nil || price != 60123.4 {
+		t.Errorf("price = %v, err = %v", price, err)
+	}
+	for i := 0; i < 2; i++ {
+		if nav, err := m.NAV(ctx); err != nil || nav != 10000 {
+			t.Fatalf("nav = %v, err = %v", nav, err)
+		}
+	}
+	if navCalls != 1 {
+		t.Errorf("NAV must be cached within nav_refresh, %d calls", navCalls)
+	}
+
+	// S1 失敗：快取未過久時沿用，否則退回 strategies.nav_usdt
+	up = false
+	m.navAt = time.Now().Add(-2 * time.Minute)
+	if nav, err := m.NAV(ctx); err != nil || nav != 10000 {
+		t.Errorf("stale nav = %v, err = %v", nav, err)
+	}
+	m.navAt = time.Now().Add(-time.Hour)
+	if nav, err := m.NAV(ctx); err != nil || nav != 500 {
+		t.Errorf("fallback nav = %v, err = %v", nav, err)
+	}
+	m.fallbackNAV = 0
+	if _, err := m.NAV(ctx); err == nil {
+		t.Error("expected nav unavailable")
+	}
+	if _, err := m.Price(ctx, "BTCUSDT", dao.MarketFUT); err == nil {
+		t.Error("expected price error")
+	}
+}
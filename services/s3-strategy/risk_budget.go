@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"s3-strategy/dao"
+	"s3-strategy/internal/config"
+	"s3-strategy/internal/risk"
+	"strings"
+	"time"
+)
+
+// 風險預算預設值（env.yaml risk 區塊未設定時使用）
+const (
+	defaultReservationTTL  = 5 * time.Minute
+	defaultResultsStream   = "ord:results"
+	orderResultsGroup      = "s3-strategy"
+	riskBudgetTimeout      = 500 * time.Millisecond
+	reasonRiskBudget       = "RISK_BUDGET"
+	orderResultsBlock      = 5 * time.Second
+	orderResultsBatch      = 100
+	orderResultsRetryDelay = 2 * time.Second
+)
+
+// 成交/撤單終態：收到後釋放暫占（部分成交不釋放）
+var releaseStatuses = map[string]bool{
+	"FILLED":    true,
+	"CANCELED":  true,
+	"CANCELLED": true,
+	"REJECTED":  true,
+	"EXPIRED":   true,
+}
+
+// initializeRiskBudget 以 env.yaml risk 區塊覆寫守門器上限，建立暫占帳本並啟動回報消費
+func (s *S3_STRATEGYServer) initializeRiskBudget() {
+	cfg := config.AppConfig.Risk
+	if cfg.FutMarginUSDTMax > 0 {
+		s.gateKeeper.futMarginUsdtMax = cfg.FutMarginUSDTMax
+	}
+	if cfg.SpotQuoteUSDTMax > 0 {
+		s.gateKeeper.spotQuoteUsdtMax = cfg.SpotQuoteUSDTMax
+	}
+	if cfg.ConcurrentEntriesPerSymbol > 0 {
+		s.gateKeeper.concurrentEntriesPerMarket = cfg.ConcurrentEntriesPerSymbol
+	}
+
+	ttl := defaultReservationTTL
+	if cfg.ReservationTTL != "" {
+		parsed, err := time.ParseDuration(cfg.ReservationTTL)
+		if err != nil || parsed <= 0 {
+			log.Printf("Invalid risk.reservation_ttl %q, using %s", cfg.ReservationTTL, defaultReservationTTL)
+		} else {
+			ttl = parsed
+		}
+	}
+
+	ledger := risk.Ledger(risk.NewMemoryLedger())
+	if s.redisClient != nil {
+		ledger = risk.NewRedisLedger(s.redisClient.Client)
+	}
+	s.gateKeeper.budget = risk.NewBudget(ledger, risk.Limits{
+		FutMarginUSDT:     s.gateKeeper.futMarginUsdtMax,
+		SpotQuoteUSDT:     s.gateKeeper.spotQuoteUsdtMax,
+		ConcurrentEntries: s.gateKeeper.concurrentEntriesPerMarket,
+		ReservationTTL:    ttl,
+	})
+
+	if s.redisClient != nil {
+		stream := cfg.ResultsStream
+		if stream == "" {
+			stream = defaultResultsStream
+		}
+		go s.consumeOrderResults(stream)
+	}
+}
+
+// consumeOrderResults 消費 S4 執行回報，終態時釋放對應意圖的暫占
+func (s *S3_STRATEGYServer) consumeOrderResults(stream string) {
+	ctx := s.redisClient.Ctx
+	if err := s.redisClient.CreateConsumerGroup(ctx, stream, orderResultsGroup); err != nil {
+		log.Printf("Failed to create consumer group for %s: %v", stream, err)
+		return
+	}
+	consumer, _ := os.Hostname()
+	if consumer == "" {
+		consumer = fmt.Sprintf("s3-%d", os.Getpid())
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		streams, err := s.redisClient.ConsumeStream(ctx, stream, orderResultsGroup, consumer, orderResultsBatch, orderResultsBlock)
+		if err != nil {
+			log.Printf("Failed to read %s: %v", stream, err)
+			time.Sleep(orderResultsRetryDelay)
+			continue
+		}
+		for _, st := range streams {
+			for _, msg := range st.Messages {
+				if err := s.handleOrderResult(ctx, msg.Values); err != nil {
+					// 未 ACK 的訊息留在 pending；暫占仍會在 TTL 到期後失效
+					log.Printf("Failed to release reservation for %s: %v", msg.ID, err)
+					continue
+				}
+				if err := s.redisClient.AcknowledgeStreamMessage(ctx, stream, orderResultsGroup, msg.ID); err != nil {
+					log.Printf("%v", err)
+				}
+			}
+		}
+	}
+}
+
+// handleOrderResult 依回報的 intent_id/symbol/market 釋放暫占（帳戶層與策略額度）與未成交曝險
+func (s *S3_STRATEGYServer) handleOrderResult(ctx context.Context, values map[string]interface{}) error {
+	status := strings.ToUpper(fmt.Sprint(values["status"]))
+	intentID, _ := values["intent_id"].(string)
+	symbol, _ := values["symbol"].(string)
+	if !releaseStatuses[status] || intentID == "" || symbol == "" {
+		return nil
+	}
+	market := dao.Market(strings.ToUpper(fmt.Sprint(values["market"])))
+
+	ctx, cancel := context.WithTimeout(ctx, riskBudgetTimeout)
+	defer cancel()
+	if err := s.releasePending(ctx, intentID); err != nil {
+		return err
+	}
+	if err := s.releaseInstances(ctx, intentID, symbol, market); err != nil {
+		return err
+	}
+	released, err := s.gateKeeper.budget.Release(ctx, intentID, symbol, market)
+	if err != nil {
+		return err
+	}
+	if released {
+		log.Printf("Released risk reservation for %s (%s %s)", intentID, symbol, status)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+
+	"s3-strategy/dao"
+)
+
+func TestRuleEngine_CompiledRules(t *testing.T) {
+	engine := NewRuleEngine()
+	rules := []*dao.StrategyRule{
+		{RuleID: "R-001", Conditions: `{"allOf":[{"f":"rv_pctile_30d","op":"<","v":0.25},{"f":"rho_usdttwd_14","op":"<","v":-0.3}]}`, Actions: `{"size_mult":1.2}`, Priority: 50, Enabled: true},
+		{RuleID: "R-EW", Conditions: `wave_signal_4h == "end_of_2_confirmed" and wave_channel_ok_5m == 1`, Actions: `{"tp_mult":2.0}`, Priority: 60, Enabled: true},
+		{RuleID: "R-EMPTY", Conditions: `{}`, Actions: `{"size_mult":2.0}`, Priority: 90, Enabled: true},
+		{RuleID: "R-BAD", Conditions: `rv_pctile_30d <`, Actions: `{"size_mult":2.0}`, Priority: 90, Enabled: true},
+	}
+	for _, rule := range rules {
+		err := engine.LoadRule(rule)
+		if bad := rule.RuleID == "R-EMPTY" || rule.RuleID == "R-BAD"; bad != (err != nil) {
+			t.Errorf("LoadRule(%s) error = %v", rule.RuleID, err)
+		}
+	}
+
+	features := dao.FeatureSet{
+		"rv_pctile_30d":      0.1,
+		"rho_usdttwd_14":     -0.5,
+		"wave_signal_4h":     "end_of_2_confirmed",
+		"wave_channel_ok_5m": 1.0,
+	}
+	decision, fired := engine.Evaluate(&dao.DecideRequest{Symbol: "BTCUSDT"}, features)
+
+	// 依優先序評估；空條件與編譯失敗的規則不命中
+	if len(fired) != 2 || fired[0] != "R-EW" || fired[1] != "R-001" {
+		t.Fatalf("fired = %v", fired)
+	}
+	if decision.SizeMult != 1.2 || decision.TPMult != 2.0 {
+		t.Errorf("decision = %+v", decision)
+	}
+
+	// 缺少特徵時規則不命中
+	delete(features, "rho_usdttwd_14")
+	if _, fired := engine.Evaluate(&dao.DecideRequest{Symbol: "BTCUSDT"}, features); len(fired) != 1 || fired[0] != "R-EW" {
+		t.Errorf("fired with missing feature = %v", fired)
+	}
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"s3-strategy/dao"
+	"s3-strategy/internal/sizing"
+	"s3-strategy/internal/strategy"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 規則測試（POST /rules/test）
+const (
+	ruleTestBundleID       = "rules-test"
+	maxRuleTestRows        = 5000
+	defaultRuleTestWindow  = 500
+	defaultRuleTestNAVUSDT = 10000.0
+	ruleTestQueryTimeout   = 10 * time.Second
+)
+
+var errNoSignalHistory = errors.New("arangodb not connected")
+
+// harnessMarketData 規則測試的價格/NAV/交易所限制：價格取自目前列，NAV 固定，限制沿用即時資料（不可用時不限制）
+type harnessMarketData struct {
+	price   float64
+	nav     float64
+	filters sizing.Filters
+}
+
+func (m *harnessMarketData) Price(context.Context, string, dao.Market) (float64, error) {
+	if m.price <= 0 {
+		return 0, sizing.ErrNoPrice
+	}
+	return m.price, nil
+}
+
+func (m *harnessMarketData) NAV(context.Context) (float64, error) {
+	return m.nav, nil
+}
+
+func (m *harnessMarketData) Filters(context.Context, string) (sizing.Filters, error) {
+	return m.filters, nil
+}
+
+// ruleTestInput 待評估的一列（請求的特徵列或重播的已記錄信號）
+type ruleTestInput struct {
+	signalID string
+	price    float64
+	features dao.FeatureSet
+	recorded *dao.Decision
+}
+
+// ruleSandbox 規則測試用的獨立決策管線：指定的規則與策略規格、記憶體持倉，不連 Redis/Arango、不暫占風險預算、
+// 不做組合層預檢與停止進場開關；L0 門檻、倉位計算、方向設定與本地 L2 模型沿用現行設定
+func (s *S3_STRATEGYServer) ruleSandbox(req *dao.RuleTestRequest) (*S3_STRATEGYServer, *harnessMarketData, error) {
+	snapshot := s.configManager.Active()
+	if len(req.Rules) > 0 {
+		bundle := activeBundle{BundleID: ruleTestBundleID, Instruments: []string{req.Symbol}, Flags: map[string]interface{}{}}
+		docs := make([]ruleDocument, 0, len(req.Rules))
+		seen := make(map[string]bool, len(req.Rules))
+		for i, raw := range req.Rules {
+			var doc ruleDocument
+			if err := json.Unmarshal(raw, &doc); err != nil {
+				return nil, nil, fmt.Errorf("rule %d: %w", i, err)
+			}
+			if doc.RuleID == "" {
+				return nil, nil, fmt.Errorf("rule %d: rule_id is required", i)
+			}
+			if seen[doc.RuleID] {
+				return nil, nil, fmt.Errorf("rule %s: duplicate rule_id", doc.RuleID)
+			}
+			seen[doc.RuleID] = true
+			docs = append(docs, doc)
+			bundle.RuleIDs = append(bundle.RuleIDs, doc.RuleID)
+		}
+		compiled, err := buildConfigSnapshot(bundle, docs)
+		if err != nil {
+			return nil, nil, err
+		}
+		snapshot = compiled
+	}
+
+	strategies := s.strategies
+	if len(req.Strategies) > 0 {
+		strategies = make([]*strategy.Strategy, 0, len(req.Strategies))
+		for i, text := range req.Strategies {
+			st, err := strategy.Parse([]byte(text))
+			if err != nil {
+				return nil, nil, fmt.Errorf("strategy %d: %w", i, err)
+			}
+			strategies = append(strategies, st)
+		}
+	}
+
+	market := &harnessMarketData{nav: req.NAVUSDT}
+	if market.nav <= 0 {
+		market.nav = s.navUSDT
+	}
+	if market.nav <= 0 {
+		market.nav = defaultRuleTestNAVUSDT
+	}
+	if s.marketData != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), s.sizing.priceTimeout)
+		if filters, err := s.marketData.Filters(ctx, req.Symbol); err == nil {
+			market.filters = filters
+		}
+		cancel()
+	}
+
+	gk := *s.gateKeeper
+	gk.budget = nil
+	sandbox := &S3_STRATEGYServer{
+		validator:       s.validator,
+		version:         s.version,
+		startTime:       s.startTime,
+		gateKeeper:      &gk,
+		mlModel:         s.mlModel,
+		configManager:   &ConfigManager{},
+		sizing:          s.sizing,
+		marketData:      market,
+		direction:       s.direction,
+		strategies:      strategies,
+		strategyRunner:  &strategy.Runner{Store: strategy.NewMemoryPositionStore()},
+		navUSDT:         market.nav,
+		riskLimits:      make(map[string]float64),
+		positionTracker: make(map[string]float64),
+	}
+	sandbox.configManager.Swap(snapshot)
+	return sandbox, market, nil
+}
+
+// recordedSignals 讀取 signals 中交易對的已記錄特徵（依時間排序，略過影子記錄；多實例同一信號只取一筆）
+func (s *S3_STRATEGYServer) recordedSignals(ctx context.Context, req *dao.RuleTestRequest) ([]ruleTestInput, error) {
+	if s.arangodbClient == nil {
+		return nil, errNoSignalHistory
+	}
+	limit := req.Window.Limit
+	if limit <= 0 {
+		limit = defaultRuleTestWindow
+	}
+	query := `FOR sig IN @@col
+		FILTER sig.symbol == @symbol && sig.market == @market && sig.shadow != true
+			&& sig.timestamp >= @from && (@to == 0 || sig.timestamp <= @to)
+		SORT sig.timestamp
+		LIMIT @limit
+		RETURN sig`
+	bindVars := map[string]interface{}{
+		"@col":   signalsCollection,
+		"symbol": req.Symbol,
+		"market": string(req.Market),
+		"from":   req.Window.From,
+		"to":     req.Window.To,
+		"limit":  limit,
+	}
+	cursor, err := s.arangodbClient.GetDB().Query(ctx, query, bindVars)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close()
+
+	var rows []ruleTestInput
+	seen := make(map[string]bool)
+	for cursor.HasMore() {
+		var signal dao.Signal
+		if _, err := cursor.ReadDocument(ctx, &signal); err != nil {
+			return nil, err
+		}
+		if seen[signal.SignalID] {
+			continue
+		}
+		seen[signal.SignalID] = true
+		rows = append(rows, ruleTestInput{signalID: signal.SignalID, features: signal.Features, recorded: signal.Decision})
+	}
+	return rows, nil
+}
+
+// runRuleTest 逐列執行沙盒決策；持倉（規則路徑與策略規格）在列間延續，可驗證進場到出場的完整流程
+func (s *S3_STRATEGYServer) runRuleTest(req *dao.RuleTestRequest, rows []ruleTestInput) (dao.RuleTestResponse, error) {
+	sandbox, market, err := s.ruleSandbox(req)
+	if err != nil {
+		return dao.RuleTestResponse{}, err
+	}
+	response := dao.RuleTestResponse{
+		Rules:   sandbox.configManager.Active().Config.Rules,
+		Rows:    make([]dao.RuleTestResult, 0, len(rows)),
+		Summary: make(map[string]int),
+	}
+	response.Strategies = make([]string, 0, len(sandbox.strategies))
+	for _, st := range sandbox.strategies {
+		response.Strategies = append(response.Strategies, st.Name())
+	}
+
+	for i, row := range rows {
+		features := row.features
+		price := row.price
+		if price <= 0 {
+			price = referencePrice(features)
+		} else if referencePrice(features) <= 0 {
+			// 策略規格以特徵中的參考價判斷進出場
+			features = make(dao.FeatureSet, len(row.features)+1)
+			for k, v := range row.features {
+				features[k] = v
+			}
+			features["mark_price"] = price
+		}
+		market.price = price
+
+		signalID := row.signalID
+		if signalID == "" {
+			signalID = fmt.Sprintf("test-%d", i)
+		}
+		decided := sandbox.decide(&dao.DecideRequest{
+			SignalID:  signalID,
+			Symbol:    req.Symbol,
+			Market:    req.Market,
+			Features:  features,
+			ConfigRev: "CURRENT",
+		})
+		result := dao.RuleTestResult{
+			Row:         i,
+			SignalID:    signalID,
+			Decision:    decided.Decision,
+			Intents:     decided.Intents,
+			Transitions: decided.Transitions,
+			Trace:       decided.Trace,
+			Recorded:    row.recorded,
+		}
+		for _, out := range decided.Strategies {
+			if out.Strategy == decided.Decision.Strategy {
+				result.RulesFired = out.RulesFired
+				break
+			}
+		}
+		response.Rows = append(response.Rows, result)
+		response.Summary[string(decided.Decision.Action)]++
+	}
+	return response, nil
+}
+
+// @Summary Test rules and strategy specs
+// @Description Replay feature rows or recorded signals through a sandboxed decision pipeline with the given rules and strategy specs
+// @Tags strategy
+// @Accept json
+// @Produce json
+// @Param request body apispec.RuleTestRequest true "Rule test request"
+// @Success 200 {object} apispec.RuleTestResponse
+// @Failure 400 {object} map[string]string
+// @Failure 503 {object} map[string]string
+// @Router /rules/test [post]
+func (s *S3_STRATEGYServer) RunRuleTest(c *gin.Context) {
+	var req dao.RuleTestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format", "details": err.Error()})
+		return
+	}
+	if err := s.validator.Struct(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed", "details": err.Error()})
+		return
+	}
+	if (len(req.Rows) == 0) == (req.Window == nil) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid test input", "details": "exactly one of rows or window is required"})
+		return
+	}
+	if len(req.Rows) > maxRuleTestRows || (req.Window != nil && req.Window.Limit > maxRuleTestRows) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid test input", "details": fmt.Sprintf("at most %d rows per test", maxRuleTestRows)})
+		return
+	}
+
+	var rows []ruleTestInput
+	if req.Window != nil {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), ruleTestQueryTimeout)
+		defer cancel()
+		recorded, err := s.recordedSignals(ctx, &req)
+		if errors.Is(err, errNoSignalHistory) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Signal history unavailable", "details": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load recorded signals", "details": err.Error()})
+			return
+		}
+		rows = recorded
+	} else {
+		for _, row := range req.Rows {
+			rows = append(rows, ruleTestInput{signalID: row.SignalID, price: row.Price, features: row.Features})
+		}
+	}
+
+	response, err := s.runRuleTest(&req, rows)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rules or strategy specs", "details": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
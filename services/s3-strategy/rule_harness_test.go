@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v2"
+
+	"s3-strategy/dao"
+)
+
+// ruleFixture testdata/rules/*.yaml：規則/策略規格、依序評估的特徵列與每列預期決策
+type ruleFixture struct {
+	Symbol     string        `yaml:"symbol"`
+	Market     string        `yaml:"market"`
+	NAVUSDT    float64       `yaml:"nav_usdt"`
+	Rules      []fixtureRule `yaml:"rules"`      // 空值使用內建預設規則
+	Strategies []string      `yaml:"strategies"` // 策略規格檔（相對於 fixture 所在目錄）
+	Rows       []fixtureRow  `yaml:"rows"`
+}
+
+type fixtureRule struct {
+	RuleID   string                 `yaml:"rule_id"`
+	RuleType string                 `yaml:"rule_type"`
+	When     string                 `yaml:"when"`
+	Actions  map[string]interface{} `yaml:"actions"`
+	Priority int                    `yaml:"priority"`
+}
+
+type fixtureRow struct {
+	Name     string                 `yaml:"name"`
+	Price    float64                `yaml:"price"`
+	Features map[string]interface{} `yaml:"features"`
+	Expect   fixtureExpect          `yaml:"expect"`
+}
+
+// fixtureExpect 未列出的欄位不比對；intents 為 <strategy>:<kind>、transitions 為 <strategy>:<to>，皆依序
+type fixtureExpect struct {
+	Action      string   `yaml:"action"`
+	Side        string   `yaml:"side"`
+	Reason      string   `yaml:"reason"` // 子字串
+	RulesFired  []string `yaml:"rules_fired"`
+	Intents     []string `yaml:"intents"`
+	Transitions []string `yaml:"transitions"`
+}
+
+// loadRuleFixture 讀取 YAML fixture 並轉為 /rules/test 請求
+func loadRuleFixture(t *testing.T, path string) (ruleFixture, dao.RuleTestRequest) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fx ruleFixture
+	// 非嚴格模式：yaml.v2 嚴格模式會把合併鍵（<<: *entry）後的覆寫視為重複鍵
+	if err := yaml.Unmarshal(data, &fx); err != nil {
+		t.Fatalf("%s: %v", path, err)
+	}
+	req := dao.RuleTestRequest{Symbol: fx.Symbol, Market: dao.Market(fx.Market), NAVUSDT: fx.NAVUSDT}
+	for _, rule := range fx.Rules {
+		raw, err := json.Marshal(map[string]interface{}{
+			"rule_id": rule.RuleID, "rule_type": rule.RuleType, "when": rule.When, "actions": rule.Actions, "priority": rule.Priority,
+		})
+		if err != nil {
+			t.Fatalf("%s: rule %s: %v", path, rule.RuleID, err)
+		}
+		req.Rules = append(req.Rules, raw)
+	}
+	for _, spec := range fx.Strategies {
+		text, err := os.ReadFile(filepath.Join(filepath.Dir(path), spec))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Strategies = append(req.Strategies, string(text))
+	}
+	for _, row := range fx.Rows {
+		req.Rows = append(req.Rows, dao.RuleTestRow{Price: row.Price, Features: row.Features})
+	}
+	return fx, req
+}
+
+// postRuleTest 呼叫 POST /rules/test（請求經 JSON 編碼，特徵數值與線上一致為 float64）
+func postRuleTest(t *testing.T, s *S3_STRATEGYServer, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	payload, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/rules/test", s.RunRuleTest)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/rules/test", strings.NewReader(string(payload))))
+	return w
+}
+
+// runRuleFixture 經 POST /rules/test 執行 fixture，逐列比對預期決策
+func runRuleFixture(t *testing.T, s *S3_STRATEGYServer, path string) {
+	t.Helper()
+	fx, req := loadRuleFixture(t, path)
+	w := postRuleTest(t, s, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	var response dao.RuleTestResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Rows) != len(fx.Rows) {
+		t.Fatalf("rows = %d, want %d", len(response.Rows), len(fx.Rows))
+	}
+
+	for i, row := range fx.Rows {
+		got, want := response.Rows[i], row.Expect
+		var mismatches []string
+		check := func(field, got, want string) {
+			if got != want {
+				mismatches = append(mismatches, field+" = "+got+", want "+want)
+			}
+		}
+		if want.Action != "" {
+			check("action", string(got.Decision.Action), want.Action)
+		}
+		if want.Side != "" {
+			check("side", string(got.Decision.Side), want.Side)
+		}
+		if want.Reason != "" && !strings.Contains(got.Decision.Reason, want.Reason) {
+			mismatches = append(mismatches, "reason = "+got.Decision.Reason+", want containing "+want.Reason)
+		}
+		if want.RulesFired != nil {
+			check("rules_fired", strings.Join(got.RulesFired, ","), strings.Join(want.RulesFired, ","))
+		}
+		if want.Intents != nil {
+			var intents []string
+			for _, intent := range got.Intents {
+				intents = append(intents, intent.Strategy+":"+string(intent.Kind))
+			}
+			check("intents", strings.Join(intents, ","), strings.Join(want.Intents, ","))
+		}
+		if want.Transitions != nil {
+			var transitions []string
+			for _, tr := range got.Transitions {
+				transitions = append(transitions, tr.Strategy+":"+tr.To)
+			}
+			check("transitions", strings.Join(transitions, ","), strings.Join(want.Transitions, ","))
+		}
+		if len(mismatches) > 0 {
+			t.Errorf("row %d (%s): %s\n  reason: %s", i, row.Name, strings.Join(mismatches, "; "), got.Decision.Reason)
+		}
+	}
+}
+
+func TestRuleFixtures(t *testing.T) {
+	paths, err := filepath.Glob("testdata/rules/*.yaml")
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("no rule fixtures: %v", err)
+	}
+	for _, path := range paths {
+		path := path
+		t.Run(strings.TrimSuffix(filepath.Base(path), ".yaml"), func(t *testing.T) {
+			runRuleFixture(t, newTestServer(t), path)
+		})
+	}
+}
+
+func TestRunRuleTest(t *testing.T) {
+	s := newTestServer(t)
+	rows := []dao.RuleTestRow{{Price: 60000, Features: hostedFeatures(nil)}}
+
+	// 沙盒不影響線上持倉；回傳規則清單、彙總與追蹤
+	w := postRuleTest(t, s, dao.RuleTestRequest{Symbol: "BTCUSDT", Market: dao.MarketFUT, Rows: rows})
+	var response dao.RuleTestResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	if strings.Join(response.Rules, ",") != "R-001,R-002" || response.Summary["open"] != 1 || response.Rows[0].SignalID != "test-0" || response.Rows[0].Trace == nil {
+		t.Errorf("response = %+v", response)
+	}
+	if pos := s.rulePosition(rulePathStrategy, "BTCUSDT"); pos != nil {
+		t.Errorf("sandbox leaked position %+v", pos)
+	}
+
+	for name, tc := range map[string]struct {
+		body interface{}
+		code int
+		want string
+	}{
+		"no input":      {dao.RuleTestRequest{Symbol: "BTCUSDT", Market: dao.MarketFUT}, http.StatusBadRequest, "exactly one of rows or window"},
+		"both inputs":   {dao.RuleTestRequest{Symbol: "BTCUSDT", Market: dao.MarketFUT, Rows: rows, Window: &dao.SignalWindow{From: 1}}, http.StatusBadRequest, "exactly one of rows or window"},
+		"bad rule":      {map[string]interface{}{"symbol": "BTCUSDT", "market": "FUT", "rows": rows, "rules": []interface{}{map[string]interface{}{"rule_id": "X", "rule_type": "ENTRY", "when": "x >"}}}, http.StatusBadRequest, "rules-test rev 0 rejected"},
+		"bad strategy":  {dao.RuleTestRequest{Symbol: "BTCUSDT", Market: dao.MarketFUT, Rows: rows, Strategies: []string{"strategy: s\nunknown: 1\n"}}, http.StatusBadRequest, "strategy 0"},
+		"no history db": {dao.RuleTestRequest{Symbol: "BTCUSDT", Market: dao.MarketFUT, Window: &dao.SignalWindow{From: 1}}, http.StatusServiceUnavailable, "arangodb not connected"},
+	} {
+		if w := postRuleTest(t, s, tc.body); w.Code != tc.code || !strings.Contains(w.Body.String(), tc.want) {
+			t.Errorf("%s: %d %s", name, w.Code, w.Body.String())
+		}
+	}
+}
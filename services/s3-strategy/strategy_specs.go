@@ -0,0 +1,332 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"s3-strategy/dao"
+	"s3-strategy/internal/config"
+	"s3-strategy/internal/services/redis"
+	"s3-strategy/internal/sizing"
+	"s3-strategy/internal/strategy"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 策略規格預設值（env.yaml strategies 區塊未設定時使用）
+const (
+	defaultStrategySpecDir = "strategies"
+	posEventsStream        = "pos:events"
+)
+
+// initializeStrategies 載入策略規格並建立持倉狀態存取（Redis 未連線時改用記憶體）
+func (s *S3_STRATEGYServer) initializeStrategies() {
+	store := strategy.PositionStore(strategy.NewMemoryPositionStore())
+	if s.redisClient != nil {
+		store = strategy.NewRedisPositionStore(s.redisClient.Client)
+	}
+	s.strategyRunner = &strategy.Runner{Store: store}
+	s.navUSDT = config.AppConfig.Strategies.NAVUSDT
+
+	dir := config.AppConfig.Strategies.SpecDir
+	if dir == "" {
+		dir = defaultStrategySpecDir
+	}
+	strategies, err := strategy.LoadDir(dir)
+	if err != nil {
+		log.Printf("Failed to load strategy specs from %s: %v", dir, err)
+		return
+	}
+	s.strategies = strategies
+	log.Printf("Loaded %d strategy specs from %s", len(strategies), dir)
+}
+
+// evaluateStrategies 對涵蓋該交易對的策略規格評估進場/出場；allowEntry 回傳 false（守門未通過、交易時段外、停止交易事件或停止進場開關）時只管理既有持倉
+func (s *S3_STRATEGYServer) evaluateStrategies(req *dao.DecideRequest, allowEntry func(name string) bool) ([]dao.OrderIntent, []dao.PositionTransition) {
+	if s.strategyRunner == nil || len(s.strategies) == 0 {
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	nav := s.navUSDT
+	filtersErr := errMarketDataUnavailable
+	var filters sizing.Filters
+	if s.marketData != nil {
+		if live, err := s.marketData.NAV(ctx); err == nil {
+			nav = live
+		}
+		filters, filtersErr = s.marketData.Filters(ctx, req.Symbol)
+	}
+	if filtersErr != nil {
+		// 無交易所限制時無法取整下單量：只管理既有持倉
+		log.Printf("Strategy specs on %s: entries disabled, filters unavailable: %v", req.Symbol, filtersErr)
+	}
+	in := strategy.Input{
+		Symbol:   req.Symbol,
+		Features: req.Features,
+		Price:    referencePrice(req.Features),
+		NAV:      nav,
+		NowMs:    time.Now().UnixMilli(),
+		Filters:  filters,
+	}
+
+	var intents []dao.OrderIntent
+	var transitions []dao.PositionTransition
+	for _, st := range s.strategies {
+		in.AllowEntry, in.MaxNotional = allowEntry(st.Name()) && filtersErr == nil, 0
+		// 先評估不寫回：進場/加倉須通過組合層預檢並暫占額度後才寫回持倉
+		res, err := s.strategyRunner.Process(ctx, st, in, true)
+		if err != nil {
+			log.Printf("Strategy %s on %s: %v", st.Name(), req.Symbol, err)
+			continue
+		}
+		var orders []dao.OrderIntent
+		if !req.DryRun {
+			if res, orders, err = s.commitStrategy(ctx, req, st, in, res); err != nil {
+				// 版本衝突代表其他副本已處理同一快照，本次結果捨棄
+				log.Printf("Strategy %s on %s: %v", st.Name(), req.Symbol, err)
+				continue
+			}
+		}
+		for _, warning := range res.Warnings {
+			log.Printf("Strategy %s on %s advisory: %s", st.Name(), req.Symbol, warning)
+		}
+		for _, tr := range res.Transitions {
+			transition := dao.PositionTransition{Strategy: st.Name(), Symbol: req.Symbol, From: tr.From, To: tr.To, Event: tr.Event, Ts: tr.Ts}
+			transitions = append(transitions, transition)
+			if !req.DryRun {
+				s.publishTransition(ctx, transition, res.Position)
+			}
+		}
+		intents = append(intents, orders...)
+	}
+	return intents, transitions
+}
+
+// commitStrategy 進場/加倉依序經組合層預檢（降尺時以名義金額上限重新評估）與額度暫占；任一未通過時捨棄進場/加倉，
+// 以停止進場重新評估只管理既有持倉。寫回持倉後才記入未成交曝險；寫回失敗時釋放暫占
+func (s *S3_STRATEGYServer) commitStrategy(ctx context.Context, req *dao.DecideRequest, st *strategy.Strategy, in strategy.Input,
+	res strategy.Result) (strategy.Result, []dao.OrderIntent, error) {
+	inst := s.specInstance(st.Name())
+	orders := s.strategyOrderIntents(req, res)
+	limit, reason := s.checkStrategyPortfolio(ctx, req, res, orders, in.NAV)
+	if reason == "" && limit > 0 {
+		log.Printf("Strategy %s on %s: entry downsized to %.2f USDT by portfolio gate", st.Name(), req.Symbol, limit)
+		in.MaxNotional = limit
+		var err error
+		if res, err = s.strategyRunner.Process(ctx, st, in, true); err != nil {
+			return res, nil, err
+		}
+		orders = s.strategyOrderIntents(req, res)
+	}
+	if reason == "" {
+		_, reason = s.reserveStrategyEntries(inst, orders)
+	}
+	if reason != "" {
+		log.Printf("Strategy %s on %s: entry dropped, %s", st.Name(), req.Symbol, reason)
+		in.AllowEntry, in.MaxNotional = false, 0
+		var err error
+		if res, err = s.strategyRunner.Process(ctx, st, in, true); err != nil {
+			return res, nil, err
+		}
+		orders = s.strategyOrderIntents(req, res)
+	}
+	if err := s.strategyRunner.Commit(ctx, res); err != nil {
+		s.releaseStrategyEntries(inst, orders)
+		return res, nil, err
+	}
+	for i := range orders {
+		if isEntryIntent(&orders[i]) {
+			s.trackPending(&orders[i], res.Position.Side, res.Position.Score)
+		}
+	}
+	return res, orders, nil
+}
+
+// checkStrategyPortfolio 策略規格進場/加倉的組合層預檢（與規則路徑相同的相關性、策略/資產類額度與淨 Delta）：
+// 回傳降尺後的名義金額上限（0 為不需降尺）或拒單原因；未啟用或無進場/加倉時直接通過
+func (s *S3_STRATEGYServer) checkStrategyPortfolio(ctx context.Context, req *dao.DecideRequest, res strategy.Result, orders []dao.OrderIntent,
+	nav float64) (float64, string) {
+	g := s.portfolio
+	if g == nil {
+		return 0, ""
+	}
+	var entry *dao.OrderIntent
+	for i := range orders {
+		if isEntryIntent(&orders[i]) {
+			entry = &orders[i]
+			break
+		}
+	}
+	if entry == nil {
+		return 0, ""
+	}
+	// 本策略在本標的的既有曝險為評估後持倉扣除本次進場/加倉
+	current := *res.Position
+	current.Qty -= entry.Qty
+	book, err := s.portfolioBook(ctx, res.Strategy, req.Symbol, &current)
+	if err != nil {
+		return 0, "portfolio: " + err.Error()
+	}
+	rho, _ := g.correlations.lookup(ctx)
+	cand := exposure{strategy: res.Strategy, symbol: req.Symbol, side: res.Position.Side, notional: entry.NotionalUSDT, score: res.Position.Score}
+	out := g.evaluate(book, cand, nav, rho)
+	if out.reason != "" {
+		return 0, "portfolio: " + out.reason
+	}
+	if out.allowed < entry.NotionalUSDT {
+		return out.allowed, ""
+	}
+	return 0, ""
+}
+
+// strategyOrderIntents 評估結果的全部下單意圖
+func (s *S3_STRATEGYServer) strategyOrderIntents(req *dao.DecideRequest, res strategy.Result) []dao.OrderIntent {
+	orders := make([]dao.OrderIntent, 0, len(res.Intents))
+	for _, intent := range res.Intents {
+		orders = append(orders, s.strategyOrderIntent(req, res.Strategy, res.Position, intent))
+	}
+	return orders
+}
+
+// isEntryIntent 進場/加倉（須暫占額度）；出場、止盈與止損不占額度
+func isEntryIntent(intent *dao.OrderIntent) bool {
+	return intent.Kind == dao.IntentEntry || intent.Kind == dao.IntentAdd
+}
+
+// reserveStrategyEntries 依序暫占進場/加倉的帳戶層與策略額度；任一筆失敗時回滾已暫占者
+func (s *S3_STRATEGYServer) reserveStrategyEntries(inst *ruleInstance, orders []dao.OrderIntent) (bool, string) {
+	for i := range orders {
+		if !isEntryIntent(&orders[i]) {
+			continue
+		}
+		if ok, reason := s.reserveEntry(inst, &orders[i]); !ok {
+			s.releaseStrategyEntries(inst, orders[:i])
+			return false, reason
+		}
+	}
+	return true, ""
+}
+
+// releaseStrategyEntries 回滾 reserveStrategyEntries 的暫占
+func (s *S3_STRATEGYServer) releaseStrategyEntries(inst *ruleInstance, orders []dao.OrderIntent) {
+	for i := range orders {
+		if isEntryIntent(&orders[i]) {
+			s.releaseEntry(inst, &orders[i])
+		}
+	}
+}
+
+// strategyOrderIntent 轉為 S4 下單意圖；intent_id 由策略、交易對、開倉時間與序號組成，重送時保持不變。
+// 數量與觸發價已依交易所限制取整；槓桿取持倉記錄的進場槓桿，未記錄時為 sizing.leverage（SPOT 為 1）
+func (s *S3_STRATEGYServer) strategyOrderIntent(req *dao.DecideRequest, name string, pos *strategy.Position, intent strategy.Intent) dao.OrderIntent {
+	px := intent.Price
+	if intent.TriggerPx > 0 {
+		px = intent.TriggerPx
+	}
+	leverage := s.sizing.leverage
+	if pos.Leverage > 0 {
+		leverage = pos.Leverage
+	}
+	if req.Market == dao.MarketSPOT {
+		leverage = 1
+	}
+	return dao.OrderIntent{
+		IntentID:     fmt.Sprintf("%s-%s-%d-%d", name, req.Symbol, pos.OpenedAt, intent.Seq),
+		Symbol:       req.Symbol,
+		Market:       req.Market,
+		Kind:         intent.Kind,
+		Side:         intent.Side,
+		NotionalUSDT: intent.Qty * px,
+		Leverage:     leverage,
+		ExecPolicy: dao.ExecPolicy{
+			PreferMaker: intent.PreferMaker,
+			TWAPSlices:  1,
+		},
+		Qty:        intent.Qty,
+		TriggerPx:  intent.TriggerPx,
+		ReduceOnly: intent.ReduceOnly,
+		Strategy:   name,
+		Reason:     intent.Reason,
+	}
+}
+
+// publishTransition 發布 pos:events（type=state_changed）
+func (s *S3_STRATEGYServer) publishTransition(ctx context.Context, tr dao.PositionTransition, pos *strategy.Position) {
+	if s.redisClient == nil {
+		return
+	}
+	message := redis.StreamMessage{
+		"type":     "state_changed",
+		"strategy": tr.Strategy,
+		"symbol":   tr.Symbol,
+		"from":     tr.From,
+		"to":       tr.To,
+		"event":    tr.Event,
+		"ts":       tr.Ts,
+	}
+	if pos != nil {
+		message["side"] = string(pos.Side)
+		message["qty"] = pos.Qty
+		message["stop_px"] = pos.StopPx
+		message["forbid_add_on"] = pos.Flags["forbid_add_on"]
+	}
+	if _, err := s.redisClient.PublishStream(ctx, posEventsStream, message); err != nil {
+		log.Printf("Failed to publish %s transition for %s: %v", tr.Strategy, tr.Symbol, err)
+	}
+}
+
+// referencePrice 參考價：mark_price → close → price
+func referencePrice(features dao.FeatureSet) float64 {
+	for _, name := range []string{"mark_price", "close", "price"} {
+		if px, ok := features[name].(float64); ok && px > 0 {
+			return px
+		}
+	}
+	return 0
+}
+
+// @Summary List strategy specs
+// @Description List loaded YAML strategy specs
+// @Tags strategy
+// @Produce json
+// @Success 200 {array} strategy.Spec
+// @Router /strategies [get]
+func (s *S3_STRATEGYServer) ListStrategies(c *gin.Context) {
+	specs := make([]strategy.Spec, 0, len(s.strategies))
+	for _, st := range s.strategies {
+		specs = append(specs, st.Spec)
+	}
+	c.JSON(http.StatusOK, specs)
+}
+
+// @Summary Get strategy position
+// @Description Get the position state kept by a strategy spec for a symbol
+// @Tags strategy
+// @Produce json
+// @Param name path string true "Strategy name"
+// @Param symbol path string true "Symbol"
+// @Success 200 {object} strategy.Position
+// @Failure 404 {object} map[string]string
+// @Router /strategies/{name}/positions/{symbol} [get]
+func (s *S3_STRATEGYServer) GetStrategyPosition(c *gin.Context) {
+	name, symbol := c.Param("name"), c.Param("symbol")
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 2*time.Second)
+	defer cancel()
+
+	pos, err := s.strategyRunner.Store.Get(ctx, name, symbol)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load position", "details": err.Error()})
+		return
+	}
+	if pos == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Position not found", "details": fmt.Sprintf("%s/%s", name, symbol)})
+		return
+	}
+	c.JSON(http.StatusOK, pos)
+}
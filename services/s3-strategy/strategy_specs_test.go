@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"s3-strategy/dao"
+	"s3-strategy/internal/risk"
+	"s3-strategy/internal/strategy"
+)
+
+const trendSpec = "ew_trend_follow_4h_anchor_v1"
+
+// newSpecServer 只載入 4h 趨勢策略規格的測試伺服器
+func newSpecServer(t *testing.T) *S3_STRATEGYServer {
+	t.Helper()
+	s := newTestServer(t)
+	specs, err := strategy.LoadDir("strategies")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, st := range specs {
+		if st.Name() == trendSpec {
+			s.strategies = append(s.strategies, st)
+		}
+	}
+	return s
+}
+
+func trendEntryRequest(signalID, symbol string) *dao.DecideRequest {
+	return &dao.DecideRequest{SignalID: signalID, Symbol: symbol, Market: dao.MarketFUT, Features: dao.FeatureSet{
+		"mark_price": 60000.0, "wave_signal_4h": "end_of_2_confirmed", "wave_impulse_score_4h": 0.8, "rvol_4h": 1.2,
+		"wave_direction_4h": "UP", "ew_confidence_4h": 0.9, "wave_invalidation_px_4h": 58333.33, "wave_leg_w1_4h": 3000.0, "atr_4h": 500.0,
+	}}
+}
+
+func TestEvaluateStrategies_OrderIntents(t *testing.T) {
+	s := newSpecServer(t)
+	req := trendEntryRequest("sig-1", "BTCUSDT")
+
+	// 風險 125 USDT；止損 58333.33 往下取整為 58333.3，數量 125 / 1666.7 = 0.07499 捨去為 0.074；槓桿取 sizing.leverage
+	intents, _ := s.evaluateStrategies(req, func(string) bool { return true })
+	if len(intents) != 2 {
+		t.Fatalf("intents = %+v", intents)
+	}
+	entry, stop := intents[0], intents[1]
+	if entry.Kind != dao.IntentEntry || entry.Qty != 0.074 || entry.Leverage != s.sizing.leverage || entry.NotionalUSDT != 0.074*60000 {
+		t.Errorf("entry = %+v", entry)
+	}
+	if stop.Kind != dao.IntentSL || stop.Qty != 0.074 || stop.TriggerPx != 58333.3 || !stop.ReduceOnly {
+		t.Errorf("stop = %+v", stop)
+	}
+
+	// 無交易所限制時不進場
+	s.marketData = nil
+	req.Symbol = "ETHUSDT"
+	if intents, _ = s.evaluateStrategies(req, func(string) bool { return true }); len(intents) != 0 {
+		t.Errorf("entered without filters: %+v", intents)
+	}
+}
+
+func TestEvaluateStrategies_ReservesEntries(t *testing.T) {
+	s := newSpecServer(t)
+	ctx := context.Background()
+	ledger := risk.NewMemoryLedger()
+	s.gateKeeper.budget = risk.NewBudget(ledger, risk.Limits{FutMarginUSDT: 5000, SpotQuoteUSDT: 10000, ConcurrentEntries: 2, ReservationTTL: time.Minute})
+	inst := &ruleInstance{name: trendSpec, budget: s.scopedBudget(trendSpec, 1, 0, 0)}
+	s.specInstances = map[string]*ruleInstance{trendSpec: inst}
+	allow := func(string) bool { return true }
+
+	// 策略額度不足：捨棄進場、不寫回持倉，並回滾帳戶層暫占
+	if intents, _ := s.evaluateStrategies(trendEntryRequest("sig-1", "BTCUSDT"), allow); len(intents) != 0 {
+		t.Fatalf("entered over budget: %+v", intents)
+	}
+	if pos, _ := s.strategyRunner.Store.Get(ctx, trendSpec, "BTCUSDT"); pos != nil {
+		t.Errorf("position saved without reservation: %+v", pos)
+	}
+	if n, _ := ledger.Usage(ctx, risk.ConcurrencyKey("BTCUSDT")); n != 0 {
+		t.Errorf("account concurrency after rollback = %v", n)
+	}
+
+	// 額度足夠：帳戶層與策略額度皆暫占，成交回報後一併釋放
+	inst.budget = s.scopedBudget(trendSpec, 2000, 0, 0)
+	intents, _ := s.evaluateStrategies(trendEntryRequest("sig-2", "BTCUSDT"), allow)
+	if len(intents) != 2 || intents[0].Kind != dao.IntentEntry {
+		t.Fatalf("intents = %+v", intents)
+	}
+	if pos, _ := s.strategyRunner.Store.Get(ctx, trendSpec, "BTCUSDT"); !isOpen(pos) {
+		t.Errorf("position = %+v", pos)
+	}
+	strategyKey := "risk:concurrency:strategy:" + trendSpec + ":{BTCUSDT}"
+	for _, key := range []string{risk.ConcurrencyKey("BTCUSDT"), strategyKey} {
+		if n, _ := ledger.Usage(ctx, key); n != 1 {
+			t.Errorf("%s = %v", key, n)
+		}
+	}
+	if err := s.releaseInstances(ctx, intents[0].IntentID, "BTCUSDT", dao.MarketFUT); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := ledger.Usage(ctx, strategyKey); n != 0 {
+		t.Errorf("strategy concurrency after release = %v", n)
+	}
+}
+
+func TestEvaluateStrategies_PortfolioGate(t *testing.T) {
+	s := newSpecServer(t)
+	ctx := context.Background()
+	s.portfolio = testPortfolioGate()
+	allow := func(string) bool { return true }
+
+	// 策略額度 0.25 NAV：4440 USDT 降尺至 2500，以上限重新評估（0.0416 捨去為 0.041），止損數量一致並記入未成交曝險
+	intents, _ := s.evaluateStrategies(trendEntryRequest("sig-1", "BTCUSDT"), allow)
+	if len(intents) != 2 || intents[0].Kind != dao.IntentEntry || intents[0].Qty != 0.041 || intents[1].Qty != 0.041 {
+		t.Fatalf("intents = %+v", intents)
+	}
+	if pos, _ := s.strategyRunner.Store.Get(ctx, trendSpec, "BTCUSDT"); !isOpen(pos) || pos.Qty != 0.041 {
+		t.Errorf("position = %+v", pos)
+	}
+	if pending, _ := s.portfolio.pending.List(ctx); len(pending) != 1 || pending[0].IntentID != intents[0].IntentID || pending[0].Strategy != trendSpec {
+		t.Errorf("pending = %+v", pending)
+	}
+
+	// 淨 Delta 超出 0.3 NAV（skip_entry）：拒單且不寫回持倉
+	s.portfolio.byStrategy[trendSpec] = 1
+	if intents, _ = s.evaluateStrategies(trendEntryRequest("sig-2", "ETHUSDT"), allow); len(intents) != 0 {
+		t.Fatalf("entered past net delta: %+v", intents)
+	}
+	if pos, _ := s.strategyRunner.Store.Get(ctx, trendSpec, "ETHUSDT"); pos != nil {
+		t.Errorf("position saved after reject: %+v", pos)
+	}
+}